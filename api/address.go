@@ -0,0 +1,322 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/token"
+)
+
+// userAddressRequest defines the payload for creating or replacing an address.
+// Fields:
+// - Type: billing, shipping, or mailing.
+// - Label: Optional name shown to the user, e.g. "Office".
+// - IsDefault: Makes this the default address, whose location is mirrored in the profile.
+type userAddressRequest struct {
+	Type          string `json:"type" binding:"required,oneof=billing shipping mailing"`
+	Label         string `json:"label" binding:"max=64"`
+	IsDefault     bool   `json:"is_default"`
+	StreetAddress string `json:"street_address" binding:"required"`
+	City          string `json:"city" binding:"required"`
+	State         string `json:"state" binding:"required"`
+	Zip           string `json:"zip"`
+	CountryCode   string `json:"country_code" binding:"required"`
+}
+
+type userAddressResponse struct {
+	ID            uuid.UUID `json:"id"`
+	UserID        uuid.UUID `json:"user_id"`
+	Type          string    `json:"type"`
+	Label         string    `json:"label"`
+	IsDefault     bool      `json:"is_default"`
+	StreetAddress string    `json:"street_address"`
+	City          string    `json:"city"`
+	State         string    `json:"state"`
+	Zip           string    `json:"zip"`
+	CountryCode   string    `json:"country_code"`
+	CreatedAt     string    `json:"created_at"`
+	UpdatedAt     string    `json:"updated_at"`
+}
+
+func newUserAddressResponse(address db.UserAddress) userAddressResponse {
+	return userAddressResponse{
+		ID:            address.ID,
+		UserID:        address.UserID,
+		Type:          address.Type,
+		Label:         address.Label,
+		IsDefault:     address.IsDefault,
+		StreetAddress: address.StreetAddress,
+		City:          address.City,
+		State:         address.State,
+		Zip:           address.Zip,
+		CountryCode:   address.CountryCode,
+		CreatedAt:     address.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     address.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// addressOwner parses the user id of an address route and checks the caller may manage that user's addresses.
+// Users manage their own addresses; admins manage everyone's. The error has already been sent when ok is false.
+func (server *Server) addressOwner(ctx *gin.Context) (uuid.UUID, bool) {
+	return server.selfOrAdmin(ctx, "You are not authorized to manage this user's addresses")
+}
+
+// selfOrAdmin parses the :id user id of a route and checks the caller is that user or an admin.
+// The error has already been sent when ok is false.
+// Parameters:
+// - ctx: The request context.
+// - forbidden: The detail of the 403 sent to other users.
+func (server *Server) selfOrAdmin(ctx *gin.Context, forbidden string) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		apierror.Respond(ctx, invalidUUIDError("id", err))
+		return uuid.Nil, false
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return uuid.Nil, false
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if userID != authPayload.UserID && authPayload.RoleID != 3 {
+		apierror.Respond(ctx, apierror.Forbidden(forbidden))
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
+
+// addressID parses the address id of an address route. The error has already been sent when ok is false.
+func addressID(ctx *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(ctx.Param("address_id"))
+	if err != nil {
+		apierror.Respond(ctx, invalidUUIDError("address_id", err))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// ListUserAddresses handles GET /usertx/:id/addresses.
+// Returns the default address first, then the others oldest first.
+// Returns 400 for a bad UUID, 403 for other users' addresses unless admin, 404 if the user does not exist, 500 for server errors, 200 for success.
+func (server *Server) ListUserAddresses(ctx *gin.Context) {
+	userID, ok := server.addressOwner(ctx)
+	if !ok {
+		return
+	}
+
+	_, err := server.store.GetUser(ctx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("user not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	addresses, err := server.store.ListUserAddresses(ctx, userID)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	response := make([]userAddressResponse, 0, len(addresses))
+	for _, address := range addresses {
+		response = append(response, newUserAddressResponse(address))
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetUserAddress handles GET /usertx/:id/addresses/:address_id and returns the address with its ETag.
+// Returns 400 for a bad UUID, 403 for other users' addresses unless admin, 404 if not found, 500 for server errors, 200 for success.
+func (server *Server) GetUserAddress(ctx *gin.Context) {
+	userID, ok := server.addressOwner(ctx)
+	if !ok {
+		return
+	}
+	id, ok := addressID(ctx)
+	if !ok {
+		return
+	}
+
+	address, err := server.store.GetUserAddress(ctx, db.GetUserAddressParams{ID: id, UserID: userID})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("address not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.Header(etagHeaderKey, userAddressETag(address))
+	ctx.JSON(http.StatusOK, newUserAddressResponse(address))
+}
+
+// CreateUserAddress handles POST /usertx/:id/addresses.
+// The first address of a user always becomes the default. A new default replaces the previous one and its
+// location is copied into the profile.
+// Returns 400 for bad input, 403 for other users' addresses unless admin, 404 if the user does not exist, 500 for server errors, 200 for success.
+func (server *Server) CreateUserAddress(ctx *gin.Context) {
+	var req userAddressRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if err := normalizeAddress(&req.StreetAddress, &req.City, &req.State, &req.Zip, &req.CountryCode); err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	userID, ok := server.addressOwner(ctx)
+	if !ok {
+		return
+	}
+
+	address, err := server.store.CreateUserAddressTx(auditContext(ctx), db.CreateUserAddressParams{
+		UserID:        userID,
+		Type:          req.Type,
+		Label:         req.Label,
+		IsDefault:     req.IsDefault,
+		StreetAddress: req.StreetAddress,
+		City:          req.City,
+		State:         req.State,
+		Zip:           req.Zip,
+		CountryCode:   req.CountryCode,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("user not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.Header(etagHeaderKey, userAddressETag(address))
+	ctx.JSON(http.StatusOK, newUserAddressResponse(address))
+}
+
+// UpdateUserAddress handles PUT /usertx/:id/addresses/:address_id to replace an address.
+// Setting is_default makes it the default; the default cannot be unset this way. An If-Match header, when
+// present, must match the address ETag.
+// Returns 400 for bad input, 403 for other users' addresses unless admin, 404 if not found, 409 when unsetting the default, 412 on ETag mismatch, 500 for server errors, 200 for success.
+func (server *Server) UpdateUserAddress(ctx *gin.Context) {
+	var req userAddressRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if err := normalizeAddress(&req.StreetAddress, &req.City, &req.State, &req.Zip, &req.CountryCode); err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	userID, ok := server.addressOwner(ctx)
+	if !ok {
+		return
+	}
+	id, ok := addressID(ctx)
+	if !ok {
+		return
+	}
+
+	arg := db.UpdateUserAddressParams{
+		ID:            id,
+		UserID:        userID,
+		Type:          req.Type,
+		Label:         req.Label,
+		IsDefault:     req.IsDefault,
+		StreetAddress: req.StreetAddress,
+		City:          req.City,
+		State:         req.State,
+		Zip:           req.Zip,
+		CountryCode:   req.CountryCode,
+	}
+
+	if etag, ok := ifMatch(ctx); ok {
+		versions, err := parseETagVersions(etag, 1)
+		if err != nil {
+			apierror.Respond(ctx, apierror.PreconditionFailed(err.Error()))
+			return
+		}
+		arg.ExpectedVersion = versions[0]
+	}
+
+	address, err := server.store.UpdateUserAddressTx(auditContext(ctx), arg)
+	if err != nil {
+		server.addressChangeFailed(ctx, arg.ID, arg.UserID, arg.ExpectedVersion.Valid, err)
+		return
+	}
+
+	ctx.Header(etagHeaderKey, userAddressETag(address))
+	ctx.JSON(http.StatusOK, newUserAddressResponse(address))
+}
+
+// DeleteUserAddress handles DELETE /usertx/:id/addresses/:address_id.
+// The default address cannot be deleted. An If-Match header, when present, must match the address ETag.
+// Returns 400 for a bad UUID, 403 for other users' addresses unless admin, 404 if not found, 409 for the default address, 412 on ETag mismatch, 500 for server errors, 200 for success.
+func (server *Server) DeleteUserAddress(ctx *gin.Context) {
+	userID, ok := server.addressOwner(ctx)
+	if !ok {
+		return
+	}
+	id, ok := addressID(ctx)
+	if !ok {
+		return
+	}
+
+	arg := db.DeleteUserAddressParams{ID: id, UserID: userID}
+
+	if etag, ok := ifMatch(ctx); ok {
+		versions, err := parseETagVersions(etag, 1)
+		if err != nil {
+			apierror.Respond(ctx, apierror.PreconditionFailed(err.Error()))
+			return
+		}
+		arg.ExpectedVersion = versions[0]
+	}
+
+	address, err := server.store.DeleteUserAddressTx(auditContext(ctx), arg)
+	if err != nil {
+		server.addressChangeFailed(ctx, arg.ID, arg.UserID, arg.ExpectedVersion.Valid, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserAddressResponse(address))
+}
+
+// addressChangeFailed responds to an address update or delete that failed.
+// A change that matched no rows is a 412 when a version was expected and the address still exists, as in updateNotApplied.
+func (server *Server) addressChangeFailed(ctx *gin.Context, id, userID uuid.UUID, versionChecked bool, err error) {
+	if errors.Is(err, db.ErrDefaultAddressRequired) {
+		apierror.Respond(ctx, apierror.Conflict(apierror.CodeConflict, "the default address cannot be removed or unset; make another address the default first"))
+		return
+	}
+	if err != sql.ErrNoRows {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	if versionChecked {
+		_, err = server.store.GetUserAddress(ctx, db.GetUserAddressParams{ID: id, UserID: userID})
+		if err == nil {
+			apierror.Respond(ctx, apierror.PreconditionFailed(errPreconditionFailed.Error()))
+			return
+		}
+		if err != sql.ErrNoRows {
+			apierror.Respond(ctx, err)
+			return
+		}
+	}
+
+	apierror.Respond(ctx, apierror.NotFound("address not found"))
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+// addressTestStore keeps the addresses of one user and enforces a single default, as the SQL store does.
+type addressTestStore struct {
+	db.Store
+	user      db.User
+	addresses []db.UserAddress
+}
+
+func (s *addressTestStore) GetUser(_ context.Context, id uuid.UUID) (db.User, error) {
+	if id != s.user.ID {
+		return db.User{}, sql.ErrNoRows
+	}
+	return s.user, nil
+}
+
+func (s *addressTestStore) ListUserAddresses(_ context.Context, userID uuid.UUID) ([]db.UserAddress, error) {
+	if userID != s.user.ID {
+		return []db.UserAddress{}, nil
+	}
+	return s.addresses, nil
+}
+
+func (s *addressTestStore) GetUserAddress(_ context.Context, arg db.GetUserAddressParams) (db.UserAddress, error) {
+	for _, address := range s.addresses {
+		if address.ID == arg.ID && address.UserID == arg.UserID {
+			return address, nil
+		}
+	}
+	return db.UserAddress{}, sql.ErrNoRows
+}
+
+func (s *addressTestStore) CreateUserAddressTx(_ context.Context, arg db.CreateUserAddressParams) (db.UserAddress, error) {
+	if arg.UserID != s.user.ID {
+		return db.UserAddress{}, sql.ErrNoRows
+	}
+	if len(s.addresses) == 0 {
+		arg.IsDefault = true
+	}
+	if arg.IsDefault {
+		for i := range s.addresses {
+			s.addresses[i].IsDefault = false
+		}
+	}
+	address := db.UserAddress{
+		ID:            util.RandomUUID(),
+		UserID:        arg.UserID,
+		Type:          arg.Type,
+		Label:         arg.Label,
+		IsDefault:     arg.IsDefault,
+		StreetAddress: arg.StreetAddress,
+		City:          arg.City,
+		State:         arg.State,
+		Zip:           arg.Zip,
+		CountryCode:   arg.CountryCode,
+		Version:       1,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	s.addresses = append(s.addresses, address)
+	return address, nil
+}
+
+func (s *addressTestStore) UpdateUserAddressTx(_ context.Context, arg db.UpdateUserAddressParams) (db.UserAddress, error) {
+	for i, address := range s.addresses {
+		if address.ID != arg.ID || address.UserID != arg.UserID {
+			continue
+		}
+		if address.IsDefault && !arg.IsDefault {
+			return db.UserAddress{}, db.ErrDefaultAddressRequired
+		}
+		if arg.ExpectedVersion.Valid && arg.ExpectedVersion.Int32 != address.Version {
+			return db.UserAddress{}, sql.ErrNoRows
+		}
+		address.Type = arg.Type
+		address.Label = arg.Label
+		address.IsDefault = arg.IsDefault
+		address.Version++
+		s.addresses[i] = address
+		return address, nil
+	}
+	return db.UserAddress{}, sql.ErrNoRows
+}
+
+func (s *addressTestStore) DeleteUserAddressTx(_ context.Context, arg db.DeleteUserAddressParams) (db.UserAddress, error) {
+	for i, address := range s.addresses {
+		if address.ID != arg.ID || address.UserID != arg.UserID {
+			continue
+		}
+		if address.IsDefault {
+			return db.UserAddress{}, db.ErrDefaultAddressRequired
+		}
+		s.addresses = append(s.addresses[:i], s.addresses[i+1:]...)
+		return address, nil
+	}
+	return db.UserAddress{}, sql.ErrNoRows
+}
+
+func TestUserAddressLifecycle(t *testing.T) {
+	user := db.User{ID: util.RandomUUID(), UserName: "jsmith", Email: "john@example.com"}
+	server := newTestServer(t, &addressTestStore{user: user})
+
+	send := func(method, path string, body interface{}, callerID uuid.UUID, role int, header map[string]string) *httptest.ResponseRecorder {
+		var data []byte
+		if body != nil {
+			var err error
+			data, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(method, path, bytes.NewReader(data))
+		require.NoError(t, err)
+		for key, value := range header {
+			request.Header.Set(key, value)
+		}
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, callerID, role, time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	base := "/usertx/" + user.ID.String() + "/addresses"
+	address := map[string]interface{}{
+		"type":           "mailing",
+		"street_address": "1 Main St",
+		"city":           "Springfield",
+		"state":          "IL",
+		"zip":            "62701",
+		"country_code":   "US",
+	}
+
+	// The first address becomes the default even when it does not ask to.
+	recorder := send(http.MethodPost, base, address, user.ID, 1, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var first userAddressResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &first))
+	require.True(t, first.IsDefault)
+	require.Equal(t, `"1"`, recorder.Header().Get(etagHeaderKey))
+
+	address["type"] = "billing"
+	address["is_default"] = true
+	recorder = send(http.MethodPost, base, address, user.ID, 1, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var second userAddressResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &second))
+	require.True(t, second.IsDefault)
+
+	recorder = send(http.MethodGet, base, nil, user.ID, 1, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var list []userAddressResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	require.Len(t, list, 2)
+	require.False(t, list[0].IsDefault)
+
+	// The default address can neither be deleted nor unset.
+	require.Equal(t, http.StatusConflict, send(http.MethodDelete, base+"/"+second.ID.String(), nil, user.ID, 1, nil).Code)
+	address["is_default"] = false
+	require.Equal(t, http.StatusConflict, send(http.MethodPut, base+"/"+second.ID.String(), address, user.ID, 1, nil).Code)
+
+	address["label"] = "Home"
+	require.Equal(t, http.StatusPreconditionFailed,
+		send(http.MethodPut, base+"/"+first.ID.String(), address, user.ID, 1, map[string]string{ifMatchHeaderKey: `"7"`}).Code)
+	recorder = send(http.MethodPut, base+"/"+first.ID.String(), address, user.ID, 1, map[string]string{ifMatchHeaderKey: `"1"`})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, `"2"`, recorder.Header().Get(etagHeaderKey))
+
+	require.Equal(t, http.StatusOK, send(http.MethodDelete, base+"/"+first.ID.String(), nil, user.ID, 1, nil).Code)
+	require.Equal(t, http.StatusNotFound, send(http.MethodGet, base+"/"+first.ID.String(), nil, user.ID, 1, nil).Code)
+
+	// Other users need to be admins.
+	require.Equal(t, http.StatusForbidden, send(http.MethodGet, base, nil, util.RandomUUID(), 1, nil).Code)
+	require.Equal(t, http.StatusOK, send(http.MethodGet, base, nil, util.RandomUUID(), 3, nil).Code)
+
+	missing := "/usertx/" + util.RandomUUID().String() + "/addresses"
+	require.Equal(t, http.StatusNotFound, send(http.MethodGet, missing, nil, util.RandomUUID(), 3, nil).Code)
+	require.Equal(t, http.StatusBadRequest, send(http.MethodGet, base+"/not-a-uuid", nil, user.ID, 1, nil).Code)
+
+	delete(address, "type")
+	require.Equal(t, http.StatusBadRequest, send(http.MethodPost, base, address, user.ID, 1, nil).Code)
+}
+
+func TestUserAddressNormalization(t *testing.T) {
+	user := db.User{ID: util.RandomUUID(), UserName: "jsmith", Email: "john@example.com"}
+	server := newTestServer(t, &addressTestStore{user: user})
+	path := "/usertx/" + user.ID.String() + "/addresses"
+
+	testCases := []struct {
+		name          string
+		body          map[string]interface{}
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Normalized",
+			body: map[string]interface{}{
+				"type":           "billing",
+				"street_address": " 1  Main St ",
+				"city":           "Ottawa",
+				"state":          "ontario",
+				"zip":            "k1a0b1",
+				"country_code":   "ca",
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var address userAddressResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &address))
+				require.Equal(t, "1 Main St", address.StreetAddress)
+				require.Equal(t, "ON", address.State)
+				require.Equal(t, "K1A 0B1", address.Zip)
+				require.Equal(t, "CA", address.CountryCode)
+			},
+		},
+		{
+			name: "InvalidStateAndZip",
+			body: map[string]interface{}{
+				"type":           "billing",
+				"street_address": "1 Main St",
+				"city":           "Springfield",
+				"state":          "Illinois!",
+				"zip":            "6270",
+				"country_code":   "US",
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				var problem apierror.Problem
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+				require.Equal(t, apierror.CodeValidationFailed, problem.Code)
+				require.Len(t, problem.Errors, 2)
+				require.Equal(t, "state", problem.Errors[0].Field)
+				require.Equal(t, "iso3166_2", problem.Errors[0].Code)
+				require.Equal(t, "zip", problem.Errors[1].Field)
+				require.Equal(t, "postal_code", problem.Errors[1].Code)
+			},
+		},
+		{
+			name: "UnknownCountry",
+			body: map[string]interface{}{
+				"type":           "billing",
+				"street_address": "1 Main St",
+				"city":           "Springfield",
+				"state":          "IL",
+				"zip":            "62701",
+				"country_code":   "USA",
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				var problem apierror.Problem
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+				require.Len(t, problem.Errors, 1)
+				require.Equal(t, "country_code", problem.Errors[0].Field)
+				require.Equal(t, "iso3166_1", problem.Errors[0].Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+			require.NoError(t, err)
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, 1, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/settings"
+	"whaleWake/token"
+)
+
+// attributeKeyPattern is the format of attribute keys: lower-case words joined by underscores, e.g. "license_number".
+var attributeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// attributeDateLayout is the format of date attribute values.
+const attributeDateLayout = "2006-01-02"
+
+// attributeDefinitionRequest holds the validation rules shared by creating and updating a definition.
+// Fields:
+// - Label: required, the name shown to people.
+// - Required: Whether every new user must have a value. Existing values cannot be removed while it is set.
+// - EnumValues: For strings, the only values allowed, if not empty.
+// - Pattern: For strings, a regular expression the whole value has to match, if not empty.
+// - MaxLength: For strings, the most characters allowed, if not zero.
+// - Minimum, Maximum: For integers, the inclusive bounds. Either both or neither are set.
+type attributeDefinitionRequest struct {
+	Label      string   `json:"label" binding:"required,max=255"`
+	Required   bool     `json:"required"`
+	EnumValues []string `json:"enum_values" binding:"omitempty,max=100,dive,required,max=255"`
+	Pattern    string   `json:"pattern" binding:"max=255"`
+	MaxLength  int32    `json:"max_length" binding:"min=0,max=10000"`
+	Minimum    *int64   `json:"minimum"`
+	Maximum    *int64   `json:"maximum"`
+}
+
+// createAttributeDefinitionRequest defines the payload for a new attribute.
+// Fields:
+// - Key: required, lower-case letters, digits, and underscores, starting with a letter. Cannot change later.
+// - Type: required, one of string, integer, boolean, or date (YYYY-MM-DD). Cannot change later.
+// - The rules of attributeDefinitionRequest.
+type createAttributeDefinitionRequest struct {
+	Key  string `json:"key" binding:"required"`
+	Type string `json:"type" binding:"required,oneof=string integer boolean date"`
+	attributeDefinitionRequest
+}
+
+type attributeDefinitionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Key        string    `json:"key"`
+	Label      string    `json:"label"`
+	Type       string    `json:"type"`
+	Required   bool      `json:"required"`
+	EnumValues []string  `json:"enum_values"`
+	Pattern    string    `json:"pattern"`
+	MaxLength  int32     `json:"max_length"`
+	Minimum    *int64    `json:"minimum"`
+	Maximum    *int64    `json:"maximum"`
+	CreatedAt  string    `json:"created_at"`
+	UpdatedAt  string    `json:"updated_at"`
+}
+
+func newAttributeDefinitionResponse(definition db.AttributeDefinition) attributeDefinitionResponse {
+	response := attributeDefinitionResponse{
+		ID:         definition.ID,
+		Key:        definition.Key,
+		Label:      definition.Label,
+		Type:       definition.Type,
+		Required:   definition.Required,
+		EnumValues: definition.EnumValues,
+		Pattern:    definition.Pattern,
+		MaxLength:  definition.MaxLength,
+		CreatedAt:  definition.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:  definition.UpdatedAt.Format(time.RFC3339),
+	}
+	if definition.Minimum.Valid {
+		response.Minimum = &definition.Minimum.Int64
+	}
+	if definition.Maximum.Valid {
+		response.Maximum = &definition.Maximum.Int64
+	}
+	return response
+}
+
+// check reports the rules that do not apply to the type or contradict each other, as a validation_failed error.
+func (req attributeDefinitionRequest) check(attributeType string) error {
+	var fields []apierror.FieldError
+	notFor := func(field string) {
+		fields = append(fields, apierror.FieldError{Field: field, Code: "invalid", Message: "does not apply to " + attributeType + " attributes"})
+	}
+
+	if attributeType != db.AttributeTypeString {
+		if len(req.EnumValues) > 0 {
+			notFor("enum_values")
+		}
+		if req.Pattern != "" {
+			notFor("pattern")
+		}
+		if req.MaxLength != 0 {
+			notFor("max_length")
+		}
+	} else if req.Pattern != "" {
+		if _, err := regexp.Compile(req.Pattern); err != nil {
+			fields = append(fields, apierror.FieldError{Field: "pattern", Code: "pattern", Message: "must be a valid regular expression"})
+		}
+	}
+
+	if attributeType != db.AttributeTypeInteger {
+		if req.Minimum != nil {
+			notFor("minimum")
+		}
+		if req.Maximum != nil {
+			notFor("maximum")
+		}
+	} else if (req.Minimum == nil) != (req.Maximum == nil) {
+		fields = append(fields, apierror.FieldError{Field: "maximum", Code: "required_with", Message: "minimum and maximum must be set together"})
+	} else if req.Minimum != nil && *req.Minimum > *req.Maximum {
+		fields = append(fields, apierror.FieldError{Field: "maximum", Code: "gtefield", Message: "must be at least minimum"})
+	}
+
+	if fields == nil {
+		return nil
+	}
+	return apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "request failed validation").WithFields(fields...)
+}
+
+// enumValues returns the enum values ready to store; the column does not accept NULL.
+func (req attributeDefinitionRequest) enumValues() []string {
+	if req.EnumValues == nil {
+		return []string{}
+	}
+	return req.EnumValues
+}
+
+func nullInt64(n *int64) sql.NullInt64 {
+	if n == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *n, Valid: true}
+}
+
+// attributeAdmin checks that the caller is an admin. The error has already been sent when ok is false.
+func (server *Server) attributeAdmin(ctx *gin.Context) bool {
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return false
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if authPayload.RoleID != 3 {
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to manage attributes"))
+		return false
+	}
+	return true
+}
+
+// attributeDefinitionID parses the id of an attribute route. The error has already been sent when ok is false.
+func attributeDefinitionID(ctx *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		apierror.Respond(ctx, invalidUUIDError("id", err))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// ListAttributeDefinitions handles GET /attributes to list every custom attribute, ordered by key, so clients
+// can build their forms.
+// Returns 500 for server errors, 200 for success.
+func (server *Server) ListAttributeDefinitions(ctx *gin.Context) {
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	definitions, err := server.store.ListAttributeDefinitions(ctx)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	response := make([]attributeDefinitionResponse, len(definitions))
+	for i, definition := range definitions {
+		response[i] = newAttributeDefinitionResponse(definition)
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CreateAttributeDefinition handles POST /attributes to define a new custom attribute. Admin only.
+// A required attribute is enforced for users created afterwards; existing users keep whatever they have.
+// Returns 400 for bad input, 403 for non-admins, 409 if the key is taken, 500 for server errors, 201 for success.
+func (server *Server) CreateAttributeDefinition(ctx *gin.Context) {
+	var req createAttributeDefinitionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if !server.attributeAdmin(ctx) {
+		return
+	}
+
+	if !attributeKeyPattern.MatchString(req.Key) {
+		apierror.Respond(ctx, apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "request failed validation").
+			WithFields(apierror.FieldError{Field: "key", Code: "pattern", Message: "must be lower-case letters, digits, and underscores, starting with a letter"}))
+		return
+	}
+	if err := req.check(req.Type); err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	definition, err := server.store.CreateAttributeDefinition(ctx, db.CreateAttributeDefinitionParams{
+		Key:        req.Key,
+		Label:      req.Label,
+		Type:       req.Type,
+		Required:   req.Required,
+		EnumValues: req.enumValues(),
+		Pattern:    req.Pattern,
+		MaxLength:  req.MaxLength,
+		Minimum:    nullInt64(req.Minimum),
+		Maximum:    nullInt64(req.Maximum),
+	})
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, newAttributeDefinitionResponse(definition))
+}
+
+// UpdateAttributeDefinition handles PUT /attributes/:id to replace the label and rules of an attribute. Admin only.
+// The key and type cannot change. Stored values are not checked again; they have to meet the new rules the next
+// time they are set.
+// Returns 400 for bad input, 403 for non-admins, 404 if not found, 500 for server errors, 200 for success.
+func (server *Server) UpdateAttributeDefinition(ctx *gin.Context) {
+	var req attributeDefinitionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if !server.attributeAdmin(ctx) {
+		return
+	}
+	id, ok := attributeDefinitionID(ctx)
+	if !ok {
+		return
+	}
+
+	definition, err := server.store.GetAttributeDefinition(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("attribute not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+	if err = req.check(definition.Type); err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	definition, err = server.store.UpdateAttributeDefinition(ctx, db.UpdateAttributeDefinitionParams{
+		ID:         id,
+		Label:      req.Label,
+		Required:   req.Required,
+		EnumValues: req.enumValues(),
+		Pattern:    req.Pattern,
+		MaxLength:  req.MaxLength,
+		Minimum:    nullInt64(req.Minimum),
+		Maximum:    nullInt64(req.Maximum),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("attribute not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newAttributeDefinitionResponse(definition))
+}
+
+// DeleteAttributeDefinition handles DELETE /attributes/:id to remove an attribute and every user's value of it.
+// Admin only.
+// Returns 400 for a bad UUID, 403 for non-admins, 404 if not found, 500 for server errors, 200 for success.
+func (server *Server) DeleteAttributeDefinition(ctx *gin.Context) {
+	if !server.attributeAdmin(ctx) {
+		return
+	}
+	id, ok := attributeDefinitionID(ctx)
+	if !ok {
+		return
+	}
+
+	definition, err := server.store.DeleteAttributeDefinitionTx(auditContext(ctx), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("attribute not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newAttributeDefinitionResponse(definition))
+}
+
+// attributeSchema returns the schema values of an attribute are checked against.
+func attributeSchema(definition db.AttributeDefinition) settings.Schema {
+	switch definition.Type {
+	case db.AttributeTypeInteger:
+		return settings.Schema{Type: settings.TypeInteger, Minimum: definition.Minimum.Int64, Maximum: definition.Maximum.Int64}
+	case db.AttributeTypeBoolean:
+		return settings.Schema{Type: settings.TypeBoolean}
+	case db.AttributeTypeDate:
+		return settings.Schema{Type: settings.TypeString, Check: checkAttributeDate}
+	}
+
+	schema := settings.Schema{Type: settings.TypeString, MaxLength: int(definition.MaxLength)}
+	if len(definition.EnumValues) > 0 {
+		schema.Enum = definition.EnumValues
+	}
+	if definition.Pattern != "" {
+		// The pattern was checked when it was stored, and has to match the whole value.
+		schema.Pattern, _ = regexp.Compile(`^(?:` + definition.Pattern + `)$`)
+	}
+	return schema
+}
+
+func checkAttributeDate(value interface{}) error {
+	if _, err := time.Parse(attributeDateLayout, value.(string)); err != nil {
+		return errors.New("must be a date in the format YYYY-MM-DD")
+	}
+	return nil
+}
+
+// userAttributeValues checks attribute values from a request against the attribute definitions.
+// Parameters:
+// - values: Attribute keys and their JSON values. A null value removes the attribute.
+// - create: Whether the values are for a new user, who must have a value for every required attribute.
+// Returns:
+// - The values in canonical JSON, ready for the store.
+// - A validation_failed error with one field error per invalid attribute, named attributes.<key>.
+func (server *Server) userAttributeValues(ctx context.Context, values map[string]json.RawMessage, create bool) ([]db.UserAttributeValue, error) {
+	if len(values) == 0 && !create {
+		return nil, nil
+	}
+
+	definitions, err := server.store.ListAttributeDefinitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkUserAttributeValues(definitions, values, create)
+}
+
+// checkUserAttributeValues is userAttributeValues with the attribute definitions already loaded.
+func checkUserAttributeValues(definitions []db.AttributeDefinition, values map[string]json.RawMessage, create bool) ([]db.UserAttributeValue, error) {
+	var result []db.UserAttributeValue
+	var fields []apierror.FieldError
+	invalid := func(key, code, message string) {
+		fields = append(fields, apierror.FieldError{Field: "attributes." + key, Code: code, Message: message})
+	}
+
+	known := make(map[string]bool, len(definitions))
+	for _, definition := range definitions {
+		key := definition.Key
+		known[key] = true
+
+		raw, ok := values[key]
+		if !ok || string(raw) == "null" {
+			if definition.Required && (ok || create) {
+				invalid(key, "required", "is required")
+			} else if ok {
+				result = append(result, db.UserAttributeValue{DefinitionID: definition.ID})
+			}
+			continue
+		}
+
+		value, err := attributeSchema(definition).Normalize(raw)
+		if err != nil {
+			var fieldErr settings.FieldError
+			if !errors.As(err, &fieldErr) {
+				return nil, err
+			}
+			invalid(key, fieldErr.Code, fieldErr.Message)
+			continue
+		}
+		result = append(result, db.UserAttributeValue{DefinitionID: definition.ID, Value: value})
+	}
+
+	for key := range values {
+		if !known[key] {
+			invalid(key, "unknown_attribute", "is not a defined attribute")
+		}
+	}
+
+	if fields != nil {
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "request failed validation").WithFields(fields...)
+	}
+	return result, nil
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+// attributeTestStore keeps attribute definitions and records the attribute values users are created with.
+type attributeTestStore struct {
+	db.Store
+	definitions []db.AttributeDefinition
+	created     []db.UserAttributeValue
+}
+
+func (s *attributeTestStore) ListAttributeDefinitions(context.Context) ([]db.AttributeDefinition, error) {
+	return s.definitions, nil
+}
+
+func (s *attributeTestStore) CreateAttributeDefinition(_ context.Context, arg db.CreateAttributeDefinitionParams) (db.AttributeDefinition, error) {
+	definition := db.AttributeDefinition{
+		ID:         util.RandomUUID(),
+		Key:        arg.Key,
+		Label:      arg.Label,
+		Type:       arg.Type,
+		Required:   arg.Required,
+		EnumValues: arg.EnumValues,
+		Pattern:    arg.Pattern,
+		MaxLength:  arg.MaxLength,
+		Minimum:    arg.Minimum,
+		Maximum:    arg.Maximum,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	s.definitions = append(s.definitions, definition)
+	return definition, nil
+}
+
+func (s *attributeTestStore) GetAttributeDefinition(_ context.Context, id uuid.UUID) (db.AttributeDefinition, error) {
+	for _, definition := range s.definitions {
+		if definition.ID == id {
+			return definition, nil
+		}
+	}
+	return db.AttributeDefinition{}, sql.ErrNoRows
+}
+
+func (s *attributeTestStore) CreateUserWithProfileAndRoleTx(_ context.Context, userParams db.CreateUserParams, _ db.CreateUserProfileParams, _ db.CreateUserRoleParams, attributes ...db.UserAttributeValue) (db.UserTxResult, error) {
+	s.created = attributes
+
+	result := db.UserTxResult{User: db.User{ID: util.RandomUUID(), UserName: userParams.UserName}}
+	for _, attribute := range attributes {
+		for _, definition := range s.definitions {
+			if definition.ID == attribute.DefinitionID {
+				result.Attributes = append(result.Attributes, db.ListUserAttributesRow{DefinitionID: definition.ID, Key: definition.Key, Value: attribute.Value})
+			}
+		}
+	}
+	return result, nil
+}
+
+// requireFieldError checks that the response is a validation error whose only field error is field with code.
+func requireFieldError(t *testing.T, recorder *httptest.ResponseRecorder, field, code string) {
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	var problem apierror.Problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+	require.Equal(t, apierror.CodeValidationFailed, problem.Code)
+	require.Len(t, problem.Errors, 1)
+	require.Equal(t, field, problem.Errors[0].Field)
+	require.Equal(t, code, problem.Errors[0].Code)
+}
+
+func TestCreateAttributeDefinition(t *testing.T) {
+	testCases := []struct {
+		name          string
+		body          string
+		role          int
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: `{"key": "license_number", "label": "License number", "type": "string", "required": true, "pattern": "[A-Z]{2}-[0-9]+"}`,
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				var definition attributeDefinitionResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &definition))
+				require.Equal(t, "license_number", definition.Key)
+				require.True(t, definition.Required)
+				require.Equal(t, []string{}, definition.EnumValues)
+			},
+		},
+		{
+			name: "NotAdmin",
+			body: `{"key": "license_number", "label": "License number", "type": "string"}`,
+			role: 1,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "BadKey",
+			body: `{"key": "License Number", "label": "License number", "type": "string"}`,
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireFieldError(t, recorder, "key", "pattern")
+			},
+		},
+		{
+			name: "RuleForOtherType",
+			body: `{"key": "tier", "label": "Tier", "type": "integer", "enum_values": ["gold"]}`,
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireFieldError(t, recorder, "enum_values", "invalid")
+			},
+		},
+		{
+			name: "MinimumWithoutMaximum",
+			body: `{"key": "tier", "label": "Tier", "type": "integer", "minimum": 1}`,
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireFieldError(t, recorder, "maximum", "required_with")
+			},
+		},
+		{
+			name: "BadPattern",
+			body: `{"key": "vessel", "label": "Vessel", "type": "string", "pattern": "[a-"}`,
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireFieldError(t, recorder, "pattern", "pattern")
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, &attributeTestStore{})
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodPost, "/attributes", bytes.NewBufferString(tc.body))
+			require.NoError(t, err)
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomUUID(), tc.role, time.Minute)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestCreateUserTxAttributes(t *testing.T) {
+	license := db.AttributeDefinition{ID: util.RandomUUID(), Key: "license_number", Type: db.AttributeTypeString, Required: true,
+		Pattern: "[A-Z]{2}-[0-9]+"}
+	tier := db.AttributeDefinition{ID: util.RandomUUID(), Key: "tier", Type: db.AttributeTypeInteger,
+		Minimum: sql.NullInt64{Int64: 1, Valid: true}, Maximum: sql.NullInt64{Int64: 3, Valid: true}}
+	renewal := db.AttributeDefinition{ID: util.RandomUUID(), Key: "renewal", Type: db.AttributeTypeDate}
+
+	testCases := []struct {
+		name          string
+		attributes    string
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, store *attributeTestStore)
+	}{
+		{
+			name:       "OK",
+			attributes: `{"license_number": "AB-12", "tier": 2, "renewal": "2027-03-01"}`,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *attributeTestStore) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Len(t, store.created, 3)
+
+				var response createUserTxResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				require.JSONEq(t, `"AB-12"`, string(response.Attributes["license_number"]))
+				require.JSONEq(t, `2`, string(response.Attributes["tier"]))
+			},
+		},
+		{
+			name:       "MissingRequired",
+			attributes: `{"tier": 2}`,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *attributeTestStore) {
+				requireFieldError(t, recorder, "attributes.license_number", "required")
+				require.Nil(t, store.created)
+			},
+		},
+		{
+			name:       "Invalid",
+			attributes: `{"license_number": "AB-12x", "tier": 9, "renewal": "2027-02-30", "vessel": "Orca"}`,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *attributeTestStore) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				var problem apierror.Problem
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+				require.Equal(t, []apierror.FieldError{
+					{Field: "attributes.license_number", Code: "pattern", Message: "is not in the expected format"},
+					{Field: "attributes.renewal", Code: "invalid", Message: "must be a date in the format YYYY-MM-DD"},
+					{Field: "attributes.tier", Code: "range", Message: "must be between 1 and 3"},
+					{Field: "attributes.vessel", Code: "unknown_attribute", Message: "is not a defined attribute"},
+				}, problem.Errors)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			store := &attributeTestStore{definitions: []db.AttributeDefinition{license, renewal, tier}}
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			body := `{"user_name": "` + util.RandomUserName() + `", "email": "` + util.RandomEmail() + `", "password": "secret123",
+				"first_name": "Ada", "last_name": "Lovelace", "business_name": "Whale Co", "street_address": "1 Main St",
+				"city": "Boston", "state": "MA", "zip": "02101", "country_code": "US", "attributes": ` + tc.attributes + `}`
+			request, err := http.NewRequest(http.MethodPost, "/usertx", bytes.NewBufferString(body))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, store)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/token"
+)
+
+// auditContext returns a context for store calls that attributes any changes to the caller.
+func auditContext(ctx *gin.Context) context.Context {
+	return db.WithActor(ctx, auditActor(ctx))
+}
+
+// auditActor describes the caller for the audit log.
+// The actor is taken from the authorization payload when the route is authenticated; anonymous requests
+// still record the request ID and client IP.
+func auditActor(ctx *gin.Context) db.Actor {
+	actor := db.Actor{
+		RequestID: ctx.GetString(requestIDKey),
+		IP:        ctx.ClientIP(),
+	}
+
+	if payload, ok := ctx.Get(authorizationPayloadKey); ok {
+		if authPayload, ok := payload.(*token.Payload); ok {
+			actor.UserID = authPayload.UserID
+			actor.RoleID = int32(authPayload.RoleID)
+		}
+	}
+
+	return actor
+}
+
+// listAuditEventsRequest defines the query parameters for GET /audit.
+// Fields:
+// - ActorID, TargetID: optional UUID filters.
+// - TargetType, Action: optional filters restricted to the known values.
+// - RequestID: optional filter for all changes made by one request.
+// - From, To: optional RFC 3339 bounds on created_at; From is inclusive, To is exclusive.
+// - PageID, PageSize: required pagination, same as GET /users.
+type listAuditEventsRequest struct {
+	ActorID    string `form:"actor_id" binding:"omitempty,uuid"`
+	TargetID   string `form:"target_id" binding:"omitempty,uuid"`
+	TargetType string `form:"target_type" binding:"omitempty,oneof=user user_profile user_role user_address user_document user_settings user_attributes"`
+	Action     string `form:"action" binding:"omitempty,oneof=create update delete restore purge erase"`
+	RequestID  string `form:"request_id"`
+	From       string `form:"from" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	To         string `form:"to" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	PageID     int32  `form:"page_id" binding:"required,min=1"`
+	PageSize   int32  `form:"page_size" binding:"required,min=1,max=100"`
+}
+
+type auditEventResponse struct {
+	ID          int64           `json:"id"`
+	ActorID     *uuid.UUID      `json:"actor_id"`
+	ActorRoleID *int32          `json:"actor_role_id"`
+	Action      string          `json:"action"`
+	TargetType  string          `json:"target_type"`
+	TargetID    uuid.UUID       `json:"target_id"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	RequestID   string          `json:"request_id"`
+	IP          string          `json:"ip"`
+	CreatedAt   string          `json:"created_at"`
+}
+
+func newAuditEventResponse(event db.AuditEvent) auditEventResponse {
+	rsp := auditEventResponse{
+		ID:         event.ID,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Before:     event.Before,
+		After:      event.After,
+		RequestID:  event.RequestID,
+		IP:         event.Ip,
+		CreatedAt:  event.CreatedAt.Format(time.RFC3339),
+	}
+	if event.ActorID.Valid {
+		rsp.ActorID = &event.ActorID.UUID
+	}
+	if event.ActorRoleID.Valid {
+		rsp.ActorRoleID = &event.ActorRoleID.Int32
+	}
+	return rsp
+}
+
+// ListAuditEvents handles GET /audit to page through the audit log, newest first. Admin only.
+// Returns 400 for bad params, 403 for non-admins, 500 for server errors, 200 for success.
+func (server *Server) ListAuditEvents(ctx *gin.Context) {
+	var req listAuditEventsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if authPayload.RoleID != 3 {
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to view the audit log"))
+		return
+	}
+
+	arg := db.ListAuditEventsParams{
+		TargetType: sql.NullString{String: req.TargetType, Valid: req.TargetType != ""},
+		Action:     sql.NullString{String: req.Action, Valid: req.Action != ""},
+		RequestID:  sql.NullString{String: req.RequestID, Valid: req.RequestID != ""},
+		PageLimit:  req.PageSize,
+		PageOffset: (req.PageID - 1) * req.PageSize,
+	}
+
+	// The binding rules above have already validated these, so parsing cannot fail.
+	if req.ActorID != "" {
+		arg.ActorID = uuid.NullUUID{UUID: uuid.MustParse(req.ActorID), Valid: true}
+	}
+	if req.TargetID != "" {
+		arg.TargetID = uuid.NullUUID{UUID: uuid.MustParse(req.TargetID), Valid: true}
+	}
+	if req.From != "" {
+		from, _ := time.Parse(time.RFC3339, req.From)
+		arg.CreatedAfter = sql.NullTime{Time: from, Valid: true}
+	}
+	if req.To != "" {
+		to, _ := time.Parse(time.RFC3339, req.To)
+		arg.CreatedBefore = sql.NullTime{Time: to, Valid: true}
+	}
+
+	events, err := server.store.ListAuditEvents(ctx, arg)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	eventsResponse := make([]auditEventResponse, 0, len(events))
+	for _, event := range events {
+		eventsResponse = append(eventsResponse, newAuditEventResponse(event))
+	}
+
+	ctx.JSON(http.StatusOK, eventsResponse)
+}
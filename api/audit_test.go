@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/token"
+	"whaleWake/util"
+)
+
+// auditTestStore records the filters passed to ListAuditEvents and returns a fixed event.
+type auditTestStore struct {
+	db.Store
+	arg    db.ListAuditEventsParams
+	events []db.AuditEvent
+}
+
+func (s *auditTestStore) ListAuditEvents(_ context.Context, arg db.ListAuditEventsParams) ([]db.AuditEvent, error) {
+	s.arg = arg
+	return s.events, nil
+}
+
+func TestListAuditEvents(t *testing.T) {
+	targetID := util.RandomUUID()
+	actorID := util.RandomUUID()
+
+	testCases := []struct {
+		name          string
+		query         string
+		roleID        int
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, store *auditTestStore)
+	}{
+		{
+			name:   "OK",
+			query:  "?page_id=2&page_size=5&target_id=" + targetID.String() + "&action=update&target_type=user_role&from=2024-01-01T00:00:00Z",
+			roleID: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *auditTestStore) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				require.Equal(t, int32(5), store.arg.PageLimit)
+				require.Equal(t, int32(5), store.arg.PageOffset)
+				require.Equal(t, uuid.NullUUID{UUID: targetID, Valid: true}, store.arg.TargetID)
+				require.False(t, store.arg.ActorID.Valid)
+				require.Equal(t, "update", store.arg.Action.String)
+				require.Equal(t, "user_role", store.arg.TargetType.String)
+				require.True(t, store.arg.CreatedAfter.Valid)
+				require.False(t, store.arg.CreatedBefore.Valid)
+
+				var events []auditEventResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &events))
+				require.Len(t, events, 1)
+				require.Equal(t, actorID, *events[0].ActorID)
+				require.JSONEq(t, `{"role_id":1}`, string(events[0].Before))
+				require.JSONEq(t, `{"role_id":3}`, string(events[0].After))
+			},
+		}, {
+			name:   "NotAdmin",
+			query:  "?page_id=1&page_size=5",
+			roleID: 1,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *auditTestStore) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		}, {
+			name:   "InvalidActorID",
+			query:  "?page_id=1&page_size=5&actor_id=nope",
+			roleID: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *auditTestStore) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"field":"actor_id"`)
+			},
+		}, {
+			name:   "InvalidAction",
+			query:  "?page_id=1&page_size=5&action=explode",
+			roleID: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *auditTestStore) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		}, {
+			name:   "InvalidFrom",
+			query:  "?page_id=1&page_size=5&from=yesterday",
+			roleID: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *auditTestStore) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"field":"from"`)
+			},
+		}, {
+			name:   "MissingPagination",
+			query:  "",
+			roleID: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *auditTestStore) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			store := &auditTestStore{events: []db.AuditEvent{{
+				ID:          1,
+				ActorID:     uuid.NullUUID{UUID: actorID, Valid: true},
+				Action:      db.AuditActionUpdate,
+				TargetType:  db.AuditTargetUserRole,
+				TargetID:    targetID,
+				Before:      json.RawMessage(`{"role_id":1}`),
+				After:       json.RawMessage(`{"role_id":3}`),
+				RequestID:   "req-1",
+				CreatedAt:   time.Now(),
+				ActorRoleID: sql.NullInt32{Int32: 3, Valid: true},
+			}}}
+			server := newTestServer(t, store)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/audit"+tc.query, nil)
+			require.NoError(t, err)
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomUUID(), tc.roleID, time.Minute)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, store)
+		})
+	}
+}
+
+func TestAuditContext(t *testing.T) {
+	server := newTestServer(t, nil)
+	userID := util.RandomUUID()
+
+	var actor db.Actor
+	var ok bool
+	server.router.GET("/actor", func(ctx *gin.Context) {
+		ctx.Set(authorizationPayloadKey, &token.Payload{UserID: userID, RoleID: 3})
+		actor, ok = db.ActorFromContext(auditContext(ctx))
+	})
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/actor", nil)
+	require.NoError(t, err)
+	request.Header.Set(requestIDHeaderKey, "req-42")
+	request.RemoteAddr = "203.0.113.7:5555"
+
+	server.router.ServeHTTP(recorder, request)
+	require.True(t, ok)
+	require.Equal(t, userID, actor.UserID)
+	require.Equal(t, int32(3), actor.RoleID)
+	require.Equal(t, "req-42", actor.RequestID)
+	require.Equal(t, "203.0.113.7", actor.IP)
+}
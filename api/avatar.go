@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"whaleWake/apierror"
+	"whaleWake/blobstore"
+	db "whaleWake/db/sqlc"
+)
+
+// avatarMaxDimension is the largest width or height of an avatar image, in pixels. It is checked before the
+// image is decoded, so a small file cannot claim a huge canvas.
+const avatarMaxDimension = 4096
+
+// avatarContentTypes are the image types accepted as avatars, as sniffed from the uploaded bytes.
+var avatarContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// getUserAvatarRequest selects the avatar image to download.
+// Fields:
+// - Size: original (the default) or one of the thumbnail sizes in pixels.
+type getUserAvatarRequest struct {
+	Size string `form:"size" binding:"omitempty,oneof=original 64 256"`
+}
+
+type userAvatarResponse struct {
+	AvatarKey         string `json:"avatar_key"`
+	AvatarContentType string `json:"avatar_content_type"`
+	ThumbnailSizes    []int  `json:"thumbnail_sizes"`
+}
+
+func newUserAvatarResponse(profile db.UserProfile) userAvatarResponse {
+	response := userAvatarResponse{
+		AvatarKey:         profile.AvatarKey,
+		AvatarContentType: profile.AvatarContentType,
+		ThumbnailSizes:    []int{},
+	}
+	if profile.AvatarKey != "" {
+		response.ThumbnailSizes = db.AvatarThumbnailSizes
+	}
+	return response
+}
+
+// avatarOwner parses the user id of an avatar route and checks the caller may manage that user's avatar.
+// The error has already been sent when ok is false.
+func (server *Server) avatarOwner(ctx *gin.Context) (uuid.UUID, bool) {
+	return server.selfOrAdmin(ctx, "You are not authorized to manage this user's avatar")
+}
+
+// SetUserAvatar handles PUT /usertx/:id/avatar to upload a new avatar as the raw request body.
+// The type is sniffed from the bytes rather than trusted from Content-Type. The original is stored along with
+// square PNG thumbnails, and the previous avatar is deleted in the background.
+// Returns 400 for an unreadable image, 403 for other users unless admin, 404 if the profile does not exist, 413 over AVATAR_MAX_BYTES, 415 for other file types, 500 for server errors, 200 for success.
+func (server *Server) SetUserAvatar(ctx *gin.Context) {
+	userID, ok := server.avatarOwner(ctx)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, server.config.AvatarMaxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Respond(ctx, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeInvalidRequest,
+				fmt.Sprintf("avatars are limited to %d bytes", server.config.AvatarMaxBytes)))
+			return
+		}
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+	if len(data) == 0 {
+		apierror.Respond(ctx, apierror.BadRequest("send the avatar image as the request body"))
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	if !avatarContentTypes[contentType] {
+		apierror.Respond(ctx, apierror.New(http.StatusUnsupportedMediaType, apierror.CodeInvalidRequest,
+			"avatars must be PNG, JPEG, or GIF images"))
+		return
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		apierror.Respond(ctx, apierror.BadRequest("the avatar image could not be read"))
+		return
+	}
+	if config.Width > avatarMaxDimension || config.Height > avatarMaxDimension {
+		apierror.Respond(ctx, apierror.BadRequest(fmt.Sprintf("avatars are limited to %d by %d pixels", avatarMaxDimension, avatarMaxDimension)))
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		apierror.Respond(ctx, apierror.BadRequest("the avatar image could not be read"))
+		return
+	}
+
+	key := db.NewAvatarKey(userID)
+	keys := []string{key}
+	if err = server.blobs.Put(ctx, key, data, contentType); err != nil {
+		apierror.Respond(ctx, apierror.Internal(err))
+		return
+	}
+	for _, size := range db.AvatarThumbnailSizes {
+		thumb, err := encodePNG(thumbnail(img, size))
+		if err == nil {
+			keys = append(keys, db.AvatarThumbnailKey(key, size))
+			err = server.blobs.Put(ctx, db.AvatarThumbnailKey(key, size), thumb, "image/png")
+		}
+		if err != nil {
+			server.deleteBlobs(keys...)
+			apierror.Respond(ctx, apierror.Internal(err))
+			return
+		}
+	}
+
+	profile, err := server.store.SetUserAvatarTx(auditContext(ctx), db.UpdateUserProfileAvatarParams{
+		UserID:            userID,
+		AvatarKey:         key,
+		AvatarContentType: contentType,
+	})
+	if err != nil {
+		server.deleteBlobs(keys...)
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("profile not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserAvatarResponse(profile))
+}
+
+// GetUserAvatar handles GET /usertx/:id/avatar to download the avatar, or one of its thumbnails with ?size=.
+// Returns 400 for bad input, 403 for other users unless admin, 404 if there is no avatar, 500 for server errors, 200 with the image.
+func (server *Server) GetUserAvatar(ctx *gin.Context) {
+	var req getUserAvatarRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	userID, ok := server.avatarOwner(ctx)
+	if !ok {
+		return
+	}
+
+	profile, err := server.store.GetUserProfile(ctx, userID)
+	if err != nil && err != sql.ErrNoRows {
+		apierror.Respond(ctx, err)
+		return
+	}
+	if err == sql.ErrNoRows || profile.AvatarKey == "" {
+		apierror.Respond(ctx, apierror.NotFound("avatar not found"))
+		return
+	}
+
+	key, contentType := profile.AvatarKey, profile.AvatarContentType
+	if req.Size != "" && req.Size != "original" {
+		size, _ := strconv.Atoi(req.Size)
+		key, contentType = db.AvatarThumbnailKey(key, size), "image/png"
+	}
+
+	server.sendBlob(ctx, key, contentType, nil)
+}
+
+// DeleteUserAvatar handles DELETE /usertx/:id/avatar to remove the avatar. Its images are deleted in the background.
+// Returns 400 for a bad UUID, 403 for other users unless admin, 404 if the profile does not exist, 500 for server errors, 200 for success.
+func (server *Server) DeleteUserAvatar(ctx *gin.Context) {
+	userID, ok := server.avatarOwner(ctx)
+	if !ok {
+		return
+	}
+
+	profile, err := server.store.SetUserAvatarTx(auditContext(ctx), db.UpdateUserProfileAvatarParams{UserID: userID})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("profile not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserAvatarResponse(profile))
+}
+
+// sendBlob streams a blob as the response body, with any extra headers.
+// A blob that is missing from the blob store is a 404.
+func (server *Server) sendBlob(ctx *gin.Context, key, contentType string, headers map[string]string) {
+	reader, err := server.blobs.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			err = apierror.NotFound("file not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+	defer reader.Close()
+
+	ctx.Header("X-Content-Type-Options", "nosniff")
+	ctx.DataFromReader(http.StatusOK, -1, contentType, reader, headers)
+}
+
+// deleteBlobs removes blobs written for a change that did not go through. Failures are only logged: the blobs
+// are not referenced, so all they cost is space.
+func (server *Server) deleteBlobs(keys ...string) {
+	for _, key := range keys {
+		if err := server.blobs.Delete(context.Background(), key); err != nil {
+			log.Printf("Unable to delete unused blob %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+// blobTestStore keeps the profile and documents of one user, and the keys queued for deletion.
+type blobTestStore struct {
+	db.Store
+	profile   db.UserProfile
+	documents []db.UserDocument
+	deleted   []string
+}
+
+func (s *blobTestStore) GetUserProfile(_ context.Context, userID uuid.UUID) (db.UserProfile, error) {
+	if userID != s.profile.UserID {
+		return db.UserProfile{}, sql.ErrNoRows
+	}
+	return s.profile, nil
+}
+
+func (s *blobTestStore) SetUserAvatarTx(_ context.Context, arg db.UpdateUserProfileAvatarParams) (db.UserProfile, error) {
+	if arg.UserID != s.profile.UserID {
+		return db.UserProfile{}, sql.ErrNoRows
+	}
+	if s.profile.AvatarKey != "" {
+		s.deleted = append(s.deleted, s.profile.AvatarKey)
+	}
+	s.profile.AvatarKey = arg.AvatarKey
+	s.profile.AvatarContentType = arg.AvatarContentType
+	s.profile.Version++
+	return s.profile, nil
+}
+
+func (s *blobTestStore) CreateUserDocumentTx(_ context.Context, arg db.CreateUserDocumentParams) (db.UserDocument, error) {
+	if arg.UserID != s.profile.UserID {
+		return db.UserDocument{}, sql.ErrNoRows
+	}
+	document := db.UserDocument{
+		ID:          util.RandomUUID(),
+		UserID:      arg.UserID,
+		Name:        arg.Name,
+		ContentType: arg.ContentType,
+		SizeBytes:   arg.SizeBytes,
+		ObjectKey:   arg.ObjectKey,
+		CreatedAt:   time.Now(),
+	}
+	s.documents = append(s.documents, document)
+	return document, nil
+}
+
+func (s *blobTestStore) ListUserDocuments(_ context.Context, userID uuid.UUID) ([]db.UserDocument, error) {
+	var documents []db.UserDocument
+	for _, document := range s.documents {
+		if document.UserID == userID {
+			documents = append(documents, document)
+		}
+	}
+	return documents, nil
+}
+
+func (s *blobTestStore) GetUserDocument(_ context.Context, arg db.GetUserDocumentParams) (db.UserDocument, error) {
+	for _, document := range s.documents {
+		if document.ID == arg.ID && document.UserID == arg.UserID {
+			return document, nil
+		}
+	}
+	return db.UserDocument{}, sql.ErrNoRows
+}
+
+func (s *blobTestStore) DeleteUserDocumentTx(_ context.Context, arg db.DeleteUserDocumentParams) (db.UserDocument, error) {
+	for i, document := range s.documents {
+		if document.ID == arg.ID && document.UserID == arg.UserID {
+			s.documents = append(s.documents[:i], s.documents[i+1:]...)
+			s.deleted = append(s.deleted, document.ObjectKey)
+			return document, nil
+		}
+	}
+	return db.UserDocument{}, sql.ErrNoRows
+}
+
+// testPNG returns a width by height PNG, red on the left half and blue on the right.
+func testPNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestUserAvatar(t *testing.T) {
+	userID := util.RandomUUID()
+	store := &blobTestStore{profile: db.UserProfile{ID: util.RandomUUID(), UserID: userID, Version: 1}}
+	server := newTestServer(t, store)
+	server.config.AvatarMaxBytes = 64 << 10
+
+	send := func(method, path string, body []byte, callerID uuid.UUID, role int) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(method, path, bytes.NewReader(body))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/octet-stream")
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, callerID, role, time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	path := "/usertx/" + userID.String() + "/avatar"
+
+	require.Equal(t, http.StatusNotFound, send(http.MethodGet, path, nil, userID, 1).Code)
+
+	// The type is sniffed from the bytes, whatever Content-Type says.
+	require.Equal(t, http.StatusUnsupportedMediaType, send(http.MethodPut, path, []byte("%PDF-1.4 not an image"), userID, 1).Code)
+	require.Equal(t, http.StatusBadRequest, send(http.MethodPut, path, nil, userID, 1).Code)
+	require.Equal(t, http.StatusRequestEntityTooLarge, send(http.MethodPut, path, make([]byte, 65<<10), userID, 1).Code)
+	require.Equal(t, http.StatusForbidden, send(http.MethodPut, path, testPNG(t, 10, 10), util.RandomUUID(), 1).Code)
+
+	original := testPNG(t, 300, 200)
+	recorder := send(http.MethodPut, path, original, userID, 1)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var avatar userAvatarResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &avatar))
+	require.Equal(t, "image/png", avatar.AvatarContentType)
+	require.Equal(t, []int{64, 256}, avatar.ThumbnailSizes)
+	require.Equal(t, avatar.AvatarKey, store.profile.AvatarKey)
+
+	recorder = send(http.MethodGet, path, nil, userID, 1)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "image/png", recorder.Header().Get("Content-Type"))
+	require.Equal(t, original, recorder.Body.Bytes())
+
+	// Thumbnails are the centre square, scaled down.
+	recorder = send(http.MethodGet, path+"?size=64", nil, util.RandomUUID(), 3)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	thumb, err := png.Decode(recorder.Body)
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(0, 0, 64, 64), thumb.Bounds())
+	r, _, b, _ := thumb.At(5, 32).RGBA()
+	require.Greater(t, r, b)
+	r, _, b, _ = thumb.At(58, 32).RGBA()
+	require.Greater(t, b, r)
+
+	require.Equal(t, http.StatusBadRequest, send(http.MethodGet, path+"?size=128", nil, userID, 1).Code)
+
+	// Replacing the avatar queues the old one for deletion.
+	previous := avatar.AvatarKey
+	require.Equal(t, http.StatusOK, send(http.MethodPut, path, testPNG(t, 16, 16), userID, 1).Code)
+	require.Equal(t, []string{previous}, store.deleted)
+	require.NotEqual(t, previous, store.profile.AvatarKey)
+
+	recorder = send(http.MethodDelete, path, nil, userID, 1)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &avatar))
+	require.Empty(t, avatar.AvatarKey)
+	require.Empty(t, avatar.ThumbnailSizes)
+	require.Equal(t, http.StatusNotFound, send(http.MethodGet, path, nil, userID, 1).Code)
+}
+
+func TestUserDocuments(t *testing.T) {
+	userID := util.RandomUUID()
+	store := &blobTestStore{profile: db.UserProfile{ID: util.RandomUUID(), UserID: userID, Version: 1}}
+	server := newTestServer(t, store)
+	server.config.DocumentMaxBytes = 1 << 10
+
+	upload := func(filename string, content []byte, callerID uuid.UUID) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", filename)
+		require.NoError(t, err)
+		_, err = part.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, "/usertx/"+userID.String()+"/documents", &body)
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", writer.FormDataContentType())
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, callerID, 1, time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	send := func(method, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(method, path, nil)
+		require.NoError(t, err)
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, userID, 1, time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	require.Equal(t, http.StatusUnsupportedMediaType, upload("run.sh", []byte("\x7fELF\x02\x01\x01"), userID).Code)
+	require.Equal(t, http.StatusRequestEntityTooLarge, upload("big.txt", bytes.Repeat([]byte("a"), 2<<10), userID).Code)
+	require.Equal(t, http.StatusForbidden, upload("notes.txt", []byte("hello"), util.RandomUUID()).Code)
+
+	content := []byte("%PDF-1.4\n% a contract\n")
+	recorder := upload(`C:\Users\me\contract "final".pdf`, content, userID)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	var document userDocumentResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &document))
+	require.Equal(t, `contract "final".pdf`, document.Name)
+	require.Equal(t, "application/pdf", document.ContentType)
+	require.Equal(t, int64(len(content)), document.SizeBytes)
+
+	recorder = send(http.MethodGet, "/usertx/"+userID.String()+"/documents")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var documents []userDocumentResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &documents))
+	require.Equal(t, []userDocumentResponse{document}, documents)
+
+	path := "/usertx/" + userID.String() + "/documents/" + document.ID.String()
+	recorder = send(http.MethodGet, path)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/pdf", recorder.Header().Get("Content-Type"))
+	require.Equal(t, `attachment; filename="contract \"final\".pdf"`, recorder.Header().Get("Content-Disposition"))
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	require.Equal(t, content, body)
+
+	require.Equal(t, http.StatusOK, send(http.MethodDelete, path).Code)
+	require.Len(t, store.deleted, 1)
+	require.Equal(t, http.StatusNotFound, send(http.MethodGet, path).Code)
+	require.Equal(t, http.StatusNotFound, send(http.MethodDelete, path).Code)
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/google/uuid"
+	"whaleWake/apierror"
+)
+
+// pageCursor marks the last row of a page in a keyset-paginated list.
+// Clients treat the encoded form as opaque and hand it back unchanged to fetch the next page.
+// Fields:
+// - Sort: The sort the page was produced with, so a cursor cannot be replayed against a different order.
+// - Value: The last row's value of the sort field.
+// - ID: The last row's id, which breaks ties between equal sort values.
+type pageCursor struct {
+	Sort  string    `json:"s"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"i"`
+}
+
+// encodeCursor returns the opaque next_cursor token for the row a page ended on.
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor token produced by encodeCursor.
+// Parameters:
+// - token: The cursor query parameter as sent by the client. Empty means the first page.
+// - sort: The sort of the current request; the cursor must have been issued for the same sort.
+// Returns:
+// - The decoded cursor and true, or false for the first page.
+// - A 400 *apierror.Error when the token is malformed or was issued for another sort.
+func decodeCursor(token string, sort string) (pageCursor, bool, error) {
+	var cursor pageCursor
+	if token == "" {
+		return cursor, false, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, false, invalidCursorError(err)
+	}
+
+	if err = json.Unmarshal(data, &cursor); err != nil || cursor.ID == uuid.Nil || cursor.Sort != sort {
+		return cursor, false, invalidCursorError(err)
+	}
+
+	return cursor, true, nil
+}
+
+// invalidCursorError reports a cursor that was tampered with or came from somewhere else.
+func invalidCursorError(err error) *apierror.Error {
+	apiErr := apierror.BadRequest("cursor is not valid")
+	apiErr.Err = err
+	return apiErr.WithFields(apierror.FieldError{Field: "cursor", Code: "cursor", Message: "must be a next_cursor value returned by a previous page with the same sort"})
+}
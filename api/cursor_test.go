@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := pageCursor{Sort: "-user_name", Value: "walrus", ID: util.RandomUUID()}
+
+	decoded, ok, err := decodeCursor(encodeCursor(cursor), "-user_name")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, cursor, decoded)
+
+	_, ok, err = decodeCursor("", "created_at")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// A cursor only continues the sort it was issued for
+	_, _, err = decodeCursor(encodeCursor(cursor), "user_name")
+	require.Error(t, err)
+
+	for _, token := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+		_, _, err = decodeCursor(token, "created_at")
+		require.Error(t, err, token)
+	}
+}
+
+// listUsersTestStore pages through a fixed, already sorted slice of users the way the keyset query does,
+// and records the last filter it was given.
+type listUsersTestStore struct {
+	db.Store
+	rows   []db.UserListRow
+	filter db.UserListFilter
+}
+
+func (s *listUsersTestStore) SearchUsersTx(_ context.Context, filter db.UserListFilter) (db.UserListResult, error) {
+	s.filter = filter
+
+	start := 0
+	if filter.CursorID.Valid {
+		for i, row := range s.rows {
+			if row.User.ID == filter.CursorID.UUID {
+				start = i + 1
+			}
+		}
+	}
+
+	end := start + int(filter.Limit)
+	if end > len(s.rows) {
+		end = len(s.rows)
+	}
+	return db.UserListResult{Rows: s.rows[start:end], Total: int64(len(s.rows))}, nil
+}
+
+func newListUsersTestStore(n int) *listUsersTestStore {
+	store := &listUsersTestStore{}
+	createdAt := time.Now()
+	for i := 0; i < n; i++ {
+		store.rows = append(store.rows, db.UserListRow{
+			User: db.User{
+				ID:        util.RandomUUID(),
+				UserName:  util.RandomUserName(),
+				CreatedAt: createdAt.Add(time.Duration(i) * time.Second),
+			},
+		})
+	}
+	return store
+}
+
+func listUsers(t *testing.T, server *Server, query string) (*httptest.ResponseRecorder, listUsersResponse) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/users"+query, nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomUUID(), 3, time.Minute)
+
+	server.router.ServeHTTP(recorder, request)
+
+	var rsp listUsersResponse
+	if recorder.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+	}
+	return recorder, rsp
+}
+
+func TestListUserPagination(t *testing.T) {
+	store := newListUsersTestStore(5)
+	server := newTestServer(t, store)
+
+	recorder, page := listUsers(t, server, "?page_size=2")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Len(t, page.Users, 2)
+	require.Equal(t, int64(5), page.Total)
+	require.Equal(t, store.rows[0].User.ID, page.Users[0].ID)
+	require.NotEmpty(t, page.NextCursor)
+
+	recorder, page = listUsers(t, server, "?page_size=2&cursor="+page.NextCursor)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Len(t, page.Users, 2)
+	require.Equal(t, store.rows[2].User.ID, page.Users[0].ID)
+	require.True(t, store.filter.CursorValue.Valid)
+	require.NotEmpty(t, page.NextCursor)
+
+	// The last page has no next_cursor
+	recorder, page = listUsers(t, server, "?page_size=2&cursor="+page.NextCursor)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Len(t, page.Users, 1)
+	require.Equal(t, store.rows[4].User.ID, page.Users[0].ID)
+	require.Empty(t, page.NextCursor)
+	require.NotContains(t, recorder.Body.String(), "next_cursor")
+
+	recorder, _ = listUsers(t, server, "?page_size=2&cursor=garbage")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"field":"cursor"`)
+
+	recorder, _ = listUsers(t, server, "?page_size=500")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestListUserFilters(t *testing.T) {
+	testCases := []struct {
+		name        string
+		query       string
+		status      int
+		checkFilter func(t *testing.T, filter db.UserListFilter)
+	}{
+		{
+			name:   "Defaults",
+			query:  "?page_size=10",
+			status: http.StatusOK,
+			checkFilter: func(t *testing.T, filter db.UserListFilter) {
+				require.Equal(t, db.UserSortCreatedAt, filter.Sort)
+				require.False(t, filter.Desc)
+				require.False(t, filter.RoleID.Valid)
+				require.False(t, filter.Verified.Valid)
+				require.Equal(t, int32(11), filter.Limit)
+			},
+		}, {
+			name:   "AllFilters",
+			query:  "?page_size=10&role_id=3&verified=false&created_from=2024-01-01T00:00:00Z&created_to=2025-01-01T00:00:00Z&country_code=us&state=CA&city=Oakland&business_name=acme&q=smith&sort=-last_name",
+			status: http.StatusOK,
+			checkFilter: func(t *testing.T, filter db.UserListFilter) {
+				require.Equal(t, int32(3), filter.RoleID.Int32)
+				require.True(t, filter.Verified.Valid)
+				require.False(t, filter.Verified.Bool)
+				require.True(t, filter.CreatedAfter.Valid)
+				require.True(t, filter.CreatedBefore.Valid)
+				require.Equal(t, "us", filter.CountryCode)
+				require.Equal(t, "CA", filter.State)
+				require.Equal(t, "Oakland", filter.City)
+				require.Equal(t, "acme", filter.BusinessName)
+				require.Equal(t, "smith", filter.Search)
+				require.Equal(t, db.UserSortLastName, filter.Sort)
+				require.True(t, filter.Desc)
+			},
+		}, {
+			name:   "UnknownSort",
+			query:  "?page_size=10&sort=password",
+			status: http.StatusBadRequest,
+		}, {
+			name:   "BadVerified",
+			query:  "?page_size=10&verified=maybe",
+			status: http.StatusBadRequest,
+		}, {
+			name:   "BadCreatedFrom",
+			query:  "?page_size=10&created_from=2024-01-01",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			store := newListUsersTestStore(1)
+			server := newTestServer(t, store)
+
+			recorder, _ := listUsers(t, server, tc.query)
+			require.Equal(t, tc.status, recorder.Code)
+			if tc.checkFilter != nil {
+				tc.checkFilter(t, store.filter)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+)
+
+// documentFormOverhead is the room left in the request body for the multipart headers around the file.
+const documentFormOverhead = 64 << 10
+
+// maxDocumentNameLength is the longest document name kept, in characters.
+const maxDocumentNameLength = 255
+
+// documentContentTypes are the file types accepted as documents, as sniffed from the uploaded bytes.
+var documentContentTypes = map[string]bool{
+	"application/pdf":           true,
+	"image/png":                 true,
+	"image/jpeg":                true,
+	"text/plain; charset=utf-8": true,
+}
+
+type userDocumentResponse struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	CreatedAt   string    `json:"created_at"`
+}
+
+func newUserDocumentResponse(document db.UserDocument) userDocumentResponse {
+	return userDocumentResponse{
+		ID:          document.ID,
+		UserID:      document.UserID,
+		Name:        document.Name,
+		ContentType: document.ContentType,
+		SizeBytes:   document.SizeBytes,
+		CreatedAt:   document.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// documentOwner parses the user id of a document route and checks the caller may manage that user's documents.
+// The error has already been sent when ok is false.
+func (server *Server) documentOwner(ctx *gin.Context) (uuid.UUID, bool) {
+	return server.selfOrAdmin(ctx, "You are not authorized to manage this user's documents")
+}
+
+// documentID parses the document id of a document route. The error has already been sent when ok is false.
+func documentID(ctx *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(ctx.Param("document_id"))
+	if err != nil {
+		apierror.Respond(ctx, invalidUUIDError("document_id", err))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// ListUserDocuments handles GET /usertx/:id/documents.
+// Returns 400 for a bad UUID, 403 for other users unless admin, 500 for server errors, 200 for success.
+func (server *Server) ListUserDocuments(ctx *gin.Context) {
+	userID, ok := server.documentOwner(ctx)
+	if !ok {
+		return
+	}
+
+	documents, err := server.store.ListUserDocuments(ctx, userID)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	response := make([]userDocumentResponse, len(documents))
+	for i, document := range documents {
+		response[i] = newUserDocumentResponse(document)
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CreateUserDocument handles POST /usertx/:id/documents to upload a file sent as the multipart form field "file".
+// The type is sniffed from the bytes rather than trusted from the upload.
+// Returns 400 for bad input, 403 for other users unless admin, 404 if the user does not exist, 413 over DOCUMENT_MAX_BYTES, 415 for other file types, 500 for server errors, 201 for success.
+func (server *Server) CreateUserDocument(ctx *gin.Context) {
+	userID, ok := server.documentOwner(ctx)
+	if !ok {
+		return
+	}
+
+	tooLarge := apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeInvalidRequest,
+		fmt.Sprintf("documents are limited to %d bytes", server.config.DocumentMaxBytes))
+
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, server.config.DocumentMaxBytes+documentFormOverhead)
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			apierror.Respond(ctx, tooLarge)
+			return
+		}
+		apierror.Respond(ctx, apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "request failed validation").
+			WithFields(apierror.FieldError{Field: "file", Code: "required", Message: "send the document as multipart form field file"}))
+		return
+	}
+	if header.Size > server.config.DocumentMaxBytes {
+		apierror.Respond(ctx, tooLarge)
+		return
+	}
+	if header.Size == 0 {
+		apierror.Respond(ctx, apierror.BadRequest("the document is empty"))
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		apierror.Respond(ctx, apierror.Internal(err))
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		apierror.Respond(ctx, apierror.Internal(err))
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	if !documentContentTypes[contentType] {
+		apierror.Respond(ctx, apierror.New(http.StatusUnsupportedMediaType, apierror.CodeInvalidRequest,
+			"documents must be PDF, PNG, JPEG, or plain text files"))
+		return
+	}
+
+	key := db.NewDocumentKey(userID)
+	if err = server.blobs.Put(ctx, key, data, contentType); err != nil {
+		apierror.Respond(ctx, apierror.Internal(err))
+		return
+	}
+
+	document, err := server.store.CreateUserDocumentTx(auditContext(ctx), db.CreateUserDocumentParams{
+		UserID:      userID,
+		Name:        documentName(header.Filename),
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+		ObjectKey:   key,
+	})
+	if err != nil {
+		server.deleteBlobs(key)
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("user not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, newUserDocumentResponse(document))
+}
+
+// GetUserDocument handles GET /usertx/:id/documents/:document_id to download a document as an attachment.
+// Returns 400 for a bad UUID, 403 for other users unless admin, 404 if not found, 500 for server errors, 200 with the file.
+func (server *Server) GetUserDocument(ctx *gin.Context) {
+	userID, ok := server.documentOwner(ctx)
+	if !ok {
+		return
+	}
+	id, ok := documentID(ctx)
+	if !ok {
+		return
+	}
+
+	document, err := server.store.GetUserDocument(ctx, db.GetUserDocumentParams{ID: id, UserID: userID})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("document not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	server.sendBlob(ctx, document.ObjectKey, document.ContentType, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": document.Name}),
+	})
+}
+
+// DeleteUserDocument handles DELETE /usertx/:id/documents/:document_id. The file is deleted in the background.
+// Returns 400 for a bad UUID, 403 for other users unless admin, 404 if not found, 500 for server errors, 200 for success.
+func (server *Server) DeleteUserDocument(ctx *gin.Context) {
+	userID, ok := server.documentOwner(ctx)
+	if !ok {
+		return
+	}
+	id, ok := documentID(ctx)
+	if !ok {
+		return
+	}
+
+	document, err := server.store.DeleteUserDocumentTx(auditContext(ctx), db.DeleteUserDocumentParams{ID: id, UserID: userID})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("document not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserDocumentResponse(document))
+}
+
+// documentName keeps the base name of an uploaded file, without control characters and cut to
+// maxDocumentNameLength characters. Unnamed uploads are called "document".
+func documentName(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "document"
+	}
+	if utf8.RuneCountInString(name) > maxDocumentNameLength {
+		name = string([]rune(name)[:maxDocumentNameLength])
+	}
+	return name
+}
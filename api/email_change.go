@@ -0,0 +1,199 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/mail"
+)
+
+// emailChangeTokenBytes is the number of random bytes in a confirm or revert token.
+const emailChangeTokenBytes = 32
+
+// emailChangeTokenRequest defines the payload for confirming or reverting an email change.
+// Fields:
+// - Token: required, the token from the link in the email.
+type emailChangeTokenRequest struct {
+	Token string `json:"token" binding:"required,max=128"`
+}
+
+// emailChangeRequest is an email change to start together with an update of a user. The tokens are kept to mail
+// once the update has committed; the store only sees their hashes.
+// Fields:
+// - params: The change for the store, see db.StartEmailChangeParams.
+// - confirmToken: The token for the link to the new address.
+// - revertToken: The token for the link to the old address.
+type emailChangeRequest struct {
+	params       db.StartEmailChangeParams
+	confirmToken string
+	revertToken  string
+}
+
+// newEmailChangeRequest makes the tokens for a change to newEmail. The store decides inside the update whether
+// the address actually changes, see db.SQLStore.UpdateUserTx. Returns nil when no address was given.
+func (server *Server) newEmailChangeRequest(newEmail string) (*emailChangeRequest, error) {
+	if newEmail == "" {
+		return nil, nil
+	}
+
+	confirmToken, err := newEmailChangeToken()
+	if err != nil {
+		return nil, apierror.Internal(err)
+	}
+	revertToken, err := newEmailChangeToken()
+	if err != nil {
+		return nil, apierror.Internal(err)
+	}
+
+	now := time.Now()
+	return &emailChangeRequest{
+		params: db.StartEmailChangeParams{
+			NewEmail:         newEmail,
+			ConfirmTokenHash: hashEmailChangeToken(confirmToken),
+			RevertTokenHash:  hashEmailChangeToken(revertToken),
+			ExpiresAt:        now.Add(server.config.EmailChangeTTL),
+			RevertExpiresAt:  now.Add(server.config.EmailRevertTTL),
+		},
+		confirmToken: confirmToken,
+		revertToken:  revertToken,
+	}, nil
+}
+
+// storeParams returns the change to pass to the store, or nil when there is none.
+func (request *emailChangeRequest) storeParams() *db.StartEmailChangeParams {
+	if request == nil {
+		return nil
+	}
+	return &request.params
+}
+
+// emailTakenError maps db.ErrEmailTaken from an update that starts an email change to 409; other errors are
+// returned as they are.
+func emailTakenError(err error) error {
+	if errors.Is(err, db.ErrEmailTaken) {
+		return apierror.New(http.StatusConflict, apierror.CodeAlreadyExists, "email already exists").
+			WithFields(apierror.FieldError{Field: "email", Code: "unique", Message: "is already taken"})
+	}
+	return err
+}
+
+// sendEmailChangeMessages sends the confirm link to the new address and the revert link to the old one, once the
+// update that started the change has committed. A failure is only logged: the update has been applied, and the
+// user can ask for the change again to get new links.
+func (server *Server) sendEmailChangeMessages(ctx *gin.Context, user db.User, change db.EmailChange, request *emailChangeRequest) {
+	messages := []mail.Message{
+		{
+			To:      change.NewEmail,
+			Subject: "Confirm your new email address",
+			Body: fmt.Sprintf("Someone asked to change the email address of %s to this address. To confirm, open:\n\n%s\n\n"+
+				"The link expires in %s. If this wasn't you, ignore this email.",
+				user.UserName, server.emailChangeLink("confirm", request.confirmToken), server.config.EmailChangeTTL),
+		},
+		{
+			To:      change.OldEmail,
+			Subject: "Your email address is being changed",
+			Body: fmt.Sprintf("Someone asked to change the email address of %s to %s. It changes once the new address "+
+				"confirms it.\n\nIf this wasn't you, open this link to keep %s:\n\n%s\n\nThe link works for %s.",
+				user.UserName, change.NewEmail, change.OldEmail, server.emailChangeLink("revert", request.revertToken), server.config.EmailRevertTTL),
+		},
+	}
+	for _, message := range messages {
+		if err := server.mailSender.Send(ctx, message); err != nil {
+			log.Printf("Unable to send an email change message for user %s: %v", user.ID, err)
+		}
+	}
+}
+
+// emailChangeLink returns the link to the page that posts a token to the confirm or revert endpoint. The link
+// leads to a page rather than the API itself so mail scanners that follow links can't use the token.
+func (server *Server) emailChangeLink(action, token string) string {
+	return fmt.Sprintf("%s/email-change/%s?token=%s", strings.TrimRight(server.config.EmailLinkBaseURL, "/"), action, url.QueryEscape(token))
+}
+
+// ConfirmEmailChange handles POST /email-changes/confirm to apply a pending email change with the token sent to
+// the new address. The token is the credential, so no authorization is needed.
+// Returns 400 for bad input or an unknown token, 409 if the address was taken meanwhile, 422 when the token has expired or was used, 500 for server errors, 200 with the user.
+func (server *Server) ConfirmEmailChange(ctx *gin.Context) {
+	var req emailChangeTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	user, err := server.store.ConfirmEmailChangeTx(ctx, hashEmailChangeToken(req.Token), time.Now())
+	if err != nil {
+		apierror.Respond(ctx, emailChangeTokenError(err))
+		return
+	}
+
+	ctx.Header(etagHeaderKey, userETag(user))
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// RevertEmailChange handles POST /email-changes/revert with the token sent to the old address. A pending change is
+// cancelled and a confirmed one undone. The token is the credential, so no authorization is needed.
+// Returns 400 for bad input or an unknown token, 409 if the old address was taken meanwhile, 422 when the token has expired or was used, 500 for server errors, 200 with the user.
+func (server *Server) RevertEmailChange(ctx *gin.Context) {
+	var req emailChangeTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	user, err := server.store.RevertEmailChangeTx(ctx, hashEmailChangeToken(req.Token), time.Now())
+	if err != nil {
+		apierror.Respond(ctx, emailChangeTokenError(err))
+		return
+	}
+
+	ctx.Header(etagHeaderKey, userETag(user))
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// emailChangeTokenError maps the token errors of the email change store methods to API errors.
+func emailChangeTokenError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrEmailChangeTokenInvalid):
+		return apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "request failed validation").
+			WithFields(apierror.FieldError{Field: "token", Code: "invalid", Message: "is not a valid email change token"})
+	case errors.Is(err, db.ErrEmailChangeTokenExpired):
+		return apierror.Unprocessable(apierror.CodeUnprocessable, "the email change link has expired or was already used")
+	}
+	return err
+}
+
+// newEmailChangeToken returns a random URL-safe token.
+func newEmailChangeToken() (string, error) {
+	token := make([]byte, emailChangeTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// hashEmailChangeToken hashes a token for storage. The tokens are random and long, so a plain hash is enough.
+func hashEmailChangeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/mail"
+	"whaleWake/util"
+)
+
+// recordingMailSender keeps the messages it is asked to send.
+type recordingMailSender struct {
+	messages []mail.Message
+}
+
+func (s *recordingMailSender) Send(_ context.Context, message mail.Message) error {
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+// failingMailSender fails every send.
+type failingMailSender struct{}
+
+func (failingMailSender) Send(context.Context, mail.Message) error {
+	return errors.New("mail server unavailable")
+}
+
+// emailChangeTestStore holds one user and at most one email change, applied the way the SQL store does.
+type emailChangeTestStore struct {
+	db.Store
+	user   db.User
+	change db.EmailChange
+	taken  string
+}
+
+func (s *emailChangeTestStore) UpdateUserTx(_ context.Context, arg db.UpdateUserParams, emailChange *db.StartEmailChangeParams) (db.UpdateUserTxResult, error) {
+	if emailChange == nil || strings.EqualFold(emailChange.NewEmail, s.user.Email) {
+		s.user.UserName = arg.UserName
+		s.user.Version++
+		return db.UpdateUserTxResult{User: s.user}, nil
+	}
+	if strings.EqualFold(emailChange.NewEmail, s.taken) {
+		return db.UpdateUserTxResult{}, db.ErrEmailTaken
+	}
+	s.user.UserName = arg.UserName
+	s.user.Version++
+	s.change = db.EmailChange{
+		ID:               util.RandomUUID(),
+		UserID:           s.user.ID,
+		OldEmail:         s.user.Email,
+		NewEmail:         emailChange.NewEmail,
+		ConfirmTokenHash: emailChange.ConfirmTokenHash,
+		RevertTokenHash:  emailChange.RevertTokenHash,
+		ExpiresAt:        emailChange.ExpiresAt,
+		RevertExpiresAt:  emailChange.RevertExpiresAt,
+	}
+	change := s.change
+	return db.UpdateUserTxResult{User: s.user, EmailChange: &change}, nil
+}
+
+func (s *emailChangeTestStore) ConfirmEmailChangeTx(_ context.Context, tokenHash string, now time.Time) (db.User, error) {
+	switch {
+	case tokenHash != s.change.ConfirmTokenHash:
+		return db.User{}, db.ErrEmailChangeTokenInvalid
+	case s.change.ConfirmedAt.Valid || !now.Before(s.change.ExpiresAt):
+		return db.User{}, db.ErrEmailChangeTokenExpired
+	}
+	s.change.ConfirmedAt.Valid = true
+	s.user.Email = s.change.NewEmail
+	return s.user, nil
+}
+
+func (s *emailChangeTestStore) RevertEmailChangeTx(_ context.Context, tokenHash string, _ time.Time) (db.User, error) {
+	if tokenHash != s.change.RevertTokenHash {
+		return db.User{}, db.ErrEmailChangeTokenInvalid
+	}
+	s.user.Email = s.change.OldEmail
+	return s.user, nil
+}
+
+var emailChangeTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// emailChangeToken returns the token of the link in a message.
+func emailChangeToken(t *testing.T, message mail.Message) string {
+	match := emailChangeTokenPattern.FindStringSubmatch(message.Body)
+	require.Len(t, match, 2)
+	return match[1]
+}
+
+func newEmailChangeTestServer(t *testing.T) (*Server, *emailChangeTestStore, *recordingMailSender) {
+	store := &emailChangeTestStore{user: db.User{ID: util.RandomUUID(), UserName: "ahab", Email: "ahab@pequod.example", Version: 1}}
+	server := newTestServer(t, store)
+	server.config.EmailChangeTTL = time.Hour
+	server.config.EmailRevertTTL = 24 * time.Hour
+	server.config.EmailLinkBaseURL = "https://app.example/"
+	sender := &recordingMailSender{}
+	server.mailSender = sender
+	return server, store, sender
+}
+
+// changeEmail sends PUT /users with a new email address as the user.
+func changeEmail(t *testing.T, server *Server, store *emailChangeTestStore, email string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	body := `{"id": "` + store.user.ID.String() + `", "user_name": "ahab", "email": "` + email + `", "password": "secret123"}`
+	request, err := http.NewRequest(http.MethodPut, "/users", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, store.user.ID, 1, time.Minute)
+
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// postEmailChangeToken posts a token to the confirm or revert endpoint.
+func postEmailChangeToken(t *testing.T, server *Server, action, token string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/email-changes/"+action, bytes.NewBufferString(`{"token": "`+token+`"}`))
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestUpdateUserEmailChange(t *testing.T) {
+	server, store, sender := newEmailChangeTestServer(t)
+
+	recorder := changeEmail(t, server, store, "ishmael@pequod.example")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response userResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "ahab@pequod.example", response.Email)
+	require.Equal(t, "ishmael@pequod.example", response.PendingEmail)
+
+	require.Len(t, sender.messages, 2)
+	require.Equal(t, "ishmael@pequod.example", sender.messages[0].To)
+	require.Contains(t, sender.messages[0].Body, "https://app.example/email-change/confirm?token=")
+	require.Equal(t, "ahab@pequod.example", sender.messages[1].To)
+	require.Contains(t, sender.messages[1].Body, "https://app.example/email-change/revert?token=")
+
+	confirmToken := emailChangeToken(t, sender.messages[0])
+	revertToken := emailChangeToken(t, sender.messages[1])
+	require.NotEqual(t, confirmToken, revertToken)
+	require.Equal(t, hashEmailChangeToken(confirmToken), store.change.ConfirmTokenHash)
+
+	// The revert token can't confirm.
+	requireFieldError(t, postEmailChangeToken(t, server, "confirm", revertToken), "token", "invalid")
+
+	recorder = postEmailChangeToken(t, server, "confirm", confirmToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "ishmael@pequod.example", response.Email)
+
+	// A token works once.
+	recorder = postEmailChangeToken(t, server, "confirm", confirmToken)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	recorder = postEmailChangeToken(t, server, "revert", revertToken)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "ahab@pequod.example", response.Email)
+}
+
+func TestUpdateUserEmailUnchanged(t *testing.T) {
+	server, store, sender := newEmailChangeTestServer(t)
+
+	recorder := changeEmail(t, server, store, "AHAB@pequod.example")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response userResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Empty(t, response.PendingEmail)
+	require.Empty(t, sender.messages)
+}
+
+func TestUpdateUserEmailTaken(t *testing.T) {
+	server, store, sender := newEmailChangeTestServer(t)
+	store.taken = "starbuck@pequod.example"
+
+	recorder := changeEmail(t, server, store, "starbuck@pequod.example")
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	require.Empty(t, recorder.Header().Get(etagHeaderKey))
+	require.Equal(t, int32(1), store.user.Version)
+	require.Empty(t, sender.messages)
+}
+
+func TestUpdateUserEmailChangeMailFails(t *testing.T) {
+	server, store, _ := newEmailChangeTestServer(t)
+	server.mailSender = failingMailSender{}
+
+	recorder := changeEmail(t, server, store, "ishmael@pequod.example")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, userETag(store.user), recorder.Header().Get(etagHeaderKey))
+
+	var response userResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "ishmael@pequod.example", response.PendingEmail)
+}
+
+func TestEmailChangeLink(t *testing.T) {
+	server, _, _ := newEmailChangeTestServer(t)
+
+	link, err := url.Parse(server.emailChangeLink("confirm", "a-b_c"))
+	require.NoError(t, err)
+	require.Equal(t, "/email-change/confirm", link.Path)
+	require.Equal(t, "a-b_c", link.Query().Get("token"))
+}
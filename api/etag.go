@@ -0,0 +1,73 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"strings"
+	db "whaleWake/db/sqlc"
+)
+
+const (
+	etagHeaderKey    = "ETag"
+	ifMatchHeaderKey = "If-Match"
+)
+
+// errPreconditionFailed is returned when an If-Match header does not match the current resource version.
+var errPreconditionFailed = errors.New("resource has been modified, refetch and retry")
+
+// userETag builds the entity tag for a single user from its row version.
+func userETag(user db.User) string {
+	return fmt.Sprintf(`"%d"`, user.Version)
+}
+
+// userTxETag builds the entity tag for a user with profile and role.
+// The tag combines the versions of all three rows so that a change to any of them invalidates it.
+func userTxETag(result db.UserTxResult) string {
+	return fmt.Sprintf(`"%d.%d.%d"`, result.User.Version, result.UserProfile.Version, result.UserRole.Version)
+}
+
+// userAddressETag builds the entity tag for an address from its row version.
+func userAddressETag(address db.UserAddress) string {
+	return fmt.Sprintf(`"%d"`, address.Version)
+}
+
+// ifMatch returns the raw If-Match value, or false when the header is absent or "*".
+func ifMatch(ctx *gin.Context) (string, bool) {
+	value := strings.TrimSpace(ctx.GetHeader(ifMatchHeaderKey))
+	if value == "" || value == "*" {
+		return "", false
+	}
+	return value, true
+}
+
+// parseETagVersions splits an entity tag into the expected row versions.
+// Parameters:
+// - etag: The quoted entity tag, e.g. "3" or "3.1.2".
+// - parts: The number of versions the tag must contain.
+// Returns:
+// - The versions as NullInt32 values ready to pass to the update queries.
+// - errPreconditionFailed if the tag is weak or malformed, since it can never match.
+func parseETagVersions(etag string, parts int) ([]sql.NullInt32, error) {
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) || len(etag) < 2 {
+		return nil, errPreconditionFailed
+	}
+
+	fields := strings.Split(strings.Trim(etag, `"`), ".")
+	if len(fields) != parts {
+		return nil, errPreconditionFailed
+	}
+
+	versions := make([]sql.NullInt32, parts)
+	for i, field := range fields {
+		version, err := strconv.ParseInt(field, 10, 32)
+		if err != nil {
+			return nil, errPreconditionFailed
+		}
+		versions[i] = sql.NullInt32{Int32: int32(version), Valid: true}
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+func TestUserTxETag(t *testing.T) {
+	result := db.UserTxResult{
+		User:        db.User{Version: 3},
+		UserProfile: db.UserProfile{Version: 1},
+		UserRole:    db.UserRole{Version: 2},
+	}
+
+	etag := userTxETag(result)
+	require.Equal(t, `"3.1.2"`, etag)
+
+	versions, err := parseETagVersions(etag, 3)
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	require.Equal(t, int32(3), versions[0].Int32)
+	require.Equal(t, int32(1), versions[1].Int32)
+	require.Equal(t, int32(2), versions[2].Int32)
+	for _, version := range versions {
+		require.True(t, version.Valid)
+	}
+}
+
+func TestParseETagVersions(t *testing.T) {
+	testCases := []struct {
+		name  string
+		etag  string
+		parts int
+		ok    bool
+	}{
+		{name: "Single", etag: `"7"`, parts: 1, ok: true},
+		{name: "Unquoted", etag: `7`, parts: 1},
+		{name: "Weak", etag: `W/"7"`, parts: 1},
+		{name: "WrongParts", etag: `"1.2"`, parts: 3},
+		{name: "NotNumeric", etag: `"a.b.c"`, parts: 3},
+		{name: "Empty", etag: `""`, parts: 1},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			versions, err := parseETagVersions(tc.etag, tc.parts)
+			if tc.ok {
+				require.NoError(t, err)
+				require.Len(t, versions, tc.parts)
+				return
+			}
+			require.ErrorIs(t, err, errPreconditionFailed)
+		})
+	}
+}
+
+// deleteTestStore holds one live user and deletes it the way the delete queries do, only at the expected versions.
+type deleteTestStore struct {
+	db.Store
+	user db.UserTxResult
+}
+
+func (s *deleteTestStore) GetUser(_ context.Context, id uuid.UUID) (db.User, error) {
+	if id != s.user.User.ID || s.user.User.DeletedAt.Valid {
+		return db.User{}, sql.ErrNoRows
+	}
+	return s.user.User, nil
+}
+
+func (s *deleteTestStore) DeleteUserWithProfileAndRoleTX(_ context.Context, userParams db.DeleteUserParams, profileParams db.DeleteUserProfileParams, roleParams db.DeleteUserRoleParams) (db.UserTxResult, error) {
+	stale := func(expected sql.NullInt32, version int32) bool { return expected.Valid && expected.Int32 != version }
+	if userParams.ID != s.user.User.ID || s.user.User.DeletedAt.Valid ||
+		stale(userParams.ExpectedVersion, s.user.User.Version) ||
+		stale(profileParams.ExpectedVersion, s.user.UserProfile.Version) ||
+		stale(roleParams.ExpectedVersion, s.user.UserRole.Version) {
+		return db.UserTxResult{}, sql.ErrNoRows
+	}
+	s.user.User.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	return s.user, nil
+}
+
+func TestDeleteUserIfMatch(t *testing.T) {
+	testCases := []struct {
+		name    string
+		path    string
+		ifMatch string
+		status  int
+	}{
+		{name: "StaleUser", path: "/users/%s", ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+		{name: "StaleProfile", path: "/usertx/%s", ifMatch: `"3.2.2"`, status: http.StatusPreconditionFailed},
+		{name: "Malformed", path: "/usertx/%s", ifMatch: `"3"`, status: http.StatusPreconditionFailed},
+		{name: "User", path: "/users/%s", ifMatch: `"3"`, status: http.StatusOK},
+		{name: "UserTx", path: "/usertx/%s", ifMatch: `"3.1.2"`, status: http.StatusOK},
+		{name: "NoIfMatch", path: "/usertx/%s", status: http.StatusOK},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			store := &deleteTestStore{user: db.UserTxResult{
+				User:        db.User{ID: util.RandomUUID(), Version: 3},
+				UserProfile: db.UserProfile{Version: 1},
+				UserRole:    db.UserRole{Version: 2},
+			}}
+			server := newTestServer(t, store)
+
+			send := func() int {
+				recorder := httptest.NewRecorder()
+				request, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(tc.path, store.user.User.ID), nil)
+				require.NoError(t, err)
+				if tc.ifMatch != "" {
+					request.Header.Set(ifMatchHeaderKey, tc.ifMatch)
+				}
+				addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomUUID(), 3, time.Minute)
+				server.router.ServeHTTP(recorder, request)
+				return recorder.Code
+			}
+
+			require.Equal(t, tc.status, send())
+			if tc.status == http.StatusOK {
+				// Deleting again finds no user, whatever the version.
+				require.Equal(t, http.StatusNotFound, send())
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/events"
+	"whaleWake/token"
+)
+
+// eventStreamHeartbeat is how often an idle stream sends a comment, so proxies keep the connection open.
+const eventStreamHeartbeat = 15 * time.Second
+
+// eventStreamReplayPage is how many missed events are read from the outbox at a time when a stream resumes.
+const eventStreamReplayPage = 100
+
+// eventStreamRetry is how long clients are told to wait before reconnecting, in milliseconds.
+const eventStreamRetry = 3000
+
+// StreamEvents handles GET /events/stream, a Server-Sent Events stream of user lifecycle events as they are
+// committed. Admins receive every event; other users only the events about themselves.
+// Each event is sent with its stream position as the SSE id and its type, such as user.created, as the SSE event
+// name; the data is the event as JSON. Positions follow the order events were committed in, which outbox IDs
+// don't, so a client that reconnects with the Last-Event-ID header, or ?last_event_id= on the first connection,
+// is first sent every event committed since, as long as it is still in the outbox.
+// Browsers' EventSource cannot send the Authorization header, so dashboards need a client that can.
+// Returns 400 for a bad Last-Event-ID, 500 for server errors, and otherwise 200 with a stream that runs until the
+// client disconnects or falls too far behind, after which it should reconnect.
+func (server *Server) StreamEvents(ctx *gin.Context) {
+	lastEventID := ctx.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = ctx.Query("last_event_id")
+	}
+	var after int64 // The position of the last event sent.
+	if lastEventID != "" {
+		var err error
+		if after, err = strconv.ParseInt(lastEventID, 10, 64); err != nil || after < 0 {
+			apierror.Respond(ctx, apierror.BadRequest("Last-Event-ID must be the id of an event").
+				WithFields(apierror.FieldError{Field: "last_event_id", Code: "min", Message: "must be a non-negative integer"}))
+			return
+		}
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	// Only admins see other users' events.
+	var onlyUser uuid.NullUUID
+	if authPayload.RoleID != 3 {
+		onlyUser = uuid.NullUUID{UUID: authPayload.UserID, Valid: true}
+	}
+
+	// Subscribe before reading missed events, so none are lost in between; the ones seen twice are skipped.
+	live, unsubscribe := server.eventHub.Subscribe()
+	defer unsubscribe()
+
+	missedEvents := func() ([]db.Outbox, error) {
+		if lastEventID == "" {
+			return nil, nil
+		}
+		return server.store.ListOutboxEventsAfter(ctx, db.ListOutboxEventsAfterParams{
+			AfterPosition: after,
+			UserID:        onlyUser,
+			PageLimit:     eventStreamReplayPage,
+		})
+	}
+	missed, err := missedEvents()
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	if _, err = fmt.Fprintf(ctx.Writer, "retry: %d\n\n", eventStreamRetry); err != nil {
+		return
+	}
+
+	for len(missed) > 0 {
+		for _, event := range missed {
+			if err = writeStreamEvent(ctx.Writer, outboxEvent(event)); err != nil {
+				return
+			}
+			after = event.StreamPosition.Int64
+		}
+		ctx.Writer.Flush()
+		if len(missed) < eventStreamReplayPage {
+			break
+		}
+		if missed, err = missedEvents(); err != nil {
+			// The stream has started, so all that is left is to end it; the client resumes from the last event.
+			_ = ctx.Error(err)
+			return
+		}
+	}
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case event, ok := <-live:
+			if !ok {
+				return
+			}
+			if event.Position <= after || (onlyUser.Valid && event.UserID != onlyUser.UUID) {
+				continue
+			}
+			if err := writeStreamEvent(ctx.Writer, event); err != nil {
+				return
+			}
+			after = event.Position
+			ctx.Writer.Flush()
+		case <-heartbeat.C:
+			if _, err := io.WriteString(ctx.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			ctx.Writer.Flush()
+		}
+	}
+}
+
+// writeStreamEvent writes one event in the Server-Sent Events format.
+func writeStreamEvent(w io.Writer, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Position, event.Type, data)
+	return err
+}
+
+// outboxEvent is the event a committed outbox row records, as it is streamed.
+func outboxEvent(event db.Outbox) events.Event {
+	return events.Event{
+		ID:         event.ID,
+		Position:   event.StreamPosition.Int64,
+		Type:       event.EventType,
+		UserID:     event.UserID,
+		OccurredAt: event.CreatedAt,
+		Data:       event.Data,
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/events"
+	"whaleWake/util"
+)
+
+// eventStreamTestStore serves the events of its outbox, which is in commit order.
+type eventStreamTestStore struct {
+	db.Store
+	outbox []db.Outbox
+}
+
+func (s *eventStreamTestStore) ListOutboxEventsAfter(_ context.Context, arg db.ListOutboxEventsAfterParams) ([]db.Outbox, error) {
+	events := []db.Outbox{}
+	for _, event := range s.outbox {
+		if event.StreamPosition.Int64 > arg.AfterPosition && (!arg.UserID.Valid || event.UserID == arg.UserID.UUID) && len(events) < int(arg.PageLimit) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// streamedEvent is an event as read from the stream.
+type streamedEvent struct {
+	id    string
+	name  string
+	event events.Event
+}
+
+// openEventStream connects to GET /events/stream and returns a function that reads the next event.
+func openEventStream(t *testing.T, server *Server, userID uuid.UUID, role int, lastEventID string) (*http.Response, func() streamedEvent) {
+	httpServer := httptest.NewServer(server.router)
+	t.Cleanup(httpServer.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/events/stream", nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, userID, role, time.Minute)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = response.Body.Close() })
+
+	reader := bufio.NewReader(response.Body)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "retry: 3000\n", line)
+
+	return response, func() streamedEvent {
+		var streamed streamedEvent
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				streamed.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				streamed.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &streamed.event))
+			case line == "" && streamed.id != "":
+				return streamed
+			}
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	admin, ahab, ishmael := util.RandomUUID(), util.RandomUUID(), util.RandomUUID()
+	store := &eventStreamTestStore{}
+	// Ishmael's event got the higher ID but committed first.
+	for i, row := range []struct {
+		id     int64
+		userID uuid.UUID
+	}{{1, ahab}, {3, ishmael}, {2, ahab}} {
+		store.outbox = append(store.outbox, db.Outbox{
+			ID:             row.id,
+			StreamPosition: sql.NullInt64{Int64: int64(i + 1), Valid: true},
+			EventType:      db.EventUserUpdated,
+			UserID:         row.userID,
+			Data:           json.RawMessage(`{}`),
+		})
+	}
+
+	hub := events.NewHub(10)
+	server := newTestServer(t, store)
+	server.eventHub = hub
+
+	live := func(id, position int64, userID uuid.UUID) events.Event {
+		return events.Event{ID: id, Position: position, Type: db.EventUserDeleted, UserID: userID, Data: json.RawMessage(`{"version": 2}`)}
+	}
+
+	t.Run("AdminResumes", func(t *testing.T) {
+		response, next := openEventStream(t, server, admin, 3, "1")
+		require.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+		// Missed events first, then live ones, skipping any already sent.
+		require.Equal(t, "2", next().id)
+		require.Equal(t, "3", next().id)
+
+		hub.Broadcast(live(2, 3, ahab))
+		hub.Broadcast(live(5, 4, ishmael))
+		streamed := next()
+		require.Equal(t, "4", streamed.id)
+		require.Equal(t, db.EventUserDeleted, streamed.name)
+		require.Equal(t, ishmael, streamed.event.UserID)
+		require.Equal(t, int64(5), streamed.event.ID)
+		require.JSONEq(t, `{"version": 2}`, string(streamed.event.Data))
+	})
+
+	t.Run("CommittedOutOfIDOrder", func(t *testing.T) {
+		// Resuming after Ishmael's event still sends Ahab's, although its ID is lower.
+		_, next := openEventStream(t, server, admin, 3, "2")
+		streamed := next()
+		require.Equal(t, "3", streamed.id)
+		require.Equal(t, int64(2), streamed.event.ID)
+
+		// The same goes for live events.
+		hub.Broadcast(live(7, 4, ishmael))
+		hub.Broadcast(live(6, 5, ahab))
+		require.Equal(t, "4", next().id)
+		streamed = next()
+		require.Equal(t, "5", streamed.id)
+		require.Equal(t, int64(6), streamed.event.ID)
+	})
+
+	t.Run("OwnEventsOnly", func(t *testing.T) {
+		_, next := openEventStream(t, server, ahab, 1, "0")
+		require.Equal(t, "1", next().id)
+		require.Equal(t, "3", next().id)
+
+		hub.Broadcast(live(8, 6, ishmael))
+		hub.Broadcast(live(9, 7, ahab))
+		streamed := next()
+		require.Equal(t, "7", streamed.id)
+		require.Equal(t, ahab, streamed.event.UserID)
+	})
+
+	t.Run("LiveOnly", func(t *testing.T) {
+		_, next := openEventStream(t, server, admin, 3, "")
+		hub.Broadcast(live(10, 8, ahab))
+		require.Equal(t, "8", next().id)
+	})
+
+	t.Run("BadLastEventID", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/events/stream?last_event_id=latest", nil)
+		require.NoError(t, err)
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, admin, 3, time.Minute)
+		server.router.ServeHTTP(recorder, request)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+		var problem apierror.Problem
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+		require.Len(t, problem.Errors, 1)
+		require.Equal(t, "last_event_id", problem.Errors[0].Field)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/events/stream", nil)
+		require.NoError(t, err)
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
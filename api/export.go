@@ -0,0 +1,277 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/token"
+)
+
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+	exportFormatXLSX   = "xlsx"
+)
+
+// exportContentTypes is the media type of each export format.
+var exportContentTypes = map[string]string{
+	exportFormatCSV:    "text/csv; charset=utf-8",
+	exportFormatNDJSON: "application/x-ndjson",
+	exportFormatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportUsersRequest defines the query parameters for GET /users/export.
+// Fields:
+// - The filters and sort of userFilterRequest.
+// - Format: csv (default), ndjson, or xlsx.
+type exportUsersRequest struct {
+	userFilterRequest
+	Format string `form:"format" binding:"omitempty,oneof=csv ndjson xlsx"`
+}
+
+// exportUserRecord is one exported user. Password hashes are never exported.
+// The profile and role fields are empty for users created without them. Attributes holds the custom attributes
+// the user has a value for; attributeKeys are the attributes given a column in CSV and XLSX files.
+type exportUserRecord struct {
+	ID            uuid.UUID                  `json:"id"`
+	UserName      string                     `json:"user_name"`
+	Email         string                     `json:"email"`
+	FirstName     string                     `json:"first_name"`
+	LastName      string                     `json:"last_name"`
+	BusinessName  string                     `json:"business_name"`
+	StreetAddress string                     `json:"street_address"`
+	City          string                     `json:"city"`
+	State         string                     `json:"state"`
+	Zip           string                     `json:"zip"`
+	CountryCode   string                     `json:"country_code"`
+	RoleID        *int32                     `json:"role_id"`
+	CreatedAt     string                     `json:"created_at"`
+	UpdatedAt     string                     `json:"updated_at"`
+	VerifiedAt    *string                    `json:"verified_at"`
+	Attributes    map[string]json.RawMessage `json:"attributes"`
+	attributeKeys []string
+}
+
+// exportColumns are the CSV and XLSX column names, in the order of exportUserRecord.values.
+// They are followed by one column per custom attribute, see exportHeader.
+var exportColumns = []string{"id", "user_name", "email", "first_name", "last_name", "business_name", "street_address",
+	"city", "state", "zip", "country_code", "role_id", "created_at", "updated_at", "verified_at"}
+
+// exportHeader returns the CSV and XLSX column names: exportColumns, then attributes.<key> for each attribute.
+func exportHeader(attributeKeys []string) []string {
+	header := append([]string(nil), exportColumns...)
+	for _, key := range attributeKeys {
+		header = append(header, "attributes."+key)
+	}
+	return header
+}
+
+func newExportUserRecord(row db.UserListRow, attributeKeys []string) exportUserRecord {
+	record := exportUserRecord{
+		ID:            row.User.ID,
+		UserName:      row.User.UserName,
+		Email:         row.User.Email,
+		FirstName:     row.FirstName.String,
+		LastName:      row.LastName.String,
+		BusinessName:  row.BusinessName.String,
+		StreetAddress: row.StreetAddress.String,
+		City:          row.City.String,
+		State:         row.State.String,
+		Zip:           row.Zip.String,
+		CountryCode:   row.CountryCode.String,
+		CreatedAt:     row.User.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     row.User.UpdatedAt.Format(time.RFC3339),
+		VerifiedAt:    historyTime(row.User.VerifiedAt),
+		Attributes:    row.Attributes,
+		attributeKeys: attributeKeys,
+	}
+	if record.Attributes == nil {
+		record.Attributes = map[string]json.RawMessage{}
+	}
+	if row.RoleID.Valid {
+		roleID := row.RoleID.Int32
+		record.RoleID = &roleID
+	}
+	return record
+}
+
+// values returns the record as text cells in exportHeader order; missing values are empty.
+func (record exportUserRecord) values() []string {
+	var roleID, verifiedAt string
+	if record.RoleID != nil {
+		roleID = strconv.Itoa(int(*record.RoleID))
+	}
+	if record.VerifiedAt != nil {
+		verifiedAt = *record.VerifiedAt
+	}
+	values := []string{record.ID.String(), record.UserName, record.Email, record.FirstName, record.LastName,
+		record.BusinessName, record.StreetAddress, record.City, record.State, record.Zip, record.CountryCode,
+		roleID, record.CreatedAt, record.UpdatedAt, verifiedAt}
+	for _, key := range record.attributeKeys {
+		values = append(values, attributeText(record.Attributes[key]))
+	}
+	return values
+}
+
+// attributeText returns an attribute value as a cell: strings without their quotes, other values as JSON, and
+// an empty cell when there is no value.
+func attributeText(value json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	return string(value)
+}
+
+// userExportWriter encodes exported users. Nothing is written until the first record or Close,
+// so a failure before the first row can still be reported as an error response.
+type userExportWriter interface {
+	Write(record exportUserRecord) error
+	Close() error
+}
+
+// newUserExportWriter returns the writer of a format. header is the first row of CSV and XLSX files.
+func newUserExportWriter(format string, w io.Writer, header []string) userExportWriter {
+	switch format {
+	case exportFormatNDJSON:
+		return &ndjsonExportWriter{encoder: json.NewEncoder(w)}
+	case exportFormatXLSX:
+		return newXLSXWriter(w, "Users", header)
+	default:
+		return &csvExportWriter{writer: csv.NewWriter(w), header: header}
+	}
+}
+
+// csvExportWriter writes a header row followed by one row per user.
+type csvExportWriter struct {
+	writer  *csv.Writer
+	header  []string
+	started bool
+}
+
+func (w *csvExportWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	return w.writer.Write(w.header)
+}
+
+func (w *csvExportWriter) Write(record exportUserRecord) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	values := record.values()
+	for i, value := range values {
+		values[i] = csvSafe(value)
+	}
+	return w.writer.Write(values)
+}
+
+func (w *csvExportWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// csvSafe stops spreadsheet programs from running a cell as a formula by prefixing it with a quote
+// when it starts with one of the characters that begin a formula.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ndjsonExportWriter writes one JSON object per line.
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonExportWriter) Write(record exportUserRecord) error {
+	return w.encoder.Encode(record)
+}
+
+func (w *ndjsonExportWriter) Close() error {
+	return nil
+}
+
+// ExportUsers handles GET /users/export to download every user matching the list filters, with their profile, role,
+// and custom attributes.
+// Rows are streamed from a database cursor as they are read, so the export never sits in memory.
+// Once the first rows have been sent the status can no longer change, so a failure part way through ends the
+// response early instead; an XLSX file is then left incomplete and will not open.
+// Admin only.
+// Returns 400 for bad params, 403 for non-admins, 500 for server errors, 200 with the file.
+func (server *Server) ExportUsers(ctx *gin.Context) {
+	var req exportUsersRequest
+
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if authPayload.RoleID != 3 {
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to export users"))
+		return
+	}
+
+	format := req.Format
+	if format == "" {
+		format = exportFormatCSV
+	}
+
+	definitions, err := server.store.ListAttributeDefinitions(ctx)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+	attributeKeys := make([]string, len(definitions))
+	for i, definition := range definitions {
+		attributeKeys[i] = definition.Key
+	}
+
+	ctx.Header("Content-Type", exportContentTypes[format])
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="users-%s.%s"`, time.Now().UTC().Format("20060102"), format))
+	ctx.Status(http.StatusOK)
+
+	writer := newUserExportWriter(format, ctx.Writer, exportHeader(attributeKeys))
+	err = server.store.ExportUsersTx(ctx, req.filter(), func(row db.UserListRow) error {
+		return writer.Write(newExportUserRecord(row, attributeKeys))
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		return
+	}
+
+	if !ctx.Writer.Written() {
+		ctx.Writer.Header().Del("Content-Disposition")
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	log.Printf("%s %s: export stopped part way: %v", ctx.Request.Method, ctx.Request.URL.Path, err)
+	ctx.Abort()
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+// exportTestStore streams a fixed set of rows and records the filter it was given.
+type exportTestStore struct {
+	db.Store
+	rows   []db.UserListRow
+	err    error
+	filter db.UserListFilter
+}
+
+func (s *exportTestStore) ExportUsersTx(_ context.Context, filter db.UserListFilter, fn func(db.UserListRow) error) error {
+	s.filter = filter
+	if s.err != nil {
+		return s.err
+	}
+	for _, row := range s.rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *exportTestStore) ListAttributeDefinitions(context.Context) ([]db.AttributeDefinition, error) {
+	return []db.AttributeDefinition{{ID: util.RandomUUID(), Key: "vessel", Type: db.AttributeTypeString}}, nil
+}
+
+func newExportTestStore() *exportTestStore {
+	return &exportTestStore{rows: []db.UserListRow{
+		{
+			User: db.User{ID: util.RandomUUID(), UserName: "alice", Email: "alice@example.com", Password: "hash-must-not-leak",
+				CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			FirstName:    sql.NullString{String: "Alice", Valid: true},
+			BusinessName: sql.NullString{String: "=HYPERLINK(\"x\") & <Co>", Valid: true},
+			RoleID:       sql.NullInt32{Int32: 3, Valid: true},
+			Attributes:   map[string]json.RawMessage{"vessel": json.RawMessage(`"Orca"`)},
+		},
+		{
+			// A user created without a profile or role
+			User: db.User{ID: util.RandomUUID(), UserName: "bob", Email: "bob@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		},
+	}}
+}
+
+func exportUsers(t *testing.T, server *Server, query string, role int) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/users/export"+query, nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomUUID(), role, time.Minute)
+
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestExportUsers(t *testing.T) {
+	testCases := []struct {
+		name          string
+		query         string
+		role          int
+		storeErr      error
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, store *exportTestStore)
+	}{
+		{
+			name: "CSV",
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *exportTestStore) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Header().Get("Content-Type"), "text/csv")
+				require.Contains(t, recorder.Header().Get("Content-Disposition"), ".csv")
+
+				records, err := csv.NewReader(recorder.Body).ReadAll()
+				require.NoError(t, err)
+				require.Len(t, records, 3)
+				require.Equal(t, append(exportColumns, "attributes.vessel"), records[0])
+				require.Equal(t, "alice", records[1][1])
+				require.Equal(t, `'=HYPERLINK("x") & <Co>`, records[1][5])
+				require.Equal(t, "3", records[1][11])
+				require.Equal(t, "", records[2][3])
+				require.Equal(t, "Orca", records[1][15])
+				require.Equal(t, "", records[2][15])
+				require.Equal(t, db.UserSortCreatedAt, store.filter.Sort)
+			},
+		}, {
+			name:  "NDJSONWithFilters",
+			query: "?format=ndjson&role_id=3&sort=-user_name&q=ali",
+			role:  3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *exportTestStore) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, int32(3), store.filter.RoleID.Int32)
+				require.Equal(t, db.UserSortUserName, store.filter.Sort)
+				require.True(t, store.filter.Desc)
+				require.Equal(t, "ali", store.filter.Search)
+
+				lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+				require.Len(t, lines, 2)
+				var record exportUserRecord
+				require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+				require.Equal(t, "bob", record.UserName)
+				require.Nil(t, record.RoleID)
+			},
+		}, {
+			name:  "XLSX",
+			query: "?format=xlsx",
+			role:  3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, _ *exportTestStore) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				body := recorder.Body.Bytes()
+				archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+				require.NoError(t, err)
+
+				var sheet string
+				for _, f := range archive.File {
+					if f.Name == "xl/worksheets/sheet1.xml" {
+						r, err := f.Open()
+						require.NoError(t, err)
+						data, err := io.ReadAll(r)
+						require.NoError(t, err)
+						sheet = string(data)
+					}
+				}
+				require.Contains(t, sheet, `<c r="B2" t="inlineStr"><is><t xml:space="preserve">alice</t></is></c>`)
+				require.Contains(t, sheet, "&lt;Co&gt;")
+				require.Contains(t, sheet, `<row r="3">`)
+			},
+		}, {
+			name:     "StoreError",
+			role:     3,
+			storeErr: errors.New("connection reset"),
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, _ *exportTestStore) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				require.Empty(t, recorder.Header().Get("Content-Disposition"))
+			},
+		}, {
+			name:  "BadFormat",
+			query: "?format=pdf",
+			role:  3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, _ *exportTestStore) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		}, {
+			name: "NotAdmin",
+			role: 1,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, _ *exportTestStore) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			store := newExportTestStore()
+			store.err = tc.storeErr
+			server := newTestServer(t, store)
+
+			recorder := exportUsers(t, server, tc.query, tc.role)
+			tc.checkResponse(t, recorder, store)
+			require.NotContains(t, recorder.Body.String(), "hash-must-not-leak")
+		})
+	}
+}
+
+func TestExportUsersUnauthorized(t *testing.T) {
+	// The export shares the GET /users/:id route with the public name check, so it checks the token itself.
+	server := newTestServer(t, newExportTestStore())
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest(http.MethodGet, "/users/export", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	require.Equal(t, "A", xlsxColumnName(0))
+	require.Equal(t, "Z", xlsxColumnName(25))
+	require.Equal(t, "AA", xlsxColumnName(26))
+	require.Equal(t, "BA", xlsxColumnName(52))
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/token"
+)
+
+type userHistoryEntry struct {
+	Version    int32   `json:"version"`
+	UserName   string  `json:"user_name"`
+	Email      string  `json:"email"`
+	UpdatedAt  string  `json:"updated_at"`
+	DeletedAt  *string `json:"deleted_at"`
+	RecordedAt string  `json:"recorded_at"`
+}
+
+type userProfileHistoryEntry struct {
+	Version         int32   `json:"version"`
+	FirstName       string  `json:"first_name"`
+	LastName        string  `json:"last_name"`
+	BusinessName    string  `json:"business_name"`
+	StreetAddress   string  `json:"street_address"`
+	City            string  `json:"city"`
+	State           string  `json:"state"`
+	Zip             string  `json:"zip"`
+	CountryCode     string  `json:"country_code"`
+	PhoneNumber     string  `json:"phone_number"`
+	PhoneVerifiedAt *string `json:"phone_verified_at"`
+	UpdatedAt       string  `json:"updated_at"`
+	DeletedAt       *string `json:"deleted_at"`
+	RecordedAt      string  `json:"recorded_at"`
+}
+
+type userRoleHistoryEntry struct {
+	Version    int32   `json:"version"`
+	RoleID     int32   `json:"role_id"`
+	UpdatedAt  string  `json:"updated_at"`
+	DeletedAt  *string `json:"deleted_at"`
+	RecordedAt string  `json:"recorded_at"`
+}
+
+// userHistoryResponse lists every version of a user, their profile, and role, oldest first.
+// Each version is valid from its recorded_at until the recorded_at of the next one; use it as ?as_of= on GET /usertx/:id.
+type userHistoryResponse struct {
+	ID          uuid.UUID                 `json:"id"`
+	User        []userHistoryEntry        `json:"user"`
+	UserProfile []userProfileHistoryEntry `json:"user_profile"`
+	UserRole    []userRoleHistoryEntry    `json:"user_role"`
+}
+
+// historyTime formats a nullable timestamp, returning nil when it is not set.
+func historyTime(t sql.NullTime) *string {
+	if !t.Valid {
+		return nil
+	}
+	formatted := t.Time.Format(time.RFC3339)
+	return &formatted
+}
+
+func newUserHistoryResponse(id uuid.UUID, history db.UserHistoryResult) userHistoryResponse {
+	rsp := userHistoryResponse{
+		ID:          id,
+		User:        make([]userHistoryEntry, 0, len(history.User)),
+		UserProfile: make([]userProfileHistoryEntry, 0, len(history.UserProfile)),
+		UserRole:    make([]userRoleHistoryEntry, 0, len(history.UserRole)),
+	}
+
+	for _, user := range history.User {
+		rsp.User = append(rsp.User, userHistoryEntry{
+			Version:    user.Version,
+			UserName:   user.UserName,
+			Email:      user.Email,
+			UpdatedAt:  user.UpdatedAt.Format(time.RFC3339),
+			DeletedAt:  historyTime(user.DeletedAt),
+			RecordedAt: user.RecordedAt.Format(time.RFC3339Nano),
+		})
+	}
+
+	for _, profile := range history.UserProfile {
+		rsp.UserProfile = append(rsp.UserProfile, userProfileHistoryEntry{
+			Version:         profile.Version,
+			FirstName:       profile.FirstName,
+			LastName:        profile.LastName,
+			BusinessName:    profile.BusinessName,
+			StreetAddress:   profile.StreetAddress,
+			City:            profile.City,
+			State:           profile.State,
+			Zip:             profile.Zip,
+			CountryCode:     profile.CountryCode,
+			PhoneNumber:     profile.PhoneNumber,
+			PhoneVerifiedAt: historyTime(profile.PhoneVerifiedAt),
+			UpdatedAt:       profile.UpdatedAt.Format(time.RFC3339),
+			DeletedAt:       historyTime(profile.DeletedAt),
+			RecordedAt:      profile.RecordedAt.Format(time.RFC3339Nano),
+		})
+	}
+
+	for _, role := range history.UserRole {
+		rsp.UserRole = append(rsp.UserRole, userRoleHistoryEntry{
+			Version:    role.Version,
+			RoleID:     role.RoleID,
+			UpdatedAt:  role.UpdatedAt.Format(time.RFC3339),
+			DeletedAt:  historyTime(role.DeletedAt),
+			RecordedAt: role.RecordedAt.Format(time.RFC3339Nano),
+		})
+	}
+
+	return rsp
+}
+
+// GetUserTxHistory handles GET /usertx/:id/history to list every recorded version of a user, profile, and role.
+// Authed for self only. Admin all.
+// Returns 400 for bad UUID, 403 if not allowed, 404 if the user has no history, 500 for server errors, 200 for success.
+func (server *Server) GetUserTxHistory(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		apierror.Respond(ctx, invalidUUIDError("id", err))
+		return
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if id != authPayload.UserID && authPayload.RoleID != 3 {
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to view this user's history"))
+		return
+	}
+
+	history, err := server.store.GetUserHistoryTx(ctx, id)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserHistoryResponse(id, history))
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+// historyTestStore answers the point-in-time and history lookups from fixed data.
+type historyTestStore struct {
+	db.Store
+	asOf    time.Time
+	result  db.UserTxResult
+	history db.UserHistoryResult
+}
+
+func (s *historyTestStore) GetUserWithProfileAndRoleTX(_ context.Context, _ uuid.UUID) (db.UserTxResult, error) {
+	return s.result, nil
+}
+
+func (s *historyTestStore) GetUserWithProfileAndRoleAsOfTx(_ context.Context, _ uuid.UUID, asOf time.Time) (db.UserTxResult, error) {
+	s.asOf = asOf
+	old := s.result
+	old.UserProfile.StreetAddress = "1 Old Street"
+	return old, nil
+}
+
+func (s *historyTestStore) GetUserHistoryTx(_ context.Context, _ uuid.UUID) (db.UserHistoryResult, error) {
+	return s.history, nil
+}
+
+func newHistoryTestStore(userID uuid.UUID) *historyTestStore {
+	now := time.Now()
+	return &historyTestStore{
+		result: db.UserTxResult{
+			User:        db.User{ID: userID, UserName: "user", Version: 2},
+			UserProfile: db.UserProfile{UserID: userID, StreetAddress: "2 New Street", Version: 2},
+			UserRole:    db.UserRole{UserID: userID, RoleID: 1, Version: 1},
+		},
+		history: db.UserHistoryResult{
+			User: []db.UsersHistory{{UserID: userID, Version: 1, RecordedAt: now}},
+			UserProfile: []db.UserProfileHistory{
+				{UserID: userID, Version: 1, StreetAddress: "1 Old Street", RecordedAt: now.Add(-time.Hour)},
+				{UserID: userID, Version: 2, StreetAddress: "2 New Street", RecordedAt: now},
+			},
+			UserRole: []db.UserRoleHistory{{UserID: userID, Version: 1, RoleID: 1, RecordedAt: now}},
+		},
+	}
+}
+
+func TestGetUserTxAsOf(t *testing.T) {
+	userID := util.RandomUUID()
+
+	testCases := []struct {
+		name          string
+		query         string
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, store *historyTestStore)
+	}{
+		{
+			name:  "Current",
+			query: "",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *historyTestStore) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, `"2.2.1"`, recorder.Header().Get(etagHeaderKey))
+				require.Contains(t, recorder.Body.String(), "2 New Street")
+			},
+		}, {
+			name:  "AsOf",
+			query: "?as_of=2024-03-01T12:00:00Z",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *historyTestStore) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Empty(t, recorder.Header().Get(etagHeaderKey))
+				require.Contains(t, recorder.Body.String(), "1 Old Street")
+				require.True(t, store.asOf.Equal(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)))
+			},
+		}, {
+			name:  "InvalidAsOf",
+			query: "?as_of=last-tuesday",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *historyTestStore) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"field":"as_of"`)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			store := newHistoryTestStore(userID)
+			server := newTestServer(t, store)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/usertx/"+userID.String()+tc.query, nil)
+			require.NoError(t, err)
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, userID, 1, time.Minute)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, store)
+		})
+	}
+}
+
+func TestGetUserTxHistory(t *testing.T) {
+	userID := util.RandomUUID()
+
+	testCases := []struct {
+		name          string
+		authUserID    uuid.UUID
+		authRoleID    int
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:       "Self",
+			authUserID: userID,
+			authRoleID: 1,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp userHistoryResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.Equal(t, userID, rsp.ID)
+				require.Len(t, rsp.User, 1)
+				require.Len(t, rsp.UserProfile, 2)
+				require.Equal(t, "1 Old Street", rsp.UserProfile[0].StreetAddress)
+				require.Equal(t, "2 New Street", rsp.UserProfile[1].StreetAddress)
+				require.Nil(t, rsp.UserProfile[1].DeletedAt)
+				require.NotContains(t, recorder.Body.String(), "password")
+			},
+		}, {
+			name:       "Admin",
+			authUserID: util.RandomUUID(),
+			authRoleID: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		}, {
+			name:       "OtherUser",
+			authUserID: util.RandomUUID(),
+			authRoleID: 1,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, newHistoryTestStore(userID))
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/usertx/"+userID.String()+"/history", nil)
+			require.NoError(t, err)
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, tc.authUserID, tc.authRoleID, time.Minute)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+)
+
+const (
+	idempotencyKeyHeaderKey      = "Idempotency-Key"
+	idempotencyReplayedHeaderKey = "Idempotent-Replayed"
+	maxIdempotencyKeyLength      = 255
+)
+
+// replayedHeaderKeys are the response headers stored with an idempotency key and repeated on replay, so a retried
+// create gets the same ETag and Location as the first attempt.
+var replayedHeaderKeys = []string{etagHeaderKey, "Location"}
+
+// idempotencyResponseWriter keeps a copy of everything the handler writes so it can be replayed later.
+type idempotencyResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyResponseWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyResponseWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyMiddleware makes POST handlers safe to retry when the client sends an Idempotency-Key header.
+// The first request with a key runs normally and its response is stored; repeats with the same body replay
+// that response, repeats with a different body are rejected with 422, and repeats that arrive while the
+// first request is still running get 409. Server errors are not stored so the client can retry them.
+// Parameters:
+// - store: The store holding the idempotency_keys table.
+// - ttl: How long a key is honoured. Zero or less keeps keys forever.
+func idempotencyMiddleware(store db.Store, ttl time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(idempotencyKeyHeaderKey)
+		if key == "" || store == nil {
+			ctx.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			apierror.Respond(ctx, apierror.BadRequest("Idempotency-Key header is too long"))
+			return
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			apierror.Respond(ctx, apierror.FromBinding(err))
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		path := ctx.Request.URL.Path
+		requestHash := hashRequest(ctx.Request.Method, path, body)
+
+		_, err = store.CreateIdempotencyKey(ctx, db.CreateIdempotencyKeyParams{
+			Key:         key,
+			RequestPath: path,
+			RequestHash: requestHash,
+		})
+		if err == sql.ErrNoRows {
+			var existing db.IdempotencyKey
+			existing, err = store.GetIdempotencyKey(ctx, db.GetIdempotencyKeyParams{
+				Key:         key,
+				RequestPath: path,
+			})
+			if err != nil {
+				apierror.Respond(ctx, err)
+				return
+			}
+
+			if ttl <= 0 || time.Since(existing.CreatedAt) < ttl {
+				replayIdempotentResponse(ctx, existing, requestHash)
+				return
+			}
+
+			// The old key has expired, so this request starts afresh under the same key.
+			err = store.DeleteIdempotencyKey(ctx, db.DeleteIdempotencyKeyParams{
+				Key:         key,
+				RequestPath: path,
+			})
+			if err != nil {
+				apierror.Respond(ctx, err)
+				return
+			}
+
+			_, err = store.CreateIdempotencyKey(ctx, db.CreateIdempotencyKeyParams{
+				Key:         key,
+				RequestPath: path,
+				RequestHash: requestHash,
+			})
+		}
+		if err != nil {
+			apierror.Respond(ctx, err)
+			return
+		}
+
+		writer := &idempotencyResponseWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+
+		ctx.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			_ = store.DeleteIdempotencyKey(ctx, db.DeleteIdempotencyKeyParams{
+				Key:         key,
+				RequestPath: path,
+			})
+			return
+		}
+
+		_, _ = store.CompleteIdempotencyKey(ctx, db.CompleteIdempotencyKeyParams{
+			Key:             key,
+			RequestPath:     path,
+			ResponseStatus:  sql.NullInt32{Int32: int32(status), Valid: true},
+			ResponseBody:    writer.body.Bytes(),
+			ResponseHeaders: replayedHeaders(writer.Header()),
+		})
+	}
+}
+
+// replayIdempotentResponse answers a repeated request from the stored record without running the handler.
+func replayIdempotentResponse(ctx *gin.Context, existing db.IdempotencyKey, requestHash string) {
+	if existing.RequestHash != requestHash {
+		apierror.Respond(ctx, apierror.Unprocessable(apierror.CodeIdempotencyKeyReused, "Idempotency-Key has already been used with a different request"))
+		return
+	}
+
+	if !existing.CompletedAt.Valid {
+		apierror.Respond(ctx, apierror.Conflict(apierror.CodeRequestInProgress, "a request with this Idempotency-Key is still being processed"))
+		return
+	}
+
+	// Anything that was not a success was written by apierror, so it is replayed as a problem document.
+	contentType := "application/json; charset=utf-8"
+	if existing.ResponseStatus.Int32 >= http.StatusBadRequest {
+		contentType = apierror.ContentType
+	}
+
+	// Records stored before response_headers existed have none to restore.
+	var headers map[string]string
+	_ = json.Unmarshal(existing.ResponseHeaders, &headers)
+	for key, value := range headers {
+		ctx.Header(key, value)
+	}
+
+	ctx.Header(idempotencyReplayedHeaderKey, "true")
+	ctx.Data(int(existing.ResponseStatus.Int32), contentType, existing.ResponseBody)
+	ctx.Abort()
+}
+
+// replayedHeaders picks the replayedHeaderKeys out of a response, as a JSON object for the response_headers column.
+func replayedHeaders(header http.Header) json.RawMessage {
+	headers := map[string]string{}
+	for _, key := range replayedHeaderKeys {
+		if value := header.Get(key); value != "" {
+			headers[key] = value
+		}
+	}
+	data, _ := json.Marshal(headers)
+	return data
+}
+
+// hashRequest fingerprints a request so a reused key can be matched against the original payload.
+func hashRequest(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+)
+
+// idempotencyTestStore keeps idempotency keys in memory. Any other store method panics through the nil embedded Store.
+type idempotencyTestStore struct {
+	db.Store
+	keys map[string]db.IdempotencyKey
+}
+
+func newIdempotencyTestStore() *idempotencyTestStore {
+	return &idempotencyTestStore{keys: map[string]db.IdempotencyKey{}}
+}
+
+func (s *idempotencyTestStore) CreateIdempotencyKey(_ context.Context, arg db.CreateIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	id := arg.Key + arg.RequestPath
+	if _, ok := s.keys[id]; ok {
+		return db.IdempotencyKey{}, sql.ErrNoRows
+	}
+	record := db.IdempotencyKey{
+		Key:         arg.Key,
+		RequestPath: arg.RequestPath,
+		RequestHash: arg.RequestHash,
+		CreatedAt:   time.Now(),
+	}
+	s.keys[id] = record
+	return record, nil
+}
+
+func (s *idempotencyTestStore) GetIdempotencyKey(_ context.Context, arg db.GetIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	record, ok := s.keys[arg.Key+arg.RequestPath]
+	if !ok {
+		return db.IdempotencyKey{}, sql.ErrNoRows
+	}
+	return record, nil
+}
+
+func (s *idempotencyTestStore) CompleteIdempotencyKey(_ context.Context, arg db.CompleteIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	record, ok := s.keys[arg.Key+arg.RequestPath]
+	if !ok {
+		return db.IdempotencyKey{}, sql.ErrNoRows
+	}
+	record.ResponseStatus = arg.ResponseStatus
+	record.ResponseBody = arg.ResponseBody
+	record.ResponseHeaders = arg.ResponseHeaders
+	record.CompletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	s.keys[arg.Key+arg.RequestPath] = record
+	return record, nil
+}
+
+func (s *idempotencyTestStore) DeleteIdempotencyKey(_ context.Context, arg db.DeleteIdempotencyKeyParams) error {
+	delete(s.keys, arg.Key+arg.RequestPath)
+	return nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	store := newIdempotencyTestStore()
+	server := newTestServer(t, nil)
+
+	calls := 0
+	path := "/idempotent"
+	server.router.POST(
+		path,
+		idempotencyMiddleware(store, time.Hour),
+		func(ctx *gin.Context) {
+			calls++
+			ctx.JSON(http.StatusOK, gin.H{"call": calls})
+		},
+	)
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		require.NoError(t, err)
+		if key != "" {
+			request.Header.Set(idempotencyKeyHeaderKey, key)
+		}
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	first := send("key-1", `{"email":"a@b.com"}`)
+	require.Equal(t, http.StatusOK, first.Code)
+	require.Equal(t, 1, calls)
+
+	// Same key and body replays the stored response without calling the handler again
+	replay := send("key-1", `{"email":"a@b.com"}`)
+	require.Equal(t, http.StatusOK, replay.Code)
+	require.Equal(t, first.Body.String(), replay.Body.String())
+	require.Equal(t, "true", replay.Header().Get(idempotencyReplayedHeaderKey))
+	require.Equal(t, 1, calls)
+
+	// Same key with a different body is rejected
+	mismatch := send("key-1", `{"email":"c@d.com"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+	require.Equal(t, 1, calls)
+
+	// A fresh key runs the handler
+	second := send("key-2", `{"email":"a@b.com"}`)
+	require.Equal(t, http.StatusOK, second.Code)
+	require.Equal(t, 2, calls)
+
+	// No key means no idempotency handling at all
+	send("", `{"email":"a@b.com"}`)
+	send("", `{"email":"a@b.com"}`)
+	require.Equal(t, 4, calls)
+}
+
+func TestIdempotencyMiddlewareReplaysHeaders(t *testing.T) {
+	store := newIdempotencyTestStore()
+	server := newTestServer(t, nil)
+
+	calls := 0
+	path := "/idempotent"
+	server.router.POST(path, idempotencyMiddleware(store, time.Hour), func(ctx *gin.Context) {
+		calls++
+		ctx.Header(etagHeaderKey, `"1"`)
+		ctx.Header("Location", "/things/1")
+		ctx.Header("X-Not-Stored", "yes")
+		ctx.JSON(http.StatusCreated, gin.H{"id": 1})
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		require.NoError(t, err)
+		request.Header.Set(idempotencyKeyHeaderKey, "key-1")
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	first := send()
+	require.Equal(t, http.StatusCreated, first.Code)
+
+	replay := send()
+	require.Equal(t, 1, calls)
+	require.Equal(t, http.StatusCreated, replay.Code)
+	require.Equal(t, "true", replay.Header().Get(idempotencyReplayedHeaderKey))
+	require.Equal(t, `"1"`, replay.Header().Get(etagHeaderKey))
+	require.Equal(t, "/things/1", replay.Header().Get("Location"))
+	require.Empty(t, replay.Header().Get("X-Not-Stored"))
+}
+
+func TestIdempotencyMiddlewareInProgress(t *testing.T) {
+	store := newIdempotencyTestStore()
+	server := newTestServer(t, nil)
+
+	path := "/idempotent"
+	server.router.POST(path, idempotencyMiddleware(store, time.Hour), func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{})
+	})
+
+	body := `{}`
+	_, err := store.CreateIdempotencyKey(context.Background(), db.CreateIdempotencyKeyParams{
+		Key:         "busy",
+		RequestPath: path,
+		RequestHash: hashRequest(http.MethodPost, path, []byte(body)),
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	require.NoError(t, err)
+	request.Header.Set(idempotencyKeyHeaderKey, "busy")
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+}
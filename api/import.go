@@ -0,0 +1,609 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/token"
+	"whaleWake/util"
+)
+
+const (
+	importFormatCSV    = "csv"
+	importFormatNDJSON = "ndjson"
+
+	importRowCreated = "created"
+	importRowValid   = "valid"
+	importRowFailed  = "failed"
+
+	maxImportBodySize = 10 << 20 // 10 MiB
+	maxImportRows     = 10000
+	// importProgressEvery is how many rows a background job processes between progress updates.
+	importProgressEvery = 25
+)
+
+// importUsersRequest defines the query parameters for POST /users/import.
+// Fields:
+// - Format: csv or ndjson. Defaults to the request Content-Type (text/csv or application/x-ndjson).
+// - DryRun: validate every row, including uniqueness against existing users, without creating anything.
+type importUsersRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=csv ndjson"`
+	DryRun bool   `form:"dry_run"`
+}
+
+// importRow is one parsed row of an import file; Err is set when the row could not be parsed.
+// CSVAttributes holds the non-empty attributes.<key> cells of a CSV row, by key. CSV cells are text, so they are
+// only turned into attribute values once the attributes' types are known.
+type importRow struct {
+	Req           createUserTxRequest
+	CSVAttributes map[string]string
+	Err           error
+}
+
+// importRowResult reports what happened to one row.
+// Fields:
+// - Row: The 1-based position of the row among the data rows, not counting a CSV header or blank NDJSON lines.
+// - Status: created, valid (dry run only), or failed.
+// - ID: The new user's ID when the row was created.
+// - Error: Why the row failed, in the same form as an API error response.
+type importRowResult struct {
+	Row    int               `json:"row"`
+	Status string            `json:"status"`
+	ID     *uuid.UUID        `json:"id,omitempty"`
+	Error  *apierror.Problem `json:"error,omitempty"`
+}
+
+// importSummary counts the rows processed so far.
+type importSummary struct {
+	Processed int32 `json:"processed"`
+	Succeeded int32 `json:"succeeded"`
+	Failed    int32 `json:"failed"`
+}
+
+func (summary *importSummary) add(result importRowResult) {
+	summary.Processed++
+	if result.Status == importRowFailed {
+		summary.Failed++
+	} else {
+		summary.Succeeded++
+	}
+}
+
+// importUsersResponse is the report of an import run while the request waited.
+type importUsersResponse struct {
+	DryRun bool `json:"dry_run"`
+	Total  int  `json:"total"`
+	importSummary
+	Rows []importRowResult `json:"rows"`
+}
+
+// importJobResponse describes a background import. Rows is only filled in once the job has finished.
+type importJobResponse struct {
+	ID         uuid.UUID         `json:"id"`
+	Status     string            `json:"status"`
+	Format     string            `json:"format"`
+	DryRun     bool              `json:"dry_run"`
+	Total      int32             `json:"total"`
+	Processed  int32             `json:"processed"`
+	Succeeded  int32             `json:"succeeded"`
+	Failed     int32             `json:"failed"`
+	Error      string            `json:"error,omitempty"`
+	Rows       []importRowResult `json:"rows,omitempty"`
+	CreatedAt  string            `json:"created_at"`
+	UpdatedAt  string            `json:"updated_at"`
+	FinishedAt *string           `json:"finished_at"`
+}
+
+func newImportJobResponse(job db.ImportJob) importJobResponse {
+	rsp := importJobResponse{
+		ID:         job.ID,
+		Status:     job.Status,
+		Format:     job.Format,
+		DryRun:     job.DryRun,
+		Total:      job.TotalRows,
+		Processed:  job.ProcessedRows,
+		Succeeded:  job.SucceededRows,
+		Failed:     job.FailedRows,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:  job.UpdatedAt.Format(time.RFC3339),
+		FinishedAt: historyTime(job.FinishedAt),
+	}
+	if len(job.Results) > 0 {
+		if err := json.Unmarshal(job.Results, &rsp.Rows); err != nil {
+			log.Printf("Unable to read results of import job %s: %v", job.ID, err)
+		}
+	}
+	return rsp
+}
+
+// ImportUsers handles POST /users/import to create users in bulk from CSV or NDJSON rows in the POST /usertx shape.
+// Each row is created in its own transaction, so one bad row does not stop the others. Files with more rows than
+// the IMPORT_ASYNC_ROWS setting are processed in the background: the response is then 202 with a job to poll at
+// the Location header. Admin only.
+// Returns 400 for an unreadable file, 403 if not an admin, 413 if the file is too large,
+// 415 for an unknown format, 200 with a per-row report, or 202 with a job.
+func (server *Server) ImportUsers(ctx *gin.Context) {
+	var req importUsersRequest
+
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if authPayload.RoleID != 3 {
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to import users"))
+		return
+	}
+
+	format := req.Format
+	if format == "" {
+		format = importFormatFromContentType(ctx.ContentType())
+	}
+	if format == "" {
+		apierror.Respond(ctx, apierror.New(http.StatusUnsupportedMediaType, apierror.CodeInvalidRequest,
+			"send text/csv or application/x-ndjson, or set ?format="))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Respond(ctx, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeInvalidRequest,
+				fmt.Sprintf("import files are limited to %d bytes", maxImportBodySize)))
+			return
+		}
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	rows, err := parseImportRows(format, bytes.NewReader(body))
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	if len(rows) == 0 {
+		apierror.Respond(ctx, apierror.BadRequest("the import file has no rows"))
+		return
+	}
+	if len(rows) > maxImportRows {
+		apierror.Respond(ctx, apierror.BadRequest(fmt.Sprintf("import files are limited to %d rows", maxImportRows)))
+		return
+	}
+
+	if server.config.ImportAsyncRows > 0 && len(rows) > server.config.ImportAsyncRows {
+		job, err := server.store.CreateImportJob(ctx, db.CreateImportJobParams{
+			CreatedBy: authPayload.UserID,
+			Format:    format,
+			DryRun:    req.DryRun,
+			TotalRows: int32(len(rows)),
+		})
+		if err != nil {
+			apierror.Respond(ctx, err)
+			return
+		}
+
+		// The gin context is recycled once this handler returns, so the job runs under the server's, which
+		// Shutdown cancels.
+		jobCtx := db.WithActor(server.jobsCtx, auditActor(ctx))
+		server.jobs.Add(1)
+		go func() {
+			defer server.jobs.Done()
+			server.runImportJob(jobCtx, job, rows)
+		}()
+
+		ctx.Header("Location", "/imports/"+job.ID.String())
+		ctx.JSON(http.StatusAccepted, newImportJobResponse(job))
+		return
+	}
+
+	rsp := importUsersResponse{DryRun: req.DryRun, Total: len(rows)}
+	rsp.Rows = server.importUsers(auditContext(ctx), rows, req.DryRun, rsp.add)
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// GetImportJob handles GET /imports/:id to poll the progress of a background import.
+// Admin only.
+// Returns 400 for bad UUID, 403 if not an admin, 404 if there is no such job, 200 with the job.
+func (server *Server) GetImportJob(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		apierror.Respond(ctx, invalidUUIDError("id", err))
+		return
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if authPayload.RoleID != 3 {
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to view imports"))
+		return
+	}
+
+	job, err := server.store.GetImportJob(ctx, id)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newImportJobResponse(job))
+}
+
+// runImportJob processes a background import, saving progress as it goes and the report when it is done.
+// When ctx is cancelled the job stops after the current row and is saved as failed, with the rows done so far.
+func (server *Server) runImportJob(ctx context.Context, job db.ImportJob, rows []importRow) {
+	var summary importSummary
+
+	status, jobErr := db.ImportJobStatusFailed, "the import stopped unexpectedly"
+	var results []importRowResult
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("Import job %s panicked: %v", job.ID, recovered)
+		}
+
+		body, err := json.Marshal(results)
+		if err != nil || results == nil {
+			body = []byte("[]")
+		}
+		// The outcome is saved even when the job was stopped by cancelling ctx.
+		_, err = server.store.FinishImportJob(context.WithoutCancel(ctx), db.FinishImportJobParams{
+			ID:            job.ID,
+			Status:        status,
+			ProcessedRows: summary.Processed,
+			SucceededRows: summary.Succeeded,
+			FailedRows:    summary.Failed,
+			Results:       body,
+			Error:         jobErr,
+		})
+		if err != nil {
+			log.Printf("Unable to finish import job %s: %v", job.ID, err)
+		}
+	}()
+
+	results = server.importUsers(ctx, rows, job.DryRun, func(result importRowResult) {
+		summary.add(result)
+		if summary.Processed%importProgressEvery != 0 {
+			return
+		}
+		_, err := server.store.UpdateImportJobProgress(ctx, db.UpdateImportJobProgressParams{
+			ID:            job.ID,
+			ProcessedRows: summary.Processed,
+			SucceededRows: summary.Succeeded,
+			FailedRows:    summary.Failed,
+		})
+		if err != nil {
+			log.Printf("Unable to update progress of import job %s: %v", job.ID, err)
+		}
+	})
+
+	if ctx.Err() != nil {
+		jobErr = "the import stopped because the server shut down"
+		return
+	}
+	status, jobErr = db.ImportJobStatusCompleted, ""
+}
+
+// importUsers validates each row and, unless dryRun is set, creates it. It stops early once ctx is cancelled.
+// Rows must be valid POST /usertx bodies, and user names and emails must be unique across the file and the
+// existing users. A dry run checks the existing users without locking anything, so a row reported as valid
+// can still conflict with a user created before the real import runs.
+// Parameters:
+// - ctx: The context for store calls, carrying the audit actor.
+// - rows: The parsed rows.
+// - dryRun: Validate only.
+// - progress: Called after every row.
+// Returns:
+// - One result per row processed, in order.
+func (server *Server) importUsers(ctx context.Context, rows []importRow, dryRun bool, progress func(importRowResult)) []importRowResult {
+	results := make([]importRowResult, 0, len(rows))
+	userNames := map[string]int{}
+	emails := map[string]int{}
+
+	// Every row needs the definitions, to check its attributes; without them every row fails.
+	definitions, definitionsErr := server.store.ListAttributeDefinitions(ctx)
+
+	for i, row := range rows {
+		if ctx.Err() != nil {
+			break
+		}
+		result := importRowResult{Row: i + 1, Status: importRowFailed}
+
+		id, err := uuid.Nil, definitionsErr
+		if err == nil {
+			id, err = server.importUser(ctx, row, result.Row, dryRun, definitions, userNames, emails)
+		}
+		switch {
+		case err != nil:
+			apiErr := apierror.From(err)
+			if apiErr.Status >= http.StatusInternalServerError {
+				log.Printf("Import row %d: %v", result.Row, apiErr)
+			}
+			problem := apiErr.Problem("")
+			result.Error = &problem
+		case dryRun:
+			result.Status = importRowValid
+		default:
+			result.Status = importRowCreated
+			result.ID = &id
+		}
+
+		results = append(results, result)
+		progress(result)
+	}
+
+	return results
+}
+
+// importUser validates and creates a single row, with its attributes checked against definitions the way
+// POST /usertx checks them. userNames and emails remember the rows seen so far.
+func (server *Server) importUser(ctx context.Context, row importRow, rowNumber int, dryRun bool, definitions []db.AttributeDefinition, userNames, emails map[string]int) (uuid.UUID, error) {
+	if row.Err != nil {
+		return uuid.Nil, row.Err
+	}
+
+	req := row.Req
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return uuid.Nil, err
+	}
+	if err := normalizeAddress(&req.StreetAddress, &req.City, &req.State, &req.Zip, &req.CountryCode); err != nil {
+		return uuid.Nil, err
+	}
+	if row.CSVAttributes != nil {
+		req.Attributes = csvAttributeValues(definitions, row.CSVAttributes)
+	}
+	attributes, err := checkUserAttributeValues(definitions, req.Attributes, true)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if other, ok := userNames[strings.ToLower(req.UserName)]; ok {
+		return uuid.Nil, duplicateImportFieldError("user_name", other)
+	}
+	if other, ok := emails[strings.ToLower(req.Email)]; ok {
+		return uuid.Nil, duplicateImportFieldError("email", other)
+	}
+	userNames[strings.ToLower(req.UserName)] = rowNumber
+	emails[strings.ToLower(req.Email)] = rowNumber
+
+	if dryRun {
+		taken, err := server.store.GetUserNameAndEmailTaken(ctx, db.GetUserNameAndEmailTakenParams{
+			UserName: req.UserName,
+			Email:    req.Email,
+		})
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if taken.UserNameTaken {
+			return uuid.Nil, takenImportFieldError("user_name")
+		}
+		if taken.EmailTaken {
+			return uuid.Nil, takenImportFieldError("email")
+		}
+		return uuid.Nil, nil
+	}
+
+	hashedPassword, err := util.HashPassword(req.Password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	result, err := server.store.CreateUserWithProfileAndRoleTx(ctx,
+		db.CreateUserParams{
+			UserName: req.UserName,
+			Email:    req.Email,
+			Password: hashedPassword,
+		},
+		db.CreateUserProfileParams{
+			FirstName:     req.FirstName,
+			LastName:      req.LastName,
+			BusinessName:  req.BusinessName,
+			StreetAddress: req.StreetAddress,
+			City:          req.City,
+			State:         req.State,
+			Zip:           req.Zip,
+			CountryCode:   req.CountryCode,
+		},
+		db.CreateUserRoleParams{
+			RoleID: 1,
+		},
+		attributes...)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return result.User.ID, nil
+}
+
+// takenImportFieldError reports a value that an existing user already has, the same way a unique violation is reported.
+func takenImportFieldError(field string) *apierror.Error {
+	return apierror.Conflict(apierror.CodeAlreadyExists, fmt.Sprintf("%s already exists", field)).
+		WithFields(apierror.FieldError{Field: field, Code: "unique", Message: "is already taken"})
+}
+
+// duplicateImportFieldError reports a value that an earlier row of the same file already uses.
+func duplicateImportFieldError(field string, row int) *apierror.Error {
+	return apierror.Conflict(apierror.CodeAlreadyExists, fmt.Sprintf("%s already exists", field)).
+		WithFields(apierror.FieldError{Field: field, Code: "unique", Message: fmt.Sprintf("is already used by row %d", row)})
+}
+
+// importFormatFromContentType maps a request media type to an import format, or "" if it is not one.
+func importFormatFromContentType(contentType string) string {
+	switch contentType {
+	case "text/csv", "application/csv":
+		return importFormatCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return importFormatNDJSON
+	}
+	return ""
+}
+
+// parseImportRows reads every row of an import file.
+// A row that cannot be read on its own (bad JSON, wrong number of CSV fields) becomes a row with Err set;
+// only problems with the file as a whole, such as an unknown CSV column, are returned as an error.
+func parseImportRows(format string, r io.Reader) ([]importRow, error) {
+	if format == importFormatCSV {
+		return parseImportCSV(r)
+	}
+	return parseImportNDJSON(r)
+}
+
+// parseImportCSV reads a CSV file whose header names the createUserTxRequest JSON fields, in any order, and
+// attributes.<key> for each custom attribute. An empty cell leaves the field or attribute unset.
+func parseImportCSV(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, invalidImportFileError(err)
+	}
+
+	known := map[string]bool{}
+	for _, name := range importCSVColumns {
+		known[name] = true
+	}
+	seen := map[string]bool{}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if !known[name] && (!strings.HasPrefix(name, importCSVAttributePrefix) || name == importCSVAttributePrefix) {
+			return nil, apierror.BadRequest(fmt.Sprintf("unknown CSV column %q", name))
+		}
+		if seen[name] {
+			return nil, apierror.BadRequest(fmt.Sprintf("duplicate CSV column %q", name))
+		}
+		seen[name] = true
+		header[i] = name
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, invalidImportFileError(err)
+		}
+		if err != nil {
+			rows = append(rows, importRow{Err: apierror.BadRequest(fmt.Sprintf("row has %d fields, the header has %d", len(record), len(header)))})
+			continue
+		}
+
+		// Going through JSON reuses the request's field names and keeps CSV and NDJSON rows identical.
+		var row importRow
+		fields := make(map[string]string, len(header))
+		for i, name := range header {
+			if key := strings.TrimPrefix(name, importCSVAttributePrefix); key != name {
+				if record[i] != "" {
+					if row.CSVAttributes == nil {
+						row.CSVAttributes = map[string]string{}
+					}
+					row.CSVAttributes[key] = record[i]
+				}
+				continue
+			}
+			fields[name] = record[i]
+		}
+		data, _ := json.Marshal(fields)
+
+		row.Err = json.Unmarshal(data, &row.Req)
+		rows = append(rows, row)
+	}
+}
+
+// parseImportNDJSON reads one createUserTxRequest JSON object per line. Blank lines are skipped.
+func parseImportNDJSON(r io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportBodySize)
+
+	var rows []importRow
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var row importRow
+		row.Err = json.Unmarshal(line, &row.Req)
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, invalidImportFileError(err)
+	}
+
+	return rows, nil
+}
+
+// importCSVColumns are the JSON names of the createUserTxRequest fields, which CSV headers may use.
+var importCSVColumns = []string{"user_name", "email", "password", "first_name", "last_name", "business_name",
+	"street_address", "city", "state", "zip", "country_code"}
+
+// importCSVAttributePrefix starts the CSV columns of custom attributes, followed by the attribute key.
+const importCSVAttributePrefix = "attributes."
+
+// csvAttributeValues turns the attribute cells of a CSV row into JSON values of the attributes' types.
+// A cell that isn't a value of its type, or whose attribute isn't defined, is kept as a string, so it fails
+// validation the same way a wrong NDJSON value does.
+func csvAttributeValues(definitions []db.AttributeDefinition, cells map[string]string) map[string]json.RawMessage {
+	types := make(map[string]string, len(definitions))
+	for _, definition := range definitions {
+		types[definition.Key] = definition.Type
+	}
+
+	values := make(map[string]json.RawMessage, len(cells))
+	for key, cell := range cells {
+		switch types[key] {
+		case db.AttributeTypeInteger:
+			if n, err := strconv.ParseInt(cell, 10, 64); err == nil {
+				values[key] = json.RawMessage(strconv.FormatInt(n, 10))
+				continue
+			}
+		case db.AttributeTypeBoolean:
+			if b, err := strconv.ParseBool(cell); err == nil {
+				values[key] = json.RawMessage(strconv.FormatBool(b))
+				continue
+			}
+		}
+		values[key], _ = json.Marshal(cell)
+	}
+	return values
+}
+
+// invalidImportFileError reports an import file that cannot be read at all.
+func invalidImportFileError(err error) *apierror.Error {
+	apiErr := apierror.BadRequest("the import file cannot be read: " + err.Error())
+	apiErr.Err = err
+	return apiErr
+}
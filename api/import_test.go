@@ -0,0 +1,402 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+// importTestStore creates users in memory, rejecting user names that are already taken the way
+// the unique index does, and keeps import jobs in memory. The attribute values of created users are kept
+// by user name.
+type importTestStore struct {
+	db.Store
+	mu          sync.Mutex
+	userNames   map[string]bool
+	created     int
+	jobs        map[uuid.UUID]db.ImportJob
+	definitions []db.AttributeDefinition
+	attributes  map[string][]db.UserAttributeValue
+}
+
+func newImportTestStore(existing ...string) *importTestStore {
+	store := &importTestStore{userNames: map[string]bool{}, jobs: map[uuid.UUID]db.ImportJob{},
+		attributes: map[string][]db.UserAttributeValue{}}
+	for _, userName := range existing {
+		store.userNames[strings.ToLower(userName)] = true
+	}
+	return store
+}
+
+func (s *importTestStore) GetUserNameAndEmailTaken(_ context.Context, arg db.GetUserNameAndEmailTakenParams) (db.GetUserNameAndEmailTakenRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return db.GetUserNameAndEmailTakenRow{UserNameTaken: s.userNames[strings.ToLower(arg.UserName)]}, nil
+}
+
+func (s *importTestStore) ListAttributeDefinitions(context.Context) ([]db.AttributeDefinition, error) {
+	return s.definitions, nil
+}
+
+func (s *importTestStore) CreateUserWithProfileAndRoleTx(_ context.Context, userParams db.CreateUserParams, profileParams db.CreateUserProfileParams, roleParams db.CreateUserRoleParams, attributes ...db.UserAttributeValue) (db.UserTxResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.userNames[strings.ToLower(userParams.UserName)] {
+		return db.UserTxResult{}, &pq.Error{Code: db.UniqueViolation, Constraint: "users_user_name_lower_key"}
+	}
+	s.userNames[strings.ToLower(userParams.UserName)] = true
+	s.attributes[userParams.UserName] = attributes
+	s.created++
+	return db.UserTxResult{User: db.User{ID: util.RandomUUID(), UserName: userParams.UserName}}, nil
+}
+
+func (s *importTestStore) CreateImportJob(_ context.Context, arg db.CreateImportJobParams) (db.ImportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := db.ImportJob{ID: util.RandomUUID(), CreatedBy: arg.CreatedBy, Format: arg.Format, DryRun: arg.DryRun,
+		Status: db.ImportJobStatusRunning, TotalRows: arg.TotalRows, Results: []byte("[]"), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	s.jobs[job.ID] = job
+	return job, nil
+}
+
+func (s *importTestStore) UpdateImportJobProgress(_ context.Context, arg db.UpdateImportJobProgressParams) (db.ImportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[arg.ID]
+	job.ProcessedRows, job.SucceededRows, job.FailedRows = arg.ProcessedRows, arg.SucceededRows, arg.FailedRows
+	s.jobs[arg.ID] = job
+	return job, nil
+}
+
+func (s *importTestStore) FinishImportJob(_ context.Context, arg db.FinishImportJobParams) (db.ImportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[arg.ID]
+	job.Status, job.Error, job.Results = arg.Status, arg.Error, arg.Results
+	job.ProcessedRows, job.SucceededRows, job.FailedRows = arg.ProcessedRows, arg.SucceededRows, arg.FailedRows
+	s.jobs[arg.ID] = job
+	return job, nil
+}
+
+func (s *importTestStore) GetImportJob(_ context.Context, id uuid.UUID) (db.ImportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id], nil
+}
+
+// importNDJSONRow returns a valid NDJSON import row for the given user name.
+func importNDJSONRow(userName string) string {
+	data, _ := json.Marshal(createUserTxRequest{
+		UserName:      userName,
+		Email:         userName + "@example.com",
+		Password:      "secret123",
+		FirstName:     "First",
+		LastName:      "Last",
+		BusinessName:  "Acme",
+		StreetAddress: "1 Main Street",
+		City:          "Springfield",
+		State:         "IL",
+		Zip:           "62701",
+		CountryCode:   "US",
+	})
+	return string(data) + "\n"
+}
+
+const importCSVHeader = "user_name,email,password,first_name,last_name,business_name,street_address,city,state,zip,country_code\n"
+
+func importUsers(t *testing.T, server *Server, query, contentType, body string, role int) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/users/import"+query, bytes.NewBufferString(body))
+	require.NoError(t, err)
+	request.Header.Set("Content-Type", contentType)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomUUID(), role, time.Minute)
+
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestImportUsers(t *testing.T) {
+	csvBody := importCSVHeader +
+		"alice,alice@example.com,secret123,Alice,Smith,Acme,1 Main Street,Springfield,IL,62701,US\n" +
+		"bob,not-an-email,secret123,Bob,Jones,Acme,1 Main Street,Springfield,IL,62701,US\n" +
+		"taken,taken@example.com,secret123,Tom,Taken,Acme,1 Main Street,Springfield,IL,62701,US\n" +
+		"ALICE,alice2@example.com,secret123,Alice,Again,Acme,1 Main Street,Springfield,IL,62701,US\n" +
+		"short,row\n"
+
+	testCases := []struct {
+		name          string
+		query         string
+		contentType   string
+		body          string
+		role          int
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, store *importTestStore)
+	}{
+		{
+			name:        "CSV",
+			contentType: "text/csv",
+			body:        csvBody,
+			role:        3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *importTestStore) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp importUsersResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.Equal(t, 5, rsp.Total)
+				require.Equal(t, int32(1), rsp.Succeeded)
+				require.Equal(t, int32(4), rsp.Failed)
+				require.Equal(t, 1, store.created)
+
+				require.Equal(t, importRowCreated, rsp.Rows[0].Status)
+				require.NotNil(t, rsp.Rows[0].ID)
+				require.Equal(t, "email", rsp.Rows[1].Error.Errors[0].Field)
+				require.Equal(t, http.StatusConflict, rsp.Rows[2].Error.Status)
+				require.Equal(t, "is already used by row 1", rsp.Rows[3].Error.Errors[0].Message)
+				require.Equal(t, importRowFailed, rsp.Rows[4].Status)
+				require.NotContains(t, recorder.Body.String(), "secret123")
+			},
+		}, {
+			name:        "DryRun",
+			query:       "?dry_run=true",
+			contentType: "text/csv",
+			body:        csvBody,
+			role:        3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *importTestStore) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp importUsersResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.True(t, rsp.DryRun)
+				require.Equal(t, importRowValid, rsp.Rows[0].Status)
+				require.Nil(t, rsp.Rows[0].ID)
+				require.Equal(t, importRowFailed, rsp.Rows[2].Status)
+				require.Equal(t, 0, store.created)
+			},
+		}, {
+			name:        "NDJSON",
+			query:       "?format=ndjson",
+			contentType: "text/plain",
+			body:        importNDJSONRow("carol") + "\n{not json}\n" + importNDJSONRow("dave"),
+			role:        3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *importTestStore) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp importUsersResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.Equal(t, 3, rsp.Total)
+				require.Equal(t, importRowFailed, rsp.Rows[1].Status)
+				require.Equal(t, 2, store.created)
+			},
+		}, {
+			name:        "UnknownColumn",
+			contentType: "text/csv",
+			body:        "user_name,role_id\nalice,3\n",
+			role:        3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *importTestStore) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Equal(t, 0, store.created)
+			},
+		}, {
+			name:        "UnknownFormat",
+			contentType: "application/json",
+			body:        "[]",
+			role:        3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, _ *importTestStore) {
+				require.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+			},
+		}, {
+			name:        "Empty",
+			contentType: "text/csv",
+			body:        importCSVHeader,
+			role:        3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, _ *importTestStore) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		}, {
+			name:        "NotAdmin",
+			contentType: "text/csv",
+			body:        csvBody,
+			role:        1,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *importTestStore) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				require.Equal(t, 0, store.created)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			store := newImportTestStore("taken")
+			server := newTestServer(t, store)
+
+			recorder := importUsers(t, server, tc.query, tc.contentType, tc.body, tc.role)
+			tc.checkResponse(t, recorder, store)
+		})
+	}
+}
+
+func TestImportUsersAttributes(t *testing.T) {
+	license := db.AttributeDefinition{ID: util.RandomUUID(), Key: "license_number", Type: db.AttributeTypeString, Required: true}
+	tier := db.AttributeDefinition{ID: util.RandomUUID(), Key: "tier", Type: db.AttributeTypeInteger,
+		Minimum: sql.NullInt64{Int64: 1, Valid: true}, Maximum: sql.NullInt64{Int64: 3, Valid: true}}
+
+	// withAttributes adds attributes to an NDJSON row.
+	withAttributes := func(userName, attributes string) string {
+		return strings.TrimSuffix(importNDJSONRow(userName), "}\n") + `,"attributes":` + attributes + "}\n"
+	}
+	csvHeader := strings.TrimSuffix(importCSVHeader, "\n") + ",attributes.license_number,attributes.tier\n"
+	csvRow := func(userName, license, tier string) string {
+		return userName + "," + userName + "@example.com,secret123,First,Last,Acme,1 Main Street,Springfield,IL,62701,US," +
+			license + "," + tier + "\n"
+	}
+
+	testCases := []struct {
+		name          string
+		contentType   string
+		body          string
+		checkResponse func(t *testing.T, rsp importUsersResponse, store *importTestStore)
+	}{
+		{
+			name:        "NDJSON",
+			contentType: "application/x-ndjson",
+			body: withAttributes("alice", `{"license_number": "AB-1", "tier": 2}`) +
+				importNDJSONRow("bob") +
+				withAttributes("carol", `{"license_number": "AB-3", "tier": 9}`),
+			checkResponse: func(t *testing.T, rsp importUsersResponse, store *importTestStore) {
+				require.Equal(t, importRowCreated, rsp.Rows[0].Status)
+				require.Len(t, store.attributes["alice"], 2)
+
+				require.Equal(t, importRowFailed, rsp.Rows[1].Status)
+				require.Equal(t, "attributes.license_number", rsp.Rows[1].Error.Errors[0].Field)
+				require.Equal(t, "required", rsp.Rows[1].Error.Errors[0].Code)
+
+				require.Equal(t, importRowFailed, rsp.Rows[2].Status)
+				require.Equal(t, "attributes.tier", rsp.Rows[2].Error.Errors[0].Field)
+				require.Equal(t, 1, store.created)
+			},
+		}, {
+			name:        "CSV",
+			contentType: "text/csv",
+			body:        csvHeader + csvRow("alice", "AB-1", "2") + csvRow("bob", "", "2") + csvRow("carol", "AB-3", "two"),
+			checkResponse: func(t *testing.T, rsp importUsersResponse, store *importTestStore) {
+				require.Equal(t, importRowCreated, rsp.Rows[0].Status)
+				require.Len(t, store.attributes["alice"], 2)
+				for _, value := range store.attributes["alice"] {
+					if value.DefinitionID == tier.ID {
+						require.JSONEq(t, `2`, string(value.Value))
+					}
+				}
+
+				require.Equal(t, "attributes.license_number", rsp.Rows[1].Error.Errors[0].Field)
+				require.Equal(t, "attributes.tier", rsp.Rows[2].Error.Errors[0].Field)
+				require.Equal(t, 1, store.created)
+			},
+		}, {
+			name:        "CSVUnknownAttribute",
+			contentType: "text/csv",
+			body:        strings.TrimSuffix(csvHeader, "\n") + ",attributes.shoe_size\n" + strings.TrimSuffix(csvRow("alice", "AB-1", "2"), "\n") + ",44\n",
+			checkResponse: func(t *testing.T, rsp importUsersResponse, store *importTestStore) {
+				require.Equal(t, "attributes.shoe_size", rsp.Rows[0].Error.Errors[0].Field)
+				require.Equal(t, "unknown_attribute", rsp.Rows[0].Error.Errors[0].Code)
+				require.Equal(t, 0, store.created)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			store := newImportTestStore()
+			store.definitions = []db.AttributeDefinition{license, tier}
+			server := newTestServer(t, store)
+
+			recorder := importUsers(t, server, "", tc.contentType, tc.body, 3)
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			var rsp importUsersResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+			tc.checkResponse(t, rsp, store)
+		})
+	}
+}
+
+func TestImportUsersInBackground(t *testing.T) {
+	store := newImportTestStore()
+	server := newTestServer(t, store)
+	server.config.ImportAsyncRows = 2
+
+	var body strings.Builder
+	for i := 0; i < 3; i++ {
+		body.WriteString(importNDJSONRow(fmt.Sprintf("user%d", i)))
+	}
+
+	recorder := importUsers(t, server, "", "application/x-ndjson", body.String(), 3)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	var job importJobResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &job))
+	require.Equal(t, db.ImportJobStatusRunning, job.Status)
+	require.Equal(t, int32(3), job.Total)
+	require.Equal(t, "/imports/"+job.ID.String(), recorder.Header().Get("Location"))
+
+	poll := func() importJobResponse {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/imports/"+job.ID.String(), nil)
+		require.NoError(t, err)
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomUUID(), 3, time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var rsp importJobResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+		return rsp
+	}
+
+	require.Eventually(t, func() bool { return poll().Status == db.ImportJobStatusCompleted }, 5*time.Second, 10*time.Millisecond)
+
+	job = poll()
+	require.Equal(t, int32(3), job.Processed)
+	require.Equal(t, int32(3), job.Succeeded)
+	require.Len(t, job.Rows, 3)
+	require.Equal(t, 3, store.created)
+}
+
+func TestImportUsersShutdown(t *testing.T) {
+	store := newImportTestStore()
+	server := newTestServer(t, store)
+	server.config.ImportAsyncRows = 1
+
+	// Jobs are stopped first, so the job is stopped before its first row.
+	server.stopJobs()
+	recorder := importUsers(t, server, "", "application/x-ndjson", importNDJSONRow("ahab")+importNDJSONRow("ishmael"), 3)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	var job importJobResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &job))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+
+	finished, err := store.GetImportJob(context.Background(), job.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.ImportJobStatusFailed, finished.Status)
+	require.Contains(t, finished.Error, "shut down")
+	require.Zero(t, finished.ProcessedRows)
+	require.Zero(t, store.created)
+}
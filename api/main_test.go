@@ -12,6 +12,7 @@ func newTestServer(t *testing.T, store db.Store) *Server {
 	config := util.Config{
 		TokenSymmetricKey:   util.RandomSymmetricKey(),
 		AccessTokenDuration: time.Minute,
+		BlobLocalDir:        t.TempDir(),
 	}
 
 	server, err := NewServer(config, store)
@@ -1,10 +1,10 @@
 package api
 
 import (
-	"errors"
 	"github.com/gin-gonic/gin"
-	"net/http"
+	"github.com/google/uuid"
 	"strings"
+	"whaleWake/apierror"
 	"whaleWake/token"
 )
 
@@ -12,6 +12,10 @@ const (
 	authorizationHeaderKey  = "authorization"
 	authorizationTypeBearer = "bearer"
 	authorizationPayloadKey = "authorization_payload"
+
+	requestIDHeaderKey = "X-Request-ID"
+	requestIDKey       = "request_id"
+	maxRequestIDLength = 128
 )
 
 func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
@@ -19,29 +23,26 @@ func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
 		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
 
 		if len(authorizationHeader) == 0 {
-			err := errors.New("authorization header is empty")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, err)
+			apierror.Respond(ctx, apierror.Unauthorized("authorization header is empty"))
 			return
 		}
 
 		// Extract the token from the header
 		fields := strings.Fields(authorizationHeader)
 		if len(fields) < 2 {
-			err := errors.New("invalid authorization header format")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, err)
+			apierror.Respond(ctx, apierror.Unauthorized("invalid authorization header format"))
 			return
 		}
 		authorizationType := strings.ToLower(fields[0])
 		if authorizationType != authorizationTypeBearer {
-			err := errors.New("unsupported authorization type")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, err)
+			apierror.Respond(ctx, apierror.Unauthorized("unsupported authorization type"))
 			return
 		}
 
 		accessToken := fields[1]
 		payload, err := tokenMaker.VerifyToken(accessToken)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, err)
+			apierror.Respond(ctx, apierror.Unauthorized(err.Error()))
 			return
 		}
 
@@ -51,3 +52,32 @@ func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
 
 	}
 }
+
+// requestIDMiddleware makes sure every request has an ID that can be used to correlate logs and audit events.
+// A well-formed X-Request-ID sent by the client (or a proxy in front of us) is kept; otherwise a new UUID is generated.
+// The ID is echoed back in the X-Request-ID response header.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(requestIDHeaderKey)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		ctx.Set(requestIDKey, requestID)
+		ctx.Header(requestIDHeaderKey, requestID)
+		ctx.Next()
+	}
+}
+
+// validRequestID accepts short IDs made of printable ASCII so client input cannot inject anything into logs.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
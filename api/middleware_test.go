@@ -7,8 +7,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+	"whaleWake/apierror"
 	"whaleWake/token"
 	"whaleWake/util"
 )
@@ -51,6 +53,8 @@ func TestAuthMiddleware(t *testing.T) {
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				require.Equal(t, apierror.ContentType, recorder.Header().Get("Content-Type"))
+				require.Contains(t, recorder.Body.String(), string(apierror.CodeUnauthenticated))
 			},
 		}, {
 			name: "UnsupportedAuthorization",
@@ -108,3 +112,47 @@ func TestAuthMiddleware(t *testing.T) {
 	}
 
 }
+
+func TestRequestIDMiddleware(t *testing.T) {
+	testCases := []struct {
+		name      string
+		requestID string
+		keep      bool
+	}{
+		{name: "Generated", requestID: "", keep: false},
+		{name: "Kept", requestID: "req-123", keep: true},
+		{name: "TooLong", requestID: strings.Repeat("a", maxRequestIDLength+1), keep: false},
+		{name: "Unprintable", requestID: "bad\tid", keep: false},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, nil)
+
+			var seen string
+			server.router.GET("/request-id", func(ctx *gin.Context) {
+				seen = ctx.GetString(requestIDKey)
+				ctx.JSON(http.StatusOK, gin.H{})
+			})
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/request-id", nil)
+			require.NoError(t, err)
+			if tc.requestID != "" {
+				request.Header.Set(requestIDHeaderKey, tc.requestID)
+			}
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			require.NotEmpty(t, seen)
+			require.Equal(t, seen, recorder.Header().Get(requestIDHeaderKey))
+			if tc.keep {
+				require.Equal(t, tc.requestID, seen)
+			} else {
+				require.NotEqual(t, tc.requestID, seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/geo"
+	"whaleWake/sms"
+	"whaleWake/token"
+)
+
+// phoneCodeAttempts is how many wrong codes are accepted before a code has to be requested again.
+const phoneCodeAttempts = 5
+
+// phoneCodeWindow is the window PHONE_CODE_LIMIT applies to.
+const phoneCodeWindow = time.Hour
+
+// setUserPhoneRequest defines the payload for setting a phone number.
+// Fields:
+// - PhoneNumber: An international number starting with + or 00, or a national number of CountryCode.
+// - CountryCode: Optional ISO 3166-1 alpha-2 code for national numbers; defaults to the profile's country.
+type setUserPhoneRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required,max=32"`
+	CountryCode string `json:"country_code" binding:"omitempty,len=2"`
+}
+
+// confirmPhoneVerificationRequest defines the payload for confirming a phone number.
+type confirmPhoneVerificationRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type userPhoneResponse struct {
+	PhoneNumber     string  `json:"phone_number"`
+	PhoneVerifiedAt *string `json:"phone_verified_at"`
+}
+
+func newUserPhoneResponse(profile db.UserProfile) userPhoneResponse {
+	return userPhoneResponse{
+		PhoneNumber:     profile.PhoneNumber,
+		PhoneVerifiedAt: historyTime(profile.PhoneVerifiedAt),
+	}
+}
+
+type phoneVerificationResponse struct {
+	PhoneNumber string `json:"phone_number"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+// phoneOwner parses the user id of a phone route and checks the caller may manage that user's phone number.
+// The error has already been sent when ok is false.
+func (server *Server) phoneOwner(ctx *gin.Context) (uuid.UUID, bool) {
+	return server.selfOrAdmin(ctx, "You are not authorized to manage this user's phone number")
+}
+
+// SetUserPhone handles PUT /usertx/:id/phone to set or replace the profile's phone number.
+// The number is stored in E.164 format. A different number than before is unverified until a code is confirmed.
+// Returns 400 for bad input, 403 for other users unless admin, 404 if the profile does not exist, 500 for server errors, 200 for success.
+func (server *Server) SetUserPhone(ctx *gin.Context) {
+	var req setUserPhoneRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	userID, ok := server.phoneOwner(ctx)
+	if !ok {
+		return
+	}
+
+	country := req.CountryCode
+	if country == "" {
+		profile, err := server.store.GetUserProfile(ctx, userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				err = apierror.NotFound("profile not found")
+			}
+			apierror.Respond(ctx, err)
+			return
+		}
+		country = profile.CountryCode
+	}
+
+	number, err := geo.NormalizePhone(req.PhoneNumber, country)
+	if err != nil {
+		apierror.Respond(ctx, apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "request failed validation").
+			WithFields(apierror.FieldError{Field: geo.FieldPhoneNumber, Code: geo.CodePhoneNumber, Message: err.Error()}))
+		return
+	}
+
+	server.setUserPhone(ctx, userID, number)
+}
+
+// DeleteUserPhone handles DELETE /usertx/:id/phone to remove the profile's phone number.
+// Returns 400 for a bad UUID, 403 for other users unless admin, 404 if the profile does not exist, 500 for server errors, 200 for success.
+func (server *Server) DeleteUserPhone(ctx *gin.Context) {
+	userID, ok := server.phoneOwner(ctx)
+	if !ok {
+		return
+	}
+
+	server.setUserPhone(ctx, userID, "")
+}
+
+// setUserPhone stores a normalized phone number, or clears it, and responds with the result.
+func (server *Server) setUserPhone(ctx *gin.Context, userID uuid.UUID, number string) {
+	profile, err := server.store.SetUserPhoneTx(auditContext(ctx), db.UpdateUserProfilePhoneParams{
+		UserID:      userID,
+		PhoneNumber: number,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("profile not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserPhoneResponse(profile))
+}
+
+// StartPhoneVerification handles POST /usertx/:id/phone/verification to text a code to the profile's phone number.
+// A user may be sent PHONE_CODE_LIMIT codes an hour; each expires after PHONE_CODE_TTL and only the latest counts.
+// Returns 400 for a bad UUID, 403 for other users unless admin, 404 if the profile does not exist, 409 without an unverified number, 429 over the limit, 500 for server errors, 202 once the code is sent.
+func (server *Server) StartPhoneVerification(ctx *gin.Context) {
+	userID, ok := server.phoneOwner(ctx)
+	if !ok {
+		return
+	}
+
+	code, err := newPhoneCode()
+	if err != nil {
+		apierror.Respond(ctx, apierror.Internal(err))
+		return
+	}
+
+	now := time.Now()
+	verification, err := server.store.StartPhoneVerificationTx(ctx, db.StartPhoneVerificationParams{
+		UserID:    userID,
+		CodeHash:  hashPhoneCode(userID, code),
+		ExpiresAt: now.Add(server.config.PhoneCodeTTL),
+		Since:     now.Add(-phoneCodeWindow),
+		Limit:     int64(server.config.PhoneCodeLimit),
+	})
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			err = apierror.NotFound("profile not found")
+		case errors.Is(err, db.ErrPhoneNumberMissing), errors.Is(err, db.ErrPhoneAlreadyVerified):
+			err = apierror.Conflict(apierror.CodeConflict, err.Error())
+		case errors.Is(err, db.ErrPhoneVerificationLimit):
+			err = apierror.TooManyRequests("too many verification codes requested; try again later")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	err = server.smsSender.Send(ctx, sms.Message{
+		To:   verification.PhoneNumber,
+		Body: fmt.Sprintf("Your verification code is %s. It expires in %s.", code, server.config.PhoneCodeTTL),
+	})
+	if err != nil {
+		log.Printf("Unable to send a phone verification code to user %s: %v", userID, err)
+		apierror.Respond(ctx, apierror.Internal(err))
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, phoneVerificationResponse{
+		PhoneNumber: verification.PhoneNumber,
+		ExpiresAt:   verification.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// ConfirmPhoneVerification handles POST /usertx/:id/phone/verification/confirm to confirm a code and mark the
+// phone number verified. Only the user can confirm their own number, even admins cannot.
+// Returns 400 for bad input or a wrong code, 403 for other users, 422 when the code has expired or run out of attempts, 500 for server errors, 200 for success.
+func (server *Server) ConfirmPhoneVerification(ctx *gin.Context) {
+	var req confirmPhoneVerificationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	userID, ok := server.phoneOwner(ctx)
+	if !ok {
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if userID != authPayload.UserID {
+		apierror.Respond(ctx, apierror.Forbidden("Only the owner of a phone number can confirm it"))
+		return
+	}
+
+	profile, err := server.store.ConfirmPhoneVerificationTx(auditContext(ctx), db.ConfirmPhoneVerificationParams{
+		UserID:      userID,
+		CodeHash:    hashPhoneCode(userID, req.Code),
+		MaxAttempts: phoneCodeAttempts,
+		Now:         time.Now(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrPhoneCodeInvalid):
+			err = apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "request failed validation").
+				WithFields(apierror.FieldError{Field: "code", Code: "invalid", Message: "is not the code that was sent"})
+		case errors.Is(err, db.ErrPhoneCodeExpired):
+			err = apierror.Unprocessable(apierror.CodeUnprocessable, "the verification code has expired; request a new one")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserPhoneResponse(profile))
+}
+
+// newPhoneCode returns a random six digit code.
+func newPhoneCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashPhoneCode hashes a code with the user it was sent to, so the stored hash only matches for that user.
+func hashPhoneCode(userID uuid.UUID, code string) string {
+	sum := sha256.Sum256([]byte(userID.String() + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/sms"
+	"whaleWake/util"
+)
+
+// phoneTestStore keeps the profile and latest verification code of one user.
+type phoneTestStore struct {
+	db.Store
+	profile      db.UserProfile
+	verification db.PhoneVerification
+	sent         int64
+}
+
+func (s *phoneTestStore) GetUserProfile(_ context.Context, userID uuid.UUID) (db.UserProfile, error) {
+	if userID != s.profile.UserID {
+		return db.UserProfile{}, sql.ErrNoRows
+	}
+	return s.profile, nil
+}
+
+func (s *phoneTestStore) SetUserPhoneTx(_ context.Context, arg db.UpdateUserProfilePhoneParams) (db.UserProfile, error) {
+	if arg.UserID != s.profile.UserID {
+		return db.UserProfile{}, sql.ErrNoRows
+	}
+	if arg.PhoneNumber != s.profile.PhoneNumber {
+		s.profile.PhoneVerifiedAt = sql.NullTime{}
+	}
+	s.profile.PhoneNumber = arg.PhoneNumber
+	s.profile.Version++
+	return s.profile, nil
+}
+
+func (s *phoneTestStore) StartPhoneVerificationTx(_ context.Context, arg db.StartPhoneVerificationParams) (db.PhoneVerification, error) {
+	switch {
+	case arg.UserID != s.profile.UserID:
+		return db.PhoneVerification{}, sql.ErrNoRows
+	case s.profile.PhoneNumber == "":
+		return db.PhoneVerification{}, db.ErrPhoneNumberMissing
+	case s.profile.PhoneVerifiedAt.Valid:
+		return db.PhoneVerification{}, db.ErrPhoneAlreadyVerified
+	case s.sent >= arg.Limit:
+		return db.PhoneVerification{}, db.ErrPhoneVerificationLimit
+	}
+	s.sent++
+	s.verification = db.PhoneVerification{
+		ID:          util.RandomUUID(),
+		UserID:      arg.UserID,
+		PhoneNumber: s.profile.PhoneNumber,
+		CodeHash:    arg.CodeHash,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   arg.ExpiresAt,
+	}
+	return s.verification, nil
+}
+
+func (s *phoneTestStore) ConfirmPhoneVerificationTx(_ context.Context, arg db.ConfirmPhoneVerificationParams) (db.UserProfile, error) {
+	if s.verification.ID == uuid.Nil || s.verification.VerifiedAt.Valid {
+		return db.UserProfile{}, db.ErrPhoneCodeInvalid
+	}
+	if !arg.Now.Before(s.verification.ExpiresAt) || s.verification.Attempts >= arg.MaxAttempts {
+		return db.UserProfile{}, db.ErrPhoneCodeExpired
+	}
+	if arg.CodeHash != s.verification.CodeHash {
+		s.verification.Attempts++
+		return db.UserProfile{}, db.ErrPhoneCodeInvalid
+	}
+	s.verification.VerifiedAt = sql.NullTime{Time: arg.Now, Valid: true}
+	s.profile.PhoneVerifiedAt = sql.NullTime{Time: arg.Now, Valid: true}
+	s.profile.Version++
+	return s.profile, nil
+}
+
+// recordingSender keeps the messages it is asked to send.
+type recordingSender struct {
+	messages []sms.Message
+}
+
+func (s *recordingSender) Send(_ context.Context, message sms.Message) error {
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+func TestUserPhoneVerification(t *testing.T) {
+	userID := util.RandomUUID()
+	store := &phoneTestStore{profile: db.UserProfile{ID: util.RandomUUID(), UserID: userID, CountryCode: "GB", Version: 1}}
+	sender := &recordingSender{}
+	server := newTestServer(t, store)
+	server.smsSender = sender
+	server.config.PhoneCodeTTL = time.Minute
+	server.config.PhoneCodeLimit = 3
+
+	send := func(method, path string, body interface{}, callerID uuid.UUID, role int) *httptest.ResponseRecorder {
+		var data []byte
+		if body != nil {
+			var err error
+			data, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(method, path, bytes.NewReader(data))
+		require.NoError(t, err)
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, callerID, role, time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	base := "/usertx/" + userID.String() + "/phone"
+
+	// No number to verify yet.
+	require.Equal(t, http.StatusConflict, send(http.MethodPost, base+"/verification", nil, userID, 1).Code)
+
+	// National numbers are read in the profile's country.
+	recorder := send(http.MethodPut, base, map[string]string{"phone_number": "020 7946 0958"}, userID, 1)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var phone userPhoneResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &phone))
+	require.Equal(t, "+442079460958", phone.PhoneNumber)
+	require.Nil(t, phone.PhoneVerifiedAt)
+
+	recorder = send(http.MethodPut, base, map[string]string{"phone_number": "12345"}, userID, 1)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"field":"phone_number"`)
+
+	// Another country can be named for the number.
+	recorder = send(http.MethodPut, base, map[string]string{"phone_number": "(415) 555-0123", "country_code": "US"}, userID, 1)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &phone))
+	require.Equal(t, "+14155550123", phone.PhoneNumber)
+
+	recorder = send(http.MethodPost, base+"/verification", nil, userID, 1)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	require.Len(t, sender.messages, 1)
+	require.Equal(t, "+14155550123", sender.messages[0].To)
+	code := regexp.MustCompile(`\d{6}`).FindString(sender.messages[0].Body)
+	require.NotEmpty(t, code)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	require.Equal(t, http.StatusBadRequest, send(http.MethodPost, base+"/verification/confirm", map[string]string{"code": wrong}, userID, 1).Code)
+	require.Equal(t, http.StatusBadRequest, send(http.MethodPost, base+"/verification/confirm", map[string]string{"code": "12ab56"}, userID, 1).Code)
+
+	// Admins can send codes but not confirm them.
+	require.Equal(t, http.StatusForbidden, send(http.MethodPost, base+"/verification/confirm", map[string]string{"code": code}, util.RandomUUID(), 3).Code)
+	require.Equal(t, http.StatusForbidden, send(http.MethodPut, base, map[string]string{"phone_number": "+14155550123"}, util.RandomUUID(), 1).Code)
+
+	recorder = send(http.MethodPost, base+"/verification/confirm", map[string]string{"code": code}, userID, 1)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &phone))
+	require.NotNil(t, phone.PhoneVerifiedAt)
+
+	require.Equal(t, http.StatusConflict, send(http.MethodPost, base+"/verification", nil, userID, 3).Code)
+
+	// A new number has to be verified again, within the rate limit.
+	require.Equal(t, http.StatusOK, send(http.MethodPut, base, map[string]string{"phone_number": "+33 1 23 45 67 89"}, userID, 1).Code)
+	require.Equal(t, http.StatusAccepted, send(http.MethodPost, base+"/verification", nil, util.RandomUUID(), 3).Code)
+	require.Equal(t, http.StatusAccepted, send(http.MethodPost, base+"/verification", nil, userID, 1).Code)
+	require.Equal(t, http.StatusTooManyRequests, send(http.MethodPost, base+"/verification", nil, userID, 1).Code)
+
+	recorder = send(http.MethodDelete, base, nil, userID, 1)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &phone))
+	require.Empty(t, phone.PhoneNumber)
+}
@@ -0,0 +1,376 @@
+package api
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/token"
+)
+
+// exportMyDataRequest defines the query parameters for GET /users/me/export.
+// Fields:
+// - Format: json (default) for a single document, or zip for one JSON file per section.
+type exportMyDataRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=json zip"`
+}
+
+type userProfileExport struct {
+	ID              uuid.UUID `json:"id"`
+	FirstName       string    `json:"first_name"`
+	LastName        string    `json:"last_name"`
+	BusinessName    string    `json:"business_name"`
+	StreetAddress   string    `json:"street_address"`
+	City            string    `json:"city"`
+	State           string    `json:"state"`
+	Zip             string    `json:"zip"`
+	CountryCode     string    `json:"country_code"`
+	PhoneNumber     string    `json:"phone_number"`
+	PhoneVerifiedAt *string   `json:"phone_verified_at"`
+	AvatarKey       string    `json:"avatar_key"`
+	CreatedAt       string    `json:"created_at"`
+	UpdatedAt       string    `json:"updated_at"`
+}
+
+type phoneVerificationExport struct {
+	ID          uuid.UUID `json:"id"`
+	PhoneNumber string    `json:"phone_number"`
+	Attempts    int32     `json:"attempts"`
+	CreatedAt   string    `json:"created_at"`
+	ExpiresAt   string    `json:"expires_at"`
+	VerifiedAt  *string   `json:"verified_at"`
+}
+
+type emailChangeExport struct {
+	ID              uuid.UUID `json:"id"`
+	OldEmail        string    `json:"old_email"`
+	NewEmail        string    `json:"new_email"`
+	CreatedAt       string    `json:"created_at"`
+	ExpiresAt       string    `json:"expires_at"`
+	RevertExpiresAt string    `json:"revert_expires_at"`
+	ConfirmedAt     *string   `json:"confirmed_at"`
+	RevertedAt      *string   `json:"reverted_at"`
+	CancelledAt     *string   `json:"cancelled_at"`
+}
+
+type userRoleExport struct {
+	ID        uuid.UUID `json:"id"`
+	RoleID    int32     `json:"role_id"`
+	CreatedAt string    `json:"created_at"`
+	UpdatedAt string    `json:"updated_at"`
+}
+
+type erasureRequestResponse struct {
+	ID           uuid.UUID `json:"id"`
+	Status       string    `json:"status"`
+	RequestedAt  string    `json:"requested_at"`
+	ScheduledFor string    `json:"scheduled_for"`
+	CancelledAt  *string   `json:"cancelled_at"`
+	CompletedAt  *string   `json:"completed_at"`
+}
+
+func newErasureRequestResponse(request db.ErasureRequest) erasureRequestResponse {
+	return erasureRequestResponse{
+		ID:           request.ID,
+		Status:       request.Status,
+		RequestedAt:  request.RequestedAt.Format(time.RFC3339),
+		ScheduledFor: request.ScheduledFor.Format(time.RFC3339),
+		CancelledAt:  historyTime(request.CancelledAt),
+		CompletedAt:  historyTime(request.CompletedAt),
+	}
+}
+
+// userDataExport is everything stored about a user. Password hashes are never included.
+// Sessions is always empty: access tokens are stateless and are not stored, so there are no sessions to export.
+type userDataExport struct {
+	GeneratedAt        string                     `json:"generated_at"`
+	User               userResponse               `json:"user"`
+	UserProfile        *userProfileExport         `json:"user_profile"`
+	UserRoles          []userRoleExport           `json:"user_roles"`
+	Addresses          []userAddressResponse      `json:"addresses"`
+	PhoneVerifications []phoneVerificationExport  `json:"phone_verifications"`
+	EmailChanges       []emailChangeExport        `json:"email_changes"`
+	Documents          []userDocumentResponse     `json:"documents"`
+	Settings           map[string]json.RawMessage `json:"settings"`
+	Attributes         map[string]json.RawMessage `json:"attributes"`
+	Sessions           []struct{}                 `json:"sessions"`
+	History            userHistoryResponse        `json:"history"`
+	AuditEvents        []auditEventResponse       `json:"audit_events"`
+	ErasureRequests    []erasureRequestResponse   `json:"erasure_requests"`
+}
+
+func newUserDataExport(data db.UserDataResult, generatedAt time.Time) userDataExport {
+	export := userDataExport{
+		GeneratedAt:        generatedAt.Format(time.RFC3339),
+		User:               newUserResponse(data.User),
+		UserRoles:          []userRoleExport{},
+		Addresses:          make([]userAddressResponse, 0, len(data.Addresses)),
+		PhoneVerifications: make([]phoneVerificationExport, 0, len(data.PhoneVerifications)),
+		EmailChanges:       make([]emailChangeExport, 0, len(data.EmailChanges)),
+		Documents:          make([]userDocumentResponse, 0, len(data.Documents)),
+		Settings:           make(map[string]json.RawMessage, len(data.Settings)),
+		Attributes:         db.UserAttributeMap(data.Attributes),
+		Sessions:           []struct{}{},
+		History:            newUserHistoryResponse(data.User.ID, data.History),
+		AuditEvents:        make([]auditEventResponse, 0, len(data.AuditEvents)),
+		ErasureRequests:    make([]erasureRequestResponse, 0, len(data.ErasureRequests)),
+	}
+
+	if profile := data.UserProfile; profile.ID != uuid.Nil {
+		export.UserProfile = &userProfileExport{
+			ID:              profile.ID,
+			FirstName:       profile.FirstName,
+			LastName:        profile.LastName,
+			BusinessName:    profile.BusinessName,
+			StreetAddress:   profile.StreetAddress,
+			City:            profile.City,
+			State:           profile.State,
+			Zip:             profile.Zip,
+			CountryCode:     profile.CountryCode,
+			PhoneNumber:     profile.PhoneNumber,
+			PhoneVerifiedAt: historyTime(profile.PhoneVerifiedAt),
+			AvatarKey:       profile.AvatarKey,
+			CreatedAt:       profile.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:       profile.UpdatedAt.Format(time.RFC3339),
+		}
+	}
+
+	if role := data.UserRole; role.ID != uuid.Nil {
+		export.UserRoles = append(export.UserRoles, userRoleExport{
+			ID:        role.ID,
+			RoleID:    role.RoleID,
+			CreatedAt: role.CreatedAt.Format(time.RFC3339),
+			UpdatedAt: role.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+
+	for _, address := range data.Addresses {
+		export.Addresses = append(export.Addresses, newUserAddressResponse(address))
+	}
+
+	for _, verification := range data.PhoneVerifications {
+		export.PhoneVerifications = append(export.PhoneVerifications, phoneVerificationExport{
+			ID:          verification.ID,
+			PhoneNumber: verification.PhoneNumber,
+			Attempts:    verification.Attempts,
+			CreatedAt:   verification.CreatedAt.Format(time.RFC3339),
+			ExpiresAt:   verification.ExpiresAt.Format(time.RFC3339),
+			VerifiedAt:  historyTime(verification.VerifiedAt),
+		})
+	}
+
+	for _, change := range data.EmailChanges {
+		export.EmailChanges = append(export.EmailChanges, emailChangeExport{
+			ID:              change.ID,
+			OldEmail:        change.OldEmail,
+			NewEmail:        change.NewEmail,
+			CreatedAt:       change.CreatedAt.Format(time.RFC3339),
+			ExpiresAt:       change.ExpiresAt.Format(time.RFC3339),
+			RevertExpiresAt: change.RevertExpiresAt.Format(time.RFC3339),
+			ConfirmedAt:     historyTime(change.ConfirmedAt),
+			RevertedAt:      historyTime(change.RevertedAt),
+			CancelledAt:     historyTime(change.CancelledAt),
+		})
+	}
+
+	for _, document := range data.Documents {
+		export.Documents = append(export.Documents, newUserDocumentResponse(document))
+	}
+
+	for _, setting := range data.Settings {
+		export.Settings[setting.Key] = setting.Value
+	}
+
+	for _, event := range data.AuditEvents {
+		export.AuditEvents = append(export.AuditEvents, newAuditEventResponse(event))
+	}
+
+	for _, request := range data.ErasureRequests {
+		export.ErasureRequests = append(export.ErasureRequests, newErasureRequestResponse(request))
+	}
+
+	return export
+}
+
+// sections returns the parts of the export as the file names and contents of the ZIP format.
+func (export userDataExport) sections() []struct {
+	name  string
+	value interface{}
+} {
+	return []struct {
+		name  string
+		value interface{}
+	}{
+		{"user.json", export.User},
+		{"user_profile.json", export.UserProfile},
+		{"user_roles.json", export.UserRoles},
+		{"addresses.json", export.Addresses},
+		{"phone_verifications.json", export.PhoneVerifications},
+		{"email_changes.json", export.EmailChanges},
+		{"documents.json", export.Documents},
+		{"settings.json", export.Settings},
+		{"attributes.json", export.Attributes},
+		{"sessions.json", export.Sessions},
+		{"history.json", export.History},
+		{"audit_events.json", export.AuditEvents},
+		{"erasure_requests.json", export.ErasureRequests},
+	}
+}
+
+// exportMyDataRoute serves GET /users/:id/export, where the only id is "me", the caller's data export. gin can't
+// register the static /users/me/export next to the other /users/:id routes, so the handler checks the id.
+// Returns 404 for any other id.
+func (server *Server) exportMyDataRoute(ctx *gin.Context) {
+	if ctx.Param("id") != "me" {
+		apierror.Respond(ctx, apierror.NotFound("only your own data can be exported, at /users/me/export"))
+		return
+	}
+	server.ExportMyData(ctx)
+}
+
+// ExportMyData handles GET /users/me/export so the caller can download everything stored about them.
+// The export covers the user, profile, role, addresses, phone verifications (without the codes), email changes
+// (without the tokens), the settings the user has changed, custom attributes, and documents (listed only; the files
+// are downloaded from /usertx/:id/documents), every recorded version of the first three, the audit events about or
+// by the user, and any erasure requests.
+// Returns 400 for an unknown format, 404 if the caller no longer exists, 500 for server errors, 200 with the file.
+func (server *Server) ExportMyData(ctx *gin.Context) {
+	var req exportMyDataRequest
+
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	data, err := server.store.GetUserDataTx(ctx, authPayload.UserID)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	export := newUserDataExport(data, now)
+	filename := fmt.Sprintf("whalewake-data-%s", now.Format("20060102"))
+
+	if req.Format != "zip" {
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		ctx.JSON(http.StatusOK, export)
+		return
+	}
+
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+	ctx.Status(http.StatusOK)
+
+	archive := zip.NewWriter(ctx.Writer)
+	for _, section := range export.sections() {
+		f, err := archive.Create(section.name)
+		if err == nil {
+			encoder := json.NewEncoder(f)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(section.value)
+		}
+		if err != nil {
+			log.Printf("%s %s: %v", ctx.Request.Method, ctx.Request.URL.Path, err)
+			ctx.Abort()
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("%s %s: %v", ctx.Request.Method, ctx.Request.URL.Path, err)
+		ctx.Abort()
+	}
+}
+
+// RequestErasure handles POST /me/erasure to ask for the caller's personal data to be erased.
+// The erasure happens once the ERASURE_COOL_DOWN setting has passed, and can be cancelled until then.
+// Returns 404 if the caller no longer exists, 409 if an erasure is already pending, 500 for server errors,
+// 202 with the scheduled request.
+func (server *Server) RequestErasure(ctx *gin.Context) {
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if _, err := server.store.GetUser(ctx, authPayload.UserID); err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	request, err := server.store.CreateErasureRequest(ctx, db.CreateErasureRequestParams{
+		UserID:       authPayload.UserID,
+		ScheduledFor: time.Now().Add(server.config.ErasureCoolDown),
+	})
+	if err == sql.ErrNoRows {
+		apierror.Respond(ctx, apierror.Conflict(apierror.CodeConflict, "an erasure is already pending; cancel it to schedule a new one"))
+		return
+	}
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, newErasureRequestResponse(request))
+}
+
+// GetErasureRequest handles GET /me/erasure to show the caller's pending erasure.
+// Returns 404 if nothing is pending, 500 for server errors, 200 with the request.
+func (server *Server) GetErasureRequest(ctx *gin.Context) {
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	request, err := server.store.GetPendingErasureRequest(ctx, authPayload.UserID)
+	if err == sql.ErrNoRows {
+		apierror.Respond(ctx, apierror.NotFound("no erasure is pending"))
+		return
+	}
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newErasureRequestResponse(request))
+}
+
+// CancelErasureRequest handles DELETE /me/erasure to call off the caller's pending erasure.
+// Returns 404 if nothing is pending, 500 for server errors, 200 with the cancelled request.
+func (server *Server) CancelErasureRequest(ctx *gin.Context) {
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	request, err := server.store.CancelErasureRequest(ctx, authPayload.UserID)
+	if err == sql.ErrNoRows {
+		apierror.Respond(ctx, apierror.NotFound("no erasure is pending"))
+		return
+	}
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newErasureRequestResponse(request))
+}
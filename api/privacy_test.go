@@ -0,0 +1,207 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+// privacyTestStore keeps at most one pending erasure request per user.
+type privacyTestStore struct {
+	db.Store
+	user    db.User
+	pending map[uuid.UUID]db.ErasureRequest
+}
+
+func (s *privacyTestStore) GetUser(_ context.Context, id uuid.UUID) (db.User, error) {
+	if id != s.user.ID {
+		return db.User{}, sql.ErrNoRows
+	}
+	return s.user, nil
+}
+
+func (s *privacyTestStore) GetUserDataTx(_ context.Context, userID uuid.UUID) (db.UserDataResult, error) {
+	if userID != s.user.ID {
+		return db.UserDataResult{}, sql.ErrNoRows
+	}
+	return db.UserDataResult{
+		User:        s.user,
+		UserProfile: db.UserProfile{ID: util.RandomUUID(), UserID: userID, FirstName: "John"},
+		UserRole:    db.UserRole{ID: util.RandomUUID(), UserID: userID, RoleID: 1},
+	}, nil
+}
+
+func (s *privacyTestStore) CreateErasureRequest(_ context.Context, arg db.CreateErasureRequestParams) (db.ErasureRequest, error) {
+	if _, ok := s.pending[arg.UserID]; ok {
+		return db.ErasureRequest{}, sql.ErrNoRows
+	}
+	request := db.ErasureRequest{
+		ID:           util.RandomUUID(),
+		UserID:       arg.UserID,
+		Status:       db.ErasureStatusPending,
+		RequestedAt:  time.Now(),
+		ScheduledFor: arg.ScheduledFor,
+	}
+	s.pending[arg.UserID] = request
+	return request, nil
+}
+
+func (s *privacyTestStore) GetPendingErasureRequest(_ context.Context, userID uuid.UUID) (db.ErasureRequest, error) {
+	request, ok := s.pending[userID]
+	if !ok {
+		return db.ErasureRequest{}, sql.ErrNoRows
+	}
+	return request, nil
+}
+
+func (s *privacyTestStore) CancelErasureRequest(_ context.Context, userID uuid.UUID) (db.ErasureRequest, error) {
+	request, ok := s.pending[userID]
+	if !ok {
+		return db.ErasureRequest{}, sql.ErrNoRows
+	}
+	delete(s.pending, userID)
+	request.Status = db.ErasureStatusCancelled
+	request.CancelledAt = sql.NullTime{Time: time.Now(), Valid: true}
+	return request, nil
+}
+
+func TestExportMyData(t *testing.T) {
+	user := db.User{ID: util.RandomUUID(), UserName: "jsmith", Email: "john@example.com", Password: "hash"}
+
+	testCases := []struct {
+		name          string
+		query         string
+		userID        uuid.UUID
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "JSON",
+			userID: user.ID,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Header().Get("Content-Disposition"), ".json")
+				require.NotContains(t, recorder.Body.String(), "hash")
+
+				var rsp userDataExport
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.Equal(t, user.ID, rsp.User.ID)
+				require.NotNil(t, rsp.UserProfile)
+				require.Equal(t, "John", rsp.UserProfile.FirstName)
+				require.Len(t, rsp.UserRoles, 1)
+				require.NotNil(t, rsp.Sessions)
+				require.Empty(t, rsp.Sessions)
+			},
+		}, {
+			name:   "ZIP",
+			query:  "?format=zip",
+			userID: user.ID,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/zip", recorder.Header().Get("Content-Type"))
+
+				body := recorder.Body.Bytes()
+				archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+				require.NoError(t, err)
+
+				names := make([]string, 0, len(archive.File))
+				for _, f := range archive.File {
+					names = append(names, f.Name)
+				}
+				require.Contains(t, names, "user.json")
+				require.Contains(t, names, "sessions.json")
+				require.Contains(t, names, "audit_events.json")
+			},
+		}, {
+			name:   "UnknownFormat",
+			query:  "?format=xml",
+			userID: user.ID,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		}, {
+			name:   "UserGone",
+			userID: util.RandomUUID(),
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, &privacyTestStore{user: user, pending: map[uuid.UUID]db.ErasureRequest{}})
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/users/me/export"+tc.query, nil)
+			require.NoError(t, err)
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, tc.userID, 1, time.Minute)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestExportMyDataOtherUser(t *testing.T) {
+	user := db.User{ID: util.RandomUUID(), UserName: "jsmith", Email: "john@example.com"}
+	server := newTestServer(t, &privacyTestStore{user: user, pending: map[uuid.UUID]db.ErasureRequest{}})
+	recorder := httptest.NewRecorder()
+
+	// Only "me" is exported; even admins don't export other users by ID here.
+	request, err := http.NewRequest(http.MethodGet, "/users/"+user.ID.String()+"/export", nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomUUID(), 3, time.Minute)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestErasureRequestLifecycle(t *testing.T) {
+	user := db.User{ID: util.RandomUUID(), UserName: "jsmith", Email: "john@example.com"}
+	server := newTestServer(t, &privacyTestStore{user: user, pending: map[uuid.UUID]db.ErasureRequest{}})
+	server.config.ErasureCoolDown = 24 * time.Hour
+
+	send := func(method string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(method, "/me/erasure", nil)
+		require.NoError(t, err)
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, 1, time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	require.Equal(t, http.StatusNotFound, send(http.MethodGet).Code)
+
+	recorder := send(http.MethodPost)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	var created erasureRequestResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	require.Equal(t, db.ErasureStatusPending, created.Status)
+	scheduledFor, err := time.Parse(time.RFC3339, created.ScheduledFor)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(24*time.Hour), scheduledFor, time.Minute)
+
+	require.Equal(t, http.StatusConflict, send(http.MethodPost).Code)
+	require.Equal(t, http.StatusOK, send(http.MethodGet).Code)
+
+	recorder = send(http.MethodDelete)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var cancelled erasureRequestResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &cancelled))
+	require.Equal(t, db.ErasureStatusCancelled, cancelled.Status)
+	require.NotNil(t, cancelled.CancelledAt)
+
+	require.Equal(t, http.StatusNotFound, send(http.MethodDelete).Code)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"container/list"
+	"github.com/gin-gonic/gin"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"whaleWake/apierror"
+)
+
+// maxRateLimitClients is how many clients a rateLimiter tracks at most.
+const maxRateLimitClients = 10000
+
+// rateLimiter allows each client a number of requests per fixed window, counted in memory.
+// Counts are per process, so with several instances a client gets the limit on each of them.
+// Windows are kept in the order they started, so expired ones are dropped from the front as they come up, and
+// once maxClients are tracked the oldest window is dropped for a new client.
+type rateLimiter struct {
+	limit      int
+	window     time.Duration
+	maxClients int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*list.Element
+	order   *list.List
+}
+
+// rateWindow counts a client's requests in the window that started at start.
+type rateWindow struct {
+	key   string
+	start time.Time
+	count int
+}
+
+// newRateLimiter creates a limiter of limit requests per window for each client.
+// A limit of zero or less turns limiting off.
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:      limit,
+		window:     window,
+		maxClients: maxRateLimitClients,
+		now:        time.Now,
+		windows:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// allow counts a request from key.
+// Returns:
+// - Whether the request is within the limit.
+// - How long until the client's window resets, when it is not.
+func (limiter *rateLimiter) allow(key string) (bool, time.Duration) {
+	if limiter.limit <= 0 {
+		return true, 0
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := limiter.now()
+	limiter.sweep(now)
+
+	element, ok := limiter.windows[key]
+	if ok {
+		// sweep has dropped every expired window, so this one is still running.
+		window := element.Value.(*rateWindow)
+		if window.count >= limiter.limit {
+			return false, window.start.Add(limiter.window).Sub(now)
+		}
+		window.count++
+		return true, 0
+	}
+
+	if limiter.order.Len() >= limiter.maxClients {
+		limiter.remove(limiter.order.Front())
+	}
+	limiter.windows[key] = limiter.order.PushBack(&rateWindow{key: key, start: now, count: 1})
+	return true, 0
+}
+
+// sweep drops the expired windows, which are all at the front, so clients that went away don't keep using memory.
+func (limiter *rateLimiter) sweep(now time.Time) {
+	for element := limiter.order.Front(); element != nil; element = limiter.order.Front() {
+		if now.Sub(element.Value.(*rateWindow).start) < limiter.window {
+			return
+		}
+		limiter.remove(element)
+	}
+}
+
+// remove stops tracking the client of a window.
+func (limiter *rateLimiter) remove(element *list.Element) {
+	delete(limiter.windows, element.Value.(*rateWindow).key)
+	limiter.order.Remove(element)
+}
+
+// rateLimitMiddleware rejects requests from a client IP over the limiter's limit with 429 and a Retry-After
+// header in whole seconds. The client IP is the address of the connection, see setupRouter.
+func rateLimitMiddleware(limiter *rateLimiter) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		allowed, retryAfter := limiter.allow(ctx.ClientIP())
+		if !allowed {
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			apierror.Respond(ctx, apierror.TooManyRequests("too many requests; try again later"))
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/token"
+)
+
+// searchUsersRequest holds the query parameters for GET /users/search.
+type searchUsersRequest struct {
+	Q     string `form:"q" binding:"required,max=200"`
+	Limit int32  `form:"limit" binding:"omitempty,min=1,max=50"`
+}
+
+// defaultSearchLimit is the number of results returned when the request does not set ?limit=.
+const defaultSearchLimit = 20
+
+// searchUserItemResponse is one search hit.
+// Highlights holds the fields that matched, HTML-escaped, with each matching word wrapped in <mark></mark>.
+type searchUserItemResponse struct {
+	listUserItemResponse
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+type searchUsersResponse struct {
+	Users []searchUserItemResponse `json:"users"`
+}
+
+// SearchUsers handles GET /users/search?q= to find users by name, email, business, or location, best match first.
+// Matching tolerates typos and partial words, except in first and last names when profile fields are encrypted,
+// which only match whole words exactly. Admin only: business_name is not an organization boundary, since users
+// set it on themselves, so there is no organization to limit other callers to.
+// Returns 400 for a missing query, 403 for non-admins, 500 for server errors, 200 for success.
+func (server *Server) SearchUsers(ctx *gin.Context) {
+	var req searchUsersRequest
+
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if authPayload.RoleID != 3 {
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to search users"))
+		return
+	}
+
+	arg := db.UserDirectorySearchParams{
+		Terms: db.SearchTerms(req.Q),
+		Limit: req.Limit,
+	}
+	if arg.Limit == 0 {
+		arg.Limit = defaultSearchLimit
+	}
+
+	rows, err := server.store.SearchUserDirectoryTx(ctx, arg)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	rsp := searchUsersResponse{Users: make([]searchUserItemResponse, 0, len(rows))}
+	for _, row := range rows {
+		rsp.Users = append(rsp.Users, searchUserItemResponse{
+			listUserItemResponse: listUserItemResponse{
+				userResponse: newUserResponse(row.User),
+				FirstName:    row.FirstName.String,
+				LastName:     row.LastName.String,
+				BusinessName: row.BusinessName.String,
+				City:         row.City.String,
+				State:        row.State.String,
+				CountryCode:  row.CountryCode.String,
+				RoleID:       row.RoleID.Int32,
+				Attributes:   row.Attributes,
+			},
+			Rank:       row.Rank,
+			Highlights: searchHighlights(row.UserListRow, arg.Terms),
+		})
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// searchHighlights returns the highlighted form of every searched field of a row that contains a matching word.
+func searchHighlights(row db.UserListRow, terms []string) map[string]string {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"user_name", row.User.UserName},
+		{"email", row.User.Email},
+		{"first_name", row.FirstName.String},
+		{"last_name", row.LastName.String},
+		{"business_name", row.BusinessName.String},
+		{"city", row.City.String},
+		{"state", row.State.String},
+	}
+
+	highlights := map[string]string{}
+	for _, field := range fields {
+		if highlighted, ok := highlight(field.value, terms); ok {
+			highlights[field.name] = highlighted
+		}
+	}
+	return highlights
+}
+
+// highlight HTML-escapes text and wraps each word that matches one of the terms in <mark></mark>.
+// Words are runs of letters and digits, the same way db.SearchTerms splits a query.
+// Returns the highlighted text and whether any word matched.
+func highlight(text string, terms []string) (string, bool) {
+	var b strings.Builder
+	matched := false
+
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		end := start
+		isWord := unicode.IsLetter(runes[start]) || unicode.IsDigit(runes[start])
+		for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) == isWord {
+			end++
+		}
+
+		part := string(runes[start:end])
+		if isWord && matchesSearchTerm(strings.ToLower(part), terms) {
+			matched = true
+			b.WriteString("<mark>" + html.EscapeString(part) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(part))
+		}
+		start = end
+	}
+
+	return b.String(), matched
+}
+
+// matchesSearchTerm reports whether a lower-case word starts with one of the terms, or is a close misspelling of it.
+// Terms of four or more characters allow one edit, and one more for every further four characters.
+func matchesSearchTerm(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+		if allowed := len([]rune(term)) / 4; allowed > 0 && editDistance(word, term) <= allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance returns the optimal string alignment distance between two strings, counting runes.
+// It is the Levenshtein distance, except that swapping two adjacent characters ("jonh") counts as one edit.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+// searchTestStore returns a fixed hit for every search, and records the last search it was given.
+type searchTestStore struct {
+	db.Store
+	profiles map[uuid.UUID]db.UserProfile
+	arg      db.UserDirectorySearchParams
+}
+
+func (s *searchTestStore) GetUserProfile(_ context.Context, userID uuid.UUID) (db.UserProfile, error) {
+	profile, ok := s.profiles[userID]
+	if !ok {
+		return db.UserProfile{}, sql.ErrNoRows
+	}
+	return profile, nil
+}
+
+func (s *searchTestStore) SearchUserDirectoryTx(_ context.Context, arg db.UserDirectorySearchParams) ([]db.UserDirectoryRow, error) {
+	s.arg = arg
+	return []db.UserDirectoryRow{{
+		UserListRow: db.UserListRow{
+			User:         db.User{ID: util.RandomUUID(), UserName: "jsmith", Email: "john.smith@example.com"},
+			FirstName:    sql.NullString{String: "John", Valid: true},
+			LastName:     sql.NullString{String: "Smith", Valid: true},
+			BusinessName: sql.NullString{String: "Smith & Sons", Valid: true},
+		},
+		Rank: 1.5,
+	}}, nil
+}
+
+func TestSearchUsers(t *testing.T) {
+	member := util.RandomUUID()
+
+	testCases := []struct {
+		name          string
+		query         string
+		userID        uuid.UUID
+		role          int
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, arg db.UserDirectorySearchParams)
+	}{
+		{
+			name:   "AdminSearchesEveryone",
+			query:  "?q=Jonh+smit",
+			userID: util.RandomUUID(),
+			role:   3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, arg db.UserDirectorySearchParams) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, []string{"jonh", "smit"}, arg.Terms)
+				require.Empty(t, arg.BusinessName)
+				require.Equal(t, int32(defaultSearchLimit), arg.Limit)
+
+				var rsp searchUsersResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+				require.Len(t, rsp.Users, 1)
+				require.Equal(t, 1.5, rsp.Users[0].Rank)
+				require.Equal(t, "<mark>John</mark>", rsp.Users[0].Highlights["first_name"])
+				require.Equal(t, "<mark>john</mark>.<mark>smith</mark>@example.com", rsp.Users[0].Highlights["email"])
+				require.Equal(t, "<mark>Smith</mark> &amp; Sons", rsp.Users[0].Highlights["business_name"])
+				require.NotContains(t, rsp.Users[0].Highlights, "user_name")
+			},
+		}, {
+			name:   "NotAdmin",
+			query:  "?q=smith&limit=5",
+			userID: member,
+			role:   1,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, arg db.UserDirectorySearchParams) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				require.Empty(t, arg.Terms)
+			},
+		}, {
+			name:   "MissingQuery",
+			query:  "",
+			userID: util.RandomUUID(),
+			role:   3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, _ db.UserDirectorySearchParams) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		}, {
+			name:   "LimitTooLarge",
+			query:  "?q=smith&limit=500",
+			userID: util.RandomUUID(),
+			role:   3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, _ db.UserDirectorySearchParams) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			store := &searchTestStore{profiles: map[uuid.UUID]db.UserProfile{
+				member: {UserID: member, BusinessName: "Smith & Sons"},
+			}}
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/users/search"+tc.query, nil)
+			require.NoError(t, err)
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, tc.userID, tc.role, time.Minute)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, store.arg)
+		})
+	}
+}
+
+func TestSearchUsersOwnBusinessName(t *testing.T) {
+	// Users set business_name on themselves, so taking another organization's name must not reveal its users.
+	member := util.RandomUUID()
+	store := &searchTestStore{profiles: map[uuid.UUID]db.UserProfile{
+		member: {UserID: member, BusinessName: "Smith & Sons"},
+	}}
+	server := newTestServer(t, store)
+
+	for _, businessName := range []string{"Whale Watchers", "Smith & Sons"} {
+		store.profiles[member] = db.UserProfile{UserID: member, BusinessName: businessName}
+
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/users/search?q=smith", nil)
+		require.NoError(t, err)
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, member, 1, time.Minute)
+
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusForbidden, recorder.Code)
+		require.NotContains(t, recorder.Body.String(), "john.smith@example.com")
+		require.Empty(t, store.arg.Terms)
+	}
+}
+
+func TestSearchUsersUnauthorized(t *testing.T) {
+	// Search shares the GET /users/:id route with the public name check, so it checks the token itself.
+	server := newTestServer(t, &searchTestStore{})
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest(http.MethodGet, "/users/search?q=smith", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestHighlight(t *testing.T) {
+	highlighted, ok := highlight("<b>Jon</b> Smyth", []string{"smith"})
+	require.True(t, ok)
+	require.Equal(t, "&lt;b&gt;Jon&lt;/b&gt; <mark>Smyth</mark>", highlighted)
+
+	_, ok = highlight("Seattle", []string{"smith"})
+	require.False(t, ok)
+}
+
+func TestEditDistance(t *testing.T) {
+	require.Equal(t, 0, editDistance("smith", "smith"))
+	require.Equal(t, 1, editDistance("smith", "smyth"))
+	require.Equal(t, 1, editDistance("john", "jonh"))
+	require.Equal(t, 3, editDistance("", "abc"))
+}
@@ -1,36 +1,93 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync"
+	"time"
+	"whaleWake/blobstore"
 	db "whaleWake/db/sqlc"
+	"whaleWake/events"
+	"whaleWake/mail"
+	"whaleWake/sms"
 	"whaleWake/token"
 	"whaleWake/util"
 )
 
+// errStoreNotInitialized is reported when a handler runs without a database store.
+var errStoreNotInitialized = errors.New("store not initialized")
+
 // Server serves HTTP requests for the application.
 type Server struct {
-	config     util.Config // Configuration settings for the server.
-	store      db.Store    // Database store for executing queries.
-	tokenMaker token.Maker // Token maker for generating and validating tokens.
-	router     *gin.Engine // HTTP router for handling API routes.
+	config     util.Config     // Configuration settings for the server.
+	store      db.Store        // Database store for executing queries.
+	tokenMaker token.Maker     // Token maker for generating and validating tokens.
+	smsSender  sms.Sender      // Sends phone verification codes.
+	mailSender mail.Sender     // Sends email change confirmations and notices.
+	blobs      blobstore.Store // Stores avatars and documents.
+	eventHub   *events.Hub     // Broadcasts committed user events to event streams.
+	router     *gin.Engine     // HTTP router for handling API routes.
+	httpServer *http.Server    // Serves the router once started.
+
+	jobsCtx  context.Context    // The context background import jobs run under.
+	stopJobs context.CancelFunc // Cancels jobsCtx.
+	jobs     sync.WaitGroup     // Counts the running background import jobs.
+}
+
+// ServerOption configures optional parts of a Server.
+type ServerOption func(*Server)
+
+// WithEventHub streams the events broadcast to hub on GET /events/stream. Without it, streams only send the
+// events a client missed.
+func WithEventHub(hub *events.Hub) ServerOption {
+	return func(server *Server) {
+		server.eventHub = hub
+	}
 }
 
 // NewServer creates a new Server instance and sets up the routes.
 // Parameters:
 // - store: A pointer to the db.Store instance for database operations.
+// - options: Optional settings, such as WithEventHub.
 // Returns:
 // - A pointer to the newly created Server instance.
-func NewServer(config util.Config, store db.Store) (*Server, error) {
+func NewServer(config util.Config, store db.Store, options ...ServerOption) (*Server, error) {
 	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create token maker: %w", err)
 	}
 
+	smsSender, err := sms.NewSender(config.SMSSender, config.SMSFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SMS sender: %w", err)
+	}
+
+	mailSender, err := mail.NewSender(config.MailSender, config.MailFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mail sender: %w", err)
+	}
+
+	blobs, err := blobstore.NewFromConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob store: %w", err)
+	}
+
 	server := &Server{
 		config:     config,
 		store:      store,
 		tokenMaker: tokenMaker,
+		smsSender:  smsSender,
+		mailSender: mailSender,
+		blobs:      blobs,
+		eventHub:   events.NewHub(config.EventStreamBuffer),
+		httpServer: &http.Server{},
+	}
+	server.jobsCtx, server.stopJobs = context.WithCancel(context.Background())
+	for _, option := range options {
+		option(server)
 	}
 
 	server.setupRouter()
@@ -40,45 +97,152 @@ func NewServer(config util.Config, store db.Store) (*Server, error) {
 }
 
 func (server *Server) setupRouter() {
+	registerValidators()
+
 	router := gin.Default()
+	// The client IP keys rate limits and is recorded in the audit log, so it is taken from the connection.
+	// X-Forwarded-For is set by the client and would let it pick any IP.
+	router.ForwardedByClientIP = false
+	router.Use(requestIDMiddleware())
+	idempotent := idempotencyMiddleware(server.store, server.config.IdempotencyKeyTTL)
+
 	// Basic User Routes
-	router.POST("/users", server.CreateUser)      // Create a new user.
-	router.POST("/users/login", server.LoginUser) // User login route.
+	router.POST("/users", idempotent, server.CreateUser) // Create a new user. Honors Idempotency-Key.
+	router.POST("/users/login", server.LoginUser)        // User login route.
+
+	// GET /users/:id is the authorized user lookup, except for the names in userRoutes: the public, rate limited
+	// GET /users/available and the admin GET /users/search and /users/export. The router can't register these
+	// routes side by side, so one handler dispatches on the id.
+	userNameCheckLimit := rateLimitMiddleware(newRateLimiter(server.config.UserNameCheckLimit, time.Minute))
+	auth := authMiddleware(server.tokenMaker)
+	router.GET("/users/:id", getUserRoute(
+		server.userRoutes(userNameCheckLimit, auth),
+		userRoute{middlewares: []gin.HandlerFunc{auth}, handler: server.GetUser},
+	))
 
 	// User Transaction (TX) Routes
-	router.POST("/usertx", server.CreateUserTx) // Create a user transaction.
+	router.POST("/usertx", idempotent, server.CreateUserTx) // Create a user transaction. Honors Idempotency-Key.
+
+	// Email Change Routes
+	// Public: the token from the emailed link is the credential.
+	router.POST("/email-changes/confirm", server.ConfirmEmailChange) // Apply a pending email change with the token sent to the new address.
+	router.POST("/email-changes/revert", server.RevertEmailChange)   // Cancel or undo an email change with the token sent to the old address.
 
 	// Authorized routes only.
-	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker))
+	authRoutes := router.Group("/").Use(auth)
 
 	// Basic User Routes
-	authRoutes.GET("/users/:id", server.GetUser)       // Retrieve a user by ID. 1 Authed for self only. Admin all.
 	authRoutes.GET("/users", server.ListUser)          // List all users. Admin only.
-	authRoutes.DELETE("/users/:id", server.DeleteUser) // Delete a user by ID. Authorized Route. Admin only.
+	authRoutes.DELETE("/users/:id", server.DeleteUser) // Soft delete a user by ID. Authorized Route. Admin only.
 	authRoutes.PUT("/users", server.UpdateUser)        // Update user details. Authed for self only. Admin all.
 
+	// User Directory Routes
+	// Served by the GET /users/:id route above:
+	// GET /users/search: Ranked, typo-tolerant search. Admin only.
+	// GET /users/export: Stream users matching the list filters as ?format=csv, ndjson, or xlsx. Admin only.
+
 	// User Transaction (TX) Routes
-	authRoutes.GET("/usertx/:id", server.GetUserTx)       // Retrieve user transactions. 1 Authed for self only. Admin all.
-	authRoutes.DELETE("/usertx/:id", server.DeleteUserTx) // Delete user transactions. Admin only.
-	authRoutes.PUT("/usertx", server.UpdateUserTx)        // Update user transactions. Authed for self only. Admin all.
+	// Every subresource of a user lives under /usertx/:id, next to the user with profile and role. /users/:id can't
+	// hold them: the router cannot register POST /users/:id/... next to POST /users/login and /users/import.
+	authRoutes.GET("/usertx/:id", server.GetUserTx)                // Retrieve user transactions, optionally ?as_of= a past time. 1 Authed for self only. Admin all.
+	authRoutes.GET("/usertx/:id/history", server.GetUserTxHistory) // Every recorded version of a user, profile, and role. 1 Authed for self only. Admin all.
+	authRoutes.DELETE("/usertx/:id", server.DeleteUserTx)          // Delete user transactions. Admin only.
+	authRoutes.POST("/usertx/:id/restore", server.RestoreUserTx)   // Restore a soft deleted user with profile and role. Admin only.
+	authRoutes.PUT("/usertx", server.UpdateUserTx)                 // Update user transactions. Authed for self only. Admin all.
+
+	// User Address Routes
+	authRoutes.GET("/usertx/:id/addresses", server.ListUserAddresses)                // A user's addresses, default first. Authed for self only. Admin all.
+	authRoutes.POST("/usertx/:id/addresses", server.CreateUserAddress)               // Add an address, optionally as the new default. Authed for self only. Admin all.
+	authRoutes.GET("/usertx/:id/addresses/:address_id", server.GetUserAddress)       // Retrieve an address and its ETag. Authed for self only. Admin all.
+	authRoutes.PUT("/usertx/:id/addresses/:address_id", server.UpdateUserAddress)    // Replace an address. Honors If-Match. Authed for self only. Admin all.
+	authRoutes.DELETE("/usertx/:id/addresses/:address_id", server.DeleteUserAddress) // Delete a non-default address. Honors If-Match. Authed for self only. Admin all.
+
+	// User Phone Routes
+	authRoutes.PUT("/usertx/:id/phone", server.SetUserPhone)                                   // Set the profile's phone number; a new number is unverified. Authed for self only. Admin all.
+	authRoutes.DELETE("/usertx/:id/phone", server.DeleteUserPhone)                             // Remove the profile's phone number. Authed for self only. Admin all.
+	authRoutes.POST("/usertx/:id/phone/verification", server.StartPhoneVerification)           // Text a verification code to the phone number. Authed for self only. Admin all.
+	authRoutes.POST("/usertx/:id/phone/verification/confirm", server.ConfirmPhoneVerification) // Confirm the code and mark the number verified. Authed for self only.
+
+	// User Avatar Routes
+	authRoutes.PUT("/usertx/:id/avatar", server.SetUserAvatar)       // Upload a PNG, JPEG, or GIF avatar as the request body; thumbnails are generated. Authed for self only. Admin all.
+	authRoutes.GET("/usertx/:id/avatar", server.GetUserAvatar)       // Download the avatar, or ?size=64 or 256 for a thumbnail. Authed for self only. Admin all.
+	authRoutes.DELETE("/usertx/:id/avatar", server.DeleteUserAvatar) // Remove the avatar. Authed for self only. Admin all.
+
+	// User Settings Routes
+	authRoutes.GET("/usertx/:id/settings", server.GetUserSettings) // Every setting with defaults filled in. Authed for self only. Admin all.
+	authRoutes.PUT("/usertx/:id/settings", server.SetUserSettings) // Change some settings; null resets one to its default. Authed for self only. Admin all.
+
+	// Custom Attribute Routes
+	authRoutes.GET("/attributes", server.ListAttributeDefinitions)         // Every custom attribute definition, by key. Authed.
+	authRoutes.POST("/attributes", server.CreateAttributeDefinition)       // Define a custom attribute with its type and rules. Admin only.
+	authRoutes.PUT("/attributes/:id", server.UpdateAttributeDefinition)    // Change an attribute's label and rules; key and type are fixed. Admin only.
+	authRoutes.DELETE("/attributes/:id", server.DeleteAttributeDefinition) // Delete an attribute and every user's value of it. Admin only.
+
+	// User Document Routes
+	authRoutes.GET("/usertx/:id/documents", server.ListUserDocuments)                  // A user's documents, oldest first. Authed for self only. Admin all.
+	authRoutes.POST("/usertx/:id/documents", server.CreateUserDocument)                // Upload a PDF, image, or text file as multipart field "file". Authed for self only. Admin all.
+	authRoutes.GET("/usertx/:id/documents/:document_id", server.GetUserDocument)       // Download a document. Authed for self only. Admin all.
+	authRoutes.DELETE("/usertx/:id/documents/:document_id", server.DeleteUserDocument) // Delete a document. Authed for self only. Admin all.
+
+	// Import Routes
+	authRoutes.POST("/users/import", server.ImportUsers) // Bulk create users from CSV or NDJSON, optionally ?dry_run=true. Admin only.
+	authRoutes.GET("/imports/:id", server.GetImportJob)  // Progress and report of a background import. Admin only.
+
+	// Personal Data Routes
+	// The caller's own data, not a subresource of /usertx/:id: the export keeps the /users/me/export path, the rest is under /me.
+	authRoutes.GET("/users/:id/export", server.exportMyDataRoute) // GET /users/me/export: everything stored about the caller, as ?format=json or zip. Self only.
+	authRoutes.POST("/me/erasure", server.RequestErasure)         // Schedule erasure of the caller's personal data after a cool-down. Self only.
+	authRoutes.GET("/me/erasure", server.GetErasureRequest)       // The caller's pending erasure. Self only.
+	authRoutes.DELETE("/me/erasure", server.CancelErasureRequest) // Cancel the caller's pending erasure. Self only.
+
+	// Audit Routes
+	authRoutes.GET("/audit", server.ListAuditEvents) // Filterable audit log of user, profile, and role changes. Admin only.
+
+	// Event Routes
+	authRoutes.GET("/events/stream", server.StreamEvents) // Server-Sent Events of user changes, resumable with Last-Event-ID. Own events only. Admin all.
+
+	// Webhook Routes
+	authRoutes.GET("/webhooks", server.ListWebhookSubscriptions)                                        // Every webhook subscription. Admin only.
+	authRoutes.POST("/webhooks", server.CreateWebhookSubscription)                                      // Subscribe a URL to event types; the secret is only shown here. Admin only.
+	authRoutes.GET("/webhooks/:id", server.GetWebhookSubscription)                                      // Retrieve a subscription. Admin only.
+	authRoutes.PUT("/webhooks/:id", server.UpdateWebhookSubscription)                                   // Replace a subscription, optionally rotating its secret. Admin only.
+	authRoutes.DELETE("/webhooks/:id", server.DeleteWebhookSubscription)                                // Delete a subscription and its deliveries. Admin only.
+	authRoutes.GET("/webhooks/:id/deliveries", server.ListWebhookDeliveries)                            // Delivery log, newest first, optionally ?status=dead. Admin only.
+	authRoutes.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", server.RedeliverWebhookDelivery) // Send a delivery again with fresh attempts. Admin only.
 
 	server.router = router
 }
 
-// Start runs the HTTP server on the specified address.
+// Start runs the HTTP server on the specified address until Shutdown is called.
 // Parameters:
 // - address: The address (host:port) to bind the server to.
 // Returns:
-// - An error if the server fails to start.
+// - http.ErrServerClosed after Shutdown, or an error if the server fails to start.
 func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+	server.httpServer.Addr = address
+	server.httpServer.Handler = server.router
+	return server.httpServer.ListenAndServe()
 }
 
-// errorResponse formats an error message as a JSON response.
+// Shutdown stops the server: it stops accepting connections, waits for the requests in progress, then stops the
+// background import jobs and waits for them to save how far they got.
 // Parameters:
-// - err: The error to be formatted.
+// - ctx: Bounds the wait; when it is done, Shutdown returns without waiting any longer.
 // Returns:
-// - A gin.H map containing the error message.
-func errorResponse(err error) gin.H {
-	return gin.H{"error": err.Error()}
+// - ctx's error if the requests or jobs did not finish in time.
+func (server *Server) Shutdown(ctx context.Context) error {
+	err := server.httpServer.Shutdown(ctx)
+	server.stopJobs()
+
+	stopped := make(chan struct{})
+	go func() {
+		server.jobs.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/settings"
+)
+
+// setUserSettingsRequest defines the payload for changing settings.
+// Fields:
+// - Settings: Setting keys and their new values. A null value resets the setting to its default; settings that
+// are not listed keep their current value.
+type setUserSettingsRequest struct {
+	Settings map[string]json.RawMessage `json:"settings" binding:"required"`
+}
+
+// userSettingsResponse holds the effective value of every setting.
+// Fields:
+// - Settings: Every registered setting, with the user's value or the default.
+// - Customized: The keys the user has set, sorted; the others have their default value.
+type userSettingsResponse struct {
+	Settings   map[string]json.RawMessage `json:"settings"`
+	Customized []string                   `json:"customized"`
+}
+
+func newUserSettingsResponse(registry *settings.Registry, userSettings []db.UserSetting) userSettingsResponse {
+	stored := make(map[string]json.RawMessage, len(userSettings))
+	customized := make([]string, 0, len(userSettings))
+	for _, setting := range userSettings {
+		if _, ok := registry.Lookup(setting.Key); !ok {
+			continue
+		}
+		stored[setting.Key] = setting.Value
+		customized = append(customized, setting.Key)
+	}
+
+	return userSettingsResponse{
+		Settings:   registry.Resolve(stored),
+		Customized: customized,
+	}
+}
+
+// settingsOwner parses the user id of a settings route and checks the caller may manage that user's settings.
+// The error has already been sent when ok is false.
+func (server *Server) settingsOwner(ctx *gin.Context) (db.User, bool) {
+	userID, ok := server.selfOrAdmin(ctx, "You are not authorized to manage this user's settings")
+	if !ok {
+		return db.User{}, false
+	}
+
+	user, err := server.store.GetUser(ctx, userID)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return db.User{}, false
+	}
+	return user, true
+}
+
+// GetUserSettings handles GET /usertx/:id/settings to read every setting of a user, with defaults filled in.
+// Returns 400 for a bad UUID, 403 for other users unless admin, 404 if the user does not exist, 500 for server errors, 200 for success.
+func (server *Server) GetUserSettings(ctx *gin.Context) {
+	user, ok := server.settingsOwner(ctx)
+	if !ok {
+		return
+	}
+
+	userSettings, err := server.store.ListUserSettings(ctx, user.ID)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserSettingsResponse(settings.Builtin, userSettings))
+}
+
+// SetUserSettings handles PUT /usertx/:id/settings to change some of a user's settings.
+// Every value is checked against the schema of its setting; nothing is stored unless all of them are valid.
+// Returns 400 for bad input, unknown settings, or invalid values, 403 for other users unless admin, 404 if the user does not exist, 500 for server errors, 200 with every setting.
+func (server *Server) SetUserSettings(ctx *gin.Context) {
+	var req setUserSettingsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	user, ok := server.settingsOwner(ctx)
+	if !ok {
+		return
+	}
+
+	values, err := settings.Builtin.Validate(req.Settings)
+	if err != nil {
+		apierror.Respond(ctx, settingsError(err))
+		return
+	}
+
+	userSettings, err := server.store.SetUserSettingsTx(auditContext(ctx), db.SetUserSettingsParams{
+		UserID: user.ID,
+		Values: values,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = apierror.NotFound("user not found")
+		}
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserSettingsResponse(settings.Builtin, userSettings))
+}
+
+// settingsError turns the errors of settings.Registry.Validate into a validation_failed error with one field
+// error per setting, named settings.<key>.
+func settingsError(err error) error {
+	var settingsErrs settings.Errors
+	if !errors.As(err, &settingsErrs) {
+		return err
+	}
+
+	apiErr := apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "request failed validation")
+	apiErr.Err = err
+	for _, fieldErr := range settingsErrs {
+		apiErr.WithFields(apierror.FieldError{Field: "settings." + fieldErr.Key, Code: fieldErr.Code, Message: fieldErr.Message})
+	}
+	return apiErr
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+// settingsTestStore keeps the stored settings of one user.
+type settingsTestStore struct {
+	db.Store
+	user   db.User
+	values map[string]json.RawMessage
+}
+
+func (s *settingsTestStore) GetUser(_ context.Context, id uuid.UUID) (db.User, error) {
+	if id != s.user.ID {
+		return db.User{}, sql.ErrNoRows
+	}
+	return s.user, nil
+}
+
+func (s *settingsTestStore) ListUserSettings(_ context.Context, userID uuid.UUID) ([]db.UserSetting, error) {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	userSettings := []db.UserSetting{}
+	for _, key := range keys {
+		userSettings = append(userSettings, db.UserSetting{UserID: userID, Key: key, Value: s.values[key]})
+	}
+	return userSettings, nil
+}
+
+func (s *settingsTestStore) SetUserSettingsTx(ctx context.Context, arg db.SetUserSettingsParams) ([]db.UserSetting, error) {
+	for key, value := range arg.Values {
+		if value == nil {
+			delete(s.values, key)
+		} else {
+			s.values[key] = value
+		}
+	}
+	return s.ListUserSettings(ctx, arg.UserID)
+}
+
+func TestUserSettings(t *testing.T) {
+	userID := util.RandomUUID()
+	store := &settingsTestStore{user: db.User{ID: userID}, values: map[string]json.RawMessage{}}
+	server := newTestServer(t, store)
+
+	send := func(method string, id uuid.UUID, body string, callerID uuid.UUID, role int) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(method, "/usertx/"+id.String()+"/settings", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, callerID, role, time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	decode := func(recorder *httptest.ResponseRecorder) userSettingsResponse {
+		var response userSettingsResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		return response
+	}
+
+	// Defaults until anything is set.
+	recorder := send(http.MethodGet, userID, "", userID, 1)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	response := decode(recorder)
+	require.JSONEq(t, `"en-US"`, string(response.Settings["locale"]))
+	require.JSONEq(t, `true`, string(response.Settings["notifications.email"]))
+	require.Empty(t, response.Customized)
+
+	recorder = send(http.MethodPut, userID, `{"settings": {"locale": "fr-FR", "timezone": "Europe/Paris", "notifications.email": false}}`, userID, 1)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	response = decode(recorder)
+	require.JSONEq(t, `"fr-FR"`, string(response.Settings["locale"]))
+	require.JSONEq(t, `false`, string(response.Settings["notifications.email"]))
+	require.Equal(t, []string{"locale", "notifications.email", "timezone"}, response.Customized)
+
+	// Nothing is stored when any value is invalid.
+	recorder = send(http.MethodPut, userID, `{"settings": {"units": "furlongs", "colour": "red", "theme": "dark"}}`, userID, 1)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"field":"settings.units"`)
+	require.Contains(t, recorder.Body.String(), `"field":"settings.colour"`)
+	require.NotContains(t, store.values, "theme")
+
+	require.Equal(t, http.StatusBadRequest, send(http.MethodPut, userID, `{}`, userID, 1).Code)
+
+	// null resets a setting; others are left alone.
+	recorder = send(http.MethodPut, userID, `{"settings": {"locale": null}}`, util.RandomUUID(), 3)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	response = decode(recorder)
+	require.JSONEq(t, `"en-US"`, string(response.Settings["locale"]))
+	require.JSONEq(t, `"Europe/Paris"`, string(response.Settings["timezone"]))
+	require.Equal(t, []string{"notifications.email", "timezone"}, response.Customized)
+
+	require.Equal(t, http.StatusForbidden, send(http.MethodGet, userID, "", util.RandomUUID(), 1).Code)
+	require.Equal(t, http.StatusForbidden, send(http.MethodPut, userID, `{"settings": {"theme": "dark"}}`, util.RandomUUID(), 1).Code)
+	require.Equal(t, http.StatusNotFound, send(http.MethodGet, util.RandomUUID(), "", util.RandomUUID(), 3).Code)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+)
+
+// thumbnail crops the centre square of img and scales it to size by size pixels.
+// Each thumbnail pixel is the average of the source pixels it covers, so downscaled images stay smooth
+// without an external imaging library. Smaller images are scaled up by repeating pixels.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	left := bounds.Min.X + (bounds.Dx()-side)/2
+	top := bounds.Min.Y + (bounds.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for dy := 0; dy < size; dy++ {
+		y0, y1 := thumbnailSpan(top, side, size, dy)
+		for dx := 0; dx < size; dx++ {
+			x0, x1 := thumbnailSpan(left, side, size, dx)
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := img.At(x, y).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			i := dst.PixOffset(dx, dy)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(b / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+// thumbnailSpan returns the source pixels [from, to) covered by thumbnail pixel i, always at least one.
+func thumbnailSpan(start, side, size, i int) (int, int) {
+	from := start + i*side/size
+	to := start + (i+1)*side/size
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
+
+// encodePNG encodes img as a PNG.
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -2,10 +2,13 @@ package api
 
 import (
 	"database/sql"
-	"errors"
+	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"net/http"
+	"strings"
+	"time"
+	"whaleWake/apierror"
 	db "whaleWake/db/sqlc"
 	"whaleWake/token"
 	"whaleWake/util"
@@ -13,22 +16,23 @@ import (
 
 // createUserRequest defines the payload for creating a new user.
 // Fields:
-// - UserName: required username.
+// - UserName: required, 3-30 letters, digits, dots, dashes, or underscores and not reserved.
 // - Email: required, must be a valid email.
 // - Password: required, 8-32 characters.
 type createUserRequest struct {
-	UserName string `json:"user_name" binding:"required"`
+	UserName string `json:"user_name" binding:"required,username,unreserved"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8,max=32"`
 }
 
 type userResponse struct {
-	ID         uuid.UUID `json:"id"`
-	UserName   string    `json:"user_name"`
-	Email      string    `json:"email"`
-	CreatedAt  string    `json:"created_at"`
-	UpdatedAt  string    `json:"updated_at"`
-	VerifiedAt string    `json:"verified_at"`
+	ID           uuid.UUID `json:"id"`
+	UserName     string    `json:"user_name"`
+	Email        string    `json:"email"`
+	PendingEmail string    `json:"pending_email,omitempty"`
+	CreatedAt    string    `json:"created_at"`
+	UpdatedAt    string    `json:"updated_at"`
+	VerifiedAt   string    `json:"verified_at"`
 }
 
 func newUserResponse(user db.User) userResponse {
@@ -43,24 +47,24 @@ func newUserResponse(user db.User) userResponse {
 }
 
 // CreateUser handles POST /users to create a new user.
-// Validates input, checks for duplicates, and inserts into the database.
-// Returns 400 for bad input, 500 for server errors, 200 for success.
+// Validates input and inserts into the database; duplicates are caught by the unique indexes on email and user_name.
+// Returns 400 for bad input, 409 if the email or user name is taken, 500 for server errors, 200 for success.
 func (server *Server) CreateUser(ctx *gin.Context) {
 	var req createUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		apierror.Respond(ctx, apierror.FromBinding(err))
 		return
 	}
 
 	if server.store == nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("store not initialized")))
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
 		return
 	}
 
 	hashedPassword, err := util.HashPassword(req.Password)
 
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
@@ -70,27 +74,18 @@ func (server *Server) CreateUser(ctx *gin.Context) {
 		Password: hashedPassword,
 	}
 
-	_, err = server.store.GetUserByEmail(ctx, arg.Email)
-	if err == nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("User already exists")))
-		return
-	}
-
-	user, err := server.store.CreateUser(ctx, arg)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-		return
-	}
-
 	//We're going to give the user a Role off the rip that way we can Auth roles later.
 	userRoleParams := db.CreateUserRoleParams{
-		UserID: user.ID,
 		RoleID: 1,
 	}
 
-	_, err = server.store.CreateUserRole(ctx, userRoleParams)
+	userWithRole, err := server.store.CreateUserWithRoleTx(auditContext(ctx), arg, userRoleParams)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
 
-	userResponse := newUserResponse(user)
+	userResponse := newUserResponse(userWithRole.User)
 
 	ctx.JSON(http.StatusOK, userResponse)
 }
@@ -102,125 +97,243 @@ func (server *Server) GetUser(ctx *gin.Context) {
 	idStr := ctx.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		apierror.Respond(ctx, invalidUUIDError("id", err))
 		return
 	}
 
 	if server.store == nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("store not initialized")))
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
 		return
 	}
 
 	user, err := server.store.GetUser(ctx, id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 
 	if user.ID != authPayload.UserID && authPayload.RoleID != 3 {
-		ctx.JSON(http.StatusForbidden, errorResponse(errors.New("You are not authorized to view this user")))
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to view this user"))
 		return
 	}
 
 	userResponse := newUserResponse(user)
 
+	ctx.Header(etagHeaderKey, userETag(user))
 	ctx.JSON(http.StatusOK, userResponse)
 }
 
-// listUsersRequest defines query parameters for paginated user listing.
+// userFilterRequest defines the query parameters shared by the user list and export.
+// Fields:
+// - RoleID: optional, only users with this role.
+// - Verified: optional, true for verified users and false for unverified ones.
+// - CreatedFrom, CreatedTo: optional RFC 3339 bounds on created_at; from is inclusive, to is exclusive.
+// - CountryCode, State, City, Zip: optional case-insensitive exact matches on the profile.
+// - BusinessName: optional case-insensitive substring match on the profile.
+// - Q: optional case-insensitive substring search across user_name, email, first_name, and last_name.
+// When profile fields are encrypted, first_name and last_name only match Q exactly.
+// - Sort: optional sort field, prefixed with "-" for descending. Defaults to created_at.
+type userFilterRequest struct {
+	RoleID       *int32 `form:"role_id" binding:"omitempty,min=1"`
+	Verified     *bool  `form:"verified"`
+	CreatedFrom  string `form:"created_from" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CreatedTo    string `form:"created_to" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CountryCode  string `form:"country_code" binding:"omitempty,max=3"`
+	State        string `form:"state" binding:"omitempty,max=64"`
+	City         string `form:"city" binding:"omitempty,max=128"`
+	Zip          string `form:"zip" binding:"omitempty,max=16"`
+	BusinessName string `form:"business_name" binding:"omitempty,max=128"`
+	Q            string `form:"q" binding:"omitempty,max=128"`
+	Sort         string `form:"sort" binding:"omitempty,oneof=created_at -created_at updated_at -updated_at user_name -user_name email -email last_name -last_name"`
+}
+
+// filter converts the request into a store filter, without a cursor or limit.
+// The binding rules have already validated the timestamp formats.
+func (req userFilterRequest) filter() db.UserListFilter {
+	sort := req.Sort
+	if sort == "" {
+		sort = db.UserSortCreatedAt
+	}
+
+	filter := db.UserListFilter{
+		CountryCode:  req.CountryCode,
+		State:        req.State,
+		City:         req.City,
+		Zip:          req.Zip,
+		BusinessName: req.BusinessName,
+		Search:       req.Q,
+		Sort:         strings.TrimPrefix(sort, "-"),
+		Desc:         strings.HasPrefix(sort, "-"),
+	}
+	if req.RoleID != nil {
+		filter.RoleID = sql.NullInt32{Int32: *req.RoleID, Valid: true}
+	}
+	if req.Verified != nil {
+		filter.Verified = sql.NullBool{Bool: *req.Verified, Valid: true}
+	}
+	if req.CreatedFrom != "" {
+		createdFrom, _ := time.Parse(time.RFC3339, req.CreatedFrom)
+		filter.CreatedAfter = sql.NullTime{Time: createdFrom, Valid: true}
+	}
+	if req.CreatedTo != "" {
+		createdTo, _ := time.Parse(time.RFC3339, req.CreatedTo)
+		filter.CreatedBefore = sql.NullTime{Time: createdTo, Valid: true}
+	}
+
+	return filter
+}
+
+// listUsersRequest defines query parameters for filtered, paginated user listing.
 // Fields:
-// - PageID: required, >= 1.
-// - PageSize: required, >= 1.
+// - The filters and sort of userFilterRequest.
+// - Cursor: optional next_cursor from the previous page; omit for the first page.
+// - PageSize: required, 1-100.
 type listUsersRequest struct {
-	PageID   int32 `form:"page_id" binding:"required,min=1"`
-	PageSize int32 `form:"page_size" binding:"required,min=1"`
+	userFilterRequest
+	Cursor   string `form:"cursor"`
+	PageSize int32  `form:"page_size" binding:"required,min=1,max=100"`
 }
 
-// ListUser handles GET /users to list users with pagination.
+// listUserItemResponse is a user in a list, with the profile and role fields the list can be filtered on.
+type listUserItemResponse struct {
+	userResponse
+	FirstName    string                     `json:"first_name,omitempty"`
+	LastName     string                     `json:"last_name,omitempty"`
+	BusinessName string                     `json:"business_name,omitempty"`
+	City         string                     `json:"city,omitempty"`
+	State        string                     `json:"state,omitempty"`
+	CountryCode  string                     `json:"country_code,omitempty"`
+	RoleID       int32                      `json:"role_id,omitempty"`
+	Attributes   map[string]json.RawMessage `json:"attributes,omitempty"`
+}
+
+// listUsersResponse is one page of users.
+// Total counts every user matching the filters; NextCursor is empty on the last page.
+type listUsersResponse struct {
+	Users      []listUserItemResponse `json:"users"`
+	Total      int64                  `json:"total"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// ListUser handles GET /users to list users with filters, sorting, and keyset pagination. Admin only.
 // Validates query params and fetches users from the database.
-// Returns 400 for bad params, 500 for server errors, 200 for success.
+// Returns 400 for bad params or cursor, 403 for non-admins, 500 for server errors, 200 for success.
 func (server *Server) ListUser(ctx *gin.Context) {
 	var req listUsersRequest
 
 	if err := ctx.ShouldBindQuery(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		apierror.Respond(ctx, apierror.FromBinding(err))
 		return
 	}
 
 	if server.store == nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("store not initialized")))
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
 		return
 	}
 
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 
 	if authPayload.RoleID != 3 {
-		ctx.JSON(http.StatusForbidden, errorResponse(errors.New("You are not authorized to view these users")))
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to view these users"))
 		return
 	}
 
-	arg := db.ListUsersParams{
-		Limit:  req.PageSize,
-		Offset: (req.PageID - 1) * req.PageSize,
+	if req.Sort == "" {
+		req.Sort = db.UserSortCreatedAt
 	}
 
-	users, err := server.store.ListUsers(ctx, arg)
+	cursor, hasCursor, err := decodeCursor(req.Cursor, req.Sort)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
 
-	var usersResponse []userResponse
-	for _, user := range users {
-		usersResponse = append(usersResponse, userResponse{
-			ID:         user.ID,
-			UserName:   user.UserName,
-			Email:      user.Email,
-			CreatedAt:  user.CreatedAt.Format("2006-01-02 15:04:05"),
-			UpdatedAt:  user.UpdatedAt.Format("2006-01-02 15:04:05"),
-			VerifiedAt: user.VerifiedAt.Time.Format("2006-01-02 15:04:05"),
-		})
+	// Fetch one extra row to find out whether there is another page.
+	filter := req.filter()
+	filter.Limit = req.PageSize + 1
+	if hasCursor {
+		filter.CursorValue = sql.NullString{String: cursor.Value, Valid: true}
+		filter.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
 	}
 
+	result, err := server.store.SearchUsersTx(ctx, filter)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, usersResponse)
+	rows := result.Rows
+	rsp := listUsersResponse{Users: make([]listUserItemResponse, 0, len(rows)), Total: result.Total}
+	if len(rows) > int(req.PageSize) {
+		rows = rows[:req.PageSize]
+		last := rows[len(rows)-1]
+		rsp.NextCursor = encodeCursor(pageCursor{Sort: req.Sort, Value: last.SortValue(filter.Sort), ID: last.User.ID})
+	}
+
+	for _, row := range rows {
+		rsp.Users = append(rsp.Users, listUserItemResponse{
+			userResponse: newUserResponse(row.User),
+			FirstName:    row.FirstName.String,
+			LastName:     row.LastName.String,
+			BusinessName: row.BusinessName.String,
+			City:         row.City.String,
+			State:        row.State.String,
+			CountryCode:  row.CountryCode.String,
+			RoleID:       row.RoleID.Int32,
+			Attributes:   row.Attributes,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
 }
 
 // DeleteUser handles DELETE /users/:id to delete a user by UUID.
-// Validates UUID and deletes user from the database.
-// Returns 400 for bad UUID, 500 for server errors, 200 for success.
+// Validates UUID and soft deletes the user along with any profile and role, so it can be restored until purged.
+// An If-Match header, when present, is enforced by the delete query itself.
+// Returns 400 for bad UUID, 404 if not found, 412 on ETag mismatch, 500 for server errors, 200 for success.
 func (server *Server) DeleteUser(ctx *gin.Context) {
 	idStr := ctx.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		apierror.Respond(ctx, invalidUUIDError("id", err))
 		return
 	}
 
 	if server.store == nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("store not initialized")))
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
 		return
 	}
 
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 
 	if authPayload.RoleID != 3 {
-		ctx.JSON(http.StatusForbidden, errorResponse(errors.New("You are not authorized to delete this user")))
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to delete this user"))
 		return
 	}
 
-	user, err := server.store.DeleteUser(ctx, id)
+	userParams := db.DeleteUserParams{ID: id}
+	if etag, ok := ifMatch(ctx); ok {
+		versions, err := parseETagVersions(etag, 1)
+		if err != nil {
+			apierror.Respond(ctx, apierror.PreconditionFailed(err.Error()))
+			return
+		}
+		userParams.ExpectedVersion = versions[0]
+	}
+
+	userWithProfileAndRole, err := server.store.DeleteUserWithProfileAndRoleTX(auditContext(ctx), userParams, db.DeleteUserProfileParams{}, db.DeleteUserRoleParams{})
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		if err == sql.ErrNoRows {
+			server.updateNotApplied(ctx, id, userParams.ExpectedVersion.Valid)
+			return
+		}
+		apierror.Respond(ctx, err)
+		return
 	}
 
-	userResponse := newUserResponse(user)
+	userResponse := newUserResponse(userWithProfileAndRole.User)
 
 	ctx.JSON(http.StatusOK, userResponse)
 }
@@ -228,40 +341,44 @@ func (server *Server) DeleteUser(ctx *gin.Context) {
 // updateUserRequest defines the payload for updating a user.
 // Fields:
 // - ID: required UUID of the user.
-// - UserName, Email, Password: optional new values.
+// - UserName, Email, Password: optional new values. A new email address waits for confirmation.
 type updateUserRequest struct {
 	ID       uuid.UUID `json:"id" binding:"required"`
-	UserName string    `json:"user_name"`
-	Email    string    `json:"email"`
+	UserName string    `json:"user_name" binding:"omitempty,username,unreserved"`
+	Email    string    `json:"email" binding:"omitempty,email"`
 	Password string    `json:"password"`
 }
 
 // UpdateUser handles PUT /users to update user details.
 // Validates input and updates user in the database.
-// Returns 400 for bad input, 500 for server errors, 200 for success.
+// An If-Match header, when present, is enforced by the update query itself.
+// A new email address is not applied right away: it is reported as pending_email until the link sent to it is
+// used, see ConfirmEmailChange, and the old address is told about the change. The change is recorded in the same
+// transaction as the update, so a taken address leaves the user as it was; the links are mailed after commit.
+// Returns 400 for bad input, 404 if not found, 409 if the email or user name is taken, 412 on ETag mismatch, 500 for server errors, 200 for success.
 func (server *Server) UpdateUser(ctx *gin.Context) {
 	var req updateUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		apierror.Respond(ctx, apierror.FromBinding(err))
 		return
 	}
 
 	if server.store == nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("store not initialized")))
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
 		return
 	}
 
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 
 	if req.ID != authPayload.UserID && authPayload.RoleID != 3 {
-		ctx.JSON(http.StatusForbidden, errorResponse(errors.New("You are not authorized to view this user")))
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to view this user"))
 		return
 	}
 
 	hashedPassword, err := util.HashPassword(req.Password)
 
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
@@ -272,91 +389,157 @@ func (server *Server) UpdateUser(ctx *gin.Context) {
 		Password: hashedPassword,
 	}
 
-	user, err := server.store.UpdateUser(ctx, arg)
+	if etag, ok := ifMatch(ctx); ok {
+		versions, err := parseETagVersions(etag, 1)
+		if err != nil {
+			apierror.Respond(ctx, apierror.PreconditionFailed(err.Error()))
+			return
+		}
+		arg.ExpectedVersion = versions[0]
+	}
+
+	emailChange, err := server.newEmailChangeRequest(req.Email)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
-	userResponse := newUserResponse(user)
+	result, err := server.store.UpdateUserTx(auditContext(ctx), arg, emailChange.storeParams())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			server.updateNotApplied(ctx, req.ID, arg.ExpectedVersion.Valid)
+			return
+		}
+		apierror.Respond(ctx, emailTakenError(err))
+		return
+	}
+
+	userResponse := newUserResponse(result.User)
+
+	if result.EmailChange != nil {
+		server.sendEmailChangeMessages(ctx, result.User, *result.EmailChange, emailChange)
+		userResponse.PendingEmail = result.EmailChange.NewEmail
+	}
 
+	ctx.Header(etagHeaderKey, userETag(result.User))
 	ctx.JSON(http.StatusOK, userResponse)
 }
 
+// updateNotApplied responds to an update or delete that matched no rows.
+// When a version was expected and the user still exists, the row was changed by someone else (412); otherwise it is gone (404).
+func (server *Server) updateNotApplied(ctx *gin.Context, userID uuid.UUID, versionChecked bool) {
+	if versionChecked {
+		_, err := server.store.GetUser(ctx, userID)
+		if err == nil {
+			apierror.Respond(ctx, apierror.PreconditionFailed(errPreconditionFailed.Error()))
+			return
+		}
+		if err != sql.ErrNoRows {
+			apierror.Respond(ctx, err)
+			return
+		}
+	}
+
+	apierror.Respond(ctx, apierror.NotFound("user not found"))
+}
+
 // createUserTxRequest defines the payload for transactional user creation.
 // Includes user, profile, and role fields.
-// All fields are required except for role, which is set internally.
+// All fields are required except for role, which is set internally, and zip, which countries without postal
+// codes leave empty. The address is validated and normalized by normalizeAddress.
 type createUserTxRequest struct {
-	UserName      string `json:"user_name" binding:"required"`
-	Email         string `json:"email" binding:"required,email"`
-	Password      string `json:"password" binding:"required,min=8,max=32"`
-	FirstName     string `json:"first_name" binding:"required"`
-	LastName      string `json:"last_name" binding:"required"`
-	BusinessName  string `json:"business_name" binding:"required"`
-	StreetAddress string `json:"street_address" binding:"required"`
-	City          string `json:"city" binding:"required"`
-	State         string `json:"state" binding:"required"`
-	Zip           string `json:"zip" binding:"required"`
-	CountryCode   string `json:"country_code" binding:"required"`
+	UserName      string                     `json:"user_name" binding:"required,username,unreserved"`
+	Email         string                     `json:"email" binding:"required,email"`
+	Password      string                     `json:"password" binding:"required,min=8,max=32"`
+	FirstName     string                     `json:"first_name" binding:"required"`
+	LastName      string                     `json:"last_name" binding:"required"`
+	BusinessName  string                     `json:"business_name" binding:"required"`
+	StreetAddress string                     `json:"street_address" binding:"required"`
+	City          string                     `json:"city" binding:"required"`
+	State         string                     `json:"state" binding:"required"`
+	Zip           string                     `json:"zip"`
+	CountryCode   string                     `json:"country_code" binding:"required"`
+	Attributes    map[string]json.RawMessage `json:"attributes"`
 }
 
+// createUserTxResponse is a user with their profile and role. The address fields are the user's default
+// address, which the profile mirrors; the other addresses are under /usertx/:id/addresses. The phone number is
+// managed under /usertx/:id/phone. Attributes holds the custom attributes the user has a value for.
 type createUserTxResponse struct {
-	ID            uuid.UUID `json:"id"`
-	UserName      string    `json:"user_name"`
-	Email         string    `json:"email"`
-	FirstName     string    `json:"first_name"`
-	LastName      string    `json:"last_name"`
-	BusinessName  string    `json:"business_name"`
-	StreetAddress string    `json:"street_address"`
-	City          string    `json:"city"`
-	State         string    `json:"state"`
-	Zip           string    `json:"zip"`
-	CountryCode   string    `json:"country_code"`
-	RoleID        int32     `json:"role_id"`
-	CreatedAt     string    `json:"created_at"`
-	UpdatedAt     string    `json:"updated_at"`
-	VerifiedAt    string    `json:"verified_at"`
+	ID              uuid.UUID                  `json:"id"`
+	UserName        string                     `json:"user_name"`
+	Email           string                     `json:"email"`
+	PendingEmail    string                     `json:"pending_email,omitempty"`
+	FirstName       string                     `json:"first_name"`
+	LastName        string                     `json:"last_name"`
+	BusinessName    string                     `json:"business_name"`
+	StreetAddress   string                     `json:"street_address"`
+	City            string                     `json:"city"`
+	State           string                     `json:"state"`
+	Zip             string                     `json:"zip"`
+	CountryCode     string                     `json:"country_code"`
+	PhoneNumber     string                     `json:"phone_number"`
+	PhoneVerifiedAt *string                    `json:"phone_verified_at"`
+	RoleID          int32                      `json:"role_id"`
+	CreatedAt       string                     `json:"created_at"`
+	UpdatedAt       string                     `json:"updated_at"`
+	VerifiedAt      string                     `json:"verified_at"`
+	Attributes      map[string]json.RawMessage `json:"attributes"`
 }
 
 func newUserTXResponse(userWithProfileAndRole db.UserTxResult) createUserTxResponse {
 	return createUserTxResponse{
-		ID:            userWithProfileAndRole.User.ID,
-		UserName:      userWithProfileAndRole.User.UserName,
-		Email:         userWithProfileAndRole.User.Email,
-		FirstName:     userWithProfileAndRole.UserProfile.FirstName,
-		LastName:      userWithProfileAndRole.UserProfile.LastName,
-		BusinessName:  userWithProfileAndRole.UserProfile.BusinessName,
-		StreetAddress: userWithProfileAndRole.UserProfile.StreetAddress,
-		City:          userWithProfileAndRole.UserProfile.City,
-		State:         userWithProfileAndRole.UserProfile.State,
-		Zip:           userWithProfileAndRole.UserProfile.Zip,
-		CountryCode:   userWithProfileAndRole.UserProfile.CountryCode,
-		RoleID:        userWithProfileAndRole.UserRole.RoleID,
-		CreatedAt:     userWithProfileAndRole.User.CreatedAt.Format("2006-01-02 15:04:05"),
-		UpdatedAt:     userWithProfileAndRole.User.UpdatedAt.Format("2006-01-02 15:04:05"),
-		VerifiedAt:    userWithProfileAndRole.User.VerifiedAt.Time.Format("2006-01-02 15:04:05"),
+		ID:              userWithProfileAndRole.User.ID,
+		UserName:        userWithProfileAndRole.User.UserName,
+		Email:           userWithProfileAndRole.User.Email,
+		FirstName:       userWithProfileAndRole.UserProfile.FirstName,
+		LastName:        userWithProfileAndRole.UserProfile.LastName,
+		BusinessName:    userWithProfileAndRole.UserProfile.BusinessName,
+		StreetAddress:   userWithProfileAndRole.UserProfile.StreetAddress,
+		City:            userWithProfileAndRole.UserProfile.City,
+		State:           userWithProfileAndRole.UserProfile.State,
+		Zip:             userWithProfileAndRole.UserProfile.Zip,
+		CountryCode:     userWithProfileAndRole.UserProfile.CountryCode,
+		PhoneNumber:     userWithProfileAndRole.UserProfile.PhoneNumber,
+		PhoneVerifiedAt: historyTime(userWithProfileAndRole.UserProfile.PhoneVerifiedAt),
+		RoleID:          userWithProfileAndRole.UserRole.RoleID,
+		CreatedAt:       userWithProfileAndRole.User.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:       userWithProfileAndRole.User.UpdatedAt.Format("2006-01-02 15:04:05"),
+		VerifiedAt:      userWithProfileAndRole.User.VerifiedAt.Time.Format("2006-01-02 15:04:05"),
+		Attributes:      db.UserAttributeMap(userWithProfileAndRole.Attributes),
 	}
 }
 
 // CreateUserTx handles POST /users/tx for transactional user creation.
 // Creates user, profile, and role in a single transaction.
-// Returns 400 for bad input, 500 for server errors, 200 for success.
+// Returns 400 for bad input, 409 if the email or user name is taken, 500 for server errors, 200 for success.
 func (server *Server) CreateUserTx(ctx *gin.Context) {
 	var req createUserTxRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if err := normalizeAddress(&req.StreetAddress, &req.City, &req.State, &req.Zip, &req.CountryCode); err != nil {
+		apierror.Respond(ctx, err)
 		return
 	}
 
 	if server.store == nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("store not initialized")))
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	attributes, err := server.userAttributeValues(ctx, req.Attributes, true)
+	if err != nil {
+		apierror.Respond(ctx, err)
 		return
 	}
 
 	hashedPassword, err := util.HashPassword(req.Password)
 
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
@@ -381,90 +564,122 @@ func (server *Server) CreateUserTx(ctx *gin.Context) {
 		RoleID: 1,
 	}
 
-	_, err = server.store.GetUserByEmail(ctx, userParams.Email)
-	if err == nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("User already exists")))
-		return
-	}
-
-	userWithProfileAndRole, err := server.store.CreateUserWithProfileAndRoleTx(ctx, userParams, profileParams, roleParams)
+	userWithProfileAndRole, err := server.store.CreateUserWithProfileAndRoleTx(auditContext(ctx), userParams, profileParams, roleParams, attributes...)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
 	userResponse := newUserTXResponse(userWithProfileAndRole)
 
+	ctx.Header(etagHeaderKey, userTxETag(userWithProfileAndRole))
 	ctx.JSON(http.StatusOK, userResponse)
 }
 
-// getUserTxRequest defines the payload for transactional user retrieval.
-// Field:
-// - ID: required UUID of the user.
+// getUserTxRequest defines the optional query parameters for GET /usertx/:id.
+// Fields:
+// - AsOf: optional RFC 3339 timestamp to rebuild the user as they were at that time.
 type getUserTxRequest struct {
-	ID uuid.UUID `json:"id" binding:"required"`
+	AsOf string `form:"as_of" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
 }
 
 // GetUserTx handles GET /users/tx/:id for transactional user retrieval.
-// Fetches user with profile and role in a single transaction.
-// Returns 400 for bad UUID, 500 for server errors, 200 for success.
+// Fetches user with profile and role in a single transaction and returns their combined ETag.
+// With ?as_of= the user is rebuilt from the history tables instead; no ETag is returned since the result cannot be updated.
+// Returns 400 for bad UUID or as_of, 404 if the user did not exist at that time, 500 for server errors, 200 for success.
 func (server *Server) GetUserTx(ctx *gin.Context) {
 	idStr := ctx.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		apierror.Respond(ctx, invalidUUIDError("id", err))
+		return
+	}
+
+	var req getUserTxRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
 		return
 	}
 
 	if server.store == nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("store not initialized")))
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
 		return
 	}
 
-	userWithProfileAndRole, err := server.store.GetUserWithProfileAndRoleTX(ctx, id)
+	var userWithProfileAndRole db.UserTxResult
+	if req.AsOf != "" {
+		// The binding rule above has already validated the format.
+		asOf, _ := time.Parse(time.RFC3339, req.AsOf)
+		userWithProfileAndRole, err = server.store.GetUserWithProfileAndRoleAsOfTx(ctx, id, asOf)
+	} else {
+		userWithProfileAndRole, err = server.store.GetUserWithProfileAndRoleTX(ctx, id)
+	}
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 
 	if userWithProfileAndRole.User.ID != authPayload.UserID && authPayload.RoleID != 3 {
-		ctx.JSON(http.StatusForbidden, errorResponse(errors.New("You are not authorized to view this user")))
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to view this user"))
 		return
 	}
 
 	userResponse := newUserTXResponse(userWithProfileAndRole)
 
+	if req.AsOf == "" {
+		ctx.Header(etagHeaderKey, userTxETag(userWithProfileAndRole))
+	}
 	ctx.JSON(http.StatusOK, userResponse)
 }
 
 // DeleteUserTx handles DELETE /users/tx/:id for transactional user deletion.
-// Validates UUID, checks store initialization, and deletes user with profile and role in a single transaction.
-// Returns 400 for bad UUID, 500 for server errors, 200 for success.
+// Validates UUID, checks store initialization, and soft deletes user with profile and role in a single transaction.
+// An If-Match header, when present, must match the combined ETag returned by GetUserTx; the delete queries
+// enforce each of its versions.
+// Returns 400 for bad UUID, 404 if not found, 412 on ETag mismatch, 500 for server errors, 200 for success.
 func (server *Server) DeleteUserTx(ctx *gin.Context) {
 	idStr := ctx.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		apierror.Respond(ctx, invalidUUIDError("id", err))
 		return
 	}
 
 	if server.store == nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("store not initialized")))
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
 		return
 	}
 
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 
 	if authPayload.RoleID != 3 {
-		ctx.JSON(http.StatusForbidden, errorResponse(errors.New("You are not authorized to delete users")))
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to delete users"))
 		return
 	}
 
-	userWithProfileAndRole, err := server.store.DeleteUserWithProfileAndRoleTX(ctx, id)
+	userParams := db.DeleteUserParams{ID: id}
+	var profileParams db.DeleteUserProfileParams
+	var roleParams db.DeleteUserRoleParams
+	if etag, ok := ifMatch(ctx); ok {
+		versions, err := parseETagVersions(etag, 3)
+		if err != nil {
+			apierror.Respond(ctx, apierror.PreconditionFailed(err.Error()))
+			return
+		}
+		userParams.ExpectedVersion = versions[0]
+		profileParams.ExpectedVersion = versions[1]
+		roleParams.ExpectedVersion = versions[2]
+	}
+
+	userWithProfileAndRole, err := server.store.DeleteUserWithProfileAndRoleTX(auditContext(ctx), userParams, profileParams, roleParams)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		if err == sql.ErrNoRows {
+			server.updateNotApplied(ctx, id, userParams.ExpectedVersion.Valid)
+			return
+		}
+		apierror.Respond(ctx, err)
 		return
 	}
 
@@ -473,48 +688,99 @@ func (server *Server) DeleteUserTx(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, userResponse)
 }
 
+// RestoreUserTx handles POST /usertx/:id/restore to undo a soft delete.
+// Restores the user along with any profile and role that were deleted with it. Admin only.
+// Returns 400 for bad UUID, 403 for non-admins, 404 if the user is not deleted or already purged, 500 for server errors, 200 for success.
+func (server *Server) RestoreUserTx(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		apierror.Respond(ctx, invalidUUIDError("id", err))
+		return
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if authPayload.RoleID != 3 {
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to restore users"))
+		return
+	}
+
+	userWithProfileAndRole, err := server.store.RestoreUserWithProfileAndRoleTx(auditContext(ctx), id)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	userResponse := newUserTXResponse(userWithProfileAndRole)
+
+	ctx.Header(etagHeaderKey, userTxETag(userWithProfileAndRole))
+	ctx.JSON(http.StatusOK, userResponse)
+}
+
 // createUserTxRequest defines the payload for transactional user creation.
 // Includes user, profile, and role fields.
 // All fields are required except for role, which is set internally.
 type updateUserTxRequest struct {
-	ID            uuid.UUID `json:"id" binding:"required"`
-	UserName      string    `json:"user_name"`
-	Email         string    `json:"email"`
-	Password      string    `json:"password"`
-	FirstName     string    `json:"first_name"`
-	LastName      string    `json:"last_name"`
-	BusinessName  string    `json:"business_name"`
-	StreetAddress string    `json:"street_address"`
-	City          string    `json:"city"`
-	State         string    `json:"state"`
-	Zip           string    `json:"zip"`
-	CountryCode   string    `json:"country_code"`
-	RoleID        int32     `json:"role_id"`
+	ID            uuid.UUID                  `json:"id" binding:"required"`
+	UserName      string                     `json:"user_name" binding:"omitempty,username,unreserved"`
+	Email         string                     `json:"email" binding:"omitempty,email"`
+	Password      string                     `json:"password"`
+	FirstName     string                     `json:"first_name"`
+	LastName      string                     `json:"last_name"`
+	BusinessName  string                     `json:"business_name"`
+	StreetAddress string                     `json:"street_address"`
+	City          string                     `json:"city"`
+	State         string                     `json:"state"`
+	Zip           string                     `json:"zip"`
+	CountryCode   string                     `json:"country_code"`
+	RoleID        int32                      `json:"role_id"`
+	Attributes    map[string]json.RawMessage `json:"attributes"`
 }
 
+// UpdateUserTx handles PUT /usertx to update a user, their profile, and role in a single transaction.
+// An If-Match header, when present, is checked against all three rows inside the transaction.
+// A new email address is pending until confirmed, the same way as for UpdateUser.
+// Returns 400 for bad input, 404 if not found, 409 if the email or user name is taken, 412 on ETag mismatch, 500 for server errors, 200 for success.
 func (server *Server) UpdateUserTx(ctx *gin.Context) {
 	var req updateUserTxRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		apierror.Respond(ctx, apierror.FromBinding(err))
 		return
 	}
 
 	if server.store == nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("store not initialized")))
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
 		return
 	}
 
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 
 	if req.ID != authPayload.UserID && authPayload.RoleID != 3 {
-		ctx.JSON(http.StatusForbidden, errorResponse(errors.New("You are not authorized to update this user")))
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to update this user"))
+		return
+	}
+
+	if err := normalizeAddress(&req.StreetAddress, &req.City, &req.State, &req.Zip, &req.CountryCode); err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	attributes, err := server.userAttributeValues(ctx, req.Attributes, false)
+	if err != nil {
+		apierror.Respond(ctx, err)
 		return
 	}
 
 	hashedPassword, err := util.HashPassword(req.Password)
 
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
@@ -540,14 +806,41 @@ func (server *Server) UpdateUserTx(ctx *gin.Context) {
 		RoleID: req.RoleID,
 	}
 
-	userWithProfileAndRole, err := server.store.UpdateUserWithProfileAndRoleTX(ctx, updateUserParams, updateProfileParams, updateRoleParams)
+	if etag, ok := ifMatch(ctx); ok {
+		versions, err := parseETagVersions(etag, 3)
+		if err != nil {
+			apierror.Respond(ctx, apierror.PreconditionFailed(err.Error()))
+			return
+		}
+		updateUserParams.ExpectedVersion = versions[0]
+		updateProfileParams.ExpectedVersion = versions[1]
+		updateRoleParams.ExpectedVersion = versions[2]
+	}
+
+	emailChange, err := server.newEmailChangeRequest(req.Email)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	userWithProfileAndRole, err := server.store.UpdateUserWithProfileAndRoleTX(auditContext(ctx), updateUserParams, updateProfileParams, updateRoleParams, emailChange.storeParams(), attributes...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			server.updateNotApplied(ctx, req.ID, updateUserParams.ExpectedVersion.Valid)
+			return
+		}
+		apierror.Respond(ctx, emailTakenError(err))
 		return
 	}
 
 	userResponse := newUserTXResponse(userWithProfileAndRole)
 
+	if userWithProfileAndRole.EmailChange != nil {
+		server.sendEmailChangeMessages(ctx, userWithProfileAndRole.User, *userWithProfileAndRole.EmailChange, emailChange)
+		userResponse.PendingEmail = userWithProfileAndRole.EmailChange.NewEmail
+	}
+
+	ctx.Header(etagHeaderKey, userTxETag(userWithProfileAndRole))
 	ctx.JSON(http.StatusOK, userResponse)
 }
 
@@ -568,7 +861,7 @@ type loginUserResponse struct {
 func (server *Server) LoginUser(ctx *gin.Context) {
 	var req loginUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		apierror.Respond(ctx, apierror.FromBinding(err))
 		return
 	}
 
@@ -576,22 +869,22 @@ func (server *Server) LoginUser(ctx *gin.Context) {
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("invalid email or password")))
+			apierror.Respond(ctx, apierror.Unauthorized("invalid email or password"))
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
 	err = util.CheckPasswordHash(req.Password, user.Password)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("invalid email or password")))
+		apierror.Respond(ctx, apierror.Unauthorized("invalid email or password"))
 		return
 	}
 
 	userRole, err := server.store.GetUserRole(ctx, user.ID)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
@@ -602,7 +895,7 @@ func (server *Server) LoginUser(ctx *gin.Context) {
 	)
 
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		apierror.Respond(ctx, err)
 		return
 	}
 
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"regexp"
+	"strings"
+	"whaleWake/apierror"
+)
+
+// userNamePattern allows 3-30 ASCII letters, digits, dots, dashes, and underscores, starting and ending with a
+// letter or digit.
+var userNamePattern = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9._-]{1,28})[A-Za-z0-9]$`)
+
+// reservedUserNames can't be taken by anyone, in any case, since they could be mistaken for the service itself
+// or clash with routes.
+var reservedUserNames = map[string]bool{
+	"abuse":         true,
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"available":     true,
+	"help":          true,
+	"hostmaster":    true,
+	"info":          true,
+	"login":         true,
+	"logout":        true,
+	"me":            true,
+	"moderator":     true,
+	"noreply":       true,
+	"no-reply":      true,
+	"null":          true,
+	"postmaster":    true,
+	"root":          true,
+	"security":      true,
+	"settings":      true,
+	"signup":        true,
+	"staff":         true,
+	"support":       true,
+	"system":        true,
+	"undefined":     true,
+	"webmaster":     true,
+	"whalewake":     true,
+	"www":           true,
+}
+
+// Reasons a user name is not available, as reported by CheckUserNameAvailability.
+const (
+	userNameInvalid  = "invalid"
+	userNameReserved = "reserved"
+	userNameTaken    = "taken"
+)
+
+// validUserName is the "username" binding rule for the format of a user name.
+func validUserName(fl validator.FieldLevel) bool {
+	return userNamePattern.MatchString(fl.Field().String())
+}
+
+// unreservedUserName is the "unreserved" binding rule that rejects reserved user names.
+func unreservedUserName(fl validator.FieldLevel) bool {
+	return !reservedUserNames[strings.ToLower(fl.Field().String())]
+}
+
+// userNameAvailabilityRequest defines the query of a user name availability check.
+// Fields:
+// - UserName: required, the name to check.
+type userNameAvailabilityRequest struct {
+	UserName string `form:"user_name" binding:"required,max=64"`
+}
+
+// userNameAvailabilityResponse reports whether a user name can be taken.
+// Fields:
+// - UserName: The name that was checked.
+// - Available: Whether a new user could be created with the name right now.
+// - Reason: Why the name is not available: invalid, reserved, or taken. Empty when available.
+type userNameAvailabilityResponse struct {
+	UserName  string `json:"user_name"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// CheckUserNameAvailability handles GET /users/available?user_name= for sign-up forms.
+// Names are compared case-insensitively. A name kept for its previous owner during the rename grace period counts
+// as taken. The route is public and rate limited per client, see userNameCheckLimit in setupRouter.
+// Returns 400 without a user name, 429 over the limit, 500 for server errors, 200 with the result.
+func (server *Server) CheckUserNameAvailability(ctx *gin.Context) {
+	var req userNameAvailabilityRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	response := userNameAvailabilityResponse{UserName: req.UserName}
+	switch {
+	case !userNamePattern.MatchString(req.UserName):
+		response.Reason = userNameInvalid
+	case reservedUserNames[strings.ToLower(req.UserName)]:
+		response.Reason = userNameReserved
+	}
+	if response.Reason != "" {
+		ctx.JSON(http.StatusOK, response)
+		return
+	}
+
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return
+	}
+
+	availability, err := server.store.GetUserNameAvailability(ctx, req.UserName)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	if availability.Taken || availability.Reserved {
+		response.Reason = userNameTaken
+	}
+	response.Available = response.Reason == ""
+	ctx.JSON(http.StatusOK, response)
+}
+
+// userRoute is a handler for GET /users/:id with the middlewares it runs behind.
+type userRoute struct {
+	middlewares []gin.HandlerFunc
+	handler     gin.HandlerFunc
+}
+
+// userRoutes returns the handlers served at GET /users/<name> instead of the user lookup, by name.
+// Parameters:
+// - checkLimit: The rate limit of the public user name check.
+// - auth: The auth middleware of the authorized routes.
+func (server *Server) userRoutes(checkLimit, auth gin.HandlerFunc) map[string]userRoute {
+	return map[string]userRoute{
+		"available": {middlewares: []gin.HandlerFunc{checkLimit}, handler: server.CheckUserNameAvailability},
+		"search":    {middlewares: []gin.HandlerFunc{auth}, handler: server.SearchUsers},
+		"export":    {middlewares: []gin.HandlerFunc{auth}, handler: server.ExportUsers},
+	}
+}
+
+// getUserRoute serves GET /users/:id from routes when the id names one, and with lookup otherwise.
+// gin can't register static paths such as /users/search next to /users/:id, so they share one route and each
+// runs its own middlewares here.
+func getUserRoute(routes map[string]userRoute, lookup userRoute) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route, ok := routes[ctx.Param("id")]
+		if !ok {
+			route = lookup
+		}
+
+		for _, middleware := range route.middlewares {
+			middleware(ctx)
+			if ctx.IsAborted() {
+				return
+			}
+		}
+		route.handler(ctx)
+	}
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+// userNameTestStore reports the lower-cased names in taken as in use and those in reserved as kept after a rename.
+type userNameTestStore struct {
+	db.Store
+	taken    map[string]bool
+	reserved map[string]bool
+}
+
+func (s *userNameTestStore) GetUserNameAvailability(_ context.Context, userName string) (db.GetUserNameAvailabilityRow, error) {
+	userName = strings.ToLower(userName)
+	return db.GetUserNameAvailabilityRow{Taken: s.taken[userName], Reserved: s.reserved[userName]}, nil
+}
+
+func TestCheckUserNameAvailability(t *testing.T) {
+	store := &userNameTestStore{taken: map[string]bool{"orca": true}, reserved: map[string]bool{"beluga": true}}
+
+	testCases := []struct {
+		name      string
+		userName  string
+		available bool
+		reason    string
+	}{
+		{name: "Available", userName: "Narwhal_9", available: true},
+		{name: "TakenInOtherCase", userName: "ORCA", reason: userNameTaken},
+		{name: "KeptAfterRename", userName: "beluga", reason: userNameTaken},
+		{name: "Reserved", userName: "Admin", reason: userNameReserved},
+		{name: "TooShort", userName: "ab", reason: userNameInvalid},
+		{name: "BadCharacters", userName: "blue whale", reason: userNameInvalid},
+		{name: "EndsWithDot", userName: "whale.", reason: userNameInvalid},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/users/available?user_name="+url.QueryEscape(tc.userName), nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			var response userNameAvailabilityResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			require.Equal(t, userNameAvailabilityResponse{UserName: tc.userName, Available: tc.available, Reason: tc.reason}, response)
+		})
+	}
+}
+
+func TestCheckUserNameAvailabilityMissingName(t *testing.T) {
+	server := newTestServer(t, &userNameTestStore{})
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest(http.MethodGet, "/users/available", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	requireFieldError(t, recorder, "user_name", "required")
+}
+
+func TestCheckUserNameAvailabilityRateLimit(t *testing.T) {
+	server := newTestServer(t, &userNameTestStore{})
+	server.config.UserNameCheckLimit = 2
+	server.setupRouter()
+
+	for i := 0; i < 3; i++ {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/users/available?user_name=narwhal", nil)
+		require.NoError(t, err)
+		// A forged X-Forwarded-For doesn't get the client a new limit.
+		request.RemoteAddr = "192.0.2.1:4000"
+		request.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+
+		server.router.ServeHTTP(recorder, request)
+		if i < 2 {
+			require.Equal(t, http.StatusOK, recorder.Code)
+			continue
+		}
+		require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+		require.NotEmpty(t, recorder.Header().Get("Retry-After"))
+	}
+
+	// Other routes are not limited, and user lookups still need a token.
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/users/"+util.RandomUUID().String(), nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestGetUserRoute(t *testing.T) {
+	testCases := []struct {
+		name  string
+		codes []int
+	}{
+		// Public, behind the rate limit of one check per minute set below.
+		{name: "available", codes: []int{http.StatusOK, http.StatusTooManyRequests}},
+		{name: "search", codes: []int{http.StatusUnauthorized}},
+		{name: "export", codes: []int{http.StatusUnauthorized}},
+		// Any other id is the user lookup.
+		{name: util.RandomUUID().String(), codes: []int{http.StatusUnauthorized}},
+	}
+
+	server := newTestServer(t, &userNameTestStore{})
+	covered := map[string]bool{}
+	for _, tc := range testCases {
+		covered[tc.name] = true
+	}
+	for name := range server.userRoutes(nil, nil) {
+		require.True(t, covered[name], "no test case for GET /users/%s", name)
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, &userNameTestStore{})
+			server.config.UserNameCheckLimit = 1
+			server.setupRouter()
+
+			for _, code := range tc.codes {
+				recorder := httptest.NewRecorder()
+				request, err := http.NewRequest(http.MethodGet, "/users/"+tc.name+"?user_name=narwhal", nil)
+				require.NoError(t, err)
+
+				server.router.ServeHTTP(recorder, request)
+				require.Equal(t, code, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestRateLimiterWindow(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(1, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	allowed, _ := limiter.allow("10.0.0.1")
+	require.True(t, allowed)
+
+	allowed, retryAfter := limiter.allow("10.0.0.1")
+	require.False(t, allowed)
+	require.Equal(t, time.Minute, retryAfter)
+
+	allowed, _ = limiter.allow("10.0.0.2")
+	require.True(t, allowed)
+
+	now = now.Add(time.Minute)
+	allowed, _ = limiter.allow("10.0.0.1")
+	require.True(t, allowed)
+}
+
+func TestRateLimiterManyClients(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(1, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3*limiter.maxClients; i++ {
+		now = now.Add(time.Millisecond)
+		allowed, _ := limiter.allow(fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+		require.True(t, allowed)
+		require.LessOrEqual(t, len(limiter.windows), limiter.maxClients)
+	}
+	require.Len(t, limiter.windows, limiter.maxClients)
+	require.Equal(t, limiter.maxClients, limiter.order.Len())
+
+	// The newest clients are still limited; the oldest were dropped to make room.
+	allowed, _ := limiter.allow(fmt.Sprintf("10.0.%d.%d", (3*limiter.maxClients-1)/256, (3*limiter.maxClients-1)%256))
+	require.False(t, allowed)
+	allowed, _ = limiter.allow("10.0.0.0")
+	require.True(t, allowed)
+
+	// Once every window has expired, the next request drops them all.
+	now = now.Add(time.Minute)
+	allowed, _ = limiter.allow("10.1.0.0")
+	require.True(t, allowed)
+	require.Len(t, limiter.windows, 1)
+}
+
+func TestCreateUserUserNameRules(t *testing.T) {
+	testCases := []struct {
+		name     string
+		userName string
+		code     string
+	}{
+		{name: "Reserved", userName: "Administrator", code: "unreserved"},
+		{name: "BadCharacters", userName: "ahab@pequod", code: "username"},
+		{name: "TooLong", userName: strings.Repeat("a", 31), code: "username"},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, &userNameTestStore{})
+			recorder := httptest.NewRecorder()
+
+			body := `{"user_name": "` + tc.userName + `", "email": "` + util.RandomEmail() + `", "password": "secret123"}`
+			request, err := http.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(body))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			requireFieldError(t, recorder, "user_name", tc.code)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"whaleWake/apierror"
+	"whaleWake/geo"
+)
+
+var registerValidatorsOnce sync.Once
+
+// registerValidators configures gin's shared validator.
+// Field errors are reported under the JSON (or query) name the client used rather than the Go field name.
+func registerValidators() {
+	registerValidatorsOnce.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+
+		v.RegisterTagNameFunc(requestFieldName)
+		_ = v.RegisterValidation("username", validUserName)
+		_ = v.RegisterValidation("unreserved", unreservedUserName)
+	})
+}
+
+// requestFieldName returns the json or form tag name of a struct field, falling back to the Go name.
+func requestFieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form", "uri"} {
+		name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// invalidUUIDError reports a path or query parameter that is not a valid UUID.
+func invalidUUIDError(field string, err error) *apierror.Error {
+	apiErr := apierror.BadRequest(fmt.Sprintf("%s must be a valid UUID", field))
+	apiErr.Err = err
+	return apiErr.WithFields(apierror.FieldError{Field: field, Code: "uuid", Message: "must be a valid UUID"})
+}
+
+// normalizeAddress validates the address fields of a request and rewrites them in place in their normalized form.
+// Returns a validation_failed error with one field error per invalid field, or nil.
+func normalizeAddress(streetAddress, city, state, zip, countryCode *string) error {
+	address, err := geo.Normalize(geo.Address{
+		StreetAddress: *streetAddress,
+		City:          *city,
+		State:         *state,
+		Zip:           *zip,
+		CountryCode:   *countryCode,
+	})
+	if err != nil {
+		var geoErrs geo.Errors
+		if !errors.As(err, &geoErrs) {
+			return err
+		}
+		apiErr := apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "request failed validation")
+		apiErr.Err = err
+		for _, fieldErr := range geoErrs {
+			apiErr.WithFields(apierror.FieldError{Field: fieldErr.Field, Code: fieldErr.Code, Message: fieldErr.Message})
+		}
+		return apiErr
+	}
+
+	*streetAddress = address.StreetAddress
+	*city = address.City
+	*state = address.State
+	*zip = address.Zip
+	*countryCode = address.CountryCode
+	return nil
+}
@@ -0,0 +1,405 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"whaleWake/apierror"
+	db "whaleWake/db/sqlc"
+	"whaleWake/token"
+)
+
+// webhookSecretBytes is the length of generated webhook secrets, before encoding.
+const webhookSecretBytes = 32
+
+// webhookSecretPrefix marks generated secrets, so they are easy to recognize in a receiver's configuration.
+const webhookSecretPrefix = "whsec_"
+
+// webhookSubscriptionRequest defines the payload for creating and replacing a subscription.
+// Fields:
+// - URL: required, the http or https endpoint deliveries are posted to.
+// - EventTypes: required, the event types to deliver, such as "user.created".
+// - Secret: optional, the key deliveries are signed with, at least 16 characters. Generated when creating
+// without one; kept when replacing without one.
+// - Active: optional, whether to deliver events; defaults to true. Events are still queued for an inactive
+// subscription and delivered once it is active again.
+type webhookSubscriptionRequest struct {
+	URL        string   `json:"url" binding:"required,url,max=2048"`
+	EventTypes []string `json:"event_types" binding:"required,min=1,max=20"`
+	Secret     string   `json:"secret" binding:"omitempty,min=16,max=255"`
+	Active     *bool    `json:"active"`
+}
+
+// webhookSubscriptionResponse is a subscription without its secret, which is only shown when it is created.
+type webhookSubscriptionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	Active     bool      `json:"active"`
+	CreatedAt  string    `json:"created_at"`
+	UpdatedAt  string    `json:"updated_at"`
+}
+
+func newWebhookSubscriptionResponse(subscription db.WebhookSubscription) webhookSubscriptionResponse {
+	return webhookSubscriptionResponse{
+		ID:         subscription.ID,
+		URL:        subscription.Url,
+		EventTypes: subscription.EventTypes,
+		Active:     subscription.Active,
+		CreatedAt:  subscription.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:  subscription.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// listWebhookDeliveriesRequest defines the query parameters for GET /webhooks/:id/deliveries.
+// Fields:
+// - Status: optional filter, one of pending, delivered, or dead.
+// - PageID, PageSize: required pagination, same as GET /users.
+type listWebhookDeliveriesRequest struct {
+	Status   string `form:"status" binding:"omitempty,oneof=pending delivered dead"`
+	PageID   int32  `form:"page_id" binding:"required,min=1"`
+	PageSize int32  `form:"page_size" binding:"required,min=1,max=100"`
+}
+
+type webhookDeliveryResponse struct {
+	ID             int64           `json:"id"`
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	UserID         uuid.UUID       `json:"user_id"`
+	Data           json.RawMessage `json:"data"`
+	OccurredAt     string          `json:"occurred_at"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *string         `json:"next_attempt_at"`
+	LastAttemptAt  *string         `json:"last_attempt_at"`
+	LastStatusCode int32           `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	DeliveredAt    *string         `json:"delivered_at"`
+	CreatedAt      string          `json:"created_at"`
+}
+
+func newWebhookDeliveryResponse(delivery db.WebhookDelivery) webhookDeliveryResponse {
+	rsp := webhookDeliveryResponse{
+		ID:             delivery.ID,
+		SubscriptionID: delivery.SubscriptionID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		UserID:         delivery.UserID,
+		Data:           delivery.Data,
+		OccurredAt:     delivery.OccurredAt.Format(time.RFC3339),
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt.Format(time.RFC3339),
+	}
+	if delivery.Status == db.WebhookDeliveryPending {
+		next := delivery.NextAttemptAt.Format(time.RFC3339)
+		rsp.NextAttemptAt = &next
+	}
+	if delivery.LastAttemptAt.Valid {
+		last := delivery.LastAttemptAt.Time.Format(time.RFC3339)
+		rsp.LastAttemptAt = &last
+	}
+	if delivery.DeliveredAt.Valid {
+		delivered := delivery.DeliveredAt.Time.Format(time.RFC3339)
+		rsp.DeliveredAt = &delivered
+	}
+	return rsp
+}
+
+// check reports a URL that is not http or https and unknown event types, as a validation_failed error.
+func (req webhookSubscriptionRequest) check() error {
+	var fields []apierror.FieldError
+
+	if endpoint, err := url.Parse(req.URL); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		fields = append(fields, apierror.FieldError{Field: "url", Code: "url", Message: "must be an http or https URL"})
+	}
+
+	for i, eventType := range req.EventTypes {
+		known := false
+		for _, candidate := range db.EventTypes {
+			known = known || eventType == candidate
+		}
+		if !known {
+			fields = append(fields, apierror.FieldError{
+				Field:   "event_types[" + strconv.Itoa(i) + "]",
+				Code:    "oneof",
+				Message: "must be one of: " + strings.Join(db.EventTypes, " "),
+			})
+		}
+	}
+
+	if fields == nil {
+		return nil
+	}
+	return apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "request failed validation").WithFields(fields...)
+}
+
+// webhookAdmin checks that the caller is an admin. The error has already been sent when ok is false.
+func (server *Server) webhookAdmin(ctx *gin.Context) bool {
+	if server.store == nil {
+		apierror.Respond(ctx, apierror.Internal(errStoreNotInitialized))
+		return false
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if authPayload.RoleID != 3 {
+		apierror.Respond(ctx, apierror.Forbidden("You are not authorized to manage webhooks"))
+		return false
+	}
+	return true
+}
+
+// webhookSubscriptionID parses the id of a webhook route. The error has already been sent when ok is false.
+func webhookSubscriptionID(ctx *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		apierror.Respond(ctx, invalidUUIDError("id", err))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// webhookNotFound turns sql.ErrNoRows into a 404 for the subscription or delivery.
+func webhookNotFound(err error, what string) error {
+	if err == sql.ErrNoRows {
+		return apierror.NotFound(what + " not found")
+	}
+	return err
+}
+
+// ListWebhookSubscriptions handles GET /webhooks to list every subscription, oldest first. Admin only.
+// Returns 403 for non-admins, 500 for server errors, 200 for success.
+func (server *Server) ListWebhookSubscriptions(ctx *gin.Context) {
+	if !server.webhookAdmin(ctx) {
+		return
+	}
+
+	subscriptions, err := server.store.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	response := make([]webhookSubscriptionResponse, len(subscriptions))
+	for i, subscription := range subscriptions {
+		response[i] = newWebhookSubscriptionResponse(subscription)
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CreateWebhookSubscription handles POST /webhooks to subscribe an endpoint to events. Admin only.
+// Events recorded from now on are delivered; earlier ones are not. The response is the only time the secret is
+// shown.
+// Returns 400 for bad input, 403 for non-admins, 500 for server errors, 201 for success.
+func (server *Server) CreateWebhookSubscription(ctx *gin.Context) {
+	var req webhookSubscriptionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if !server.webhookAdmin(ctx) {
+		return
+	}
+	if err := req.check(); err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		if secret, err = newWebhookSecret(); err != nil {
+			apierror.Respond(ctx, err)
+			return
+		}
+	}
+
+	subscription, err := server.store.CreateWebhookSubscription(ctx, db.CreateWebhookSubscriptionParams{
+		Url:        req.URL,
+		EventTypes: req.EventTypes,
+		Secret:     secret,
+		Active:     req.Active == nil || *req.Active,
+	})
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	response := newWebhookSubscriptionResponse(subscription)
+	response.Secret = subscription.Secret
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// GetWebhookSubscription handles GET /webhooks/:id to retrieve a subscription. Admin only.
+// Returns 400 for a bad UUID, 403 for non-admins, 404 if not found, 500 for server errors, 200 for success.
+func (server *Server) GetWebhookSubscription(ctx *gin.Context) {
+	if !server.webhookAdmin(ctx) {
+		return
+	}
+	id, ok := webhookSubscriptionID(ctx)
+	if !ok {
+		return
+	}
+
+	subscription, err := server.store.GetWebhookSubscription(ctx, id)
+	if err != nil {
+		apierror.Respond(ctx, webhookNotFound(err, "webhook"))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newWebhookSubscriptionResponse(subscription))
+}
+
+// UpdateWebhookSubscription handles PUT /webhooks/:id to replace a subscription, and to rotate its secret when
+// a new one is given. Admin only.
+// Queued deliveries go to the new URL, signed with the new secret.
+// Returns 400 for bad input, 403 for non-admins, 404 if not found, 500 for server errors, 200 for success.
+func (server *Server) UpdateWebhookSubscription(ctx *gin.Context) {
+	var req webhookSubscriptionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if !server.webhookAdmin(ctx) {
+		return
+	}
+	id, ok := webhookSubscriptionID(ctx)
+	if !ok {
+		return
+	}
+	if err := req.check(); err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	subscription, err := server.store.UpdateWebhookSubscription(ctx, db.UpdateWebhookSubscriptionParams{
+		ID:         id,
+		Url:        req.URL,
+		EventTypes: req.EventTypes,
+		Secret:     req.Secret,
+		Active:     req.Active == nil || *req.Active,
+	})
+	if err != nil {
+		apierror.Respond(ctx, webhookNotFound(err, "webhook"))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newWebhookSubscriptionResponse(subscription))
+}
+
+// DeleteWebhookSubscription handles DELETE /webhooks/:id to remove a subscription along with its deliveries and
+// their log. Admin only.
+// Returns 400 for a bad UUID, 403 for non-admins, 404 if not found, 500 for server errors, 200 for success.
+func (server *Server) DeleteWebhookSubscription(ctx *gin.Context) {
+	if !server.webhookAdmin(ctx) {
+		return
+	}
+	id, ok := webhookSubscriptionID(ctx)
+	if !ok {
+		return
+	}
+
+	subscription, err := server.store.DeleteWebhookSubscription(ctx, id)
+	if err != nil {
+		apierror.Respond(ctx, webhookNotFound(err, "webhook"))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newWebhookSubscriptionResponse(subscription))
+}
+
+// ListWebhookDeliveries handles GET /webhooks/:id/deliveries to page through the delivery log of a
+// subscription, newest first, with the outcome of the last attempt of each. Admin only.
+// Returns 400 for bad params, 403 for non-admins, 404 if not found, 500 for server errors, 200 for success.
+func (server *Server) ListWebhookDeliveries(ctx *gin.Context) {
+	var req listWebhookDeliveriesRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(ctx, apierror.FromBinding(err))
+		return
+	}
+
+	if !server.webhookAdmin(ctx) {
+		return
+	}
+	id, ok := webhookSubscriptionID(ctx)
+	if !ok {
+		return
+	}
+
+	if _, err := server.store.GetWebhookSubscription(ctx, id); err != nil {
+		apierror.Respond(ctx, webhookNotFound(err, "webhook"))
+		return
+	}
+
+	deliveries, err := server.store.ListWebhookDeliveries(ctx, db.ListWebhookDeliveriesParams{
+		SubscriptionID: id,
+		Status:         sql.NullString{String: req.Status, Valid: req.Status != ""},
+		PageLimit:      req.PageSize,
+		PageOffset:     (req.PageID - 1) * req.PageSize,
+	})
+	if err != nil {
+		apierror.Respond(ctx, err)
+		return
+	}
+
+	response := make([]webhookDeliveryResponse, len(deliveries))
+	for i, delivery := range deliveries {
+		response[i] = newWebhookDeliveryResponse(delivery)
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RedeliverWebhookDelivery handles POST /webhooks/:id/deliveries/:delivery_id/redeliver to send a delivery
+// again as soon as possible, with a fresh set of attempts. Dead deliveries come back this way once the endpoint
+// is fixed; delivered ones are sent again for receivers that lost them. Admin only.
+// Returns 400 for bad ids, 403 for non-admins, 404 if not found, 500 for server errors, 202 for success.
+func (server *Server) RedeliverWebhookDelivery(ctx *gin.Context) {
+	if !server.webhookAdmin(ctx) {
+		return
+	}
+	id, ok := webhookSubscriptionID(ctx)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(ctx.Param("delivery_id"), 10, 64)
+	if err != nil || deliveryID < 1 {
+		apierror.Respond(ctx, apierror.BadRequest("delivery_id must be a positive integer").
+			WithFields(apierror.FieldError{Field: "delivery_id", Code: "min", Message: "must be a positive integer"}))
+		return
+	}
+
+	delivery, err := server.store.RedeliverWebhookDelivery(ctx, db.RedeliverWebhookDeliveryParams{
+		ID:             deliveryID,
+		SubscriptionID: id,
+	})
+	if err != nil {
+		apierror.Respond(ctx, webhookNotFound(err, "delivery"))
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, newWebhookDeliveryResponse(delivery))
+}
+
+// newWebhookSecret returns a random secret for signing deliveries.
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
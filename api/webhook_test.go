@@ -0,0 +1,250 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/util"
+)
+
+// webhookTestStore keeps subscriptions and deliveries in memory.
+type webhookTestStore struct {
+	db.Store
+	subscriptions []db.WebhookSubscription
+	deliveries    []db.WebhookDelivery
+}
+
+func (s *webhookTestStore) CreateWebhookSubscription(_ context.Context, arg db.CreateWebhookSubscriptionParams) (db.WebhookSubscription, error) {
+	subscription := db.WebhookSubscription{
+		ID:         util.RandomUUID(),
+		Url:        arg.Url,
+		EventTypes: arg.EventTypes,
+		Secret:     arg.Secret,
+		Active:     arg.Active,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	s.subscriptions = append(s.subscriptions, subscription)
+	return subscription, nil
+}
+
+func (s *webhookTestStore) GetWebhookSubscription(_ context.Context, id uuid.UUID) (db.WebhookSubscription, error) {
+	for _, subscription := range s.subscriptions {
+		if subscription.ID == id {
+			return subscription, nil
+		}
+	}
+	return db.WebhookSubscription{}, sql.ErrNoRows
+}
+
+func (s *webhookTestStore) UpdateWebhookSubscription(_ context.Context, arg db.UpdateWebhookSubscriptionParams) (db.WebhookSubscription, error) {
+	for i, subscription := range s.subscriptions {
+		if subscription.ID == arg.ID {
+			subscription.Url = arg.Url
+			subscription.EventTypes = arg.EventTypes
+			subscription.Active = arg.Active
+			if arg.Secret != "" {
+				subscription.Secret = arg.Secret
+			}
+			s.subscriptions[i] = subscription
+			return subscription, nil
+		}
+	}
+	return db.WebhookSubscription{}, sql.ErrNoRows
+}
+
+func (s *webhookTestStore) ListWebhookDeliveries(_ context.Context, arg db.ListWebhookDeliveriesParams) ([]db.WebhookDelivery, error) {
+	deliveries := []db.WebhookDelivery{}
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		delivery := s.deliveries[i]
+		if delivery.SubscriptionID == arg.SubscriptionID && (!arg.Status.Valid || delivery.Status == arg.Status.String) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (s *webhookTestStore) RedeliverWebhookDelivery(_ context.Context, arg db.RedeliverWebhookDeliveryParams) (db.WebhookDelivery, error) {
+	for i, delivery := range s.deliveries {
+		if delivery.ID == arg.ID && delivery.SubscriptionID == arg.SubscriptionID {
+			delivery.Status = db.WebhookDeliveryPending
+			delivery.Attempts = 0
+			delivery.NextAttemptAt = time.Now()
+			delivery.DeliveredAt = sql.NullTime{}
+			s.deliveries[i] = delivery
+			return delivery, nil
+		}
+	}
+	return db.WebhookDelivery{}, sql.ErrNoRows
+}
+
+func TestCreateWebhookSubscription(t *testing.T) {
+	testCases := []struct {
+		name          string
+		body          string
+		role          int
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, store *webhookTestStore)
+	}{
+		{
+			name: "OK",
+			body: `{"url": "https://partner.example.com/hooks", "event_types": ["user.created", "user.deleted"]}`,
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *webhookTestStore) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				var subscription webhookSubscriptionResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &subscription))
+				require.True(t, subscription.Active)
+				require.Equal(t, []string{db.EventUserCreated, db.EventUserDeleted}, subscription.EventTypes)
+				require.True(t, strings.HasPrefix(subscription.Secret, webhookSecretPrefix))
+				require.Equal(t, store.subscriptions[0].Secret, subscription.Secret)
+			},
+		},
+		{
+			name: "OwnSecretInactive",
+			body: `{"url": "http://localhost:9000/hooks", "event_types": ["user.updated"], "secret": "correct horse battery staple", "active": false}`,
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *webhookTestStore) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				require.Equal(t, "correct horse battery staple", store.subscriptions[0].Secret)
+				require.False(t, store.subscriptions[0].Active)
+			},
+		},
+		{
+			name: "NotAdmin",
+			body: `{"url": "https://partner.example.com/hooks", "event_types": ["user.created"]}`,
+			role: 1,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *webhookTestStore) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				require.Empty(t, store.subscriptions)
+			},
+		},
+		{
+			name: "NotHTTP",
+			body: `{"url": "ftp://partner.example.com/hooks", "event_types": ["user.created"]}`,
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *webhookTestStore) {
+				requireFieldError(t, recorder, "url", "url")
+			},
+		},
+		{
+			name: "UnknownEventType",
+			body: `{"url": "https://partner.example.com/hooks", "event_types": ["user.created", "whale.sighted"]}`,
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *webhookTestStore) {
+				requireFieldError(t, recorder, "event_types[1]", "oneof")
+			},
+		},
+		{
+			name: "NoEventTypes",
+			body: `{"url": "https://partner.example.com/hooks", "event_types": []}`,
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *webhookTestStore) {
+				requireFieldError(t, recorder, "event_types", "min")
+			},
+		},
+		{
+			name: "ShortSecret",
+			body: `{"url": "https://partner.example.com/hooks", "event_types": ["user.created"], "secret": "hunter2"}`,
+			role: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, store *webhookTestStore) {
+				requireFieldError(t, recorder, "secret", "min")
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			store := &webhookTestStore{}
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodPost, "/webhooks", bytes.NewBufferString(tc.body))
+			require.NoError(t, err)
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomUUID(), tc.role, time.Minute)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, store)
+		})
+	}
+}
+
+func TestUpdateWebhookSubscriptionKeepsSecret(t *testing.T) {
+	store := &webhookTestStore{}
+	subscription, err := store.CreateWebhookSubscription(context.Background(), db.CreateWebhookSubscriptionParams{
+		Url: "https://partner.example.com/hooks", EventTypes: []string{db.EventUserCreated}, Secret: "whsec_original", Active: true,
+	})
+	require.NoError(t, err)
+	server := newTestServer(t, store)
+
+	recorder := httptest.NewRecorder()
+	body := `{"url": "https://partner.example.com/v2/hooks", "event_types": ["user.created", "user.updated"]}`
+	request, err := http.NewRequest(http.MethodPut, "/webhooks/"+subscription.ID.String(), bytes.NewBufferString(body))
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomUUID(), 3, time.Minute)
+	server.router.ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response webhookSubscriptionResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Empty(t, response.Secret)
+	require.Equal(t, "https://partner.example.com/v2/hooks", response.URL)
+	require.Equal(t, "whsec_original", store.subscriptions[0].Secret)
+}
+
+func TestWebhookDeliveryLog(t *testing.T) {
+	store := &webhookTestStore{}
+	subscription, err := store.CreateWebhookSubscription(context.Background(), db.CreateWebhookSubscriptionParams{
+		Url: "https://partner.example.com/hooks", EventTypes: []string{db.EventUserCreated}, Secret: "whsec_original", Active: true,
+	})
+	require.NoError(t, err)
+	store.deliveries = []db.WebhookDelivery{
+		{ID: 1, SubscriptionID: subscription.ID, EventID: 10, EventType: db.EventUserCreated, Status: db.WebhookDeliveryDelivered,
+			Attempts: 1, LastStatusCode: http.StatusNoContent, DeliveredAt: sql.NullTime{Time: time.Now(), Valid: true}},
+		{ID: 2, SubscriptionID: subscription.ID, EventID: 11, EventType: db.EventUserCreated, Status: db.WebhookDeliveryDead,
+			Attempts: 10, LastStatusCode: http.StatusServiceUnavailable, LastError: "webhook responded 503 Service Unavailable"},
+	}
+	server := newTestServer(t, store)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(method, path, nil)
+		require.NoError(t, err)
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, util.RandomUUID(), 3, time.Minute)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	deliveriesPath := "/webhooks/" + subscription.ID.String() + "/deliveries"
+
+	recorder := serve(http.MethodGet, deliveriesPath+"?status=dead&page_id=1&page_size=10")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var deliveries []webhookDeliveryResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &deliveries))
+	require.Len(t, deliveries, 1)
+	require.Equal(t, int64(2), deliveries[0].ID)
+	require.Equal(t, int32(http.StatusServiceUnavailable), deliveries[0].LastStatusCode)
+	require.Nil(t, deliveries[0].NextAttemptAt)
+
+	recorder = serve(http.MethodPost, deliveriesPath+"/2/redeliver")
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	var delivery webhookDeliveryResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &delivery))
+	require.Equal(t, db.WebhookDeliveryPending, delivery.Status)
+	require.Zero(t, delivery.Attempts)
+	require.NotNil(t, delivery.NextAttemptAt)
+	require.Equal(t, "webhook responded 503 Service Unavailable", delivery.LastError)
+
+	require.Equal(t, http.StatusNotFound, serve(http.MethodPost, deliveriesPath+"/3/redeliver").Code)
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPost, deliveriesPath+"/latest/redeliver").Code)
+	require.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/webhooks/"+util.RandomUUID().String()+"/deliveries?page_id=1&page_size=10").Code)
+}
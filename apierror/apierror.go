@@ -0,0 +1,296 @@
+package apierror
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/lib/pq"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	db "whaleWake/db/sqlc"
+)
+
+// ContentType is the media type of every error body, as defined by RFC 7807.
+const ContentType = "application/problem+json"
+
+// Code is a stable, machine-readable identifier for a class of error.
+// Clients should switch on the code rather than on the human-readable detail.
+type Code string
+
+const (
+	CodeInvalidRequest     Code = "invalid_request"
+	CodeValidationFailed   Code = "validation_failed"
+	CodeUnauthenticated    Code = "unauthenticated"
+	CodeForbidden          Code = "forbidden"
+	CodeNotFound           Code = "not_found"
+	CodeAlreadyExists      Code = "already_exists"
+	CodeConflict           Code = "conflict"
+	CodePreconditionFailed Code = "precondition_failed"
+	CodeUnprocessable      Code = "unprocessable_entity"
+	CodeRateLimited        Code = "rate_limited"
+	CodeInternal           Code = "internal_error"
+
+	CodeIdempotencyKeyReused Code = "idempotency_key_reused"
+	CodeRequestInProgress    Code = "request_in_progress"
+)
+
+// FieldError describes a problem with a single request field.
+type FieldError struct {
+	Field   string `json:"field"`   // Field name as the client sent it (JSON or query name)
+	Code    string `json:"code"`    // Validation rule that failed, e.g. "required" or "email"
+	Message string `json:"message"` // Human-readable explanation
+}
+
+// Error is an error that knows how it should be presented to API clients.
+// The wrapped Err is for logs only and is never sent in a response.
+type Error struct {
+	Status int
+	Code   Code
+	Detail string
+	Fields []FieldError
+	Err    error
+}
+
+// Problem is the RFC 7807 problem details body, extended with a code and field errors.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     Code         `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+// Unwrap returns the underlying cause so errors.Is and errors.As keep working.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithFields attaches field-level details to the error and returns it.
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	e.Fields = append(e.Fields, fields...)
+	return e
+}
+
+// Problem renders the error as an RFC 7807 body.
+// Parameters:
+// - instance: The request path the problem occurred on.
+func (e *Error) Problem(instance string) Problem {
+	return Problem{
+		Type:     "/problems/" + string(e.Code),
+		Title:    http.StatusText(e.Status),
+		Status:   e.Status,
+		Detail:   e.Detail,
+		Instance: instance,
+		Code:     e.Code,
+		Errors:   e.Fields,
+	}
+}
+
+// New creates an error with the given status, code, and client-facing detail.
+func New(status int, code Code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// BadRequest creates a 400 error for requests that cannot be understood.
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeInvalidRequest, detail)
+}
+
+// Unauthorized creates a 401 error for missing or invalid credentials.
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthenticated, detail)
+}
+
+// Forbidden creates a 403 error for callers that lack permission.
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+// NotFound creates a 404 error.
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+// Conflict creates a 409 error with the given code.
+func Conflict(code Code, detail string) *Error {
+	return New(http.StatusConflict, code, detail)
+}
+
+// PreconditionFailed creates a 412 error for failed conditional requests.
+func PreconditionFailed(detail string) *Error {
+	return New(http.StatusPreconditionFailed, CodePreconditionFailed, detail)
+}
+
+// Unprocessable creates a 422 error with the given code.
+func Unprocessable(code Code, detail string) *Error {
+	return New(http.StatusUnprocessableEntity, code, detail)
+}
+
+// TooManyRequests creates a 429 error for callers that have to slow down.
+func TooManyRequests(detail string) *Error {
+	return New(http.StatusTooManyRequests, CodeRateLimited, detail)
+}
+
+// Internal creates a 500 error that hides err from the client.
+func Internal(err error) *Error {
+	return &Error{
+		Status: http.StatusInternalServerError,
+		Code:   CodeInternal,
+		Detail: "an unexpected error occurred",
+		Err:    err,
+	}
+}
+
+// From converts any error into an *Error.
+// Errors that are already *Error pass through. Binding and validation errors become 400s with field details,
+// sql.ErrNoRows becomes 404, Postgres constraint errors become 409 or 422, and anything else is a 500.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return fromValidation(validationErrs)
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: "request body is not valid JSON", Err: err}
+	case errors.As(err, &typeErr):
+		apiErr = &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: "request body has a field of the wrong type", Err: err}
+		return apiErr.WithFields(FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: fmt.Sprintf("must be of type %s", typeErr.Type),
+		})
+	case errors.Is(err, sql.ErrNoRows):
+		return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Detail: "resource not found", Err: err}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return fromPostgres(pqErr)
+	}
+
+	return Internal(err)
+}
+
+// FromBinding converts an error from binding or parsing request input into an *Error.
+// Validation errors keep their field details; anything else is reported as a malformed request.
+func FromBinding(err error) *Error {
+	apiErr := From(err)
+	if apiErr.Status >= http.StatusInternalServerError {
+		return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: err.Error(), Err: err}
+	}
+	return apiErr
+}
+
+// fromPostgres maps Postgres errors to client errors without echoing the database message.
+func fromPostgres(pqErr *pq.Error) *Error {
+	switch string(pqErr.Code) {
+	case db.UniqueViolation:
+		field, _ := db.UniqueViolationField(pqErr)
+		apiErr := &Error{Status: http.StatusConflict, Code: CodeAlreadyExists, Detail: "resource already exists", Err: pqErr}
+		if field != "" {
+			apiErr.Detail = fmt.Sprintf("%s already exists", field)
+			apiErr.WithFields(FieldError{Field: field, Code: "unique", Message: "is already taken"})
+		}
+		return apiErr
+	case db.ForeignKeyViolation:
+		return &Error{Status: http.StatusConflict, Code: CodeConflict, Detail: "resource is referenced by or references another resource", Err: pqErr}
+	}
+
+	switch pqErr.Code.Class() {
+	case "22", "23":
+		// Data exceptions and the remaining integrity constraint violations (not null, check, ...)
+		apiErr := &Error{Status: http.StatusUnprocessableEntity, Code: CodeUnprocessable, Detail: "request contains a value the database cannot store", Err: pqErr}
+		if pqErr.Column != "" {
+			apiErr.WithFields(FieldError{Field: pqErr.Column, Code: pqErr.Code.Name(), Message: "is not a valid value"})
+		}
+		return apiErr
+	}
+
+	return Internal(pqErr)
+}
+
+// fromValidation translates validator errors into field errors.
+func fromValidation(validationErrs validator.ValidationErrors) *Error {
+	apiErr := &Error{Status: http.StatusBadRequest, Code: CodeValidationFailed, Detail: "request failed validation", Err: validationErrs}
+	for _, fieldErr := range validationErrs {
+		apiErr.Fields = append(apiErr.Fields, FieldError{
+			Field:   fieldErr.Field(),
+			Code:    fieldErr.Tag(),
+			Message: validationMessage(fieldErr),
+		})
+	}
+	return apiErr
+}
+
+// validationMessage returns a short explanation for a failed validation rule.
+func validationMessage(fieldErr validator.FieldError) string {
+	isString := fieldErr.Kind() == reflect.String
+
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "url":
+		return "must be a valid URL"
+	case "min":
+		if isString {
+			return fmt.Sprintf("must be at least %s characters long", fieldErr.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fieldErr.Param())
+	case "max":
+		if isString {
+			return fmt.Sprintf("must be at most %s characters long", fieldErr.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fieldErr.Param())
+	case "len":
+		return fmt.Sprintf("must be exactly %s characters long", fieldErr.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fieldErr.Param())
+	case "datetime":
+		return fmt.Sprintf("must be a timestamp in the format %s", fieldErr.Param())
+	case "username":
+		return "must be 3-30 letters, digits, dots, dashes, or underscores, starting and ending with a letter or digit"
+	case "unreserved":
+		return "is reserved"
+	}
+	return fmt.Sprintf("failed the %s rule", fieldErr.Tag())
+}
+
+// Respond aborts the request and writes err as an application/problem+json response.
+// Server errors are logged with their underlying cause, which is never sent to the client.
+func Respond(ctx *gin.Context, err error) {
+	apiErr := From(err)
+
+	if apiErr.Status >= http.StatusInternalServerError {
+		log.Printf("%s %s: %v", ctx.Request.Method, ctx.Request.URL.Path, apiErr)
+	}
+
+	ctx.Header("Content-Type", ContentType)
+	ctx.AbortWithStatusJSON(apiErr.Status, apiErr.Problem(ctx.Request.URL.Path))
+}
@@ -0,0 +1,97 @@
+package apierror
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	db "whaleWake/db/sqlc"
+)
+
+func TestFrom(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		status int
+		code   Code
+	}{
+		{name: "PassThrough", err: Forbidden("nope"), status: http.StatusForbidden, code: CodeForbidden},
+		{name: "WrappedPassThrough", err: fmt.Errorf("wrapped: %w", NotFound("gone")), status: http.StatusNotFound, code: CodeNotFound},
+		{name: "NoRows", err: sql.ErrNoRows, status: http.StatusNotFound, code: CodeNotFound},
+		{name: "UniqueViolation", err: &pq.Error{Code: db.UniqueViolation, Constraint: "users_email_lower_key"}, status: http.StatusConflict, code: CodeAlreadyExists},
+		{name: "ForeignKeyViolation", err: &pq.Error{Code: db.ForeignKeyViolation}, status: http.StatusConflict, code: CodeConflict},
+		{name: "StringTooLong", err: &pq.Error{Code: "22001"}, status: http.StatusUnprocessableEntity, code: CodeUnprocessable},
+		{name: "NotNull", err: &pq.Error{Code: "23502", Column: "email"}, status: http.StatusUnprocessableEntity, code: CodeUnprocessable},
+		{name: "OtherPostgres", err: &pq.Error{Code: "53300"}, status: http.StatusInternalServerError, code: CodeInternal},
+		{name: "Syntax", err: json.Unmarshal([]byte("{"), &struct{}{}), status: http.StatusBadRequest, code: CodeInvalidRequest},
+		{name: "Unknown", err: errors.New("boom"), status: http.StatusInternalServerError, code: CodeInternal},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			apiErr := From(tc.err)
+			require.Equal(t, tc.status, apiErr.Status)
+			require.Equal(t, tc.code, apiErr.Code)
+		})
+	}
+}
+
+func TestFromUniqueViolationField(t *testing.T) {
+	apiErr := From(&pq.Error{Code: db.UniqueViolation, Constraint: "users_user_name_lower_key"})
+	require.Len(t, apiErr.Fields, 1)
+	require.Equal(t, "user_name", apiErr.Fields[0].Field)
+	require.Equal(t, "unique", apiErr.Fields[0].Code)
+}
+
+func TestFromValidation(t *testing.T) {
+	type request struct {
+		Email    string `validate:"required,email"`
+		Password string `validate:"min=8"`
+	}
+
+	err := validator.New().Struct(request{Email: "not-an-email", Password: "short"})
+	require.Error(t, err)
+
+	apiErr := From(err)
+	require.Equal(t, http.StatusBadRequest, apiErr.Status)
+	require.Equal(t, CodeValidationFailed, apiErr.Code)
+	require.Len(t, apiErr.Fields, 2)
+	require.Equal(t, "Email", apiErr.Fields[0].Field)
+	require.Equal(t, "email", apiErr.Fields[0].Code)
+	require.Equal(t, "must be a valid email address", apiErr.Fields[0].Message)
+	require.Equal(t, "min", apiErr.Fields[1].Code)
+	require.Equal(t, "must be at least 8 characters long", apiErr.Fields[1].Message)
+}
+
+func TestRespond(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/boom", func(ctx *gin.Context) {
+		Respond(ctx, errors.New("pq: secret table details"))
+	})
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/boom", nil)
+	require.NoError(t, err)
+	router.ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Equal(t, ContentType, recorder.Header().Get("Content-Type"))
+	require.NotContains(t, recorder.Body.String(), "secret")
+
+	var problem Problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+	require.Equal(t, CodeInternal, problem.Code)
+	require.Equal(t, http.StatusInternalServerError, problem.Status)
+	require.Equal(t, "/boom", problem.Instance)
+	require.Equal(t, "/problems/internal_error", problem.Type)
+}
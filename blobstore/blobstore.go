@@ -0,0 +1,70 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"whaleWake/util"
+)
+
+// Store kinds accepted by NewFromConfig.
+const (
+	KindLocal = "local"
+	KindS3    = "s3"
+)
+
+var (
+	ErrNotFound    = errors.New("blob not found")
+	ErrInvalidKey  = errors.New("blob keys must be relative slash-separated paths without . or .. segments")
+	ErrUnknownKind = errors.New("unknown blob store")
+)
+
+// Store keeps binary objects under slash-separated keys, such as "avatars/<user id>/<id>/original".
+// Implementations must be safe for concurrent use. Deleting a key that does not exist is not an error.
+type Store interface {
+	// Put stores data under key, replacing any object already there.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get opens the object under key. The caller closes the reader. Returns ErrNotFound for a missing key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object under key.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewFromConfig builds the store named by BLOB_STORE.
+// Parameters:
+// - config: BLOB_STORE selects KindLocal (the default) or KindS3. The local store writes under BLOB_LOCAL_DIR;
+// the S3 store uses the S3_* settings.
+// Returns:
+// - The store, or an error if the kind is unknown or its settings are incomplete.
+func NewFromConfig(config util.Config) (Store, error) {
+	switch config.BlobStore {
+	case "", KindLocal:
+		return NewLocalStore(config.BlobLocalDir)
+	case KindS3:
+		return NewS3Store(S3Config{
+			Endpoint:        config.S3Endpoint,
+			Region:          config.S3Region,
+			Bucket:          config.S3Bucket,
+			AccessKeyID:     config.S3AccessKeyID,
+			SecretAccessKey: config.S3SecretAccessKey,
+			PathStyle:       config.S3PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKind, config.BlobStore)
+	}
+}
+
+// checkKey rejects keys that could escape the store's root or address a directory.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config holds the settings of an S3-compatible store.
+// Fields:
+// - Endpoint: Base URL of the service, e.g. "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000" for MinIO.
+// - Region: The region requests are signed for; MinIO accepts "us-east-1".
+// - Bucket: The bucket objects are kept in. It must already exist.
+// - AccessKeyID, SecretAccessKey: The credentials requests are signed with.
+// - PathStyle: Address the bucket as a path segment (endpoint/bucket/key) rather than a host name
+// (bucket.endpoint/key). MinIO and most other stand-ins need path style.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool
+}
+
+// S3Store keeps objects in an S3-compatible bucket, signing requests with AWS Signature Version 4.
+type S3Store struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3Store creates a store for a bucket. No request is made until the store is used.
+func NewS3Store(config S3Config) (*S3Store, error) {
+	if config.Endpoint == "" || config.Region == "" || config.Bucket == "" ||
+		config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("the S3 blob store needs an endpoint, region, bucket, and credentials")
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+
+	return &S3Store{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+// objectURL returns the URL of a key.
+func (store *S3Store) objectURL(key string) *url.URL {
+	u := *store.endpoint
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if store.config.PathStyle {
+		u.Path = basePath + "/" + store.config.Bucket + "/" + key
+	} else {
+		u.Host = store.config.Bucket + "." + u.Host
+		u.Path = basePath + "/" + key
+	}
+	u.RawPath = ""
+	return &u
+}
+
+// do signs and sends a request for a key.
+func (store *S3Store) do(ctx context.Context, method, key string, data []byte, contentType string) (*http.Response, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, store.objectURL(key).String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	payloadHash := sha256.Sum256(data)
+	signV4(req, hex.EncodeToString(payloadHash[:]), store.config.AccessKeyID, store.config.SecretAccessKey,
+		store.config.Region, "s3", store.now())
+
+	return store.client.Do(req)
+}
+
+// Put uploads the object in a single request.
+func (store *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	rsp, err := store.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	return responseError(rsp, "put", key)
+}
+
+// Get downloads the object.
+func (store *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	rsp, err := store.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode == http.StatusNotFound {
+		rsp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if err = responseError(rsp, "get", key); err != nil {
+		rsp.Body.Close()
+		return nil, err
+	}
+	return rsp.Body, nil
+}
+
+// Delete removes the object. S3 answers 204 whether or not the key existed.
+func (store *S3Store) Delete(ctx context.Context, key string) error {
+	rsp, err := store.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return responseError(rsp, "delete", key)
+}
+
+// responseError turns a non-2xx response into an error that includes the start of the S3 error document.
+func responseError(rsp *http.Response, operation, key string) error {
+	if rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(rsp.Body, 512))
+	return fmt.Errorf("s3 %s %q: %s: %s", operation, key, rsp.Status, strings.TrimSpace(string(body)))
+}
+
+// signV4 signs a request with AWS Signature Version 4, setting the X-Amz-Date, X-Amz-Content-Sha256, and
+// Authorization headers. The host, Content-Type, Range, and every X-Amz-* header are signed.
+// Parameters:
+// - req: The request to sign. Its headers must be complete.
+// - payloadHash: The hex SHA-256 of the body.
+// - accessKeyID, secretAccessKey: The credentials.
+// - region, service: The scope, e.g. "us-east-1" and "s3".
+// - now: The signing time.
+func signV4(req *http.Request, payloadHash, accessKeyID, secretAccessKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalURI percent-encodes every path segment as SigV4 requires for S3: everything but unreserved
+// characters, keeping the slashes.
+func canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery sorts and encodes the query parameters.
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name)+"="+uriEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the characters RFC 3986 leaves unreserved.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+// Command rotate-keys re-encrypts the encrypted user profile and address fields, and their values in audit diffs,
+// under the current key and fills in missing blind indexes, a batch per transaction.
+//
+// To rotate, put the new key first in FIELD_ENCRYPTION_KEYS, keeping the old ones after it, restart the server,
+// and run this command. Once it finishes the old keys can be removed. Run it as well after turning encryption on,
+// to encrypt the rows written before.
+//
+// Usage:
+//
+//	go run ./cmd/rotate-keys [-config .] [-batch 500]
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"log"
+	db "whaleWake/db/sqlc"
+	"whaleWake/keyring"
+	"whaleWake/util"
+)
+
+func main() {
+	configPath := flag.String("config", ".", "directory holding the .env file")
+	batchSize := flag.Int("batch", 500, "rows re-encrypted per transaction")
+	flag.Parse()
+
+	if *batchSize < 1 {
+		log.Fatal("-batch must be at least 1")
+	}
+
+	config, err := util.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal("Unable to load config:", err)
+	}
+
+	ring, err := keyring.NewKeyring(config.FieldEncryptionKeys, config.BlindIndexKey)
+	if err != nil {
+		log.Fatal("Unable to load the field encryption keys:", err)
+	}
+
+	conn, err := sql.Open(config.DBDriver, config.DBSource)
+	if err != nil {
+		log.Fatal("Unable to connect to the db:", err)
+	}
+	defer conn.Close()
+
+	store := db.NewStore(conn, db.WithFieldCipher(ring))
+	ctx := context.Background()
+	limit := int32(*batchSize)
+
+	var scanned, rotated int
+	var afterProfile uuid.UUID
+	for {
+		batch, err := store.RotateProfileKeysTx(ctx, afterProfile, limit)
+		if err != nil {
+			log.Fatalf("user_profile: stopped after id %s: %v", afterProfile, err)
+		}
+		scanned += batch.Scanned
+		rotated += batch.Rotated
+		afterProfile = batch.LastID
+		if batch.Scanned < *batchSize {
+			break
+		}
+	}
+	log.Printf("user_profile: %d rows scanned, %d rewritten", scanned, rotated)
+
+	scanned, rotated = 0, 0
+	var afterHistory int64
+	for {
+		batch, err := store.RotateProfileHistoryKeysTx(ctx, afterHistory, limit)
+		if err != nil {
+			log.Fatalf("user_profile_history: stopped after id %d: %v", afterHistory, err)
+		}
+		scanned += batch.Scanned
+		rotated += batch.Rotated
+		afterHistory = batch.LastID
+		if batch.Scanned < *batchSize {
+			break
+		}
+	}
+	log.Printf("user_profile_history: %d rows scanned, %d rewritten", scanned, rotated)
+
+	scanned, rotated = 0, 0
+	var afterAddress uuid.UUID
+	for {
+		batch, err := store.RotateAddressKeysTx(ctx, afterAddress, limit)
+		if err != nil {
+			log.Fatalf("user_addresses: stopped after id %s: %v", afterAddress, err)
+		}
+		scanned += batch.Scanned
+		rotated += batch.Rotated
+		afterAddress = batch.LastID
+		if batch.Scanned < *batchSize {
+			break
+		}
+	}
+	log.Printf("user_addresses: %d rows scanned, %d rewritten", scanned, rotated)
+
+	scanned, rotated = 0, 0
+	var afterAudit int64
+	for {
+		batch, err := store.RotateAuditKeysTx(ctx, afterAudit, limit)
+		if err != nil {
+			log.Fatalf("audit_events: stopped after id %d: %v", afterAudit, err)
+		}
+		scanned += batch.Scanned
+		rotated += batch.Rotated
+		afterAudit = batch.LastID
+		if batch.Scanned < *batchSize {
+			break
+		}
+	}
+	log.Printf("audit_events: %d rows scanned, %d rewritten", scanned, rotated)
+}
@@ -0,0 +1,3 @@
+ALTER TABLE "user_role" DROP COLUMN IF EXISTS "version";
+ALTER TABLE "user_profile" DROP COLUMN IF EXISTS "version";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "version";
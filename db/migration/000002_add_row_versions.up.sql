@@ -0,0 +1,5 @@
+ALTER TABLE "users" ADD COLUMN "version" int NOT NULL DEFAULT 1;
+
+ALTER TABLE "user_profile" ADD COLUMN "version" int NOT NULL DEFAULT 1;
+
+ALTER TABLE "user_role" ADD COLUMN "version" int NOT NULL DEFAULT 1;
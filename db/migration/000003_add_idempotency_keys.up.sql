@@ -0,0 +1,12 @@
+CREATE TABLE "idempotency_keys" (
+                                    "key" varchar NOT NULL,
+                                    "request_path" varchar NOT NULL,
+                                    "request_hash" varchar NOT NULL,
+                                    "response_status" int,
+                                    "response_body" bytea,
+                                    "created_at" timestamptz NOT NULL DEFAULT (now()),
+                                    "completed_at" timestamptz,
+                                    PRIMARY KEY ("key", "request_path")
+);
+
+CREATE INDEX ON "idempotency_keys" ("created_at");
@@ -0,0 +1,4 @@
+-- Emails and user names are unique regardless of case. Existing duplicates must be resolved before migrating.
+CREATE UNIQUE INDEX "users_email_lower_key" ON "users" (lower("email"));
+
+CREATE UNIQUE INDEX "users_user_name_lower_key" ON "users" (lower("user_name"));
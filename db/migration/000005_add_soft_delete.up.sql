@@ -0,0 +1,12 @@
+-- Soft-deleted rows keep their email and user_name reserved until they are purged.
+ALTER TABLE "users" ADD COLUMN "deleted_at" timestamptz;
+
+ALTER TABLE "user_profile" ADD COLUMN "deleted_at" timestamptz;
+
+ALTER TABLE "user_role" ADD COLUMN "deleted_at" timestamptz;
+
+CREATE INDEX ON "users" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
+
+CREATE INDEX ON "user_profile" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
+
+CREATE INDEX ON "user_role" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
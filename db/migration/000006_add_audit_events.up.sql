@@ -0,0 +1,36 @@
+-- actor_id is NULL for actions taken by the system itself (e.g. the purge worker) or by anonymous sign-ups.
+-- target_id is always the user the row belongs to, so every change to a user, its profile, and role can be read together.
+CREATE TABLE "audit_events" (
+                                "id" bigserial PRIMARY KEY,
+                                "actor_id" uuid,
+                                "actor_role_id" int,
+                                "action" varchar NOT NULL,
+                                "target_type" varchar NOT NULL,
+                                "target_id" uuid NOT NULL,
+                                "before" jsonb NOT NULL DEFAULT '{}',
+                                "after" jsonb NOT NULL DEFAULT '{}',
+                                "request_id" varchar NOT NULL DEFAULT '',
+                                "ip" varchar NOT NULL DEFAULT '',
+                                "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "audit_events" ("target_id", "created_at");
+
+CREATE INDEX ON "audit_events" ("actor_id", "created_at");
+
+CREATE INDEX ON "audit_events" ("action");
+
+CREATE INDEX ON "audit_events" ("created_at");
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE
+    ON "audit_events"
+    FOR EACH ROW
+EXECUTE FUNCTION audit_events_append_only();
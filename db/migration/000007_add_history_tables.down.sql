@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_role_history;
+DROP TABLE IF EXISTS user_profile_history;
+DROP TABLE IF EXISTS users_history;
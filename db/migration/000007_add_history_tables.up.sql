@@ -0,0 +1,70 @@
+-- Every version of a user, profile, and role is kept here so their state at any point in time can be rebuilt.
+-- A row is valid from recorded_at until the next row for the same user. Passwords are never copied.
+CREATE TABLE "users_history" (
+                                 "id" bigserial PRIMARY KEY,
+                                 "user_id" uuid NOT NULL,
+                                 "version" int NOT NULL,
+                                 "user_name" varchar NOT NULL,
+                                 "email" varchar NOT NULL,
+                                 "created_at" timestamptz NOT NULL,
+                                 "updated_at" timestamptz NOT NULL,
+                                 "verified_at" timestamptz,
+                                 "deleted_at" timestamptz,
+                                 "recorded_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "user_profile_history" (
+                                        "id" bigserial PRIMARY KEY,
+                                        "profile_id" uuid NOT NULL,
+                                        "user_id" uuid NOT NULL,
+                                        "version" int NOT NULL,
+                                        "first_name" varchar NOT NULL,
+                                        "last_name" varchar NOT NULL,
+                                        "business_name" varchar NOT NULL,
+                                        "street_address" varchar NOT NULL,
+                                        "city" varchar NOT NULL,
+                                        "state" varchar NOT NULL,
+                                        "zip" varchar NOT NULL,
+                                        "country_code" varchar NOT NULL,
+                                        "created_at" timestamptz NOT NULL,
+                                        "updated_at" timestamptz NOT NULL,
+                                        "verified_at" timestamptz,
+                                        "deleted_at" timestamptz,
+                                        "recorded_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "user_role_history" (
+                                     "id" bigserial PRIMARY KEY,
+                                     "role_row_id" uuid NOT NULL,
+                                     "user_id" uuid NOT NULL,
+                                     "version" int NOT NULL,
+                                     "role_id" int NOT NULL,
+                                     "created_at" timestamptz NOT NULL,
+                                     "updated_at" timestamptz NOT NULL,
+                                     "verified_at" timestamptz,
+                                     "deleted_at" timestamptz,
+                                     "recorded_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "users_history" ("user_id", "recorded_at");
+
+CREATE INDEX ON "user_profile_history" ("user_id", "recorded_at");
+
+CREATE INDEX ON "user_role_history" ("user_id", "recorded_at");
+
+-- Existing rows start their history at their last update.
+INSERT INTO "users_history" (user_id, version, user_name, email, created_at, updated_at, verified_at, deleted_at, recorded_at)
+SELECT id, version, user_name, email, created_at, updated_at, verified_at, deleted_at, updated_at
+FROM "users";
+
+INSERT INTO "user_profile_history" (profile_id, user_id, version, first_name, last_name, business_name, street_address,
+                                    city, state, zip, country_code, created_at, updated_at, verified_at, deleted_at,
+                                    recorded_at)
+SELECT id, user_id, version, first_name, last_name, business_name, street_address,
+       city, state, zip, country_code, created_at, updated_at, verified_at, deleted_at,
+       updated_at
+FROM "user_profile";
+
+INSERT INTO "user_role_history" (role_row_id, user_id, version, role_id, created_at, updated_at, verified_at, deleted_at, recorded_at)
+SELECT id, user_id, version, role_id, created_at, updated_at, verified_at, deleted_at, updated_at
+FROM "user_role";
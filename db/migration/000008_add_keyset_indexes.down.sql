@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_created_at_id_idx;
+DROP INDEX IF EXISTS user_profile_created_at_id_idx;
+DROP INDEX IF EXISTS user_role_created_at_id_idx;
@@ -0,0 +1,6 @@
+-- Supports keyset pagination of the list queries, which page over live rows ordered by (created_at, id).
+CREATE INDEX ON "users" ("created_at", "id") WHERE "deleted_at" IS NULL;
+
+CREATE INDEX ON "user_profile" ("created_at", "id") WHERE "deleted_at" IS NULL;
+
+CREATE INDEX ON "user_role" ("created_at", "id") WHERE "deleted_at" IS NULL;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS users_email_id_idx;
+DROP INDEX IF EXISTS users_user_name_id_idx;
+DROP INDEX IF EXISTS users_updated_at_id_idx;
+DROP INDEX IF EXISTS users_verified_at_idx;
+DROP INDEX IF EXISTS user_profile_location_idx;
+DROP INDEX IF EXISTS user_profile_business_name_trgm_idx;
+DROP INDEX IF EXISTS user_profile_last_name_trgm_idx;
+DROP INDEX IF EXISTS user_profile_first_name_trgm_idx;
+DROP INDEX IF EXISTS users_email_trgm_idx;
+DROP INDEX IF EXISTS users_user_name_trgm_idx;
@@ -0,0 +1,23 @@
+-- Trigram indexes back the case-insensitive substring filters (ILIKE '%...%') on the user list.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX users_user_name_trgm_idx ON "users" USING gin ("user_name" gin_trgm_ops);
+
+CREATE INDEX users_email_trgm_idx ON "users" USING gin ("email" gin_trgm_ops);
+
+CREATE INDEX user_profile_first_name_trgm_idx ON "user_profile" USING gin ("first_name" gin_trgm_ops);
+
+CREATE INDEX user_profile_last_name_trgm_idx ON "user_profile" USING gin ("last_name" gin_trgm_ops);
+
+CREATE INDEX user_profile_business_name_trgm_idx ON "user_profile" USING gin ("business_name" gin_trgm_ops);
+
+-- Exact location filters and the selectable sort fields.
+CREATE INDEX user_profile_location_idx ON "user_profile" (upper("country_code"), lower("state"), lower("city"));
+
+CREATE INDEX users_verified_at_idx ON "users" ("verified_at");
+
+CREATE INDEX users_updated_at_id_idx ON "users" ("updated_at", "id") WHERE "deleted_at" IS NULL;
+
+CREATE INDEX users_user_name_id_idx ON "users" ("user_name", "id") WHERE "deleted_at" IS NULL;
+
+CREATE INDEX users_email_id_idx ON "users" ("email", "id") WHERE "deleted_at" IS NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS user_profile_search_trgm_idx;
+DROP INDEX IF EXISTS user_profile_search_tsv_idx;
+DROP INDEX IF EXISTS users_search_trgm_idx;
+DROP INDEX IF EXISTS users_search_tsv_idx;
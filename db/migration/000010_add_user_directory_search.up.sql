@@ -0,0 +1,16 @@
+-- Indexes for GET /users/search. Each table gets one search document: a tsvector for prefix matches and
+-- ranking, and a trigram index on the same text for typo-tolerant word similarity (<%).
+-- The expressions must stay identical to the ones in db/sqlc/user_search.go for the planner to use them.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX users_search_tsv_idx ON "users"
+    USING gin (to_tsvector('simple', "user_name" || ' ' || "email"));
+
+CREATE INDEX users_search_trgm_idx ON "users"
+    USING gin (("user_name" || ' ' || "email") gin_trgm_ops);
+
+CREATE INDEX user_profile_search_tsv_idx ON "user_profile"
+    USING gin (to_tsvector('simple', "first_name" || ' ' || "last_name" || ' ' || "business_name" || ' ' || "city" || ' ' || "state"));
+
+CREATE INDEX user_profile_search_trgm_idx ON "user_profile"
+    USING gin (("first_name" || ' ' || "last_name" || ' ' || "business_name" || ' ' || "city" || ' ' || "state") gin_trgm_ops);
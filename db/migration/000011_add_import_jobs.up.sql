@@ -0,0 +1,20 @@
+-- Background bulk imports started through POST /users/import. The uploaded rows are never stored here since they
+-- carry plain-text passwords; only progress and the per-row report are kept for GET /imports/:id.
+CREATE TABLE "import_jobs" (
+                               "id" uuid PRIMARY KEY DEFAULT (gen_random_uuid()),
+                               "created_by" uuid NOT NULL,
+                               "format" varchar NOT NULL,
+                               "dry_run" boolean NOT NULL DEFAULT false,
+                               "status" varchar NOT NULL DEFAULT 'running',
+                               "total_rows" int NOT NULL,
+                               "processed_rows" int NOT NULL DEFAULT 0,
+                               "succeeded_rows" int NOT NULL DEFAULT 0,
+                               "failed_rows" int NOT NULL DEFAULT 0,
+                               "results" jsonb NOT NULL DEFAULT '[]',
+                               "error" varchar NOT NULL DEFAULT '',
+                               "created_at" timestamptz NOT NULL DEFAULT (now()),
+                               "updated_at" timestamptz NOT NULL DEFAULT (now()),
+                               "finished_at" timestamptz
+);
+
+CREATE INDEX ON "import_jobs" ("created_by", "created_at");
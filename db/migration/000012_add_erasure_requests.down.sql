@@ -0,0 +1,9 @@
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS jsonb_erase_keys(jsonb, text[]);
+DROP TABLE IF EXISTS erasure_requests;
@@ -0,0 +1,40 @@
+-- Right-to-erasure requests. A pending request is carried out by the erasure worker once scheduled_for has passed,
+-- unless the user cancels it first. A user has at most one pending request at a time.
+CREATE TABLE "erasure_requests" (
+                                    "id" uuid PRIMARY KEY DEFAULT (gen_random_uuid()),
+                                    "user_id" uuid NOT NULL,
+                                    "status" varchar NOT NULL DEFAULT 'pending',
+                                    "requested_at" timestamptz NOT NULL DEFAULT (now()),
+                                    "scheduled_for" timestamptz NOT NULL,
+                                    "cancelled_at" timestamptz,
+                                    "completed_at" timestamptz
+);
+
+CREATE UNIQUE INDEX "erasure_requests_pending_user_id_key" ON "erasure_requests" ("user_id") WHERE "status" = 'pending';
+
+CREATE INDEX ON "erasure_requests" ("scheduled_for") WHERE "status" = 'pending';
+
+-- jsonb_erase_keys replaces the value of every listed key of a flat JSON object, keeping the keys so
+-- audit diffs still show which fields changed.
+CREATE FUNCTION jsonb_erase_keys(doc jsonb, keys text[]) RETURNS jsonb AS
+$$
+SELECT COALESCE(jsonb_object_agg(key, CASE WHEN key = ANY (keys) THEN to_jsonb('[ERASED]'::text) ELSE value END), '{}'::jsonb)
+FROM jsonb_each(doc);
+$$ LANGUAGE sql IMMUTABLE;
+
+-- audit_events stays append-only, except that an erasure may overwrite the personal data in before, after, and ip.
+-- The erasure enables this for its own transaction only by setting whalewake.audit_erasure.
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS
+$$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND current_setting('whalewake.audit_erasure', true) = 'on'
+        AND (NEW.id, NEW.actor_id, NEW.actor_role_id, NEW.action, NEW.target_type, NEW.target_id, NEW.request_id, NEW.created_at)
+            IS NOT DISTINCT FROM
+            (OLD.id, OLD.actor_id, OLD.actor_role_id, OLD.action, OLD.target_type, OLD.target_id, OLD.request_id, OLD.created_at)
+    THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
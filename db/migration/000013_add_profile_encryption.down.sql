@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS user_profile_zip_bidx_idx;
+DROP INDEX IF EXISTS user_profile_last_name_bidx_idx;
+DROP INDEX IF EXISTS user_profile_first_name_bidx_idx;
+ALTER TABLE "user_profile" DROP COLUMN IF EXISTS "zip_bidx";
+ALTER TABLE "user_profile" DROP COLUMN IF EXISTS "last_name_bidx";
+ALTER TABLE "user_profile" DROP COLUMN IF EXISTS "first_name_bidx";
@@ -0,0 +1,15 @@
+-- When field encryption is configured, first_name, last_name, street_address, and zip in user_profile and
+-- user_profile_history hold ciphertext (see the keyring package). The existing varchar columns are unbounded,
+-- so they hold it as they are. Blind indexes are HMACs of the normalized plaintext, for exact-match lookups;
+-- they stay NULL while encryption is off and are filled in by the rotate-keys command for older rows.
+ALTER TABLE "user_profile" ADD COLUMN "first_name_bidx" varchar;
+
+ALTER TABLE "user_profile" ADD COLUMN "last_name_bidx" varchar;
+
+ALTER TABLE "user_profile" ADD COLUMN "zip_bidx" varchar;
+
+CREATE INDEX user_profile_first_name_bidx_idx ON "user_profile" ("first_name_bidx") WHERE "deleted_at" IS NULL;
+
+CREATE INDEX user_profile_last_name_bidx_idx ON "user_profile" ("last_name_bidx") WHERE "deleted_at" IS NULL;
+
+CREATE INDEX user_profile_zip_bidx_idx ON "user_profile" ("zip_bidx") WHERE "deleted_at" IS NULL;
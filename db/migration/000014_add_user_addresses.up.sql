@@ -0,0 +1,31 @@
+-- A user's billing, shipping, and mailing addresses. Exactly one address per user is the default, and its location
+-- is mirrored in the address columns of user_profile so the profile, list filters, and search keep working.
+-- street_address and zip are encrypted like the profile columns they mirror.
+CREATE TABLE "user_addresses" (
+                                  "id" uuid PRIMARY KEY DEFAULT (gen_random_uuid()),
+                                  "user_id" uuid NOT NULL,
+                                  "type" varchar NOT NULL,
+                                  "label" varchar NOT NULL DEFAULT '',
+                                  "is_default" boolean NOT NULL DEFAULT false,
+                                  "street_address" varchar NOT NULL,
+                                  "city" varchar NOT NULL,
+                                  "state" varchar NOT NULL,
+                                  "zip" varchar NOT NULL,
+                                  "country_code" varchar NOT NULL,
+                                  "version" int NOT NULL DEFAULT 1,
+                                  "created_at" timestamptz NOT NULL DEFAULT (now()),
+                                  "updated_at" timestamptz NOT NULL DEFAULT (now()),
+                                  CONSTRAINT "user_addresses_type_check" CHECK ("type" IN ('billing', 'shipping', 'mailing'))
+);
+
+CREATE INDEX ON "user_addresses" ("user_id", "created_at");
+
+CREATE UNIQUE INDEX "user_addresses_default_user_id_key" ON "user_addresses" ("user_id") WHERE "is_default";
+
+ALTER TABLE "user_addresses" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+-- Every existing profile address becomes its user's default mailing address. Encrypted values are copied as they are:
+-- the column names match, so they decrypt the same way.
+INSERT INTO "user_addresses" (user_id, type, is_default, street_address, city, state, zip, country_code, created_at, updated_at)
+SELECT user_id, 'mailing', true, street_address, city, state, zip, country_code, created_at, updated_at
+FROM "user_profile";
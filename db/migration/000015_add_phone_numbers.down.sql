@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS phone_verifications;
+ALTER TABLE "user_profile_history" DROP COLUMN IF EXISTS "phone_verified_at";
+ALTER TABLE "user_profile_history" DROP COLUMN IF EXISTS "phone_number";
+ALTER TABLE "user_profile" DROP COLUMN IF EXISTS "phone_verified_at";
+ALTER TABLE "user_profile" DROP COLUMN IF EXISTS "phone_number";
@@ -0,0 +1,26 @@
+-- A profile has at most one phone number, in E.164 format, or '' when it has none. phone_verified_at is set once
+-- the user confirms a code sent to that number and cleared whenever the number changes.
+ALTER TABLE "user_profile" ADD COLUMN "phone_number" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "user_profile" ADD COLUMN "phone_verified_at" timestamptz;
+
+ALTER TABLE "user_profile_history" ADD COLUMN "phone_number" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "user_profile_history" ADD COLUMN "phone_verified_at" timestamptz;
+
+-- Codes sent to confirm a phone number. Only a hash of the code is kept. A code is spent once it has been
+-- confirmed, and is refused after it expires or after too many wrong attempts.
+CREATE TABLE "phone_verifications" (
+                                       "id" uuid PRIMARY KEY DEFAULT (gen_random_uuid()),
+                                       "user_id" uuid NOT NULL,
+                                       "phone_number" varchar NOT NULL,
+                                       "code_hash" varchar NOT NULL,
+                                       "attempts" int NOT NULL DEFAULT 0,
+                                       "created_at" timestamptz NOT NULL DEFAULT (now()),
+                                       "expires_at" timestamptz NOT NULL,
+                                       "verified_at" timestamptz
+);
+
+CREATE INDEX ON "phone_verifications" ("user_id", "created_at");
+
+ALTER TABLE "phone_verifications" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
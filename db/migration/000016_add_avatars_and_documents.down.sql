@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS blob_deletions;
+DROP TABLE IF EXISTS user_documents;
+ALTER TABLE "user_profile" DROP COLUMN IF EXISTS "avatar_content_type";
+ALTER TABLE "user_profile" DROP COLUMN IF EXISTS "avatar_key";
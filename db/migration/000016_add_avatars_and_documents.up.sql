@@ -0,0 +1,28 @@
+-- A profile has at most one avatar. avatar_key is the blob store key of the original image, or '' when there is
+-- none; the thumbnails are stored next to it. Replaced avatars are not kept in user_profile_history, since their
+-- blobs are deleted.
+ALTER TABLE "user_profile" ADD COLUMN "avatar_key" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "user_profile" ADD COLUMN "avatar_content_type" varchar NOT NULL DEFAULT '';
+
+-- Files uploaded by or for a user. The content is kept in the blob store under object_key.
+CREATE TABLE "user_documents" (
+                                  "id" uuid PRIMARY KEY DEFAULT (gen_random_uuid()),
+                                  "user_id" uuid NOT NULL,
+                                  "name" varchar NOT NULL,
+                                  "content_type" varchar NOT NULL,
+                                  "size_bytes" bigint NOT NULL,
+                                  "object_key" varchar UNIQUE NOT NULL,
+                                  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "user_documents" ("user_id", "created_at");
+
+ALTER TABLE "user_documents" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+-- Blobs waiting to be deleted from the blob store. Keys are queued in the same transaction that stops referring
+-- to them, and removed once the blob is gone, so a failed delete is retried rather than leaking the blob.
+CREATE TABLE "blob_deletions" (
+                                  "object_key" varchar PRIMARY KEY,
+                                  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
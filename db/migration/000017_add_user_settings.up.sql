@@ -0,0 +1,11 @@
+-- Preferences a user has changed from their defaults, one row per setting. Values are JSON checked against the
+-- schemas in the settings package; settings the user has not changed are not stored.
+CREATE TABLE "user_settings" (
+                                 "user_id" uuid NOT NULL,
+                                 "key" varchar NOT NULL,
+                                 "value" jsonb NOT NULL,
+                                 "updated_at" timestamptz NOT NULL DEFAULT (now()),
+                                 PRIMARY KEY ("user_id", "key")
+);
+
+ALTER TABLE "user_settings" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_attributes;
+DROP TABLE IF EXISTS attribute_definitions;
@@ -0,0 +1,33 @@
+-- Extra fields admins define for users, such as a license number or membership tier. Values are JSON checked
+-- against the definition when they are set. key and type cannot change once users may have values.
+CREATE TABLE "attribute_definitions" (
+                                         "id" uuid PRIMARY KEY DEFAULT (gen_random_uuid()),
+                                         "key" varchar UNIQUE NOT NULL,
+                                         "label" varchar NOT NULL,
+                                         "type" varchar NOT NULL,
+                                         "required" boolean NOT NULL DEFAULT false,
+                                         "enum_values" text[] NOT NULL DEFAULT '{}',
+                                         "pattern" varchar NOT NULL DEFAULT '',
+                                         "max_length" integer NOT NULL DEFAULT 0,
+                                         "minimum" bigint,
+                                         "maximum" bigint,
+                                         "created_at" timestamptz NOT NULL DEFAULT (now()),
+                                         "updated_at" timestamptz NOT NULL DEFAULT (now()),
+                                         CHECK ("type" IN ('string', 'integer', 'boolean', 'date'))
+);
+
+-- The attribute values of each user, one row per attribute that has a value. Deleting a definition deletes its
+-- values.
+CREATE TABLE "user_attributes" (
+                                   "user_id" uuid NOT NULL,
+                                   "definition_id" uuid NOT NULL,
+                                   "value" jsonb NOT NULL,
+                                   "updated_at" timestamptz NOT NULL DEFAULT (now()),
+                                   PRIMARY KEY ("user_id", "definition_id")
+);
+
+CREATE INDEX ON "user_attributes" ("definition_id");
+
+ALTER TABLE "user_attributes" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "user_attributes" ADD FOREIGN KEY ("definition_id") REFERENCES "attribute_definitions" ("id") ON DELETE CASCADE;
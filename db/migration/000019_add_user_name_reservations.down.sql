@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS users_user_name_not_reserved ON users;
+DROP FUNCTION IF EXISTS users_user_name_not_reserved();
+DROP TABLE IF EXISTS user_name_reservations;
@@ -0,0 +1,39 @@
+-- Old user names are kept for their previous owner for a grace period after a rename, so nobody else can take
+-- a name over while links and mentions still point at it. The owner may take a reserved name back.
+CREATE TABLE "user_name_reservations" (
+                                          "user_name" varchar NOT NULL,
+                                          "user_id" uuid NOT NULL,
+                                          "expires_at" timestamptz NOT NULL,
+                                          "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE UNIQUE INDEX "user_name_reservations_user_name_lower_key" ON "user_name_reservations" (lower("user_name"));
+
+CREATE INDEX ON "user_name_reservations" ("user_id");
+
+CREATE INDEX ON "user_name_reservations" ("expires_at");
+
+ALTER TABLE "user_name_reservations" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+-- Reports a name reserved for someone else as a unique violation of the reservation index, the same way a name
+-- in use is reported by users_user_name_lower_key.
+CREATE FUNCTION users_user_name_not_reserved() RETURNS trigger AS
+$$
+BEGIN
+    IF EXISTS(SELECT 1
+              FROM user_name_reservations
+              WHERE lower(user_name) = lower(NEW.user_name)
+                AND user_id <> NEW.id
+                AND expires_at > now()) THEN
+        RAISE EXCEPTION 'user name % is reserved', NEW.user_name
+            USING ERRCODE = 'unique_violation', CONSTRAINT = 'user_name_reservations_user_name_lower_key';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_user_name_not_reserved
+    BEFORE INSERT OR UPDATE OF user_name
+    ON "users"
+    FOR EACH ROW
+EXECUTE FUNCTION users_user_name_not_reserved();
@@ -0,0 +1,27 @@
+-- A change of email address waits here until it is confirmed with the token sent to the new address. The old
+-- address is told about the change and gets a revert token, which cancels a pending change or puts the old
+-- address back after it was confirmed. Only hashes of the tokens are kept.
+CREATE TABLE "email_changes" (
+                                 "id" uuid PRIMARY KEY DEFAULT (gen_random_uuid()),
+                                 "user_id" uuid NOT NULL,
+                                 "old_email" varchar NOT NULL,
+                                 "new_email" varchar NOT NULL,
+                                 "confirm_token_hash" varchar NOT NULL,
+                                 "revert_token_hash" varchar NOT NULL,
+                                 "created_at" timestamptz NOT NULL DEFAULT (now()),
+                                 "expires_at" timestamptz NOT NULL,
+                                 "revert_expires_at" timestamptz NOT NULL,
+                                 "confirmed_at" timestamptz,
+                                 "reverted_at" timestamptz,
+                                 "cancelled_at" timestamptz
+);
+
+CREATE UNIQUE INDEX ON "email_changes" ("confirm_token_hash");
+
+CREATE UNIQUE INDEX ON "email_changes" ("revert_token_hash");
+
+CREATE INDEX ON "email_changes" ("user_id", "created_at");
+
+CREATE INDEX ON "email_changes" ("revert_expires_at");
+
+ALTER TABLE "email_changes" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
@@ -0,0 +1,17 @@
+-- Events about users, written in the same transaction as the change they describe and published afterwards by
+-- the outbox relay, at least once and in order per user. Events only carry ids, so erasure has nothing to scrub.
+CREATE TABLE "outbox" (
+                          "id" bigserial PRIMARY KEY,
+                          "event_type" varchar NOT NULL,
+                          "user_id" uuid NOT NULL,
+                          "data" jsonb NOT NULL DEFAULT '{}',
+                          "created_at" timestamptz NOT NULL DEFAULT (now()),
+                          "attempts" int NOT NULL DEFAULT 0,
+                          "next_attempt_at" timestamptz NOT NULL DEFAULT (now()),
+                          "last_error" varchar NOT NULL DEFAULT '',
+                          "published_at" timestamptz
+);
+
+CREATE INDEX "outbox_unpublished_idx" ON "outbox" ("user_id", "id") WHERE "published_at" IS NULL;
+
+CREATE INDEX ON "outbox" ("published_at");
@@ -0,0 +1,41 @@
+-- Endpoints admins register to be sent user lifecycle events. Each delivery is signed with the secret, which is
+-- kept as is because it is needed to sign.
+CREATE TABLE "webhook_subscriptions" (
+                                         "id" uuid PRIMARY KEY DEFAULT (gen_random_uuid()),
+                                         "url" varchar NOT NULL,
+                                         "event_types" text[] NOT NULL,
+                                         "secret" varchar NOT NULL,
+                                         "active" boolean NOT NULL DEFAULT true,
+                                         "created_at" timestamptz NOT NULL DEFAULT (now()),
+                                         "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+-- One row per event and subscription, created with the outbox event so no event is missed. A delivery is
+-- pending until the endpoint accepts it, and dead once it has failed too often; dead deliveries stay until they
+-- are redelivered or the subscription is deleted. The event is copied, as the outbox row may be gone by then.
+CREATE TABLE "webhook_deliveries" (
+                                      "id" bigserial PRIMARY KEY,
+                                      "subscription_id" uuid NOT NULL,
+                                      "event_id" bigint NOT NULL,
+                                      "event_type" varchar NOT NULL,
+                                      "user_id" uuid NOT NULL,
+                                      "data" jsonb NOT NULL,
+                                      "occurred_at" timestamptz NOT NULL,
+                                      "status" varchar NOT NULL DEFAULT 'pending',
+                                      "attempts" int NOT NULL DEFAULT 0,
+                                      "next_attempt_at" timestamptz NOT NULL DEFAULT (now()),
+                                      "last_attempt_at" timestamptz,
+                                      "last_status_code" int NOT NULL DEFAULT 0,
+                                      "last_error" varchar NOT NULL DEFAULT '',
+                                      "delivered_at" timestamptz,
+                                      "created_at" timestamptz NOT NULL DEFAULT (now()),
+                                      CHECK ("status" IN ('pending', 'delivered', 'dead'))
+);
+
+CREATE INDEX "webhook_deliveries_due_idx" ON "webhook_deliveries" ("next_attempt_at") WHERE "status" = 'pending';
+
+CREATE INDEX ON "webhook_deliveries" ("subscription_id", "id");
+
+CREATE INDEX ON "webhook_deliveries" ("delivered_at");
+
+ALTER TABLE "webhook_deliveries" ADD FOREIGN KEY ("subscription_id") REFERENCES "webhook_subscriptions" ("id") ON DELETE CASCADE;
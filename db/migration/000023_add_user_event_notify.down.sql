@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS outbox_notify_user_event ON outbox;
+DROP FUNCTION IF EXISTS notify_user_event();
+ALTER TABLE outbox DROP COLUMN IF EXISTS stream_position;
+DROP SEQUENCE IF EXISTS outbox_stream_position_seq;
@@ -0,0 +1,47 @@
+-- The position of each event in the order the transactions that recorded them committed, for resuming the live
+-- event stream. Outbox ids are taken when a row is inserted, so a transaction that inserts first can commit
+-- last; positions are only handed out while committing. NULL until the event's transaction commits.
+CREATE SEQUENCE "outbox_stream_position_seq";
+
+ALTER TABLE "outbox" ADD COLUMN "stream_position" bigint UNIQUE;
+
+-- Events already in the outbox were committed, so they keep the order of their ids.
+UPDATE "outbox" o
+SET "stream_position" = p."stream_position"
+FROM (SELECT "id", row_number() OVER (ORDER BY "id") AS "stream_position" FROM "outbox") p
+WHERE o."id" = p."id";
+
+SELECT setval('outbox_stream_position_seq', COALESCE(max("stream_position"), 0) + 1, false)
+FROM "outbox";
+
+-- Gives every outbox event its stream position and announces it on the user_events channel. Runs as the
+-- transaction commits; the advisory lock is held until the commit is done, so a transaction that takes a later
+-- position is visible after every transaction with an earlier one. The payload is the event as published, which
+-- is small: event data only holds ids and versions.
+CREATE FUNCTION notify_user_event() RETURNS trigger AS
+$$
+DECLARE
+    stream_pos bigint;
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('outbox_stream_position'));
+    stream_pos := nextval('outbox_stream_position_seq');
+    UPDATE outbox SET stream_position = stream_pos WHERE id = NEW.id;
+
+    PERFORM pg_notify('user_events', json_build_object(
+            'id', NEW.id,
+            'position', stream_pos,
+            'type', NEW.event_type,
+            'user_id', NEW.user_id,
+            'occurred_at', NEW.created_at,
+            'data', NEW.data
+        )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER outbox_notify_user_event
+    AFTER INSERT
+    ON outbox
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW
+EXECUTE FUNCTION notify_user_event();
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS user_profile_search_trgm_idx;
+DROP INDEX IF EXISTS user_profile_search_tsv_idx;
+
+CREATE INDEX user_profile_search_tsv_idx ON "user_profile"
+    USING gin (to_tsvector('simple', "first_name" || ' ' || "last_name" || ' ' || "business_name" || ' ' || "city" || ' ' || "state"));
+
+CREATE INDEX user_profile_search_trgm_idx ON "user_profile"
+    USING gin (("first_name" || ' ' || "last_name" || ' ' || "business_name" || ' ' || "city" || ' ' || "state") gin_trgm_ops);
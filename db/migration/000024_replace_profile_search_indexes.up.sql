@@ -0,0 +1,12 @@
+-- first_name and last_name hold ciphertext when field encryption is configured, so the profile search indexes of
+-- migration 000010 indexed random text. They are rebuilt over the columns that are never encrypted; names are
+-- matched through their blind indexes, or without encryption by scanning the profiles.
+-- The expressions must stay identical to the ones in db/sqlc/user_search.go for the planner to use them.
+DROP INDEX IF EXISTS user_profile_search_trgm_idx;
+DROP INDEX IF EXISTS user_profile_search_tsv_idx;
+
+CREATE INDEX user_profile_search_tsv_idx ON "user_profile"
+    USING gin (to_tsvector('simple', "business_name" || ' ' || "city" || ' ' || "state"));
+
+CREATE INDEX user_profile_search_trgm_idx ON "user_profile"
+    USING gin (("business_name" || ' ' || "city" || ' ' || "state") gin_trgm_ops);
@@ -0,0 +1,14 @@
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS
+$$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND current_setting('whalewake.audit_erasure', true) = 'on'
+        AND (NEW.id, NEW.actor_id, NEW.actor_role_id, NEW.action, NEW.target_type, NEW.target_id, NEW.request_id, NEW.created_at)
+            IS NOT DISTINCT FROM
+            (OLD.id, OLD.actor_id, OLD.actor_role_id, OLD.action, OLD.target_type, OLD.target_id, OLD.request_id, OLD.created_at)
+    THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
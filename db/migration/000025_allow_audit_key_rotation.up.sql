@@ -0,0 +1,21 @@
+-- The diffs of profile and address changes hold the encrypted fields as ciphertext. Key rotation may rewrite before
+-- and after to re-encrypt them under the current key, and nothing else; it enables this for its own transaction
+-- only by setting whalewake.audit_key_rotation. Erasures keep the exception of migration 000012.
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS
+$$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND (NEW.id, NEW.actor_id, NEW.actor_role_id, NEW.action, NEW.target_type, NEW.target_id, NEW.request_id, NEW.created_at)
+            IS NOT DISTINCT FROM
+            (OLD.id, OLD.actor_id, OLD.actor_role_id, OLD.action, OLD.target_type, OLD.target_id, OLD.request_id, OLD.created_at)
+    THEN
+        IF current_setting('whalewake.audit_erasure', true) = 'on' THEN
+            RETURN NEW;
+        END IF;
+        IF current_setting('whalewake.audit_key_rotation', true) = 'on' AND NEW.ip IS NOT DISTINCT FROM OLD.ip THEN
+            RETURN NEW;
+        END IF;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
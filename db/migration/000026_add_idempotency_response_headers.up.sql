@@ -0,0 +1,3 @@
+-- The headers of a stored response that a replay has to repeat, such as the ETag of a created user.
+ALTER TABLE "idempotency_keys"
+    ADD COLUMN "response_headers" jsonb NOT NULL DEFAULT '{}';
@@ -0,0 +1,30 @@
+-- name: CreateAttributeDefinition :one
+INSERT INTO attribute_definitions (key, label, type, required, enum_values, pattern, max_length, minimum, maximum)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *;
+
+-- name: GetAttributeDefinition :one
+SELECT *
+FROM attribute_definitions
+WHERE id = $1;
+
+-- name: ListAttributeDefinitions :many
+SELECT *
+FROM attribute_definitions
+ORDER BY key;
+
+-- name: UpdateAttributeDefinition :one
+UPDATE attribute_definitions
+SET label       = sqlc.arg(label),
+    required    = sqlc.arg(required),
+    enum_values = sqlc.arg(enum_values),
+    pattern     = sqlc.arg(pattern),
+    max_length  = sqlc.arg(max_length),
+    minimum     = sqlc.narg(minimum),
+    maximum     = sqlc.narg(maximum),
+    updated_at  = STATEMENT_TIMESTAMP()
+WHERE id = sqlc.arg(id) RETURNING *;
+
+-- name: DeleteAttributeDefinition :one
+DELETE
+FROM attribute_definitions
+WHERE id = $1 RETURNING *;
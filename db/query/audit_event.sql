@@ -0,0 +1,47 @@
+-- name: CreateAuditEvent :one
+INSERT INTO audit_events (actor_id, actor_role_id, action, target_type, target_id, before, after, request_id, ip)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING *;
+
+-- name: ListAuditEvents :many
+-- Every filter is optional; events come back newest first.
+SELECT *
+FROM audit_events
+WHERE (sqlc.narg(actor_id)::uuid IS NULL OR actor_id = sqlc.narg(actor_id))
+  AND (sqlc.narg(target_id)::uuid IS NULL OR target_id = sqlc.narg(target_id))
+  AND (sqlc.narg(target_type)::varchar IS NULL OR target_type = sqlc.narg(target_type))
+  AND (sqlc.narg(action)::varchar IS NULL OR action = sqlc.narg(action))
+  AND (sqlc.narg(request_id)::varchar IS NULL OR request_id = sqlc.narg(request_id))
+  AND (sqlc.narg(created_after)::timestamptz IS NULL OR created_at >= sqlc.narg(created_after))
+  AND (sqlc.narg(created_before)::timestamptz IS NULL OR created_at < sqlc.narg(created_before))
+ORDER BY id DESC
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
+
+-- name: ListAuditEventsForUser :many
+-- Every change to the user, and every change the user made, oldest first.
+SELECT *
+FROM audit_events
+WHERE target_id = $1
+   OR actor_id = $1
+ORDER BY id;
+
+-- name: AllowAuditKeyRotation :exec
+-- Lets UpdateAuditEventEncryption update audit_events until the end of the transaction.
+SELECT set_config('whalewake.audit_key_rotation', 'on', true);
+
+-- name: ListAuditEventsForKeyRotation :many
+-- Keyset pagination over id, of the profile and address changes, whose diffs hold encrypted fields.
+-- Locks the page for the rest of the transaction.
+SELECT id, target_type, before, after
+FROM audit_events
+WHERE id > sqlc.arg(after_id)
+  AND target_type IN ('user_profile', 'user_address')
+ORDER BY id
+LIMIT sqlc.arg(page_limit) FOR UPDATE;
+
+-- name: UpdateAuditEventEncryption :exec
+-- Needs AllowAuditKeyRotation earlier in the same transaction.
+UPDATE audit_events
+SET before = sqlc.arg(before),
+    after  = sqlc.arg(after)
+WHERE id = sqlc.arg(id);
@@ -0,0 +1,17 @@
+-- name: EnqueueBlobDeletions :execrows
+-- Queues blobs for deletion. Keys that are already queued are left alone.
+INSERT INTO blob_deletions (object_key)
+SELECT unnest(sqlc.arg(object_keys)::text[])
+ON CONFLICT (object_key) DO NOTHING;
+
+-- name: ListBlobDeletions :many
+-- The oldest queued blobs. Locks them for the rest of the transaction and skips blobs another sweeper has locked.
+SELECT *
+FROM blob_deletions
+ORDER BY created_at, object_key
+LIMIT $1 FOR UPDATE SKIP LOCKED;
+
+-- name: DeleteBlobDeletion :exec
+DELETE
+FROM blob_deletions
+WHERE object_key = $1;
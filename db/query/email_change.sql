@@ -0,0 +1,54 @@
+-- name: CreateEmailChange :one
+INSERT INTO email_changes (user_id, old_email, new_email, confirm_token_hash, revert_token_hash, expires_at,
+                           revert_expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *;
+
+-- name: GetEmailChangeByConfirmTokenForUpdate :one
+SELECT *
+FROM email_changes
+WHERE confirm_token_hash = $1
+LIMIT 1 FOR UPDATE;
+
+-- name: GetEmailChangeByRevertTokenForUpdate :one
+SELECT *
+FROM email_changes
+WHERE revert_token_hash = $1
+LIMIT 1 FOR UPDATE;
+
+-- name: CancelPendingEmailChanges :execrows
+-- Cancels every change of a user's email address that has not been confirmed or reverted yet.
+UPDATE email_changes
+SET cancelled_at = STATEMENT_TIMESTAMP()
+WHERE user_id = $1
+  AND confirmed_at IS NULL
+  AND reverted_at IS NULL
+  AND cancelled_at IS NULL;
+
+-- name: MarkEmailChangeConfirmed :one
+UPDATE email_changes
+SET confirmed_at = STATEMENT_TIMESTAMP()
+WHERE id = $1 RETURNING *;
+
+-- name: MarkEmailChangeReverted :one
+UPDATE email_changes
+SET reverted_at = STATEMENT_TIMESTAMP()
+WHERE id = $1 RETURNING *;
+
+-- name: ListEmailChanges :many
+SELECT *
+FROM email_changes
+WHERE user_id = $1
+ORDER BY created_at, id;
+
+-- name: DeleteEmailChanges :execrows
+DELETE
+FROM email_changes
+WHERE user_id = $1;
+
+-- name: PurgeEmailChanges :execrows
+-- Removes changes that can no longer be reverted, and the changes of users that are being purged so the users can
+-- be deleted afterwards.
+DELETE
+FROM email_changes
+WHERE revert_expires_at < sqlc.arg(deleted_before)::timestamptz
+   OR user_id IN (SELECT id FROM users WHERE users.deleted_at < sqlc.arg(deleted_before)::timestamptz);
@@ -0,0 +1,109 @@
+-- name: CreateErasureRequest :one
+-- Returns no rows when the user already has a pending request.
+INSERT INTO erasure_requests (user_id, scheduled_for)
+VALUES ($1, $2)
+ON CONFLICT (user_id) WHERE status = 'pending' DO NOTHING
+RETURNING *;
+
+-- name: GetPendingErasureRequest :one
+SELECT *
+FROM erasure_requests
+WHERE user_id = $1
+  AND status = 'pending'
+LIMIT 1;
+
+-- name: ListErasureRequests :many
+SELECT *
+FROM erasure_requests
+WHERE user_id = $1
+ORDER BY requested_at, id;
+
+-- name: CancelErasureRequest :one
+UPDATE erasure_requests
+SET status       = 'cancelled',
+    cancelled_at = STATEMENT_TIMESTAMP()
+WHERE user_id = $1
+  AND status = 'pending'
+RETURNING *;
+
+-- name: ListDueErasureRequests :many
+-- Locks the due requests for the rest of the transaction; requests another worker has locked are skipped.
+SELECT *
+FROM erasure_requests
+WHERE status = 'pending'
+  AND scheduled_for <= $1
+ORDER BY scheduled_for, id
+FOR UPDATE SKIP LOCKED;
+
+-- name: CompleteErasureRequest :one
+UPDATE erasure_requests
+SET status       = 'completed',
+    completed_at = STATEMENT_TIMESTAMP()
+WHERE id = $1
+RETURNING *;
+
+-- name: AllowAuditErasure :exec
+-- Lets AnonymizeAuditEvents update audit_events until the end of the transaction.
+SELECT set_config('whalewake.audit_erasure', 'on', true);
+
+-- name: AnonymizeUser :one
+-- The user name and email become unique placeholders, and the empty password hash never matches a password.
+UPDATE users
+SET user_name  = 'erased-' || id,
+    email      = 'erased-' || id || '@erased.invalid',
+    password   = '',
+    version    = version + 1,
+    updated_at = STATEMENT_TIMESTAMP()
+WHERE id = $1
+RETURNING *;
+
+-- name: AnonymizeUserProfile :one
+UPDATE user_profile
+SET first_name          = '',
+    last_name           = '',
+    business_name       = '',
+    street_address      = '',
+    city                = '',
+    state               = '',
+    zip                 = '',
+    country_code        = '',
+    first_name_bidx     = NULL,
+    last_name_bidx      = NULL,
+    zip_bidx            = NULL,
+    phone_number        = '',
+    avatar_key          = '',
+    avatar_content_type = '',
+    version             = version + 1,
+    updated_at          = STATEMENT_TIMESTAMP()
+WHERE user_id = $1
+RETURNING *;
+
+-- name: AnonymizeUserHistory :execrows
+UPDATE users_history
+SET user_name = 'erased-' || user_id,
+    email     = 'erased-' || user_id || '@erased.invalid'
+WHERE user_id = $1;
+
+-- name: AnonymizeUserProfileHistory :execrows
+UPDATE user_profile_history
+SET first_name     = '',
+    last_name      = '',
+    business_name  = '',
+    street_address = '',
+    city           = '',
+    state          = '',
+    zip            = '',
+    country_code   = '',
+    phone_number   = ''
+WHERE user_id = $1;
+
+-- name: AnonymizeAuditEvents :execrows
+-- Erases the listed fields from the diffs of changes to the user, and the IP address of changes the user made.
+-- Changes the user made to other users keep their diffs, since those hold the other users' data.
+-- Needs AllowAuditErasure earlier in the same transaction.
+UPDATE audit_events
+SET before = CASE WHEN target_id = sqlc.arg(user_id) THEN jsonb_erase_keys(before, sqlc.arg(fields)::text[]) ELSE before END,
+    after  = CASE WHEN target_id = sqlc.arg(user_id) THEN jsonb_erase_keys(after, sqlc.arg(fields)::text[]) ELSE after END,
+    ip     = CASE WHEN actor_id = sqlc.arg(user_id) THEN '' ELSE ip END
+WHERE target_id = sqlc.arg(user_id)
+   OR actor_id = sqlc.arg(user_id);
@@ -0,0 +1,103 @@
+-- name: CreateUserHistory :one
+INSERT INTO users_history (user_id, version, user_name, email, created_at, updated_at, verified_at, deleted_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: ListUserHistory :many
+SELECT *
+FROM users_history
+WHERE user_id = $1
+ORDER BY recorded_at, id;
+
+-- name: GetUserAsOf :one
+SELECT *
+FROM users_history
+WHERE user_id = sqlc.arg(user_id)
+  AND recorded_at <= sqlc.arg(as_of)
+ORDER BY recorded_at DESC, id DESC
+LIMIT 1;
+
+-- name: DeleteUserHistory :execrows
+DELETE
+FROM users_history
+WHERE user_id = $1;
+
+-- name: CreateUserProfileHistory :one
+INSERT INTO user_profile_history (profile_id,
+                                  user_id,
+                                  version,
+                                  first_name,
+                                  last_name,
+                                  business_name,
+                                  street_address,
+                                  city,
+                                  state,
+                                  zip,
+                                  country_code,
+                                  created_at,
+                                  updated_at,
+                                  verified_at,
+                                  deleted_at,
+                                  phone_number,
+                                  phone_verified_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+RETURNING *;
+
+-- name: ListUserProfileHistory :many
+SELECT *
+FROM user_profile_history
+WHERE user_id = $1
+ORDER BY recorded_at, id;
+
+-- name: GetUserProfileAsOf :one
+SELECT *
+FROM user_profile_history
+WHERE user_id = sqlc.arg(user_id)
+  AND recorded_at <= sqlc.arg(as_of)
+ORDER BY recorded_at DESC, id DESC
+LIMIT 1;
+
+-- name: DeleteUserProfileHistory :execrows
+DELETE
+FROM user_profile_history
+WHERE user_id = $1;
+
+-- name: CreateUserRoleHistory :one
+INSERT INTO user_role_history (role_row_id, user_id, version, role_id, created_at, updated_at, verified_at, deleted_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: ListUserRoleHistory :many
+SELECT *
+FROM user_role_history
+WHERE user_id = $1
+ORDER BY recorded_at, id;
+
+-- name: GetUserRoleAsOf :one
+SELECT *
+FROM user_role_history
+WHERE user_id = sqlc.arg(user_id)
+  AND recorded_at <= sqlc.arg(as_of)
+ORDER BY recorded_at DESC, id DESC
+LIMIT 1;
+
+-- name: DeleteUserRoleHistory :execrows
+DELETE
+FROM user_role_history
+WHERE user_id = $1;
+
+-- name: ListUserProfileHistoryForKeyRotation :many
+-- Keyset pagination over id. Locks the page for the rest of the transaction.
+SELECT id, first_name, last_name, street_address, zip
+FROM user_profile_history
+WHERE id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(page_limit) FOR UPDATE;
+
+-- name: UpdateUserProfileHistoryEncryption :exec
+UPDATE user_profile_history
+SET first_name     = sqlc.arg(first_name),
+    last_name      = sqlc.arg(last_name),
+    street_address = sqlc.arg(street_address),
+    zip            = sqlc.arg(zip)
+WHERE id = sqlc.arg(id);
@@ -0,0 +1,34 @@
+-- name: CreateIdempotencyKey :one
+-- Returns no rows when the key is already taken for this path.
+INSERT INTO idempotency_keys (key, request_path, request_hash)
+VALUES ($1, $2, $3)
+ON CONFLICT (key, request_path) DO NOTHING
+RETURNING *;
+
+-- name: GetIdempotencyKey :one
+SELECT *
+FROM idempotency_keys
+WHERE key = $1
+  AND request_path = $2
+LIMIT 1;
+
+-- name: CompleteIdempotencyKey :one
+UPDATE idempotency_keys
+SET response_status  = $3,
+    response_body    = $4,
+    response_headers = $5,
+    completed_at     = STATEMENT_TIMESTAMP()
+WHERE key = $1
+  AND request_path = $2
+RETURNING *;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE
+FROM idempotency_keys
+WHERE key = $1
+  AND request_path = $2;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE
+FROM idempotency_keys
+WHERE created_at < $1;
@@ -0,0 +1,44 @@
+-- name: CreateImportJob :one
+INSERT INTO import_jobs (created_by, format, dry_run, total_rows)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetImportJob :one
+SELECT *
+FROM import_jobs
+WHERE id = $1
+LIMIT 1;
+
+-- name: UpdateImportJobProgress :one
+UPDATE import_jobs
+SET processed_rows = $2,
+    succeeded_rows = $3,
+    failed_rows    = $4,
+    updated_at     = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: FinishImportJob :one
+-- status is completed or failed; error explains a failed job.
+UPDATE import_jobs
+SET status         = $2,
+    processed_rows = $3,
+    succeeded_rows = $4,
+    failed_rows    = $5,
+    results        = $6,
+    error          = $7,
+    updated_at     = now(),
+    finished_at    = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: FailStaleImportJobs :execrows
+-- Fails the running jobs that have not saved progress since updated_before, because the process running them
+-- stopped without finishing them.
+UPDATE import_jobs
+SET status      = 'failed',
+    error       = sqlc.arg(error),
+    updated_at  = now(),
+    finished_at = now()
+WHERE status = 'running'
+  AND updated_at < sqlc.arg(updated_before)::timestamptz;
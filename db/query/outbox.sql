@@ -0,0 +1,54 @@
+-- name: CreateOutboxEvent :one
+INSERT INTO outbox (event_type, user_id, data)
+VALUES ($1, $2, $3) RETURNING *;
+
+-- name: ListDueOutboxEvents :many
+-- The oldest unpublished event of each user, if it is due. Later events of a user wait until the earlier ones
+-- are published, which keeps them in order. Locks the events for the rest of the transaction and skips events
+-- another relay has locked.
+SELECT *
+FROM outbox o
+WHERE o.published_at IS NULL
+  AND o.next_attempt_at <= sqlc.arg(now)::timestamptz
+  AND NOT EXISTS (SELECT 1
+                  FROM outbox earlier
+                  WHERE earlier.user_id = o.user_id
+                    AND earlier.published_at IS NULL
+                    AND earlier.id < o.id)
+ORDER BY o.id
+LIMIT sqlc.arg(page_limit) FOR UPDATE SKIP LOCKED;
+
+-- name: MarkOutboxEventPublished :exec
+UPDATE outbox
+SET published_at = STATEMENT_TIMESTAMP(),
+    attempts     = attempts + 1,
+    last_error   = ''
+WHERE id = $1;
+
+-- name: RetryOutboxEvent :exec
+UPDATE outbox
+SET attempts        = attempts + 1,
+    next_attempt_at = sqlc.arg(next_attempt_at),
+    last_error      = sqlc.arg(last_error)
+WHERE id = sqlc.arg(id);
+
+-- name: ListOutboxEventsForUser :many
+SELECT *
+FROM outbox
+WHERE user_id = $1
+ORDER BY id;
+
+-- name: ListOutboxEventsAfter :many
+-- Committed events after a stream position, in commit order, optionally only those of one user, for resuming the
+-- event stream.
+SELECT *
+FROM outbox
+WHERE stream_position > sqlc.arg(after_position)::bigint
+  AND (sqlc.narg(user_id)::uuid IS NULL OR user_id = sqlc.narg(user_id))
+ORDER BY stream_position
+LIMIT sqlc.arg(page_limit);
+
+-- name: PurgePublishedOutboxEvents :execrows
+DELETE
+FROM outbox
+WHERE published_at < sqlc.arg(published_before)::timestamptz;
@@ -0,0 +1,48 @@
+-- name: CreatePhoneVerification :one
+INSERT INTO phone_verifications (user_id, phone_number, code_hash, expires_at)
+VALUES ($1, $2, $3, $4) RETURNING *;
+
+-- name: CountPhoneVerificationsSince :one
+-- Counts the codes sent to a user since a time, for rate limiting.
+SELECT COUNT(*)
+FROM phone_verifications
+WHERE user_id = sqlc.arg(user_id)
+  AND created_at >= sqlc.arg(since);
+
+-- name: GetLatestPhoneVerificationForUpdate :one
+-- The most recent code for a user that has not been confirmed yet. Locks it for the rest of the transaction,
+-- so concurrent attempts are counted one at a time.
+SELECT *
+FROM phone_verifications
+WHERE user_id = $1
+  AND verified_at IS NULL
+ORDER BY created_at DESC, id DESC
+LIMIT 1 FOR UPDATE;
+
+-- name: IncrementPhoneVerificationAttempts :one
+UPDATE phone_verifications
+SET attempts = attempts + 1
+WHERE id = $1 RETURNING *;
+
+-- name: MarkPhoneVerificationVerified :one
+UPDATE phone_verifications
+SET verified_at = STATEMENT_TIMESTAMP()
+WHERE id = $1 RETURNING *;
+
+-- name: ListPhoneVerifications :many
+SELECT *
+FROM phone_verifications
+WHERE user_id = $1
+ORDER BY created_at, id;
+
+-- name: DeletePhoneVerifications :execrows
+DELETE
+FROM phone_verifications
+WHERE user_id = $1;
+
+-- name: PurgePhoneVerifications :execrows
+-- Removes expired codes, and the codes of users that are being purged so the users can be deleted afterwards.
+DELETE
+FROM phone_verifications
+WHERE expires_at < sqlc.arg(deleted_before)::timestamptz
+   OR user_id IN (SELECT id FROM users WHERE users.deleted_at < sqlc.arg(deleted_before)::timestamptz);
@@ -5,28 +5,71 @@ VALUES ($1, $2, $3) RETURNING *;
 -- name: GetUser :one
 SELECT *
 FROM users
-WHERE id = $1 LIMIT 1;
+WHERE id = $1
+  AND deleted_at IS NULL LIMIT 1;
 
 -- name: GetUserByEmail :one
 SELECT *
 FROM users
-WHERE email = $1 LIMIT 1;
+WHERE lower(email) = lower(sqlc.arg(email))
+  AND deleted_at IS NULL LIMIT 1;
+
+-- name: GetUserNameAndEmailTaken :one
+-- Checks both values the way the unique indexes do: case-insensitively and including soft-deleted users.
+-- A user name reserved after a rename counts as taken.
+SELECT (EXISTS(SELECT 1 FROM users WHERE lower(user_name) = lower(sqlc.arg(user_name))) OR
+        EXISTS(SELECT 1
+               FROM user_name_reservations
+               WHERE lower(user_name) = lower(sqlc.arg(user_name))
+                 AND expires_at > now()))::bool                                     AS user_name_taken,
+       EXISTS(SELECT 1 FROM users WHERE lower(email) = lower(sqlc.arg(email)))::bool     AS email_taken;
+
+-- name: GetUserForUpdate :one
+-- Locks the row for the rest of the transaction. Soft-deleted rows are included so restores can be audited.
+SELECT *
+FROM users
+WHERE id = $1
+LIMIT 1 FOR UPDATE;
 
 -- name: ListUsers :many
+-- Keyset pagination over (created_at, id). Leave the cursor null for the first page, then pass the last row's values.
 SELECT *
 FROM users
-ORDER BY id LIMIT $1
-OFFSET $2;
+WHERE deleted_at IS NULL
+  AND (sqlc.narg(cursor_created_at)::timestamptz IS NULL
+    OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamptz, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at, id
+LIMIT sqlc.arg(page_limit);
 
 -- name: UpdateUser :one
+-- expected_version is optional; when set the update only applies if the row is still at that version.
 UPDATE users
-SET user_name  = $2,
-    email      = $3,
-    password   = $4,
+SET user_name  = sqlc.arg(user_name),
+    email      = sqlc.arg(email),
+    password   = sqlc.arg(password),
+    version    = version + 1,
     updated_at = STATEMENT_TIMESTAMP()
-WHERE id = $1 RETURNING *;
+WHERE id = sqlc.arg(id)
+  AND deleted_at IS NULL
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)) RETURNING *;
 
 -- name: DeleteUser :one
+-- Soft deletes the user; the row is removed for good by PurgeDeletedUsers once the retention window passes.
+-- expected_version is optional; when set the delete only applies if the row is still at that version.
+UPDATE users
+SET deleted_at = STATEMENT_TIMESTAMP()
+WHERE id = sqlc.arg(id)
+  AND deleted_at IS NULL
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)) RETURNING *;
+
+-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL
+WHERE id = $1
+  AND deleted_at IS NOT NULL RETURNING *;
+
+-- name: PurgeDeletedUsers :many
 DELETE
 FROM users
-WHERE id = $1 RETURNING *;
\ No newline at end of file
+WHERE deleted_at < sqlc.arg(deleted_before)::timestamptz
+RETURNING id;
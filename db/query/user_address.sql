@@ -0,0 +1,100 @@
+-- name: CreateUserAddress :one
+INSERT INTO user_addresses (user_id,
+                            type,
+                            label,
+                            is_default,
+                            street_address,
+                            city,
+                            state,
+                            zip,
+                            country_code)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *;
+
+-- name: GetUserAddress :one
+SELECT *
+FROM user_addresses
+WHERE id = $1
+  AND user_id = $2 LIMIT 1;
+
+-- name: GetUserAddressForUpdate :one
+-- Locks the row for the rest of the transaction.
+SELECT *
+FROM user_addresses
+WHERE id = $1
+  AND user_id = $2
+LIMIT 1 FOR UPDATE;
+
+-- name: GetDefaultUserAddressForUpdate :one
+-- Locks the row for the rest of the transaction.
+SELECT *
+FROM user_addresses
+WHERE user_id = $1
+  AND is_default
+LIMIT 1 FOR UPDATE;
+
+-- name: ListUserAddresses :many
+-- The default address comes first, then the others oldest first.
+SELECT *
+FROM user_addresses
+WHERE user_id = $1
+ORDER BY is_default DESC, created_at, id;
+
+-- name: UpdateUserAddress :one
+-- expected_version is optional; when set the update only applies if the row is still at that version.
+UPDATE user_addresses
+SET type           = sqlc.arg(type),
+    label          = sqlc.arg(label),
+    is_default     = sqlc.arg(is_default),
+    street_address = sqlc.arg(street_address),
+    city           = sqlc.arg(city),
+    state          = sqlc.arg(state),
+    zip            = sqlc.arg(zip),
+    country_code   = sqlc.arg(country_code),
+    version        = version + 1,
+    updated_at     = STATEMENT_TIMESTAMP()
+WHERE id = sqlc.arg(id)
+  AND user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)) RETURNING *;
+
+-- name: UnsetDefaultUserAddress :one
+-- Clears the default flag so another address can take it; the partial unique index allows only one per user.
+UPDATE user_addresses
+SET is_default = false,
+    version    = version + 1,
+    updated_at = STATEMENT_TIMESTAMP()
+WHERE user_id = $1
+  AND is_default RETURNING *;
+
+-- name: DeleteUserAddress :one
+-- expected_version is optional; when set the delete only applies if the row is still at that version.
+DELETE
+FROM user_addresses
+WHERE id = sqlc.arg(id)
+  AND user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)) RETURNING *;
+
+-- name: DeleteUserAddresses :execrows
+DELETE
+FROM user_addresses
+WHERE user_id = $1;
+
+-- name: PurgeDeletedUserAddresses :execrows
+-- Removes the addresses of users that are being purged so the users can be deleted afterwards.
+DELETE
+FROM user_addresses
+WHERE user_id IN (SELECT id FROM users WHERE users.deleted_at < sqlc.arg(deleted_before)::timestamptz);
+
+-- name: ListUserAddressesForKeyRotation :many
+-- Keyset pagination over id. Locks the page for the rest of the transaction.
+SELECT id, street_address, zip
+FROM user_addresses
+WHERE id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(page_limit) FOR UPDATE;
+
+-- name: UpdateUserAddressEncryption :exec
+-- Rewrites the encrypted columns without a new version: the values themselves are unchanged.
+UPDATE user_addresses
+SET street_address = sqlc.arg(street_address),
+    zip            = sqlc.arg(zip)
+WHERE id = sqlc.arg(id);
@@ -0,0 +1,49 @@
+-- name: ListUserAttributes :many
+SELECT ua.definition_id, d.key, ua.value, ua.updated_at
+FROM user_attributes ua
+         JOIN attribute_definitions d ON d.id = ua.definition_id
+WHERE ua.user_id = $1
+ORDER BY d.key;
+
+-- name: ListUsersAttributes :many
+-- The attribute values of several users at once, for listings and exports.
+SELECT ua.user_id, d.key, ua.value
+FROM user_attributes ua
+         JOIN attribute_definitions d ON d.id = ua.definition_id
+WHERE ua.user_id = ANY (sqlc.arg(user_ids)::uuid[])
+ORDER BY ua.user_id, d.key;
+
+-- name: ListLiveUsersWithAttributeForUpdate :many
+-- The live users with a value for an attribute, locked in id order for the rest of the transaction.
+SELECT u.id
+FROM users u
+         JOIN user_attributes ua ON ua.user_id = u.id
+WHERE ua.definition_id = $1
+  AND u.deleted_at IS NULL
+ORDER BY u.id
+    FOR UPDATE OF u;
+
+-- name: UpsertUserAttribute :one
+INSERT INTO user_attributes (user_id, definition_id, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, definition_id) DO UPDATE
+    SET value      = excluded.value,
+        updated_at = STATEMENT_TIMESTAMP()
+RETURNING *;
+
+-- name: DeleteUserAttribute :execrows
+DELETE
+FROM user_attributes
+WHERE user_id = sqlc.arg(user_id)
+  AND definition_id = sqlc.arg(definition_id);
+
+-- name: DeleteUserAttributes :execrows
+DELETE
+FROM user_attributes
+WHERE user_id = $1;
+
+-- name: PurgeDeletedUserAttributes :execrows
+-- Removes the attribute values of users that are being purged so the users can be deleted afterwards.
+DELETE
+FROM user_attributes
+WHERE user_id IN (SELECT id FROM users WHERE users.deleted_at < sqlc.arg(deleted_before)::timestamptz);
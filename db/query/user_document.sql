@@ -0,0 +1,34 @@
+-- name: CreateUserDocument :one
+INSERT INTO user_documents (user_id, name, content_type, size_bytes, object_key)
+VALUES ($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: GetUserDocument :one
+SELECT *
+FROM user_documents
+WHERE id = sqlc.arg(id)
+  AND user_id = sqlc.arg(user_id);
+
+-- name: ListUserDocuments :many
+SELECT *
+FROM user_documents
+WHERE user_id = $1
+ORDER BY created_at, id;
+
+-- name: DeleteUserDocument :one
+DELETE
+FROM user_documents
+WHERE id = sqlc.arg(id)
+  AND user_id = sqlc.arg(user_id) RETURNING *;
+
+-- name: DeleteUserDocuments :many
+-- Removes all documents of a user and returns their keys, so the blobs can be queued for deletion.
+DELETE
+FROM user_documents
+WHERE user_id = $1 RETURNING object_key;
+
+-- name: PurgeDeletedUserDocuments :many
+-- Removes the documents of users that are being purged so the users can be deleted afterwards.
+DELETE
+FROM user_documents
+WHERE user_id IN (SELECT id FROM users WHERE users.deleted_at < sqlc.arg(deleted_before)::timestamptz)
+RETURNING object_key;
@@ -0,0 +1,44 @@
+-- name: ReserveUserName :one
+-- Keeps a user's old name for them until expires_at. A reservation of the same name that has expired, or that
+-- the user already held, is replaced.
+INSERT INTO user_name_reservations (user_name, user_id, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (lower(user_name)) DO UPDATE
+    SET user_name  = excluded.user_name,
+        user_id    = excluded.user_id,
+        expires_at = excluded.expires_at,
+        created_at = STATEMENT_TIMESTAMP()
+RETURNING *;
+
+-- name: ReleaseUserName :execrows
+-- Removes a user's own reservation of a name, e.g. when they take it back.
+DELETE
+FROM user_name_reservations
+WHERE lower(user_name) = lower(sqlc.arg(user_name))
+  AND user_id = sqlc.arg(user_id);
+
+-- name: ListUserNameReservations :many
+SELECT *
+FROM user_name_reservations
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetUserNameAvailability :one
+-- Checks a name the way the unique index and the reservation trigger do.
+SELECT EXISTS(SELECT 1 FROM users WHERE lower(user_name) = lower(sqlc.arg(user_name)))::bool AS taken,
+       EXISTS(SELECT 1
+              FROM user_name_reservations
+              WHERE lower(user_name) = lower(sqlc.arg(user_name))
+                AND expires_at > now())::bool                                          AS reserved;
+
+-- name: DeleteUserNameReservations :execrows
+DELETE
+FROM user_name_reservations
+WHERE user_id = $1;
+
+-- name: PurgeUserNameReservations :execrows
+-- Removes expired reservations, and those of users that are being purged so the users can be deleted afterwards.
+DELETE
+FROM user_name_reservations
+WHERE expires_at <= now()
+   OR user_id IN (SELECT id FROM users WHERE users.deleted_at < sqlc.arg(deleted_before)::timestamptz);
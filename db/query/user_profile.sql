@@ -7,34 +7,133 @@ INSERT INTO user_profile (user_id,
                           city,
                           state,
                           zip,
-                          country_code)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *;
+                          country_code,
+                          first_name_bidx,
+                          last_name_bidx,
+                          zip_bidx)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING *;
 
 -- name: GetUserProfile :one
 SELECT *
 FROM user_profile
-WHERE user_id = $1 LIMIT 1;
+WHERE user_id = $1
+  AND deleted_at IS NULL LIMIT 1;
+
+-- name: GetUserProfileForUpdate :one
+-- Locks the row for the rest of the transaction. Soft-deleted rows are included so restores can be audited.
+SELECT *
+FROM user_profile
+WHERE user_id = $1
+LIMIT 1 FOR UPDATE;
 
 -- name: ListUserProfiles :many
+-- Keyset pagination over (created_at, id). Leave the cursor null for the first page, then pass the last row's values.
 SELECT *
 FROM user_profile
-ORDER BY id LIMIT $1
-OFFSET $2;
+WHERE deleted_at IS NULL
+  AND (sqlc.narg(cursor_created_at)::timestamptz IS NULL
+    OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamptz, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at, id
+LIMIT sqlc.arg(page_limit);
 
 -- name: UpdateUserProfile :one
+-- expected_version is optional; when set the update only applies if the row is still at that version.
 UPDATE user_profile
-SET first_name = $2,
-    last_name = $3,
-    business_name = $4,
-    street_address = $5,
-    city = $6,
-    state = $7,
-    zip = $8,
-    country_code = $9,
+SET first_name = sqlc.arg(first_name),
+    last_name = sqlc.arg(last_name),
+    business_name = sqlc.arg(business_name),
+    street_address = sqlc.arg(street_address),
+    city = sqlc.arg(city),
+    state = sqlc.arg(state),
+    zip = sqlc.arg(zip),
+    country_code = sqlc.arg(country_code),
+    first_name_bidx = sqlc.narg(first_name_bidx),
+    last_name_bidx = sqlc.narg(last_name_bidx),
+    zip_bidx = sqlc.narg(zip_bidx),
+    version = version + 1,
     updated_at = STATEMENT_TIMESTAMP()
-WHERE user_id = $1 RETURNING *;
+WHERE user_id = sqlc.arg(user_id)
+  AND deleted_at IS NULL
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)) RETURNING *;
+
+-- name: UpdateUserProfilePhone :one
+-- Sets or clears the phone number. A new number is unverified; setting the same number again keeps the verification.
+-- expected_version is optional, as in UpdateUserProfile.
+UPDATE user_profile
+SET phone_verified_at = CASE WHEN phone_number = sqlc.arg(phone_number) THEN phone_verified_at END,
+    phone_number      = sqlc.arg(phone_number),
+    version           = version + 1,
+    updated_at        = STATEMENT_TIMESTAMP()
+WHERE user_id = sqlc.arg(user_id)
+  AND deleted_at IS NULL
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)) RETURNING *;
+
+-- name: VerifyUserProfilePhone :one
+-- Marks the phone number as verified. Returns no rows when the profile's number is no longer phone_number.
+UPDATE user_profile
+SET phone_verified_at = STATEMENT_TIMESTAMP(),
+    version           = version + 1,
+    updated_at        = STATEMENT_TIMESTAMP()
+WHERE user_id = sqlc.arg(user_id)
+  AND phone_number = sqlc.arg(phone_number)
+  AND deleted_at IS NULL RETURNING *;
+
+-- name: UpdateUserProfileAvatar :one
+-- Sets or clears the avatar. The caller queues the blobs of the previous avatar for deletion.
+UPDATE user_profile
+SET avatar_key          = sqlc.arg(avatar_key),
+    avatar_content_type = sqlc.arg(avatar_content_type),
+    version             = version + 1,
+    updated_at          = STATEMENT_TIMESTAMP()
+WHERE user_id = sqlc.arg(user_id)
+  AND deleted_at IS NULL RETURNING *;
 
 -- name: DeleteUserProfile :one
+-- Soft deletes the profile; the row is removed for good by PurgeDeletedUserProfiles.
+-- expected_version is optional, as in DeleteUser.
+UPDATE user_profile
+SET deleted_at = STATEMENT_TIMESTAMP()
+WHERE user_id = sqlc.arg(user_id)
+  AND deleted_at IS NULL
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version)) RETURNING *;
+
+-- name: RestoreUserProfile :one
+UPDATE user_profile
+SET deleted_at = NULL
+WHERE user_id = $1
+  AND deleted_at IS NOT NULL RETURNING *;
+
+-- name: ListPurgeableAvatarKeys :many
+-- The avatars of the profiles PurgeDeletedUserProfiles is about to remove.
+SELECT avatar_key
+FROM user_profile
+WHERE avatar_key <> ''
+  AND (user_profile.deleted_at < sqlc.arg(deleted_before)::timestamptz
+    OR user_id IN (SELECT id FROM users WHERE users.deleted_at < sqlc.arg(deleted_before)::timestamptz));
+
+-- name: PurgeDeletedUserProfiles :execrows
+-- Also removes profiles of users that are being purged so the users can be deleted afterwards.
 DELETE
 FROM user_profile
-WHERE user_id = $1 RETURNING *;
\ No newline at end of file
+WHERE user_profile.deleted_at < sqlc.arg(deleted_before)::timestamptz
+   OR user_id IN (SELECT id FROM users WHERE users.deleted_at < sqlc.arg(deleted_before)::timestamptz);
+
+-- name: ListUserProfilesForKeyRotation :many
+-- Keyset pagination over id, soft-deleted rows included. Locks the page for the rest of the transaction.
+SELECT id, first_name, last_name, street_address, zip, first_name_bidx, last_name_bidx, zip_bidx
+FROM user_profile
+WHERE id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(page_limit) FOR UPDATE;
+
+-- name: UpdateUserProfileEncryption :exec
+-- Rewrites the encrypted columns and blind indexes without a new version: the values themselves are unchanged.
+UPDATE user_profile
+SET first_name      = sqlc.arg(first_name),
+    last_name       = sqlc.arg(last_name),
+    street_address  = sqlc.arg(street_address),
+    zip             = sqlc.arg(zip),
+    first_name_bidx = sqlc.narg(first_name_bidx),
+    last_name_bidx  = sqlc.narg(last_name_bidx),
+    zip_bidx        = sqlc.narg(zip_bidx)
+WHERE id = sqlc.arg(id);
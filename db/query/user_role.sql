@@ -7,23 +7,57 @@ RETURNING *;
 SELECT *
 FROM user_role
 WHERE user_id = $1
+  AND deleted_at IS NULL
 LIMIT 1;
 
+-- name: GetUserRoleForUpdate :one
+-- Locks the row for the rest of the transaction. Soft-deleted rows are included so restores can be audited.
+SELECT *
+FROM user_role
+WHERE user_id = $1
+LIMIT 1 FOR UPDATE;
+
 -- name: ListUserRoles :many
+-- Keyset pagination over (created_at, id). Leave the cursor null for the first page, then pass the last row's values.
 SELECT *
 FROM user_role
-ORDER BY id
-LIMIT $1 OFFSET $2;
+WHERE deleted_at IS NULL
+  AND (sqlc.narg(cursor_created_at)::timestamptz IS NULL
+    OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamptz, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at, id
+LIMIT sqlc.arg(page_limit);
 
 -- name: UpdateUserRole :one
+-- expected_version is optional; when set the update only applies if the row is still at that version.
 UPDATE user_role
-SET role_id    = $2,
+SET role_id    = sqlc.arg(role_id),
+    version    = version + 1,
     updated_at = STATEMENT_TIMESTAMP()
-WHERE user_id = $1
+WHERE user_id = sqlc.arg(user_id)
+  AND deleted_at IS NULL
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version))
 RETURNING *;
 
 -- name: DeleteUserRole :one
+-- Soft deletes the role; the row is removed for good by PurgeDeletedUserRoles.
+-- expected_version is optional, as in DeleteUser.
+UPDATE user_role
+SET deleted_at = STATEMENT_TIMESTAMP()
+WHERE user_id = sqlc.arg(user_id)
+  AND deleted_at IS NULL
+  AND (sqlc.narg(expected_version)::int IS NULL OR version = sqlc.narg(expected_version))
+RETURNING *;
+
+-- name: RestoreUserRole :one
+UPDATE user_role
+SET deleted_at = NULL
+WHERE user_id = $1
+  AND deleted_at IS NOT NULL
+RETURNING *;
+
+-- name: PurgeDeletedUserRoles :execrows
+-- Also removes roles of users that are being purged so the users can be deleted afterwards.
 DELETE
 FROM user_role
-WHERE user_id = $1
-RETURNING *;
\ No newline at end of file
+WHERE user_role.deleted_at < sqlc.arg(deleted_before)::timestamptz
+   OR user_id IN (SELECT id FROM users WHERE users.deleted_at < sqlc.arg(deleted_before)::timestamptz);
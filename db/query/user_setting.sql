@@ -0,0 +1,30 @@
+-- name: ListUserSettings :many
+SELECT *
+FROM user_settings
+WHERE user_id = $1
+ORDER BY key;
+
+-- name: UpsertUserSetting :one
+INSERT INTO user_settings (user_id, key, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, key) DO UPDATE
+    SET value      = excluded.value,
+        updated_at = STATEMENT_TIMESTAMP()
+RETURNING *;
+
+-- name: DeleteUserSetting :execrows
+DELETE
+FROM user_settings
+WHERE user_id = sqlc.arg(user_id)
+  AND key = sqlc.arg(key);
+
+-- name: DeleteUserSettings :execrows
+DELETE
+FROM user_settings
+WHERE user_id = $1;
+
+-- name: PurgeDeletedUserSettings :execrows
+-- Removes the settings of users that are being purged so the users can be deleted afterwards.
+DELETE
+FROM user_settings
+WHERE user_id IN (SELECT id FROM users WHERE users.deleted_at < sqlc.arg(deleted_before)::timestamptz);
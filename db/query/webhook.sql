@@ -0,0 +1,84 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (url, event_types, secret, active)
+VALUES ($1, $2, $3, $4) RETURNING *;
+
+-- name: GetWebhookSubscription :one
+SELECT *
+FROM webhook_subscriptions
+WHERE id = $1;
+
+-- name: ListWebhookSubscriptions :many
+SELECT *
+FROM webhook_subscriptions
+ORDER BY created_at, id;
+
+-- name: UpdateWebhookSubscription :one
+-- An empty secret keeps the current one.
+UPDATE webhook_subscriptions
+SET url         = sqlc.arg(url),
+    event_types = sqlc.arg(event_types),
+    secret      = COALESCE(NULLIF(sqlc.arg(secret)::varchar, ''), secret),
+    active      = sqlc.arg(active),
+    updated_at  = STATEMENT_TIMESTAMP()
+WHERE id = sqlc.arg(id) RETURNING *;
+
+-- name: DeleteWebhookSubscription :one
+DELETE
+FROM webhook_subscriptions
+WHERE id = $1 RETURNING *;
+
+-- name: CreateWebhookDeliveries :execrows
+-- A delivery of the outbox event to every active subscription to its type.
+INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, user_id, data, occurred_at)
+SELECT s.id, o.id, o.event_type, o.user_id, o.data, o.created_at
+FROM outbox o
+         JOIN webhook_subscriptions s ON s.active AND o.event_type = ANY (s.event_types)
+WHERE o.id = $1;
+
+-- name: ListDueWebhookDeliveries :many
+-- Pending deliveries that are due, with where they go. Locks the deliveries for the rest of the transaction and
+-- skips deliveries another dispatcher has locked. Deliveries of inactive subscriptions wait.
+SELECT sqlc.embed(d), s.url, s.secret
+FROM webhook_deliveries d
+         JOIN webhook_subscriptions s ON s.id = d.subscription_id
+WHERE d.status = 'pending'
+  AND d.next_attempt_at <= sqlc.arg(now)::timestamptz
+  AND s.active
+ORDER BY d.next_attempt_at, d.id
+LIMIT sqlc.arg(page_limit) FOR UPDATE OF d SKIP LOCKED;
+
+-- name: RecordWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries
+SET status           = sqlc.arg(status),
+    attempts         = attempts + 1,
+    next_attempt_at  = sqlc.arg(next_attempt_at),
+    last_attempt_at  = sqlc.arg(attempted_at),
+    last_status_code = sqlc.arg(last_status_code),
+    last_error       = sqlc.arg(last_error),
+    delivered_at     = sqlc.narg(delivered_at)
+WHERE id = sqlc.arg(id) RETURNING *;
+
+-- name: ListWebhookDeliveries :many
+-- A subscription's deliveries, newest first, optionally only those in one status.
+SELECT *
+FROM webhook_deliveries
+WHERE subscription_id = sqlc.arg(subscription_id)
+  AND (sqlc.narg(status)::varchar IS NULL OR status = sqlc.narg(status))
+ORDER BY id DESC
+LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
+
+-- name: RedeliverWebhookDelivery :one
+-- Sends the delivery again as soon as possible, whatever its status, with a fresh set of attempts. The outcome
+-- of the last attempt is kept until the next one.
+UPDATE webhook_deliveries
+SET status          = 'pending',
+    attempts        = 0,
+    next_attempt_at = STATEMENT_TIMESTAMP(),
+    delivered_at    = NULL
+WHERE id = $1
+  AND subscription_id = $2 RETURNING *;
+
+-- name: PurgeDeliveredWebhookDeliveries :execrows
+DELETE
+FROM webhook_deliveries
+WHERE delivered_at < sqlc.arg(delivered_before)::timestamptz;
@@ -0,0 +1,208 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: attribute_definition.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createAttributeDefinition = `-- name: CreateAttributeDefinition :one
+INSERT INTO attribute_definitions (key, label, type, required, enum_values, pattern, max_length, minimum, maximum)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, key, label, type, required, enum_values, pattern, max_length, minimum, maximum, created_at, updated_at
+`
+
+type CreateAttributeDefinitionParams struct {
+	Key        string        `json:"key"`
+	Label      string        `json:"label"`
+	Type       string        `json:"type"`
+	Required   bool          `json:"required"`
+	EnumValues []string      `json:"enum_values"`
+	Pattern    string        `json:"pattern"`
+	MaxLength  int32         `json:"max_length"`
+	Minimum    sql.NullInt64 `json:"minimum"`
+	Maximum    sql.NullInt64 `json:"maximum"`
+}
+
+func (q *Queries) CreateAttributeDefinition(ctx context.Context, arg CreateAttributeDefinitionParams) (AttributeDefinition, error) {
+	row := q.db.QueryRowContext(ctx, createAttributeDefinition,
+		arg.Key,
+		arg.Label,
+		arg.Type,
+		arg.Required,
+		pq.Array(arg.EnumValues),
+		arg.Pattern,
+		arg.MaxLength,
+		arg.Minimum,
+		arg.Maximum,
+	)
+	var i AttributeDefinition
+	err := row.Scan(
+		&i.ID,
+		&i.Key,
+		&i.Label,
+		&i.Type,
+		&i.Required,
+		pq.Array(&i.EnumValues),
+		&i.Pattern,
+		&i.MaxLength,
+		&i.Minimum,
+		&i.Maximum,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteAttributeDefinition = `-- name: DeleteAttributeDefinition :one
+DELETE
+FROM attribute_definitions
+WHERE id = $1 RETURNING id, key, label, type, required, enum_values, pattern, max_length, minimum, maximum, created_at, updated_at
+`
+
+func (q *Queries) DeleteAttributeDefinition(ctx context.Context, id uuid.UUID) (AttributeDefinition, error) {
+	row := q.db.QueryRowContext(ctx, deleteAttributeDefinition, id)
+	var i AttributeDefinition
+	err := row.Scan(
+		&i.ID,
+		&i.Key,
+		&i.Label,
+		&i.Type,
+		&i.Required,
+		pq.Array(&i.EnumValues),
+		&i.Pattern,
+		&i.MaxLength,
+		&i.Minimum,
+		&i.Maximum,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getAttributeDefinition = `-- name: GetAttributeDefinition :one
+SELECT id, key, label, type, required, enum_values, pattern, max_length, minimum, maximum, created_at, updated_at
+FROM attribute_definitions
+WHERE id = $1
+`
+
+func (q *Queries) GetAttributeDefinition(ctx context.Context, id uuid.UUID) (AttributeDefinition, error) {
+	row := q.db.QueryRowContext(ctx, getAttributeDefinition, id)
+	var i AttributeDefinition
+	err := row.Scan(
+		&i.ID,
+		&i.Key,
+		&i.Label,
+		&i.Type,
+		&i.Required,
+		pq.Array(&i.EnumValues),
+		&i.Pattern,
+		&i.MaxLength,
+		&i.Minimum,
+		&i.Maximum,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listAttributeDefinitions = `-- name: ListAttributeDefinitions :many
+SELECT id, key, label, type, required, enum_values, pattern, max_length, minimum, maximum, created_at, updated_at
+FROM attribute_definitions
+ORDER BY key
+`
+
+func (q *Queries) ListAttributeDefinitions(ctx context.Context) ([]AttributeDefinition, error) {
+	rows, err := q.db.QueryContext(ctx, listAttributeDefinitions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AttributeDefinition{}
+	for rows.Next() {
+		var i AttributeDefinition
+		if err := rows.Scan(
+			&i.ID,
+			&i.Key,
+			&i.Label,
+			&i.Type,
+			&i.Required,
+			pq.Array(&i.EnumValues),
+			&i.Pattern,
+			&i.MaxLength,
+			&i.Minimum,
+			&i.Maximum,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateAttributeDefinition = `-- name: UpdateAttributeDefinition :one
+UPDATE attribute_definitions
+SET label       = $1,
+    required    = $2,
+    enum_values = $3,
+    pattern     = $4,
+    max_length  = $5,
+    minimum     = $6,
+    maximum     = $7,
+    updated_at  = STATEMENT_TIMESTAMP()
+WHERE id = $8 RETURNING id, key, label, type, required, enum_values, pattern, max_length, minimum, maximum, created_at, updated_at
+`
+
+type UpdateAttributeDefinitionParams struct {
+	Label      string        `json:"label"`
+	Required   bool          `json:"required"`
+	EnumValues []string      `json:"enum_values"`
+	Pattern    string        `json:"pattern"`
+	MaxLength  int32         `json:"max_length"`
+	Minimum    sql.NullInt64 `json:"minimum"`
+	Maximum    sql.NullInt64 `json:"maximum"`
+	ID         uuid.UUID     `json:"id"`
+}
+
+func (q *Queries) UpdateAttributeDefinition(ctx context.Context, arg UpdateAttributeDefinitionParams) (AttributeDefinition, error) {
+	row := q.db.QueryRowContext(ctx, updateAttributeDefinition,
+		arg.Label,
+		arg.Required,
+		pq.Array(arg.EnumValues),
+		arg.Pattern,
+		arg.MaxLength,
+		arg.Minimum,
+		arg.Maximum,
+		arg.ID,
+	)
+	var i AttributeDefinition
+	err := row.Scan(
+		&i.ID,
+		&i.Key,
+		&i.Label,
+		&i.Type,
+		&i.Required,
+		pq.Array(&i.EnumValues),
+		&i.Pattern,
+		&i.MaxLength,
+		&i.Minimum,
+		&i.Maximum,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
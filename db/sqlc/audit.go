@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"reflect"
+)
+
+// Audit actions recorded in audit_events.action.
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+	AuditActionErase   = "erase"
+)
+
+// Audit target types recorded in audit_events.target_type.
+const (
+	AuditTargetUser           = "user"
+	AuditTargetUserProfile    = "user_profile"
+	AuditTargetUserRole       = "user_role"
+	AuditTargetUserAddress    = "user_address"
+	AuditTargetUserDocument   = "user_document"
+	AuditTargetUserSettings   = "user_settings"
+	AuditTargetUserAttributes = "user_attributes"
+)
+
+// auditRedacted replaces the value of sensitive fields in audit diffs.
+const auditRedacted = "[REDACTED]"
+
+// auditRedactedFields are never written to the audit log in the clear. A change is still recorded.
+var auditRedactedFields = map[string]bool{
+	"password": true,
+}
+
+// auditIgnoredFields change on every write and would only add noise to diffs.
+// Blind indexes change with the encrypted field they index, which is already in the diff.
+var auditIgnoredFields = map[string]bool{
+	"updated_at":      true,
+	"version":         true,
+	"first_name_bidx": true,
+	"last_name_bidx":  true,
+	"zip_bidx":        true,
+}
+
+// Actor identifies who is making a change and where the request came from.
+// Fields:
+// - UserID: The authenticated user, or uuid.Nil for anonymous requests and the system itself.
+// - RoleID: The role of the authenticated user, or 0 when there is none.
+// - RequestID: The request ID the change was made under.
+// - IP: The client IP address.
+type Actor struct {
+	UserID    uuid.UUID
+	RoleID    int32
+	RequestID string
+	IP        string
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a copy of ctx carrying the actor that store mutations are attributed to.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored by WithActor, if any.
+func ActorFromContext(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorContextKey{}).(Actor)
+	return actor, ok
+}
+
+// recordAudit writes an audit event using the transaction's queries, so the event commits or rolls back with the change.
+// Parameters:
+// - ctx: The context carrying the actor, see WithActor.
+// - q: The queries bound to the current transaction.
+// - action: One of the AuditAction constants.
+// - targetType: One of the AuditTarget constants.
+// - targetID: The user the changed row belongs to.
+// - before, after: The row before and after the change. Either may be nil. Only changed fields are kept.
+// Returns:
+// - An error if the diff cannot be built or the event cannot be inserted.
+func recordAudit(ctx context.Context, q *Queries, action, targetType string, targetID uuid.UUID, before, after interface{}) error {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return err
+	}
+
+	beforeDiff, afterDiff := auditDiff(beforeFields, afterFields)
+
+	beforeJSON, err := json.Marshal(beforeDiff)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(afterDiff)
+	if err != nil {
+		return err
+	}
+
+	arg := CreateAuditEventParams{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     beforeJSON,
+		After:      afterJSON,
+	}
+
+	if actor, ok := ActorFromContext(ctx); ok {
+		if actor.UserID != uuid.Nil {
+			arg.ActorID = uuid.NullUUID{UUID: actor.UserID, Valid: true}
+			arg.ActorRoleID = sql.NullInt32{Int32: actor.RoleID, Valid: true}
+		}
+		arg.RequestID = actor.RequestID
+		arg.Ip = actor.IP
+	}
+
+	_, err = q.CreateAuditEvent(ctx, arg)
+	return err
+}
+
+// auditFields flattens a row into its JSON fields, turning sql.Null* values into plain values or null.
+func auditFields(row interface{}) (map[string]interface{}, error) {
+	if row == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for name, value := range fields {
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		valid, ok := nested["Valid"].(bool)
+		if !ok || len(nested) != 2 {
+			continue
+		}
+		fields[name] = nil
+		if valid {
+			for key, inner := range nested {
+				if key != "Valid" {
+					fields[name] = inner
+				}
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// auditDiff keeps only the fields that differ between before and after, and redacts sensitive values.
+// When one side is missing (a create or a purge) the other side is kept whole.
+func auditDiff(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	beforeDiff := map[string]interface{}{}
+	afterDiff := map[string]interface{}{}
+
+	for name, value := range before {
+		if auditIgnoredFields[name] {
+			continue
+		}
+		if after != nil && reflect.DeepEqual(value, after[name]) {
+			continue
+		}
+		beforeDiff[name] = auditValue(name, value)
+	}
+
+	for name, value := range after {
+		if auditIgnoredFields[name] {
+			continue
+		}
+		if before != nil && reflect.DeepEqual(value, before[name]) {
+			continue
+		}
+		afterDiff[name] = auditValue(name, value)
+	}
+
+	return beforeDiff, afterDiff
+}
+
+// auditValue returns the value to store for a field, hiding sensitive ones.
+func auditValue(name string, value interface{}) interface{} {
+	if auditRedactedFields[name] && value != nil {
+		return auditRedacted
+	}
+	return value
+}
@@ -0,0 +1,257 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: audit_event.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+const allowAuditKeyRotation = `-- name: AllowAuditKeyRotation :exec
+SELECT set_config('whalewake.audit_key_rotation', 'on', true)
+`
+
+// Lets UpdateAuditEventEncryption update audit_events until the end of the transaction.
+func (q *Queries) AllowAuditKeyRotation(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, allowAuditKeyRotation)
+	return err
+}
+
+const createAuditEvent = `-- name: CreateAuditEvent :one
+INSERT INTO audit_events (actor_id, actor_role_id, action, target_type, target_id, before, after, request_id, ip)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, actor_id, actor_role_id, action, target_type, target_id, before, after, request_id, ip, created_at
+`
+
+type CreateAuditEventParams struct {
+	ActorID     uuid.NullUUID   `json:"actor_id"`
+	ActorRoleID sql.NullInt32   `json:"actor_role_id"`
+	Action      string          `json:"action"`
+	TargetType  string          `json:"target_type"`
+	TargetID    uuid.UUID       `json:"target_id"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	RequestID   string          `json:"request_id"`
+	Ip          string          `json:"ip"`
+}
+
+func (q *Queries) CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error) {
+	row := q.db.QueryRowContext(ctx, createAuditEvent,
+		arg.ActorID,
+		arg.ActorRoleID,
+		arg.Action,
+		arg.TargetType,
+		arg.TargetID,
+		arg.Before,
+		arg.After,
+		arg.RequestID,
+		arg.Ip,
+	)
+	var i AuditEvent
+	err := row.Scan(
+		&i.ID,
+		&i.ActorID,
+		&i.ActorRoleID,
+		&i.Action,
+		&i.TargetType,
+		&i.TargetID,
+		&i.Before,
+		&i.After,
+		&i.RequestID,
+		&i.Ip,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listAuditEvents = `-- name: ListAuditEvents :many
+SELECT id, actor_id, actor_role_id, action, target_type, target_id, before, after, request_id, ip, created_at
+FROM audit_events
+WHERE ($1::uuid IS NULL OR actor_id = $1)
+  AND ($2::uuid IS NULL OR target_id = $2)
+  AND ($3::varchar IS NULL OR target_type = $3)
+  AND ($4::varchar IS NULL OR action = $4)
+  AND ($5::varchar IS NULL OR request_id = $5)
+  AND ($6::timestamptz IS NULL OR created_at >= $6)
+  AND ($7::timestamptz IS NULL OR created_at < $7)
+ORDER BY id DESC
+LIMIT $9 OFFSET $8
+`
+
+type ListAuditEventsParams struct {
+	ActorID       uuid.NullUUID  `json:"actor_id"`
+	TargetID      uuid.NullUUID  `json:"target_id"`
+	TargetType    sql.NullString `json:"target_type"`
+	Action        sql.NullString `json:"action"`
+	RequestID     sql.NullString `json:"request_id"`
+	CreatedAfter  sql.NullTime   `json:"created_after"`
+	CreatedBefore sql.NullTime   `json:"created_before"`
+	PageOffset    int32          `json:"page_offset"`
+	PageLimit     int32          `json:"page_limit"`
+}
+
+// Every filter is optional; events come back newest first.
+func (q *Queries) ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditEvents,
+		arg.ActorID,
+		arg.TargetID,
+		arg.TargetType,
+		arg.Action,
+		arg.RequestID,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.PageOffset,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AuditEvent{}
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.ActorID,
+			&i.ActorRoleID,
+			&i.Action,
+			&i.TargetType,
+			&i.TargetID,
+			&i.Before,
+			&i.After,
+			&i.RequestID,
+			&i.Ip,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditEventsForKeyRotation = `-- name: ListAuditEventsForKeyRotation :many
+SELECT id, target_type, before, after
+FROM audit_events
+WHERE id > $1
+  AND target_type IN ('user_profile', 'user_address')
+ORDER BY id
+LIMIT $2 FOR UPDATE
+`
+
+type ListAuditEventsForKeyRotationParams struct {
+	AfterID   int64 `json:"after_id"`
+	PageLimit int32 `json:"page_limit"`
+}
+
+type ListAuditEventsForKeyRotationRow struct {
+	ID         int64           `json:"id"`
+	TargetType string          `json:"target_type"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+}
+
+// Keyset pagination over id, of the profile and address changes, whose diffs hold encrypted fields.
+// Locks the page for the rest of the transaction.
+func (q *Queries) ListAuditEventsForKeyRotation(ctx context.Context, arg ListAuditEventsForKeyRotationParams) ([]ListAuditEventsForKeyRotationRow, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditEventsForKeyRotation, arg.AfterID, arg.PageLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListAuditEventsForKeyRotationRow{}
+	for rows.Next() {
+		var i ListAuditEventsForKeyRotationRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TargetType,
+			&i.Before,
+			&i.After,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditEventsForUser = `-- name: ListAuditEventsForUser :many
+SELECT id, actor_id, actor_role_id, action, target_type, target_id, before, after, request_id, ip, created_at
+FROM audit_events
+WHERE target_id = $1
+   OR actor_id = $1
+ORDER BY id
+`
+
+// Every change to the user, and every change the user made, oldest first.
+func (q *Queries) ListAuditEventsForUser(ctx context.Context, targetID uuid.UUID) ([]AuditEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditEventsForUser, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AuditEvent{}
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.ActorID,
+			&i.ActorRoleID,
+			&i.Action,
+			&i.TargetType,
+			&i.TargetID,
+			&i.Before,
+			&i.After,
+			&i.RequestID,
+			&i.Ip,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateAuditEventEncryption = `-- name: UpdateAuditEventEncryption :exec
+UPDATE audit_events
+SET before = $1,
+    after  = $2
+WHERE id = $3
+`
+
+type UpdateAuditEventEncryptionParams struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+	ID     int64           `json:"id"`
+}
+
+// Needs AllowAuditKeyRotation earlier in the same transaction.
+func (q *Queries) UpdateAuditEventEncryption(ctx context.Context, arg UpdateAuditEventEncryptionParams) error {
+	_, err := q.db.ExecContext(ctx, updateAuditEventEncryption, arg.Before, arg.After, arg.ID)
+	return err
+}
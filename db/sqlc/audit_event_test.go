@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"whaleWake/util"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := User{
+		ID:       util.RandomUUID(),
+		UserName: "before",
+		Email:    "same@example.com",
+		Password: "old-hash",
+		Version:  1,
+	}
+	after := before
+	after.UserName = "after"
+	after.Password = "new-hash"
+	after.Version = 2
+	after.UpdatedAt = time.Now()
+	after.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	beforeFields, err := auditFields(before)
+	require.NoError(t, err)
+	afterFields, err := auditFields(after)
+	require.NoError(t, err)
+
+	beforeDiff, afterDiff := auditDiff(beforeFields, afterFields)
+
+	// Unchanged and bookkeeping fields are dropped; passwords are redacted on both sides
+	require.Equal(t, map[string]interface{}{
+		"user_name":  "before",
+		"password":   auditRedacted,
+		"deleted_at": nil,
+	}, beforeDiff)
+	require.Len(t, afterDiff, 3)
+	require.Equal(t, "after", afterDiff["user_name"])
+	require.Equal(t, auditRedacted, afterDiff["password"])
+	require.NotNil(t, afterDiff["deleted_at"])
+
+	// A create keeps the whole row, still without the password
+	beforeDiff, afterDiff = auditDiff(nil, afterFields)
+	require.Empty(t, beforeDiff)
+	require.Equal(t, auditRedacted, afterDiff["password"])
+	require.Equal(t, "same@example.com", afterDiff["email"])
+	require.NotContains(t, afterDiff, "version")
+}
+
+func TestCreateUserWithRoleTxAudit(t *testing.T) {
+	store := NewStore(testDB)
+	actorID := util.RandomUUID()
+	ctx := WithActor(context.Background(), Actor{UserID: actorID, RoleID: 3, RequestID: "req-create", IP: "203.0.113.1"})
+
+	result, err := store.CreateUserWithRoleTx(ctx,
+		CreateUserParams{
+			UserName: util.RandomUserName(),
+			Email:    util.RandomEmail(),
+			Password: util.RandomPassword(),
+		},
+		CreateUserRoleParams{RoleID: 1})
+	require.NoError(t, err)
+	require.Equal(t, result.User.ID, result.UserRole.UserID)
+
+	events, err := store.ListAuditEvents(context.Background(), ListAuditEventsParams{
+		TargetID:  uuid.NullUUID{UUID: result.User.ID, Valid: true},
+		PageLimit: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	for _, event := range events {
+		require.Equal(t, AuditActionCreate, event.Action)
+		require.Equal(t, uuid.NullUUID{UUID: actorID, Valid: true}, event.ActorID)
+		require.Equal(t, int32(3), event.ActorRoleID.Int32)
+		require.Equal(t, "req-create", event.RequestID)
+		require.Equal(t, "203.0.113.1", event.Ip)
+		require.NotContains(t, string(event.After), result.User.Password)
+	}
+}
+
+func TestUpdateUserWithProfileAndRoleTxAudit(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+	actorID := util.RandomUUID()
+	ctx := WithActor(context.Background(), Actor{UserID: actorID, RoleID: 3, RequestID: "req-promote"})
+
+	_, err := store.UpdateUserWithProfileAndRoleTX(ctx,
+		UpdateUserParams{
+			ID:       created.User.ID,
+			UserName: created.User.UserName,
+			Email:    created.User.Email,
+			Password: created.User.Password,
+		},
+		UpdateUserProfileParams{
+			FirstName:     created.UserProfile.FirstName,
+			LastName:      created.UserProfile.LastName,
+			BusinessName:  created.UserProfile.BusinessName,
+			StreetAddress: created.UserProfile.StreetAddress,
+			City:          created.UserProfile.City,
+			State:         created.UserProfile.State,
+			Zip:           created.UserProfile.Zip,
+			CountryCode:   created.UserProfile.CountryCode,
+		},
+		UpdateUserRoleParams{RoleID: 3}, nil)
+	require.NoError(t, err)
+
+	events, err := store.ListAuditEvents(context.Background(), ListAuditEventsParams{
+		TargetID:   uuid.NullUUID{UUID: created.User.ID, Valid: true},
+		TargetType: sql.NullString{String: AuditTargetUserRole, Valid: true},
+		Action:     sql.NullString{String: AuditActionUpdate, Valid: true},
+		PageLimit:  10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, uuid.NullUUID{UUID: actorID, Valid: true}, events[0].ActorID)
+	require.Equal(t, "req-promote", events[0].RequestID)
+
+	var before, after map[string]interface{}
+	require.NoError(t, json.Unmarshal(events[0].Before, &before))
+	require.NoError(t, json.Unmarshal(events[0].After, &after))
+	require.Equal(t, map[string]interface{}{"role_id": float64(1)}, before)
+	require.Equal(t, map[string]interface{}{"role_id": float64(3)}, after)
+
+	// Nothing changed on the user row itself, so its event carries empty diffs
+	events, err = store.ListAuditEvents(context.Background(), ListAuditEventsParams{
+		TargetID:   uuid.NullUUID{UUID: created.User.ID, Valid: true},
+		TargetType: sql.NullString{String: AuditTargetUser, Valid: true},
+		Action:     sql.NullString{String: AuditActionUpdate, Valid: true},
+		PageLimit:  10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.JSONEq(t, `{}`, string(events[0].Before))
+	require.JSONEq(t, `{}`, string(events[0].After))
+}
+
+func TestAuditEventsAreAppendOnly(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+
+	_, err := testDB.Exec(`UPDATE audit_events SET action = 'tampered' WHERE target_id = $1`, created.User.ID)
+	require.Error(t, err)
+
+	_, err = testDB.Exec(`DELETE FROM audit_events WHERE target_id = $1`, created.User.ID)
+	require.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"path"
+)
+
+// AvatarThumbnailSizes are the widths, in pixels, of the square thumbnails stored with every avatar.
+var AvatarThumbnailSizes = []int{64, 256}
+
+// NewAvatarKey returns a new blob store key for the original image of a user's avatar.
+// Every upload gets its own key, so a replaced avatar can be deleted later without racing the new one.
+func NewAvatarKey(userID uuid.UUID) string {
+	return fmt.Sprintf("avatars/%s/%s/original", userID, uuid.New())
+}
+
+// AvatarThumbnailKey returns the key of the thumbnail of an avatar, stored next to the original as a PNG.
+// Parameters:
+// - key: The key of the original image, as returned by NewAvatarKey.
+// - size: One of AvatarThumbnailSizes.
+func AvatarThumbnailKey(key string, size int) string {
+	return fmt.Sprintf("%s/%d.png", path.Dir(key), size)
+}
+
+// NewDocumentKey returns a new blob store key for a document of a user.
+func NewDocumentKey(userID uuid.UUID) string {
+	return fmt.Sprintf("documents/%s/%s", userID, uuid.New())
+}
+
+// avatarObjectKeys returns the keys of an avatar and its thumbnails, or nothing when key is empty.
+func avatarObjectKeys(key string) []string {
+	if key == "" {
+		return nil
+	}
+	keys := []string{key}
+	for _, size := range AvatarThumbnailSizes {
+		keys = append(keys, AvatarThumbnailKey(key, size))
+	}
+	return keys
+}
+
+// queueBlobDeletions queues blobs for deletion by SweepBlobDeletionsTx within the caller's transaction.
+func queueBlobDeletions(ctx context.Context, q *Queries, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := q.EnqueueBlobDeletions(ctx, keys)
+	return err
+}
+
+// SetUserAvatarTx sets, replaces, or clears the avatar of a user's profile, as a new profile version.
+// The blobs of the previous avatar are queued for deletion. The new blobs have to be stored before calling this.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The user and the key and content type of the original image, or empty strings to clear the avatar.
+// Returns:
+// - The updated profile, decrypted.
+// - sql.ErrNoRows if the profile does not exist or is deleted.
+func (store *SQLStore) SetUserAvatarTx(ctx context.Context, arg UpdateUserProfileAvatarParams) (UserProfile, error) {
+	var result UserProfile
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		before, err := q.GetUserProfileForUpdate(ctx, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		result, err = q.UpdateUserProfileAvatar(ctx, arg)
+		if err != nil {
+			return err
+		}
+
+		if before.AvatarKey != arg.AvatarKey {
+			if err = queueBlobDeletions(ctx, q, avatarObjectKeys(before.AvatarKey)); err != nil {
+				return err
+			}
+		}
+
+		err = recordAudit(ctx, q, AuditActionUpdate, AuditTargetUserProfile, arg.UserID, before, result)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserProfileHistory(ctx, q, result)
+		if err != nil {
+			return err
+		}
+
+		return recordUserUpdated(ctx, q, arg.UserID)
+	})
+
+	if err == nil {
+		err = store.decryptProfile(&result)
+	}
+
+	return result, err
+}
+
+// SweepBlobDeletionsTx deletes the oldest queued blobs and removes them from the queue.
+// The queued rows stay locked while fn runs, so several sweepers can run at once without deleting the same blob.
+// A blob that fn fails to delete stays queued and is tried again by the next sweep.
+// Parameters:
+// - ctx: The context for the transaction.
+// - limit: The most blobs to delete.
+// - fn: Deletes one blob from the blob store. It should succeed for blobs that are already gone.
+// Returns:
+// - The number of blobs deleted.
+// - The first error returned by fn, or an error if the transaction fails.
+func (store *SQLStore) SweepBlobDeletionsTx(ctx context.Context, limit int32, fn func(key string) error) (int64, error) {
+	var deleted int64
+	var deleteErr error
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		deletions, err := q.ListBlobDeletions(ctx, limit)
+		if err != nil {
+			return err
+		}
+
+		for _, deletion := range deletions {
+			if err = fn(deletion.ObjectKey); err != nil {
+				if deleteErr == nil {
+					deleteErr = fmt.Errorf("delete blob %s: %w", deletion.ObjectKey, err)
+				}
+				continue
+			}
+			if err = q.DeleteBlobDeletion(ctx, deletion.ObjectKey); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+	return deleted, deleteErr
+}
@@ -0,0 +1,69 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: blob_deletion.sql
+
+package db
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+)
+
+const deleteBlobDeletion = `-- name: DeleteBlobDeletion :exec
+DELETE
+FROM blob_deletions
+WHERE object_key = $1
+`
+
+func (q *Queries) DeleteBlobDeletion(ctx context.Context, objectKey string) error {
+	_, err := q.db.ExecContext(ctx, deleteBlobDeletion, objectKey)
+	return err
+}
+
+const enqueueBlobDeletions = `-- name: EnqueueBlobDeletions :execrows
+INSERT INTO blob_deletions (object_key)
+SELECT unnest($1::text[])
+ON CONFLICT (object_key) DO NOTHING
+`
+
+// Queues blobs for deletion. Keys that are already queued are left alone.
+func (q *Queries) EnqueueBlobDeletions(ctx context.Context, objectKeys []string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enqueueBlobDeletions, pq.Array(objectKeys))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listBlobDeletions = `-- name: ListBlobDeletions :many
+SELECT object_key, created_at
+FROM blob_deletions
+ORDER BY created_at, object_key
+LIMIT $1 FOR UPDATE SKIP LOCKED
+`
+
+// The oldest queued blobs. Locks them for the rest of the transaction and skips blobs another sweeper has locked.
+func (q *Queries) ListBlobDeletions(ctx context.Context, limit int32) ([]BlobDeletion, error) {
+	rows, err := q.db.QueryContext(ctx, listBlobDeletions, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []BlobDeletion{}
+	for rows.Next() {
+		var i BlobDeletion
+		if err := rows.Scan(&i.ObjectKey, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
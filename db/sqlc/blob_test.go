@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAvatarsAndDocuments(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+	userID := created.User.ID
+
+	first := NewAvatarKey(userID)
+	profile, err := store.SetUserAvatarTx(context.Background(), UpdateUserProfileAvatarParams{
+		UserID:            userID,
+		AvatarKey:         first,
+		AvatarContentType: "image/png",
+	})
+	require.NoError(t, err)
+	require.Equal(t, first, profile.AvatarKey)
+	require.Equal(t, created.UserProfile.Version+1, profile.Version)
+
+	// Replacing the avatar queues the original and thumbnails of the old one.
+	profile, err = store.SetUserAvatarTx(context.Background(), UpdateUserProfileAvatarParams{
+		UserID:            userID,
+		AvatarKey:         NewAvatarKey(userID),
+		AvatarContentType: "image/jpeg",
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, first, profile.AvatarKey)
+
+	document, err := store.CreateUserDocumentTx(context.Background(), CreateUserDocumentParams{
+		UserID:      userID,
+		Name:        "contract.pdf",
+		ContentType: "application/pdf",
+		SizeBytes:   42,
+		ObjectKey:   NewDocumentKey(userID),
+	})
+	require.NoError(t, err)
+
+	documents, err := store.ListUserDocuments(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+
+	_, err = store.DeleteUserDocumentTx(context.Background(), DeleteUserDocumentParams{ID: document.ID, UserID: userID})
+	require.NoError(t, err)
+
+	// Sweep until the queued keys of this test are gone; other tests may have queued keys as well.
+	swept := map[string]bool{}
+	for {
+		deleted, err := store.SweepBlobDeletionsTx(context.Background(), 100, func(key string) error {
+			swept[key] = true
+			return nil
+		})
+		require.NoError(t, err)
+		if deleted == 0 {
+			break
+		}
+	}
+	for _, key := range avatarObjectKeys(first) {
+		require.True(t, swept[key], key)
+	}
+	require.True(t, swept[document.ObjectKey])
+	require.False(t, swept[profile.AvatarKey])
+}
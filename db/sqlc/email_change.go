@@ -0,0 +1,265 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrEmailUnchanged is returned when a change is requested to the address the user already has.
+	ErrEmailUnchanged = errors.New("the email address is unchanged")
+	// ErrEmailTaken is returned when a change is requested to an address another user has.
+	ErrEmailTaken = errors.New("the email address is taken")
+	// ErrEmailChangeTokenInvalid is returned for a token that does not belong to any email change.
+	ErrEmailChangeTokenInvalid = errors.New("the email change token is not valid")
+	// ErrEmailChangeTokenExpired is returned for a token that has expired, was already used, or belongs to a change
+	// that has been replaced, cancelled, or overtaken by a later change.
+	ErrEmailChangeTokenExpired = errors.New("the email change token has expired")
+)
+
+// StartEmailChangeParams holds the details of a new email change.
+// Fields:
+// - UserID: The user whose address changes.
+// - NewEmail: The address to change to, once confirmed.
+// - ConfirmTokenHash: A hash of the token sent to the new address; the token itself is never stored.
+// - RevertTokenHash: A hash of the token sent to the old address.
+// - ExpiresAt: When the confirm token stops being accepted.
+// - RevertExpiresAt: When the revert token stops being accepted.
+type StartEmailChangeParams struct {
+	UserID           uuid.UUID
+	NewEmail         string
+	ConfirmTokenHash string
+	RevertTokenHash  string
+	ExpiresAt        time.Time
+	RevertExpiresAt  time.Time
+}
+
+// keepEmail keeps the stored email address in an update of a user, since a new address only applies once it
+// has been confirmed, see startEmailChange. Changes of case only are applied; they reach the same mailbox.
+func keepEmail(params *UpdateUserParams, before User) {
+	if !strings.EqualFold(params.Email, before.Email) {
+		params.Email = before.Email
+	}
+}
+
+// StartEmailChangeTx records a change of a user's email address that waits for confirmation.
+// Any earlier change still waiting is cancelled, so only the latest confirm token works.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The new address and the token hashes.
+// Returns:
+// - The pending change, with the old address to notify.
+// - sql.ErrNoRows if the user does not exist or is deleted, ErrEmailUnchanged, or ErrEmailTaken.
+func (store *SQLStore) StartEmailChangeTx(ctx context.Context, arg StartEmailChangeParams) (EmailChange, error) {
+	var result EmailChange
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		user, err := q.GetUserForUpdate(ctx, arg.UserID)
+		if err != nil {
+			return err
+		}
+		if user.DeletedAt.Valid {
+			return sql.ErrNoRows
+		}
+
+		result, err = startEmailChange(ctx, q, user, arg)
+		return err
+	})
+
+	return result, err
+}
+
+// startEmailChange records a change of a locked user's email address inside a transaction, for StartEmailChangeTx
+// and the updates that start one. Returns ErrEmailUnchanged or ErrEmailTaken when the address can't be used.
+func startEmailChange(ctx context.Context, q *Queries, user User, arg StartEmailChangeParams) (EmailChange, error) {
+	if strings.EqualFold(user.Email, arg.NewEmail) {
+		return EmailChange{}, ErrEmailUnchanged
+	}
+
+	other, err := q.GetUserByEmail(ctx, arg.NewEmail)
+	if err == nil && other.ID != user.ID {
+		return EmailChange{}, ErrEmailTaken
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return EmailChange{}, err
+	}
+
+	if _, err = q.CancelPendingEmailChanges(ctx, user.ID); err != nil {
+		return EmailChange{}, err
+	}
+
+	return q.CreateEmailChange(ctx, CreateEmailChangeParams{
+		UserID:           user.ID,
+		OldEmail:         user.Email,
+		NewEmail:         arg.NewEmail,
+		ConfirmTokenHash: arg.ConfirmTokenHash,
+		RevertTokenHash:  arg.RevertTokenHash,
+		ExpiresAt:        arg.ExpiresAt,
+		RevertExpiresAt:  arg.RevertExpiresAt,
+	})
+}
+
+// startEmailChangeWithUpdate starts the email change asked for with an update of a user, once the user has been
+// updated. Nothing is started when none was asked for or the address only differs in case, see keepEmail.
+func startEmailChangeWithUpdate(ctx context.Context, q *Queries, user User, arg *StartEmailChangeParams) (*EmailChange, error) {
+	if arg == nil || strings.EqualFold(user.Email, arg.NewEmail) {
+		return nil, nil
+	}
+
+	change, err := startEmailChange(ctx, q, user, *arg)
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// ConfirmEmailChangeTx applies the change a confirm token belongs to, as a new user version.
+// Parameters:
+// - ctx: The context for the transaction.
+// - tokenHash: A hash of the token from the new address, made the same way as the one stored.
+// - now: The time the token has to be used by.
+// Returns:
+// - The updated user.
+// - ErrEmailChangeTokenInvalid or ErrEmailChangeTokenExpired, or a unique violation if the new address was
+// taken by someone else meanwhile.
+func (store *SQLStore) ConfirmEmailChangeTx(ctx context.Context, tokenHash string, now time.Time) (User, error) {
+	var result User
+	var tokenErr error
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		change, err := q.GetEmailChangeByConfirmTokenForUpdate(ctx, tokenHash)
+		if err == sql.ErrNoRows {
+			tokenErr = ErrEmailChangeTokenInvalid
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if change.ConfirmedAt.Valid || change.RevertedAt.Valid || change.CancelledAt.Valid || !now.Before(change.ExpiresAt) {
+			tokenErr = ErrEmailChangeTokenExpired
+			return nil
+		}
+
+		result, err = setUserEmail(ctx, q, change.UserID, change.OldEmail, change.NewEmail)
+		if err == sql.ErrNoRows {
+			tokenErr = ErrEmailChangeTokenExpired
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err = q.MarkEmailChangeConfirmed(ctx, change.ID); err != nil {
+			return err
+		}
+
+		return recordEvent(ctx, q, EventUserVerified, change.UserID, map[string]string{"channel": "email"})
+	})
+
+	if err == nil {
+		err = tokenErr
+	}
+
+	return result, err
+}
+
+// RevertEmailChangeTx undoes the change a revert token belongs to. A change that is still waiting is cancelled;
+// a confirmed one puts the old address back, as a new user version. Other changes still waiting are cancelled
+// too, since the old address is treating the change as unwanted.
+// Parameters:
+// - ctx: The context for the transaction.
+// - tokenHash: A hash of the token from the old address, made the same way as the one stored.
+// - now: The time the token has to be used by.
+// Returns:
+// - The user, with the old address.
+// - ErrEmailChangeTokenInvalid, or ErrEmailChangeTokenExpired when the token was used, has expired, or the
+// address has changed again since.
+func (store *SQLStore) RevertEmailChangeTx(ctx context.Context, tokenHash string, now time.Time) (User, error) {
+	var result User
+	var tokenErr error
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		change, err := q.GetEmailChangeByRevertTokenForUpdate(ctx, tokenHash)
+		if err == sql.ErrNoRows {
+			tokenErr = ErrEmailChangeTokenInvalid
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if change.RevertedAt.Valid || !now.Before(change.RevertExpiresAt) {
+			tokenErr = ErrEmailChangeTokenExpired
+			return nil
+		}
+
+		if change.ConfirmedAt.Valid {
+			result, err = setUserEmail(ctx, q, change.UserID, change.NewEmail, change.OldEmail)
+		} else {
+			result, err = q.GetUserForUpdate(ctx, change.UserID)
+			if err == nil && (result.DeletedAt.Valid || !strings.EqualFold(result.Email, change.OldEmail)) {
+				err = sql.ErrNoRows
+			}
+		}
+		if err == sql.ErrNoRows {
+			tokenErr = ErrEmailChangeTokenExpired
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err = q.CancelPendingEmailChanges(ctx, change.UserID); err != nil {
+			return err
+		}
+
+		_, err = q.MarkEmailChangeReverted(ctx, change.ID)
+		return err
+	})
+
+	if err == nil {
+		err = tokenErr
+	}
+
+	return result, err
+}
+
+// setUserEmail changes a user's address from one to another within the caller's transaction, audited, recorded
+// in history, and announced in the outbox. Returns sql.ErrNoRows if the user is deleted or no longer has the
+// address from.
+func setUserEmail(ctx context.Context, q *Queries, userID uuid.UUID, from, to string) (User, error) {
+	before, err := q.GetUserForUpdate(ctx, userID)
+	if err != nil {
+		return User{}, err
+	}
+	if before.DeletedAt.Valid || !strings.EqualFold(before.Email, from) {
+		return User{}, sql.ErrNoRows
+	}
+
+	after, err := q.UpdateUser(ctx, UpdateUserParams{
+		ID:       before.ID,
+		UserName: before.UserName,
+		Email:    to,
+		Password: before.Password,
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	err = recordAudit(ctx, q, AuditActionUpdate, AuditTargetUser, userID, before, after)
+	if err != nil {
+		return User{}, err
+	}
+
+	err = recordUserHistory(ctx, q, after)
+	if err != nil {
+		return User{}, err
+	}
+
+	return after, recordEvent(ctx, q, EventUserUpdated, userID, userEventData(after))
+}
@@ -0,0 +1,255 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: email_change.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const cancelPendingEmailChanges = `-- name: CancelPendingEmailChanges :execrows
+UPDATE email_changes
+SET cancelled_at = STATEMENT_TIMESTAMP()
+WHERE user_id = $1
+  AND confirmed_at IS NULL
+  AND reverted_at IS NULL
+  AND cancelled_at IS NULL
+`
+
+// Cancels every change of a user's email address that has not been confirmed or reverted yet.
+func (q *Queries) CancelPendingEmailChanges(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelPendingEmailChanges, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const createEmailChange = `-- name: CreateEmailChange :one
+INSERT INTO email_changes (user_id, old_email, new_email, confirm_token_hash, revert_token_hash, expires_at,
+                           revert_expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, user_id, old_email, new_email, confirm_token_hash, revert_token_hash, created_at, expires_at, revert_expires_at, confirmed_at, reverted_at, cancelled_at
+`
+
+type CreateEmailChangeParams struct {
+	UserID           uuid.UUID `json:"user_id"`
+	OldEmail         string    `json:"old_email"`
+	NewEmail         string    `json:"new_email"`
+	ConfirmTokenHash string    `json:"confirm_token_hash"`
+	RevertTokenHash  string    `json:"revert_token_hash"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RevertExpiresAt  time.Time `json:"revert_expires_at"`
+}
+
+func (q *Queries) CreateEmailChange(ctx context.Context, arg CreateEmailChangeParams) (EmailChange, error) {
+	row := q.db.QueryRowContext(ctx, createEmailChange,
+		arg.UserID,
+		arg.OldEmail,
+		arg.NewEmail,
+		arg.ConfirmTokenHash,
+		arg.RevertTokenHash,
+		arg.ExpiresAt,
+		arg.RevertExpiresAt,
+	)
+	var i EmailChange
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.OldEmail,
+		&i.NewEmail,
+		&i.ConfirmTokenHash,
+		&i.RevertTokenHash,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.RevertExpiresAt,
+		&i.ConfirmedAt,
+		&i.RevertedAt,
+		&i.CancelledAt,
+	)
+	return i, err
+}
+
+const deleteEmailChanges = `-- name: DeleteEmailChanges :execrows
+DELETE
+FROM email_changes
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteEmailChanges(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteEmailChanges, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getEmailChangeByConfirmTokenForUpdate = `-- name: GetEmailChangeByConfirmTokenForUpdate :one
+SELECT id, user_id, old_email, new_email, confirm_token_hash, revert_token_hash, created_at, expires_at, revert_expires_at, confirmed_at, reverted_at, cancelled_at
+FROM email_changes
+WHERE confirm_token_hash = $1
+LIMIT 1 FOR UPDATE
+`
+
+func (q *Queries) GetEmailChangeByConfirmTokenForUpdate(ctx context.Context, confirmTokenHash string) (EmailChange, error) {
+	row := q.db.QueryRowContext(ctx, getEmailChangeByConfirmTokenForUpdate, confirmTokenHash)
+	var i EmailChange
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.OldEmail,
+		&i.NewEmail,
+		&i.ConfirmTokenHash,
+		&i.RevertTokenHash,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.RevertExpiresAt,
+		&i.ConfirmedAt,
+		&i.RevertedAt,
+		&i.CancelledAt,
+	)
+	return i, err
+}
+
+const getEmailChangeByRevertTokenForUpdate = `-- name: GetEmailChangeByRevertTokenForUpdate :one
+SELECT id, user_id, old_email, new_email, confirm_token_hash, revert_token_hash, created_at, expires_at, revert_expires_at, confirmed_at, reverted_at, cancelled_at
+FROM email_changes
+WHERE revert_token_hash = $1
+LIMIT 1 FOR UPDATE
+`
+
+func (q *Queries) GetEmailChangeByRevertTokenForUpdate(ctx context.Context, revertTokenHash string) (EmailChange, error) {
+	row := q.db.QueryRowContext(ctx, getEmailChangeByRevertTokenForUpdate, revertTokenHash)
+	var i EmailChange
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.OldEmail,
+		&i.NewEmail,
+		&i.ConfirmTokenHash,
+		&i.RevertTokenHash,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.RevertExpiresAt,
+		&i.ConfirmedAt,
+		&i.RevertedAt,
+		&i.CancelledAt,
+	)
+	return i, err
+}
+
+const listEmailChanges = `-- name: ListEmailChanges :many
+SELECT id, user_id, old_email, new_email, confirm_token_hash, revert_token_hash, created_at, expires_at, revert_expires_at, confirmed_at, reverted_at, cancelled_at
+FROM email_changes
+WHERE user_id = $1
+ORDER BY created_at, id
+`
+
+func (q *Queries) ListEmailChanges(ctx context.Context, userID uuid.UUID) ([]EmailChange, error) {
+	rows, err := q.db.QueryContext(ctx, listEmailChanges, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []EmailChange{}
+	for rows.Next() {
+		var i EmailChange
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.OldEmail,
+			&i.NewEmail,
+			&i.ConfirmTokenHash,
+			&i.RevertTokenHash,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.RevertExpiresAt,
+			&i.ConfirmedAt,
+			&i.RevertedAt,
+			&i.CancelledAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEmailChangeConfirmed = `-- name: MarkEmailChangeConfirmed :one
+UPDATE email_changes
+SET confirmed_at = STATEMENT_TIMESTAMP()
+WHERE id = $1 RETURNING id, user_id, old_email, new_email, confirm_token_hash, revert_token_hash, created_at, expires_at, revert_expires_at, confirmed_at, reverted_at, cancelled_at
+`
+
+func (q *Queries) MarkEmailChangeConfirmed(ctx context.Context, id uuid.UUID) (EmailChange, error) {
+	row := q.db.QueryRowContext(ctx, markEmailChangeConfirmed, id)
+	var i EmailChange
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.OldEmail,
+		&i.NewEmail,
+		&i.ConfirmTokenHash,
+		&i.RevertTokenHash,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.RevertExpiresAt,
+		&i.ConfirmedAt,
+		&i.RevertedAt,
+		&i.CancelledAt,
+	)
+	return i, err
+}
+
+const markEmailChangeReverted = `-- name: MarkEmailChangeReverted :one
+UPDATE email_changes
+SET reverted_at = STATEMENT_TIMESTAMP()
+WHERE id = $1 RETURNING id, user_id, old_email, new_email, confirm_token_hash, revert_token_hash, created_at, expires_at, revert_expires_at, confirmed_at, reverted_at, cancelled_at
+`
+
+func (q *Queries) MarkEmailChangeReverted(ctx context.Context, id uuid.UUID) (EmailChange, error) {
+	row := q.db.QueryRowContext(ctx, markEmailChangeReverted, id)
+	var i EmailChange
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.OldEmail,
+		&i.NewEmail,
+		&i.ConfirmTokenHash,
+		&i.RevertTokenHash,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.RevertExpiresAt,
+		&i.ConfirmedAt,
+		&i.RevertedAt,
+		&i.CancelledAt,
+	)
+	return i, err
+}
+
+const purgeEmailChanges = `-- name: PurgeEmailChanges :execrows
+DELETE
+FROM email_changes
+WHERE revert_expires_at < $1::timestamptz
+   OR user_id IN (SELECT id FROM users WHERE users.deleted_at < $1::timestamptz)
+`
+
+// Removes changes that can no longer be reverted, and the changes of users that are being purged so the users can
+// be deleted afterwards.
+func (q *Queries) PurgeEmailChanges(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeEmailChanges, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
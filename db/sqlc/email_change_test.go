@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"whaleWake/util"
+)
+
+func startRandomEmailChange(t *testing.T, store Store, user User) (StartEmailChangeParams, EmailChange) {
+	arg := StartEmailChangeParams{
+		UserID:           user.ID,
+		NewEmail:         util.RandomEmail(),
+		ConfirmTokenHash: util.RandomString(32),
+		RevertTokenHash:  util.RandomString(32),
+		ExpiresAt:        time.Now().Add(time.Hour),
+		RevertExpiresAt:  time.Now().Add(24 * time.Hour),
+	}
+	change, err := store.StartEmailChangeTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, user.Email, change.OldEmail)
+	require.Equal(t, arg.NewEmail, change.NewEmail)
+	return arg, change
+}
+
+func TestUpdateUserKeepsEmail(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+
+	updated, err := store.UpdateUserTx(context.Background(), UpdateUserParams{
+		ID:       user.ID,
+		UserName: user.UserName,
+		Email:    util.RandomEmail(),
+		Password: user.Password,
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, user.Email, updated.User.Email)
+	require.Nil(t, updated.EmailChange)
+}
+
+func TestUpdateUserStartsEmailChange(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+	newEmail := util.RandomEmail()
+
+	updated, err := store.UpdateUserTx(context.Background(), UpdateUserParams{
+		ID:       user.ID,
+		UserName: util.RandomUserName(),
+		Email:    newEmail,
+		Password: user.Password,
+	}, &StartEmailChangeParams{
+		NewEmail:         newEmail,
+		ConfirmTokenHash: util.RandomString(32),
+		RevertTokenHash:  util.RandomString(32),
+		ExpiresAt:        time.Now().Add(time.Hour),
+		RevertExpiresAt:  time.Now().Add(24 * time.Hour),
+	})
+	require.NoError(t, err)
+	require.Equal(t, user.Email, updated.User.Email)
+	require.NotNil(t, updated.EmailChange)
+	require.Equal(t, user.Email, updated.EmailChange.OldEmail)
+	require.Equal(t, newEmail, updated.EmailChange.NewEmail)
+}
+
+func TestUpdateUserEmailTakenRollsBack(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+	other := createRandomUser(t)
+
+	_, err := store.UpdateUserTx(context.Background(), UpdateUserParams{
+		ID:       user.ID,
+		UserName: util.RandomUserName(),
+		Email:    other.Email,
+		Password: user.Password,
+	}, &StartEmailChangeParams{
+		NewEmail:         other.Email,
+		ConfirmTokenHash: util.RandomString(32),
+		RevertTokenHash:  util.RandomString(32),
+		ExpiresAt:        time.Now().Add(time.Hour),
+		RevertExpiresAt:  time.Now().Add(24 * time.Hour),
+	})
+	require.ErrorIs(t, err, ErrEmailTaken)
+
+	stored, err := store.GetUser(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, user.UserName, stored.UserName)
+	require.Equal(t, user.Version, stored.Version)
+}
+
+func TestConfirmAndRevertEmailChange(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+
+	first, _ := startRandomEmailChange(t, store, user)
+	second, change := startRandomEmailChange(t, store, user)
+
+	// Starting a change cancels the one before it.
+	_, err := store.ConfirmEmailChangeTx(context.Background(), first.ConfirmTokenHash, time.Now())
+	require.ErrorIs(t, err, ErrEmailChangeTokenExpired)
+
+	_, err = store.ConfirmEmailChangeTx(context.Background(), util.RandomString(32), time.Now())
+	require.ErrorIs(t, err, ErrEmailChangeTokenInvalid)
+
+	_, err = store.ConfirmEmailChangeTx(context.Background(), second.ConfirmTokenHash, second.ExpiresAt)
+	require.ErrorIs(t, err, ErrEmailChangeTokenExpired)
+
+	confirmed, err := store.ConfirmEmailChangeTx(context.Background(), second.ConfirmTokenHash, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, change.NewEmail, confirmed.Email)
+
+	_, err = store.ConfirmEmailChangeTx(context.Background(), second.ConfirmTokenHash, time.Now())
+	require.ErrorIs(t, err, ErrEmailChangeTokenExpired)
+
+	reverted, err := store.RevertEmailChangeTx(context.Background(), second.RevertTokenHash, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, user.Email, reverted.Email)
+
+	_, err = store.RevertEmailChangeTx(context.Background(), second.RevertTokenHash, time.Now())
+	require.ErrorIs(t, err, ErrEmailChangeTokenExpired)
+}
+
+func TestRevertPendingEmailChange(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+
+	arg, _ := startRandomEmailChange(t, store, user)
+
+	reverted, err := store.RevertEmailChangeTx(context.Background(), arg.RevertTokenHash, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, user.Email, reverted.Email)
+
+	_, err = store.ConfirmEmailChangeTx(context.Background(), arg.ConfirmTokenHash, time.Now())
+	require.ErrorIs(t, err, ErrEmailChangeTokenExpired)
+}
+
+func TestStartEmailChangeTaken(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+	other := createRandomUser(t)
+
+	_, err := store.StartEmailChangeTx(context.Background(), StartEmailChangeParams{
+		UserID:           user.ID,
+		NewEmail:         other.Email,
+		ConfirmTokenHash: util.RandomString(32),
+		RevertTokenHash:  util.RandomString(32),
+		ExpiresAt:        time.Now().Add(time.Hour),
+		RevertExpiresAt:  time.Now().Add(time.Hour),
+	})
+	require.ErrorIs(t, err, ErrEmailTaken)
+}
@@ -0,0 +1,344 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: erasure.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const allowAuditErasure = `-- name: AllowAuditErasure :exec
+SELECT set_config('whalewake.audit_erasure', 'on', true)
+`
+
+// Lets AnonymizeAuditEvents update audit_events until the end of the transaction.
+func (q *Queries) AllowAuditErasure(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, allowAuditErasure)
+	return err
+}
+
+const anonymizeAuditEvents = `-- name: AnonymizeAuditEvents :execrows
+UPDATE audit_events
+SET before = CASE WHEN target_id = $1 THEN jsonb_erase_keys(before, $2::text[]) ELSE before END,
+    after  = CASE WHEN target_id = $1 THEN jsonb_erase_keys(after, $2::text[]) ELSE after END,
+    ip     = CASE WHEN actor_id = $1 THEN '' ELSE ip END
+WHERE target_id = $1
+   OR actor_id = $1
+`
+
+type AnonymizeAuditEventsParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	Fields []string  `json:"fields"`
+}
+
+// Erases the listed fields from the diffs of changes to the user, and the IP address of changes the user made.
+// Changes the user made to other users keep their diffs, since those hold the other users' data.
+// Needs AllowAuditErasure earlier in the same transaction.
+func (q *Queries) AnonymizeAuditEvents(ctx context.Context, arg AnonymizeAuditEventsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, anonymizeAuditEvents, arg.UserID, pq.Array(arg.Fields))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const anonymizeUser = `-- name: AnonymizeUser :one
+UPDATE users
+SET user_name  = 'erased-' || id,
+    email      = 'erased-' || id || '@erased.invalid',
+    password   = '',
+    version    = version + 1,
+    updated_at = STATEMENT_TIMESTAMP()
+WHERE id = $1
+RETURNING id, user_name, email, password, created_at, updated_at, verified_at, version, deleted_at
+`
+
+// The user name and email become unique placeholders, and the empty password hash never matches a password.
+func (q *Queries) AnonymizeUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, anonymizeUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.UserName,
+		&i.Email,
+		&i.Password,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const anonymizeUserHistory = `-- name: AnonymizeUserHistory :execrows
+UPDATE users_history
+SET user_name = 'erased-' || user_id,
+    email     = 'erased-' || user_id || '@erased.invalid'
+WHERE user_id = $1
+`
+
+func (q *Queries) AnonymizeUserHistory(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, anonymizeUserHistory, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const anonymizeUserProfile = `-- name: AnonymizeUserProfile :one
+UPDATE user_profile
+SET first_name          = '',
+    last_name           = '',
+    business_name       = '',
+    street_address      = '',
+    city                = '',
+    state               = '',
+    zip                 = '',
+    country_code        = '',
+    first_name_bidx     = NULL,
+    last_name_bidx      = NULL,
+    zip_bidx            = NULL,
+    phone_number        = '',
+    avatar_key          = '',
+    avatar_content_type = '',
+    version             = version + 1,
+    updated_at          = STATEMENT_TIMESTAMP()
+WHERE user_id = $1
+RETURNING id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, version, deleted_at, first_name_bidx, last_name_bidx, zip_bidx, phone_number, phone_verified_at, avatar_key, avatar_content_type
+`
+
+func (q *Queries) AnonymizeUserProfile(ctx context.Context, userID uuid.UUID) (UserProfile, error) {
+	row := q.db.QueryRowContext(ctx, anonymizeUserProfile, userID)
+	var i UserProfile
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.BusinessName,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.FirstNameBidx,
+		&i.LastNameBidx,
+		&i.ZipBidx,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+		&i.AvatarKey,
+		&i.AvatarContentType,
+	)
+	return i, err
+}
+
+const anonymizeUserProfileHistory = `-- name: AnonymizeUserProfileHistory :execrows
+UPDATE user_profile_history
+SET first_name     = '',
+    last_name      = '',
+    business_name  = '',
+    street_address = '',
+    city           = '',
+    state          = '',
+    zip            = '',
+    country_code   = '',
+    phone_number   = ''
+WHERE user_id = $1
+`
+
+func (q *Queries) AnonymizeUserProfileHistory(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, anonymizeUserProfileHistory, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const cancelErasureRequest = `-- name: CancelErasureRequest :one
+UPDATE erasure_requests
+SET status       = 'cancelled',
+    cancelled_at = STATEMENT_TIMESTAMP()
+WHERE user_id = $1
+  AND status = 'pending'
+RETURNING id, user_id, status, requested_at, scheduled_for, cancelled_at, completed_at
+`
+
+func (q *Queries) CancelErasureRequest(ctx context.Context, userID uuid.UUID) (ErasureRequest, error) {
+	row := q.db.QueryRowContext(ctx, cancelErasureRequest, userID)
+	var i ErasureRequest
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.RequestedAt,
+		&i.ScheduledFor,
+		&i.CancelledAt,
+		&i.CompletedAt,
+	)
+	return i, err
+}
+
+const completeErasureRequest = `-- name: CompleteErasureRequest :one
+UPDATE erasure_requests
+SET status       = 'completed',
+    completed_at = STATEMENT_TIMESTAMP()
+WHERE id = $1
+RETURNING id, user_id, status, requested_at, scheduled_for, cancelled_at, completed_at
+`
+
+func (q *Queries) CompleteErasureRequest(ctx context.Context, id uuid.UUID) (ErasureRequest, error) {
+	row := q.db.QueryRowContext(ctx, completeErasureRequest, id)
+	var i ErasureRequest
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.RequestedAt,
+		&i.ScheduledFor,
+		&i.CancelledAt,
+		&i.CompletedAt,
+	)
+	return i, err
+}
+
+const createErasureRequest = `-- name: CreateErasureRequest :one
+INSERT INTO erasure_requests (user_id, scheduled_for)
+VALUES ($1, $2)
+ON CONFLICT (user_id) WHERE status = 'pending' DO NOTHING
+RETURNING id, user_id, status, requested_at, scheduled_for, cancelled_at, completed_at
+`
+
+type CreateErasureRequestParams struct {
+	UserID       uuid.UUID `json:"user_id"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
+// Returns no rows when the user already has a pending request.
+func (q *Queries) CreateErasureRequest(ctx context.Context, arg CreateErasureRequestParams) (ErasureRequest, error) {
+	row := q.db.QueryRowContext(ctx, createErasureRequest, arg.UserID, arg.ScheduledFor)
+	var i ErasureRequest
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.RequestedAt,
+		&i.ScheduledFor,
+		&i.CancelledAt,
+		&i.CompletedAt,
+	)
+	return i, err
+}
+
+const getPendingErasureRequest = `-- name: GetPendingErasureRequest :one
+SELECT id, user_id, status, requested_at, scheduled_for, cancelled_at, completed_at
+FROM erasure_requests
+WHERE user_id = $1
+  AND status = 'pending'
+LIMIT 1
+`
+
+func (q *Queries) GetPendingErasureRequest(ctx context.Context, userID uuid.UUID) (ErasureRequest, error) {
+	row := q.db.QueryRowContext(ctx, getPendingErasureRequest, userID)
+	var i ErasureRequest
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.RequestedAt,
+		&i.ScheduledFor,
+		&i.CancelledAt,
+		&i.CompletedAt,
+	)
+	return i, err
+}
+
+const listDueErasureRequests = `-- name: ListDueErasureRequests :many
+SELECT id, user_id, status, requested_at, scheduled_for, cancelled_at, completed_at
+FROM erasure_requests
+WHERE status = 'pending'
+  AND scheduled_for <= $1
+ORDER BY scheduled_for, id
+FOR UPDATE SKIP LOCKED
+`
+
+// Locks the due requests for the rest of the transaction; requests another worker has locked are skipped.
+func (q *Queries) ListDueErasureRequests(ctx context.Context, scheduledFor time.Time) ([]ErasureRequest, error) {
+	rows, err := q.db.QueryContext(ctx, listDueErasureRequests, scheduledFor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ErasureRequest{}
+	for rows.Next() {
+		var i ErasureRequest
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.RequestedAt,
+			&i.ScheduledFor,
+			&i.CancelledAt,
+			&i.CompletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listErasureRequests = `-- name: ListErasureRequests :many
+SELECT id, user_id, status, requested_at, scheduled_for, cancelled_at, completed_at
+FROM erasure_requests
+WHERE user_id = $1
+ORDER BY requested_at, id
+`
+
+func (q *Queries) ListErasureRequests(ctx context.Context, userID uuid.UUID) ([]ErasureRequest, error) {
+	rows, err := q.db.QueryContext(ctx, listErasureRequests, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ErasureRequest{}
+	for rows.Next() {
+		var i ErasureRequest
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.RequestedAt,
+			&i.ScheduledFor,
+			&i.CancelledAt,
+			&i.CompletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
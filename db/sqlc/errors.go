@@ -0,0 +1,39 @@
+package db
+
+import (
+	"errors"
+	"github.com/lib/pq"
+)
+
+// Postgres SQLSTATE codes the application reacts to.
+const (
+	UniqueViolation     = "23505"
+	ForeignKeyViolation = "23503"
+)
+
+// uniqueConstraintFields maps unique constraints and indexes to the request field they protect.
+var uniqueConstraintFields = map[string]string{
+	"users_email_lower_key":                      "email",
+	"users_user_name_lower_key":                  "user_name",
+	"attribute_definitions_key_key":              "key",
+	"user_name_reservations_user_name_lower_key": "user_name",
+}
+
+// ErrorCode returns the Postgres SQLSTATE code of err, or an empty string if err did not come from Postgres.
+func ErrorCode(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	return ""
+}
+
+// UniqueViolationField reports whether err is a unique violation and, if so, which field caused it.
+// The field is empty when the violated constraint is not one the API exposes.
+func UniqueViolationField(err error) (string, bool) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || string(pqErr.Code) != UniqueViolation {
+		return "", false
+	}
+	return uniqueConstraintFields[pqErr.Constraint], true
+}
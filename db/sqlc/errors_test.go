@@ -0,0 +1,29 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUniqueViolationField(t *testing.T) {
+	err := fmt.Errorf("tx failed: %w", &pq.Error{Code: UniqueViolation, Constraint: "users_email_lower_key"})
+
+	field, ok := UniqueViolationField(err)
+	require.True(t, ok)
+	require.Equal(t, "email", field)
+	require.Equal(t, UniqueViolation, ErrorCode(err))
+
+	field, ok = UniqueViolationField(&pq.Error{Code: UniqueViolation, Constraint: "unknown_key"})
+	require.True(t, ok)
+	require.Empty(t, field)
+
+	_, ok = UniqueViolationField(&pq.Error{Code: ForeignKeyViolation})
+	require.False(t, ok)
+
+	_, ok = UniqueViolationField(errors.New("boom"))
+	require.False(t, ok)
+	require.Empty(t, ErrorCode(errors.New("boom")))
+}
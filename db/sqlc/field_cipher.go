@@ -0,0 +1,368 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+)
+
+// FieldCipher encrypts the personal columns of user profiles at rest and computes blind indexes of their
+// plaintext for exact-match lookups. *keyring.Keyring implements it.
+type FieldCipher interface {
+	// Encrypt seals a value of the named field. Empty values stay empty.
+	Encrypt(field, plaintext string) (string, error)
+	// Decrypt opens a value made by Encrypt. Values that were never encrypted are returned as they are.
+	Decrypt(field, value string) (string, error)
+	// IsCurrent reports whether a stored value is empty or already encrypted under the current key.
+	IsCurrent(value string) bool
+	// BlindIndex returns a keyed hash of a value, the same for values that differ only in case or surrounding space.
+	BlindIndex(field, plaintext string) string
+}
+
+// StoreOption configures a store built by NewStore.
+type StoreOption func(*SQLStore)
+
+// WithFieldCipher encrypts first_name, last_name, street_address, and zip of user profiles and their history,
+// and street_address and zip of user addresses.
+// The store encrypts on write and decrypts on read, so callers only ever see plaintext. Audit diffs of profile and
+// address changes hold the ciphertext too and are decrypted when read. Rows and diffs written before encryption
+// was turned on are read as plaintext until key rotation encrypts them.
+// With encryption on, the user list searches names by exact (case-insensitive) match through the blind indexes
+// instead of by substring, and sorting by last_name orders by blind index, which is stable but not alphabetical.
+func WithFieldCipher(fields FieldCipher) StoreOption {
+	return func(store *SQLStore) {
+		store.fields = fields
+	}
+}
+
+// ErrNoFieldCipher is returned by key rotation on a store built without WithFieldCipher.
+var ErrNoFieldCipher = errors.New("field encryption is not configured")
+
+// The encrypted columns. Each name is bound into the ciphertext, so a value only decrypts as the column it came from.
+const (
+	fieldFirstName     = "first_name"
+	fieldLastName      = "last_name"
+	fieldStreetAddress = "street_address"
+	fieldZip           = "zip"
+)
+
+// auditErased is the value jsonb_erase_keys (migration 000012) leaves in audit diffs in place of erased fields.
+const auditErased = "[ERASED]"
+
+// auditEncryptedFields lists, per audit target type, the fields whose values are ciphertext in audit diffs.
+var auditEncryptedFields = map[string][]string{
+	AuditTargetUserProfile: {fieldFirstName, fieldLastName, fieldStreetAddress, fieldZip},
+	AuditTargetUserAddress: {fieldStreetAddress, fieldZip},
+}
+
+// encryptedField points at one encrypted column of a row.
+type encryptedField struct {
+	name  string
+	value *string
+}
+
+// profileFields lists the encrypted columns of a row, in a fixed order.
+func profileFields(firstName, lastName, streetAddress, zip *string) []encryptedField {
+	return []encryptedField{
+		{fieldFirstName, firstName},
+		{fieldLastName, lastName},
+		{fieldStreetAddress, streetAddress},
+		{fieldZip, zip},
+	}
+}
+
+// addressFields lists the encrypted columns of an address. They share the profile's field names, so an address
+// and the profile it is mirrored in can copy ciphertext between each other.
+func addressFields(streetAddress, zip *string) []encryptedField {
+	return []encryptedField{
+		{fieldStreetAddress, streetAddress},
+		{fieldZip, zip},
+	}
+}
+
+// encryptFields replaces each value with its ciphertext.
+func (store *SQLStore) encryptFields(fields []encryptedField) error {
+	if store.fields == nil {
+		return nil
+	}
+	for _, field := range fields {
+		value, err := store.fields.Encrypt(field.name, *field.value)
+		if err != nil {
+			return err
+		}
+		*field.value = value
+	}
+	return nil
+}
+
+// decryptFields replaces each value with its plaintext.
+func (store *SQLStore) decryptFields(fields []encryptedField) error {
+	if store.fields == nil {
+		return nil
+	}
+	for _, field := range fields {
+		value, err := store.fields.Decrypt(field.name, *field.value)
+		if err != nil {
+			return err
+		}
+		*field.value = value
+	}
+	return nil
+}
+
+// blindIndex returns the blind index of a value, or NULL when encryption is off or the value is empty.
+func (store *SQLStore) blindIndex(field, plaintext string) sql.NullString {
+	if store.fields == nil {
+		return sql.NullString{}
+	}
+	index := store.fields.BlindIndex(field, plaintext)
+	return sql.NullString{String: index, Valid: index != ""}
+}
+
+func (store *SQLStore) encryptCreateProfileParams(arg CreateUserProfileParams) (CreateUserProfileParams, error) {
+	arg.FirstNameBidx = store.blindIndex(fieldFirstName, arg.FirstName)
+	arg.LastNameBidx = store.blindIndex(fieldLastName, arg.LastName)
+	arg.ZipBidx = store.blindIndex(fieldZip, arg.Zip)
+	err := store.encryptFields(profileFields(&arg.FirstName, &arg.LastName, &arg.StreetAddress, &arg.Zip))
+	return arg, err
+}
+
+// encryptUpdateProfileParams encrypts an update. Values that did not change keep the ciphertext they have
+// under the current key, so audit diffs only show the fields that really changed.
+func (store *SQLStore) encryptUpdateProfileParams(arg UpdateUserProfileParams, before UserProfile) (UpdateUserProfileParams, error) {
+	arg.FirstNameBidx = store.blindIndex(fieldFirstName, arg.FirstName)
+	arg.LastNameBidx = store.blindIndex(fieldLastName, arg.LastName)
+	arg.ZipBidx = store.blindIndex(fieldZip, arg.Zip)
+	err := store.reencryptFields(
+		profileFields(&arg.FirstName, &arg.LastName, &arg.StreetAddress, &arg.Zip),
+		profileFields(&before.FirstName, &before.LastName, &before.StreetAddress, &before.Zip))
+	return arg, err
+}
+
+// reencryptFields encrypts the values of after. A value equal to the plaintext of its stored counterpart keeps
+// the stored ciphertext when that is under the current key.
+func (store *SQLStore) reencryptFields(after, stored []encryptedField) error {
+	if store.fields == nil {
+		return nil
+	}
+	for i, field := range after {
+		if store.fields.IsCurrent(*stored[i].value) {
+			plaintext, err := store.fields.Decrypt(field.name, *stored[i].value)
+			if err == nil && plaintext == *field.value {
+				*field.value = *stored[i].value
+				continue
+			}
+		}
+
+		value, err := store.fields.Encrypt(field.name, *field.value)
+		if err != nil {
+			return err
+		}
+		*field.value = value
+	}
+	return nil
+}
+
+func (store *SQLStore) decryptProfile(profile *UserProfile) error {
+	return store.decryptFields(profileFields(&profile.FirstName, &profile.LastName, &profile.StreetAddress, &profile.Zip))
+}
+
+func (store *SQLStore) decryptProfileHistory(profile *UserProfileHistory) error {
+	return store.decryptFields(profileFields(&profile.FirstName, &profile.LastName, &profile.StreetAddress, &profile.Zip))
+}
+
+func (store *SQLStore) decryptAddress(address *UserAddress) error {
+	return store.decryptFields(addressFields(&address.StreetAddress, &address.Zip))
+}
+
+func (store *SQLStore) decryptAuditEvent(event *AuditEvent) error {
+	if store.fields == nil {
+		return nil
+	}
+	var err error
+	if event.Before, err = mapAuditDiff(event.TargetType, event.Before, store.fields.Decrypt); err != nil {
+		return err
+	}
+	event.After, err = mapAuditDiff(event.TargetType, event.After, store.fields.Decrypt)
+	return err
+}
+
+// mapAuditDiff replaces each encrypted field of an audit diff of the target type with fn of its value.
+// Diffs without such fields, and fields that are null or erased, come back as they are.
+func mapAuditDiff(targetType string, diff json.RawMessage, fn func(field, value string) (string, error)) (json.RawMessage, error) {
+	names := auditEncryptedFields[targetType]
+	if len(names) == 0 || len(diff) == 0 {
+		return diff, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(diff, &fields); err != nil || fields == nil {
+		return diff, err
+	}
+
+	changed := false
+	for _, name := range names {
+		var value string
+		if raw, ok := fields[name]; !ok || json.Unmarshal(raw, &value) != nil || value == auditErased {
+			continue
+		}
+		mapped, err := fn(name, value)
+		if err != nil {
+			return nil, err
+		}
+		if mapped == value {
+			continue
+		}
+		if fields[name], err = json.Marshal(mapped); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+
+	if !changed {
+		return diff, nil
+	}
+	return json.Marshal(fields)
+}
+
+func (store *SQLStore) decryptListRow(row *UserListRow) error {
+	return store.decryptFields(profileFields(&row.FirstName.String, &row.LastName.String, &row.StreetAddress.String, &row.Zip.String))
+}
+
+// The profile and address queries are wrapped so callers of the Store never handle ciphertext.
+
+func (store *SQLStore) CreateUserProfile(ctx context.Context, arg CreateUserProfileParams) (UserProfile, error) {
+	arg, err := store.encryptCreateProfileParams(arg)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	profile, err := store.Queries.CreateUserProfile(ctx, arg)
+	if err == nil {
+		err = store.decryptProfile(&profile)
+	}
+	return profile, err
+}
+
+func (store *SQLStore) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (UserProfile, error) {
+	arg, err := store.encryptUpdateProfileParams(arg, UserProfile{})
+	if err != nil {
+		return UserProfile{}, err
+	}
+	profile, err := store.Queries.UpdateUserProfile(ctx, arg)
+	if err == nil {
+		err = store.decryptProfile(&profile)
+	}
+	return profile, err
+}
+
+func (store *SQLStore) GetUserProfile(ctx context.Context, userID uuid.UUID) (UserProfile, error) {
+	profile, err := store.Queries.GetUserProfile(ctx, userID)
+	if err == nil {
+		err = store.decryptProfile(&profile)
+	}
+	return profile, err
+}
+
+func (store *SQLStore) GetUserProfileForUpdate(ctx context.Context, userID uuid.UUID) (UserProfile, error) {
+	profile, err := store.Queries.GetUserProfileForUpdate(ctx, userID)
+	if err == nil {
+		err = store.decryptProfile(&profile)
+	}
+	return profile, err
+}
+
+func (store *SQLStore) DeleteUserProfile(ctx context.Context, arg DeleteUserProfileParams) (UserProfile, error) {
+	profile, err := store.Queries.DeleteUserProfile(ctx, arg)
+	if err == nil {
+		err = store.decryptProfile(&profile)
+	}
+	return profile, err
+}
+
+func (store *SQLStore) RestoreUserProfile(ctx context.Context, userID uuid.UUID) (UserProfile, error) {
+	profile, err := store.Queries.RestoreUserProfile(ctx, userID)
+	if err == nil {
+		err = store.decryptProfile(&profile)
+	}
+	return profile, err
+}
+
+func (store *SQLStore) ListUserProfiles(ctx context.Context, arg ListUserProfilesParams) ([]UserProfile, error) {
+	profiles, err := store.Queries.ListUserProfiles(ctx, arg)
+	for i := 0; err == nil && i < len(profiles); i++ {
+		err = store.decryptProfile(&profiles[i])
+	}
+	return profiles, err
+}
+
+func (store *SQLStore) ListUserProfileHistory(ctx context.Context, userID uuid.UUID) ([]UserProfileHistory, error) {
+	profiles, err := store.Queries.ListUserProfileHistory(ctx, userID)
+	for i := 0; err == nil && i < len(profiles); i++ {
+		err = store.decryptProfileHistory(&profiles[i])
+	}
+	return profiles, err
+}
+
+func (store *SQLStore) GetUserProfileAsOf(ctx context.Context, arg GetUserProfileAsOfParams) (UserProfileHistory, error) {
+	profile, err := store.Queries.GetUserProfileAsOf(ctx, arg)
+	if err == nil {
+		err = store.decryptProfileHistory(&profile)
+	}
+	return profile, err
+}
+
+func (store *SQLStore) ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error) {
+	events, err := store.Queries.ListAuditEvents(ctx, arg)
+	for i := 0; err == nil && i < len(events); i++ {
+		err = store.decryptAuditEvent(&events[i])
+	}
+	return events, err
+}
+
+func (store *SQLStore) ListAuditEventsForUser(ctx context.Context, targetID uuid.UUID) ([]AuditEvent, error) {
+	events, err := store.Queries.ListAuditEventsForUser(ctx, targetID)
+	for i := 0; err == nil && i < len(events); i++ {
+		err = store.decryptAuditEvent(&events[i])
+	}
+	return events, err
+}
+
+func (store *SQLStore) CreateUserAddress(ctx context.Context, arg CreateUserAddressParams) (UserAddress, error) {
+	if err := store.encryptFields(addressFields(&arg.StreetAddress, &arg.Zip)); err != nil {
+		return UserAddress{}, err
+	}
+	address, err := store.Queries.CreateUserAddress(ctx, arg)
+	if err == nil {
+		err = store.decryptAddress(&address)
+	}
+	return address, err
+}
+
+func (store *SQLStore) UpdateUserAddress(ctx context.Context, arg UpdateUserAddressParams) (UserAddress, error) {
+	if err := store.encryptFields(addressFields(&arg.StreetAddress, &arg.Zip)); err != nil {
+		return UserAddress{}, err
+	}
+	address, err := store.Queries.UpdateUserAddress(ctx, arg)
+	if err == nil {
+		err = store.decryptAddress(&address)
+	}
+	return address, err
+}
+
+func (store *SQLStore) GetUserAddress(ctx context.Context, arg GetUserAddressParams) (UserAddress, error) {
+	address, err := store.Queries.GetUserAddress(ctx, arg)
+	if err == nil {
+		err = store.decryptAddress(&address)
+	}
+	return address, err
+}
+
+func (store *SQLStore) ListUserAddresses(ctx context.Context, userID uuid.UUID) ([]UserAddress, error) {
+	addresses, err := store.Queries.ListUserAddresses(ctx, userID)
+	for i := 0; err == nil && i < len(addresses); i++ {
+		err = store.decryptAddress(&addresses[i])
+	}
+	return addresses, err
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"whaleWake/keyring"
+	"whaleWake/util"
+)
+
+func newEncryptedTestStore(t *testing.T, keys, indexKey string) Store {
+	ring, err := keyring.NewKeyring(keys, indexKey)
+	require.NoError(t, err)
+	return NewStore(testDB, WithFieldCipher(ring))
+}
+
+func TestEncryptedUserProfile(t *testing.T) {
+	indexKey := util.RandomSymmetricKey()
+	store := newEncryptedTestStore(t, "k1:"+util.RandomSymmetricKey(), indexKey)
+	created := createRandomUserTx(t, store)
+	require.NotContains(t, created.UserProfile.FirstName, "enc:")
+
+	stored, err := testQueries.GetUserProfile(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(stored.FirstName, "enc:v1:k1:"))
+	require.True(t, strings.HasPrefix(stored.Zip, "enc:v1:k1:"))
+	require.Equal(t, created.UserProfile.BusinessName, stored.BusinessName)
+	require.True(t, stored.LastNameBidx.Valid)
+
+	fetched, err := store.GetUserWithProfileAndRoleTX(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.Equal(t, created.UserProfile.FirstName, fetched.UserProfile.FirstName)
+	require.Equal(t, created.UserProfile.Zip, fetched.UserProfile.Zip)
+
+	// An unchanged value keeps its ciphertext, so the audit diff only shows what changed.
+	_, err = store.UpdateUserWithProfileAndRoleTX(context.Background(),
+		UpdateUserParams{
+			ID:       created.User.ID,
+			UserName: created.User.UserName,
+			Email:    created.User.Email,
+			Password: created.User.Password,
+		},
+		UpdateUserProfileParams{
+			FirstName:     created.UserProfile.FirstName,
+			LastName:      created.UserProfile.LastName,
+			BusinessName:  created.UserProfile.BusinessName,
+			StreetAddress: created.UserProfile.StreetAddress,
+			City:          util.RandomString(6),
+			State:         created.UserProfile.State,
+			Zip:           created.UserProfile.Zip,
+			CountryCode:   created.UserProfile.CountryCode,
+		},
+		UpdateUserRoleParams{RoleID: created.UserRole.RoleID}, nil)
+	require.NoError(t, err)
+
+	updated, err := testQueries.GetUserProfile(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.Equal(t, stored.FirstName, updated.FirstName)
+	require.Equal(t, stored.Zip, updated.Zip)
+
+	page, err := store.SearchUsersTx(context.Background(), UserListFilter{
+		Search: strings.ToUpper(created.UserProfile.LastName),
+		Limit:  10,
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Rows, 1)
+	require.Equal(t, created.User.ID, page.Rows[0].User.ID)
+	require.Equal(t, created.UserProfile.LastName, page.Rows[0].LastName.String)
+}
+
+func TestRotateProfileKeysTx(t *testing.T) {
+	oldKey := "k1:" + util.RandomSymmetricKey()
+	indexKey := util.RandomSymmetricKey()
+	created := createRandomUserTx(t, newEncryptedTestStore(t, oldKey, indexKey))
+
+	store := newEncryptedTestStore(t, "k2:"+util.RandomSymmetricKey()+","+oldKey, indexKey)
+	var total int
+	var afterID uuid.UUID
+	for {
+		batch, err := store.RotateProfileKeysTx(context.Background(), afterID, 100)
+		require.NoError(t, err)
+		total += batch.Rotated
+		afterID = batch.LastID
+		if batch.Scanned < 100 {
+			break
+		}
+	}
+	require.GreaterOrEqual(t, total, 1)
+
+	stored, err := testQueries.GetUserProfile(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(stored.FirstName, "enc:v1:k2:"))
+
+	fetched, err := store.GetUserWithProfileAndRoleTX(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.Equal(t, created.UserProfile.StreetAddress, fetched.UserProfile.StreetAddress)
+
+	_, err = NewStore(testDB).RotateProfileKeysTx(context.Background(), uuid.Nil, 1)
+	require.ErrorIs(t, err, ErrNoFieldCipher)
+	_, err = NewStore(testDB).RotateProfileHistoryKeysTx(context.Background(), 0, 1)
+	require.ErrorIs(t, err, ErrNoFieldCipher)
+}
+
+func TestRotateAuditKeysTx(t *testing.T) {
+	oldKey := "k1:" + util.RandomSymmetricKey()
+	indexKey := util.RandomSymmetricKey()
+	created := createRandomUserTx(t, newEncryptedTestStore(t, oldKey, indexKey))
+
+	profileDiff := func(events []AuditEvent) map[string]interface{} {
+		for _, event := range events {
+			if event.TargetType == AuditTargetUserProfile && event.Action == AuditActionCreate {
+				var diff map[string]interface{}
+				require.NoError(t, json.Unmarshal(event.After, &diff))
+				return diff
+			}
+		}
+		t.Fatal("no profile audit event")
+		return nil
+	}
+
+	raw, err := testQueries.ListAuditEventsForUser(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(profileDiff(raw)["first_name"].(string), "enc:v1:k1:"))
+
+	newKey := "k2:" + util.RandomSymmetricKey()
+	store := newEncryptedTestStore(t, newKey+","+oldKey, indexKey)
+	events, err := store.ListAuditEventsForUser(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.Equal(t, created.UserProfile.FirstName, profileDiff(events)["first_name"])
+	require.Equal(t, created.UserProfile.BusinessName, profileDiff(events)["business_name"])
+
+	// Start at the user's events, since the ones other tests left behind are under keys this store doesn't have.
+	batch, err := store.RotateAuditKeysTx(context.Background(), raw[0].ID-1, 100)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, batch.Rotated, 1)
+
+	raw, err = testQueries.ListAuditEventsForUser(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(profileDiff(raw)["zip"].(string), "enc:v1:k2:"))
+
+	// Once rotated, the old key can go.
+	events, err = newEncryptedTestStore(t, newKey, indexKey).ListAuditEvents(context.Background(), ListAuditEventsParams{
+		TargetID:  uuid.NullUUID{UUID: created.User.ID, Valid: true},
+		PageLimit: 10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, created.UserProfile.Zip, profileDiff(events)["zip"])
+
+	_, err = NewStore(testDB).RotateAuditKeysTx(context.Background(), 0, 1)
+	require.ErrorIs(t, err, ErrNoFieldCipher)
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"time"
+)
+
+// UserHistoryResult holds every recorded version of a user, their profile, and role, oldest first.
+// Fields:
+// - User: Versions of the users row.
+// - UserProfile: Versions of the user_profile row.
+// - UserRole: Versions of the user_role row.
+type UserHistoryResult struct {
+	User        []UsersHistory       `json:"user"`
+	UserProfile []UserProfileHistory `json:"user_profile"`
+	UserRole    []UserRoleHistory    `json:"user_role"`
+}
+
+// recordUserHistory copies the current state of a user into users_history. The password is not copied.
+func recordUserHistory(ctx context.Context, q *Queries, user User) error {
+	_, err := q.CreateUserHistory(ctx, CreateUserHistoryParams{
+		UserID:     user.ID,
+		Version:    user.Version,
+		UserName:   user.UserName,
+		Email:      user.Email,
+		CreatedAt:  user.CreatedAt,
+		UpdatedAt:  user.UpdatedAt,
+		VerifiedAt: user.VerifiedAt,
+		DeletedAt:  user.DeletedAt,
+	})
+	return err
+}
+
+// recordUserProfileHistory copies the current state of a profile into user_profile_history.
+func recordUserProfileHistory(ctx context.Context, q *Queries, profile UserProfile) error {
+	_, err := q.CreateUserProfileHistory(ctx, CreateUserProfileHistoryParams{
+		ProfileID:       profile.ID,
+		UserID:          profile.UserID,
+		Version:         profile.Version,
+		FirstName:       profile.FirstName,
+		LastName:        profile.LastName,
+		BusinessName:    profile.BusinessName,
+		StreetAddress:   profile.StreetAddress,
+		City:            profile.City,
+		State:           profile.State,
+		Zip:             profile.Zip,
+		CountryCode:     profile.CountryCode,
+		CreatedAt:       profile.CreatedAt,
+		UpdatedAt:       profile.UpdatedAt,
+		VerifiedAt:      profile.VerifiedAt,
+		DeletedAt:       profile.DeletedAt,
+		PhoneNumber:     profile.PhoneNumber,
+		PhoneVerifiedAt: profile.PhoneVerifiedAt,
+	})
+	return err
+}
+
+// recordUserRoleHistory copies the current state of a role into user_role_history.
+func recordUserRoleHistory(ctx context.Context, q *Queries, role UserRole) error {
+	_, err := q.CreateUserRoleHistory(ctx, CreateUserRoleHistoryParams{
+		RoleRowID:  role.ID,
+		UserID:     role.UserID,
+		Version:    role.Version,
+		RoleID:     role.RoleID,
+		CreatedAt:  role.CreatedAt,
+		UpdatedAt:  role.UpdatedAt,
+		VerifiedAt: role.VerifiedAt,
+		DeletedAt:  role.DeletedAt,
+	})
+	return err
+}
+
+// purgeUserHistory removes every recorded version of a user, their profile, and role.
+func purgeUserHistory(ctx context.Context, q *Queries, userID uuid.UUID) error {
+	_, err := q.DeleteUserRoleHistory(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.DeleteUserProfileHistory(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.DeleteUserHistory(ctx, userID)
+	return err
+}
+
+// GetUserWithProfileAndRoleAsOfTx rebuilds a user, their profile, and role as they were at a point in time.
+// Parameters:
+// - ctx: The context for the transaction.
+// - userID: The UUID of the user to retrieve.
+// - asOf: The point in time to rebuild.
+// Returns:
+// - A UserTxResult built from the history tables. Passwords are not kept in history, so User.Password is empty.
+// - sql.ErrNoRows if the user, profile, or role did not exist or was deleted at that time.
+func (store *SQLStore) GetUserWithProfileAndRoleAsOfTx(ctx context.Context, userID uuid.UUID, asOf time.Time) (UserTxResult, error) {
+	var result UserTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		user, err := q.GetUserAsOf(ctx, GetUserAsOfParams{UserID: userID, AsOf: asOf})
+		if err != nil {
+			return err
+		}
+		if user.DeletedAt.Valid {
+			return sql.ErrNoRows
+		}
+
+		profile, err := q.GetUserProfileAsOf(ctx, GetUserProfileAsOfParams{UserID: userID, AsOf: asOf})
+		if err != nil {
+			return err
+		}
+		if profile.DeletedAt.Valid {
+			return sql.ErrNoRows
+		}
+
+		role, err := q.GetUserRoleAsOf(ctx, GetUserRoleAsOfParams{UserID: userID, AsOf: asOf})
+		if err != nil {
+			return err
+		}
+		if role.DeletedAt.Valid {
+			return sql.ErrNoRows
+		}
+
+		result.User = User{
+			ID:         user.UserID,
+			UserName:   user.UserName,
+			Email:      user.Email,
+			CreatedAt:  user.CreatedAt,
+			UpdatedAt:  user.UpdatedAt,
+			VerifiedAt: user.VerifiedAt,
+			Version:    user.Version,
+		}
+		result.UserProfile = UserProfile{
+			ID:              profile.ProfileID,
+			UserID:          profile.UserID,
+			FirstName:       profile.FirstName,
+			LastName:        profile.LastName,
+			BusinessName:    profile.BusinessName,
+			StreetAddress:   profile.StreetAddress,
+			City:            profile.City,
+			State:           profile.State,
+			Zip:             profile.Zip,
+			CountryCode:     profile.CountryCode,
+			CreatedAt:       profile.CreatedAt,
+			UpdatedAt:       profile.UpdatedAt,
+			VerifiedAt:      profile.VerifiedAt,
+			Version:         profile.Version,
+			PhoneNumber:     profile.PhoneNumber,
+			PhoneVerifiedAt: profile.PhoneVerifiedAt,
+		}
+		result.UserRole = UserRole{
+			ID:         role.RoleRowID,
+			UserID:     role.UserID,
+			RoleID:     role.RoleID,
+			CreatedAt:  role.CreatedAt,
+			UpdatedAt:  role.UpdatedAt,
+			VerifiedAt: role.VerifiedAt,
+			Version:    role.Version,
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		err = store.decryptProfile(&result.UserProfile)
+	}
+
+	return result, err
+}
+
+// GetUserHistoryTx retrieves every recorded version of a user, their profile, and role.
+// Parameters:
+// - ctx: The context for the transaction.
+// - userID: The UUID of the user.
+// Returns:
+// - A UserHistoryResult with each history ordered oldest first.
+// - sql.ErrNoRows if the user has no history at all.
+func (store *SQLStore) GetUserHistoryTx(ctx context.Context, userID uuid.UUID) (UserHistoryResult, error) {
+	var result UserHistoryResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		result.User, err = q.ListUserHistory(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(result.User) == 0 {
+			return sql.ErrNoRows
+		}
+
+		result.UserProfile, err = q.ListUserProfileHistory(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		result.UserRole, err = q.ListUserRoleHistory(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	for i := 0; err == nil && i < len(result.UserProfile); i++ {
+		err = store.decryptProfileHistory(&result.UserProfile[i])
+	}
+
+	return result, err
+}
@@ -0,0 +1,547 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: history.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createUserHistory = `-- name: CreateUserHistory :one
+INSERT INTO users_history (user_id, version, user_name, email, created_at, updated_at, verified_at, deleted_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, user_id, version, user_name, email, created_at, updated_at, verified_at, deleted_at, recorded_at
+`
+
+type CreateUserHistoryParams struct {
+	UserID     uuid.UUID    `json:"user_id"`
+	Version    int32        `json:"version"`
+	UserName   string       `json:"user_name"`
+	Email      string       `json:"email"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+	VerifiedAt sql.NullTime `json:"verified_at"`
+	DeletedAt  sql.NullTime `json:"deleted_at"`
+}
+
+func (q *Queries) CreateUserHistory(ctx context.Context, arg CreateUserHistoryParams) (UsersHistory, error) {
+	row := q.db.QueryRowContext(ctx, createUserHistory,
+		arg.UserID,
+		arg.Version,
+		arg.UserName,
+		arg.Email,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.VerifiedAt,
+		arg.DeletedAt,
+	)
+	var i UsersHistory
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Version,
+		&i.UserName,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.DeletedAt,
+		&i.RecordedAt,
+	)
+	return i, err
+}
+
+const createUserProfileHistory = `-- name: CreateUserProfileHistory :one
+INSERT INTO user_profile_history (profile_id,
+                                  user_id,
+                                  version,
+                                  first_name,
+                                  last_name,
+                                  business_name,
+                                  street_address,
+                                  city,
+                                  state,
+                                  zip,
+                                  country_code,
+                                  created_at,
+                                  updated_at,
+                                  verified_at,
+                                  deleted_at,
+                                  phone_number,
+                                  phone_verified_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+RETURNING id, profile_id, user_id, version, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, deleted_at, recorded_at, phone_number, phone_verified_at
+`
+
+type CreateUserProfileHistoryParams struct {
+	ProfileID       uuid.UUID    `json:"profile_id"`
+	UserID          uuid.UUID    `json:"user_id"`
+	Version         int32        `json:"version"`
+	FirstName       string       `json:"first_name"`
+	LastName        string       `json:"last_name"`
+	BusinessName    string       `json:"business_name"`
+	StreetAddress   string       `json:"street_address"`
+	City            string       `json:"city"`
+	State           string       `json:"state"`
+	Zip             string       `json:"zip"`
+	CountryCode     string       `json:"country_code"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	VerifiedAt      sql.NullTime `json:"verified_at"`
+	DeletedAt       sql.NullTime `json:"deleted_at"`
+	PhoneNumber     string       `json:"phone_number"`
+	PhoneVerifiedAt sql.NullTime `json:"phone_verified_at"`
+}
+
+func (q *Queries) CreateUserProfileHistory(ctx context.Context, arg CreateUserProfileHistoryParams) (UserProfileHistory, error) {
+	row := q.db.QueryRowContext(ctx, createUserProfileHistory,
+		arg.ProfileID,
+		arg.UserID,
+		arg.Version,
+		arg.FirstName,
+		arg.LastName,
+		arg.BusinessName,
+		arg.StreetAddress,
+		arg.City,
+		arg.State,
+		arg.Zip,
+		arg.CountryCode,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.VerifiedAt,
+		arg.DeletedAt,
+		arg.PhoneNumber,
+		arg.PhoneVerifiedAt,
+	)
+	var i UserProfileHistory
+	err := row.Scan(
+		&i.ID,
+		&i.ProfileID,
+		&i.UserID,
+		&i.Version,
+		&i.FirstName,
+		&i.LastName,
+		&i.BusinessName,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.DeletedAt,
+		&i.RecordedAt,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+	)
+	return i, err
+}
+
+const createUserRoleHistory = `-- name: CreateUserRoleHistory :one
+INSERT INTO user_role_history (role_row_id, user_id, version, role_id, created_at, updated_at, verified_at, deleted_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, role_row_id, user_id, version, role_id, created_at, updated_at, verified_at, deleted_at, recorded_at
+`
+
+type CreateUserRoleHistoryParams struct {
+	RoleRowID  uuid.UUID    `json:"role_row_id"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Version    int32        `json:"version"`
+	RoleID     int32        `json:"role_id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+	VerifiedAt sql.NullTime `json:"verified_at"`
+	DeletedAt  sql.NullTime `json:"deleted_at"`
+}
+
+func (q *Queries) CreateUserRoleHistory(ctx context.Context, arg CreateUserRoleHistoryParams) (UserRoleHistory, error) {
+	row := q.db.QueryRowContext(ctx, createUserRoleHistory,
+		arg.RoleRowID,
+		arg.UserID,
+		arg.Version,
+		arg.RoleID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.VerifiedAt,
+		arg.DeletedAt,
+	)
+	var i UserRoleHistory
+	err := row.Scan(
+		&i.ID,
+		&i.RoleRowID,
+		&i.UserID,
+		&i.Version,
+		&i.RoleID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.DeletedAt,
+		&i.RecordedAt,
+	)
+	return i, err
+}
+
+const deleteUserHistory = `-- name: DeleteUserHistory :execrows
+DELETE
+FROM users_history
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserHistory(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserHistory, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteUserProfileHistory = `-- name: DeleteUserProfileHistory :execrows
+DELETE
+FROM user_profile_history
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserProfileHistory(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserProfileHistory, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteUserRoleHistory = `-- name: DeleteUserRoleHistory :execrows
+DELETE
+FROM user_role_history
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserRoleHistory(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserRoleHistory, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getUserAsOf = `-- name: GetUserAsOf :one
+SELECT id, user_id, version, user_name, email, created_at, updated_at, verified_at, deleted_at, recorded_at
+FROM users_history
+WHERE user_id = $1
+  AND recorded_at <= $2
+ORDER BY recorded_at DESC, id DESC
+LIMIT 1
+`
+
+type GetUserAsOfParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	AsOf   time.Time `json:"as_of"`
+}
+
+func (q *Queries) GetUserAsOf(ctx context.Context, arg GetUserAsOfParams) (UsersHistory, error) {
+	row := q.db.QueryRowContext(ctx, getUserAsOf, arg.UserID, arg.AsOf)
+	var i UsersHistory
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Version,
+		&i.UserName,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.DeletedAt,
+		&i.RecordedAt,
+	)
+	return i, err
+}
+
+const getUserProfileAsOf = `-- name: GetUserProfileAsOf :one
+SELECT id, profile_id, user_id, version, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, deleted_at, recorded_at, phone_number, phone_verified_at
+FROM user_profile_history
+WHERE user_id = $1
+  AND recorded_at <= $2
+ORDER BY recorded_at DESC, id DESC
+LIMIT 1
+`
+
+type GetUserProfileAsOfParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	AsOf   time.Time `json:"as_of"`
+}
+
+func (q *Queries) GetUserProfileAsOf(ctx context.Context, arg GetUserProfileAsOfParams) (UserProfileHistory, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfileAsOf, arg.UserID, arg.AsOf)
+	var i UserProfileHistory
+	err := row.Scan(
+		&i.ID,
+		&i.ProfileID,
+		&i.UserID,
+		&i.Version,
+		&i.FirstName,
+		&i.LastName,
+		&i.BusinessName,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.DeletedAt,
+		&i.RecordedAt,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserRoleAsOf = `-- name: GetUserRoleAsOf :one
+SELECT id, role_row_id, user_id, version, role_id, created_at, updated_at, verified_at, deleted_at, recorded_at
+FROM user_role_history
+WHERE user_id = $1
+  AND recorded_at <= $2
+ORDER BY recorded_at DESC, id DESC
+LIMIT 1
+`
+
+type GetUserRoleAsOfParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	AsOf   time.Time `json:"as_of"`
+}
+
+func (q *Queries) GetUserRoleAsOf(ctx context.Context, arg GetUserRoleAsOfParams) (UserRoleHistory, error) {
+	row := q.db.QueryRowContext(ctx, getUserRoleAsOf, arg.UserID, arg.AsOf)
+	var i UserRoleHistory
+	err := row.Scan(
+		&i.ID,
+		&i.RoleRowID,
+		&i.UserID,
+		&i.Version,
+		&i.RoleID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.DeletedAt,
+		&i.RecordedAt,
+	)
+	return i, err
+}
+
+const listUserHistory = `-- name: ListUserHistory :many
+SELECT id, user_id, version, user_name, email, created_at, updated_at, verified_at, deleted_at, recorded_at
+FROM users_history
+WHERE user_id = $1
+ORDER BY recorded_at, id
+`
+
+func (q *Queries) ListUserHistory(ctx context.Context, userID uuid.UUID) ([]UsersHistory, error) {
+	rows, err := q.db.QueryContext(ctx, listUserHistory, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UsersHistory{}
+	for rows.Next() {
+		var i UsersHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Version,
+			&i.UserName,
+			&i.Email,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.VerifiedAt,
+			&i.DeletedAt,
+			&i.RecordedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserProfileHistory = `-- name: ListUserProfileHistory :many
+SELECT id, profile_id, user_id, version, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, deleted_at, recorded_at, phone_number, phone_verified_at
+FROM user_profile_history
+WHERE user_id = $1
+ORDER BY recorded_at, id
+`
+
+func (q *Queries) ListUserProfileHistory(ctx context.Context, userID uuid.UUID) ([]UserProfileHistory, error) {
+	rows, err := q.db.QueryContext(ctx, listUserProfileHistory, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UserProfileHistory{}
+	for rows.Next() {
+		var i UserProfileHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProfileID,
+			&i.UserID,
+			&i.Version,
+			&i.FirstName,
+			&i.LastName,
+			&i.BusinessName,
+			&i.StreetAddress,
+			&i.City,
+			&i.State,
+			&i.Zip,
+			&i.CountryCode,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.VerifiedAt,
+			&i.DeletedAt,
+			&i.RecordedAt,
+			&i.PhoneNumber,
+			&i.PhoneVerifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserProfileHistoryForKeyRotation = `-- name: ListUserProfileHistoryForKeyRotation :many
+SELECT id, first_name, last_name, street_address, zip
+FROM user_profile_history
+WHERE id > $1
+ORDER BY id
+LIMIT $2 FOR UPDATE
+`
+
+type ListUserProfileHistoryForKeyRotationParams struct {
+	AfterID   int64 `json:"after_id"`
+	PageLimit int32 `json:"page_limit"`
+}
+
+type ListUserProfileHistoryForKeyRotationRow struct {
+	ID            int64  `json:"id"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	StreetAddress string `json:"street_address"`
+	Zip           string `json:"zip"`
+}
+
+// Keyset pagination over id. Locks the page for the rest of the transaction.
+func (q *Queries) ListUserProfileHistoryForKeyRotation(ctx context.Context, arg ListUserProfileHistoryForKeyRotationParams) ([]ListUserProfileHistoryForKeyRotationRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserProfileHistoryForKeyRotation, arg.AfterID, arg.PageLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUserProfileHistoryForKeyRotationRow{}
+	for rows.Next() {
+		var i ListUserProfileHistoryForKeyRotationRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.StreetAddress,
+			&i.Zip,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserRoleHistory = `-- name: ListUserRoleHistory :many
+SELECT id, role_row_id, user_id, version, role_id, created_at, updated_at, verified_at, deleted_at, recorded_at
+FROM user_role_history
+WHERE user_id = $1
+ORDER BY recorded_at, id
+`
+
+func (q *Queries) ListUserRoleHistory(ctx context.Context, userID uuid.UUID) ([]UserRoleHistory, error) {
+	rows, err := q.db.QueryContext(ctx, listUserRoleHistory, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UserRoleHistory{}
+	for rows.Next() {
+		var i UserRoleHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.RoleRowID,
+			&i.UserID,
+			&i.Version,
+			&i.RoleID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.VerifiedAt,
+			&i.DeletedAt,
+			&i.RecordedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateUserProfileHistoryEncryption = `-- name: UpdateUserProfileHistoryEncryption :exec
+UPDATE user_profile_history
+SET first_name     = $1,
+    last_name      = $2,
+    street_address = $3,
+    zip            = $4
+WHERE id = $5
+`
+
+type UpdateUserProfileHistoryEncryptionParams struct {
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	StreetAddress string `json:"street_address"`
+	Zip           string `json:"zip"`
+	ID            int64  `json:"id"`
+}
+
+func (q *Queries) UpdateUserProfileHistoryEncryption(ctx context.Context, arg UpdateUserProfileHistoryEncryptionParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserProfileHistoryEncryption,
+		arg.FirstName,
+		arg.LastName,
+		arg.StreetAddress,
+		arg.Zip,
+		arg.ID,
+	)
+	return err
+}
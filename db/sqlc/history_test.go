@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGetUserWithProfileAndRoleAsOfTx(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+
+	// now() in Postgres is the transaction start time, so leave a gap either side of the update
+	time.Sleep(10 * time.Millisecond)
+	beforeUpdate := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	profile := created.UserProfile
+	_, err := store.UpdateUserWithProfileAndRoleTX(context.Background(),
+		UpdateUserParams{
+			ID:       created.User.ID,
+			UserName: created.User.UserName,
+			Email:    created.User.Email,
+			Password: created.User.Password,
+		},
+		UpdateUserProfileParams{
+			FirstName:     profile.FirstName,
+			LastName:      profile.LastName,
+			BusinessName:  profile.BusinessName,
+			StreetAddress: "42 Moved Street",
+			City:          profile.City,
+			State:         profile.State,
+			Zip:           profile.Zip,
+			CountryCode:   profile.CountryCode,
+		},
+		UpdateUserRoleParams{RoleID: created.UserRole.RoleID}, nil)
+	require.NoError(t, err)
+
+	old, err := store.GetUserWithProfileAndRoleAsOfTx(context.Background(), created.User.ID, beforeUpdate)
+	require.NoError(t, err)
+	require.Equal(t, profile.StreetAddress, old.UserProfile.StreetAddress)
+	require.Equal(t, int32(1), old.UserProfile.Version)
+	require.Empty(t, old.User.Password)
+
+	current, err := store.GetUserWithProfileAndRoleAsOfTx(context.Background(), created.User.ID, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "42 Moved Street", current.UserProfile.StreetAddress)
+	require.Equal(t, int32(2), current.UserProfile.Version)
+
+	// Before the user was created there is nothing to rebuild
+	_, err = store.GetUserWithProfileAndRoleAsOfTx(context.Background(), created.User.ID, created.User.CreatedAt.Add(-time.Hour))
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	history, err := store.GetUserHistoryTx(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.Len(t, history.User, 2)
+	require.Len(t, history.UserProfile, 2)
+	require.Len(t, history.UserRole, 2)
+	require.Equal(t, profile.StreetAddress, history.UserProfile[0].StreetAddress)
+	require.Equal(t, "42 Moved Street", history.UserProfile[1].StreetAddress)
+}
+
+func TestAsOfAfterDelete(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+
+	time.Sleep(10 * time.Millisecond)
+	beforeDelete := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	_, err := store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: created.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
+	require.NoError(t, err)
+
+	_, err = store.GetUserWithProfileAndRoleAsOfTx(context.Background(), created.User.ID, time.Now())
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	old, err := store.GetUserWithProfileAndRoleAsOfTx(context.Background(), created.User.ID, beforeDelete)
+	require.NoError(t, err)
+	require.Equal(t, created.User.ID, old.User.ID)
+}
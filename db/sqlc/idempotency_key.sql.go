@@ -0,0 +1,144 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: idempotency_key.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const completeIdempotencyKey = `-- name: CompleteIdempotencyKey :one
+UPDATE idempotency_keys
+SET response_status  = $3,
+    response_body    = $4,
+    response_headers = $5,
+    completed_at     = STATEMENT_TIMESTAMP()
+WHERE key = $1
+  AND request_path = $2
+RETURNING key, request_path, request_hash, response_status, response_body, created_at, completed_at, response_headers
+`
+
+type CompleteIdempotencyKeyParams struct {
+	Key             string          `json:"key"`
+	RequestPath     string          `json:"request_path"`
+	ResponseStatus  sql.NullInt32   `json:"response_status"`
+	ResponseBody    []byte          `json:"response_body"`
+	ResponseHeaders json.RawMessage `json:"response_headers"`
+}
+
+func (q *Queries) CompleteIdempotencyKey(ctx context.Context, arg CompleteIdempotencyKeyParams) (IdempotencyKey, error) {
+	row := q.db.QueryRowContext(ctx, completeIdempotencyKey,
+		arg.Key,
+		arg.RequestPath,
+		arg.ResponseStatus,
+		arg.ResponseBody,
+		arg.ResponseHeaders,
+	)
+	var i IdempotencyKey
+	err := row.Scan(
+		&i.Key,
+		&i.RequestPath,
+		&i.RequestHash,
+		&i.ResponseStatus,
+		&i.ResponseBody,
+		&i.CreatedAt,
+		&i.CompletedAt,
+		&i.ResponseHeaders,
+	)
+	return i, err
+}
+
+const createIdempotencyKey = `-- name: CreateIdempotencyKey :one
+INSERT INTO idempotency_keys (key, request_path, request_hash)
+VALUES ($1, $2, $3)
+ON CONFLICT (key, request_path) DO NOTHING
+RETURNING key, request_path, request_hash, response_status, response_body, created_at, completed_at, response_headers
+`
+
+type CreateIdempotencyKeyParams struct {
+	Key         string `json:"key"`
+	RequestPath string `json:"request_path"`
+	RequestHash string `json:"request_hash"`
+}
+
+// Returns no rows when the key is already taken for this path.
+func (q *Queries) CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (IdempotencyKey, error) {
+	row := q.db.QueryRowContext(ctx, createIdempotencyKey, arg.Key, arg.RequestPath, arg.RequestHash)
+	var i IdempotencyKey
+	err := row.Scan(
+		&i.Key,
+		&i.RequestPath,
+		&i.RequestHash,
+		&i.ResponseStatus,
+		&i.ResponseBody,
+		&i.CreatedAt,
+		&i.CompletedAt,
+		&i.ResponseHeaders,
+	)
+	return i, err
+}
+
+const deleteExpiredIdempotencyKeys = `-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE
+FROM idempotency_keys
+WHERE created_at < $1
+`
+
+func (q *Queries) DeleteExpiredIdempotencyKeys(ctx context.Context, createdAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredIdempotencyKeys, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteIdempotencyKey = `-- name: DeleteIdempotencyKey :exec
+DELETE
+FROM idempotency_keys
+WHERE key = $1
+  AND request_path = $2
+`
+
+type DeleteIdempotencyKeyParams struct {
+	Key         string `json:"key"`
+	RequestPath string `json:"request_path"`
+}
+
+func (q *Queries) DeleteIdempotencyKey(ctx context.Context, arg DeleteIdempotencyKeyParams) error {
+	_, err := q.db.ExecContext(ctx, deleteIdempotencyKey, arg.Key, arg.RequestPath)
+	return err
+}
+
+const getIdempotencyKey = `-- name: GetIdempotencyKey :one
+SELECT key, request_path, request_hash, response_status, response_body, created_at, completed_at, response_headers
+FROM idempotency_keys
+WHERE key = $1
+  AND request_path = $2
+LIMIT 1
+`
+
+type GetIdempotencyKeyParams struct {
+	Key         string `json:"key"`
+	RequestPath string `json:"request_path"`
+}
+
+func (q *Queries) GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (IdempotencyKey, error) {
+	row := q.db.QueryRowContext(ctx, getIdempotencyKey, arg.Key, arg.RequestPath)
+	var i IdempotencyKey
+	err := row.Scan(
+		&i.Key,
+		&i.RequestPath,
+		&i.RequestHash,
+		&i.ResponseStatus,
+		&i.ResponseBody,
+		&i.CreatedAt,
+		&i.CompletedAt,
+		&i.ResponseHeaders,
+	)
+	return i, err
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"whaleWake/util"
+)
+
+func createRandomIdempotencyKey(t *testing.T) IdempotencyKey {
+	arg := CreateIdempotencyKeyParams{
+		Key:         util.RandomUUID().String(),
+		RequestPath: "/users",
+		RequestHash: util.RandomHexString(64),
+	}
+
+	record, err := testQueries.CreateIdempotencyKey(context.Background(), arg)
+	require.NoError(t, err)
+
+	require.Equal(t, arg.Key, record.Key)
+	require.Equal(t, arg.RequestPath, record.RequestPath)
+	require.Equal(t, arg.RequestHash, record.RequestHash)
+	require.NotZero(t, record.CreatedAt)
+	require.False(t, record.CompletedAt.Valid)
+	require.False(t, record.ResponseStatus.Valid)
+
+	return record
+}
+
+func TestCreateIdempotencyKeyConflict(t *testing.T) {
+	record := createRandomIdempotencyKey(t)
+
+	t.Cleanup(func() {
+		_ = testQueries.DeleteIdempotencyKey(context.Background(), DeleteIdempotencyKeyParams{
+			Key:         record.Key,
+			RequestPath: record.RequestPath,
+		})
+	})
+
+	_, err := testQueries.CreateIdempotencyKey(context.Background(), CreateIdempotencyKeyParams{
+		Key:         record.Key,
+		RequestPath: record.RequestPath,
+		RequestHash: util.RandomHexString(64),
+	})
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+}
+
+func TestCompleteIdempotencyKey(t *testing.T) {
+	record := createRandomIdempotencyKey(t)
+
+	t.Cleanup(func() {
+		_ = testQueries.DeleteIdempotencyKey(context.Background(), DeleteIdempotencyKeyParams{
+			Key:         record.Key,
+			RequestPath: record.RequestPath,
+		})
+	})
+
+	completed, err := testQueries.CompleteIdempotencyKey(context.Background(), CompleteIdempotencyKeyParams{
+		Key:            record.Key,
+		RequestPath:    record.RequestPath,
+		ResponseStatus: sql.NullInt32{Int32: 200, Valid: true},
+		ResponseBody:   []byte(`{"id":"1"}`),
+	})
+	require.NoError(t, err)
+
+	fetched, err := testQueries.GetIdempotencyKey(context.Background(), GetIdempotencyKeyParams{
+		Key:         record.Key,
+		RequestPath: record.RequestPath,
+	})
+	require.NoError(t, err)
+	require.Equal(t, completed.ResponseStatus, fetched.ResponseStatus)
+	require.Equal(t, completed.ResponseBody, fetched.ResponseBody)
+	require.True(t, fetched.CompletedAt.Valid)
+}
+
+func TestDeleteExpiredIdempotencyKeys(t *testing.T) {
+	record := createRandomIdempotencyKey(t)
+
+	_, err := testQueries.DeleteExpiredIdempotencyKeys(context.Background(), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	_, err = testQueries.GetIdempotencyKey(context.Background(), GetIdempotencyKeyParams{
+		Key:         record.Key,
+		RequestPath: record.RequestPath,
+	})
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+}
@@ -0,0 +1,8 @@
+package db
+
+// Statuses of a background import job.
+const (
+	ImportJobStatusRunning   = "running"
+	ImportJobStatusCompleted = "completed"
+	ImportJobStatusFailed    = "failed"
+)
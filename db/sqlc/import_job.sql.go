@@ -0,0 +1,207 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: import_job.sql
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createImportJob = `-- name: CreateImportJob :one
+INSERT INTO import_jobs (created_by, format, dry_run, total_rows)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_by, format, dry_run, status, total_rows, processed_rows, succeeded_rows, failed_rows, results, error, created_at, updated_at, finished_at
+`
+
+type CreateImportJobParams struct {
+	CreatedBy uuid.UUID `json:"created_by"`
+	Format    string    `json:"format"`
+	DryRun    bool      `json:"dry_run"`
+	TotalRows int32     `json:"total_rows"`
+}
+
+func (q *Queries) CreateImportJob(ctx context.Context, arg CreateImportJobParams) (ImportJob, error) {
+	row := q.db.QueryRowContext(ctx, createImportJob,
+		arg.CreatedBy,
+		arg.Format,
+		arg.DryRun,
+		arg.TotalRows,
+	)
+	var i ImportJob
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedBy,
+		&i.Format,
+		&i.DryRun,
+		&i.Status,
+		&i.TotalRows,
+		&i.ProcessedRows,
+		&i.SucceededRows,
+		&i.FailedRows,
+		&i.Results,
+		&i.Error,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FinishedAt,
+	)
+	return i, err
+}
+
+const failStaleImportJobs = `-- name: FailStaleImportJobs :execrows
+UPDATE import_jobs
+SET status      = 'failed',
+    error       = $1,
+    updated_at  = now(),
+    finished_at = now()
+WHERE status = 'running'
+  AND updated_at < $2::timestamptz
+`
+
+type FailStaleImportJobsParams struct {
+	Error         string    `json:"error"`
+	UpdatedBefore time.Time `json:"updated_before"`
+}
+
+// Fails the running jobs that have not saved progress since updated_before, because the process running them
+// stopped without finishing them.
+func (q *Queries) FailStaleImportJobs(ctx context.Context, arg FailStaleImportJobsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, failStaleImportJobs, arg.Error, arg.UpdatedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const finishImportJob = `-- name: FinishImportJob :one
+UPDATE import_jobs
+SET status         = $2,
+    processed_rows = $3,
+    succeeded_rows = $4,
+    failed_rows    = $5,
+    results        = $6,
+    error          = $7,
+    updated_at     = now(),
+    finished_at    = now()
+WHERE id = $1
+RETURNING id, created_by, format, dry_run, status, total_rows, processed_rows, succeeded_rows, failed_rows, results, error, created_at, updated_at, finished_at
+`
+
+type FinishImportJobParams struct {
+	ID            uuid.UUID       `json:"id"`
+	Status        string          `json:"status"`
+	ProcessedRows int32           `json:"processed_rows"`
+	SucceededRows int32           `json:"succeeded_rows"`
+	FailedRows    int32           `json:"failed_rows"`
+	Results       json.RawMessage `json:"results"`
+	Error         string          `json:"error"`
+}
+
+// status is completed or failed; error explains a failed job.
+func (q *Queries) FinishImportJob(ctx context.Context, arg FinishImportJobParams) (ImportJob, error) {
+	row := q.db.QueryRowContext(ctx, finishImportJob,
+		arg.ID,
+		arg.Status,
+		arg.ProcessedRows,
+		arg.SucceededRows,
+		arg.FailedRows,
+		arg.Results,
+		arg.Error,
+	)
+	var i ImportJob
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedBy,
+		&i.Format,
+		&i.DryRun,
+		&i.Status,
+		&i.TotalRows,
+		&i.ProcessedRows,
+		&i.SucceededRows,
+		&i.FailedRows,
+		&i.Results,
+		&i.Error,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FinishedAt,
+	)
+	return i, err
+}
+
+const getImportJob = `-- name: GetImportJob :one
+SELECT id, created_by, format, dry_run, status, total_rows, processed_rows, succeeded_rows, failed_rows, results, error, created_at, updated_at, finished_at
+FROM import_jobs
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) GetImportJob(ctx context.Context, id uuid.UUID) (ImportJob, error) {
+	row := q.db.QueryRowContext(ctx, getImportJob, id)
+	var i ImportJob
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedBy,
+		&i.Format,
+		&i.DryRun,
+		&i.Status,
+		&i.TotalRows,
+		&i.ProcessedRows,
+		&i.SucceededRows,
+		&i.FailedRows,
+		&i.Results,
+		&i.Error,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FinishedAt,
+	)
+	return i, err
+}
+
+const updateImportJobProgress = `-- name: UpdateImportJobProgress :one
+UPDATE import_jobs
+SET processed_rows = $2,
+    succeeded_rows = $3,
+    failed_rows    = $4,
+    updated_at     = now()
+WHERE id = $1
+RETURNING id, created_by, format, dry_run, status, total_rows, processed_rows, succeeded_rows, failed_rows, results, error, created_at, updated_at, finished_at
+`
+
+type UpdateImportJobProgressParams struct {
+	ID            uuid.UUID `json:"id"`
+	ProcessedRows int32     `json:"processed_rows"`
+	SucceededRows int32     `json:"succeeded_rows"`
+	FailedRows    int32     `json:"failed_rows"`
+}
+
+func (q *Queries) UpdateImportJobProgress(ctx context.Context, arg UpdateImportJobProgressParams) (ImportJob, error) {
+	row := q.db.QueryRowContext(ctx, updateImportJobProgress,
+		arg.ID,
+		arg.ProcessedRows,
+		arg.SucceededRows,
+		arg.FailedRows,
+	)
+	var i ImportJob
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedBy,
+		&i.Format,
+		&i.DryRun,
+		&i.Status,
+		&i.TotalRows,
+		&i.ProcessedRows,
+		&i.SucceededRows,
+		&i.FailedRows,
+		&i.Results,
+		&i.Error,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FinishedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+	"whaleWake/util"
+)
+
+func TestImportJobLifecycle(t *testing.T) {
+	createdBy := util.RandomUUID()
+	job, err := testQueries.CreateImportJob(context.Background(), CreateImportJobParams{
+		CreatedBy: createdBy,
+		Format:    "csv",
+		DryRun:    true,
+		TotalRows: 50,
+	})
+	require.NoError(t, err)
+	require.Equal(t, createdBy, job.CreatedBy)
+	require.Equal(t, "running", job.Status)
+	require.JSONEq(t, "[]", string(job.Results))
+	require.False(t, job.FinishedAt.Valid)
+
+	job, err = testQueries.UpdateImportJobProgress(context.Background(), UpdateImportJobProgressParams{
+		ID:            job.ID,
+		ProcessedRows: 25,
+		SucceededRows: 20,
+		FailedRows:    5,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(25), job.ProcessedRows)
+
+	results := json.RawMessage(`[{"row":1,"status":"valid"}]`)
+	job, err = testQueries.FinishImportJob(context.Background(), FinishImportJobParams{
+		ID:            job.ID,
+		Status:        "completed",
+		ProcessedRows: 50,
+		SucceededRows: 45,
+		FailedRows:    5,
+		Results:       results,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "completed", job.Status)
+	require.True(t, job.FinishedAt.Valid)
+
+	fetched, err := testQueries.GetImportJob(context.Background(), job.ID)
+	require.NoError(t, err)
+	require.Equal(t, int32(45), fetched.SucceededRows)
+	require.JSONEq(t, string(results), string(fetched.Results))
+}
+
+func TestFailStaleImportJobs(t *testing.T) {
+	create := func() ImportJob {
+		job, err := testQueries.CreateImportJob(context.Background(), CreateImportJobParams{
+			CreatedBy: util.RandomUUID(),
+			Format:    "ndjson",
+			TotalRows: 10,
+		})
+		require.NoError(t, err)
+		return job
+	}
+	stale, finished := create(), create()
+	_, err := testQueries.FinishImportJob(context.Background(), FinishImportJobParams{
+		ID:      finished.ID,
+		Status:  ImportJobStatusCompleted,
+		Results: json.RawMessage("[]"),
+	})
+	require.NoError(t, err)
+
+	failed, err := testQueries.FailStaleImportJobs(context.Background(), FailStaleImportJobsParams{
+		Error:         "gone",
+		UpdatedBefore: time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, failed, int64(1))
+
+	job, err := testQueries.GetImportJob(context.Background(), stale.ID)
+	require.NoError(t, err)
+	require.Equal(t, ImportJobStatusFailed, job.Status)
+	require.Equal(t, "gone", job.Error)
+	require.True(t, job.FinishedAt.Valid)
+
+	job, err = testQueries.GetImportJob(context.Background(), finished.ID)
+	require.NoError(t, err)
+	require.Equal(t, ImportJobStatusCompleted, job.Status)
+}
+
+func TestGetUserNameAndEmailTaken(t *testing.T) {
+	user := createRandomUser(t)
+
+	taken, err := testQueries.GetUserNameAndEmailTaken(context.Background(), GetUserNameAndEmailTakenParams{
+		UserName: strings.ToUpper(user.UserName),
+		Email:    util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	require.True(t, taken.UserNameTaken)
+	require.False(t, taken.EmailTaken)
+
+	taken, err = testQueries.GetUserNameAndEmailTaken(context.Background(), GetUserNameAndEmailTakenParams{
+		UserName: util.RandomUserName(),
+		Email:    strings.ToUpper(user.Email),
+	})
+	require.NoError(t, err)
+	require.False(t, taken.UserNameTaken)
+	require.True(t, taken.EmailTaken)
+}
@@ -0,0 +1,286 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"github.com/google/uuid"
+)
+
+// ProfileKeyRotationBatch reports one batch of RotateProfileKeysTx.
+// Fields:
+// - Scanned: Rows read. Fewer than the limit means the table is done.
+// - Rotated: Rows rewritten because a value was plaintext or under an older key, or a blind index was stale.
+// - LastID: The id to continue after.
+type ProfileKeyRotationBatch struct {
+	Scanned int
+	Rotated int
+	LastID  uuid.UUID
+}
+
+// ProfileHistoryKeyRotationBatch reports one batch of RotateProfileHistoryKeysTx, as ProfileKeyRotationBatch does.
+type ProfileHistoryKeyRotationBatch struct {
+	Scanned int
+	Rotated int
+	LastID  int64
+}
+
+// AddressKeyRotationBatch reports one batch of RotateAddressKeysTx, as ProfileKeyRotationBatch does.
+type AddressKeyRotationBatch struct {
+	Scanned int
+	Rotated int
+	LastID  uuid.UUID
+}
+
+// AuditKeyRotationBatch reports one batch of RotateAuditKeysTx, as ProfileHistoryKeyRotationBatch does.
+type AuditKeyRotationBatch struct {
+	Scanned int
+	Rotated int
+	LastID  int64
+}
+
+// RotateProfileKeysTx re-encrypts one batch of user profiles under the current key and refreshes their blind indexes.
+// Soft deleted rows are included. Values are unchanged, so no new version, history row, or audit event is written.
+// Parameters:
+// - ctx: The context for the transaction.
+// - afterID: Start after this profile id; uuid.Nil for the first batch.
+// - limit: The batch size.
+// Returns:
+// - The batch counts and where to continue.
+// - ErrNoFieldCipher if the store has no cipher, or an error if a value cannot be decrypted with the configured keys.
+func (store *SQLStore) RotateProfileKeysTx(ctx context.Context, afterID uuid.UUID, limit int32) (ProfileKeyRotationBatch, error) {
+	var batch ProfileKeyRotationBatch
+	if store.fields == nil {
+		return batch, ErrNoFieldCipher
+	}
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		rows, err := q.ListUserProfilesForKeyRotation(ctx, ListUserProfilesForKeyRotationParams{AfterID: afterID, PageLimit: limit})
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			batch.Scanned++
+			batch.LastID = row.ID
+
+			arg := UpdateUserProfileEncryptionParams{
+				ID:            row.ID,
+				FirstName:     row.FirstName,
+				LastName:      row.LastName,
+				StreetAddress: row.StreetAddress,
+				Zip:           row.Zip,
+			}
+			fields := profileFields(&arg.FirstName, &arg.LastName, &arg.StreetAddress, &arg.Zip)
+
+			stale, err := store.rotateFields(fields)
+			if err != nil {
+				return err
+			}
+
+			arg.FirstNameBidx = store.blindIndex(fieldFirstName, *fields[0].value)
+			arg.LastNameBidx = store.blindIndex(fieldLastName, *fields[1].value)
+			arg.ZipBidx = store.blindIndex(fieldZip, *fields[3].value)
+			if !stale && arg.FirstNameBidx == row.FirstNameBidx && arg.LastNameBidx == row.LastNameBidx && arg.ZipBidx == row.ZipBidx {
+				continue
+			}
+
+			if err = store.encryptFields(fields); err != nil {
+				return err
+			}
+			if err = q.UpdateUserProfileEncryption(ctx, arg); err != nil {
+				return err
+			}
+			batch.Rotated++
+		}
+
+		return nil
+	})
+
+	return batch, err
+}
+
+// RotateProfileHistoryKeysTx re-encrypts one batch of user_profile_history rows under the current key.
+// Parameters:
+// - ctx: The context for the transaction.
+// - afterID: Start after this history id; 0 for the first batch.
+// - limit: The batch size.
+// Returns:
+// - The batch counts and where to continue.
+// - ErrNoFieldCipher if the store has no cipher, or an error if a value cannot be decrypted with the configured keys.
+func (store *SQLStore) RotateProfileHistoryKeysTx(ctx context.Context, afterID int64, limit int32) (ProfileHistoryKeyRotationBatch, error) {
+	var batch ProfileHistoryKeyRotationBatch
+	if store.fields == nil {
+		return batch, ErrNoFieldCipher
+	}
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		rows, err := q.ListUserProfileHistoryForKeyRotation(ctx, ListUserProfileHistoryForKeyRotationParams{AfterID: afterID, PageLimit: limit})
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			batch.Scanned++
+			batch.LastID = row.ID
+
+			arg := UpdateUserProfileHistoryEncryptionParams{
+				ID:            row.ID,
+				FirstName:     row.FirstName,
+				LastName:      row.LastName,
+				StreetAddress: row.StreetAddress,
+				Zip:           row.Zip,
+			}
+			fields := profileFields(&arg.FirstName, &arg.LastName, &arg.StreetAddress, &arg.Zip)
+
+			stale, err := store.rotateFields(fields)
+			if err != nil {
+				return err
+			}
+			if !stale {
+				continue
+			}
+
+			if err = store.encryptFields(fields); err != nil {
+				return err
+			}
+			if err = q.UpdateUserProfileHistoryEncryption(ctx, arg); err != nil {
+				return err
+			}
+			batch.Rotated++
+		}
+
+		return nil
+	})
+
+	return batch, err
+}
+
+// RotateAddressKeysTx re-encrypts one batch of user addresses under the current key.
+// Parameters:
+// - ctx: The context for the transaction.
+// - afterID: Start after this address id; uuid.Nil for the first batch.
+// - limit: The batch size.
+// Returns:
+// - The batch counts and where to continue.
+// - ErrNoFieldCipher if the store has no cipher, or an error if a value cannot be decrypted with the configured keys.
+func (store *SQLStore) RotateAddressKeysTx(ctx context.Context, afterID uuid.UUID, limit int32) (AddressKeyRotationBatch, error) {
+	var batch AddressKeyRotationBatch
+	if store.fields == nil {
+		return batch, ErrNoFieldCipher
+	}
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		rows, err := q.ListUserAddressesForKeyRotation(ctx, ListUserAddressesForKeyRotationParams{AfterID: afterID, PageLimit: limit})
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			batch.Scanned++
+			batch.LastID = row.ID
+
+			arg := UpdateUserAddressEncryptionParams{
+				ID:            row.ID,
+				StreetAddress: row.StreetAddress,
+				Zip:           row.Zip,
+			}
+			fields := addressFields(&arg.StreetAddress, &arg.Zip)
+
+			stale, err := store.rotateFields(fields)
+			if err != nil {
+				return err
+			}
+			if !stale {
+				continue
+			}
+
+			if err = store.encryptFields(fields); err != nil {
+				return err
+			}
+			if err = q.UpdateUserAddressEncryption(ctx, arg); err != nil {
+				return err
+			}
+			batch.Rotated++
+		}
+
+		return nil
+	})
+
+	return batch, err
+}
+
+// RotateAuditKeysTx re-encrypts the encrypted fields in one batch of audit diffs of profile and address changes
+// under the current key. Nothing but those values changes, and no audit event is written for the rewrite.
+// Parameters:
+// - ctx: The context for the transaction.
+// - afterID: Start after this audit event id; 0 for the first batch.
+// - limit: The batch size.
+// Returns:
+// - The batch counts and where to continue.
+// - ErrNoFieldCipher if the store has no cipher, or an error if a value cannot be decrypted with the configured keys.
+func (store *SQLStore) RotateAuditKeysTx(ctx context.Context, afterID int64, limit int32) (AuditKeyRotationBatch, error) {
+	var batch AuditKeyRotationBatch
+	if store.fields == nil {
+		return batch, ErrNoFieldCipher
+	}
+
+	// Values already under the current key are kept, so a diff without stale values comes back unchanged.
+	rotate := func(field, value string) (string, error) {
+		if store.fields.IsCurrent(value) {
+			return value, nil
+		}
+		plaintext, err := store.fields.Decrypt(field, value)
+		if err != nil {
+			return "", err
+		}
+		return store.fields.Encrypt(field, plaintext)
+	}
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		if err := q.AllowAuditKeyRotation(ctx); err != nil {
+			return err
+		}
+
+		rows, err := q.ListAuditEventsForKeyRotation(ctx, ListAuditEventsForKeyRotationParams{AfterID: afterID, PageLimit: limit})
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			batch.Scanned++
+			batch.LastID = row.ID
+
+			before, err := mapAuditDiff(row.TargetType, row.Before, rotate)
+			if err != nil {
+				return err
+			}
+			after, err := mapAuditDiff(row.TargetType, row.After, rotate)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(before, row.Before) && bytes.Equal(after, row.After) {
+				continue
+			}
+
+			if err = q.UpdateAuditEventEncryption(ctx, UpdateAuditEventEncryptionParams{ID: row.ID, Before: before, After: after}); err != nil {
+				return err
+			}
+			batch.Rotated++
+		}
+
+		return nil
+	})
+
+	return batch, err
+}
+
+// rotateFields decrypts the values in place and reports whether any of them was not under the current key.
+func (store *SQLStore) rotateFields(fields []encryptedField) (bool, error) {
+	stale := false
+	for _, field := range fields {
+		if !store.fields.IsCurrent(*field.value) {
+			stale = true
+		}
+	}
+	return stale, store.decryptFields(fields)
+}
@@ -6,11 +6,123 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AttributeDefinition struct {
+	ID         uuid.UUID     `json:"id"`
+	Key        string        `json:"key"`
+	Label      string        `json:"label"`
+	Type       string        `json:"type"`
+	Required   bool          `json:"required"`
+	EnumValues []string      `json:"enum_values"`
+	Pattern    string        `json:"pattern"`
+	MaxLength  int32         `json:"max_length"`
+	Minimum    sql.NullInt64 `json:"minimum"`
+	Maximum    sql.NullInt64 `json:"maximum"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+type AuditEvent struct {
+	ID          int64           `json:"id"`
+	ActorID     uuid.NullUUID   `json:"actor_id"`
+	ActorRoleID sql.NullInt32   `json:"actor_role_id"`
+	Action      string          `json:"action"`
+	TargetType  string          `json:"target_type"`
+	TargetID    uuid.UUID       `json:"target_id"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	RequestID   string          `json:"request_id"`
+	Ip          string          `json:"ip"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type BlobDeletion struct {
+	ObjectKey string    `json:"object_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type EmailChange struct {
+	ID               uuid.UUID    `json:"id"`
+	UserID           uuid.UUID    `json:"user_id"`
+	OldEmail         string       `json:"old_email"`
+	NewEmail         string       `json:"new_email"`
+	ConfirmTokenHash string       `json:"confirm_token_hash"`
+	RevertTokenHash  string       `json:"revert_token_hash"`
+	CreatedAt        time.Time    `json:"created_at"`
+	ExpiresAt        time.Time    `json:"expires_at"`
+	RevertExpiresAt  time.Time    `json:"revert_expires_at"`
+	ConfirmedAt      sql.NullTime `json:"confirmed_at"`
+	RevertedAt       sql.NullTime `json:"reverted_at"`
+	CancelledAt      sql.NullTime `json:"cancelled_at"`
+}
+
+type ErasureRequest struct {
+	ID           uuid.UUID    `json:"id"`
+	UserID       uuid.UUID    `json:"user_id"`
+	Status       string       `json:"status"`
+	RequestedAt  time.Time    `json:"requested_at"`
+	ScheduledFor time.Time    `json:"scheduled_for"`
+	CancelledAt  sql.NullTime `json:"cancelled_at"`
+	CompletedAt  sql.NullTime `json:"completed_at"`
+}
+
+type IdempotencyKey struct {
+	Key             string          `json:"key"`
+	RequestPath     string          `json:"request_path"`
+	RequestHash     string          `json:"request_hash"`
+	ResponseStatus  sql.NullInt32   `json:"response_status"`
+	ResponseBody    []byte          `json:"response_body"`
+	CreatedAt       time.Time       `json:"created_at"`
+	CompletedAt     sql.NullTime    `json:"completed_at"`
+	ResponseHeaders json.RawMessage `json:"response_headers"`
+}
+
+type ImportJob struct {
+	ID            uuid.UUID       `json:"id"`
+	CreatedBy     uuid.UUID       `json:"created_by"`
+	Format        string          `json:"format"`
+	DryRun        bool            `json:"dry_run"`
+	Status        string          `json:"status"`
+	TotalRows     int32           `json:"total_rows"`
+	ProcessedRows int32           `json:"processed_rows"`
+	SucceededRows int32           `json:"succeeded_rows"`
+	FailedRows    int32           `json:"failed_rows"`
+	Results       json.RawMessage `json:"results"`
+	Error         string          `json:"error"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+	FinishedAt    sql.NullTime    `json:"finished_at"`
+}
+
+type Outbox struct {
+	ID             int64           `json:"id"`
+	EventType      string          `json:"event_type"`
+	UserID         uuid.UUID       `json:"user_id"`
+	Data           json.RawMessage `json:"data"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      string          `json:"last_error"`
+	PublishedAt    sql.NullTime    `json:"published_at"`
+	StreamPosition sql.NullInt64   `json:"stream_position"`
+}
+
+type PhoneVerification struct {
+	ID          uuid.UUID    `json:"id"`
+	UserID      uuid.UUID    `json:"user_id"`
+	PhoneNumber string       `json:"phone_number"`
+	CodeHash    string       `json:"code_hash"`
+	Attempts    int32        `json:"attempts"`
+	CreatedAt   time.Time    `json:"created_at"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+	VerifiedAt  sql.NullTime `json:"verified_at"`
+}
+
 type User struct {
 	ID         uuid.UUID    `json:"id"`
 	UserName   string       `json:"user_name"`
@@ -19,22 +131,95 @@ type User struct {
 	CreatedAt  time.Time    `json:"created_at"`
 	UpdatedAt  time.Time    `json:"updated_at"`
 	VerifiedAt sql.NullTime `json:"verified_at"`
+	Version    int32        `json:"version"`
+	DeletedAt  sql.NullTime `json:"deleted_at"`
+}
+
+type UserAddress struct {
+	ID            uuid.UUID `json:"id"`
+	UserID        uuid.UUID `json:"user_id"`
+	Type          string    `json:"type"`
+	Label         string    `json:"label"`
+	IsDefault     bool      `json:"is_default"`
+	StreetAddress string    `json:"street_address"`
+	City          string    `json:"city"`
+	State         string    `json:"state"`
+	Zip           string    `json:"zip"`
+	CountryCode   string    `json:"country_code"`
+	Version       int32     `json:"version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type UserAttribute struct {
+	UserID       uuid.UUID       `json:"user_id"`
+	DefinitionID uuid.UUID       `json:"definition_id"`
+	Value        json.RawMessage `json:"value"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+type UserDocument struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	ObjectKey   string    `json:"object_key"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type UserNameReservation struct {
+	UserName  string    `json:"user_name"`
+	UserID    uuid.UUID `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type UserProfile struct {
-	ID            uuid.UUID    `json:"id"`
-	UserID        uuid.UUID    `json:"user_id"`
-	FirstName     string       `json:"first_name"`
-	LastName      string       `json:"last_name"`
-	BusinessName  string       `json:"business_name"`
-	StreetAddress string       `json:"street_address"`
-	City          string       `json:"city"`
-	State         string       `json:"state"`
-	Zip           string       `json:"zip"`
-	CountryCode   string       `json:"country_code"`
-	CreatedAt     time.Time    `json:"created_at"`
-	UpdatedAt     time.Time    `json:"updated_at"`
-	VerifiedAt    sql.NullTime `json:"verified_at"`
+	ID                uuid.UUID      `json:"id"`
+	UserID            uuid.UUID      `json:"user_id"`
+	FirstName         string         `json:"first_name"`
+	LastName          string         `json:"last_name"`
+	BusinessName      string         `json:"business_name"`
+	StreetAddress     string         `json:"street_address"`
+	City              string         `json:"city"`
+	State             string         `json:"state"`
+	Zip               string         `json:"zip"`
+	CountryCode       string         `json:"country_code"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	VerifiedAt        sql.NullTime   `json:"verified_at"`
+	Version           int32          `json:"version"`
+	DeletedAt         sql.NullTime   `json:"deleted_at"`
+	FirstNameBidx     sql.NullString `json:"first_name_bidx"`
+	LastNameBidx      sql.NullString `json:"last_name_bidx"`
+	ZipBidx           sql.NullString `json:"zip_bidx"`
+	PhoneNumber       string         `json:"phone_number"`
+	PhoneVerifiedAt   sql.NullTime   `json:"phone_verified_at"`
+	AvatarKey         string         `json:"avatar_key"`
+	AvatarContentType string         `json:"avatar_content_type"`
+}
+
+type UserProfileHistory struct {
+	ID              int64        `json:"id"`
+	ProfileID       uuid.UUID    `json:"profile_id"`
+	UserID          uuid.UUID    `json:"user_id"`
+	Version         int32        `json:"version"`
+	FirstName       string       `json:"first_name"`
+	LastName        string       `json:"last_name"`
+	BusinessName    string       `json:"business_name"`
+	StreetAddress   string       `json:"street_address"`
+	City            string       `json:"city"`
+	State           string       `json:"state"`
+	Zip             string       `json:"zip"`
+	CountryCode     string       `json:"country_code"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	VerifiedAt      sql.NullTime `json:"verified_at"`
+	DeletedAt       sql.NullTime `json:"deleted_at"`
+	RecordedAt      time.Time    `json:"recorded_at"`
+	PhoneNumber     string       `json:"phone_number"`
+	PhoneVerifiedAt sql.NullTime `json:"phone_verified_at"`
 }
 
 type UserRole struct {
@@ -44,4 +229,67 @@ type UserRole struct {
 	CreatedAt  time.Time    `json:"created_at"`
 	UpdatedAt  time.Time    `json:"updated_at"`
 	VerifiedAt sql.NullTime `json:"verified_at"`
+	Version    int32        `json:"version"`
+	DeletedAt  sql.NullTime `json:"deleted_at"`
+}
+
+type UserRoleHistory struct {
+	ID         int64        `json:"id"`
+	RoleRowID  uuid.UUID    `json:"role_row_id"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Version    int32        `json:"version"`
+	RoleID     int32        `json:"role_id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+	VerifiedAt sql.NullTime `json:"verified_at"`
+	DeletedAt  sql.NullTime `json:"deleted_at"`
+	RecordedAt time.Time    `json:"recorded_at"`
+}
+
+type UserSetting struct {
+	UserID    uuid.UUID       `json:"user_id"`
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type UsersHistory struct {
+	ID         int64        `json:"id"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Version    int32        `json:"version"`
+	UserName   string       `json:"user_name"`
+	Email      string       `json:"email"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+	VerifiedAt sql.NullTime `json:"verified_at"`
+	DeletedAt  sql.NullTime `json:"deleted_at"`
+	RecordedAt time.Time    `json:"recorded_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	UserID         uuid.UUID       `json:"user_id"`
+	Data           json.RawMessage `json:"data"`
+	OccurredAt     time.Time       `json:"occurred_at"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastAttemptAt  sql.NullTime    `json:"last_attempt_at"`
+	LastStatusCode int32           `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	DeliveredAt    sql.NullTime    `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+type WebhookSubscription struct {
+	ID         uuid.UUID `json:"id"`
+	Url        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Types of the user lifecycle events written to the outbox.
+const (
+	EventUserCreated  = "user.created"
+	EventUserUpdated  = "user.updated"
+	EventUserVerified = "user.verified"
+	EventUserDeleted  = "user.deleted"
+	EventUserRestored = "user.restored"
+)
+
+// EventTypes lists every outbox event type, for subscribers that filter on them.
+var EventTypes = []string{EventUserCreated, EventUserUpdated, EventUserVerified, EventUserDeleted, EventUserRestored}
+
+// outboxMaxBackoff caps the wait between attempts to publish an event.
+const outboxMaxBackoff = 10 * time.Minute
+
+// recordEvent writes an event to the outbox within the caller's transaction, so it is published if and only if
+// the change it describes is committed. The event is also queued for every webhook subscribed to its type.
+// Parameters:
+// - ctx: The context of the transaction.
+// - q: The queries bound to the current transaction.
+// - eventType: One of the Event* constants.
+// - userID: The user the event is about; events of a user are published in the order they were recorded.
+// - data: Details of the event, marshalled to JSON. Nil for none. Must not hold personal data.
+func recordEvent(ctx context.Context, q *Queries, eventType string, userID uuid.UUID, data interface{}) error {
+	payload := json.RawMessage(`{}`)
+	if data != nil {
+		var err error
+		if payload, err = json.Marshal(data); err != nil {
+			return err
+		}
+	}
+
+	event, err := q.CreateOutboxEvent(ctx, CreateOutboxEventParams{
+		EventType: eventType,
+		UserID:    userID,
+		Data:      payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = q.CreateWebhookDeliveries(ctx, event.ID)
+	return err
+}
+
+// userEventData is the data of created, updated, deleted, and restored events: the version of the user row the
+// event leads to, so consumers can tell whether what they fetch is at least as new.
+func userEventData(user User) map[string]interface{} {
+	return map[string]interface{}{"version": user.Version}
+}
+
+// recordUserUpdated records a user.updated event for a change to the user's profile, addresses, settings, or
+// attributes within the caller's transaction. Those changes leave the user row alone, so the event carries its
+// current version.
+func recordUserUpdated(ctx context.Context, q *Queries, userID uuid.UUID) error {
+	user, err := q.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return recordEvent(ctx, q, EventUserUpdated, userID, userEventData(user))
+}
+
+// RelayOutboxTx publishes the due outbox events, the oldest unpublished event of each user at a time.
+// The events stay locked while fn runs, so several relays can run at once without publishing the same event or
+// publishing a user's events out of order. An event fn fails to publish is tried again after a backoff, and the
+// user's later events wait for it.
+// Parameters:
+// - ctx: The context for the transaction.
+// - limit: The most events to publish.
+// - now: The time events have to be due by.
+// - fn: Publishes one event.
+// Returns:
+// - The number of events published.
+// - The first error returned by fn, or an error if the transaction fails.
+func (store *SQLStore) RelayOutboxTx(ctx context.Context, limit int32, now time.Time, fn func(Outbox) error) (int64, error) {
+	var published int64
+	var publishErr error
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		events, err := q.ListDueOutboxEvents(ctx, ListDueOutboxEventsParams{Now: now, PageLimit: limit})
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			if err = fn(event); err != nil {
+				if publishErr == nil {
+					publishErr = fmt.Errorf("publish event %d: %w", event.ID, err)
+				}
+				err = q.RetryOutboxEvent(ctx, RetryOutboxEventParams{
+					ID:            event.ID,
+					NextAttemptAt: now.Add(outboxBackoff(event.Attempts)),
+					LastError:     err.Error(),
+				})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err = q.MarkOutboxEventPublished(ctx, event.ID); err != nil {
+				return err
+			}
+			published++
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+	return published, publishErr
+}
+
+// outboxBackoff is how long to wait before the next attempt after attempts failed ones: one second, doubling
+// each time, up to outboxMaxBackoff.
+func outboxBackoff(attempts int32) time.Duration {
+	if attempts >= 10 {
+		return outboxMaxBackoff
+	}
+	backoff := time.Second << uint(attempts)
+	if backoff > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return backoff
+}
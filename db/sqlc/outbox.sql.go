@@ -0,0 +1,237 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: outbox.sql
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createOutboxEvent = `-- name: CreateOutboxEvent :one
+INSERT INTO outbox (event_type, user_id, data)
+VALUES ($1, $2, $3) RETURNING id, event_type, user_id, data, created_at, attempts, next_attempt_at, last_error, published_at, stream_position
+`
+
+type CreateOutboxEventParams struct {
+	EventType string          `json:"event_type"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func (q *Queries) CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) (Outbox, error) {
+	row := q.db.QueryRowContext(ctx, createOutboxEvent, arg.EventType, arg.UserID, arg.Data)
+	var i Outbox
+	err := row.Scan(
+		&i.ID,
+		&i.EventType,
+		&i.UserID,
+		&i.Data,
+		&i.CreatedAt,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastError,
+		&i.PublishedAt,
+		&i.StreamPosition,
+	)
+	return i, err
+}
+
+const listDueOutboxEvents = `-- name: ListDueOutboxEvents :many
+SELECT id, event_type, user_id, data, created_at, attempts, next_attempt_at, last_error, published_at, stream_position
+FROM outbox o
+WHERE o.published_at IS NULL
+  AND o.next_attempt_at <= $1::timestamptz
+  AND NOT EXISTS (SELECT 1
+                  FROM outbox earlier
+                  WHERE earlier.user_id = o.user_id
+                    AND earlier.published_at IS NULL
+                    AND earlier.id < o.id)
+ORDER BY o.id
+LIMIT $2 FOR UPDATE SKIP LOCKED
+`
+
+type ListDueOutboxEventsParams struct {
+	Now       time.Time `json:"now"`
+	PageLimit int32     `json:"page_limit"`
+}
+
+// The oldest unpublished event of each user, if it is due. Later events of a user wait until the earlier ones
+// are published, which keeps them in order. Locks the events for the rest of the transaction and skips events
+// another relay has locked.
+func (q *Queries) ListDueOutboxEvents(ctx context.Context, arg ListDueOutboxEventsParams) ([]Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, listDueOutboxEvents, arg.Now, arg.PageLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Outbox{}
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.EventType,
+			&i.UserID,
+			&i.Data,
+			&i.CreatedAt,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastError,
+			&i.PublishedAt,
+			&i.StreamPosition,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOutboxEventsAfter = `-- name: ListOutboxEventsAfter :many
+SELECT id, event_type, user_id, data, created_at, attempts, next_attempt_at, last_error, published_at, stream_position
+FROM outbox
+WHERE stream_position > $1::bigint
+  AND ($2::uuid IS NULL OR user_id = $2)
+ORDER BY stream_position
+LIMIT $3
+`
+
+type ListOutboxEventsAfterParams struct {
+	AfterPosition int64         `json:"after_position"`
+	UserID        uuid.NullUUID `json:"user_id"`
+	PageLimit     int32         `json:"page_limit"`
+}
+
+// Committed events after a stream position, in commit order, optionally only those of one user, for resuming the
+// event stream.
+func (q *Queries) ListOutboxEventsAfter(ctx context.Context, arg ListOutboxEventsAfterParams) ([]Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, listOutboxEventsAfter, arg.AfterPosition, arg.UserID, arg.PageLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Outbox{}
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.EventType,
+			&i.UserID,
+			&i.Data,
+			&i.CreatedAt,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastError,
+			&i.PublishedAt,
+			&i.StreamPosition,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOutboxEventsForUser = `-- name: ListOutboxEventsForUser :many
+SELECT id, event_type, user_id, data, created_at, attempts, next_attempt_at, last_error, published_at, stream_position
+FROM outbox
+WHERE user_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListOutboxEventsForUser(ctx context.Context, userID uuid.UUID) ([]Outbox, error) {
+	rows, err := q.db.QueryContext(ctx, listOutboxEventsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Outbox{}
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.EventType,
+			&i.UserID,
+			&i.Data,
+			&i.CreatedAt,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastError,
+			&i.PublishedAt,
+			&i.StreamPosition,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markOutboxEventPublished = `-- name: MarkOutboxEventPublished :exec
+UPDATE outbox
+SET published_at = STATEMENT_TIMESTAMP(),
+    attempts     = attempts + 1,
+    last_error   = ''
+WHERE id = $1
+`
+
+func (q *Queries) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, markOutboxEventPublished, id)
+	return err
+}
+
+const purgePublishedOutboxEvents = `-- name: PurgePublishedOutboxEvents :execrows
+DELETE
+FROM outbox
+WHERE published_at < $1::timestamptz
+`
+
+func (q *Queries) PurgePublishedOutboxEvents(ctx context.Context, publishedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgePublishedOutboxEvents, publishedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const retryOutboxEvent = `-- name: RetryOutboxEvent :exec
+UPDATE outbox
+SET attempts        = attempts + 1,
+    next_attempt_at = $1,
+    last_error      = $2
+WHERE id = $3
+`
+
+type RetryOutboxEventParams struct {
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error"`
+	ID            int64     `json:"id"`
+}
+
+func (q *Queries) RetryOutboxEvent(ctx context.Context, arg RetryOutboxEventParams) error {
+	_, err := q.db.ExecContext(ctx, retryOutboxEvent, arg.NextAttemptAt, arg.LastError, arg.ID)
+	return err
+}
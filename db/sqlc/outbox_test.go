@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"whaleWake/util"
+)
+
+func TestUserLifecycleEvents(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+
+	_, err := store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: created.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
+	require.NoError(t, err)
+	_, err = store.RestoreUserWithProfileAndRoleTx(context.Background(), created.User.ID)
+	require.NoError(t, err)
+
+	events, err := store.ListOutboxEventsForUser(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, EventUserCreated, events[0].EventType)
+	require.JSONEq(t, `{"version": 1}`, string(events[0].Data))
+	require.Equal(t, EventUserDeleted, events[1].EventType)
+	require.Equal(t, EventUserRestored, events[2].EventType)
+}
+
+func TestProfileChangeEvents(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+	userID := created.User.ID
+
+	// Each change to something other than the user row is a user.updated event at the user's version.
+	changes := []func() error{
+		func() error {
+			_, err := store.SetUserPhoneTx(context.Background(), UpdateUserProfilePhoneParams{UserID: userID, PhoneNumber: "+14155550123"})
+			return err
+		},
+		func() error {
+			_, err := store.SetUserAvatarTx(context.Background(), UpdateUserProfileAvatarParams{
+				UserID: userID, AvatarKey: NewAvatarKey(userID), AvatarContentType: "image/png"})
+			return err
+		},
+		func() error {
+			address, err := store.CreateUserAddressTx(context.Background(), CreateUserAddressParams{
+				UserID:        userID,
+				Type:          AddressTypeShipping,
+				StreetAddress: util.RandomStreetAddress(),
+				City:          util.RandomString(6),
+				State:         util.RandomCountryCodeOrState(),
+				Zip:           util.RandomString(5),
+				CountryCode:   util.RandomCountryCodeOrState(),
+			})
+			if err != nil {
+				return err
+			}
+			_, err = store.UpdateUserAddressTx(context.Background(), UpdateUserAddressParams{
+				ID:            address.ID,
+				UserID:        userID,
+				Type:          address.Type,
+				Label:         "Office",
+				StreetAddress: address.StreetAddress,
+				City:          address.City,
+				State:         address.State,
+				Zip:           address.Zip,
+				CountryCode:   address.CountryCode,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = store.DeleteUserAddressTx(context.Background(), DeleteUserAddressParams{ID: address.ID, UserID: userID})
+			return err
+		},
+		func() error {
+			_, err := store.SetUserSettingsTx(context.Background(), SetUserSettingsParams{
+				UserID: userID, Values: map[string]json.RawMessage{"locale": json.RawMessage(`"fr-FR"`)}})
+			return err
+		},
+	}
+	for _, change := range changes {
+		require.NoError(t, change())
+	}
+
+	events, err := store.ListOutboxEventsForUser(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, events, 7)
+	for _, event := range events[1:] {
+		require.Equal(t, EventUserUpdated, event.EventType)
+		require.JSONEq(t, `{"version": 1}`, string(event.Data))
+	}
+}
+
+func TestRelayOutboxTx(t *testing.T) {
+	store := NewStore(testDB)
+	first := createRandomUserTx(t, store)
+	second := createRandomUserTx(t, store)
+	_, err := store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: first.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
+	require.NoError(t, err)
+
+	// Only the two users' events are published, so events left behind by other tests don't get in the way.
+	ours := map[uuid.UUID]bool{first.User.ID: true, second.User.ID: true}
+	relay := func(fail uuid.UUID, published *[]Outbox) error {
+		for {
+			n, err := store.RelayOutboxTx(context.Background(), 1000, time.Now().Add(time.Hour), func(event Outbox) error {
+				if !ours[event.UserID] {
+					return nil
+				}
+				if event.UserID == fail {
+					return errors.New("unavailable")
+				}
+				*published = append(*published, event)
+				return nil
+			})
+			if err != nil || n == 0 {
+				return err
+			}
+		}
+	}
+
+	var published []Outbox
+	require.Error(t, relay(first.User.ID, &published))
+	require.Len(t, published, 1)
+	require.Equal(t, second.User.ID, published[0].UserID)
+
+	// The failed event waits out its backoff, so it needs a later time, and then goes out before the next one.
+	published = nil
+	_, err = store.RelayOutboxTx(context.Background(), 1000, time.Now(), func(event Outbox) error {
+		require.NotEqual(t, first.User.ID, event.UserID)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, relay(uuid.Nil, &published))
+	require.Len(t, published, 2)
+	require.Equal(t, EventUserCreated, published[0].EventType)
+	require.Equal(t, EventUserDeleted, published[1].EventType)
+	require.Equal(t, int32(1), published[0].Attempts)
+}
+
+func TestListOutboxEventsAfter(t *testing.T) {
+	store := NewStore(testDB)
+	first := createRandomUserTx(t, store)
+	second := createRandomUserTx(t, store)
+	_, err := store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: first.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
+	require.NoError(t, err)
+
+	firstEvents, err := store.ListOutboxEventsForUser(context.Background(), first.User.ID)
+	require.NoError(t, err)
+	require.Len(t, firstEvents, 2)
+	require.True(t, firstEvents[0].StreamPosition.Valid)
+
+	events, err := store.ListOutboxEventsAfter(context.Background(), ListOutboxEventsAfterParams{
+		AfterPosition: firstEvents[0].StreamPosition.Int64,
+		UserID:        uuid.NullUUID{UUID: first.User.ID, Valid: true},
+		PageLimit:     10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, EventUserDeleted, events[0].EventType)
+
+	events, err = store.ListOutboxEventsAfter(context.Background(), ListOutboxEventsAfterParams{
+		AfterPosition: firstEvents[0].StreamPosition.Int64,
+		PageLimit:     10,
+	})
+	require.NoError(t, err)
+	var users []uuid.UUID
+	for _, event := range events {
+		require.Greater(t, event.StreamPosition.Int64, firstEvents[0].StreamPosition.Int64)
+		users = append(users, event.UserID)
+	}
+	require.Contains(t, users, second.User.ID)
+	require.Contains(t, users, first.User.ID)
+}
+
+func TestListOutboxEventsAfterCommitOrder(t *testing.T) {
+	ahab := createRandomUser(t)
+	ishmael := createRandomUser(t)
+
+	// Ahab's event is recorded first, so it gets the lower ID, but Ishmael's commits first.
+	record := func(userID uuid.UUID) (*sql.Tx, Outbox) {
+		tx, err := testDB.BeginTx(context.Background(), nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = tx.Rollback() })
+		event, err := New(tx).CreateOutboxEvent(context.Background(), CreateOutboxEventParams{
+			EventType: EventUserUpdated,
+			UserID:    userID,
+			Data:      json.RawMessage(`{}`),
+		})
+		require.NoError(t, err)
+		require.False(t, event.StreamPosition.Valid)
+		return tx, event
+	}
+	ahabTx, ahabEvent := record(ahab.ID)
+	ishmaelTx, ishmaelEvent := record(ishmael.ID)
+	require.Less(t, ahabEvent.ID, ishmaelEvent.ID)
+	require.NoError(t, ishmaelTx.Commit())
+
+	// A stream that has sent Ishmael's event must still be sent Ahab's once it commits.
+	ishmaelEvents, err := testQueries.ListOutboxEventsForUser(context.Background(), ishmael.ID)
+	require.NoError(t, err)
+	require.Len(t, ishmaelEvents, 1)
+	after := ishmaelEvents[0].StreamPosition.Int64
+
+	require.NoError(t, ahabTx.Commit())
+
+	events, err := testQueries.ListOutboxEventsAfter(context.Background(), ListOutboxEventsAfterParams{
+		AfterPosition: after,
+		UserID:        uuid.NullUUID{UUID: ahab.ID, Valid: true},
+		PageLimit:     10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, ahabEvent.ID, events[0].ID)
+	require.Greater(t, events[0].StreamPosition.Int64, after)
+}
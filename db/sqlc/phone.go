@@ -0,0 +1,223 @@
+package db
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	// ErrPhoneNumberMissing is returned when a code is requested for a profile without a phone number.
+	ErrPhoneNumberMissing = errors.New("the profile has no phone number")
+	// ErrPhoneAlreadyVerified is returned when a code is requested for a phone number that is already verified.
+	ErrPhoneAlreadyVerified = errors.New("the phone number is already verified")
+	// ErrPhoneVerificationLimit is returned when a user has been sent too many codes recently.
+	ErrPhoneVerificationLimit = errors.New("too many verification codes requested")
+	// ErrPhoneCodeInvalid is returned for a wrong code, or when there is no code waiting to be confirmed.
+	ErrPhoneCodeInvalid = errors.New("the verification code is not valid")
+	// ErrPhoneCodeExpired is returned for a code that has expired, run out of attempts, or was sent to a number
+	// the profile no longer has. A new code has to be requested.
+	ErrPhoneCodeExpired = errors.New("the verification code has expired")
+)
+
+// StartPhoneVerificationParams holds the details of a new verification code.
+// Fields:
+// - UserID: The user whose phone number is being verified.
+// - CodeHash: A hash of the code; the code itself is never stored.
+// - ExpiresAt: When the code stops being accepted.
+// - Since: Start of the rate limit window.
+// - Limit: How many codes the user may be sent within the window.
+type StartPhoneVerificationParams struct {
+	UserID    uuid.UUID
+	CodeHash  string
+	ExpiresAt time.Time
+	Since     time.Time
+	Limit     int64
+}
+
+// ConfirmPhoneVerificationParams holds an attempt to confirm a phone number.
+// Fields:
+// - UserID: The user whose phone number is being verified.
+// - CodeHash: A hash of the code the user entered, made the same way as StartPhoneVerificationParams.CodeHash.
+// - MaxAttempts: How many wrong codes are allowed before the code is refused.
+// - Now: The time the code has to be confirmed by.
+type ConfirmPhoneVerificationParams struct {
+	UserID      uuid.UUID
+	CodeHash    string
+	MaxAttempts int32
+	Now         time.Time
+}
+
+// SetUserPhoneTx sets, replaces, or clears the phone number of a user's profile, as a new profile version.
+// A different number is unverified until it is confirmed; the same number keeps its verification.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The user and the number in E.164 format, or an empty string to clear it. ExpectedVersion is optional.
+// Returns:
+// - The updated profile, decrypted.
+// - sql.ErrNoRows if the profile does not exist, is deleted, or is not at the expected version.
+func (store *SQLStore) SetUserPhoneTx(ctx context.Context, arg UpdateUserProfilePhoneParams) (UserProfile, error) {
+	var result UserProfile
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		before, err := q.GetUserProfileForUpdate(ctx, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		result, err = q.UpdateUserProfilePhone(ctx, arg)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudit(ctx, q, AuditActionUpdate, AuditTargetUserProfile, arg.UserID, before, result)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserProfileHistory(ctx, q, result)
+		if err != nil {
+			return err
+		}
+
+		return recordUserUpdated(ctx, q, arg.UserID)
+	})
+
+	if err == nil {
+		err = store.decryptProfile(&result)
+	}
+
+	return result, err
+}
+
+// StartPhoneVerificationTx records a new verification code for the phone number of a user's profile.
+// The profile is locked while the recent codes are counted, so concurrent requests cannot pass the limit.
+// Earlier codes stay valid until they expire; only the latest one can be confirmed.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The code and the rate limit.
+// Returns:
+// - The verification, with the phone number to send the code to.
+// - sql.ErrNoRows if the profile does not exist or is deleted, ErrPhoneNumberMissing, ErrPhoneAlreadyVerified,
+// or ErrPhoneVerificationLimit.
+func (store *SQLStore) StartPhoneVerificationTx(ctx context.Context, arg StartPhoneVerificationParams) (PhoneVerification, error) {
+	var result PhoneVerification
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		profile, err := q.GetUserProfileForUpdate(ctx, arg.UserID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case profile.DeletedAt.Valid:
+			return sql.ErrNoRows
+		case profile.PhoneNumber == "":
+			return ErrPhoneNumberMissing
+		case profile.PhoneVerifiedAt.Valid:
+			return ErrPhoneAlreadyVerified
+		}
+
+		sent, err := q.CountPhoneVerificationsSince(ctx, CountPhoneVerificationsSinceParams{
+			UserID: arg.UserID,
+			Since:  arg.Since,
+		})
+		if err != nil {
+			return err
+		}
+		if sent >= arg.Limit {
+			return ErrPhoneVerificationLimit
+		}
+
+		result, err = q.CreatePhoneVerification(ctx, CreatePhoneVerificationParams{
+			UserID:      arg.UserID,
+			PhoneNumber: profile.PhoneNumber,
+			CodeHash:    arg.CodeHash,
+			ExpiresAt:   arg.ExpiresAt,
+		})
+		return err
+	})
+
+	return result, err
+}
+
+// ConfirmPhoneVerificationTx checks a code against the latest one sent to a user and, if it matches, marks the
+// profile's phone number as verified, as a new profile version.
+// A wrong code counts as an attempt even though an error is returned.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The code and the attempt limit.
+// Returns:
+// - The updated profile, decrypted.
+// - ErrPhoneCodeInvalid for a wrong code or when no code is waiting, ErrPhoneCodeExpired when a new code is needed.
+func (store *SQLStore) ConfirmPhoneVerificationTx(ctx context.Context, arg ConfirmPhoneVerificationParams) (UserProfile, error) {
+	var result UserProfile
+	var codeErr error
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		verification, err := q.GetLatestPhoneVerificationForUpdate(ctx, arg.UserID)
+		if err == sql.ErrNoRows {
+			codeErr = ErrPhoneCodeInvalid
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !arg.Now.Before(verification.ExpiresAt) || verification.Attempts >= arg.MaxAttempts {
+			codeErr = ErrPhoneCodeExpired
+			return nil
+		}
+
+		if subtle.ConstantTimeCompare([]byte(verification.CodeHash), []byte(arg.CodeHash)) != 1 {
+			// Commit the attempt, so wrong guesses use up the code.
+			_, err = q.IncrementPhoneVerificationAttempts(ctx, verification.ID)
+			codeErr = ErrPhoneCodeInvalid
+			return err
+		}
+
+		before, err := q.GetUserProfileForUpdate(ctx, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		result, err = q.VerifyUserProfilePhone(ctx, VerifyUserProfilePhoneParams{
+			UserID:      arg.UserID,
+			PhoneNumber: verification.PhoneNumber,
+		})
+		if err == sql.ErrNoRows {
+			codeErr = ErrPhoneCodeExpired
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err = q.MarkPhoneVerificationVerified(ctx, verification.ID); err != nil {
+			return err
+		}
+
+		err = recordAudit(ctx, q, AuditActionUpdate, AuditTargetUserProfile, arg.UserID, before, result)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserProfileHistory(ctx, q, result)
+		if err != nil {
+			return err
+		}
+
+		return recordEvent(ctx, q, EventUserVerified, arg.UserID, map[string]string{"channel": "phone"})
+	})
+
+	if err == nil {
+		err = codeErr
+	}
+	if err == nil {
+		err = store.decryptProfile(&result)
+	}
+
+	return result, err
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPhoneVerification(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+	userID := created.User.ID
+	now := time.Now()
+
+	start := StartPhoneVerificationParams{
+		UserID:    userID,
+		CodeHash:  "right",
+		ExpiresAt: now.Add(time.Minute),
+		Since:     now.Add(-time.Hour),
+		Limit:     2,
+	}
+
+	_, err := store.StartPhoneVerificationTx(context.Background(), start)
+	require.ErrorIs(t, err, ErrPhoneNumberMissing)
+
+	profile, err := store.SetUserPhoneTx(context.Background(), UpdateUserProfilePhoneParams{
+		UserID:      userID,
+		PhoneNumber: "+14155550123",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "+14155550123", profile.PhoneNumber)
+	require.False(t, profile.PhoneVerifiedAt.Valid)
+	require.Equal(t, created.UserProfile.Version+1, profile.Version)
+
+	verification, err := store.StartPhoneVerificationTx(context.Background(), start)
+	require.NoError(t, err)
+	require.Equal(t, "+14155550123", verification.PhoneNumber)
+
+	confirm := ConfirmPhoneVerificationParams{UserID: userID, CodeHash: "wrong", MaxAttempts: 2, Now: now}
+	_, err = store.ConfirmPhoneVerificationTx(context.Background(), confirm)
+	require.ErrorIs(t, err, ErrPhoneCodeInvalid)
+
+	// The wrong attempt was kept even though the transaction returned an error.
+	verifications, err := store.ListPhoneVerifications(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, verifications, 1)
+	require.Equal(t, int32(1), verifications[0].Attempts)
+
+	confirm.CodeHash = "right"
+	profile, err = store.ConfirmPhoneVerificationTx(context.Background(), confirm)
+	require.NoError(t, err)
+	require.True(t, profile.PhoneVerifiedAt.Valid)
+
+	_, err = store.StartPhoneVerificationTx(context.Background(), start)
+	require.ErrorIs(t, err, ErrPhoneAlreadyVerified)
+
+	// Setting the same number keeps the verification; a new number drops it.
+	profile, err = store.SetUserPhoneTx(context.Background(), UpdateUserProfilePhoneParams{UserID: userID, PhoneNumber: "+14155550123"})
+	require.NoError(t, err)
+	require.True(t, profile.PhoneVerifiedAt.Valid)
+
+	profile, err = store.SetUserPhoneTx(context.Background(), UpdateUserProfilePhoneParams{UserID: userID, PhoneNumber: "+442079460958"})
+	require.NoError(t, err)
+	require.False(t, profile.PhoneVerifiedAt.Valid)
+
+	_, err = store.StartPhoneVerificationTx(context.Background(), start)
+	require.NoError(t, err)
+	_, err = store.StartPhoneVerificationTx(context.Background(), start)
+	require.ErrorIs(t, err, ErrPhoneVerificationLimit)
+
+	// Codes expire.
+	confirm.Now = now.Add(2 * time.Minute)
+	_, err = store.ConfirmPhoneVerificationTx(context.Background(), confirm)
+	require.ErrorIs(t, err, ErrPhoneCodeExpired)
+
+	history, err := store.ListUserProfileHistory(context.Background(), userID)
+	require.NoError(t, err)
+	require.Equal(t, "+442079460958", history[len(history)-1].PhoneNumber)
+}
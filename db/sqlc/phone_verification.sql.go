@@ -0,0 +1,206 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: phone_verification.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const countPhoneVerificationsSince = `-- name: CountPhoneVerificationsSince :one
+SELECT COUNT(*)
+FROM phone_verifications
+WHERE user_id = $1
+  AND created_at >= $2
+`
+
+type CountPhoneVerificationsSinceParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	Since  time.Time `json:"since"`
+}
+
+// Counts the codes sent to a user since a time, for rate limiting.
+func (q *Queries) CountPhoneVerificationsSince(ctx context.Context, arg CountPhoneVerificationsSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPhoneVerificationsSince, arg.UserID, arg.Since)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createPhoneVerification = `-- name: CreatePhoneVerification :one
+INSERT INTO phone_verifications (user_id, phone_number, code_hash, expires_at)
+VALUES ($1, $2, $3, $4) RETURNING id, user_id, phone_number, code_hash, attempts, created_at, expires_at, verified_at
+`
+
+type CreatePhoneVerificationParams struct {
+	UserID      uuid.UUID `json:"user_id"`
+	PhoneNumber string    `json:"phone_number"`
+	CodeHash    string    `json:"code_hash"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreatePhoneVerification(ctx context.Context, arg CreatePhoneVerificationParams) (PhoneVerification, error) {
+	row := q.db.QueryRowContext(ctx, createPhoneVerification,
+		arg.UserID,
+		arg.PhoneNumber,
+		arg.CodeHash,
+		arg.ExpiresAt,
+	)
+	var i PhoneVerification
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.PhoneNumber,
+		&i.CodeHash,
+		&i.Attempts,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.VerifiedAt,
+	)
+	return i, err
+}
+
+const deletePhoneVerifications = `-- name: DeletePhoneVerifications :execrows
+DELETE
+FROM phone_verifications
+WHERE user_id = $1
+`
+
+func (q *Queries) DeletePhoneVerifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deletePhoneVerifications, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getLatestPhoneVerificationForUpdate = `-- name: GetLatestPhoneVerificationForUpdate :one
+SELECT id, user_id, phone_number, code_hash, attempts, created_at, expires_at, verified_at
+FROM phone_verifications
+WHERE user_id = $1
+  AND verified_at IS NULL
+ORDER BY created_at DESC, id DESC
+LIMIT 1 FOR UPDATE
+`
+
+// The most recent code for a user that has not been confirmed yet. Locks it for the rest of the transaction,
+// so concurrent attempts are counted one at a time.
+func (q *Queries) GetLatestPhoneVerificationForUpdate(ctx context.Context, userID uuid.UUID) (PhoneVerification, error) {
+	row := q.db.QueryRowContext(ctx, getLatestPhoneVerificationForUpdate, userID)
+	var i PhoneVerification
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.PhoneNumber,
+		&i.CodeHash,
+		&i.Attempts,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.VerifiedAt,
+	)
+	return i, err
+}
+
+const incrementPhoneVerificationAttempts = `-- name: IncrementPhoneVerificationAttempts :one
+UPDATE phone_verifications
+SET attempts = attempts + 1
+WHERE id = $1 RETURNING id, user_id, phone_number, code_hash, attempts, created_at, expires_at, verified_at
+`
+
+func (q *Queries) IncrementPhoneVerificationAttempts(ctx context.Context, id uuid.UUID) (PhoneVerification, error) {
+	row := q.db.QueryRowContext(ctx, incrementPhoneVerificationAttempts, id)
+	var i PhoneVerification
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.PhoneNumber,
+		&i.CodeHash,
+		&i.Attempts,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.VerifiedAt,
+	)
+	return i, err
+}
+
+const listPhoneVerifications = `-- name: ListPhoneVerifications :many
+SELECT id, user_id, phone_number, code_hash, attempts, created_at, expires_at, verified_at
+FROM phone_verifications
+WHERE user_id = $1
+ORDER BY created_at, id
+`
+
+func (q *Queries) ListPhoneVerifications(ctx context.Context, userID uuid.UUID) ([]PhoneVerification, error) {
+	rows, err := q.db.QueryContext(ctx, listPhoneVerifications, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []PhoneVerification{}
+	for rows.Next() {
+		var i PhoneVerification
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.PhoneNumber,
+			&i.CodeHash,
+			&i.Attempts,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.VerifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markPhoneVerificationVerified = `-- name: MarkPhoneVerificationVerified :one
+UPDATE phone_verifications
+SET verified_at = STATEMENT_TIMESTAMP()
+WHERE id = $1 RETURNING id, user_id, phone_number, code_hash, attempts, created_at, expires_at, verified_at
+`
+
+func (q *Queries) MarkPhoneVerificationVerified(ctx context.Context, id uuid.UUID) (PhoneVerification, error) {
+	row := q.db.QueryRowContext(ctx, markPhoneVerificationVerified, id)
+	var i PhoneVerification
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.PhoneNumber,
+		&i.CodeHash,
+		&i.Attempts,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.VerifiedAt,
+	)
+	return i, err
+}
+
+const purgePhoneVerifications = `-- name: PurgePhoneVerifications :execrows
+DELETE
+FROM phone_verifications
+WHERE expires_at < $1::timestamptz
+   OR user_id IN (SELECT id FROM users WHERE users.deleted_at < $1::timestamptz)
+`
+
+// Removes expired codes, and the codes of users that are being purged so the users can be deleted afterwards.
+func (q *Queries) PurgePhoneVerifications(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgePhoneVerifications, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,305 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Statuses of an erasure request.
+const (
+	ErasureStatusPending   = "pending"
+	ErasureStatusCancelled = "cancelled"
+	ErasureStatusCompleted = "completed"
+)
+
+// erasedAuditFields are the personal fields erased from the audit diffs of an erased or purged user.
+var erasedAuditFields = []string{
+	"user_name",
+	"email",
+	"first_name",
+	"last_name",
+	"business_name",
+	"label",
+	"street_address",
+	"city",
+	"state",
+	"zip",
+	"country_code",
+	"phone_number",
+	"name",
+	"locale",
+	"timezone",
+	"attributes",
+}
+
+// UserDataResult is everything stored about a user, for a data subject access request.
+// The profile and role are left empty when the user has none. Password hashes, verification code hashes, and
+// email change token hashes are never included.
+type UserDataResult struct {
+	User               User
+	UserProfile        UserProfile
+	UserRole           UserRole
+	Addresses          []UserAddress
+	PhoneVerifications []PhoneVerification
+	EmailChanges       []EmailChange
+	Documents          []UserDocument
+	Settings           []UserSetting
+	Attributes         []ListUserAttributesRow
+	History            UserHistoryResult
+	AuditEvents        []AuditEvent
+	ErasureRequests    []ErasureRequest
+}
+
+// GetUserDataTx collects everything stored about a user in a single transaction, so the parts are consistent.
+// Parameters:
+// - ctx: The context for the transaction.
+// - userID: The UUID of the user.
+// Returns:
+// - The user's data, with an empty password.
+// - sql.ErrNoRows if the user does not exist or is deleted.
+func (store *SQLStore) GetUserDataTx(ctx context.Context, userID uuid.UUID) (UserDataResult, error) {
+	var result UserDataResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		result.User, err = q.GetUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		result.User.Password = ""
+
+		result.UserProfile, err = q.GetUserProfile(ctx, userID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		result.UserRole, err = q.GetUserRole(ctx, userID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		result.Addresses, err = q.ListUserAddresses(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		result.PhoneVerifications, err = q.ListPhoneVerifications(ctx, userID)
+		if err != nil {
+			return err
+		}
+		for i := range result.PhoneVerifications {
+			result.PhoneVerifications[i].CodeHash = ""
+		}
+
+		result.EmailChanges, err = q.ListEmailChanges(ctx, userID)
+		if err != nil {
+			return err
+		}
+		for i := range result.EmailChanges {
+			result.EmailChanges[i].ConfirmTokenHash = ""
+			result.EmailChanges[i].RevertTokenHash = ""
+		}
+
+		result.Documents, err = q.ListUserDocuments(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		result.Settings, err = q.ListUserSettings(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		result.Attributes, err = q.ListUserAttributes(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		result.History.User, err = q.ListUserHistory(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		result.History.UserProfile, err = q.ListUserProfileHistory(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		result.History.UserRole, err = q.ListUserRoleHistory(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		result.AuditEvents, err = q.ListAuditEventsForUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		result.ErasureRequests, err = q.ListErasureRequests(ctx, userID)
+		return err
+	})
+
+	if err == nil {
+		err = store.decryptProfile(&result.UserProfile)
+	}
+	for i := 0; err == nil && i < len(result.Addresses); i++ {
+		err = store.decryptAddress(&result.Addresses[i])
+	}
+	for i := 0; err == nil && i < len(result.History.UserProfile); i++ {
+		err = store.decryptProfileHistory(&result.History.UserProfile[i])
+	}
+	for i := 0; err == nil && i < len(result.AuditEvents); i++ {
+		err = store.decryptAuditEvent(&result.AuditEvents[i])
+	}
+
+	return result, err
+}
+
+// EraseDueUsersTx carries out every pending erasure request scheduled at or before now.
+// Each user's name, email, password, and profile are anonymized, in the live rows, the history tables, and the
+// audit log, their addresses, phone verification codes, settings, attributes, reserved user names, and documents
+// are removed, the blobs of their avatar and documents are queued for deletion, and the user is then soft deleted
+// so the purge removes the rows later.
+// Row IDs, versions, roles, and audit events are kept, so references and the audit trail stay intact. An erase
+// audit event is recorded with no field values.
+// Parameters:
+// - ctx: The context for the transaction.
+// - now: Requests scheduled at or before this time are carried out.
+// Returns:
+// - The number of users erased.
+// - An error if the transaction fails.
+func (store *SQLStore) EraseDueUsersTx(ctx context.Context, now time.Time) (int64, error) {
+	var erased int64
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		requests, err := q.ListDueErasureRequests(ctx, now)
+		if err != nil || len(requests) == 0 {
+			return err
+		}
+
+		err = q.AllowAuditErasure(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, request := range requests {
+			err = eraseUser(ctx, q, request.UserID)
+			if err != nil {
+				return err
+			}
+
+			_, err = q.CompleteErasureRequest(ctx, request.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		erased = int64(len(requests))
+		return nil
+	})
+
+	return erased, err
+}
+
+// eraseUser anonymizes and soft deletes one user within the caller's transaction.
+// A user that has already been purged has nothing left to erase.
+func eraseUser(ctx context.Context, q *Queries, userID uuid.UUID) error {
+	_, err := q.GetUserForUpdate(ctx, userID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Scrub the past first, so the history rows recorded below are the only new copies.
+	if _, err = q.AnonymizeUserHistory(ctx, userID); err != nil {
+		return err
+	}
+	if _, err = q.AnonymizeUserProfileHistory(ctx, userID); err != nil {
+		return err
+	}
+	_, err = q.AnonymizeAuditEvents(ctx, AnonymizeAuditEventsParams{UserID: userID, Fields: erasedAuditFields})
+	if err != nil {
+		return err
+	}
+
+	user, err := q.AnonymizeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err = recordAudit(ctx, q, AuditActionErase, AuditTargetUser, userID, nil, nil); err != nil {
+		return err
+	}
+	if err = recordEvent(ctx, q, EventUserDeleted, userID, map[string]bool{"erased": true}); err != nil {
+		return err
+	}
+
+	if _, err = q.DeleteUserAddresses(ctx, userID); err != nil {
+		return err
+	}
+	if _, err = q.DeletePhoneVerifications(ctx, userID); err != nil {
+		return err
+	}
+	if _, err = q.DeleteEmailChanges(ctx, userID); err != nil {
+		return err
+	}
+	if _, err = q.DeleteUserSettings(ctx, userID); err != nil {
+		return err
+	}
+	if _, err = q.DeleteUserAttributes(ctx, userID); err != nil {
+		return err
+	}
+	if _, err = q.DeleteUserNameReservations(ctx, userID); err != nil {
+		return err
+	}
+	documentKeys, err := q.DeleteUserDocuments(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err = queueBlobDeletions(ctx, q, documentKeys); err != nil {
+		return err
+	}
+
+	before, err := q.GetUserProfileForUpdate(ctx, userID)
+	if err == nil {
+		err = queueBlobDeletions(ctx, q, avatarObjectKeys(before.AvatarKey))
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	profile, err := q.AnonymizeUserProfile(ctx, userID)
+	if err == nil && !profile.DeletedAt.Valid {
+		profile, err = q.DeleteUserProfile(ctx, DeleteUserProfileParams{UserID: userID})
+	}
+	if err == nil {
+		err = recordUserProfileHistory(ctx, q, profile)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	role, err := q.GetUserRoleForUpdate(ctx, userID)
+	if err == nil && !role.DeletedAt.Valid {
+		role, err = q.DeleteUserRole(ctx, DeleteUserRoleParams{UserID: userID})
+		if err == nil {
+			err = recordUserRoleHistory(ctx, q, role)
+		}
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if !user.DeletedAt.Valid {
+		user, err = q.DeleteUser(ctx, DeleteUserParams{ID: userID})
+		if err != nil {
+			return err
+		}
+	}
+
+	return recordUserHistory(ctx, q, user)
+}
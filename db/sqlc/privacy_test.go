@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGetUserDataTx(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+
+	data, err := store.GetUserDataTx(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.Equal(t, created.User.ID, data.User.ID)
+	require.Empty(t, data.User.Password)
+	require.Equal(t, created.UserProfile.ID, data.UserProfile.ID)
+	require.Equal(t, created.UserRole.ID, data.UserRole.ID)
+	require.NotEmpty(t, data.History.User)
+	require.NotEmpty(t, data.AuditEvents)
+	require.Empty(t, data.ErasureRequests)
+}
+
+func TestCreateErasureRequestOnePending(t *testing.T) {
+	user := createRandomUser(t)
+	arg := CreateErasureRequestParams{UserID: user.ID, ScheduledFor: time.Now().Add(time.Hour)}
+
+	request, err := testQueries.CreateErasureRequest(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, ErasureStatusPending, request.Status)
+
+	_, err = testQueries.CreateErasureRequest(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	cancelled, err := testQueries.CancelErasureRequest(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, ErasureStatusCancelled, cancelled.Status)
+	require.True(t, cancelled.CancelledAt.Valid)
+
+	// Once cancelled, a new request can be made
+	_, err = testQueries.CreateErasureRequest(context.Background(), arg)
+	require.NoError(t, err)
+}
+
+func TestEraseDueUsersTx(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+	userID := created.User.ID
+
+	request, err := testQueries.CreateErasureRequest(context.Background(), CreateErasureRequestParams{
+		UserID:       userID,
+		ScheduledFor: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	erased, err := store.EraseDueUsersTx(context.Background(), time.Now())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, erased, int64(1))
+
+	user, err := testQueries.GetUserForUpdate(context.Background(), userID)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("erased-%s", userID), user.UserName)
+	require.Equal(t, fmt.Sprintf("erased-%s@erased.invalid", userID), user.Email)
+	require.Empty(t, user.Password)
+	require.True(t, user.DeletedAt.Valid)
+
+	userHistory, err := testQueries.ListUserHistory(context.Background(), userID)
+	require.NoError(t, err)
+	for _, row := range userHistory {
+		require.NotEqual(t, created.User.UserName, row.UserName)
+		require.NotEqual(t, created.User.Email, row.Email)
+	}
+
+	profileHistory, err := testQueries.ListUserProfileHistory(context.Background(), userID)
+	require.NoError(t, err)
+	for _, row := range profileHistory {
+		require.NotEqual(t, created.UserProfile.FirstName, row.FirstName)
+		require.NotEqual(t, created.UserProfile.StreetAddress, row.StreetAddress)
+	}
+
+	events, err := testQueries.ListAuditEventsForUser(context.Background(), userID)
+	require.NoError(t, err)
+	actions := make([]string, 0, len(events))
+	for _, event := range events {
+		actions = append(actions, event.Action)
+		require.NotContains(t, string(event.Before), created.User.Email)
+		require.NotContains(t, string(event.After), created.User.Email)
+		require.NotContains(t, string(event.After), created.UserProfile.StreetAddress)
+	}
+	require.Contains(t, actions, AuditActionErase)
+
+	requests, err := testQueries.ListErasureRequests(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	require.Equal(t, request.ID, requests[0].ID)
+	require.Equal(t, ErasureStatusCompleted, requests[0].Status)
+	require.True(t, requests[0].CompletedAt.Valid)
+}
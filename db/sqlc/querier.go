@@ -6,27 +6,250 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type Querier interface {
+	// Lets AnonymizeAuditEvents update audit_events until the end of the transaction.
+	AllowAuditErasure(ctx context.Context) error
+	// Lets UpdateAuditEventEncryption update audit_events until the end of the transaction.
+	AllowAuditKeyRotation(ctx context.Context) error
+	// Erases the listed fields from the diffs of changes to the user, and the IP address of changes the user made.
+	// Changes the user made to other users keep their diffs, since those hold the other users' data.
+	// Needs AllowAuditErasure earlier in the same transaction.
+	AnonymizeAuditEvents(ctx context.Context, arg AnonymizeAuditEventsParams) (int64, error)
+	// The user name and email become unique placeholders, and the empty password hash never matches a password.
+	AnonymizeUser(ctx context.Context, id uuid.UUID) (User, error)
+	AnonymizeUserHistory(ctx context.Context, userID uuid.UUID) (int64, error)
+	AnonymizeUserProfile(ctx context.Context, userID uuid.UUID) (UserProfile, error)
+	AnonymizeUserProfileHistory(ctx context.Context, userID uuid.UUID) (int64, error)
+	CancelErasureRequest(ctx context.Context, userID uuid.UUID) (ErasureRequest, error)
+	// Cancels every change of a user's email address that has not been confirmed or reverted yet.
+	CancelPendingEmailChanges(ctx context.Context, userID uuid.UUID) (int64, error)
+	CompleteErasureRequest(ctx context.Context, id uuid.UUID) (ErasureRequest, error)
+	CompleteIdempotencyKey(ctx context.Context, arg CompleteIdempotencyKeyParams) (IdempotencyKey, error)
+	// Counts the codes sent to a user since a time, for rate limiting.
+	CountPhoneVerificationsSince(ctx context.Context, arg CountPhoneVerificationsSinceParams) (int64, error)
+	CreateAttributeDefinition(ctx context.Context, arg CreateAttributeDefinitionParams) (AttributeDefinition, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error)
+	CreateEmailChange(ctx context.Context, arg CreateEmailChangeParams) (EmailChange, error)
+	// Returns no rows when the user already has a pending request.
+	CreateErasureRequest(ctx context.Context, arg CreateErasureRequestParams) (ErasureRequest, error)
+	// Returns no rows when the key is already taken for this path.
+	CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (IdempotencyKey, error)
+	CreateImportJob(ctx context.Context, arg CreateImportJobParams) (ImportJob, error)
+	CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) (Outbox, error)
+	CreatePhoneVerification(ctx context.Context, arg CreatePhoneVerificationParams) (PhoneVerification, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateUserAddress(ctx context.Context, arg CreateUserAddressParams) (UserAddress, error)
+	CreateUserDocument(ctx context.Context, arg CreateUserDocumentParams) (UserDocument, error)
+	CreateUserHistory(ctx context.Context, arg CreateUserHistoryParams) (UsersHistory, error)
 	CreateUserProfile(ctx context.Context, arg CreateUserProfileParams) (UserProfile, error)
+	CreateUserProfileHistory(ctx context.Context, arg CreateUserProfileHistoryParams) (UserProfileHistory, error)
 	CreateUserRole(ctx context.Context, arg CreateUserRoleParams) (UserRole, error)
-	DeleteUser(ctx context.Context, id uuid.UUID) (User, error)
-	DeleteUserProfile(ctx context.Context, userID uuid.UUID) (UserProfile, error)
-	DeleteUserRole(ctx context.Context, userID uuid.UUID) (UserRole, error)
+	CreateUserRoleHistory(ctx context.Context, arg CreateUserRoleHistoryParams) (UserRoleHistory, error)
+	// A delivery of the outbox event to every active subscription to its type.
+	CreateWebhookDeliveries(ctx context.Context, id int64) (int64, error)
+	CreateWebhookSubscription(ctx context.Context, arg CreateWebhookSubscriptionParams) (WebhookSubscription, error)
+	DeleteAttributeDefinition(ctx context.Context, id uuid.UUID) (AttributeDefinition, error)
+	DeleteBlobDeletion(ctx context.Context, objectKey string) error
+	DeleteEmailChanges(ctx context.Context, userID uuid.UUID) (int64, error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context, createdAt time.Time) (int64, error)
+	DeleteIdempotencyKey(ctx context.Context, arg DeleteIdempotencyKeyParams) error
+	DeletePhoneVerifications(ctx context.Context, userID uuid.UUID) (int64, error)
+	// Soft deletes the user; the row is removed for good by PurgeDeletedUsers once the retention window passes.
+	// expected_version is optional; when set the delete only applies if the row is still at that version.
+	DeleteUser(ctx context.Context, arg DeleteUserParams) (User, error)
+	// expected_version is optional; when set the delete only applies if the row is still at that version.
+	DeleteUserAddress(ctx context.Context, arg DeleteUserAddressParams) (UserAddress, error)
+	DeleteUserAddresses(ctx context.Context, userID uuid.UUID) (int64, error)
+	DeleteUserAttribute(ctx context.Context, arg DeleteUserAttributeParams) (int64, error)
+	DeleteUserAttributes(ctx context.Context, userID uuid.UUID) (int64, error)
+	DeleteUserDocument(ctx context.Context, arg DeleteUserDocumentParams) (UserDocument, error)
+	// Removes all documents of a user and returns their keys, so the blobs can be queued for deletion.
+	DeleteUserDocuments(ctx context.Context, userID uuid.UUID) ([]string, error)
+	DeleteUserHistory(ctx context.Context, userID uuid.UUID) (int64, error)
+	DeleteUserNameReservations(ctx context.Context, userID uuid.UUID) (int64, error)
+	// Soft deletes the profile; the row is removed for good by PurgeDeletedUserProfiles.
+	// expected_version is optional, as in DeleteUser.
+	DeleteUserProfile(ctx context.Context, arg DeleteUserProfileParams) (UserProfile, error)
+	DeleteUserProfileHistory(ctx context.Context, userID uuid.UUID) (int64, error)
+	// Soft deletes the role; the row is removed for good by PurgeDeletedUserRoles.
+	// expected_version is optional, as in DeleteUser.
+	DeleteUserRole(ctx context.Context, arg DeleteUserRoleParams) (UserRole, error)
+	DeleteUserRoleHistory(ctx context.Context, userID uuid.UUID) (int64, error)
+	DeleteUserSetting(ctx context.Context, arg DeleteUserSettingParams) (int64, error)
+	DeleteUserSettings(ctx context.Context, userID uuid.UUID) (int64, error)
+	DeleteWebhookSubscription(ctx context.Context, id uuid.UUID) (WebhookSubscription, error)
+	// Queues blobs for deletion. Keys that are already queued are left alone.
+	EnqueueBlobDeletions(ctx context.Context, objectKeys []string) (int64, error)
+	// Fails the running jobs that have not saved progress since updated_before, because the process running them
+	// stopped without finishing them.
+	FailStaleImportJobs(ctx context.Context, arg FailStaleImportJobsParams) (int64, error)
+	// status is completed or failed; error explains a failed job.
+	FinishImportJob(ctx context.Context, arg FinishImportJobParams) (ImportJob, error)
+	GetAttributeDefinition(ctx context.Context, id uuid.UUID) (AttributeDefinition, error)
+	// Locks the row for the rest of the transaction.
+	GetDefaultUserAddressForUpdate(ctx context.Context, userID uuid.UUID) (UserAddress, error)
+	GetEmailChangeByConfirmTokenForUpdate(ctx context.Context, confirmTokenHash string) (EmailChange, error)
+	GetEmailChangeByRevertTokenForUpdate(ctx context.Context, revertTokenHash string) (EmailChange, error)
+	GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (IdempotencyKey, error)
+	GetImportJob(ctx context.Context, id uuid.UUID) (ImportJob, error)
+	// The most recent code for a user that has not been confirmed yet. Locks it for the rest of the transaction,
+	// so concurrent attempts are counted one at a time.
+	GetLatestPhoneVerificationForUpdate(ctx context.Context, userID uuid.UUID) (PhoneVerification, error)
+	GetPendingErasureRequest(ctx context.Context, userID uuid.UUID) (ErasureRequest, error)
 	GetUser(ctx context.Context, id uuid.UUID) (User, error)
+	GetUserAddress(ctx context.Context, arg GetUserAddressParams) (UserAddress, error)
+	// Locks the row for the rest of the transaction.
+	GetUserAddressForUpdate(ctx context.Context, arg GetUserAddressForUpdateParams) (UserAddress, error)
+	GetUserAsOf(ctx context.Context, arg GetUserAsOfParams) (UsersHistory, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserDocument(ctx context.Context, arg GetUserDocumentParams) (UserDocument, error)
+	// Locks the row for the rest of the transaction. Soft-deleted rows are included so restores can be audited.
+	GetUserForUpdate(ctx context.Context, id uuid.UUID) (User, error)
+	// Checks both values the way the unique indexes do: case-insensitively and including soft-deleted users.
+	// A user name reserved after a rename counts as taken.
+	GetUserNameAndEmailTaken(ctx context.Context, arg GetUserNameAndEmailTakenParams) (GetUserNameAndEmailTakenRow, error)
+	// Checks a name the way the unique index and the reservation trigger do.
+	GetUserNameAvailability(ctx context.Context, userName string) (GetUserNameAvailabilityRow, error)
 	GetUserProfile(ctx context.Context, userID uuid.UUID) (UserProfile, error)
+	GetUserProfileAsOf(ctx context.Context, arg GetUserProfileAsOfParams) (UserProfileHistory, error)
+	// Locks the row for the rest of the transaction. Soft-deleted rows are included so restores can be audited.
+	GetUserProfileForUpdate(ctx context.Context, userID uuid.UUID) (UserProfile, error)
 	GetUserRole(ctx context.Context, userID uuid.UUID) (UserRole, error)
+	GetUserRoleAsOf(ctx context.Context, arg GetUserRoleAsOfParams) (UserRoleHistory, error)
+	// Locks the row for the rest of the transaction. Soft-deleted rows are included so restores can be audited.
+	GetUserRoleForUpdate(ctx context.Context, userID uuid.UUID) (UserRole, error)
+	GetWebhookSubscription(ctx context.Context, id uuid.UUID) (WebhookSubscription, error)
+	IncrementPhoneVerificationAttempts(ctx context.Context, id uuid.UUID) (PhoneVerification, error)
+	ListAttributeDefinitions(ctx context.Context) ([]AttributeDefinition, error)
+	// Every filter is optional; events come back newest first.
+	ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error)
+	// Keyset pagination over id, of the profile and address changes, whose diffs hold encrypted fields.
+	// Locks the page for the rest of the transaction.
+	ListAuditEventsForKeyRotation(ctx context.Context, arg ListAuditEventsForKeyRotationParams) ([]ListAuditEventsForKeyRotationRow, error)
+	// Every change to the user, and every change the user made, oldest first.
+	ListAuditEventsForUser(ctx context.Context, targetID uuid.UUID) ([]AuditEvent, error)
+	// The oldest queued blobs. Locks them for the rest of the transaction and skips blobs another sweeper has locked.
+	ListBlobDeletions(ctx context.Context, limit int32) ([]BlobDeletion, error)
+	// Locks the due requests for the rest of the transaction; requests another worker has locked are skipped.
+	ListDueErasureRequests(ctx context.Context, scheduledFor time.Time) ([]ErasureRequest, error)
+	// The oldest unpublished event of each user, if it is due. Later events of a user wait until the earlier ones
+	// are published, which keeps them in order. Locks the events for the rest of the transaction and skips events
+	// another relay has locked.
+	ListDueOutboxEvents(ctx context.Context, arg ListDueOutboxEventsParams) ([]Outbox, error)
+	// Pending deliveries that are due, with where they go. Locks the deliveries for the rest of the transaction and
+	// skips deliveries another dispatcher has locked. Deliveries of inactive subscriptions wait.
+	ListDueWebhookDeliveries(ctx context.Context, arg ListDueWebhookDeliveriesParams) ([]ListDueWebhookDeliveriesRow, error)
+	ListEmailChanges(ctx context.Context, userID uuid.UUID) ([]EmailChange, error)
+	ListErasureRequests(ctx context.Context, userID uuid.UUID) ([]ErasureRequest, error)
+	// The live users with a value for an attribute, locked in id order for the rest of the transaction.
+	ListLiveUsersWithAttributeForUpdate(ctx context.Context, definitionID uuid.UUID) ([]uuid.UUID, error)
+	// Committed events after a stream position, in commit order, optionally only those of one user, for resuming the
+	// event stream.
+	ListOutboxEventsAfter(ctx context.Context, arg ListOutboxEventsAfterParams) ([]Outbox, error)
+	ListOutboxEventsForUser(ctx context.Context, userID uuid.UUID) ([]Outbox, error)
+	ListPhoneVerifications(ctx context.Context, userID uuid.UUID) ([]PhoneVerification, error)
+	// The avatars of the profiles PurgeDeletedUserProfiles is about to remove.
+	ListPurgeableAvatarKeys(ctx context.Context, deletedBefore time.Time) ([]string, error)
+	// The default address comes first, then the others oldest first.
+	ListUserAddresses(ctx context.Context, userID uuid.UUID) ([]UserAddress, error)
+	// Keyset pagination over id. Locks the page for the rest of the transaction.
+	ListUserAddressesForKeyRotation(ctx context.Context, arg ListUserAddressesForKeyRotationParams) ([]ListUserAddressesForKeyRotationRow, error)
+	ListUserAttributes(ctx context.Context, userID uuid.UUID) ([]ListUserAttributesRow, error)
+	ListUserDocuments(ctx context.Context, userID uuid.UUID) ([]UserDocument, error)
+	ListUserHistory(ctx context.Context, userID uuid.UUID) ([]UsersHistory, error)
+	ListUserNameReservations(ctx context.Context, userID uuid.UUID) ([]UserNameReservation, error)
+	ListUserProfileHistory(ctx context.Context, userID uuid.UUID) ([]UserProfileHistory, error)
+	// Keyset pagination over id. Locks the page for the rest of the transaction.
+	ListUserProfileHistoryForKeyRotation(ctx context.Context, arg ListUserProfileHistoryForKeyRotationParams) ([]ListUserProfileHistoryForKeyRotationRow, error)
+	// Keyset pagination over (created_at, id). Leave the cursor null for the first page, then pass the last row's values.
 	ListUserProfiles(ctx context.Context, arg ListUserProfilesParams) ([]UserProfile, error)
+	// Keyset pagination over id, soft-deleted rows included. Locks the page for the rest of the transaction.
+	ListUserProfilesForKeyRotation(ctx context.Context, arg ListUserProfilesForKeyRotationParams) ([]ListUserProfilesForKeyRotationRow, error)
+	ListUserRoleHistory(ctx context.Context, userID uuid.UUID) ([]UserRoleHistory, error)
+	// Keyset pagination over (created_at, id). Leave the cursor null for the first page, then pass the last row's values.
 	ListUserRoles(ctx context.Context, arg ListUserRolesParams) ([]UserRole, error)
+	ListUserSettings(ctx context.Context, userID uuid.UUID) ([]UserSetting, error)
+	// Keyset pagination over (created_at, id). Leave the cursor null for the first page, then pass the last row's values.
 	ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error)
+	// The attribute values of several users at once, for listings and exports.
+	ListUsersAttributes(ctx context.Context, userIds []uuid.UUID) ([]ListUsersAttributesRow, error)
+	// A subscription's deliveries, newest first, optionally only those in one status.
+	ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error)
+	MarkEmailChangeConfirmed(ctx context.Context, id uuid.UUID) (EmailChange, error)
+	MarkEmailChangeReverted(ctx context.Context, id uuid.UUID) (EmailChange, error)
+	MarkOutboxEventPublished(ctx context.Context, id int64) error
+	MarkPhoneVerificationVerified(ctx context.Context, id uuid.UUID) (PhoneVerification, error)
+	// Removes the addresses of users that are being purged so the users can be deleted afterwards.
+	PurgeDeletedUserAddresses(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// Removes the attribute values of users that are being purged so the users can be deleted afterwards.
+	PurgeDeletedUserAttributes(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// Removes the documents of users that are being purged so the users can be deleted afterwards.
+	PurgeDeletedUserDocuments(ctx context.Context, deletedBefore time.Time) ([]string, error)
+	// Also removes profiles of users that are being purged so the users can be deleted afterwards.
+	PurgeDeletedUserProfiles(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// Also removes roles of users that are being purged so the users can be deleted afterwards.
+	PurgeDeletedUserRoles(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// Removes the settings of users that are being purged so the users can be deleted afterwards.
+	PurgeDeletedUserSettings(ctx context.Context, deletedBefore time.Time) (int64, error)
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error)
+	PurgeDeliveredWebhookDeliveries(ctx context.Context, deliveredBefore time.Time) (int64, error)
+	// Removes changes that can no longer be reverted, and the changes of users that are being purged so the users can
+	// be deleted afterwards.
+	PurgeEmailChanges(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// Removes expired codes, and the codes of users that are being purged so the users can be deleted afterwards.
+	PurgePhoneVerifications(ctx context.Context, deletedBefore time.Time) (int64, error)
+	PurgePublishedOutboxEvents(ctx context.Context, publishedBefore time.Time) (int64, error)
+	// Removes expired reservations, and those of users that are being purged so the users can be deleted afterwards.
+	PurgeUserNameReservations(ctx context.Context, deletedBefore time.Time) (int64, error)
+	RecordWebhookDeliveryAttempt(ctx context.Context, arg RecordWebhookDeliveryAttemptParams) (WebhookDelivery, error)
+	// Sends the delivery again as soon as possible, whatever its status, with a fresh set of attempts. The outcome
+	// of the last attempt is kept until the next one.
+	RedeliverWebhookDelivery(ctx context.Context, arg RedeliverWebhookDeliveryParams) (WebhookDelivery, error)
+	// Removes a user's own reservation of a name, e.g. when they take it back.
+	ReleaseUserName(ctx context.Context, arg ReleaseUserNameParams) (int64, error)
+	// Keeps a user's old name for them until expires_at. A reservation of the same name that has expired, or that
+	// the user already held, is replaced.
+	ReserveUserName(ctx context.Context, arg ReserveUserNameParams) (UserNameReservation, error)
+	RestoreUser(ctx context.Context, id uuid.UUID) (User, error)
+	RestoreUserProfile(ctx context.Context, userID uuid.UUID) (UserProfile, error)
+	RestoreUserRole(ctx context.Context, userID uuid.UUID) (UserRole, error)
+	RetryOutboxEvent(ctx context.Context, arg RetryOutboxEventParams) error
+	// Clears the default flag so another address can take it; the partial unique index allows only one per user.
+	UnsetDefaultUserAddress(ctx context.Context, userID uuid.UUID) (UserAddress, error)
+	UpdateAttributeDefinition(ctx context.Context, arg UpdateAttributeDefinitionParams) (AttributeDefinition, error)
+	// Needs AllowAuditKeyRotation earlier in the same transaction.
+	UpdateAuditEventEncryption(ctx context.Context, arg UpdateAuditEventEncryptionParams) error
+	UpdateImportJobProgress(ctx context.Context, arg UpdateImportJobProgressParams) (ImportJob, error)
+	// expected_version is optional; when set the update only applies if the row is still at that version.
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	// expected_version is optional; when set the update only applies if the row is still at that version.
+	UpdateUserAddress(ctx context.Context, arg UpdateUserAddressParams) (UserAddress, error)
+	// Rewrites the encrypted columns without a new version: the values themselves are unchanged.
+	UpdateUserAddressEncryption(ctx context.Context, arg UpdateUserAddressEncryptionParams) error
+	// expected_version is optional; when set the update only applies if the row is still at that version.
 	UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (UserProfile, error)
+	// Sets or clears the avatar. The caller queues the blobs of the previous avatar for deletion.
+	UpdateUserProfileAvatar(ctx context.Context, arg UpdateUserProfileAvatarParams) (UserProfile, error)
+	// Rewrites the encrypted columns and blind indexes without a new version: the values themselves are unchanged.
+	UpdateUserProfileEncryption(ctx context.Context, arg UpdateUserProfileEncryptionParams) error
+	UpdateUserProfileHistoryEncryption(ctx context.Context, arg UpdateUserProfileHistoryEncryptionParams) error
+	// Sets or clears the phone number. A new number is unverified; setting the same number again keeps the verification.
+	// expected_version is optional, as in UpdateUserProfile.
+	UpdateUserProfilePhone(ctx context.Context, arg UpdateUserProfilePhoneParams) (UserProfile, error)
+	// expected_version is optional; when set the update only applies if the row is still at that version.
 	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (UserRole, error)
+	// An empty secret keeps the current one.
+	UpdateWebhookSubscription(ctx context.Context, arg UpdateWebhookSubscriptionParams) (WebhookSubscription, error)
+	UpsertUserAttribute(ctx context.Context, arg UpsertUserAttributeParams) (UserAttribute, error)
+	UpsertUserSetting(ctx context.Context, arg UpsertUserSettingParams) (UserSetting, error)
+	// Marks the phone number as verified. Returns no rows when the profile's number is no longer phone_number.
+	VerifyUserProfilePhone(ctx context.Context, arg VerifyUserProfilePhoneParams) (UserProfile, error)
 }
 
 var _ Querier = (*Queries)(nil)
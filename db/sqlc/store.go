@@ -5,33 +5,76 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/google/uuid"
+	"time"
 )
 
 // Store provides all functions to execute database queries and transactions.
 // It embeds *Queries to allow direct access to query methods and maintains a reference to the database connection.
+// The transactional methods also write audit events, attributed to the actor carried by ctx (see WithActor),
+// copy every new row version into the history tables, and write user lifecycle events to the outbox.
 type Store interface {
 	Querier
-	CreateUserWithProfileAndRoleTx(ctx context.Context, userParams CreateUserParams, profileParams CreateUserProfileParams, roleParams CreateUserRoleParams) (UserTxResult, error)
+	CreateUserWithProfileAndRoleTx(ctx context.Context, userParams CreateUserParams, profileParams CreateUserProfileParams, roleParams CreateUserRoleParams, attributes ...UserAttributeValue) (UserTxResult, error)
+	CreateUserWithRoleTx(ctx context.Context, userParams CreateUserParams, roleParams CreateUserRoleParams) (UserTxResult, error)
+	UpdateUserTx(ctx context.Context, userParams UpdateUserParams, emailChange *StartEmailChangeParams) (UpdateUserTxResult, error)
 	GetUserWithProfileAndRoleTX(ctx context.Context, userID uuid.UUID) (UserTxResult, error)
-	DeleteUserWithProfileAndRoleTX(ctx context.Context, userID uuid.UUID) (UserTxResult, error)
-	UpdateUserWithProfileAndRoleTX(ctx context.Context, userParams UpdateUserParams, profileParams UpdateUserProfileParams, roleParams UpdateUserRoleParams) (UserTxResult, error)
+	DeleteUserWithProfileAndRoleTX(ctx context.Context, userParams DeleteUserParams, profileParams DeleteUserProfileParams, roleParams DeleteUserRoleParams) (UserTxResult, error)
+	UpdateUserWithProfileAndRoleTX(ctx context.Context, userParams UpdateUserParams, profileParams UpdateUserProfileParams, roleParams UpdateUserRoleParams, emailChange *StartEmailChangeParams, attributes ...UserAttributeValue) (UserTxResult, error)
+	RestoreUserWithProfileAndRoleTx(ctx context.Context, userID uuid.UUID) (UserTxResult, error)
+	PurgeDeletedUsersTx(ctx context.Context, deletedBefore time.Time) (int64, error)
+	GetUserWithProfileAndRoleAsOfTx(ctx context.Context, userID uuid.UUID, asOf time.Time) (UserTxResult, error)
+	GetUserHistoryTx(ctx context.Context, userID uuid.UUID) (UserHistoryResult, error)
+	SearchUsersTx(ctx context.Context, filter UserListFilter) (UserListResult, error)
+	SearchUserDirectoryTx(ctx context.Context, arg UserDirectorySearchParams) ([]UserDirectoryRow, error)
+	ExportUsersTx(ctx context.Context, filter UserListFilter, fn func(UserListRow) error) error
+	GetUserDataTx(ctx context.Context, userID uuid.UUID) (UserDataResult, error)
+	EraseDueUsersTx(ctx context.Context, now time.Time) (int64, error)
+	RotateProfileKeysTx(ctx context.Context, afterID uuid.UUID, limit int32) (ProfileKeyRotationBatch, error)
+	RotateProfileHistoryKeysTx(ctx context.Context, afterID int64, limit int32) (ProfileHistoryKeyRotationBatch, error)
+	RotateAddressKeysTx(ctx context.Context, afterID uuid.UUID, limit int32) (AddressKeyRotationBatch, error)
+	RotateAuditKeysTx(ctx context.Context, afterID int64, limit int32) (AuditKeyRotationBatch, error)
+	CreateUserAddressTx(ctx context.Context, arg CreateUserAddressParams) (UserAddress, error)
+	UpdateUserAddressTx(ctx context.Context, arg UpdateUserAddressParams) (UserAddress, error)
+	DeleteUserAddressTx(ctx context.Context, arg DeleteUserAddressParams) (UserAddress, error)
+	SetUserPhoneTx(ctx context.Context, arg UpdateUserProfilePhoneParams) (UserProfile, error)
+	StartPhoneVerificationTx(ctx context.Context, arg StartPhoneVerificationParams) (PhoneVerification, error)
+	ConfirmPhoneVerificationTx(ctx context.Context, arg ConfirmPhoneVerificationParams) (UserProfile, error)
+	SetUserAvatarTx(ctx context.Context, arg UpdateUserProfileAvatarParams) (UserProfile, error)
+	CreateUserDocumentTx(ctx context.Context, arg CreateUserDocumentParams) (UserDocument, error)
+	DeleteUserDocumentTx(ctx context.Context, arg DeleteUserDocumentParams) (UserDocument, error)
+	SweepBlobDeletionsTx(ctx context.Context, limit int32, fn func(key string) error) (int64, error)
+	SetUserSettingsTx(ctx context.Context, arg SetUserSettingsParams) ([]UserSetting, error)
+	DeleteAttributeDefinitionTx(ctx context.Context, id uuid.UUID) (AttributeDefinition, error)
+	StartEmailChangeTx(ctx context.Context, arg StartEmailChangeParams) (EmailChange, error)
+	ConfirmEmailChangeTx(ctx context.Context, tokenHash string, now time.Time) (User, error)
+	RevertEmailChangeTx(ctx context.Context, tokenHash string, now time.Time) (User, error)
+	RelayOutboxTx(ctx context.Context, limit int32, now time.Time, fn func(Outbox) error) (int64, error)
+	DeliverWebhooksTx(ctx context.Context, arg DeliverWebhooksParams, fn func(ListDueWebhookDeliveriesRow) (int, error)) (WebhookDispatchResult, error)
 }
 
 type SQLStore struct {
 	*Queries
-	db *sql.DB
+	db                  *sql.DB
+	fields              FieldCipher
+	userNameGracePeriod time.Duration
 }
 
 // NewStore creates a new Store instance.
 // Parameters:
 // - db: A pointer to the database connection.
+// - options: Optional settings, such as WithFieldCipher and WithUserNameGracePeriod.
 // Returns:
 // - A pointer to the initialized Store.
-func NewStore(db *sql.DB) Store {
-	return &SQLStore{
-		db:      db,
-		Queries: New(db),
+func NewStore(db *sql.DB, options ...StoreOption) Store {
+	store := &SQLStore{
+		db:                  db,
+		Queries:             New(db),
+		userNameGracePeriod: DefaultUserNameGracePeriod,
 	}
+	for _, option := range options {
+		option(store)
+	}
+	return store
 }
 
 // execTx executes a function within a database transaction.
@@ -66,10 +109,23 @@ func (store *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) erro
 // - User: The user entity.
 // - UserProfile: The associated user profile entity.
 // - UserRole: The associated user role entity.
+// - Attributes: The user's custom attribute values, ordered by key. Only filled in by the methods that say so.
+// - EmailChange: The email change started with an update, or nil. Only filled in by UpdateUserWithProfileAndRoleTX.
 type UserTxResult struct {
-	User        User        `json:"user"`
-	UserProfile UserProfile `json:"user_profile"`
-	UserRole    UserRole    `json:"user_role"`
+	User        User                    `json:"user"`
+	UserProfile UserProfile             `json:"user_profile"`
+	UserRole    UserRole                `json:"user_role"`
+	Attributes  []ListUserAttributesRow `json:"attributes"`
+	EmailChange *EmailChange            `json:"email_change,omitempty"`
+}
+
+// UpdateUserTxResult represents the result of UpdateUserTx.
+// Fields:
+// - User: The updated user.
+// - EmailChange: The email change started with the update, or nil if none was asked for.
+type UpdateUserTxResult struct {
+	User        User         `json:"user"`
+	EmailChange *EmailChange `json:"email_change,omitempty"`
 }
 
 // CreateUserWithProfileAndRoleTx performs a transaction to create a user, their profile, and role.
@@ -78,10 +134,11 @@ type UserTxResult struct {
 // - userParams: Parameters for creating the user.
 // - profileParams: Parameters for creating the user profile.
 // - roleParams: Parameters for creating the user role.
+// - attributes: Custom attribute values of the new user, already validated.
 // Returns:
-// - A UserTxResult containing the created user, profile, and role.
+// - A UserTxResult containing the created user, profile, role, and attributes.
 // - An error if the transaction fails.
-func (store *SQLStore) CreateUserWithProfileAndRoleTx(ctx context.Context, userParams CreateUserParams, profileParams CreateUserProfileParams, roleParams CreateUserRoleParams) (UserTxResult, error) {
+func (store *SQLStore) CreateUserWithProfileAndRoleTx(ctx context.Context, userParams CreateUserParams, profileParams CreateUserProfileParams, roleParams CreateUserRoleParams, attributes ...UserAttributeValue) (UserTxResult, error) {
 	var result UserTxResult
 
 	err := store.execTx(ctx, func(q *Queries) error {
@@ -92,13 +149,44 @@ func (store *SQLStore) CreateUserWithProfileAndRoleTx(ctx context.Context, userP
 			return err
 		}
 
+		err = recordAudit(ctx, q, AuditActionCreate, AuditTargetUser, result.User.ID, nil, result.User)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserHistory(ctx, q, result.User)
+		if err != nil {
+			return err
+		}
+
 		profileParams.UserID = result.User.ID
+		location := addressLocation{profileParams.StreetAddress, profileParams.City, profileParams.State, profileParams.Zip, profileParams.CountryCode}
+
+		profileParams, err = store.encryptCreateProfileParams(profileParams)
+		if err != nil {
+			return err
+		}
 
 		result.UserProfile, err = q.CreateUserProfile(ctx, profileParams)
 		if err != nil {
 			return err
 		}
 
+		err = recordAudit(ctx, q, AuditActionCreate, AuditTargetUserProfile, result.User.ID, nil, result.UserProfile)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserProfileHistory(ctx, q, result.UserProfile)
+		if err != nil {
+			return err
+		}
+
+		err = store.syncDefaultAddress(ctx, q, result.User.ID, location)
+		if err != nil {
+			return err
+		}
+
 		roleParams.UserID = result.User.ID
 
 		result.UserRole, err = q.CreateUserRole(ctx, roleParams)
@@ -106,7 +194,78 @@ func (store *SQLStore) CreateUserWithProfileAndRoleTx(ctx context.Context, userP
 			return err
 		}
 
-		return nil
+		err = recordAudit(ctx, q, AuditActionCreate, AuditTargetUserRole, result.User.ID, nil, result.UserRole)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserRoleHistory(ctx, q, result.UserRole)
+		if err != nil {
+			return err
+		}
+
+		result.Attributes, err = setUserAttributes(ctx, q, AuditActionCreate, result.User.ID, attributes)
+		if err != nil {
+			return err
+		}
+
+		return recordEvent(ctx, q, EventUserCreated, result.User.ID, userEventData(result.User))
+	})
+
+	if err == nil {
+		err = store.decryptProfile(&result.UserProfile)
+	}
+
+	return result, err
+}
+
+// CreateUserWithRoleTx creates a user and their role in a single transaction, for users signing up without a profile.
+// Parameters:
+// - ctx: The context for the transaction.
+// - userParams: Parameters for creating the user.
+// - roleParams: Parameters for creating the user role. UserID is filled in from the new user.
+// Returns:
+// - A UserTxResult containing the created user and role. UserProfile is left empty.
+// - An error if the transaction fails.
+func (store *SQLStore) CreateUserWithRoleTx(ctx context.Context, userParams CreateUserParams, roleParams CreateUserRoleParams) (UserTxResult, error) {
+	var result UserTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		result.User, err = q.CreateUser(ctx, userParams)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudit(ctx, q, AuditActionCreate, AuditTargetUser, result.User.ID, nil, result.User)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserHistory(ctx, q, result.User)
+		if err != nil {
+			return err
+		}
+
+		roleParams.UserID = result.User.ID
+
+		result.UserRole, err = q.CreateUserRole(ctx, roleParams)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudit(ctx, q, AuditActionCreate, AuditTargetUserRole, result.User.ID, nil, result.UserRole)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserRoleHistory(ctx, q, result.UserRole)
+		if err != nil {
+			return err
+		}
+
+		return recordEvent(ctx, q, EventUserCreated, result.User.ID, userEventData(result.User))
 	})
 
 	return result, err
@@ -117,7 +276,7 @@ func (store *SQLStore) CreateUserWithProfileAndRoleTx(ctx context.Context, userP
 // - ctx: The context for the transaction.
 // - userID: The UUID of the user to retrieve.
 // Returns:
-// - A UserTxResult containing the user, profile, and role.
+// - A UserTxResult containing the user, profile, role, and attributes.
 // - An error if the transaction fails or the user does not exist.
 func (store *SQLStore) GetUserWithProfileAndRoleTX(ctx context.Context, userID uuid.UUID) (UserTxResult, error) {
 	var result UserTxResult
@@ -139,40 +298,147 @@ func (store *SQLStore) GetUserWithProfileAndRoleTX(ctx context.Context, userID u
 			return err
 		}
 
-		return nil
+		result.Attributes, err = q.ListUserAttributes(ctx, userID)
+		return err
 	})
 
+	if err == nil {
+		err = store.decryptProfile(&result.UserProfile)
+	}
+
 	return result, err
 }
 
-// DeleteUserWithProfileAndRoleTX deletes a user, their profile, and role in a single transaction.
+// DeleteUserWithProfileAndRoleTX soft deletes a user, their profile, and role in a single transaction.
+// Users created without a profile or role are still deleted; the missing parts are left empty in the result.
 // Parameters:
 // - ctx: The context for the transaction.
-// - userID: The UUID of the user to delete.
+// - userParams: The user to delete. ExpectedVersion is optional.
+// - profileParams: ExpectedVersion is optional and only checked when the user has a profile. UserID is set from userParams.
+// - roleParams: ExpectedVersion is optional and only checked when the user has a role. UserID is set from userParams.
 // Returns:
 // - A UserTxResult containing the deleted user, profile, and role.
-// - An error if the transaction fails or the user does not exist.
-func (store *SQLStore) DeleteUserWithProfileAndRoleTX(ctx context.Context, userID uuid.UUID) (UserTxResult, error) {
+// - sql.ErrNoRows if the user does not exist or an ExpectedVersion did not match, or an error if the transaction fails.
+func (store *SQLStore) DeleteUserWithProfileAndRoleTX(ctx context.Context, userParams DeleteUserParams, profileParams DeleteUserProfileParams, roleParams DeleteUserRoleParams) (UserTxResult, error) {
 	var result UserTxResult
+	userID := userParams.ID
 
 	err := store.execTx(ctx, func(q *Queries) error {
 		var err error
 
-		result.UserRole, err = q.DeleteUserRole(ctx, userID)
+		// A role or profile that is missing or already deleted is skipped, so a delete that finds no row is a
+		// version mismatch.
+		roleBefore, err := q.GetUserRoleForUpdate(ctx, userID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && !roleBefore.DeletedAt.Valid {
+			roleParams.UserID = userID
+			result.UserRole, err = q.DeleteUserRole(ctx, roleParams)
+			if err == nil {
+				err = recordAudit(ctx, q, AuditActionDelete, AuditTargetUserRole, userID, roleBefore, result.UserRole)
+			}
+			if err == nil {
+				err = recordUserRoleHistory(ctx, q, result.UserRole)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		profileBefore, err := q.GetUserProfileForUpdate(ctx, userID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && !profileBefore.DeletedAt.Valid {
+			profileParams.UserID = userID
+			result.UserProfile, err = q.DeleteUserProfile(ctx, profileParams)
+			if err == nil {
+				err = recordAudit(ctx, q, AuditActionDelete, AuditTargetUserProfile, userID, profileBefore, result.UserProfile)
+			}
+			if err == nil {
+				err = recordUserProfileHistory(ctx, q, result.UserProfile)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		userBefore, err := q.GetUserForUpdate(ctx, userID)
 		if err != nil {
 			return err
 		}
 
-		result.UserProfile, err = q.DeleteUserProfile(ctx, userID)
+		result.User, err = q.DeleteUser(ctx, userParams)
 		if err != nil {
 			return err
 		}
 
-		result.User, err = q.DeleteUser(ctx, userID)
+		err = recordAudit(ctx, q, AuditActionDelete, AuditTargetUser, userID, userBefore, result.User)
 		if err != nil {
 			return err
 		}
-		return nil
+
+		err = recordUserHistory(ctx, q, result.User)
+		if err != nil {
+			return err
+		}
+
+		return recordEvent(ctx, q, EventUserDeleted, userID, userEventData(result.User))
+	})
+
+	if err == nil {
+		err = store.decryptProfile(&result.UserProfile)
+	}
+
+	return result, err
+}
+
+// UpdateUserTx updates a user in a single transaction, recording the change in the audit log.
+// Parameters:
+// - ctx: The context for the transaction.
+// - userParams: Parameters for updating the user. A different email address is ignored, see keepEmail.
+// - emailChange: The email change to start in the same transaction, or nil. Its UserID is not used.
+// Returns:
+// - The updated user and the pending email change, if one was started.
+// - sql.ErrNoRows if the user does not exist or ExpectedVersion did not match, or ErrEmailTaken, in which case
+// nothing is updated.
+func (store *SQLStore) UpdateUserTx(ctx context.Context, userParams UpdateUserParams, emailChange *StartEmailChangeParams) (UpdateUserTxResult, error) {
+	var result UpdateUserTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		userBefore, err := q.GetUserForUpdate(ctx, userParams.ID)
+		if err != nil {
+			return err
+		}
+		keepEmail(&userParams, userBefore)
+
+		result.User, err = q.UpdateUser(ctx, userParams)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudit(ctx, q, AuditActionUpdate, AuditTargetUser, result.User.ID, userBefore, result.User)
+		if err != nil {
+			return err
+		}
+
+		err = store.reserveOldUserName(ctx, q, userBefore, result.User)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserHistory(ctx, q, result.User)
+		if err != nil {
+			return err
+		}
+
+		result.EmailChange, err = startEmailChangeWithUpdate(ctx, q, result.User, emailChange)
+		if err != nil {
+			return err
+		}
+
+		return recordEvent(ctx, q, EventUserUpdated, result.User.ID, userEventData(result.User))
 	})
 
 	return result, err
@@ -181,39 +447,305 @@ func (store *SQLStore) DeleteUserWithProfileAndRoleTX(ctx context.Context, userI
 // UpdateUserWithProfileAndRoleTX updates a user, their profile, and role in a single transaction.
 // Parameters:
 // - ctx: The context for the transaction.
-// - userParams: Parameters for updating the user.
+// - userParams: Parameters for updating the user. A different email address is ignored, see keepEmail.
 // - profileParams: Parameters for updating the user profile.
 // - roleParams: Parameters for updating the user role.
+// - emailChange: The email change to start in the same transaction, or nil. Its UserID is not used.
+// - attributes: Custom attribute values to set or remove, already validated. Attributes not listed are kept.
 // Returns:
-// - A UserTxResult containing the updated user, profile, and role.
-// - An error if the transaction fails or the user does not exist.
-func (store *SQLStore) UpdateUserWithProfileAndRoleTX(ctx context.Context, userParams UpdateUserParams, profileParams UpdateUserProfileParams, roleParams UpdateUserRoleParams) (UserTxResult, error) {
+// - A UserTxResult containing the updated user, profile, role, attributes, and the pending email change.
+// - An error if the transaction fails or the user does not exist, or ErrEmailTaken, in which case nothing is updated.
+func (store *SQLStore) UpdateUserWithProfileAndRoleTX(ctx context.Context, userParams UpdateUserParams, profileParams UpdateUserProfileParams, roleParams UpdateUserRoleParams, emailChange *StartEmailChangeParams, attributes ...UserAttributeValue) (UserTxResult, error) {
 	var result UserTxResult
 
 	err := store.execTx(ctx, func(q *Queries) error {
 		var err error
 
+		userBefore, err := q.GetUserForUpdate(ctx, userParams.ID)
+		if err != nil {
+			return err
+		}
+		keepEmail(&userParams, userBefore)
+
 		result.User, err = q.UpdateUser(ctx, userParams)
 		if err != nil {
 			return err
 		}
 
+		err = recordAudit(ctx, q, AuditActionUpdate, AuditTargetUser, userParams.ID, userBefore, result.User)
+		if err != nil {
+			return err
+		}
+
+		err = store.reserveOldUserName(ctx, q, userBefore, result.User)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserHistory(ctx, q, result.User)
+		if err != nil {
+			return err
+		}
+
 		profileParams.UserID = userParams.ID
+		location := addressLocation{profileParams.StreetAddress, profileParams.City, profileParams.State, profileParams.Zip, profileParams.CountryCode}
+
+		profileBefore, err := q.GetUserProfileForUpdate(ctx, userParams.ID)
+		if err != nil {
+			return err
+		}
+
+		profileParams, err = store.encryptUpdateProfileParams(profileParams, profileBefore)
+		if err != nil {
+			return err
+		}
 
 		result.UserProfile, err = q.UpdateUserProfile(ctx, profileParams)
 		if err != nil {
 			return err
 		}
 
+		err = recordAudit(ctx, q, AuditActionUpdate, AuditTargetUserProfile, userParams.ID, profileBefore, result.UserProfile)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserProfileHistory(ctx, q, result.UserProfile)
+		if err != nil {
+			return err
+		}
+
+		err = store.syncDefaultAddress(ctx, q, userParams.ID, location)
+		if err != nil {
+			return err
+		}
+
 		roleParams.UserID = userParams.ID
 
+		roleBefore, err := q.GetUserRoleForUpdate(ctx, userParams.ID)
+		if err != nil {
+			return err
+		}
+
 		result.UserRole, err = q.UpdateUserRole(ctx, roleParams)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		err = recordAudit(ctx, q, AuditActionUpdate, AuditTargetUserRole, userParams.ID, roleBefore, result.UserRole)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserRoleHistory(ctx, q, result.UserRole)
+		if err != nil {
+			return err
+		}
+
+		result.Attributes, err = setUserAttributes(ctx, q, AuditActionUpdate, userParams.ID, attributes)
+		if err != nil {
+			return err
+		}
+
+		result.EmailChange, err = startEmailChangeWithUpdate(ctx, q, result.User, emailChange)
+		if err != nil {
+			return err
+		}
+
+		return recordEvent(ctx, q, EventUserUpdated, userParams.ID, userEventData(result.User))
+	})
+
+	if err == nil {
+		err = store.decryptProfile(&result.UserProfile)
+	}
+
+	return result, err
+}
+
+// RestoreUserWithProfileAndRoleTx undoes a soft delete of a user, their profile, and role in a single transaction.
+// Parameters:
+// - ctx: The context for the transaction.
+// - userID: The UUID of the user to restore.
+// Returns:
+// - A UserTxResult containing the restored user and whichever of profile and role existed.
+// - sql.ErrNoRows if the user is not soft deleted (or has already been purged).
+func (store *SQLStore) RestoreUserWithProfileAndRoleTx(ctx context.Context, userID uuid.UUID) (UserTxResult, error) {
+	var result UserTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		userBefore, err := q.GetUserForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		result.User, err = q.RestoreUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudit(ctx, q, AuditActionRestore, AuditTargetUser, userID, userBefore, result.User)
+		if err != nil {
+			return err
+		}
+
+		err = recordUserHistory(ctx, q, result.User)
+		if err != nil {
+			return err
+		}
+
+		profileBefore, err := q.GetUserProfileForUpdate(ctx, userID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		result.UserProfile, err = q.RestoreUserProfile(ctx, userID)
+		if err == nil {
+			err = recordAudit(ctx, q, AuditActionRestore, AuditTargetUserProfile, userID, profileBefore, result.UserProfile)
+		}
+		if err == nil {
+			err = recordUserProfileHistory(ctx, q, result.UserProfile)
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		roleBefore, err := q.GetUserRoleForUpdate(ctx, userID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		result.UserRole, err = q.RestoreUserRole(ctx, userID)
+		if err == nil {
+			err = recordAudit(ctx, q, AuditActionRestore, AuditTargetUserRole, userID, roleBefore, result.UserRole)
+		}
+		if err == nil {
+			err = recordUserRoleHistory(ctx, q, result.UserRole)
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		return recordEvent(ctx, q, EventUserRestored, userID, userEventData(result.User))
 	})
 
+	if err == nil {
+		err = store.decryptProfile(&result.UserProfile)
+	}
+
 	return result, err
 }
+
+// PurgeDeletedUsersTx permanently removes users soft deleted before the cutoff, along with their profiles and roles.
+// Phone verification codes that expired before the cutoff, expired user name reservations, and email changes that
+// can no longer be reverted are removed as well.
+// The blobs of removed avatars and documents are queued for deletion.
+// Each purged user gets a purge audit event and loses its history, and the personal fields are erased from the
+// diffs of its earlier audit events as for erasure (see erasedAuditFields). Once the queued blobs are deleted, no
+// copy of the user's data is left behind.
+// Parameters:
+// - ctx: The context for the transaction.
+// - deletedBefore: Rows soft deleted before this time are removed.
+// Returns:
+// - The number of users removed.
+// - An error if the transaction fails.
+func (store *SQLStore) PurgeDeletedUsersTx(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		_, err = q.PurgeDeletedUserRoles(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		avatarKeys, err := q.ListPurgeableAvatarKeys(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+		for _, key := range avatarKeys {
+			if err = queueBlobDeletions(ctx, q, avatarObjectKeys(key)); err != nil {
+				return err
+			}
+		}
+
+		_, err = q.PurgeDeletedUserProfiles(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.PurgeDeletedUserAddresses(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.PurgePhoneVerifications(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.PurgeUserNameReservations(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.PurgeEmailChanges(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.PurgeDeletedUserSettings(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.PurgeDeletedUserAttributes(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		documentKeys, err := q.PurgeDeletedUserDocuments(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+		if err = queueBlobDeletions(ctx, q, documentKeys); err != nil {
+			return err
+		}
+
+		userIDs, err := q.PurgeDeletedUsers(ctx, deletedBefore)
+		if err != nil {
+			return err
+		}
+
+		if len(userIDs) > 0 {
+			if err = q.AllowAuditErasure(ctx); err != nil {
+				return err
+			}
+		}
+
+		for _, userID := range userIDs {
+			// The audit log is append-only, so the user's personal data would otherwise outlive them there.
+			_, err = q.AnonymizeAuditEvents(ctx, AnonymizeAuditEventsParams{UserID: userID, Fields: erasedAuditFields})
+			if err != nil {
+				return err
+			}
+
+			err = recordAudit(ctx, q, AuditActionPurge, AuditTargetUser, userID, nil, nil)
+			if err != nil {
+				return err
+			}
+
+			err = purgeUserHistory(ctx, q, userID)
+			if err != nil {
+				return err
+			}
+		}
+
+		purged = int64(len(userIDs))
+		return nil
+	})
+
+	return purged, err
+}
@@ -2,8 +2,10 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 	"whaleWake/util"
 )
 
@@ -90,7 +92,7 @@ func TestCreateUserWithProfileAndRoleTx(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Cleanup(func() {
-		_, err = store.DeleteUserWithProfileAndRoleTX(context.Background(), result.User.ID)
+		_, err = store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: result.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
 		require.NoError(t, err)
 
 		_, err = store.GetUser(context.Background(), result.User.ID)
@@ -161,7 +163,7 @@ func TestGetUserWithProfileAndRoleTx(t *testing.T) {
 	require.Equal(t, result.UserRole.ID, fetched.UserRole.ID)
 
 	t.Cleanup(func() {
-		_, err = store.DeleteUserWithProfileAndRoleTX(context.Background(), result.User.ID)
+		_, err = store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: result.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
 		require.NoError(t, err)
 
 		_, err = store.GetUser(context.Background(), result.User.ID)
@@ -224,7 +226,7 @@ func TestDeleteUserWithProfileAndRoleTX(t *testing.T) {
 	require.NotEmpty(t, result)
 
 	t.Cleanup(func() {
-		_, err = store.DeleteUserWithProfileAndRoleTX(context.Background(), result.User.ID)
+		_, err = store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: result.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
 		require.NoError(t, err)
 
 		_, err = store.GetUser(context.Background(), result.User.ID)
@@ -239,6 +241,37 @@ func TestDeleteUserWithProfileAndRoleTX(t *testing.T) {
 
 }
 
+func TestDeleteUserWithProfileAndRoleTXExpectedVersions(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+	version := func(v int32) sql.NullInt32 { return sql.NullInt32{Int32: v, Valid: true} }
+
+	// A stale profile version leaves all three rows untouched, including the role deleted before it.
+	_, err := store.DeleteUserWithProfileAndRoleTX(context.Background(),
+		DeleteUserParams{ID: created.User.ID, ExpectedVersion: version(created.User.Version)},
+		DeleteUserProfileParams{ExpectedVersion: version(created.UserProfile.Version + 1)},
+		DeleteUserRoleParams{ExpectedVersion: version(created.UserRole.Version)})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = store.GetUserRole(context.Background(), created.User.ID)
+	require.NoError(t, err)
+
+	_, err = store.DeleteUserWithProfileAndRoleTX(context.Background(),
+		DeleteUserParams{ID: created.User.ID, ExpectedVersion: version(created.User.Version + 1)},
+		DeleteUserProfileParams{},
+		DeleteUserRoleParams{})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	deleted, err := store.DeleteUserWithProfileAndRoleTX(context.Background(),
+		DeleteUserParams{ID: created.User.ID, ExpectedVersion: version(created.User.Version)},
+		DeleteUserProfileParams{ExpectedVersion: version(created.UserProfile.Version)},
+		DeleteUserRoleParams{ExpectedVersion: version(created.UserRole.Version)})
+	require.NoError(t, err)
+	require.True(t, deleted.User.DeletedAt.Valid)
+	require.True(t, deleted.UserProfile.DeletedAt.Valid)
+	require.True(t, deleted.UserRole.DeletedAt.Valid)
+}
+
 func TestUpdateUserWithProfileAndRoleTX(t *testing.T) {
 	store := NewStore(testDB)
 
@@ -340,7 +373,8 @@ func TestUpdateUserWithProfileAndRoleTX(t *testing.T) {
 		},
 		UpdateUserRoleParams{
 			RoleID: userRoleUpdate.RoleID,
-		})
+		},
+		nil)
 
 	// Quick check on the Create Mock here.
 	require.NoError(t, err)
@@ -348,7 +382,8 @@ func TestUpdateUserWithProfileAndRoleTX(t *testing.T) {
 
 	//Checking that the update took place
 	require.Equal(t, userUpdate.UserName, updatedResult.User.UserName)
-	require.Equal(t, userUpdate.Email, updatedResult.User.Email)
+	// A new email address waits for confirmation, see StartEmailChangeTx.
+	require.Equal(t, result.User.Email, updatedResult.User.Email)
 	require.Equal(t, userUpdate.Password, updatedResult.User.Password)
 	require.Equal(t, userProfileUpdate.FirstName, updatedResult.UserProfile.FirstName)
 	require.Equal(t, userProfileUpdate.LastName, updatedResult.UserProfile.LastName)
@@ -362,7 +397,6 @@ func TestUpdateUserWithProfileAndRoleTX(t *testing.T) {
 
 	//Now checking that update doesn't match the original anymore
 	require.NotEqual(t, result.User.UserName, updatedResult.User.UserName)
-	require.NotEqual(t, result.User.Email, updatedResult.User.Email)
 	require.NotEqual(t, result.User.Password, updatedResult.User.Password)
 	require.NotEqual(t, result.UserProfile.FirstName, updatedResult.UserProfile.FirstName)
 	require.NotEqual(t, result.UserProfile.LastName, updatedResult.UserProfile.LastName)
@@ -375,7 +409,7 @@ func TestUpdateUserWithProfileAndRoleTX(t *testing.T) {
 	require.NotEqual(t, result.UserRole.RoleID, updatedResult.UserRole.RoleID)
 
 	t.Cleanup(func() {
-		_, err = store.DeleteUserWithProfileAndRoleTX(context.Background(), result.User.ID)
+		_, err = store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: result.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
 		require.NoError(t, err)
 
 		_, err = store.GetUser(context.Background(), result.User.ID)
@@ -388,3 +422,98 @@ func TestUpdateUserWithProfileAndRoleTX(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+// createRandomUserTx creates a user with a profile and role through the store for tests that need all three.
+func createRandomUserTx(t *testing.T, store Store) UserTxResult {
+	result, err := store.CreateUserWithProfileAndRoleTx(context.Background(),
+		CreateUserParams{
+			UserName: util.RandomUserName(),
+			Email:    util.RandomEmail(),
+			Password: util.RandomPassword()},
+		CreateUserProfileParams{
+			FirstName:     util.RandomUserName(),
+			LastName:      util.RandomUserName(),
+			BusinessName:  util.RandomBusinessName(),
+			StreetAddress: util.RandomStreetAddress(),
+			City:          util.RandomString(6),
+			State:         util.RandomCountryCodeOrState(),
+			Zip:           util.RandomString(5),
+			CountryCode:   util.RandomCountryCodeOrState(),
+		},
+		CreateUserRoleParams{
+			RoleID: 1,
+		})
+	require.NoError(t, err)
+	require.NotEmpty(t, result)
+
+	return result
+}
+
+func TestRestoreUserWithProfileAndRoleTx(t *testing.T) {
+	store := NewStore(testDB)
+	result := createRandomUserTx(t, store)
+
+	deleted, err := store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: result.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
+	require.NoError(t, err)
+	require.True(t, deleted.User.DeletedAt.Valid)
+	require.True(t, deleted.UserProfile.DeletedAt.Valid)
+	require.True(t, deleted.UserRole.DeletedAt.Valid)
+
+	_, err = store.GetUserWithProfileAndRoleTX(context.Background(), result.User.ID)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	restored, err := store.RestoreUserWithProfileAndRoleTx(context.Background(), result.User.ID)
+	require.NoError(t, err)
+	require.False(t, restored.User.DeletedAt.Valid)
+	require.False(t, restored.UserProfile.DeletedAt.Valid)
+	require.False(t, restored.UserRole.DeletedAt.Valid)
+
+	fetched, err := store.GetUserWithProfileAndRoleTX(context.Background(), result.User.ID)
+	require.NoError(t, err)
+	require.Equal(t, result.User.ID, fetched.User.ID)
+
+	// Restoring a user that is not deleted is a not found
+	_, err = store.RestoreUserWithProfileAndRoleTx(context.Background(), result.User.ID)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	t.Cleanup(func() {
+		_, err = store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: result.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
+		require.NoError(t, err)
+	})
+}
+
+func TestDeleteUserWithoutProfileTX(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+
+	deleted, err := store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: user.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
+	require.NoError(t, err)
+	require.Equal(t, user.ID, deleted.User.ID)
+	require.Empty(t, deleted.UserProfile)
+	require.Empty(t, deleted.UserRole)
+}
+
+func TestPurgeDeletedUsersTx(t *testing.T) {
+	store := NewStore(testDB)
+	result := createRandomUserTx(t, store)
+
+	_, err := store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: result.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
+	require.NoError(t, err)
+
+	purged, err := store.PurgeDeletedUsersTx(context.Background(), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, purged, int64(1))
+
+	// The audit log keeps that the user existed, but none of their personal data.
+	events, err := store.ListAuditEventsForUser(context.Background(), result.User.ID)
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	for _, event := range events {
+		require.NotContains(t, string(event.Before)+string(event.After), result.User.Email)
+		require.NotContains(t, string(event.Before)+string(event.After), result.User.UserName)
+	}
+
+	// Once purged there is nothing left to restore
+	_, err = store.RestoreUserWithProfileAndRoleTx(context.Background(), result.User.ID)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+}
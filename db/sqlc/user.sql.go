@@ -7,13 +7,15 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (user_name, email, password)
-VALUES ($1, $2, $3) RETURNING id, user_name, email, password, created_at, updated_at, verified_at
+VALUES ($1, $2, $3) RETURNING id, user_name, email, password, created_at, updated_at, verified_at, version, deleted_at
 `
 
 type CreateUserParams struct {
@@ -33,18 +35,29 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const deleteUser = `-- name: DeleteUser :one
-DELETE
-FROM users
-WHERE id = $1 RETURNING id, user_name, email, password, created_at, updated_at, verified_at
+UPDATE users
+SET deleted_at = STATEMENT_TIMESTAMP()
+WHERE id = $1
+  AND deleted_at IS NULL
+  AND ($2::int IS NULL OR version = $2) RETURNING id, user_name, email, password, created_at, updated_at, verified_at, version, deleted_at
 `
 
-func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (User, error) {
-	row := q.db.QueryRowContext(ctx, deleteUser, id)
+type DeleteUserParams struct {
+	ID              uuid.UUID     `json:"id"`
+	ExpectedVersion sql.NullInt32 `json:"expected_version"`
+}
+
+// Soft deletes the user; the row is removed for good by PurgeDeletedUsers once the retention window passes.
+// expected_version is optional; when set the delete only applies if the row is still at that version.
+func (q *Queries) DeleteUser(ctx context.Context, arg DeleteUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, deleteUser, arg.ID, arg.ExpectedVersion)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -54,14 +67,17 @@ func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, user_name, email, password, created_at, updated_at, verified_at
+SELECT id, user_name, email, password, created_at, updated_at, verified_at, version, deleted_at
 FROM users
-WHERE id = $1 LIMIT 1
+WHERE id = $1
+  AND deleted_at IS NULL LIMIT 1
 `
 
 func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
@@ -75,14 +91,17 @@ func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, user_name, email, password, created_at, updated_at, verified_at
+SELECT id, user_name, email, password, created_at, updated_at, verified_at, version, deleted_at
 FROM users
-WHERE email = $1 LIMIT 1
+WHERE lower(email) = lower($1)
+  AND deleted_at IS NULL LIMIT 1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -96,24 +115,84 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getUserForUpdate = `-- name: GetUserForUpdate :one
+SELECT id, user_name, email, password, created_at, updated_at, verified_at, version, deleted_at
+FROM users
+WHERE id = $1
+LIMIT 1 FOR UPDATE
+`
+
+// Locks the row for the rest of the transaction. Soft-deleted rows are included so restores can be audited.
+func (q *Queries) GetUserForUpdate(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.UserName,
+		&i.Email,
+		&i.Password,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const getUserNameAndEmailTaken = `-- name: GetUserNameAndEmailTaken :one
+SELECT (EXISTS(SELECT 1 FROM users WHERE lower(user_name) = lower($1)) OR
+        EXISTS(SELECT 1
+               FROM user_name_reservations
+               WHERE lower(user_name) = lower($1)
+                 AND expires_at > now()))::bool                                     AS user_name_taken,
+       EXISTS(SELECT 1 FROM users WHERE lower(email) = lower($2))::bool     AS email_taken
+`
+
+type GetUserNameAndEmailTakenParams struct {
+	UserName string `json:"user_name"`
+	Email    string `json:"email"`
+}
+
+type GetUserNameAndEmailTakenRow struct {
+	UserNameTaken bool `json:"user_name_taken"`
+	EmailTaken    bool `json:"email_taken"`
+}
+
+// Checks both values the way the unique indexes do: case-insensitively and including soft-deleted users.
+// A user name reserved after a rename counts as taken.
+func (q *Queries) GetUserNameAndEmailTaken(ctx context.Context, arg GetUserNameAndEmailTakenParams) (GetUserNameAndEmailTakenRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserNameAndEmailTaken, arg.UserName, arg.Email)
+	var i GetUserNameAndEmailTakenRow
+	err := row.Scan(&i.UserNameTaken, &i.EmailTaken)
+	return i, err
+}
+
 const listUsers = `-- name: ListUsers :many
-SELECT id, user_name, email, password, created_at, updated_at, verified_at
+SELECT id, user_name, email, password, created_at, updated_at, verified_at, version, deleted_at
 FROM users
-ORDER BY id LIMIT $1
-OFFSET $2
+WHERE deleted_at IS NULL
+  AND ($1::timestamptz IS NULL
+    OR (created_at, id) > ($1::timestamptz, $2::uuid))
+ORDER BY created_at, id
+LIMIT $3
 `
 
 type ListUsersParams struct {
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+	CursorCreatedAt sql.NullTime  `json:"cursor_created_at"`
+	CursorID        uuid.NullUUID `json:"cursor_id"`
+	PageLimit       int32         `json:"page_limit"`
 }
 
+// Keyset pagination over (created_at, id). Leave the cursor null for the first page, then pass the last row's values.
 func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
-	rows, err := q.db.QueryContext(ctx, listUsers, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, listUsers, arg.CursorCreatedAt, arg.CursorID, arg.PageLimit)
 	if err != nil {
 		return nil, err
 	}
@@ -129,6 +208,8 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.VerifiedAt,
+			&i.Version,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -143,28 +224,88 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 	return items, nil
 }
 
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :many
+DELETE
+FROM users
+WHERE deleted_at < $1::timestamptz
+RETURNING id
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, purgeDeletedUsers, deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const restoreUser = `-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL
+WHERE id = $1
+  AND deleted_at IS NOT NULL RETURNING id, user_name, email, password, created_at, updated_at, verified_at, version, deleted_at
+`
+
+func (q *Queries) RestoreUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, restoreUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.UserName,
+		&i.Email,
+		&i.Password,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
-SET user_name  = $2,
-    email      = $3,
-    password   = $4,
+SET user_name  = $1,
+    email      = $2,
+    password   = $3,
+    version    = version + 1,
     updated_at = STATEMENT_TIMESTAMP()
-WHERE id = $1 RETURNING id, user_name, email, password, created_at, updated_at, verified_at
+WHERE id = $4
+  AND deleted_at IS NULL
+  AND ($5::int IS NULL OR version = $5) RETURNING id, user_name, email, password, created_at, updated_at, verified_at, version, deleted_at
 `
 
 type UpdateUserParams struct {
-	ID       uuid.UUID `json:"id"`
-	UserName string    `json:"user_name"`
-	Email    string    `json:"email"`
-	Password string    `json:"password"`
+	UserName        string        `json:"user_name"`
+	Email           string        `json:"email"`
+	Password        string        `json:"password"`
+	ID              uuid.UUID     `json:"id"`
+	ExpectedVersion sql.NullInt32 `json:"expected_version"`
 }
 
+// expected_version is optional; when set the update only applies if the row is still at that version.
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
 	row := q.db.QueryRowContext(ctx, updateUser,
-		arg.ID,
 		arg.UserName,
 		arg.Email,
 		arg.Password,
+		arg.ID,
+		arg.ExpectedVersion,
 	)
 	var i User
 	err := row.Scan(
@@ -175,6 +316,8 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,349 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+)
+
+// Address types accepted in user_addresses.type.
+const (
+	AddressTypeBilling  = "billing"
+	AddressTypeShipping = "shipping"
+	AddressTypeMailing  = "mailing"
+)
+
+// ErrDefaultAddressRequired is returned when a change would leave a user without a default address.
+// Another address has to be made the default first.
+var ErrDefaultAddressRequired = errors.New("the default address cannot be removed or unset")
+
+// addressLocation is the part of an address that is mirrored in the profile, in plaintext.
+type addressLocation struct {
+	StreetAddress string
+	City          string
+	State         string
+	Zip           string
+	CountryCode   string
+}
+
+func (address UserAddress) location() addressLocation {
+	return addressLocation{address.StreetAddress, address.City, address.State, address.Zip, address.CountryCode}
+}
+
+func (profile UserProfile) location() addressLocation {
+	return addressLocation{profile.StreetAddress, profile.City, profile.State, profile.Zip, profile.CountryCode}
+}
+
+// CreateUserAddressTx adds an address for a user.
+// The first address of a user becomes the default whatever IsDefault says. A new default takes the flag from
+// the previous one, and its location is copied into the profile.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The new address, in plaintext.
+// Returns:
+// - The created address.
+// - sql.ErrNoRows if the user does not exist or is deleted.
+func (store *SQLStore) CreateUserAddressTx(ctx context.Context, arg CreateUserAddressParams) (UserAddress, error) {
+	var result UserAddress
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		err := lockLiveUser(ctx, q, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.GetDefaultUserAddressForUpdate(ctx, arg.UserID)
+		if err == sql.ErrNoRows {
+			arg.IsDefault = true
+		} else if err != nil {
+			return err
+		} else if arg.IsDefault {
+			if err = unsetDefaultAddress(ctx, q, arg.UserID); err != nil {
+				return err
+			}
+		}
+
+		if err = store.encryptFields(addressFields(&arg.StreetAddress, &arg.Zip)); err != nil {
+			return err
+		}
+
+		result, err = q.CreateUserAddress(ctx, arg)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudit(ctx, q, AuditActionCreate, AuditTargetUserAddress, arg.UserID, nil, result)
+		if err != nil {
+			return err
+		}
+
+		if err = store.decryptAddress(&result); err != nil {
+			return err
+		}
+		if result.IsDefault {
+			if err = store.syncProfileAddress(ctx, q, arg.UserID, result.location()); err != nil {
+				return err
+			}
+		}
+
+		return recordUserUpdated(ctx, q, arg.UserID)
+	})
+
+	return result, err
+}
+
+// UpdateUserAddressTx replaces an address of a user.
+// Setting IsDefault moves the default flag to this address and copies its location into the profile;
+// clearing it on the current default is refused.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The address, in plaintext. ExpectedVersion is optional.
+// Returns:
+// - The updated address.
+// - sql.ErrNoRows if the user or address does not exist or ExpectedVersion did not match.
+// - ErrDefaultAddressRequired if the update would unset the default address.
+func (store *SQLStore) UpdateUserAddressTx(ctx context.Context, arg UpdateUserAddressParams) (UserAddress, error) {
+	var result UserAddress
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		err := lockLiveUser(ctx, q, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		before, err := q.GetUserAddressForUpdate(ctx, GetUserAddressForUpdateParams{ID: arg.ID, UserID: arg.UserID})
+		if err != nil {
+			return err
+		}
+
+		if before.IsDefault && !arg.IsDefault {
+			return ErrDefaultAddressRequired
+		}
+		if arg.IsDefault && !before.IsDefault {
+			if err = unsetDefaultAddress(ctx, q, arg.UserID); err != nil {
+				return err
+			}
+		}
+
+		err = store.reencryptFields(
+			addressFields(&arg.StreetAddress, &arg.Zip),
+			addressFields(&before.StreetAddress, &before.Zip))
+		if err != nil {
+			return err
+		}
+
+		result, err = q.UpdateUserAddress(ctx, arg)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudit(ctx, q, AuditActionUpdate, AuditTargetUserAddress, arg.UserID, before, result)
+		if err != nil {
+			return err
+		}
+
+		if err = store.decryptAddress(&result); err != nil {
+			return err
+		}
+		if result.IsDefault {
+			if err = store.syncProfileAddress(ctx, q, arg.UserID, result.location()); err != nil {
+				return err
+			}
+		}
+
+		return recordUserUpdated(ctx, q, arg.UserID)
+	})
+
+	return result, err
+}
+
+// DeleteUserAddressTx removes an address of a user. The default address cannot be removed.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The address to remove. ExpectedVersion is optional.
+// Returns:
+// - The removed address.
+// - sql.ErrNoRows if the user or address does not exist or ExpectedVersion did not match.
+// - ErrDefaultAddressRequired if the address is the default.
+func (store *SQLStore) DeleteUserAddressTx(ctx context.Context, arg DeleteUserAddressParams) (UserAddress, error) {
+	var result UserAddress
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		err := lockLiveUser(ctx, q, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		before, err := q.GetUserAddressForUpdate(ctx, GetUserAddressForUpdateParams{ID: arg.ID, UserID: arg.UserID})
+		if err != nil {
+			return err
+		}
+		if before.IsDefault {
+			return ErrDefaultAddressRequired
+		}
+
+		result, err = q.DeleteUserAddress(ctx, arg)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudit(ctx, q, AuditActionDelete, AuditTargetUserAddress, arg.UserID, before, nil)
+		if err != nil {
+			return err
+		}
+
+		return recordUserUpdated(ctx, q, arg.UserID)
+	})
+
+	if err == nil {
+		err = store.decryptAddress(&result)
+	}
+
+	return result, err
+}
+
+// lockLiveUser locks a user for the rest of the transaction, so changes to their addresses are serialized.
+// Returns sql.ErrNoRows if the user does not exist or is deleted.
+func lockLiveUser(ctx context.Context, q *Queries, userID uuid.UUID) error {
+	user, err := q.GetUserForUpdate(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.DeletedAt.Valid {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// unsetDefaultAddress clears the default flag of a user's default address, if there is one.
+func unsetDefaultAddress(ctx context.Context, q *Queries, userID uuid.UUID) error {
+	before, err := q.GetDefaultUserAddressForUpdate(ctx, userID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	after, err := q.UnsetDefaultUserAddress(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, q, AuditActionUpdate, AuditTargetUserAddress, userID, before, after)
+}
+
+// syncProfileAddress copies the location of the default address into the user's profile, as a new profile
+// version. Users without a live profile are left alone.
+func (store *SQLStore) syncProfileAddress(ctx context.Context, q *Queries, userID uuid.UUID, location addressLocation) error {
+	before, err := q.GetUserProfileForUpdate(ctx, userID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt.Valid {
+		return nil
+	}
+
+	profile := before
+	if err = store.decryptProfile(&profile); err != nil {
+		return err
+	}
+	if profile.location() == location {
+		return nil
+	}
+
+	arg, err := store.encryptUpdateProfileParams(UpdateUserProfileParams{
+		UserID:        userID,
+		FirstName:     profile.FirstName,
+		LastName:      profile.LastName,
+		BusinessName:  profile.BusinessName,
+		StreetAddress: location.StreetAddress,
+		City:          location.City,
+		State:         location.State,
+		Zip:           location.Zip,
+		CountryCode:   location.CountryCode,
+	}, before)
+	if err != nil {
+		return err
+	}
+
+	after, err := q.UpdateUserProfile(ctx, arg)
+	if err != nil {
+		return err
+	}
+
+	err = recordAudit(ctx, q, AuditActionUpdate, AuditTargetUserProfile, userID, before, after)
+	if err != nil {
+		return err
+	}
+
+	return recordUserProfileHistory(ctx, q, after)
+}
+
+// syncDefaultAddress copies the location of a profile into the user's default address, creating a default
+// mailing address when the user has none.
+func (store *SQLStore) syncDefaultAddress(ctx context.Context, q *Queries, userID uuid.UUID, location addressLocation) error {
+	before, err := q.GetDefaultUserAddressForUpdate(ctx, userID)
+	if err == sql.ErrNoRows {
+		arg := CreateUserAddressParams{
+			UserID:        userID,
+			Type:          AddressTypeMailing,
+			IsDefault:     true,
+			StreetAddress: location.StreetAddress,
+			City:          location.City,
+			State:         location.State,
+			Zip:           location.Zip,
+			CountryCode:   location.CountryCode,
+		}
+		if err = store.encryptFields(addressFields(&arg.StreetAddress, &arg.Zip)); err != nil {
+			return err
+		}
+
+		after, err := q.CreateUserAddress(ctx, arg)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, q, AuditActionCreate, AuditTargetUserAddress, userID, nil, after)
+	}
+	if err != nil {
+		return err
+	}
+
+	address := before
+	if err = store.decryptAddress(&address); err != nil {
+		return err
+	}
+	if address.location() == location {
+		return nil
+	}
+
+	arg := UpdateUserAddressParams{
+		ID:            before.ID,
+		UserID:        userID,
+		Type:          before.Type,
+		Label:         before.Label,
+		IsDefault:     true,
+		StreetAddress: location.StreetAddress,
+		City:          location.City,
+		State:         location.State,
+		Zip:           location.Zip,
+		CountryCode:   location.CountryCode,
+	}
+	err = store.reencryptFields(
+		addressFields(&arg.StreetAddress, &arg.Zip),
+		addressFields(&before.StreetAddress, &before.Zip))
+	if err != nil {
+		return err
+	}
+
+	after, err := q.UpdateUserAddress(ctx, arg)
+	if err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, q, AuditActionUpdate, AuditTargetUserAddress, userID, before, after)
+}
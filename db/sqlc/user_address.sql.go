@@ -0,0 +1,436 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: user_address.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createUserAddress = `-- name: CreateUserAddress :one
+INSERT INTO user_addresses (user_id,
+                            type,
+                            label,
+                            is_default,
+                            street_address,
+                            city,
+                            state,
+                            zip,
+                            country_code)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, user_id, type, label, is_default, street_address, city, state, zip, country_code, version, created_at, updated_at
+`
+
+type CreateUserAddressParams struct {
+	UserID        uuid.UUID `json:"user_id"`
+	Type          string    `json:"type"`
+	Label         string    `json:"label"`
+	IsDefault     bool      `json:"is_default"`
+	StreetAddress string    `json:"street_address"`
+	City          string    `json:"city"`
+	State         string    `json:"state"`
+	Zip           string    `json:"zip"`
+	CountryCode   string    `json:"country_code"`
+}
+
+func (q *Queries) CreateUserAddress(ctx context.Context, arg CreateUserAddressParams) (UserAddress, error) {
+	row := q.db.QueryRowContext(ctx, createUserAddress,
+		arg.UserID,
+		arg.Type,
+		arg.Label,
+		arg.IsDefault,
+		arg.StreetAddress,
+		arg.City,
+		arg.State,
+		arg.Zip,
+		arg.CountryCode,
+	)
+	var i UserAddress
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Type,
+		&i.Label,
+		&i.IsDefault,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteUserAddress = `-- name: DeleteUserAddress :one
+DELETE
+FROM user_addresses
+WHERE id = $1
+  AND user_id = $2
+  AND ($3::int IS NULL OR version = $3) RETURNING id, user_id, type, label, is_default, street_address, city, state, zip, country_code, version, created_at, updated_at
+`
+
+type DeleteUserAddressParams struct {
+	ID              uuid.UUID     `json:"id"`
+	UserID          uuid.UUID     `json:"user_id"`
+	ExpectedVersion sql.NullInt32 `json:"expected_version"`
+}
+
+// expected_version is optional; when set the delete only applies if the row is still at that version.
+func (q *Queries) DeleteUserAddress(ctx context.Context, arg DeleteUserAddressParams) (UserAddress, error) {
+	row := q.db.QueryRowContext(ctx, deleteUserAddress, arg.ID, arg.UserID, arg.ExpectedVersion)
+	var i UserAddress
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Type,
+		&i.Label,
+		&i.IsDefault,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteUserAddresses = `-- name: DeleteUserAddresses :execrows
+DELETE
+FROM user_addresses
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserAddresses(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserAddresses, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getDefaultUserAddressForUpdate = `-- name: GetDefaultUserAddressForUpdate :one
+SELECT id, user_id, type, label, is_default, street_address, city, state, zip, country_code, version, created_at, updated_at
+FROM user_addresses
+WHERE user_id = $1
+  AND is_default
+LIMIT 1 FOR UPDATE
+`
+
+// Locks the row for the rest of the transaction.
+func (q *Queries) GetDefaultUserAddressForUpdate(ctx context.Context, userID uuid.UUID) (UserAddress, error) {
+	row := q.db.QueryRowContext(ctx, getDefaultUserAddressForUpdate, userID)
+	var i UserAddress
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Type,
+		&i.Label,
+		&i.IsDefault,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getUserAddress = `-- name: GetUserAddress :one
+SELECT id, user_id, type, label, is_default, street_address, city, state, zip, country_code, version, created_at, updated_at
+FROM user_addresses
+WHERE id = $1
+  AND user_id = $2 LIMIT 1
+`
+
+type GetUserAddressParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetUserAddress(ctx context.Context, arg GetUserAddressParams) (UserAddress, error) {
+	row := q.db.QueryRowContext(ctx, getUserAddress, arg.ID, arg.UserID)
+	var i UserAddress
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Type,
+		&i.Label,
+		&i.IsDefault,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getUserAddressForUpdate = `-- name: GetUserAddressForUpdate :one
+SELECT id, user_id, type, label, is_default, street_address, city, state, zip, country_code, version, created_at, updated_at
+FROM user_addresses
+WHERE id = $1
+  AND user_id = $2
+LIMIT 1 FOR UPDATE
+`
+
+type GetUserAddressForUpdateParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// Locks the row for the rest of the transaction.
+func (q *Queries) GetUserAddressForUpdate(ctx context.Context, arg GetUserAddressForUpdateParams) (UserAddress, error) {
+	row := q.db.QueryRowContext(ctx, getUserAddressForUpdate, arg.ID, arg.UserID)
+	var i UserAddress
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Type,
+		&i.Label,
+		&i.IsDefault,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listUserAddresses = `-- name: ListUserAddresses :many
+SELECT id, user_id, type, label, is_default, street_address, city, state, zip, country_code, version, created_at, updated_at
+FROM user_addresses
+WHERE user_id = $1
+ORDER BY is_default DESC, created_at, id
+`
+
+// The default address comes first, then the others oldest first.
+func (q *Queries) ListUserAddresses(ctx context.Context, userID uuid.UUID) ([]UserAddress, error) {
+	rows, err := q.db.QueryContext(ctx, listUserAddresses, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UserAddress{}
+	for rows.Next() {
+		var i UserAddress
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Type,
+			&i.Label,
+			&i.IsDefault,
+			&i.StreetAddress,
+			&i.City,
+			&i.State,
+			&i.Zip,
+			&i.CountryCode,
+			&i.Version,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserAddressesForKeyRotation = `-- name: ListUserAddressesForKeyRotation :many
+SELECT id, street_address, zip
+FROM user_addresses
+WHERE id > $1
+ORDER BY id
+LIMIT $2 FOR UPDATE
+`
+
+type ListUserAddressesForKeyRotationParams struct {
+	AfterID   uuid.UUID `json:"after_id"`
+	PageLimit int32     `json:"page_limit"`
+}
+
+type ListUserAddressesForKeyRotationRow struct {
+	ID            uuid.UUID `json:"id"`
+	StreetAddress string    `json:"street_address"`
+	Zip           string    `json:"zip"`
+}
+
+// Keyset pagination over id. Locks the page for the rest of the transaction.
+func (q *Queries) ListUserAddressesForKeyRotation(ctx context.Context, arg ListUserAddressesForKeyRotationParams) ([]ListUserAddressesForKeyRotationRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserAddressesForKeyRotation, arg.AfterID, arg.PageLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUserAddressesForKeyRotationRow{}
+	for rows.Next() {
+		var i ListUserAddressesForKeyRotationRow
+		if err := rows.Scan(&i.ID, &i.StreetAddress, &i.Zip); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedUserAddresses = `-- name: PurgeDeletedUserAddresses :execrows
+DELETE
+FROM user_addresses
+WHERE user_id IN (SELECT id FROM users WHERE users.deleted_at < $1::timestamptz)
+`
+
+// Removes the addresses of users that are being purged so the users can be deleted afterwards.
+func (q *Queries) PurgeDeletedUserAddresses(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUserAddresses, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unsetDefaultUserAddress = `-- name: UnsetDefaultUserAddress :one
+UPDATE user_addresses
+SET is_default = false,
+    version    = version + 1,
+    updated_at = STATEMENT_TIMESTAMP()
+WHERE user_id = $1
+  AND is_default RETURNING id, user_id, type, label, is_default, street_address, city, state, zip, country_code, version, created_at, updated_at
+`
+
+// Clears the default flag so another address can take it; the partial unique index allows only one per user.
+func (q *Queries) UnsetDefaultUserAddress(ctx context.Context, userID uuid.UUID) (UserAddress, error) {
+	row := q.db.QueryRowContext(ctx, unsetDefaultUserAddress, userID)
+	var i UserAddress
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Type,
+		&i.Label,
+		&i.IsDefault,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const updateUserAddress = `-- name: UpdateUserAddress :one
+UPDATE user_addresses
+SET type           = $1,
+    label          = $2,
+    is_default     = $3,
+    street_address = $4,
+    city           = $5,
+    state          = $6,
+    zip            = $7,
+    country_code   = $8,
+    version        = version + 1,
+    updated_at     = STATEMENT_TIMESTAMP()
+WHERE id = $9
+  AND user_id = $10
+  AND ($11::int IS NULL OR version = $11) RETURNING id, user_id, type, label, is_default, street_address, city, state, zip, country_code, version, created_at, updated_at
+`
+
+type UpdateUserAddressParams struct {
+	Type            string        `json:"type"`
+	Label           string        `json:"label"`
+	IsDefault       bool          `json:"is_default"`
+	StreetAddress   string        `json:"street_address"`
+	City            string        `json:"city"`
+	State           string        `json:"state"`
+	Zip             string        `json:"zip"`
+	CountryCode     string        `json:"country_code"`
+	ID              uuid.UUID     `json:"id"`
+	UserID          uuid.UUID     `json:"user_id"`
+	ExpectedVersion sql.NullInt32 `json:"expected_version"`
+}
+
+// expected_version is optional; when set the update only applies if the row is still at that version.
+func (q *Queries) UpdateUserAddress(ctx context.Context, arg UpdateUserAddressParams) (UserAddress, error) {
+	row := q.db.QueryRowContext(ctx, updateUserAddress,
+		arg.Type,
+		arg.Label,
+		arg.IsDefault,
+		arg.StreetAddress,
+		arg.City,
+		arg.State,
+		arg.Zip,
+		arg.CountryCode,
+		arg.ID,
+		arg.UserID,
+		arg.ExpectedVersion,
+	)
+	var i UserAddress
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Type,
+		&i.Label,
+		&i.IsDefault,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const updateUserAddressEncryption = `-- name: UpdateUserAddressEncryption :exec
+UPDATE user_addresses
+SET street_address = $1,
+    zip            = $2
+WHERE id = $3
+`
+
+type UpdateUserAddressEncryptionParams struct {
+	StreetAddress string    `json:"street_address"`
+	Zip           string    `json:"zip"`
+	ID            uuid.UUID `json:"id"`
+}
+
+// Rewrites the encrypted columns without a new version: the values themselves are unchanged.
+func (q *Queries) UpdateUserAddressEncryption(ctx context.Context, arg UpdateUserAddressEncryptionParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserAddressEncryption, arg.StreetAddress, arg.Zip, arg.ID)
+	return err
+}
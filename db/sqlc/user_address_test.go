@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"whaleWake/util"
+)
+
+func TestUserAddressDefaultSync(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+	userID := created.User.ID
+
+	// A new user gets their profile address as the default mailing address.
+	addresses, err := store.ListUserAddresses(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, addresses, 1)
+	mailing := addresses[0]
+	require.True(t, mailing.IsDefault)
+	require.Equal(t, AddressTypeMailing, mailing.Type)
+	require.Equal(t, created.UserProfile.StreetAddress, mailing.StreetAddress)
+	require.Equal(t, created.UserProfile.Zip, mailing.Zip)
+
+	shipping, err := store.CreateUserAddressTx(context.Background(), CreateUserAddressParams{
+		UserID:        userID,
+		Type:          AddressTypeShipping,
+		Label:         "Office",
+		IsDefault:     true,
+		StreetAddress: util.RandomStreetAddress(),
+		City:          util.RandomString(6),
+		State:         util.RandomCountryCodeOrState(),
+		Zip:           util.RandomString(5),
+		CountryCode:   util.RandomCountryCodeOrState(),
+	})
+	require.NoError(t, err)
+	require.True(t, shipping.IsDefault)
+
+	// The new default moved the flag and its location into the profile.
+	mailing, err = store.GetUserAddress(context.Background(), GetUserAddressParams{ID: mailing.ID, UserID: userID})
+	require.NoError(t, err)
+	require.False(t, mailing.IsDefault)
+
+	profile, err := store.GetUserProfile(context.Background(), userID)
+	require.NoError(t, err)
+	require.Equal(t, shipping.StreetAddress, profile.StreetAddress)
+	require.Equal(t, shipping.City, profile.City)
+	require.Equal(t, created.UserProfile.Version+1, profile.Version)
+
+	// A profile update moves the default address with it.
+	updated, err := store.UpdateUserWithProfileAndRoleTX(context.Background(),
+		UpdateUserParams{
+			ID:       userID,
+			UserName: created.User.UserName,
+			Email:    created.User.Email,
+			Password: created.User.Password,
+		},
+		UpdateUserProfileParams{
+			FirstName:     profile.FirstName,
+			LastName:      profile.LastName,
+			BusinessName:  profile.BusinessName,
+			StreetAddress: util.RandomStreetAddress(),
+			City:          profile.City,
+			State:         profile.State,
+			Zip:           profile.Zip,
+			CountryCode:   profile.CountryCode,
+		},
+		UpdateUserRoleParams{RoleID: created.UserRole.RoleID}, nil)
+	require.NoError(t, err)
+
+	shipping, err = store.GetUserAddress(context.Background(), GetUserAddressParams{ID: shipping.ID, UserID: userID})
+	require.NoError(t, err)
+	require.Equal(t, updated.UserProfile.StreetAddress, shipping.StreetAddress)
+	require.Equal(t, "Office", shipping.Label)
+
+	_, err = store.DeleteUserAddressTx(context.Background(), DeleteUserAddressParams{ID: shipping.ID, UserID: userID})
+	require.ErrorIs(t, err, ErrDefaultAddressRequired)
+
+	_, err = store.UpdateUserAddressTx(context.Background(), UpdateUserAddressParams{
+		ID:            shipping.ID,
+		UserID:        userID,
+		Type:          shipping.Type,
+		StreetAddress: shipping.StreetAddress,
+		City:          shipping.City,
+		State:         shipping.State,
+		Zip:           shipping.Zip,
+		CountryCode:   shipping.CountryCode,
+	})
+	require.ErrorIs(t, err, ErrDefaultAddressRequired)
+
+	deleted, err := store.DeleteUserAddressTx(context.Background(), DeleteUserAddressParams{ID: mailing.ID, UserID: userID})
+	require.NoError(t, err)
+	require.Equal(t, mailing.ID, deleted.ID)
+
+	addresses, err = store.ListUserAddresses(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, addresses, 1)
+}
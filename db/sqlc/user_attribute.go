@@ -0,0 +1,141 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"sort"
+)
+
+// Types of custom attribute values, stored in attribute_definitions.type.
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeInteger = "integer"
+	AttributeTypeBoolean = "boolean"
+	AttributeTypeDate    = "date"
+)
+
+// UserAttributeValue is a new value for one custom attribute of a user.
+// Fields:
+// - DefinitionID: The attribute definition the value is for.
+// - Value: The JSON value, already validated against the definition. A nil value removes the attribute.
+type UserAttributeValue struct {
+	DefinitionID uuid.UUID
+	Value        json.RawMessage
+}
+
+// setUserAttributes stores or removes some of a user's attribute values within the caller's transaction,
+// recorded as a single audit event when anything changed.
+// Parameters:
+// - ctx: The context carrying the actor, see WithActor.
+// - q: The queries bound to the current transaction.
+// - action: The audit action of the change, AuditActionCreate for a new user.
+// - userID: The user whose attributes change.
+// - values: The values to set. Attributes not listed are left as they are.
+// Returns:
+// - Every attribute value of the user after the change, ordered by key.
+// - An error if a query fails, e.g. a foreign key violation when a definition has been deleted meanwhile.
+func setUserAttributes(ctx context.Context, q *Queries, action string, userID uuid.UUID, values []UserAttributeValue) ([]ListUserAttributesRow, error) {
+	before, err := q.ListUserAttributes(ctx, userID)
+	if err != nil || len(values) == 0 {
+		return before, err
+	}
+
+	// Apply the changes in definition order, so concurrent changes to the same user touch rows in the same order.
+	values = append([]UserAttributeValue(nil), values...)
+	sort.Slice(values, func(i, j int) bool {
+		return bytes.Compare(values[i].DefinitionID[:], values[j].DefinitionID[:]) < 0
+	})
+
+	for _, value := range values {
+		if value.Value == nil {
+			_, err = q.DeleteUserAttribute(ctx, DeleteUserAttributeParams{UserID: userID, DefinitionID: value.DefinitionID})
+		} else {
+			_, err = q.UpsertUserAttribute(ctx, UpsertUserAttributeParams{UserID: userID, DefinitionID: value.DefinitionID, Value: value.Value})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	after, err := q.ListUserAttributes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The values are audited under a single "attributes" field, since the keys are chosen by admins and could
+	// clash with the fields erasure scrubs by name.
+	err = recordAudit(ctx, q, action, AuditTargetUserAttributes, userID,
+		map[string]interface{}{"attributes": UserAttributeMap(before)},
+		map[string]interface{}{"attributes": UserAttributeMap(after)})
+	return after, err
+}
+
+// DeleteAttributeDefinitionTx removes an attribute definition and every user's value of it. The values of live
+// users are removed first, so each of them gets an audit event and a user.updated event; the values of deleted
+// users go with the definition.
+// Parameters:
+// - ctx: The context for the transaction.
+// - id: The attribute definition to remove.
+// Returns:
+// - The removed definition.
+// - sql.ErrNoRows if the definition does not exist.
+func (store *SQLStore) DeleteAttributeDefinitionTx(ctx context.Context, id uuid.UUID) (AttributeDefinition, error) {
+	var result AttributeDefinition
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		userIDs, err := q.ListLiveUsersWithAttributeForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		for _, userID := range userIDs {
+			_, err = setUserAttributes(ctx, q, AuditActionUpdate, userID, []UserAttributeValue{{DefinitionID: id}})
+			if err != nil {
+				return err
+			}
+			if err = recordUserUpdated(ctx, q, userID); err != nil {
+				return err
+			}
+		}
+
+		result, err = q.DeleteAttributeDefinition(ctx, id)
+		return err
+	})
+
+	return result, err
+}
+
+// UserAttributeMap maps the keys of a user's attributes to their values.
+func UserAttributeMap(attributes []ListUserAttributesRow) map[string]json.RawMessage {
+	values := make(map[string]json.RawMessage, len(attributes))
+	for _, attribute := range attributes {
+		values[attribute.Key] = attribute.Value
+	}
+	return values
+}
+
+// loadListAttributes fills in the Attributes of each row with one query.
+func loadListAttributes(ctx context.Context, q *Queries, rows []*UserListRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	userIDs := make([]uuid.UUID, len(rows))
+	byID := make(map[uuid.UUID]*UserListRow, len(rows))
+	for i, row := range rows {
+		userIDs[i] = row.User.ID
+		byID[row.User.ID] = row
+		row.Attributes = map[string]json.RawMessage{}
+	}
+
+	attributes, err := q.ListUsersAttributes(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	for _, attribute := range attributes {
+		byID[attribute.UserID].Attributes[attribute.Key] = attribute.Value
+	}
+	return nil
+}
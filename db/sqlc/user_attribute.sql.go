@@ -0,0 +1,206 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: user_attribute.sql
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const deleteUserAttribute = `-- name: DeleteUserAttribute :execrows
+DELETE
+FROM user_attributes
+WHERE user_id = $1
+  AND definition_id = $2
+`
+
+type DeleteUserAttributeParams struct {
+	UserID       uuid.UUID `json:"user_id"`
+	DefinitionID uuid.UUID `json:"definition_id"`
+}
+
+func (q *Queries) DeleteUserAttribute(ctx context.Context, arg DeleteUserAttributeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserAttribute, arg.UserID, arg.DefinitionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteUserAttributes = `-- name: DeleteUserAttributes :execrows
+DELETE
+FROM user_attributes
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserAttributes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserAttributes, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listLiveUsersWithAttributeForUpdate = `-- name: ListLiveUsersWithAttributeForUpdate :many
+SELECT u.id
+FROM users u
+         JOIN user_attributes ua ON ua.user_id = u.id
+WHERE ua.definition_id = $1
+  AND u.deleted_at IS NULL
+ORDER BY u.id
+    FOR UPDATE OF u
+`
+
+// The live users with a value for an attribute, locked in id order for the rest of the transaction.
+func (q *Queries) ListLiveUsersWithAttributeForUpdate(ctx context.Context, definitionID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listLiveUsersWithAttributeForUpdate, definitionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserAttributes = `-- name: ListUserAttributes :many
+SELECT ua.definition_id, d.key, ua.value, ua.updated_at
+FROM user_attributes ua
+         JOIN attribute_definitions d ON d.id = ua.definition_id
+WHERE ua.user_id = $1
+ORDER BY d.key
+`
+
+type ListUserAttributesRow struct {
+	DefinitionID uuid.UUID       `json:"definition_id"`
+	Key          string          `json:"key"`
+	Value        json.RawMessage `json:"value"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+func (q *Queries) ListUserAttributes(ctx context.Context, userID uuid.UUID) ([]ListUserAttributesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserAttributes, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUserAttributesRow{}
+	for rows.Next() {
+		var i ListUserAttributesRow
+		if err := rows.Scan(
+			&i.DefinitionID,
+			&i.Key,
+			&i.Value,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersAttributes = `-- name: ListUsersAttributes :many
+SELECT ua.user_id, d.key, ua.value
+FROM user_attributes ua
+         JOIN attribute_definitions d ON d.id = ua.definition_id
+WHERE ua.user_id = ANY ($1::uuid[])
+ORDER BY ua.user_id, d.key
+`
+
+type ListUsersAttributesRow struct {
+	UserID uuid.UUID       `json:"user_id"`
+	Key    string          `json:"key"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// The attribute values of several users at once, for listings and exports.
+func (q *Queries) ListUsersAttributes(ctx context.Context, userIds []uuid.UUID) ([]ListUsersAttributesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersAttributes, pq.Array(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUsersAttributesRow{}
+	for rows.Next() {
+		var i ListUsersAttributesRow
+		if err := rows.Scan(&i.UserID, &i.Key, &i.Value); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedUserAttributes = `-- name: PurgeDeletedUserAttributes :execrows
+DELETE
+FROM user_attributes
+WHERE user_id IN (SELECT id FROM users WHERE users.deleted_at < $1::timestamptz)
+`
+
+// Removes the attribute values of users that are being purged so the users can be deleted afterwards.
+func (q *Queries) PurgeDeletedUserAttributes(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUserAttributes, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const upsertUserAttribute = `-- name: UpsertUserAttribute :one
+INSERT INTO user_attributes (user_id, definition_id, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, definition_id) DO UPDATE
+    SET value      = excluded.value,
+        updated_at = STATEMENT_TIMESTAMP()
+RETURNING user_id, definition_id, value, updated_at
+`
+
+type UpsertUserAttributeParams struct {
+	UserID       uuid.UUID       `json:"user_id"`
+	DefinitionID uuid.UUID       `json:"definition_id"`
+	Value        json.RawMessage `json:"value"`
+}
+
+func (q *Queries) UpsertUserAttribute(ctx context.Context, arg UpsertUserAttributeParams) (UserAttribute, error) {
+	row := q.db.QueryRowContext(ctx, upsertUserAttribute, arg.UserID, arg.DefinitionID, arg.Value)
+	var i UserAttribute
+	err := row.Scan(
+		&i.UserID,
+		&i.DefinitionID,
+		&i.Value,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"whaleWake/util"
+)
+
+func createRandomAttributeDefinition(t *testing.T, store Store, attributeType string) AttributeDefinition {
+	definition, err := store.CreateAttributeDefinition(context.Background(), CreateAttributeDefinitionParams{
+		Key:        "attr_" + util.RandomString(10),
+		Label:      util.RandomString(8),
+		Type:       attributeType,
+		EnumValues: []string{},
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_, _ = store.DeleteAttributeDefinition(context.Background(), definition.ID)
+	})
+	return definition
+}
+
+func TestUserAttributes(t *testing.T) {
+	store := NewStore(testDB)
+	license := createRandomAttributeDefinition(t, store, AttributeTypeString)
+	tier := createRandomAttributeDefinition(t, store, AttributeTypeInteger)
+
+	created, err := store.CreateUserWithProfileAndRoleTx(context.Background(),
+		CreateUserParams{UserName: util.RandomUserName(), Email: util.RandomEmail(), Password: util.RandomPassword()},
+		CreateUserProfileParams{FirstName: util.RandomUserName(), LastName: util.RandomUserName(), CountryCode: "US"},
+		CreateUserRoleParams{RoleID: 1},
+		UserAttributeValue{DefinitionID: license.ID, Value: json.RawMessage(`"LN-1"`)},
+		UserAttributeValue{DefinitionID: tier.ID, Value: json.RawMessage(`2`)},
+	)
+	require.NoError(t, err)
+	require.Equal(t, map[string]json.RawMessage{license.Key: json.RawMessage(`"LN-1"`), tier.Key: json.RawMessage(`2`)},
+		UserAttributeMap(created.Attributes))
+
+	updated, err := store.UpdateUserWithProfileAndRoleTX(context.Background(),
+		UpdateUserParams{ID: created.User.ID, UserName: created.User.UserName, Email: created.User.Email, Password: created.User.Password},
+		UpdateUserProfileParams{FirstName: created.UserProfile.FirstName, LastName: created.UserProfile.LastName, CountryCode: "US"},
+		UpdateUserRoleParams{RoleID: 1},
+		nil,
+		UserAttributeValue{DefinitionID: tier.ID},
+	)
+	require.NoError(t, err)
+	require.Equal(t, map[string]json.RawMessage{license.Key: json.RawMessage(`"LN-1"`)}, UserAttributeMap(updated.Attributes))
+
+	fetched, err := store.GetUserWithProfileAndRoleTX(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.Equal(t, updated.Attributes, fetched.Attributes)
+
+	result, err := store.SearchUsersTx(context.Background(), UserListFilter{Search: created.User.UserName, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, result.Rows, 1)
+	require.Equal(t, map[string]json.RawMessage{license.Key: json.RawMessage(`"LN-1"`)}, result.Rows[0].Attributes)
+
+	events, err := store.ListAuditEventsForUser(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	event := events[len(events)-1]
+	require.Equal(t, AuditTargetUserAttributes, event.TargetType)
+	require.JSONEq(t, `{"attributes": {"`+license.Key+`": "LN-1", "`+tier.Key+`": 2}}`, string(event.Before))
+
+	// Deleting the definition deletes the values, as a change to each user.
+	_, err = store.DeleteAttributeDefinitionTx(context.Background(), license.ID)
+	require.NoError(t, err)
+	attributes, err := store.ListUserAttributes(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.Empty(t, attributes)
+
+	events, err = store.ListAuditEventsForUser(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"attributes": {}}`, string(events[len(events)-1].After))
+
+	outbox, err := store.ListOutboxEventsForUser(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.Equal(t, EventUserUpdated, outbox[len(outbox)-1].EventType)
+	require.Len(t, outbox, 3)
+}
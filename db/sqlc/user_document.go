@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+)
+
+// CreateUserDocumentTx records a document of a user. The blob has to be stored under arg.ObjectKey first.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The document to record.
+// Returns:
+// - The new document.
+// - sql.ErrNoRows if the user does not exist or is deleted.
+func (store *SQLStore) CreateUserDocumentTx(ctx context.Context, arg CreateUserDocumentParams) (UserDocument, error) {
+	var result UserDocument
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		err := lockLiveUser(ctx, q, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		result, err = q.CreateUserDocument(ctx, arg)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, q, AuditActionCreate, AuditTargetUserDocument, arg.UserID, nil, result)
+	})
+
+	return result, err
+}
+
+// DeleteUserDocumentTx removes a document of a user and queues its blob for deletion.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The document to remove.
+// Returns:
+// - The removed document.
+// - sql.ErrNoRows if the user or document does not exist.
+func (store *SQLStore) DeleteUserDocumentTx(ctx context.Context, arg DeleteUserDocumentParams) (UserDocument, error) {
+	var result UserDocument
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		err := lockLiveUser(ctx, q, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		result, err = q.DeleteUserDocument(ctx, arg)
+		if err != nil {
+			return err
+		}
+
+		if err = queueBlobDeletions(ctx, q, []string{result.ObjectKey}); err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, q, AuditActionDelete, AuditTargetUserDocument, arg.UserID, result, nil)
+	})
+
+	return result, err
+}
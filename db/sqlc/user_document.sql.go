@@ -0,0 +1,200 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: user_document.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createUserDocument = `-- name: CreateUserDocument :one
+INSERT INTO user_documents (user_id, name, content_type, size_bytes, object_key)
+VALUES ($1, $2, $3, $4, $5) RETURNING id, user_id, name, content_type, size_bytes, object_key, created_at
+`
+
+type CreateUserDocumentParams struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	ObjectKey   string    `json:"object_key"`
+}
+
+func (q *Queries) CreateUserDocument(ctx context.Context, arg CreateUserDocumentParams) (UserDocument, error) {
+	row := q.db.QueryRowContext(ctx, createUserDocument,
+		arg.UserID,
+		arg.Name,
+		arg.ContentType,
+		arg.SizeBytes,
+		arg.ObjectKey,
+	)
+	var i UserDocument
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.ContentType,
+		&i.SizeBytes,
+		&i.ObjectKey,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteUserDocument = `-- name: DeleteUserDocument :one
+DELETE
+FROM user_documents
+WHERE id = $1
+  AND user_id = $2 RETURNING id, user_id, name, content_type, size_bytes, object_key, created_at
+`
+
+type DeleteUserDocumentParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) DeleteUserDocument(ctx context.Context, arg DeleteUserDocumentParams) (UserDocument, error) {
+	row := q.db.QueryRowContext(ctx, deleteUserDocument, arg.ID, arg.UserID)
+	var i UserDocument
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.ContentType,
+		&i.SizeBytes,
+		&i.ObjectKey,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteUserDocuments = `-- name: DeleteUserDocuments :many
+DELETE
+FROM user_documents
+WHERE user_id = $1 RETURNING object_key
+`
+
+// Removes all documents of a user and returns their keys, so the blobs can be queued for deletion.
+func (q *Queries) DeleteUserDocuments(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, deleteUserDocuments, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var object_key string
+		if err := rows.Scan(&object_key); err != nil {
+			return nil, err
+		}
+		items = append(items, object_key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserDocument = `-- name: GetUserDocument :one
+SELECT id, user_id, name, content_type, size_bytes, object_key, created_at
+FROM user_documents
+WHERE id = $1
+  AND user_id = $2
+`
+
+type GetUserDocumentParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetUserDocument(ctx context.Context, arg GetUserDocumentParams) (UserDocument, error) {
+	row := q.db.QueryRowContext(ctx, getUserDocument, arg.ID, arg.UserID)
+	var i UserDocument
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.ContentType,
+		&i.SizeBytes,
+		&i.ObjectKey,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listUserDocuments = `-- name: ListUserDocuments :many
+SELECT id, user_id, name, content_type, size_bytes, object_key, created_at
+FROM user_documents
+WHERE user_id = $1
+ORDER BY created_at, id
+`
+
+func (q *Queries) ListUserDocuments(ctx context.Context, userID uuid.UUID) ([]UserDocument, error) {
+	rows, err := q.db.QueryContext(ctx, listUserDocuments, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UserDocument{}
+	for rows.Next() {
+		var i UserDocument
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.ContentType,
+			&i.SizeBytes,
+			&i.ObjectKey,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedUserDocuments = `-- name: PurgeDeletedUserDocuments :many
+DELETE
+FROM user_documents
+WHERE user_id IN (SELECT id FROM users WHERE users.deleted_at < $1::timestamptz)
+RETURNING object_key
+`
+
+// Removes the documents of users that are being purged so the users can be deleted afterwards.
+func (q *Queries) PurgeDeletedUserDocuments(ctx context.Context, deletedBefore time.Time) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, purgeDeletedUserDocuments, deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var object_key string
+		if err := rows.Scan(&object_key); err != nil {
+			return nil, err
+		}
+		items = append(items, object_key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// userExportBatchSize is how many rows each FETCH reads from the export cursor.
+const userExportBatchSize = 1000
+
+// userExportColumns are userListColumns with the password hash replaced by an empty string, so it never
+// leaves the database.
+const userExportColumns = `u.id, u.user_name, u.email, '' AS password, u.created_at, u.updated_at, u.verified_at, u.version, u.deleted_at,
+       p.first_name, p.last_name, p.business_name, p.street_address, p.city, p.state, p.zip, p.country_code, r.role_id`
+
+// ExportUsersTx passes every user matching a filter to fn, in the filter's sort order.
+// The rows are read through a server-side cursor a batch at a time, so memory use stays flat however many
+// users match. The cursor and limit of the filter are ignored, and Password is always empty.
+// Parameters:
+// - ctx: The context for the transaction.
+// - filter: The filters and sort order, as for SearchUsersTx.
+// - fn: Called once per row. Returning an error stops the export.
+// Returns:
+// - An error if the sort field is unknown, the query fails, or fn fails.
+func (store *SQLStore) ExportUsersTx(ctx context.Context, filter UserListFilter, fn func(UserListRow) error) error {
+	column, err := userSortColumn(filter.Sort, store.fields)
+	if err != nil {
+		return err
+	}
+
+	where, args := userListWhere(filter, store.fields)
+
+	direction := "ASC"
+	if filter.Desc {
+		direction = "DESC"
+	}
+
+	query := "DECLARE user_export NO SCROLL CURSOR FOR\nSELECT " + userExportColumns +
+		userListFrom +
+		"\nWHERE " + strings.Join(where, "\n  AND ") +
+		fmt.Sprintf("\nORDER BY %s %s, u.id %s", column.expr, direction, direction)
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM user_export", userExportBatchSize)
+
+	return store.execTx(ctx, func(q *Queries) error {
+		// The cursor lives until the transaction ends, so it does not need closing.
+		if _, err := q.db.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+
+		for {
+			rows, err := q.db.QueryContext(ctx, fetch)
+			if err != nil {
+				return err
+			}
+
+			var batch []UserListRow
+			for rows.Next() {
+				var i UserListRow
+				if err := rows.Scan(i.scanDest()...); err != nil {
+					rows.Close()
+					return err
+				}
+				if err := store.decryptListRow(&i); err != nil {
+					rows.Close()
+					return err
+				}
+				batch = append(batch, i)
+			}
+			if err := rows.Close(); err != nil {
+				return err
+			}
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			// The attributes are loaded per batch, once the cursor's rows have been read.
+			page := make([]*UserListRow, len(batch))
+			for i := range batch {
+				page[i] = &batch[i]
+			}
+			if err := loadListAttributes(ctx, q, page); err != nil {
+				return err
+			}
+			for _, row := range batch {
+				if err := fn(row); err != nil {
+					return err
+				}
+			}
+
+			if len(batch) < userExportBatchSize {
+				return nil
+			}
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"whaleWake/util"
+)
+
+func TestExportUsersTx(t *testing.T) {
+	store := NewStore(testDB)
+
+	businessName := "Export " + util.RandomString(12)
+	var created []uuid.UUID
+	for i := 0; i < 3; i++ {
+		result, err := store.CreateUserWithProfileAndRoleTx(context.Background(),
+			CreateUserParams{
+				UserName: util.RandomUserName(),
+				Email:    util.RandomEmail(),
+				Password: util.RandomPassword()},
+			CreateUserProfileParams{
+				FirstName:     util.RandomUserName(),
+				LastName:      util.RandomUserName(),
+				BusinessName:  businessName,
+				StreetAddress: util.RandomStreetAddress(),
+				City:          util.RandomUserName(),
+				State:         util.RandomCountryCodeOrState(),
+				Zip:           util.RandomString(5),
+				CountryCode:   util.RandomCountryCodeOrState(),
+			},
+			CreateUserRoleParams{RoleID: 1})
+		require.NoError(t, err)
+		created = append(created, result.User.ID)
+	}
+
+	var exported []UserListRow
+	err := store.ExportUsersTx(context.Background(), UserListFilter{BusinessName: businessName}, func(row UserListRow) error {
+		exported = append(exported, row)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, exported, 3)
+	for i, row := range exported {
+		require.Equal(t, created[i], row.User.ID)
+		require.Empty(t, row.User.Password)
+		require.Equal(t, businessName, row.BusinessName.String)
+		require.NotEmpty(t, row.StreetAddress.String)
+		require.Equal(t, int32(1), row.RoleID.Int32)
+	}
+
+	// An error from the callback stops the export and is returned
+	stop := errors.New("stop")
+	calls := 0
+	err = store.ExportUsersTx(context.Background(), UserListFilter{BusinessName: businessName}, func(row UserListRow) error {
+		calls++
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,320 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// Sort fields accepted by SearchUsersTx.
+const (
+	UserSortCreatedAt = "created_at"
+	UserSortUpdatedAt = "updated_at"
+	UserSortUserName  = "user_name"
+	UserSortEmail     = "email"
+	UserSortLastName  = "last_name"
+)
+
+// sortColumn is the expression a sort field orders by and the type its cursor value is cast to.
+// field is set for columns that order by a blind index; the cursor value is then indexed the same way.
+type sortColumn struct {
+	expr  string
+	cast  string
+	field string
+}
+
+// userSortColumns maps each sort field to its column.
+// Expressions over the optional profile are wrapped in COALESCE so keyset comparisons never meet a NULL.
+var userSortColumns = map[string]sortColumn{
+	UserSortCreatedAt: {expr: "u.created_at", cast: "timestamptz"},
+	UserSortUpdatedAt: {expr: "u.updated_at", cast: "timestamptz"},
+	UserSortUserName:  {expr: "u.user_name", cast: "text"},
+	UserSortEmail:     {expr: "u.email", cast: "text"},
+	UserSortLastName:  {expr: "COALESCE(p.last_name, '')", cast: "text"},
+}
+
+// encryptedSortColumns replace entries of userSortColumns when field encryption is on, since ciphertext has no
+// useful order. The blind index gives a stable order that keyset pagination can follow.
+var encryptedSortColumns = map[string]sortColumn{
+	UserSortLastName: {expr: "COALESCE(p.last_name_bidx, '')", cast: "text", field: fieldLastName},
+}
+
+// UserListFilter narrows and orders a user listing. Zero values mean "no filter".
+// Fields:
+// - RoleID: Only users with this role.
+// - Verified: Only verified (true) or unverified (false) users.
+// - CreatedAfter, CreatedBefore: Bounds on created_at; after is inclusive, before is exclusive.
+// - CountryCode, State, City, Zip: Case-insensitive exact matches on the profile.
+// - BusinessName: Case-insensitive substring match on the profile.
+// - Search: Case-insensitive substring match on user_name, email, first_name, or last_name.
+// - Sort: One of the UserSort constants; defaults to created_at.
+// - Desc: Sort descending instead of ascending.
+// - CursorValue, CursorID: The sort value and id of the last row of the previous page, from UserListRow.SortValue.
+// - Limit: The maximum number of rows to return.
+type UserListFilter struct {
+	RoleID        sql.NullInt32
+	Verified      sql.NullBool
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+	CountryCode   string
+	State         string
+	City          string
+	Zip           string
+	BusinessName  string
+	Search        string
+	Sort          string
+	Desc          bool
+	CursorValue   sql.NullString
+	CursorID      uuid.NullUUID
+	Limit         int32
+}
+
+// UserListRow is a user with the profile and role fields the list can filter on, and their custom attributes
+// keyed by attribute key. The profile and role are missing for users created without them.
+type UserListRow struct {
+	User          User
+	FirstName     sql.NullString
+	LastName      sql.NullString
+	BusinessName  sql.NullString
+	StreetAddress sql.NullString
+	City          sql.NullString
+	State         sql.NullString
+	Zip           sql.NullString
+	CountryCode   sql.NullString
+	RoleID        sql.NullInt32
+	Attributes    map[string]json.RawMessage
+}
+
+// SortValue returns the value of the sort field for this row, in the form UserListFilter.CursorValue expects.
+func (row UserListRow) SortValue(sort string) string {
+	switch sort {
+	case UserSortUpdatedAt:
+		return row.User.UpdatedAt.Format(time.RFC3339Nano)
+	case UserSortUserName:
+		return row.User.UserName
+	case UserSortEmail:
+		return row.User.Email
+	case UserSortLastName:
+		return row.LastName.String
+	default:
+		return row.User.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
+
+// scanDest returns the scan destinations matching userListColumns.
+func (row *UserListRow) scanDest() []interface{} {
+	return []interface{}{
+		&row.User.ID,
+		&row.User.UserName,
+		&row.User.Email,
+		&row.User.Password,
+		&row.User.CreatedAt,
+		&row.User.UpdatedAt,
+		&row.User.VerifiedAt,
+		&row.User.Version,
+		&row.User.DeletedAt,
+		&row.FirstName,
+		&row.LastName,
+		&row.BusinessName,
+		&row.StreetAddress,
+		&row.City,
+		&row.State,
+		&row.Zip,
+		&row.CountryCode,
+		&row.RoleID,
+	}
+}
+
+// UserListResult is one page of users and the number of users matching the filter across all pages.
+type UserListResult struct {
+	Rows  []UserListRow
+	Total int64
+}
+
+// userListColumns are the columns scanned into UserListRow.scanDest.
+const userListColumns = `u.id, u.user_name, u.email, u.password, u.created_at, u.updated_at, u.verified_at, u.version, u.deleted_at,
+       p.first_name, p.last_name, p.business_name, p.street_address, p.city, p.state, p.zip, p.country_code, r.role_id`
+
+// userListFrom joins each live user to at most one live profile and role, so a user never appears twice.
+const userListFrom = `
+FROM users u` + userListJoins
+
+// userListJoins attaches the profile (as p) and role (as r) to the users row aliased u.
+const userListJoins = `
+LEFT JOIN LATERAL (SELECT first_name, last_name, business_name, street_address, city, state, zip, country_code,
+                          first_name_bidx, last_name_bidx, zip_bidx
+                   FROM user_profile
+                   WHERE user_profile.user_id = u.id
+                     AND user_profile.deleted_at IS NULL
+                   ORDER BY created_at
+                   LIMIT 1) p ON true
+LEFT JOIN LATERAL (SELECT role_id
+                   FROM user_role
+                   WHERE user_role.user_id = u.id
+                     AND user_role.deleted_at IS NULL
+                   ORDER BY created_at
+                   LIMIT 1) r ON true`
+
+// SearchUsersTx lists users matching a filter with keyset pagination, and counts all matches in the same snapshot.
+// The query is built dynamically because the filters and sort order are chosen at run time; every value is
+// still passed as a bind parameter.
+// Parameters:
+// - ctx: The context for the transaction.
+// - filter: The filters, sort order, cursor, and page size.
+// Returns:
+// - The page of rows and the total number of matches.
+// - An error if the sort field is unknown or the query fails.
+func (store *SQLStore) SearchUsersTx(ctx context.Context, filter UserListFilter) (UserListResult, error) {
+	var result UserListResult
+
+	column, err := userSortColumn(filter.Sort, store.fields)
+	if err != nil {
+		return result, err
+	}
+
+	where, args := userListWhere(filter, store.fields)
+
+	direction, comparison := "ASC", ">"
+	if filter.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	pageWhere := where
+	pageArgs := args
+	if filter.CursorValue.Valid && filter.CursorID.Valid {
+		cursorValue := filter.CursorValue.String
+		if column.field != "" {
+			cursorValue = store.fields.BlindIndex(column.field, cursorValue)
+		}
+		pageArgs = append(append([]interface{}{}, args...), cursorValue, filter.CursorID.UUID)
+		pageWhere = append(append([]string{}, where...), fmt.Sprintf("(%s, u.id) %s ($%d::%s, $%d::uuid)",
+			column.expr, comparison, len(pageArgs)-1, column.cast, len(pageArgs)))
+	}
+	pageArgs = append(pageArgs, filter.Limit)
+
+	listQuery := "SELECT " + userListColumns +
+		userListFrom +
+		"\nWHERE " + strings.Join(pageWhere, "\n  AND ") +
+		fmt.Sprintf("\nORDER BY %s %s, u.id %s\nLIMIT $%d", column.expr, direction, direction, len(pageArgs))
+
+	countQuery := "SELECT count(*)" + userListFrom + "\nWHERE " + strings.Join(where, "\n  AND ")
+
+	err = store.execTx(ctx, func(q *Queries) error {
+		rows, err := q.db.QueryContext(ctx, listQuery, pageArgs...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		result.Rows = []UserListRow{}
+		for rows.Next() {
+			var i UserListRow
+			if err := rows.Scan(i.scanDest()...); err != nil {
+				return err
+			}
+			if err := store.decryptListRow(&i); err != nil {
+				return err
+			}
+			result.Rows = append(result.Rows, i)
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		page := make([]*UserListRow, len(result.Rows))
+		for i := range result.Rows {
+			page[i] = &result.Rows[i]
+		}
+		if err := loadListAttributes(ctx, q, page); err != nil {
+			return err
+		}
+
+		return q.db.QueryRowContext(ctx, countQuery, args...).Scan(&result.Total)
+	})
+
+	return result, err
+}
+
+// userSortColumn looks up a sort field, defaulting to created_at when it is empty.
+// fields is the store's cipher, or nil when encryption is off.
+func userSortColumn(sort string, fields FieldCipher) (sortColumn, error) {
+	if sort == "" {
+		sort = UserSortCreatedAt
+	}
+	if column, ok := encryptedSortColumns[sort]; ok && fields != nil {
+		return column, nil
+	}
+	column, ok := userSortColumns[sort]
+	if !ok {
+		return column, fmt.Errorf("unknown sort field %q", sort)
+	}
+	return column, nil
+}
+
+// userListWhere builds the WHERE conditions and bind arguments for a filter, excluding the cursor.
+// With a cipher, encrypted fields are matched exactly through their blind indexes.
+func userListWhere(filter UserListFilter, fields FieldCipher) ([]string, []interface{}) {
+	where := []string{"u.deleted_at IS NULL"}
+	var args []interface{}
+
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, strings.ReplaceAll(condition, "$?", fmt.Sprintf("$%d", len(args))))
+	}
+
+	if filter.RoleID.Valid {
+		add("r.role_id = $?", filter.RoleID.Int32)
+	}
+	if filter.Verified.Valid {
+		if filter.Verified.Bool {
+			where = append(where, "u.verified_at IS NOT NULL")
+		} else {
+			where = append(where, "u.verified_at IS NULL")
+		}
+	}
+	if filter.CreatedAfter.Valid {
+		add("u.created_at >= $?", filter.CreatedAfter.Time)
+	}
+	if filter.CreatedBefore.Valid {
+		add("u.created_at < $?", filter.CreatedBefore.Time)
+	}
+	if filter.CountryCode != "" {
+		add("upper(p.country_code) = upper($?)", filter.CountryCode)
+	}
+	if filter.State != "" {
+		add("lower(p.state) = lower($?)", filter.State)
+	}
+	if filter.City != "" {
+		add("lower(p.city) = lower($?)", filter.City)
+	}
+	if filter.Zip != "" && fields != nil {
+		add("p.zip_bidx = $?", fields.BlindIndex(fieldZip, filter.Zip))
+	} else if filter.Zip != "" {
+		add("upper(p.zip) = upper($?)", filter.Zip)
+	}
+	if filter.BusinessName != "" {
+		add("p.business_name ILIKE $?", likePattern(filter.BusinessName))
+	}
+	if filter.Search != "" && fields != nil {
+		args = append(args, likePattern(filter.Search), fields.BlindIndex(fieldFirstName, filter.Search), fields.BlindIndex(fieldLastName, filter.Search))
+		where = append(where, fmt.Sprintf("(u.user_name ILIKE $%[1]d OR u.email ILIKE $%[1]d OR p.first_name_bidx = $%[2]d OR p.last_name_bidx = $%[3]d)",
+			len(args)-2, len(args)-1, len(args)))
+	} else if filter.Search != "" {
+		add("(u.user_name ILIKE $? OR u.email ILIKE $? OR p.first_name ILIKE $? OR p.last_name ILIKE $?)", likePattern(filter.Search))
+	}
+
+	return where, args
+}
+
+// likePattern turns user input into an ILIKE substring pattern, escaping the wildcard characters.
+func likePattern(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(s) + "%"
+}
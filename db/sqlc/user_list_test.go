@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"whaleWake/util"
+)
+
+func TestLikePattern(t *testing.T) {
+	require.Equal(t, "%acme%", likePattern("acme"))
+	require.Equal(t, `%100\%\_off\\%`, likePattern(`100%_off\`))
+}
+
+func TestSearchUsersTx(t *testing.T) {
+	store := NewStore(testDB)
+
+	// A business name no other test uses, so the filter only matches the users created here
+	businessName := "Search " + util.RandomString(12)
+	var created []UserTxResult
+	for i := 0; i < 3; i++ {
+		result, err := store.CreateUserWithProfileAndRoleTx(context.Background(),
+			CreateUserParams{
+				UserName: util.RandomUserName(),
+				Email:    util.RandomEmail(),
+				Password: util.RandomPassword()},
+			CreateUserProfileParams{
+				FirstName:     util.RandomUserName(),
+				LastName:      util.RandomUserName(),
+				BusinessName:  businessName,
+				StreetAddress: util.RandomStreetAddress(),
+				City:          "Springfield",
+				State:         util.RandomCountryCodeOrState(),
+				Zip:           util.RandomString(5),
+				CountryCode:   util.RandomCountryCodeOrState(),
+			},
+			CreateUserRoleParams{RoleID: int32(i + 1)})
+		require.NoError(t, err)
+		created = append(created, result)
+	}
+
+	result, err := store.SearchUsersTx(context.Background(), UserListFilter{
+		BusinessName: strings.ToUpper(businessName),
+		Limit:        10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), result.Total)
+	require.Len(t, result.Rows, 3)
+	require.Equal(t, created[0].User.ID, result.Rows[0].User.ID)
+	require.Equal(t, businessName, result.Rows[0].BusinessName.String)
+
+	// Filters combine with AND
+	result, err = store.SearchUsersTx(context.Background(), UserListFilter{
+		BusinessName: businessName,
+		City:         "springfield",
+		RoleID:       sql.NullInt32{Int32: 2, Valid: true},
+		Limit:        10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), result.Total)
+	require.Equal(t, created[1].User.ID, result.Rows[0].User.ID)
+
+	// Search matches a fragment of the user name, case-insensitively
+	fragment := strings.ToUpper(created[2].User.UserName[1:5])
+	result, err = store.SearchUsersTx(context.Background(), UserListFilter{
+		BusinessName: businessName,
+		Search:       fragment,
+		Limit:        10,
+	})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, result.Total, int64(1))
+
+	// Walking the pages in descending user_name order visits every user exactly once
+	filter := UserListFilter{BusinessName: businessName, Sort: UserSortUserName, Desc: true, Limit: 2}
+	var seen []uuid.UUID
+	for {
+		page, err := store.SearchUsersTx(context.Background(), filter)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), page.Total)
+		for _, row := range page.Rows {
+			seen = append(seen, row.User.ID)
+		}
+		if len(page.Rows) < int(filter.Limit) {
+			break
+		}
+		last := page.Rows[len(page.Rows)-1]
+		filter.CursorValue = sql.NullString{String: last.SortValue(filter.Sort), Valid: true}
+		filter.CursorID = uuid.NullUUID{UUID: last.User.ID, Valid: true}
+	}
+	require.Len(t, seen, 3)
+
+	_, err = store.SearchUsersTx(context.Background(), UserListFilter{Sort: "password", Limit: 1})
+	require.Error(t, err)
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// DefaultUserNameGracePeriod is how long an old user name stays reserved for its owner after a rename, unless
+// the store is built with WithUserNameGracePeriod.
+const DefaultUserNameGracePeriod = 30 * 24 * time.Hour
+
+// WithUserNameGracePeriod sets how long an old user name stays reserved for its owner after a rename. During
+// that time nobody else can take the name, but the owner can take it back. Zero turns reservations off.
+func WithUserNameGracePeriod(gracePeriod time.Duration) StoreOption {
+	return func(store *SQLStore) {
+		store.userNameGracePeriod = gracePeriod
+	}
+}
+
+// reserveOldUserName keeps the old name of a renamed user for them for the grace period, within the caller's
+// transaction. A user taking back a name they had reserved releases the reservation. Changes of case only
+// keep the same name, so nothing is reserved.
+func (store *SQLStore) reserveOldUserName(ctx context.Context, q *Queries, before, after User) error {
+	if strings.EqualFold(before.UserName, after.UserName) {
+		return nil
+	}
+
+	_, err := q.ReleaseUserName(ctx, ReleaseUserNameParams{UserName: after.UserName, UserID: after.ID})
+	if err != nil || store.userNameGracePeriod <= 0 {
+		return err
+	}
+
+	_, err = q.ReserveUserName(ctx, ReserveUserNameParams{
+		UserName:  before.UserName,
+		UserID:    after.ID,
+		ExpiresAt: time.Now().Add(store.userNameGracePeriod),
+	})
+	return err
+}
@@ -0,0 +1,151 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: user_name_reservation.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const deleteUserNameReservations = `-- name: DeleteUserNameReservations :execrows
+DELETE
+FROM user_name_reservations
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserNameReservations(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserNameReservations, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getUserNameAvailability = `-- name: GetUserNameAvailability :one
+SELECT EXISTS(SELECT 1 FROM users WHERE lower(user_name) = lower($1))::bool AS taken,
+       EXISTS(SELECT 1
+              FROM user_name_reservations
+              WHERE lower(user_name) = lower($1)
+                AND expires_at > now())::bool                                          AS reserved
+`
+
+type GetUserNameAvailabilityRow struct {
+	Taken    bool `json:"taken"`
+	Reserved bool `json:"reserved"`
+}
+
+// Checks a name the way the unique index and the reservation trigger do.
+func (q *Queries) GetUserNameAvailability(ctx context.Context, userName string) (GetUserNameAvailabilityRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserNameAvailability, userName)
+	var i GetUserNameAvailabilityRow
+	err := row.Scan(&i.Taken, &i.Reserved)
+	return i, err
+}
+
+const listUserNameReservations = `-- name: ListUserNameReservations :many
+SELECT user_name, user_id, expires_at, created_at
+FROM user_name_reservations
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListUserNameReservations(ctx context.Context, userID uuid.UUID) ([]UserNameReservation, error) {
+	rows, err := q.db.QueryContext(ctx, listUserNameReservations, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UserNameReservation{}
+	for rows.Next() {
+		var i UserNameReservation
+		if err := rows.Scan(
+			&i.UserName,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeUserNameReservations = `-- name: PurgeUserNameReservations :execrows
+DELETE
+FROM user_name_reservations
+WHERE expires_at <= now()
+   OR user_id IN (SELECT id FROM users WHERE users.deleted_at < $1::timestamptz)
+`
+
+// Removes expired reservations, and those of users that are being purged so the users can be deleted afterwards.
+func (q *Queries) PurgeUserNameReservations(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeUserNameReservations, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const releaseUserName = `-- name: ReleaseUserName :execrows
+DELETE
+FROM user_name_reservations
+WHERE lower(user_name) = lower($1)
+  AND user_id = $2
+`
+
+type ReleaseUserNameParams struct {
+	UserName string    `json:"user_name"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+// Removes a user's own reservation of a name, e.g. when they take it back.
+func (q *Queries) ReleaseUserName(ctx context.Context, arg ReleaseUserNameParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, releaseUserName, arg.UserName, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const reserveUserName = `-- name: ReserveUserName :one
+INSERT INTO user_name_reservations (user_name, user_id, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (lower(user_name)) DO UPDATE
+    SET user_name  = excluded.user_name,
+        user_id    = excluded.user_id,
+        expires_at = excluded.expires_at,
+        created_at = STATEMENT_TIMESTAMP()
+RETURNING user_name, user_id, expires_at, created_at
+`
+
+type ReserveUserNameParams struct {
+	UserName  string    `json:"user_name"`
+	UserID    uuid.UUID `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Keeps a user's old name for them until expires_at. A reservation of the same name that has expired, or that
+// the user already held, is replaced.
+func (q *Queries) ReserveUserName(ctx context.Context, arg ReserveUserNameParams) (UserNameReservation, error) {
+	row := q.db.QueryRowContext(ctx, reserveUserName, arg.UserName, arg.UserID, arg.ExpiresAt)
+	var i UserNameReservation
+	err := row.Scan(
+		&i.UserName,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
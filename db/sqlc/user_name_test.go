@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"whaleWake/util"
+)
+
+func TestUserNameGracePeriod(t *testing.T) {
+	store := NewStore(testDB)
+	owner := createRandomUser(t)
+	other := createRandomUser(t)
+	oldName := owner.UserName
+
+	rename := func(user User, userName string) (User, error) {
+		result, err := store.UpdateUserTx(context.Background(), UpdateUserParams{
+			ID:       user.ID,
+			UserName: userName,
+			Email:    user.Email,
+			Password: user.Password,
+		}, nil)
+		return result.User, err
+	}
+
+	owner, err := rename(owner, util.RandomUserName())
+	require.NoError(t, err)
+
+	availability, err := store.GetUserNameAvailability(context.Background(), oldName)
+	require.NoError(t, err)
+	require.False(t, availability.Taken)
+	require.True(t, availability.Reserved)
+
+	// Nobody else can take the old name, in any case, during the grace period.
+	_, err = rename(other, strings.ToUpper(oldName))
+	var pqErr *pq.Error
+	require.ErrorAs(t, err, &pqErr)
+	require.Equal(t, UniqueViolation, pqErr.Code)
+
+	// The owner can take it back, which releases the reservation.
+	_, err = rename(owner, oldName)
+	require.NoError(t, err)
+
+	reservations, err := store.ListUserNameReservations(context.Background(), owner.ID)
+	require.NoError(t, err)
+	require.Len(t, reservations, 1)
+	require.NotEqual(t, oldName, reservations[0].UserName)
+}
+
+func TestUserNameGracePeriodOff(t *testing.T) {
+	store := NewStore(testDB, WithUserNameGracePeriod(0))
+	owner := createRandomUser(t)
+
+	_, err := store.UpdateUserTx(context.Background(), UpdateUserParams{
+		ID:       owner.ID,
+		UserName: util.RandomUserName(),
+		Email:    owner.Email,
+		Password: owner.Password,
+	}, nil)
+	require.NoError(t, err)
+
+	reservations, err := store.ListUserNameReservations(context.Background(), owner.ID)
+	require.NoError(t, err)
+	require.Empty(t, reservations)
+}
@@ -7,6 +7,8 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -20,20 +22,26 @@ INSERT INTO user_profile (user_id,
                           city,
                           state,
                           zip,
-                          country_code)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at
+                          country_code,
+                          first_name_bidx,
+                          last_name_bidx,
+                          zip_bidx)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, version, deleted_at, first_name_bidx, last_name_bidx, zip_bidx, phone_number, phone_verified_at, avatar_key, avatar_content_type
 `
 
 type CreateUserProfileParams struct {
-	UserID        uuid.UUID `json:"user_id"`
-	FirstName     string    `json:"first_name"`
-	LastName      string    `json:"last_name"`
-	BusinessName  string    `json:"business_name"`
-	StreetAddress string    `json:"street_address"`
-	City          string    `json:"city"`
-	State         string    `json:"state"`
-	Zip           string    `json:"zip"`
-	CountryCode   string    `json:"country_code"`
+	UserID        uuid.UUID      `json:"user_id"`
+	FirstName     string         `json:"first_name"`
+	LastName      string         `json:"last_name"`
+	BusinessName  string         `json:"business_name"`
+	StreetAddress string         `json:"street_address"`
+	City          string         `json:"city"`
+	State         string         `json:"state"`
+	Zip           string         `json:"zip"`
+	CountryCode   string         `json:"country_code"`
+	FirstNameBidx sql.NullString `json:"first_name_bidx"`
+	LastNameBidx  sql.NullString `json:"last_name_bidx"`
+	ZipBidx       sql.NullString `json:"zip_bidx"`
 }
 
 func (q *Queries) CreateUserProfile(ctx context.Context, arg CreateUserProfileParams) (UserProfile, error) {
@@ -47,6 +55,9 @@ func (q *Queries) CreateUserProfile(ctx context.Context, arg CreateUserProfilePa
 		arg.State,
 		arg.Zip,
 		arg.CountryCode,
+		arg.FirstNameBidx,
+		arg.LastNameBidx,
+		arg.ZipBidx,
 	)
 	var i UserProfile
 	err := row.Scan(
@@ -63,18 +74,36 @@ func (q *Queries) CreateUserProfile(ctx context.Context, arg CreateUserProfilePa
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.FirstNameBidx,
+		&i.LastNameBidx,
+		&i.ZipBidx,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+		&i.AvatarKey,
+		&i.AvatarContentType,
 	)
 	return i, err
 }
 
 const deleteUserProfile = `-- name: DeleteUserProfile :one
-DELETE
-FROM user_profile
-WHERE user_id = $1 RETURNING id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at
+UPDATE user_profile
+SET deleted_at = STATEMENT_TIMESTAMP()
+WHERE user_id = $1
+  AND deleted_at IS NULL
+  AND ($2::int IS NULL OR version = $2) RETURNING id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, version, deleted_at, first_name_bidx, last_name_bidx, zip_bidx, phone_number, phone_verified_at, avatar_key, avatar_content_type
 `
 
-func (q *Queries) DeleteUserProfile(ctx context.Context, userID uuid.UUID) (UserProfile, error) {
-	row := q.db.QueryRowContext(ctx, deleteUserProfile, userID)
+type DeleteUserProfileParams struct {
+	UserID          uuid.UUID     `json:"user_id"`
+	ExpectedVersion sql.NullInt32 `json:"expected_version"`
+}
+
+// Soft deletes the profile; the row is removed for good by PurgeDeletedUserProfiles.
+// expected_version is optional, as in DeleteUser.
+func (q *Queries) DeleteUserProfile(ctx context.Context, arg DeleteUserProfileParams) (UserProfile, error) {
+	row := q.db.QueryRowContext(ctx, deleteUserProfile, arg.UserID, arg.ExpectedVersion)
 	var i UserProfile
 	err := row.Scan(
 		&i.ID,
@@ -90,14 +119,24 @@ func (q *Queries) DeleteUserProfile(ctx context.Context, userID uuid.UUID) (User
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.FirstNameBidx,
+		&i.LastNameBidx,
+		&i.ZipBidx,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+		&i.AvatarKey,
+		&i.AvatarContentType,
 	)
 	return i, err
 }
 
 const getUserProfile = `-- name: GetUserProfile :one
-SELECT id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at
+SELECT id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, version, deleted_at, first_name_bidx, last_name_bidx, zip_bidx, phone_number, phone_verified_at, avatar_key, avatar_content_type
 FROM user_profile
-WHERE user_id = $1 LIMIT 1
+WHERE user_id = $1
+  AND deleted_at IS NULL LIMIT 1
 `
 
 func (q *Queries) GetUserProfile(ctx context.Context, userID uuid.UUID) (UserProfile, error) {
@@ -117,24 +156,108 @@ func (q *Queries) GetUserProfile(ctx context.Context, userID uuid.UUID) (UserPro
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.FirstNameBidx,
+		&i.LastNameBidx,
+		&i.ZipBidx,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+		&i.AvatarKey,
+		&i.AvatarContentType,
 	)
 	return i, err
 }
 
+const getUserProfileForUpdate = `-- name: GetUserProfileForUpdate :one
+SELECT id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, version, deleted_at, first_name_bidx, last_name_bidx, zip_bidx, phone_number, phone_verified_at, avatar_key, avatar_content_type
+FROM user_profile
+WHERE user_id = $1
+LIMIT 1 FOR UPDATE
+`
+
+// Locks the row for the rest of the transaction. Soft-deleted rows are included so restores can be audited.
+func (q *Queries) GetUserProfileForUpdate(ctx context.Context, userID uuid.UUID) (UserProfile, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfileForUpdate, userID)
+	var i UserProfile
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.BusinessName,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.FirstNameBidx,
+		&i.LastNameBidx,
+		&i.ZipBidx,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+		&i.AvatarKey,
+		&i.AvatarContentType,
+	)
+	return i, err
+}
+
+const listPurgeableAvatarKeys = `-- name: ListPurgeableAvatarKeys :many
+SELECT avatar_key
+FROM user_profile
+WHERE avatar_key <> ''
+  AND (user_profile.deleted_at < $1::timestamptz
+    OR user_id IN (SELECT id FROM users WHERE users.deleted_at < $1::timestamptz))
+`
+
+// The avatars of the profiles PurgeDeletedUserProfiles is about to remove.
+func (q *Queries) ListPurgeableAvatarKeys(ctx context.Context, deletedBefore time.Time) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listPurgeableAvatarKeys, deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var avatar_key string
+		if err := rows.Scan(&avatar_key); err != nil {
+			return nil, err
+		}
+		items = append(items, avatar_key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listUserProfiles = `-- name: ListUserProfiles :many
-SELECT id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at
+SELECT id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, version, deleted_at, first_name_bidx, last_name_bidx, zip_bidx, phone_number, phone_verified_at, avatar_key, avatar_content_type
 FROM user_profile
-ORDER BY id LIMIT $1
-OFFSET $2
+WHERE deleted_at IS NULL
+  AND ($1::timestamptz IS NULL
+    OR (created_at, id) > ($1::timestamptz, $2::uuid))
+ORDER BY created_at, id
+LIMIT $3
 `
 
 type ListUserProfilesParams struct {
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+	CursorCreatedAt sql.NullTime  `json:"cursor_created_at"`
+	CursorID        uuid.NullUUID `json:"cursor_id"`
+	PageLimit       int32         `json:"page_limit"`
 }
 
+// Keyset pagination over (created_at, id). Leave the cursor null for the first page, then pass the last row's values.
 func (q *Queries) ListUserProfiles(ctx context.Context, arg ListUserProfilesParams) ([]UserProfile, error) {
-	rows, err := q.db.QueryContext(ctx, listUserProfiles, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, listUserProfiles, arg.CursorCreatedAt, arg.CursorID, arg.PageLimit)
 	if err != nil {
 		return nil, err
 	}
@@ -156,6 +279,72 @@ func (q *Queries) ListUserProfiles(ctx context.Context, arg ListUserProfilesPara
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.VerifiedAt,
+			&i.Version,
+			&i.DeletedAt,
+			&i.FirstNameBidx,
+			&i.LastNameBidx,
+			&i.ZipBidx,
+			&i.PhoneNumber,
+			&i.PhoneVerifiedAt,
+			&i.AvatarKey,
+			&i.AvatarContentType,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserProfilesForKeyRotation = `-- name: ListUserProfilesForKeyRotation :many
+SELECT id, first_name, last_name, street_address, zip, first_name_bidx, last_name_bidx, zip_bidx
+FROM user_profile
+WHERE id > $1
+ORDER BY id
+LIMIT $2 FOR UPDATE
+`
+
+type ListUserProfilesForKeyRotationParams struct {
+	AfterID   uuid.UUID `json:"after_id"`
+	PageLimit int32     `json:"page_limit"`
+}
+
+type ListUserProfilesForKeyRotationRow struct {
+	ID            uuid.UUID      `json:"id"`
+	FirstName     string         `json:"first_name"`
+	LastName      string         `json:"last_name"`
+	StreetAddress string         `json:"street_address"`
+	Zip           string         `json:"zip"`
+	FirstNameBidx sql.NullString `json:"first_name_bidx"`
+	LastNameBidx  sql.NullString `json:"last_name_bidx"`
+	ZipBidx       sql.NullString `json:"zip_bidx"`
+}
+
+// Keyset pagination over id, soft-deleted rows included. Locks the page for the rest of the transaction.
+func (q *Queries) ListUserProfilesForKeyRotation(ctx context.Context, arg ListUserProfilesForKeyRotationParams) ([]ListUserProfilesForKeyRotationRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserProfilesForKeyRotation, arg.AfterID, arg.PageLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUserProfilesForKeyRotationRow{}
+	for rows.Next() {
+		var i ListUserProfilesForKeyRotationRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.StreetAddress,
+			&i.Zip,
+			&i.FirstNameBidx,
+			&i.LastNameBidx,
+			&i.ZipBidx,
 		); err != nil {
 			return nil, err
 		}
@@ -170,35 +359,98 @@ func (q *Queries) ListUserProfiles(ctx context.Context, arg ListUserProfilesPara
 	return items, nil
 }
 
+const purgeDeletedUserProfiles = `-- name: PurgeDeletedUserProfiles :execrows
+DELETE
+FROM user_profile
+WHERE user_profile.deleted_at < $1::timestamptz
+   OR user_id IN (SELECT id FROM users WHERE users.deleted_at < $1::timestamptz)
+`
+
+// Also removes profiles of users that are being purged so the users can be deleted afterwards.
+func (q *Queries) PurgeDeletedUserProfiles(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUserProfiles, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreUserProfile = `-- name: RestoreUserProfile :one
+UPDATE user_profile
+SET deleted_at = NULL
+WHERE user_id = $1
+  AND deleted_at IS NOT NULL RETURNING id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, version, deleted_at, first_name_bidx, last_name_bidx, zip_bidx, phone_number, phone_verified_at, avatar_key, avatar_content_type
+`
+
+func (q *Queries) RestoreUserProfile(ctx context.Context, userID uuid.UUID) (UserProfile, error) {
+	row := q.db.QueryRowContext(ctx, restoreUserProfile, userID)
+	var i UserProfile
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.BusinessName,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.FirstNameBidx,
+		&i.LastNameBidx,
+		&i.ZipBidx,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+		&i.AvatarKey,
+		&i.AvatarContentType,
+	)
+	return i, err
+}
+
 const updateUserProfile = `-- name: UpdateUserProfile :one
 UPDATE user_profile
-SET first_name = $2,
-    last_name = $3,
-    business_name = $4,
-    street_address = $5,
-    city = $6,
-    state = $7,
-    zip = $8,
-    country_code = $9,
+SET first_name = $1,
+    last_name = $2,
+    business_name = $3,
+    street_address = $4,
+    city = $5,
+    state = $6,
+    zip = $7,
+    country_code = $8,
+    first_name_bidx = $9,
+    last_name_bidx = $10,
+    zip_bidx = $11,
+    version = version + 1,
     updated_at = STATEMENT_TIMESTAMP()
-WHERE user_id = $1 RETURNING id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at
+WHERE user_id = $12
+  AND deleted_at IS NULL
+  AND ($13::int IS NULL OR version = $13) RETURNING id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, version, deleted_at, first_name_bidx, last_name_bidx, zip_bidx, phone_number, phone_verified_at, avatar_key, avatar_content_type
 `
 
 type UpdateUserProfileParams struct {
-	UserID        uuid.UUID `json:"user_id"`
-	FirstName     string    `json:"first_name"`
-	LastName      string    `json:"last_name"`
-	BusinessName  string    `json:"business_name"`
-	StreetAddress string    `json:"street_address"`
-	City          string    `json:"city"`
-	State         string    `json:"state"`
-	Zip           string    `json:"zip"`
-	CountryCode   string    `json:"country_code"`
+	FirstName       string         `json:"first_name"`
+	LastName        string         `json:"last_name"`
+	BusinessName    string         `json:"business_name"`
+	StreetAddress   string         `json:"street_address"`
+	City            string         `json:"city"`
+	State           string         `json:"state"`
+	Zip             string         `json:"zip"`
+	CountryCode     string         `json:"country_code"`
+	FirstNameBidx   sql.NullString `json:"first_name_bidx"`
+	LastNameBidx    sql.NullString `json:"last_name_bidx"`
+	ZipBidx         sql.NullString `json:"zip_bidx"`
+	UserID          uuid.UUID      `json:"user_id"`
+	ExpectedVersion sql.NullInt32  `json:"expected_version"`
 }
 
+// expected_version is optional; when set the update only applies if the row is still at that version.
 func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (UserProfile, error) {
 	row := q.db.QueryRowContext(ctx, updateUserProfile,
-		arg.UserID,
 		arg.FirstName,
 		arg.LastName,
 		arg.BusinessName,
@@ -207,6 +459,11 @@ func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfilePa
 		arg.State,
 		arg.Zip,
 		arg.CountryCode,
+		arg.FirstNameBidx,
+		arg.LastNameBidx,
+		arg.ZipBidx,
+		arg.UserID,
+		arg.ExpectedVersion,
 	)
 	var i UserProfile
 	err := row.Scan(
@@ -223,6 +480,195 @@ func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfilePa
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.FirstNameBidx,
+		&i.LastNameBidx,
+		&i.ZipBidx,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+		&i.AvatarKey,
+		&i.AvatarContentType,
+	)
+	return i, err
+}
+
+const updateUserProfileAvatar = `-- name: UpdateUserProfileAvatar :one
+UPDATE user_profile
+SET avatar_key          = $1,
+    avatar_content_type = $2,
+    version             = version + 1,
+    updated_at          = STATEMENT_TIMESTAMP()
+WHERE user_id = $3
+  AND deleted_at IS NULL RETURNING id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, version, deleted_at, first_name_bidx, last_name_bidx, zip_bidx, phone_number, phone_verified_at, avatar_key, avatar_content_type
+`
+
+type UpdateUserProfileAvatarParams struct {
+	AvatarKey         string    `json:"avatar_key"`
+	AvatarContentType string    `json:"avatar_content_type"`
+	UserID            uuid.UUID `json:"user_id"`
+}
+
+// Sets or clears the avatar. The caller queues the blobs of the previous avatar for deletion.
+func (q *Queries) UpdateUserProfileAvatar(ctx context.Context, arg UpdateUserProfileAvatarParams) (UserProfile, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfileAvatar, arg.AvatarKey, arg.AvatarContentType, arg.UserID)
+	var i UserProfile
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.BusinessName,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.FirstNameBidx,
+		&i.LastNameBidx,
+		&i.ZipBidx,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+		&i.AvatarKey,
+		&i.AvatarContentType,
+	)
+	return i, err
+}
+
+const updateUserProfileEncryption = `-- name: UpdateUserProfileEncryption :exec
+UPDATE user_profile
+SET first_name      = $1,
+    last_name       = $2,
+    street_address  = $3,
+    zip             = $4,
+    first_name_bidx = $5,
+    last_name_bidx  = $6,
+    zip_bidx        = $7
+WHERE id = $8
+`
+
+type UpdateUserProfileEncryptionParams struct {
+	FirstName     string         `json:"first_name"`
+	LastName      string         `json:"last_name"`
+	StreetAddress string         `json:"street_address"`
+	Zip           string         `json:"zip"`
+	FirstNameBidx sql.NullString `json:"first_name_bidx"`
+	LastNameBidx  sql.NullString `json:"last_name_bidx"`
+	ZipBidx       sql.NullString `json:"zip_bidx"`
+	ID            uuid.UUID      `json:"id"`
+}
+
+// Rewrites the encrypted columns and blind indexes without a new version: the values themselves are unchanged.
+func (q *Queries) UpdateUserProfileEncryption(ctx context.Context, arg UpdateUserProfileEncryptionParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserProfileEncryption,
+		arg.FirstName,
+		arg.LastName,
+		arg.StreetAddress,
+		arg.Zip,
+		arg.FirstNameBidx,
+		arg.LastNameBidx,
+		arg.ZipBidx,
+		arg.ID,
+	)
+	return err
+}
+
+const updateUserProfilePhone = `-- name: UpdateUserProfilePhone :one
+UPDATE user_profile
+SET phone_verified_at = CASE WHEN phone_number = $1 THEN phone_verified_at END,
+    phone_number      = $1,
+    version           = version + 1,
+    updated_at        = STATEMENT_TIMESTAMP()
+WHERE user_id = $2
+  AND deleted_at IS NULL
+  AND ($3::int IS NULL OR version = $3) RETURNING id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, version, deleted_at, first_name_bidx, last_name_bidx, zip_bidx, phone_number, phone_verified_at, avatar_key, avatar_content_type
+`
+
+type UpdateUserProfilePhoneParams struct {
+	PhoneNumber     string        `json:"phone_number"`
+	UserID          uuid.UUID     `json:"user_id"`
+	ExpectedVersion sql.NullInt32 `json:"expected_version"`
+}
+
+// Sets or clears the phone number. A new number is unverified; setting the same number again keeps the verification.
+// expected_version is optional, as in UpdateUserProfile.
+func (q *Queries) UpdateUserProfilePhone(ctx context.Context, arg UpdateUserProfilePhoneParams) (UserProfile, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfilePhone, arg.PhoneNumber, arg.UserID, arg.ExpectedVersion)
+	var i UserProfile
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.BusinessName,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.FirstNameBidx,
+		&i.LastNameBidx,
+		&i.ZipBidx,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+		&i.AvatarKey,
+		&i.AvatarContentType,
+	)
+	return i, err
+}
+
+const verifyUserProfilePhone = `-- name: VerifyUserProfilePhone :one
+UPDATE user_profile
+SET phone_verified_at = STATEMENT_TIMESTAMP(),
+    version           = version + 1,
+    updated_at        = STATEMENT_TIMESTAMP()
+WHERE user_id = $1
+  AND phone_number = $2
+  AND deleted_at IS NULL RETURNING id, user_id, first_name, last_name, business_name, street_address, city, state, zip, country_code, created_at, updated_at, verified_at, version, deleted_at, first_name_bidx, last_name_bidx, zip_bidx, phone_number, phone_verified_at, avatar_key, avatar_content_type
+`
+
+type VerifyUserProfilePhoneParams struct {
+	UserID      uuid.UUID `json:"user_id"`
+	PhoneNumber string    `json:"phone_number"`
+}
+
+// Marks the phone number as verified. Returns no rows when the profile's number is no longer phone_number.
+func (q *Queries) VerifyUserProfilePhone(ctx context.Context, arg VerifyUserProfilePhoneParams) (UserProfile, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserProfilePhone, arg.UserID, arg.PhoneNumber)
+	var i UserProfile
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.BusinessName,
+		&i.StreetAddress,
+		&i.City,
+		&i.State,
+		&i.Zip,
+		&i.CountryCode,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.FirstNameBidx,
+		&i.LastNameBidx,
+		&i.ZipBidx,
+		&i.PhoneNumber,
+		&i.PhoneVerifiedAt,
+		&i.AvatarKey,
+		&i.AvatarContentType,
 	)
 	return i, err
 }
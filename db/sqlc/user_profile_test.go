@@ -36,8 +36,8 @@ func TestCreateUserProfile(t *testing.T) {
 	profile := createRandomUserProfile(t, user.ID)
 
 	t.Cleanup(func() {
-		_, _ = testQueries.DeleteUserProfile(context.Background(), profile.UserID)
-		_, _ = testQueries.DeleteUser(context.Background(), user.ID)
+		_, _ = testQueries.DeleteUserProfile(context.Background(), DeleteUserProfileParams{UserID: profile.UserID})
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 	})
 }
 
@@ -48,8 +48,8 @@ func TestGetUserProfile(t *testing.T) {
 
 	// Cleanup should be run before the require statements because if the require statements fail, the cleanup will not be run
 	t.Cleanup(func() {
-		_, _ = testQueries.DeleteUserProfile(context.Background(), profile1.UserID)
-		_, _ = testQueries.DeleteUser(context.Background(), user.ID)
+		_, _ = testQueries.DeleteUserProfile(context.Background(), DeleteUserProfileParams{UserID: profile1.UserID})
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 	})
 
 	require.NoError(t, err)
@@ -89,8 +89,8 @@ func TestUpdateUserProfile(t *testing.T) {
 	profile2, err := testQueries.UpdateUserProfile(context.Background(), arg)
 
 	t.Cleanup(func() {
-		_, _ = testQueries.DeleteUserProfile(context.Background(), profile2.UserID)
-		_, _ = testQueries.DeleteUser(context.Background(), user.ID)
+		_, _ = testQueries.DeleteUserProfile(context.Background(), DeleteUserProfileParams{UserID: profile2.UserID})
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 	})
 
 	require.NoError(t, err)
@@ -108,13 +108,45 @@ func TestUpdateUserProfile(t *testing.T) {
 	require.WithinDuration(t, profile1.CreatedAt, profile2.CreatedAt, time.Second)
 	require.NotEqual(t, profile1.UpdatedAt, profile2.UpdatedAt)
 	require.Equal(t, profile1.VerifiedAt, profile2.VerifiedAt)
+	require.Equal(t, profile1.Version+1, profile2.Version)
+}
+
+func TestUpdateUserProfileStaleVersion(t *testing.T) {
+	user := createRandomUser(t)
+	profile1 := createRandomUserProfile(t, user.ID)
+
+	t.Cleanup(func() {
+		_, _ = testQueries.DeleteUserProfile(context.Background(), DeleteUserProfileParams{UserID: profile1.UserID})
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
+	})
+
+	arg := UpdateUserProfileParams{
+		UserID:          profile1.UserID,
+		FirstName:       util.RandomUserName(),
+		LastName:        profile1.LastName,
+		BusinessName:    profile1.BusinessName,
+		StreetAddress:   profile1.StreetAddress,
+		City:            profile1.City,
+		State:           profile1.State,
+		Zip:             profile1.Zip,
+		CountryCode:     profile1.CountryCode,
+		ExpectedVersion: sql.NullInt32{Int32: profile1.Version + 1, Valid: true},
+	}
+
+	_, err := testQueries.UpdateUserProfile(context.Background(), arg)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	profile2, err := testQueries.GetUserProfile(context.Background(), profile1.UserID)
+	require.NoError(t, err)
+	require.Equal(t, profile1.FirstName, profile2.FirstName)
+	require.Equal(t, profile1.Version, profile2.Version)
 }
 
 func TestDeleteUserProfile(t *testing.T) {
 	user := createRandomUser(t)
 	profile1 := createRandomUserProfile(t, user.ID)
 
-	profile1, err := testQueries.DeleteUserProfile(context.Background(), profile1.UserID)
+	profile1, err := testQueries.DeleteUserProfile(context.Background(), DeleteUserProfileParams{UserID: profile1.UserID})
 	require.NoError(t, err)
 
 	profile2, err := testQueries.GetUserProfile(context.Background(), profile1.UserID)
@@ -123,8 +155,8 @@ func TestDeleteUserProfile(t *testing.T) {
 	require.Empty(t, profile2)
 
 	t.Cleanup(func() {
-		_, _ = testQueries.DeleteUserProfile(context.Background(), profile1.UserID)
-		_, _ = testQueries.DeleteUser(context.Background(), user.ID)
+		_, _ = testQueries.DeleteUserProfile(context.Background(), DeleteUserProfileParams{UserID: profile1.UserID})
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 	})
 }
 
@@ -139,16 +171,15 @@ func TestListUserProfiles(t *testing.T) {
 	}
 
 	arg := ListUserProfilesParams{
-		Limit:  5,
-		Offset: 5,
+		PageLimit: 5,
 	}
 
 	profiles, err := testQueries.ListUserProfiles(context.Background(), arg)
 
 	t.Cleanup(func() {
 		for _, profile := range profileSlice {
-			_, _ = testQueries.DeleteUserProfile(context.Background(), profile.UserID)
-			_, _ = testQueries.DeleteUser(context.Background(), user.ID)
+			_, _ = testQueries.DeleteUserProfile(context.Background(), DeleteUserProfileParams{UserID: profile.UserID})
+			_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 		}
 	})
 
@@ -159,4 +190,18 @@ func TestListUserProfiles(t *testing.T) {
 		require.NotEmpty(t, profile)
 	}
 
+	last := profiles[len(profiles)-1]
+	arg = ListUserProfilesParams{
+		CursorCreatedAt: sql.NullTime{Time: last.CreatedAt, Valid: true},
+		CursorID:        uuid.NullUUID{UUID: last.ID, Valid: true},
+		PageLimit:       5,
+	}
+
+	nextUserProfiles, err := testQueries.ListUserProfiles(context.Background(), arg)
+	require.NoError(t, err)
+	for _, next := range nextUserProfiles {
+		require.False(t, next.CreatedAt.Before(last.CreatedAt))
+		require.NotEqual(t, last.ID, next.ID)
+	}
+
 }
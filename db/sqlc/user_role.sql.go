@@ -7,6 +7,8 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -14,7 +16,7 @@ import (
 const createUserRole = `-- name: CreateUserRole :one
 INSERT INTO user_role (user_id, role_id)
 VALUES ($1, $2)
-RETURNING id, user_id, role_id, created_at, updated_at, verified_at
+RETURNING id, user_id, role_id, created_at, updated_at, verified_at, version, deleted_at
 `
 
 type CreateUserRoleParams struct {
@@ -32,19 +34,30 @@ func (q *Queries) CreateUserRole(ctx context.Context, arg CreateUserRoleParams)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const deleteUserRole = `-- name: DeleteUserRole :one
-DELETE
-FROM user_role
+UPDATE user_role
+SET deleted_at = STATEMENT_TIMESTAMP()
 WHERE user_id = $1
-RETURNING id, user_id, role_id, created_at, updated_at, verified_at
+  AND deleted_at IS NULL
+  AND ($2::int IS NULL OR version = $2)
+RETURNING id, user_id, role_id, created_at, updated_at, verified_at, version, deleted_at
 `
 
-func (q *Queries) DeleteUserRole(ctx context.Context, userID uuid.UUID) (UserRole, error) {
-	row := q.db.QueryRowContext(ctx, deleteUserRole, userID)
+type DeleteUserRoleParams struct {
+	UserID          uuid.UUID     `json:"user_id"`
+	ExpectedVersion sql.NullInt32 `json:"expected_version"`
+}
+
+// Soft deletes the role; the row is removed for good by PurgeDeletedUserRoles.
+// expected_version is optional, as in DeleteUser.
+func (q *Queries) DeleteUserRole(ctx context.Context, arg DeleteUserRoleParams) (UserRole, error) {
+	row := q.db.QueryRowContext(ctx, deleteUserRole, arg.UserID, arg.ExpectedVersion)
 	var i UserRole
 	err := row.Scan(
 		&i.ID,
@@ -53,14 +66,17 @@ func (q *Queries) DeleteUserRole(ctx context.Context, userID uuid.UUID) (UserRol
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getUserRole = `-- name: GetUserRole :one
-SELECT id, user_id, role_id, created_at, updated_at, verified_at
+SELECT id, user_id, role_id, created_at, updated_at, verified_at, version, deleted_at
 FROM user_role
 WHERE user_id = $1
+  AND deleted_at IS NULL
 LIMIT 1
 `
 
@@ -74,24 +90,55 @@ func (q *Queries) GetUserRole(ctx context.Context, userID uuid.UUID) (UserRole,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getUserRoleForUpdate = `-- name: GetUserRoleForUpdate :one
+SELECT id, user_id, role_id, created_at, updated_at, verified_at, version, deleted_at
+FROM user_role
+WHERE user_id = $1
+LIMIT 1 FOR UPDATE
+`
+
+// Locks the row for the rest of the transaction. Soft-deleted rows are included so restores can be audited.
+func (q *Queries) GetUserRoleForUpdate(ctx context.Context, userID uuid.UUID) (UserRole, error) {
+	row := q.db.QueryRowContext(ctx, getUserRoleForUpdate, userID)
+	var i UserRole
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RoleID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const listUserRoles = `-- name: ListUserRoles :many
-SELECT id, user_id, role_id, created_at, updated_at, verified_at
+SELECT id, user_id, role_id, created_at, updated_at, verified_at, version, deleted_at
 FROM user_role
-ORDER BY id
-LIMIT $1 OFFSET $2
+WHERE deleted_at IS NULL
+  AND ($1::timestamptz IS NULL
+    OR (created_at, id) > ($1::timestamptz, $2::uuid))
+ORDER BY created_at, id
+LIMIT $3
 `
 
 type ListUserRolesParams struct {
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+	CursorCreatedAt sql.NullTime  `json:"cursor_created_at"`
+	CursorID        uuid.NullUUID `json:"cursor_id"`
+	PageLimit       int32         `json:"page_limit"`
 }
 
+// Keyset pagination over (created_at, id). Leave the cursor null for the first page, then pass the last row's values.
 func (q *Queries) ListUserRoles(ctx context.Context, arg ListUserRolesParams) ([]UserRole, error) {
-	rows, err := q.db.QueryContext(ctx, listUserRoles, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, listUserRoles, arg.CursorCreatedAt, arg.CursorID, arg.PageLimit)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +153,8 @@ func (q *Queries) ListUserRoles(ctx context.Context, arg ListUserRolesParams) ([
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.VerifiedAt,
+			&i.Version,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -120,21 +169,66 @@ func (q *Queries) ListUserRoles(ctx context.Context, arg ListUserRolesParams) ([
 	return items, nil
 }
 
+const purgeDeletedUserRoles = `-- name: PurgeDeletedUserRoles :execrows
+DELETE
+FROM user_role
+WHERE user_role.deleted_at < $1::timestamptz
+   OR user_id IN (SELECT id FROM users WHERE users.deleted_at < $1::timestamptz)
+`
+
+// Also removes roles of users that are being purged so the users can be deleted afterwards.
+func (q *Queries) PurgeDeletedUserRoles(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUserRoles, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreUserRole = `-- name: RestoreUserRole :one
+UPDATE user_role
+SET deleted_at = NULL
+WHERE user_id = $1
+  AND deleted_at IS NOT NULL
+RETURNING id, user_id, role_id, created_at, updated_at, verified_at, version, deleted_at
+`
+
+func (q *Queries) RestoreUserRole(ctx context.Context, userID uuid.UUID) (UserRole, error) {
+	row := q.db.QueryRowContext(ctx, restoreUserRole, userID)
+	var i UserRole
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RoleID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
 const updateUserRole = `-- name: UpdateUserRole :one
 UPDATE user_role
-SET role_id    = $2,
+SET role_id    = $1,
+    version    = version + 1,
     updated_at = STATEMENT_TIMESTAMP()
-WHERE user_id = $1
-RETURNING id, user_id, role_id, created_at, updated_at, verified_at
+WHERE user_id = $2
+  AND deleted_at IS NULL
+  AND ($3::int IS NULL OR version = $3)
+RETURNING id, user_id, role_id, created_at, updated_at, verified_at, version, deleted_at
 `
 
 type UpdateUserRoleParams struct {
-	UserID uuid.UUID `json:"user_id"`
-	RoleID int32     `json:"role_id"`
+	RoleID          int32         `json:"role_id"`
+	UserID          uuid.UUID     `json:"user_id"`
+	ExpectedVersion sql.NullInt32 `json:"expected_version"`
 }
 
+// expected_version is optional; when set the update only applies if the row is still at that version.
 func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (UserRole, error) {
-	row := q.db.QueryRowContext(ctx, updateUserRole, arg.UserID, arg.RoleID)
+	row := q.db.QueryRowContext(ctx, updateUserRole, arg.RoleID, arg.UserID, arg.ExpectedVersion)
 	var i UserRole
 	err := row.Scan(
 		&i.ID,
@@ -143,6 +237,8 @@ func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.VerifiedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -36,8 +36,8 @@ func TestCreateUserRole(t *testing.T) {
 	role := createRandomUserRole(t, user.ID)
 
 	t.Cleanup(func() {
-		_, _ = testQueries.DeleteUserRole(context.Background(), role.UserID)
-		_, _ = testQueries.DeleteUser(context.Background(), user.ID)
+		_, _ = testQueries.DeleteUserRole(context.Background(), DeleteUserRoleParams{UserID: role.UserID})
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 	})
 }
 
@@ -48,8 +48,8 @@ func TestGetUserRole(t *testing.T) {
 
 	// Cleanup should be run before the require statements because if the require statements fail, the cleanup will not be run
 	t.Cleanup(func() {
-		_, _ = testQueries.DeleteUserRole(context.Background(), role1.UserID)
-		_, _ = testQueries.DeleteUser(context.Background(), user.ID)
+		_, _ = testQueries.DeleteUserRole(context.Background(), DeleteUserRoleParams{UserID: role1.UserID})
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 	})
 
 	require.NoError(t, err)
@@ -75,8 +75,8 @@ func TestUpdateUserRole(t *testing.T) {
 	role2, err := testQueries.UpdateUserRole(context.Background(), arg)
 
 	t.Cleanup(func() {
-		_, _ = testQueries.DeleteUserRole(context.Background(), role2.UserID)
-		_, _ = testQueries.DeleteUser(context.Background(), user.ID)
+		_, _ = testQueries.DeleteUserRole(context.Background(), DeleteUserRoleParams{UserID: role2.UserID})
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 	})
 
 	require.NoError(t, err)
@@ -87,14 +87,39 @@ func TestUpdateUserRole(t *testing.T) {
 	require.WithinDuration(t, role1.CreatedAt, role2.CreatedAt, time.Second)
 	require.NotEqual(t, role1.UpdatedAt, role2.UpdatedAt)
 	require.Equal(t, role1.VerifiedAt, role2.VerifiedAt)
+	require.Equal(t, role1.Version+1, role2.Version)
 
 }
 
+func TestUpdateUserRoleStaleVersion(t *testing.T) {
+	user := createRandomUser(t)
+	role1 := createRandomUserRole(t, user.ID)
+
+	t.Cleanup(func() {
+		_, _ = testQueries.DeleteUserRole(context.Background(), DeleteUserRoleParams{UserID: role1.UserID})
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
+	})
+
+	arg := UpdateUserRoleParams{
+		UserID:          role1.UserID,
+		RoleID:          3,
+		ExpectedVersion: sql.NullInt32{Int32: role1.Version + 1, Valid: true},
+	}
+
+	_, err := testQueries.UpdateUserRole(context.Background(), arg)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	role2, err := testQueries.GetUserRole(context.Background(), role1.UserID)
+	require.NoError(t, err)
+	require.Equal(t, role1.RoleID, role2.RoleID)
+	require.Equal(t, role1.Version, role2.Version)
+}
+
 func TestDeleteUserRole(t *testing.T) {
 	user := createRandomUser(t)
 	role1 := createRandomUserRole(t, user.ID)
 
-	role1, err := testQueries.DeleteUserRole(context.Background(), role1.UserID)
+	role1, err := testQueries.DeleteUserRole(context.Background(), DeleteUserRoleParams{UserID: role1.UserID})
 	require.NoError(t, err)
 
 	role2, err := testQueries.GetUserRole(context.Background(), role1.UserID)
@@ -103,8 +128,8 @@ func TestDeleteUserRole(t *testing.T) {
 	require.Empty(t, role2)
 
 	t.Cleanup(func() {
-		_, _ = testQueries.DeleteUserRole(context.Background(), role1.UserID)
-		_, _ = testQueries.DeleteUser(context.Background(), user.ID)
+		_, _ = testQueries.DeleteUserRole(context.Background(), DeleteUserRoleParams{UserID: role1.UserID})
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 	})
 
 }
@@ -119,16 +144,15 @@ func TestListUserRoles(t *testing.T) {
 	}
 
 	arg := ListUserRolesParams{
-		Limit:  5,
-		Offset: 5,
+		PageLimit: 5,
 	}
 
 	roles, err := testQueries.ListUserRoles(context.Background(), arg)
 
 	t.Cleanup(func() {
 		for _, role := range roleSlice {
-			_, _ = testQueries.DeleteUserRole(context.Background(), role.UserID)
-			_, _ = testQueries.DeleteUser(context.Background(), user.ID)
+			_, _ = testQueries.DeleteUserRole(context.Background(), DeleteUserRoleParams{UserID: role.UserID})
+			_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 		}
 	})
 
@@ -138,4 +162,18 @@ func TestListUserRoles(t *testing.T) {
 	for _, role := range roles {
 		require.NotEmpty(t, role)
 	}
+
+	last := roles[len(roles)-1]
+	arg = ListUserRolesParams{
+		CursorCreatedAt: sql.NullTime{Time: last.CreatedAt, Valid: true},
+		CursorID:        uuid.NullUUID{UUID: last.ID, Valid: true},
+		PageLimit:       5,
+	}
+
+	nextUserRoles, err := testQueries.ListUserRoles(context.Background(), arg)
+	require.NoError(t, err)
+	for _, next := range nextUserRoles {
+		require.False(t, next.CreatedAt.Before(last.CreatedAt))
+		require.NotEqual(t, last.ID, next.ID)
+	}
 }
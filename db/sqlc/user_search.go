@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxSearchTerms caps how many words of a query are used, so a pasted paragraph cannot build a huge query.
+	maxSearchTerms = 8
+	// minSearchTermLength drops words too short to produce useful trigrams.
+	minSearchTermLength = 2
+	// searchWordSimilarityThreshold is how close a query word must be to a word in the document to match.
+	// It is lower than the pg_trgm default of 0.6 so common typos ("jonh", "smth") still match.
+	searchWordSimilarityThreshold = "0.3"
+)
+
+// The search documents. The first two must match the index expressions in migrations 000010 and 000024 exactly.
+// The profile's is made of the columns that are never encrypted; without encryption the names are searched too,
+// through plaintextProfileSearchDocument, which no index covers.
+// Column names are left unqualified so the same text works against the tables and the joined u and p aliases,
+// where none of them is ambiguous.
+const (
+	userSearchDocument             = "(user_name || ' ' || email)"
+	profileSearchDocument          = "(business_name || ' ' || city || ' ' || state)"
+	plaintextProfileSearchDocument = "(first_name || ' ' || last_name || ' ' || business_name || ' ' || city || ' ' || state)"
+)
+
+// UserDirectorySearchParams describes a directory search.
+// Fields:
+// - Terms: The normalized words to search for, see SearchTerms. Every term must match the user.
+// - BusinessName: When set, only users whose profile has this business name (case-insensitive) are returned.
+// - Limit: The maximum number of rows to return.
+type UserDirectorySearchParams struct {
+	Terms        []string
+	BusinessName string
+	Limit        int32
+}
+
+// UserDirectoryRow is a search hit and its relevance; higher ranks are better matches.
+type UserDirectoryRow struct {
+	UserListRow
+	Rank float64
+}
+
+// SearchTerms splits a free-text query into lower-case words made of letters and digits.
+// Punctuation separates words, words shorter than two characters and repeats are dropped,
+// and at most eight words are kept.
+func SearchTerms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if len([]rune(word)) < minSearchTermLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+
+	return terms
+}
+
+// SearchUserDirectoryTx finds users by typo-tolerant full-text search over their user name, email, and profile.
+// Candidates are found through the tsvector (prefix) and trigram (word similarity) indexes on each table, then
+// every term must match either document. Results are ranked by text rank plus the similarity of each term.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The terms, optional business name restriction, and limit.
+// Returns:
+// - The matching rows, best first. An empty slice when there are no terms.
+// - An error if the query fails.
+func (store *SQLStore) SearchUserDirectoryTx(ctx context.Context, arg UserDirectorySearchParams) ([]UserDirectoryRow, error) {
+	result := []UserDirectoryRow{}
+	if len(arg.Terms) == 0 {
+		return result, nil
+	}
+
+	query, args := userDirectoryQuery(arg, store.fields)
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		// Scoped to this transaction by is_local = true.
+		_, err := q.db.ExecContext(ctx, "SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)", searchWordSimilarityThreshold)
+		if err != nil {
+			return err
+		}
+
+		rows, err := q.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var i UserDirectoryRow
+			if err := rows.Scan(append(i.scanDest(), &i.Rank)...); err != nil {
+				return err
+			}
+			if err := store.decryptListRow(&i.UserListRow); err != nil {
+				return err
+			}
+			result = append(result, i)
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		page := make([]*UserListRow, len(result))
+		for i := range result {
+			page[i] = &result[i].UserListRow
+		}
+		return loadListAttributes(ctx, q, page)
+	})
+
+	return result, err
+}
+
+// userDirectoryQuery builds the search query and its bind arguments.
+// $1 is the prefix tsquery built from all terms; each term then gets its own parameter.
+// With a cipher the encrypted names cannot be searched as text, so a term also matches a first or last name
+// exactly through its blind index. Without one the names are part of the profile document.
+func userDirectoryQuery(arg UserDirectorySearchParams, fields FieldCipher) (string, []interface{}) {
+	profileDocument := profileSearchDocument
+	if fields == nil {
+		profileDocument = plaintextProfileSearchDocument
+	}
+
+	prefixes := make([]string, len(arg.Terms))
+	for i, term := range arg.Terms {
+		prefixes[i] = term + ":*"
+	}
+	args := []interface{}{strings.Join(prefixes, " | ")}
+
+	userTSV := "to_tsvector('simple', " + userSearchDocument + ")"
+	profileTSV := "to_tsvector('simple', " + profileDocument + ")"
+
+	var userAny, profileAny, everyTerm, similarity []string
+	for _, term := range arg.Terms {
+		args = append(args, term)
+		param := fmt.Sprintf("$%d", len(args))
+
+		profileMatch := param + " <% " + profileDocument
+		if fields != nil {
+			args = append(args, fields.BlindIndex(fieldFirstName, term), fields.BlindIndex(fieldLastName, term))
+			profileMatch += fmt.Sprintf(" OR first_name_bidx = $%d OR last_name_bidx = $%d", len(args)-1, len(args))
+		}
+
+		userAny = append(userAny, param+" <% "+userSearchDocument)
+		profileAny = append(profileAny, profileMatch)
+		everyTerm = append(everyTerm, fmt.Sprintf(
+			"(%s <%% %s OR %s OR %s @@ to_tsquery('simple', %s || ':*') OR %s @@ to_tsquery('simple', %s || ':*'))",
+			param, userSearchDocument, profileMatch, userTSV, param, profileTSV, param))
+		similarity = append(similarity, fmt.Sprintf("GREATEST(word_similarity(%s, %s), COALESCE(word_similarity(%s, %s), 0))",
+			param, userSearchDocument, param, profileDocument))
+	}
+
+	rank := fmt.Sprintf("ts_rank(to_tsvector('simple', %s || ' ' || COALESCE(%s, '')), to_tsquery('simple', $1)) + %s",
+		userSearchDocument, profileDocument, strings.Join(similarity, " + "))
+
+	where := []string{"u.deleted_at IS NULL", strings.Join(everyTerm, "\n  AND ")}
+	if arg.BusinessName != "" {
+		args = append(args, arg.BusinessName)
+		where = append(where, fmt.Sprintf("lower(p.business_name) = lower($%d)", len(args)))
+	}
+	args = append(args, arg.Limit)
+
+	query := `WITH candidates AS (SELECT id
+                    FROM users
+                    WHERE deleted_at IS NULL
+                      AND (` + userTSV + ` @@ to_tsquery('simple', $1) OR ` + strings.Join(userAny, " OR ") + `)
+                    UNION
+                    SELECT user_id
+                    FROM user_profile
+                    WHERE deleted_at IS NULL
+                      AND (` + profileTSV + ` @@ to_tsquery('simple', $1) OR ` + strings.Join(profileAny, " OR ") + `))
+SELECT ` + userListColumns + `,
+       ` + rank + ` AS rank
+FROM candidates c
+JOIN users u ON u.id = c.id` + userListJoins + `
+WHERE ` + strings.Join(where, "\n  AND ") + fmt.Sprintf(`
+ORDER BY rank DESC, u.id
+LIMIT $%d`, len(args))
+
+	return query, args
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"whaleWake/util"
+)
+
+func TestSearchTerms(t *testing.T) {
+	require.Equal(t, []string{"jonh", "smith", "example", "com"}, SearchTerms("Jonh  SMITH, jonh@example.com a"))
+	require.Empty(t, SearchTerms("!! ? x"))
+	require.Len(t, SearchTerms("aa bb cc dd ee ff gg hh ii jj"), maxSearchTerms)
+}
+
+func TestSearchUserDirectoryTx(t *testing.T) {
+	store := NewStore(testDB)
+
+	businessName := "Directory " + util.RandomString(12)
+	lastName := "Zz" + util.RandomString(8)
+	result, err := store.CreateUserWithProfileAndRoleTx(context.Background(),
+		CreateUserParams{
+			UserName: util.RandomUserName(),
+			Email:    util.RandomEmail(),
+			Password: util.RandomPassword()},
+		CreateUserProfileParams{
+			FirstName:     "Jonathan",
+			LastName:      lastName,
+			BusinessName:  businessName,
+			StreetAddress: util.RandomStreetAddress(),
+			City:          "Springfield",
+			State:         util.RandomCountryCodeOrState(),
+			Zip:           util.RandomString(5),
+			CountryCode:   util.RandomCountryCodeOrState(),
+		},
+		CreateUserRoleParams{RoleID: 1})
+	require.NoError(t, err)
+
+	// A one-letter typo in the last name and a prefix of the first name still find the user
+	typo := []rune(lastName)
+	typo[len(typo)-1] = 'q'
+	rows, err := store.SearchUserDirectoryTx(context.Background(), UserDirectorySearchParams{
+		Terms:        SearchTerms("jonat " + string(typo)),
+		BusinessName: businessName,
+		Limit:        10,
+	})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Equal(t, result.User.ID, rows[0].User.ID)
+	require.Greater(t, rows[0].Rank, 0.0)
+
+	// Every term must match
+	rows, err = store.SearchUserDirectoryTx(context.Background(), UserDirectorySearchParams{
+		Terms:        SearchTerms("jonathan " + util.RandomString(10)),
+		BusinessName: businessName,
+		Limit:        10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, rows)
+
+	// Another organization does not see the user
+	rows, err = store.SearchUserDirectoryTx(context.Background(), UserDirectorySearchParams{
+		Terms:        SearchTerms(lastName),
+		BusinessName: "Other " + util.RandomString(12),
+		Limit:        10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, rows)
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"sort"
+)
+
+// SetUserSettingsParams holds a change to some of a user's settings.
+// Fields:
+// - UserID: The user whose settings change.
+// - Values: Setting keys and their new JSON values, already validated. A nil value resets the setting to its
+// default by removing the stored value. Settings not listed are left as they are.
+type SetUserSettingsParams struct {
+	UserID uuid.UUID
+	Values map[string]json.RawMessage
+}
+
+// SetUserSettingsTx stores or resets some of a user's settings in one change, recorded as a single audit event.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The user and the settings to change.
+// Returns:
+// - Every setting the user has stored after the change, ordered by key.
+// - sql.ErrNoRows if the user does not exist or is deleted.
+func (store *SQLStore) SetUserSettingsTx(ctx context.Context, arg SetUserSettingsParams) ([]UserSetting, error) {
+	var result []UserSetting
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		err := lockLiveUser(ctx, q, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		before, err := q.ListUserSettings(ctx, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		// Apply the changes in key order, so concurrent changes to the same user touch rows in the same order.
+		keys := make([]string, 0, len(arg.Values))
+		for key := range arg.Values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value := arg.Values[key]
+			if value == nil {
+				_, err = q.DeleteUserSetting(ctx, DeleteUserSettingParams{UserID: arg.UserID, Key: key})
+			} else {
+				_, err = q.UpsertUserSetting(ctx, UpsertUserSettingParams{UserID: arg.UserID, Key: key, Value: value})
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		result, err = q.ListUserSettings(ctx, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudit(ctx, q, AuditActionUpdate, AuditTargetUserSettings, arg.UserID,
+			userSettingValues(before), userSettingValues(result))
+		if err != nil {
+			return err
+		}
+
+		return recordUserUpdated(ctx, q, arg.UserID)
+	})
+
+	return result, err
+}
+
+// userSettingValues maps the keys of stored settings to their values, the shape settings are audited in.
+func userSettingValues(userSettings []UserSetting) map[string]json.RawMessage {
+	values := make(map[string]json.RawMessage, len(userSettings))
+	for _, setting := range userSettings {
+		values[setting.Key] = setting.Value
+	}
+	return values
+}
@@ -0,0 +1,125 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: user_setting.sql
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const deleteUserSetting = `-- name: DeleteUserSetting :execrows
+DELETE
+FROM user_settings
+WHERE user_id = $1
+  AND key = $2
+`
+
+type DeleteUserSettingParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	Key    string    `json:"key"`
+}
+
+func (q *Queries) DeleteUserSetting(ctx context.Context, arg DeleteUserSettingParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserSetting, arg.UserID, arg.Key)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteUserSettings = `-- name: DeleteUserSettings :execrows
+DELETE
+FROM user_settings
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserSettings(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserSettings, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listUserSettings = `-- name: ListUserSettings :many
+SELECT user_id, key, value, updated_at
+FROM user_settings
+WHERE user_id = $1
+ORDER BY key
+`
+
+func (q *Queries) ListUserSettings(ctx context.Context, userID uuid.UUID) ([]UserSetting, error) {
+	rows, err := q.db.QueryContext(ctx, listUserSettings, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UserSetting{}
+	for rows.Next() {
+		var i UserSetting
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Key,
+			&i.Value,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedUserSettings = `-- name: PurgeDeletedUserSettings :execrows
+DELETE
+FROM user_settings
+WHERE user_id IN (SELECT id FROM users WHERE users.deleted_at < $1::timestamptz)
+`
+
+// Removes the settings of users that are being purged so the users can be deleted afterwards.
+func (q *Queries) PurgeDeletedUserSettings(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUserSettings, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const upsertUserSetting = `-- name: UpsertUserSetting :one
+INSERT INTO user_settings (user_id, key, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, key) DO UPDATE
+    SET value      = excluded.value,
+        updated_at = STATEMENT_TIMESTAMP()
+RETURNING user_id, key, value, updated_at
+`
+
+type UpsertUserSettingParams struct {
+	UserID uuid.UUID       `json:"user_id"`
+	Key    string          `json:"key"`
+	Value  json.RawMessage `json:"value"`
+}
+
+func (q *Queries) UpsertUserSetting(ctx context.Context, arg UpsertUserSettingParams) (UserSetting, error) {
+	row := q.db.QueryRowContext(ctx, upsertUserSetting, arg.UserID, arg.Key, arg.Value)
+	var i UserSetting
+	err := row.Scan(
+		&i.UserID,
+		&i.Key,
+		&i.Value,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSetUserSettings(t *testing.T) {
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+	userID := created.User.ID
+
+	userSettings, err := store.SetUserSettingsTx(context.Background(), SetUserSettingsParams{
+		UserID: userID,
+		Values: map[string]json.RawMessage{
+			"locale": json.RawMessage(`"fr-FR"`),
+			"units":  json.RawMessage(`"imperial"`),
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, userSettings, 2)
+	require.Equal(t, "locale", userSettings[0].Key)
+	require.JSONEq(t, `"fr-FR"`, string(userSettings[0].Value))
+
+	userSettings, err = store.SetUserSettingsTx(context.Background(), SetUserSettingsParams{
+		UserID: userID,
+		Values: map[string]json.RawMessage{
+			"locale": nil,
+			"units":  json.RawMessage(`"metric"`),
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, userSettings, 1)
+	require.Equal(t, "units", userSettings[0].Key)
+	require.JSONEq(t, `"metric"`, string(userSettings[0].Value))
+
+	events, err := store.ListAuditEventsForUser(context.Background(), userID)
+	require.NoError(t, err)
+	event := events[len(events)-1]
+	require.Equal(t, AuditTargetUserSettings, event.TargetType)
+	require.JSONEq(t, `{"locale": "fr-FR", "units": "imperial"}`, string(event.Before))
+	require.JSONEq(t, `{"units": "metric"}`, string(event.After))
+}
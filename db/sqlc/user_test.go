@@ -3,7 +3,9 @@ package db
 import (
 	"context"
 	"database/sql"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 	"time"
 	"whaleWake/util"
@@ -39,7 +41,7 @@ func TestCreateUser(t *testing.T) {
 	user := createRandomUser(t)
 
 	t.Cleanup(func() {
-		_, err := testQueries.DeleteUser(context.Background(), user.ID)
+		_, err := testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 		if err != nil {
 			return
 		}
@@ -52,7 +54,7 @@ func TestGetUser(t *testing.T) {
 
 	// Cleanup should be run before the require statements because if the require statements fail, the cleanup will not be run
 	t.Cleanup(func() {
-		_, err := testQueries.DeleteUser(context.Background(), user1.ID)
+		_, err := testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user1.ID})
 		if err != nil {
 			return
 		}
@@ -70,6 +72,44 @@ func TestGetUser(t *testing.T) {
 	require.Equal(t, user1.VerifiedAt, user2.VerifiedAt)
 }
 
+func TestGetUserByEmailIgnoresCase(t *testing.T) {
+	user1 := createRandomUser(t)
+
+	t.Cleanup(func() {
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user1.ID})
+	})
+
+	user2, err := testQueries.GetUserByEmail(context.Background(), strings.ToUpper(user1.Email))
+	require.NoError(t, err)
+	require.Equal(t, user1.ID, user2.ID)
+}
+
+func TestCreateUserDuplicateIgnoresCase(t *testing.T) {
+	user1 := createRandomUser(t)
+
+	t.Cleanup(func() {
+		_, _ = testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user1.ID})
+	})
+
+	_, err := testQueries.CreateUser(context.Background(), CreateUserParams{
+		UserName: util.RandomUserName(),
+		Email:    strings.ToUpper(user1.Email),
+		Password: user1.Password,
+	})
+	field, ok := UniqueViolationField(err)
+	require.True(t, ok)
+	require.Equal(t, "email", field)
+
+	_, err = testQueries.CreateUser(context.Background(), CreateUserParams{
+		UserName: strings.ToUpper(user1.UserName),
+		Email:    util.RandomEmail(),
+		Password: user1.Password,
+	})
+	field, ok = UniqueViolationField(err)
+	require.True(t, ok)
+	require.Equal(t, "user_name", field)
+}
+
 func TestUpdateUser(t *testing.T) {
 	user1 := createRandomUser(t)
 
@@ -84,7 +124,7 @@ func TestUpdateUser(t *testing.T) {
 
 	// Cleanup should be run before the require statements because if the require statements fail, the cleanup will not be run
 	t.Cleanup(func() {
-		_, err := testQueries.DeleteUser(context.Background(), user1.ID)
+		_, err := testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user1.ID})
 		if err != nil {
 			return
 		}
@@ -101,13 +141,47 @@ func TestUpdateUser(t *testing.T) {
 	require.WithinDuration(t, user1.CreatedAt, user2.CreatedAt, time.Second)
 	require.NotEqual(t, user1.UpdatedAt, user2.UpdatedAt)
 	require.Equal(t, user1.VerifiedAt, user2.VerifiedAt)
+	require.Equal(t, user1.Version+1, user2.Version)
 
 }
 
+func TestUpdateUserStaleVersion(t *testing.T) {
+	user1 := createRandomUser(t)
+
+	t.Cleanup(func() {
+		_, err := testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user1.ID})
+		if err != nil {
+			return
+		}
+	})
+
+	arg := UpdateUserParams{
+		ID:              user1.ID,
+		UserName:        user1.UserName,
+		Email:           util.RandomEmail(),
+		Password:        user1.Password,
+		ExpectedVersion: sql.NullInt32{Int32: user1.Version, Valid: true},
+	}
+
+	user2, err := testQueries.UpdateUser(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, user1.Version+1, user2.Version)
+
+	// Replaying the update with the now stale version must not touch the row
+	arg.Email = util.RandomEmail()
+	_, err = testQueries.UpdateUser(context.Background(), arg)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	user3, err := testQueries.GetUser(context.Background(), user1.ID)
+	require.NoError(t, err)
+	require.Equal(t, user2.Email, user3.Email)
+	require.Equal(t, user2.Version, user3.Version)
+}
+
 func TestDeleteUser(t *testing.T) {
 	user1 := createRandomUser(t)
 
-	user1, err := testQueries.DeleteUser(context.Background(), user1.ID)
+	user1, err := testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user1.ID})
 	require.NoError(t, err)
 
 	user2, err := testQueries.GetUser(context.Background(), user1.ID)
@@ -124,15 +198,30 @@ func TestListUsers(t *testing.T) {
 	}
 
 	arg := ListUsersParams{
-		Limit:  5,
-		Offset: 5,
+		PageLimit: 5,
 	}
 
 	users, err := testQueries.ListUsers(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, users, 5)
+
+	// The next page starts strictly after the last row of this one
+	last := users[len(users)-1]
+	arg = ListUsersParams{
+		CursorCreatedAt: sql.NullTime{Time: last.CreatedAt, Valid: true},
+		CursorID:        uuid.NullUUID{UUID: last.ID, Valid: true},
+		PageLimit:       5,
+	}
+
+	nextUsers, err := testQueries.ListUsers(context.Background(), arg)
+	require.NoError(t, err)
+	for _, user := range nextUsers {
+		require.True(t, user.CreatedAt.After(last.CreatedAt) || (user.CreatedAt.Equal(last.CreatedAt) && user.ID.String() > last.ID.String()))
+	}
 
 	t.Cleanup(func() {
 		for _, user := range userSlice {
-			_, err := testQueries.DeleteUser(context.Background(), user.ID)
+			_, err := testQueries.DeleteUser(context.Background(), DeleteUserParams{ID: user.ID})
 			if err != nil {
 				return
 			}
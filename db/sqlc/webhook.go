@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Statuses of a webhook delivery.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// webhookMaxBackoff caps the wait between attempts of a webhook delivery.
+const webhookMaxBackoff = time.Hour
+
+// DeliverWebhooksParams holds the parameters for DeliverWebhooksTx.
+// Fields:
+// - Limit: The most deliveries to attempt.
+// - Now: The time deliveries have to be due by, and the time attempts are recorded at.
+// - MaxAttempts: How many failed attempts make a delivery dead.
+type DeliverWebhooksParams struct {
+	Limit       int32
+	Now         time.Time
+	MaxAttempts int32
+}
+
+// WebhookDispatchResult counts what happened to the deliveries DeliverWebhooksTx attempted.
+type WebhookDispatchResult struct {
+	Attempted int64 // Deliveries that were due and attempted.
+	Delivered int64 // Deliveries the endpoint accepted.
+	Dead      int64 // Deliveries that failed for the last time.
+}
+
+// DeliverWebhooksTx attempts the due webhook deliveries and records the outcome of each.
+// The deliveries stay locked while fn runs, so several dispatchers can run at once without sending the same
+// delivery twice. A failed delivery is tried again after a backoff, until it has failed MaxAttempts times and
+// is dead.
+// Parameters:
+// - ctx: The context for the transaction.
+// - arg: The limit, the current time, and the attempt limit.
+// - fn: Sends one delivery to the subscription's URL, signed with its secret. Returns the HTTP status code of
+// the response, if any, and an error unless the endpoint accepted the delivery.
+// Returns:
+// - What happened to the deliveries.
+// - An error if the transaction fails.
+func (store *SQLStore) DeliverWebhooksTx(ctx context.Context, arg DeliverWebhooksParams, fn func(ListDueWebhookDeliveriesRow) (int, error)) (WebhookDispatchResult, error) {
+	var result WebhookDispatchResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		result = WebhookDispatchResult{}
+		rows, err := q.ListDueWebhookDeliveries(ctx, ListDueWebhookDeliveriesParams{Now: arg.Now, PageLimit: arg.Limit})
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			delivery := row.WebhookDelivery
+			statusCode, sendErr := fn(row)
+			result.Attempted++
+
+			attempt := RecordWebhookDeliveryAttemptParams{
+				ID:             delivery.ID,
+				Status:         WebhookDeliveryDelivered,
+				NextAttemptAt:  delivery.NextAttemptAt,
+				AttemptedAt:    sql.NullTime{Time: arg.Now, Valid: true},
+				LastStatusCode: int32(statusCode),
+				DeliveredAt:    sql.NullTime{Time: arg.Now, Valid: true},
+			}
+			switch {
+			case sendErr == nil:
+				result.Delivered++
+			case delivery.Attempts+1 >= arg.MaxAttempts:
+				attempt.Status = WebhookDeliveryDead
+				attempt.LastError = sendErr.Error()
+				attempt.DeliveredAt = sql.NullTime{}
+				result.Dead++
+			default:
+				attempt.Status = WebhookDeliveryPending
+				attempt.NextAttemptAt = arg.Now.Add(webhookBackoff(delivery.Attempts))
+				attempt.LastError = sendErr.Error()
+				attempt.DeliveredAt = sql.NullTime{}
+			}
+
+			if _, err = q.RecordWebhookDeliveryAttempt(ctx, attempt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// webhookBackoff is how long to wait before the next attempt after attempts failed ones: ten seconds, doubling
+// each time, up to webhookMaxBackoff.
+func webhookBackoff(attempts int32) time.Duration {
+	if attempts >= 10 {
+		return webhookMaxBackoff
+	}
+	backoff := 10 * time.Second << uint(attempts)
+	if backoff > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,416 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: webhook.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createWebhookDeliveries = `-- name: CreateWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, user_id, data, occurred_at)
+SELECT s.id, o.id, o.event_type, o.user_id, o.data, o.created_at
+FROM outbox o
+         JOIN webhook_subscriptions s ON s.active AND o.event_type = ANY (s.event_types)
+WHERE o.id = $1
+`
+
+// A delivery of the outbox event to every active subscription to its type.
+func (q *Queries) CreateWebhookDeliveries(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createWebhookDeliveries, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const createWebhookSubscription = `-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (url, event_types, secret, active)
+VALUES ($1, $2, $3, $4) RETURNING id, url, event_types, secret, active, created_at, updated_at
+`
+
+type CreateWebhookSubscriptionParams struct {
+	Url        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+	Active     bool     `json:"active"`
+}
+
+func (q *Queries) CreateWebhookSubscription(ctx context.Context, arg CreateWebhookSubscriptionParams) (WebhookSubscription, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookSubscription,
+		arg.Url,
+		pq.Array(arg.EventTypes),
+		arg.Secret,
+		arg.Active,
+	)
+	var i WebhookSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		pq.Array(&i.EventTypes),
+		&i.Secret,
+		&i.Active,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteWebhookSubscription = `-- name: DeleteWebhookSubscription :one
+DELETE
+FROM webhook_subscriptions
+WHERE id = $1 RETURNING id, url, event_types, secret, active, created_at, updated_at
+`
+
+func (q *Queries) DeleteWebhookSubscription(ctx context.Context, id uuid.UUID) (WebhookSubscription, error) {
+	row := q.db.QueryRowContext(ctx, deleteWebhookSubscription, id)
+	var i WebhookSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		pq.Array(&i.EventTypes),
+		&i.Secret,
+		&i.Active,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getWebhookSubscription = `-- name: GetWebhookSubscription :one
+SELECT id, url, event_types, secret, active, created_at, updated_at
+FROM webhook_subscriptions
+WHERE id = $1
+`
+
+func (q *Queries) GetWebhookSubscription(ctx context.Context, id uuid.UUID) (WebhookSubscription, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookSubscription, id)
+	var i WebhookSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		pq.Array(&i.EventTypes),
+		&i.Secret,
+		&i.Active,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listDueWebhookDeliveries = `-- name: ListDueWebhookDeliveries :many
+SELECT d.id, d.subscription_id, d.event_id, d.event_type, d.user_id, d.data, d.occurred_at, d.status, d.attempts, d.next_attempt_at, d.last_attempt_at, d.last_status_code, d.last_error, d.delivered_at, d.created_at, s.url, s.secret
+FROM webhook_deliveries d
+         JOIN webhook_subscriptions s ON s.id = d.subscription_id
+WHERE d.status = 'pending'
+  AND d.next_attempt_at <= $1::timestamptz
+  AND s.active
+ORDER BY d.next_attempt_at, d.id
+LIMIT $2 FOR UPDATE OF d SKIP LOCKED
+`
+
+type ListDueWebhookDeliveriesParams struct {
+	Now       time.Time `json:"now"`
+	PageLimit int32     `json:"page_limit"`
+}
+
+type ListDueWebhookDeliveriesRow struct {
+	WebhookDelivery WebhookDelivery `json:"webhook_delivery"`
+	Url             string          `json:"url"`
+	Secret          string          `json:"secret"`
+}
+
+// Pending deliveries that are due, with where they go. Locks the deliveries for the rest of the transaction and
+// skips deliveries another dispatcher has locked. Deliveries of inactive subscriptions wait.
+func (q *Queries) ListDueWebhookDeliveries(ctx context.Context, arg ListDueWebhookDeliveriesParams) ([]ListDueWebhookDeliveriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listDueWebhookDeliveries, arg.Now, arg.PageLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListDueWebhookDeliveriesRow{}
+	for rows.Next() {
+		var i ListDueWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.WebhookDelivery.ID,
+			&i.WebhookDelivery.SubscriptionID,
+			&i.WebhookDelivery.EventID,
+			&i.WebhookDelivery.EventType,
+			&i.WebhookDelivery.UserID,
+			&i.WebhookDelivery.Data,
+			&i.WebhookDelivery.OccurredAt,
+			&i.WebhookDelivery.Status,
+			&i.WebhookDelivery.Attempts,
+			&i.WebhookDelivery.NextAttemptAt,
+			&i.WebhookDelivery.LastAttemptAt,
+			&i.WebhookDelivery.LastStatusCode,
+			&i.WebhookDelivery.LastError,
+			&i.WebhookDelivery.DeliveredAt,
+			&i.WebhookDelivery.CreatedAt,
+			&i.Url,
+			&i.Secret,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookDeliveries = `-- name: ListWebhookDeliveries :many
+SELECT id, subscription_id, event_id, event_type, user_id, data, occurred_at, status, attempts, next_attempt_at, last_attempt_at, last_status_code, last_error, delivered_at, created_at
+FROM webhook_deliveries
+WHERE subscription_id = $1
+  AND ($2::varchar IS NULL OR status = $2)
+ORDER BY id DESC
+LIMIT $4 OFFSET $3
+`
+
+type ListWebhookDeliveriesParams struct {
+	SubscriptionID uuid.UUID      `json:"subscription_id"`
+	Status         sql.NullString `json:"status"`
+	PageOffset     int32          `json:"page_offset"`
+	PageLimit      int32          `json:"page_limit"`
+}
+
+// A subscription's deliveries, newest first, optionally only those in one status.
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookDeliveries,
+		arg.SubscriptionID,
+		arg.Status,
+		arg.PageOffset,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []WebhookDelivery{}
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.SubscriptionID,
+			&i.EventID,
+			&i.EventType,
+			&i.UserID,
+			&i.Data,
+			&i.OccurredAt,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+			&i.LastStatusCode,
+			&i.LastError,
+			&i.DeliveredAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookSubscriptions = `-- name: ListWebhookSubscriptions :many
+SELECT id, url, event_types, secret, active, created_at, updated_at
+FROM webhook_subscriptions
+ORDER BY created_at, id
+`
+
+func (q *Queries) ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookSubscriptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []WebhookSubscription{}
+	for rows.Next() {
+		var i WebhookSubscription
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			pq.Array(&i.EventTypes),
+			&i.Secret,
+			&i.Active,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeliveredWebhookDeliveries = `-- name: PurgeDeliveredWebhookDeliveries :execrows
+DELETE
+FROM webhook_deliveries
+WHERE delivered_at < $1::timestamptz
+`
+
+func (q *Queries) PurgeDeliveredWebhookDeliveries(ctx context.Context, deliveredBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeliveredWebhookDeliveries, deliveredBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const recordWebhookDeliveryAttempt = `-- name: RecordWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries
+SET status           = $1,
+    attempts         = attempts + 1,
+    next_attempt_at  = $2,
+    last_attempt_at  = $3,
+    last_status_code = $4,
+    last_error       = $5,
+    delivered_at     = $6
+WHERE id = $7 RETURNING id, subscription_id, event_id, event_type, user_id, data, occurred_at, status, attempts, next_attempt_at, last_attempt_at, last_status_code, last_error, delivered_at, created_at
+`
+
+type RecordWebhookDeliveryAttemptParams struct {
+	Status         string       `json:"status"`
+	NextAttemptAt  time.Time    `json:"next_attempt_at"`
+	AttemptedAt    sql.NullTime `json:"attempted_at"`
+	LastStatusCode int32        `json:"last_status_code"`
+	LastError      string       `json:"last_error"`
+	DeliveredAt    sql.NullTime `json:"delivered_at"`
+	ID             int64        `json:"id"`
+}
+
+func (q *Queries) RecordWebhookDeliveryAttempt(ctx context.Context, arg RecordWebhookDeliveryAttemptParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, recordWebhookDeliveryAttempt,
+		arg.Status,
+		arg.NextAttemptAt,
+		arg.AttemptedAt,
+		arg.LastStatusCode,
+		arg.LastError,
+		arg.DeliveredAt,
+		arg.ID,
+	)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.SubscriptionID,
+		&i.EventID,
+		&i.EventType,
+		&i.UserID,
+		&i.Data,
+		&i.OccurredAt,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+		&i.LastStatusCode,
+		&i.LastError,
+		&i.DeliveredAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const redeliverWebhookDelivery = `-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status          = 'pending',
+    attempts        = 0,
+    next_attempt_at = STATEMENT_TIMESTAMP(),
+    delivered_at    = NULL
+WHERE id = $1
+  AND subscription_id = $2 RETURNING id, subscription_id, event_id, event_type, user_id, data, occurred_at, status, attempts, next_attempt_at, last_attempt_at, last_status_code, last_error, delivered_at, created_at
+`
+
+type RedeliverWebhookDeliveryParams struct {
+	ID             int64     `json:"id"`
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+}
+
+// Sends the delivery again as soon as possible, whatever its status, with a fresh set of attempts. The outcome
+// of the last attempt is kept until the next one.
+func (q *Queries) RedeliverWebhookDelivery(ctx context.Context, arg RedeliverWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, redeliverWebhookDelivery, arg.ID, arg.SubscriptionID)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.SubscriptionID,
+		&i.EventID,
+		&i.EventType,
+		&i.UserID,
+		&i.Data,
+		&i.OccurredAt,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+		&i.LastStatusCode,
+		&i.LastError,
+		&i.DeliveredAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const updateWebhookSubscription = `-- name: UpdateWebhookSubscription :one
+UPDATE webhook_subscriptions
+SET url         = $1,
+    event_types = $2,
+    secret      = COALESCE(NULLIF($3::varchar, ''), secret),
+    active      = $4,
+    updated_at  = STATEMENT_TIMESTAMP()
+WHERE id = $5 RETURNING id, url, event_types, secret, active, created_at, updated_at
+`
+
+type UpdateWebhookSubscriptionParams struct {
+	Url        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret"`
+	Active     bool      `json:"active"`
+	ID         uuid.UUID `json:"id"`
+}
+
+// An empty secret keeps the current one.
+func (q *Queries) UpdateWebhookSubscription(ctx context.Context, arg UpdateWebhookSubscriptionParams) (WebhookSubscription, error) {
+	row := q.db.QueryRowContext(ctx, updateWebhookSubscription,
+		arg.Url,
+		pq.Array(arg.EventTypes),
+		arg.Secret,
+		arg.Active,
+		arg.ID,
+	)
+	var i WebhookSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		pq.Array(&i.EventTypes),
+		&i.Secret,
+		&i.Active,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func createRandomWebhookSubscription(t *testing.T, eventTypes ...string) WebhookSubscription {
+	subscription, err := testQueries.CreateWebhookSubscription(context.Background(), CreateWebhookSubscriptionParams{
+		Url:        "https://partner.example.com/hooks",
+		EventTypes: eventTypes,
+		Secret:     "whsec_store-test",
+		Active:     true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = testQueries.DeleteWebhookSubscription(context.Background(), subscription.ID)
+	})
+	return subscription
+}
+
+func TestWebhookDeliveriesFollowEvents(t *testing.T) {
+	subscription := createRandomWebhookSubscription(t, EventUserDeleted)
+	store := NewStore(testDB)
+	created := createRandomUserTx(t, store)
+	_, err := store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: created.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
+	require.NoError(t, err)
+
+	deliveries, err := store.ListWebhookDeliveries(context.Background(), ListWebhookDeliveriesParams{
+		SubscriptionID: subscription.ID,
+		PageLimit:      10,
+	})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, EventUserDeleted, deliveries[0].EventType)
+	require.Equal(t, created.User.ID, deliveries[0].UserID)
+	require.Equal(t, WebhookDeliveryPending, deliveries[0].Status)
+
+	// An inactive subscription gets no deliveries of new events.
+	_, err = store.UpdateWebhookSubscription(context.Background(), UpdateWebhookSubscriptionParams{
+		ID:         subscription.ID,
+		Url:        subscription.Url,
+		EventTypes: subscription.EventTypes,
+		Active:     false,
+	})
+	require.NoError(t, err)
+	other := createRandomUserTx(t, store)
+	_, err = store.DeleteUserWithProfileAndRoleTX(context.Background(), DeleteUserParams{ID: other.User.ID}, DeleteUserProfileParams{}, DeleteUserRoleParams{})
+	require.NoError(t, err)
+
+	deliveries, err = store.ListWebhookDeliveries(context.Background(), ListWebhookDeliveriesParams{
+		SubscriptionID: subscription.ID,
+		PageLimit:      10,
+	})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+}
+
+func TestDeliverWebhooksTx(t *testing.T) {
+	subscription := createRandomWebhookSubscription(t, EventUserCreated)
+	store := NewStore(testDB)
+	createRandomUserTx(t, store)
+
+	// Deliveries of other tests' subscriptions are accepted, so they don't get in the way.
+	deliver := func(now time.Time, fail bool) {
+		_, err := store.DeliverWebhooksTx(context.Background(), DeliverWebhooksParams{Limit: 1000, Now: now, MaxAttempts: 2},
+			func(row ListDueWebhookDeliveriesRow) (int, error) {
+				if fail && row.WebhookDelivery.SubscriptionID == subscription.ID {
+					return http.StatusBadGateway, errors.New("webhook responded 502 Bad Gateway")
+				}
+				return http.StatusOK, nil
+			})
+		require.NoError(t, err)
+	}
+	ours := func() WebhookDelivery {
+		deliveries, err := store.ListWebhookDeliveries(context.Background(), ListWebhookDeliveriesParams{
+			SubscriptionID: subscription.ID,
+			PageLimit:      10,
+		})
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		return deliveries[0]
+	}
+
+	now := time.Now()
+	deliver(now, true)
+	delivery := ours()
+	require.Equal(t, WebhookDeliveryPending, delivery.Status)
+	require.Equal(t, int32(1), delivery.Attempts)
+	require.Equal(t, int32(http.StatusBadGateway), delivery.LastStatusCode)
+	require.WithinDuration(t, now.Add(10*time.Second), delivery.NextAttemptAt, time.Second)
+
+	deliver(now.Add(time.Minute), true)
+	delivery = ours()
+	require.Equal(t, WebhookDeliveryDead, delivery.Status)
+	require.False(t, delivery.DeliveredAt.Valid)
+
+	delivery, err := store.RedeliverWebhookDelivery(context.Background(), RedeliverWebhookDeliveryParams{
+		ID:             delivery.ID,
+		SubscriptionID: subscription.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, WebhookDeliveryPending, delivery.Status)
+	require.Zero(t, delivery.Attempts)
+
+	deliver(time.Now().Add(time.Minute), false)
+	delivery = ours()
+	require.Equal(t, WebhookDeliveryDelivered, delivery.Status)
+	require.True(t, delivery.DeliveredAt.Valid)
+	require.Empty(t, delivery.LastError)
+
+	_, err = store.RedeliverWebhookDelivery(context.Background(), RedeliverWebhookDeliveryParams{
+		ID:             delivery.ID + 1_000_000,
+		SubscriptionID: subscription.ID,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -0,0 +1,122 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"whaleWake/util"
+)
+
+// Publisher kinds accepted by NewFromConfig.
+const (
+	KindLog     = "log"
+	KindFile    = "file"
+	KindWebhook = "webhook"
+	KindNATS    = "nats"
+)
+
+var (
+	ErrUnknownKind = errors.New("unknown event publisher")
+	ErrMissingPath = errors.New("the file event publisher needs a path")
+	ErrMissingURL  = errors.New("the webhook event publisher needs a URL")
+	ErrMissingAddr = errors.New("the NATS event publisher needs an address")
+)
+
+// Event is a user lifecycle event as published to other services.
+// Fields:
+// - ID: Increases with every event recorded; a consumer that sees an ID again has seen that event before.
+// - Position: Set on streamed events only. Increases in the order the events' transactions committed, which the
+// IDs don't always follow, so it is what a stream resumes from.
+// - Type: The event type, such as "user.created".
+// - UserID: The user the event is about. Events of one user are published in order.
+// - OccurredAt: When the change was committed.
+// - Data: Details of the event. Never personal data; consumers fetch the user for that.
+type Event struct {
+	ID         int64           `json:"id"`
+	Position   int64           `json:"position,omitempty"`
+	Type       string          `json:"type"`
+	UserID     uuid.UUID       `json:"user_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Publisher delivers events to other services. Publish returns once the event has been accepted, so a nil error
+// means the event is not published again. Delivery is at least once: after an error the event is published
+// again, so consumers should skip IDs they have already seen.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// NewFromConfig builds the publisher named by EVENT_PUBLISHER.
+// Parameters:
+// - config: EVENT_PUBLISHER selects KindLog (the default), KindFile, which appends to EVENT_FILE_PATH,
+// KindWebhook, which posts to EVENT_WEBHOOK_URL, or KindNATS, which publishes to a NATS server at EVENT_NATS_ADDRESS
+// under the subject EVENT_NATS_SUBJECT followed by the event type.
+// Returns:
+// - The publisher, or an error if the kind is unknown or its settings are incomplete.
+func NewFromConfig(config util.Config) (Publisher, error) {
+	switch config.EventPublisher {
+	case "", KindLog:
+		return LogPublisher{}, nil
+	case KindFile:
+		if config.EventFilePath == "" {
+			return nil, ErrMissingPath
+		}
+		return &FilePublisher{path: config.EventFilePath}, nil
+	case KindWebhook:
+		if config.EventWebhookURL == "" {
+			return nil, ErrMissingURL
+		}
+		return NewWebhookPublisher(config.EventWebhookURL), nil
+	case KindNATS:
+		if config.EventNATSAddress == "" {
+			return nil, ErrMissingAddr
+		}
+		return NewNATSPublisher(config.EventNATSAddress, config.EventNATSSubject), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKind, config.EventPublisher)
+	}
+}
+
+// LogPublisher writes events to the standard logger instead of publishing them.
+type LogPublisher struct{}
+
+// Publish logs the event.
+func (LogPublisher) Publish(_ context.Context, event Event) error {
+	log.Printf("Event %d %s for user %s: %s", event.ID, event.Type, event.UserID, event.Data)
+	return nil
+}
+
+// FilePublisher appends events to a file as JSON lines, so local tools can read them.
+type FilePublisher struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Publish appends the event to the file, creating it if needed.
+func (publisher *FilePublisher) Publish(_ context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	file, err := os.OpenFile(publisher.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,261 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"whaleWake/util"
+)
+
+func randomEvent(id int64) Event {
+	return Event{
+		ID:         id,
+		Type:       "user.created",
+		UserID:     util.RandomUUID(),
+		OccurredAt: time.Now().UTC().Truncate(time.Second),
+		Data:       json.RawMessage(`{"version":1}`),
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	publisher, err := NewFromConfig(util.Config{})
+	require.NoError(t, err)
+	require.IsType(t, LogPublisher{}, publisher)
+	require.NoError(t, publisher.Publish(context.Background(), randomEvent(1)))
+
+	_, err = NewFromConfig(util.Config{EventPublisher: KindFile})
+	require.ErrorIs(t, err, ErrMissingPath)
+
+	_, err = NewFromConfig(util.Config{EventPublisher: KindWebhook})
+	require.ErrorIs(t, err, ErrMissingURL)
+
+	_, err = NewFromConfig(util.Config{EventPublisher: KindNATS})
+	require.ErrorIs(t, err, ErrMissingAddr)
+
+	_, err = NewFromConfig(util.Config{EventPublisher: "carrier-pigeon"})
+	require.ErrorIs(t, err, ErrUnknownKind)
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	publisher, err := NewFromConfig(util.Config{EventPublisher: KindFile, EventFilePath: path})
+	require.NoError(t, err)
+
+	first, second := randomEvent(1), randomEvent(2)
+	require.NoError(t, publisher.Publish(context.Background(), first))
+	require.NoError(t, publisher.Publish(context.Background(), second))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var event Event
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	require.Equal(t, second.ID, event.ID)
+	require.Equal(t, second.UserID, event.UserID)
+	require.JSONEq(t, string(second.Data), string(event.Data))
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	var received []Event
+	status := http.StatusNoContent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var event Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		require.Equal(t, strconv.FormatInt(event.ID, 10), r.Header.Get("Event-ID"))
+		require.Equal(t, event.Type, r.Header.Get("Event-Type"))
+		received = append(received, event)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	publisher := NewWebhookPublisher(receiver.URL)
+	require.NoError(t, publisher.Publish(context.Background(), randomEvent(7)))
+	require.Len(t, received, 1)
+	require.Equal(t, int64(7), received[0].ID)
+
+	status = http.StatusServiceUnavailable
+	require.Error(t, publisher.Publish(context.Background(), randomEvent(8)))
+}
+
+func TestWebhookSender(t *testing.T) {
+	const secret = "whsec_test-secret"
+	now := time.Unix(1_800_000_000, 0)
+	var checked int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, "42", r.Header.Get(HeaderWebhookID))
+		require.Equal(t, strconv.FormatInt(now.Unix(), 10), r.Header.Get(HeaderWebhookTimestamp))
+
+		timestamp, signature := r.Header.Get(HeaderWebhookTimestamp), r.Header.Get(HeaderWebhookSignature)
+		require.NoError(t, VerifySignature(secret, timestamp, signature, body, 5*time.Minute, now.Add(time.Minute)))
+		require.NoError(t, VerifySignature(secret, timestamp, "v1=stale "+signature, body, 5*time.Minute, now))
+		require.ErrorIs(t, VerifySignature("whsec_other", timestamp, signature, body, 5*time.Minute, now), ErrSignatureMismatch)
+		require.ErrorIs(t, VerifySignature(secret, timestamp, signature, append(body, ' '), 5*time.Minute, now), ErrSignatureMismatch)
+		require.ErrorIs(t, VerifySignature(secret, timestamp, signature, body, 5*time.Minute, now.Add(time.Hour)), ErrSignatureExpired)
+		checked++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer receiver.Close()
+
+	sender := NewWebhookSender(time.Second)
+	sender.now = func() time.Time { return now }
+
+	status, err := sender.Send(context.Background(), receiver.URL, secret, 42, randomEvent(7))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, status)
+	require.Equal(t, 1, checked)
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	status, err = sender.Send(context.Background(), unreachable.URL, secret, 43, randomEvent(8))
+	require.Error(t, err)
+	require.Zero(t, status)
+}
+
+// natsTestServer speaks enough of the NATS protocol to accept publishes, and records the subjects and payloads it is sent.
+type natsTestServer struct {
+	listener net.Listener
+	messages chan [2]string
+	reject   atomic.Bool
+}
+
+func newNATSTestServer(t *testing.T) *natsTestServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &natsTestServer{listener: listener, messages: make(chan [2]string, 10)}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *natsTestServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	_, _ = conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[0] == "PUB":
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err = io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			if server.reject.Load() {
+				_, _ = conn.Write([]byte("-ERR 'Permissions Violation'\r\n"))
+				continue
+			}
+			// A server PING in between must be answered before the PONG arrives.
+			_, _ = conn.Write([]byte("PING\r\n"))
+			server.messages <- [2]string{fields[1], string(payload[:size])}
+		case len(fields) == 1 && fields[0] == "PING":
+			_, _ = conn.Write([]byte("PONG\r\n"))
+		}
+	}
+}
+
+func TestNATSPublisher(t *testing.T) {
+	server := newNATSTestServer(t)
+	publisher := NewNATSPublisher("nats://"+server.listener.Addr().String(), "whalewake")
+	defer publisher.Close()
+
+	for id := int64(1); id <= 2; id++ {
+		event := randomEvent(id)
+		require.NoError(t, publisher.Publish(context.Background(), event))
+
+		message := <-server.messages
+		require.Equal(t, "whalewake.user.created", message[0])
+		var received Event
+		require.NoError(t, json.Unmarshal([]byte(message[1]), &received))
+		require.Equal(t, event.ID, received.ID)
+	}
+
+	server.reject.Store(true)
+	require.ErrorContains(t, publisher.Publish(context.Background(), randomEvent(3)), "Permissions Violation")
+}
+
+func TestNATSPublisherUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	publisher := NewNATSPublisher(address, "whalewake")
+	require.Error(t, publisher.Publish(context.Background(), randomEvent(1)))
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub(2)
+	first, unsubscribeFirst := hub.Subscribe()
+	second, unsubscribeSecond := hub.Subscribe()
+	defer unsubscribeSecond()
+
+	hub.Broadcast(randomEvent(1))
+	require.Equal(t, int64(1), (<-first).ID)
+	require.Equal(t, int64(1), (<-second).ID)
+
+	// The second subscriber stops reading and is dropped once it is more than two events behind.
+	for id := int64(2); id <= 4; id++ {
+		hub.Broadcast(randomEvent(id))
+		require.Equal(t, id, (<-first).ID)
+	}
+	require.Equal(t, int64(2), (<-second).ID)
+	require.Equal(t, int64(3), (<-second).ID)
+	_, ok := <-second
+	require.False(t, ok)
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	_, ok = <-first
+	require.False(t, ok)
+	hub.Broadcast(randomEvent(5))
+}
+
+func TestDecodeNotification(t *testing.T) {
+	// The payload as built by the outbox trigger, with Postgres' timestamp format.
+	payload := `{"id" : 12, "position" : 10, "type" : "user.updated", "user_id" : "6f1c2a8e-2f4b-4c1e-9a51-0d7e4b3c2a10", ` +
+		`"occurred_at" : "2026-10-18T09:30:15.123456+00:00", "data" : {"version": 3}}`
+
+	event, err := decodeNotification(payload)
+	require.NoError(t, err)
+	require.Equal(t, int64(12), event.ID)
+	require.Equal(t, int64(10), event.Position)
+	require.Equal(t, "user.updated", event.Type)
+	require.Equal(t, "6f1c2a8e-2f4b-4c1e-9a51-0d7e4b3c2a10", event.UserID.String())
+	require.Equal(t, time.Date(2026, 10, 18, 9, 30, 15, 123456000, time.UTC), event.OccurredAt.UTC())
+	require.JSONEq(t, `{"version": 3}`, string(event.Data))
+
+	_, err = decodeNotification("12")
+	require.Error(t, err)
+}
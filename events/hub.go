@@ -0,0 +1,58 @@
+package events
+
+import (
+	"sync"
+)
+
+// Hub hands each event it is given to every current subscriber, for streaming events to clients as they happen.
+// A subscriber that falls behind by more than its buffer is dropped, and its channel closed, rather than slowing
+// down the others; it can subscribe again and catch up from the outbox.
+type Hub struct {
+	buffer int
+
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// NewHub creates a hub whose subscribers can fall buffer events behind.
+func NewHub(buffer int) *Hub {
+	return &Hub{buffer: buffer, subscribers: map[chan Event]struct{}{}}
+}
+
+// Subscribe returns a channel of the events broadcast from now on, and a function that cancels the subscription.
+// The channel is closed when the subscription is cancelled or the subscriber falls behind.
+func (hub *Hub) Subscribe() (<-chan Event, func()) {
+	events := make(chan Event, hub.buffer)
+
+	hub.mu.Lock()
+	hub.subscribers[events] = struct{}{}
+	hub.mu.Unlock()
+
+	return events, func() {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		hub.drop(events)
+	}
+}
+
+// Broadcast gives the event to every subscriber.
+func (hub *Hub) Broadcast(event Event) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for events := range hub.subscribers {
+		select {
+		case events <- event:
+		default:
+			hub.drop(events)
+		}
+	}
+}
+
+// drop removes a subscriber and closes its channel, once. The caller holds mu.
+func (hub *Hub) drop(events chan Event) {
+	if _, ok := hub.subscribers[events]; ok {
+		delete(hub.subscribers, events)
+		close(events)
+	}
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsTimeout bounds connecting to the server and each publish.
+const natsTimeout = 10 * time.Second
+
+// NATSPublisher publishes events to a NATS server, or any broker speaking the NATS client protocol, under the
+// subject "<subject>.<event type>", e.g. "whalewake.user.created". It speaks just enough of the text protocol to
+// publish: each event is followed by a PING, and the event counts as accepted once the server's PONG arrives.
+type NATSPublisher struct {
+	address string
+	subject string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewNATSPublisher creates a publisher for the server at address, host:port. The connection is opened on the
+// first publish and opened again after an error.
+func NewNATSPublisher(address, subject string) *NATSPublisher {
+	return &NATSPublisher{address: strings.TrimPrefix(address, "nats://"), subject: subject}
+}
+
+// Publish sends the event and waits for the server to confirm it.
+func (publisher *NATSPublisher) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	subject := event.Type
+	if publisher.subject != "" {
+		subject = publisher.subject + "." + event.Type
+	}
+
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	err = publisher.publish(ctx, subject, payload)
+	if err != nil {
+		publisher.close()
+	}
+	return err
+}
+
+// Close closes the connection, if open.
+func (publisher *NATSPublisher) Close() error {
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	publisher.close()
+	return nil
+}
+
+func (publisher *NATSPublisher) publish(ctx context.Context, subject string, payload []byte) error {
+	if publisher.conn == nil {
+		if err := publisher.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	deadline := time.Now().Add(natsTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := publisher.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+	if _, err := publisher.conn.Write([]byte(message)); err != nil {
+		return err
+	}
+	return publisher.awaitPong()
+}
+
+// connect dials the server, reads its INFO, and introduces the client.
+func (publisher *NATSPublisher) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: natsTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", publisher.address)
+	if err != nil {
+		return err
+	}
+	publisher.conn = conn
+	publisher.reader = bufio.NewReader(conn)
+
+	if err = conn.SetDeadline(time.Now().Add(natsTimeout)); err != nil {
+		return err
+	}
+	line, err := publisher.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO") {
+		return fmt.Errorf("unexpected greeting from NATS server: %q", line)
+	}
+
+	_, err = conn.Write([]byte(`CONNECT {"verbose":false,"pedantic":false,"name":"whaleWake"}` + "\r\n"))
+	return err
+}
+
+// awaitPong reads until the server answers the PING sent after a publish, answering the server's own PINGs.
+func (publisher *NATSPublisher) awaitPong() error {
+	for {
+		line, err := publisher.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err = publisher.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("NATS server error: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (publisher *NATSPublisher) readLine() (string, error) {
+	line, err := publisher.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (publisher *NATSPublisher) close() {
+	if publisher.conn != nil {
+		_ = publisher.conn.Close()
+		publisher.conn = nil
+		publisher.reader = nil
+	}
+}
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/lib/pq"
+	"log"
+	"time"
+)
+
+// PostgresChannel is the channel the outbox trigger announces every new event on.
+const PostgresChannel = "user_events"
+
+// How long the listener waits before connecting again after losing its connection, at first and at most.
+const (
+	listenerMinReconnect = time.Second
+	listenerMaxReconnect = time.Minute
+)
+
+// listenerPingInterval is how often an idle listener checks its connection is still alive.
+const listenerPingInterval = 90 * time.Second
+
+// ListenPostgres broadcasts the events announced on PostgresChannel to hub until ctx is cancelled. Events are
+// announced when the transaction that recorded them commits, so they arrive in commit order. Events announced
+// while the connection is down are missed; streams catch up from the outbox when they reconnect.
+// Parameters:
+// - ctx: Stops listening when cancelled.
+// - dataSource: The connection string of the database.
+// - hub: The hub to broadcast events to.
+// Returns:
+// - An error if the channel could not be listened on.
+func ListenPostgres(ctx context.Context, dataSource string, hub *Hub) error {
+	listener := pq.NewListener(dataSource, listenerMinReconnect, listenerMaxReconnect, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("Event listener connection problem:", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(PostgresChannel); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-listener.Notify:
+			// A nil notification means the connection was re-established.
+			if notification == nil {
+				continue
+			}
+			event, err := decodeNotification(notification.Extra)
+			if err != nil {
+				log.Println("Unable to decode event notification:", err)
+				continue
+			}
+			hub.Broadcast(event)
+		case <-ping.C:
+			go func() { _ = listener.Ping() }()
+		}
+	}
+}
+
+// decodeNotification reads the event in the payload of a notification from the outbox trigger.
+func decodeNotification(payload string) (Event, error) {
+	var event Event
+	err := json.Unmarshal([]byte(payload), &event)
+	return event, err
+}
@@ -0,0 +1,154 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webhookTimeout bounds a single delivery to the webhook.
+const webhookTimeout = 10 * time.Second
+
+// Headers of signed webhook deliveries, see WebhookSender.
+const (
+	HeaderWebhookID        = "Webhook-ID"
+	HeaderWebhookTimestamp = "Webhook-Timestamp"
+	HeaderWebhookSignature = "Webhook-Signature"
+)
+
+var (
+	ErrSignatureMismatch = errors.New("webhook signature does not match")
+	ErrSignatureExpired  = errors.New("webhook timestamp is outside the tolerance")
+)
+
+// WebhookPublisher posts each event as JSON to a URL. Any 2xx response accepts the event.
+type WebhookPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPublisher creates a publisher that posts to url.
+func NewWebhookPublisher(url string) *WebhookPublisher {
+	return &WebhookPublisher{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Publish posts the event. The event ID and type are also sent in the Event-ID and Event-Type headers, so
+// receivers can drop duplicates without parsing the body.
+func (publisher *WebhookPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = postEvent(ctx, publisher.client, publisher.url, event, body, nil)
+	return err
+}
+
+// WebhookSender delivers events to the webhooks admins subscribe, signing each delivery with the subscription's
+// secret. Besides the Event-ID and Event-Type headers of WebhookPublisher, a delivery carries:
+// - Webhook-ID: The delivery ID, the same for every attempt of the delivery.
+// - Webhook-Timestamp: When the attempt was made, in Unix seconds.
+// - Webhook-Signature: "v1=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret.
+// Receivers check the signature with VerifySignature, and reject old timestamps to stop replays.
+type WebhookSender struct {
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewWebhookSender creates a sender whose attempts give up after timeout.
+func NewWebhookSender(timeout time.Duration) *WebhookSender {
+	return &WebhookSender{client: &http.Client{Timeout: timeout}, now: time.Now}
+}
+
+// Send posts the event to url as delivery deliveryID, signed with secret.
+// Returns:
+// - The HTTP status code of the response, or 0 if there was none.
+// - An error unless the response was a 2xx.
+func (sender *WebhookSender) Send(ctx context.Context, url, secret string, deliveryID int64, event Event) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := sender.now()
+	return postEvent(ctx, sender.client, url, event, body, map[string]string{
+		HeaderWebhookID:        strconv.FormatInt(deliveryID, 10),
+		HeaderWebhookTimestamp: strconv.FormatInt(timestamp.Unix(), 10),
+		HeaderWebhookSignature: Sign(secret, timestamp, body),
+	})
+}
+
+// Sign returns the Webhook-Signature header of a delivery of body at timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the headers of a delivery the way a receiver should.
+// Parameters:
+// - secret: The subscription's secret.
+// - timestamp, signature: The Webhook-Timestamp and Webhook-Signature headers.
+// - body: The raw request body.
+// - tolerance: How far the timestamp may be from now.
+// - now: The current time.
+// Returns:
+// - ErrSignatureExpired if the timestamp is missing or too far off, ErrSignatureMismatch if the signature is wrong.
+func VerifySignature(secret, timestamp, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSignatureExpired
+	}
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-tolerance)) || signedAt.After(now.Add(tolerance)) {
+		return ErrSignatureExpired
+	}
+
+	expected := Sign(secret, signedAt, body)
+	// Several signatures may be sent, separated by spaces, while a secret is being rotated.
+	for _, candidate := range strings.Fields(signature) {
+		if hmac.Equal([]byte(candidate), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrSignatureMismatch
+}
+
+// postEvent posts the JSON body of event with the Event-ID, Event-Type, and extra headers.
+// Returns the status code of the response, if any, and an error unless it was a 2xx.
+func postEvent(ctx context.Context, client *http.Client, url string, event Event, body []byte, headers map[string]string) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Event-ID", strconv.FormatInt(event.ID, 10))
+	request.Header.Set("Event-Type", event.Type)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("webhook responded %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
@@ -0,0 +1,199 @@
+// Package geo validates and normalizes postal addresses: country codes against ISO 3166-1, states against the
+// ISO 3166-2 subdivisions of the countries listed in subdivisions.tab, and postal codes against per-country formats.
+// It also parses phone numbers into E.164 format.
+package geo
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//go:embed countries.tab
+var countriesTab string
+
+//go:embed subdivisions.tab
+var subdivisionsTab string
+
+// Field names used in FieldError. They match the JSON names of the address fields in API requests.
+const (
+	FieldStreetAddress = "street_address"
+	FieldCity          = "city"
+	FieldState         = "state"
+	FieldZip           = "zip"
+	FieldCountryCode   = "country_code"
+)
+
+// Error codes used in FieldError.
+const (
+	CodeCountry     = "iso3166_1"
+	CodeSubdivision = "iso3166_2"
+	CodePostalCode  = "postal_code"
+)
+
+var (
+	// countries maps each ISO 3166-1 alpha-2 code to its name.
+	countries = map[string]string{}
+	// subdivisions maps a country code to its subdivision codes (without the country prefix) and their names.
+	subdivisions = map[string]map[string]string{}
+	// subdivisionNames maps a country code to its upper-cased subdivision names and their codes.
+	subdivisionNames = map[string]map[string]string{}
+)
+
+func init() {
+	for _, fields := range parseTab(countriesTab) {
+		countries[fields[0]] = fields[1]
+	}
+
+	for _, fields := range parseTab(subdivisionsTab) {
+		country, code, _ := strings.Cut(fields[0], "-")
+		if subdivisions[country] == nil {
+			subdivisions[country] = map[string]string{}
+			subdivisionNames[country] = map[string]string{}
+		}
+		subdivisions[country][code] = fields[1]
+		// A name shared by several subdivisions stands for the first, the highest level.
+		name := strings.ToUpper(fields[1])
+		if _, ok := subdivisionNames[country][name]; !ok {
+			subdivisionNames[country][name] = code
+		}
+	}
+}
+
+// parseTab splits an embedded table into its tab-separated lines, skipping comments.
+func parseTab(tab string) [][]string {
+	var rows [][]string
+	for _, line := range strings.Split(tab, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rows = append(rows, strings.SplitN(line, "\t", 2))
+	}
+	return rows
+}
+
+// Address holds the fields of a postal address that Normalize checks.
+type Address struct {
+	StreetAddress string
+	City          string
+	State         string
+	Zip           string
+	CountryCode   string
+}
+
+// FieldError describes one invalid address field.
+// Fields:
+// - Field: One of the Field constants.
+// - Code: One of the Code constants.
+// - Message: What is wrong, for people.
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Errors lists every invalid field of an address.
+type Errors []FieldError
+
+func (errs Errors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Field + " " + err.Message
+	}
+	return "invalid address: " + strings.Join(messages, "; ")
+}
+
+// Normalize validates an address and returns it normalized.
+// Surrounding whitespace is trimmed and inner runs of whitespace collapsed in every field. Country codes are
+// upper-cased. For countries with known subdivisions the state may be given as its code, with or without the
+// country prefix, or its name, and comes back as the bare code, e.g. "US-ca" and "california" become "CA".
+// Postal codes are upper-cased and written in the country's usual format, e.g. "k1a0b1" becomes "K1A 0B1".
+// Street address and city are otherwise left as they are.
+// Parameters:
+// - address: The address as entered.
+// Returns:
+// - The normalized address.
+// - Errors listing every field that is invalid, or nil.
+func Normalize(address Address) (Address, error) {
+	address = Address{
+		StreetAddress: collapseSpace(address.StreetAddress),
+		City:          collapseSpace(address.City),
+		State:         collapseSpace(address.State),
+		Zip:           strings.ToUpper(collapseSpace(address.Zip)),
+		CountryCode:   strings.ToUpper(collapseSpace(address.CountryCode)),
+	}
+
+	if _, ok := countries[address.CountryCode]; !ok {
+		return address, Errors{{
+			Field:   FieldCountryCode,
+			Code:    CodeCountry,
+			Message: "must be an ISO 3166-1 alpha-2 country code",
+		}}
+	}
+
+	var errs Errors
+
+	if state, ok := normalizeSubdivision(address.CountryCode, address.State); ok {
+		address.State = state
+	} else {
+		errs = append(errs, FieldError{
+			Field:   FieldState,
+			Code:    CodeSubdivision,
+			Message: fmt.Sprintf("must be an ISO 3166-2 subdivision of %s", address.CountryCode),
+		})
+	}
+
+	if zip, err := normalizePostalCode(address.CountryCode, address.Zip); err == nil {
+		address.Zip = zip
+	} else {
+		errs = append(errs, FieldError{Field: FieldZip, Code: CodePostalCode, Message: err.Error()})
+	}
+
+	if errs != nil {
+		return address, errs
+	}
+	return address, nil
+}
+
+// normalizeSubdivision returns the subdivision code of state within country.
+// Countries without listed subdivisions accept any state as it is.
+func normalizeSubdivision(country, state string) (string, bool) {
+	codes, ok := subdivisions[country]
+	if !ok {
+		return state, true
+	}
+
+	code := strings.TrimPrefix(strings.ToUpper(state), country+"-")
+	if _, ok := codes[code]; ok {
+		return code, true
+	}
+
+	code, ok = subdivisionNames[country][strings.ToUpper(state)]
+	return code, ok
+}
+
+// IsCountry reports whether code is an ISO 3166-1 alpha-2 country code. It is case-sensitive.
+func IsCountry(code string) bool {
+	_, ok := countries[code]
+	return ok
+}
+
+// Subdivisions returns the sorted subdivision codes of a country, without the country prefix, or nil when the
+// country's subdivisions are not checked.
+func Subdivisions(country string) []string {
+	codes := make([]string, 0, len(subdivisions[country]))
+	for code := range subdivisions[country] {
+		codes = append(codes, code)
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// collapseSpace trims s and replaces each inner run of whitespace with a single space.
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,148 @@
+package geo
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		name     string
+		address  Address
+		expected Address
+		fields   []string
+	}{
+		{
+			name:     "US",
+			address:  Address{StreetAddress: "  1  Main   St ", City: "Springfield", State: "il", Zip: " 62701 ", CountryCode: "us"},
+			expected: Address{StreetAddress: "1 Main St", City: "Springfield", State: "IL", Zip: "62701", CountryCode: "US"},
+		},
+		{
+			name:     "USStateNameAndZipPlusFour",
+			address:  Address{State: "new york", Zip: "100011234", CountryCode: "US"},
+			expected: Address{State: "NY", Zip: "10001-1234", CountryCode: "US"},
+		},
+		{
+			name:     "PrefixedSubdivision",
+			address:  Address{State: "CA-on", Zip: "k1a0b1", CountryCode: "CA"},
+			expected: Address{State: "ON", Zip: "K1A 0B1", CountryCode: "CA"},
+		},
+		{
+			name:     "SubdivisionName",
+			address:  Address{State: "england", Zip: "sw1a1aa", CountryCode: "GB"},
+			expected: Address{State: "ENG", Zip: "SW1A 1AA", CountryCode: "GB"},
+		},
+		{
+			name:     "SharedSubdivisionName",
+			address:  Address{State: "Barishal", Zip: "8200", CountryCode: "BD"},
+			expected: Address{State: "A", Zip: "8200", CountryCode: "BD"},
+		},
+		{
+			name:     "UnlistedSubdivisions",
+			address:  Address{State: "Kowloon", CountryCode: "HK"},
+			expected: Address{State: "Kowloon", CountryCode: "HK"},
+		},
+		{
+			name:     "NoPostalCodes",
+			address:  Address{State: "du", CountryCode: "AE"},
+			expected: Address{State: "DU", CountryCode: "AE"},
+		},
+		{
+			name:     "AnyPostalCode",
+			address:  Address{State: "Reykjavikurborg", Zip: "101", CountryCode: "IS"},
+			expected: Address{State: "RKV", Zip: "101", CountryCode: "IS"},
+		},
+		{
+			name:    "UnknownCountry",
+			address: Address{State: "XX", Zip: "whatever", CountryCode: "ZZ"},
+			fields:  []string{FieldCountryCode},
+		},
+		{
+			name:    "BadStateAndZip",
+			address: Address{State: "QQ", Zip: "1234", CountryCode: "US"},
+			fields:  []string{FieldState, FieldZip},
+		},
+		{
+			name:    "MissingZip",
+			address: Address{State: "BY", CountryCode: "DE"},
+			fields:  []string{FieldZip},
+		},
+		{
+			name:    "UnexpectedZip",
+			address: Address{State: "DA", Zip: "12345", CountryCode: "QA"},
+			fields:  []string{FieldZip},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			address, err := Normalize(tc.address)
+			if tc.fields == nil {
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, address)
+				return
+			}
+
+			var errs Errors
+			require.ErrorAs(t, err, &errs)
+			fields := make([]string, len(errs))
+			for i, fieldErr := range errs {
+				fields[i] = fieldErr.Field
+			}
+			require.Equal(t, tc.fields, fields)
+		})
+	}
+}
+
+func TestSubdivisions(t *testing.T) {
+	states := Subdivisions("US")
+	require.Contains(t, states, "CA")
+	require.Contains(t, states, "DC")
+	require.IsIncreasing(t, states)
+	require.Contains(t, Subdivisions("FR"), "IDF")
+	require.Contains(t, Subdivisions("FR"), "75")
+	require.Nil(t, Subdivisions("HK"))
+
+	require.True(t, IsCountry("NZ"))
+	require.False(t, IsCountry("nz"))
+}
+
+func TestNormalizePhone(t *testing.T) {
+	testCases := []struct {
+		name     string
+		number   string
+		country  string
+		expected string
+		ok       bool
+	}{
+		{name: "International", number: "+1 (415) 555-0123", expected: "+14155550123", ok: true},
+		{name: "InternationalDoubleZero", number: "0044 20 7946 0958", country: "US", expected: "+442079460958", ok: true},
+		{name: "NationalUS", number: "415.555.0123", country: "us", expected: "+14155550123", ok: true},
+		{name: "NationalUSTrunkPrefix", number: "1-415-555-0123", country: "US", expected: "+14155550123", ok: true},
+		{name: "NationalGB", number: "020 7946 0958", country: "GB", expected: "+442079460958", ok: true},
+		{name: "NationalIT", number: "06 6982 1234", country: "IT", expected: "+390669821234", ok: true},
+		{name: "NationalRU", number: "8 495 123-45-67", country: "RU", expected: "+74951234567", ok: true},
+		{name: "Letters", number: "+1 415 CALL NOW", ok: false},
+		{name: "Empty", number: " ", country: "US", ok: false},
+		{name: "BadAreaCode", number: "+1 015 555 0123", ok: false},
+		{name: "TooShort", number: "+33 1 23 45", ok: false},
+		{name: "UnknownCallingCode", number: "+999 1234 5678", ok: false},
+		{name: "NationalWithoutCountry", number: "020 7946 0958", ok: false},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			number, err := NormalizePhone(tc.number, tc.country)
+			if !tc.ok {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, number)
+		})
+	}
+}
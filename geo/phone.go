@@ -0,0 +1,159 @@
+package geo
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//go:embed callingcodes.tab
+var callingCodesTab string
+
+// FieldPhoneNumber is the JSON name of phone numbers in API requests.
+const FieldPhoneNumber = "phone_number"
+
+// CodePhoneNumber is the error code for phone numbers that cannot be parsed.
+const CodePhoneNumber = "e164"
+
+var (
+	// callingCodes maps each ISO 3166-1 alpha-2 code to its country calling code.
+	callingCodes = map[string]string{}
+	// isCallingCode holds every country calling code. No code is a prefix of another.
+	isCallingCode = map[string]bool{}
+)
+
+func init() {
+	for _, fields := range parseTab(callingCodesTab) {
+		callingCodes[fields[0]] = fields[1]
+		isCallingCode[fields[1]] = true
+	}
+}
+
+// phoneNumberLength is the length of the national significant number under one calling code.
+type phoneNumberLength struct {
+	min, max int
+}
+
+// phoneNumberLengths are the national number lengths of the larger numbering plans. Other calling codes accept
+// from 4 digits up to the 15 digits E.164 allows in total.
+var phoneNumberLengths = map[string]phoneNumberLength{
+	"7":  {10, 10},
+	"31": {9, 9},
+	"33": {9, 9},
+	"34": {9, 9},
+	"39": {6, 11},
+	"44": {9, 10},
+	"49": {6, 13},
+	"52": {10, 10},
+	"55": {10, 11},
+	"61": {9, 9},
+	"81": {9, 10},
+	"91": {10, 10},
+}
+
+// nanpNumber matches a North American Numbering Plan number without its calling code: a three digit area code
+// and a seven digit number, neither starting with 0 or 1.
+var nanpNumber = regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`)
+
+// keepsLeadingZero are the countries whose national numbers keep their leading 0 after the calling code.
+var keepsLeadingZero = map[string]bool{"IT": true, "SM": true, "VA": true}
+
+// errPhoneNumberCharacters is reported for numbers with anything but digits, a leading +, and punctuation.
+var errPhoneNumberCharacters = errors.New("may only contain digits, spaces, and the characters + - . ( )")
+
+// phonePunctuation, including no-break spaces, is removed from phone numbers before they are parsed.
+var phonePunctuation = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "\u00a0", "")
+
+// NormalizePhone parses a phone number and returns it in E.164 format, e.g. "+14155550123".
+// Numbers starting with + or 00 are read as international numbers. Other numbers are read as national numbers
+// of country: a trunk prefix is dropped (the leading 0 in most countries, 1 in North America, 8 in Russia and
+// Kazakhstan) and the country's calling code is added.
+// Parameters:
+// - number: The phone number as entered. Spaces, hyphens, dots, and parentheses are ignored.
+// - country: The ISO 3166-1 alpha-2 code used for national numbers; may be empty when number is international.
+// Returns:
+// - The number in E.164 format.
+// - An error describing what is wrong with the number, for people.
+func NormalizePhone(number, country string) (string, error) {
+	digits := phonePunctuation.Replace(strings.TrimSpace(number))
+	international := false
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		digits, international = digits[1:], true
+	case strings.HasPrefix(digits, "00"):
+		digits, international = digits[2:], true
+	}
+
+	if digits == "" {
+		return "", errors.New("is required")
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", errPhoneNumberCharacters
+		}
+	}
+
+	var code, national string
+	if international {
+		for i := 1; i <= 3 && i < len(digits); i++ {
+			if isCallingCode[digits[:i]] {
+				code, national = digits[:i], digits[i:]
+				break
+			}
+		}
+		if code == "" {
+			return "", errors.New("must start with a valid country calling code")
+		}
+	} else {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		var ok bool
+		code, ok = callingCodes[country]
+		if !ok {
+			return "", errors.New("must start with + and a country calling code when no country is known")
+		}
+		national = dropTrunkPrefix(country, code, digits)
+	}
+
+	if err := checkNationalNumber(code, national); err != nil {
+		return "", err
+	}
+	return "+" + code + national, nil
+}
+
+// dropTrunkPrefix removes the prefix dialled before national numbers within a country.
+func dropTrunkPrefix(country, code, digits string) string {
+	switch {
+	case code == "1" && len(digits) == 11 && digits[0] == '1':
+		return digits[1:]
+	case code == "7" && len(digits) == 11 && digits[0] == '8':
+		return digits[1:]
+	case keepsLeadingZero[country]:
+		return digits
+	default:
+		return strings.TrimPrefix(digits, "0")
+	}
+}
+
+// checkNationalNumber checks the length, and for North America the shape, of a national significant number.
+func checkNationalNumber(code, national string) error {
+	if code == "1" {
+		if !nanpNumber.MatchString(national) {
+			return errors.New("must be a 10 digit North American number with a valid area code")
+		}
+		return nil
+	}
+
+	length, ok := phoneNumberLengths[code]
+	if !ok {
+		length = phoneNumberLength{min: 4, max: 15 - len(code)}
+	}
+	if len(national) < length.min || len(national) > length.max {
+		if length.min == length.max {
+			return fmt.Errorf("must have %d digits after the calling code +%s", length.min, code)
+		}
+		return fmt.Errorf("must have %d to %d digits after the calling code +%s", length.min, length.max, code)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package geo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// postalFormat is the postal code format of a country.
+// Fields:
+// - pattern: Matches a valid code once it has been upper-cased and had its spaces and hyphens removed.
+// - format: Writes a matching code in the country's usual form; nil keeps the compact form.
+// - example: A valid code, shown in error messages.
+type postalFormat struct {
+	pattern *regexp.Regexp
+	format  func(string) string
+	example string
+}
+
+// digits matches n digits.
+func digits(n int) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`^\d{%d}$`, n))
+}
+
+// splitAt writes a compact code with sep inserted before its last n characters.
+func splitAt(n int, sep string) func(string) string {
+	return func(code string) string {
+		return code[:len(code)-n] + sep + code[len(code)-n:]
+	}
+}
+
+// postalFormats are the formats of the countries whose postal codes are checked, after the Universal Postal
+// Union's addressing guides. Other countries accept any postal code, except those in noPostalCodes.
+var postalFormats = map[string]postalFormat{
+	"AR": {regexp.MustCompile(`^([A-Z]\d{4}[A-Z]{3}|\d{4})$`), nil, "C1425DKF"},
+	"AT": {digits(4), nil, "1010"},
+	"AU": {digits(4), nil, "2000"},
+	"BE": {digits(4), nil, "1000"},
+	"BG": {digits(4), nil, "1000"},
+	"BR": {digits(8), splitAt(3, "-"), "01310-100"},
+	"CA": {regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY]\d[ABCEGHJ-NPRSTV-Z]\d[ABCEGHJ-NPRSTV-Z]\d$`), splitAt(3, " "), "K1A 0B1"},
+	"CH": {digits(4), nil, "8001"},
+	"CL": {digits(7), nil, "8320000"},
+	"CN": {digits(6), nil, "100000"},
+	"CY": {digits(4), nil, "1010"},
+	"CZ": {digits(5), splitAt(2, " "), "110 00"},
+	"DE": {digits(5), nil, "10115"},
+	"DK": {digits(4), nil, "1050"},
+	"EE": {digits(5), nil, "10111"},
+	"ES": {digits(5), nil, "28001"},
+	"FI": {digits(5), nil, "00100"},
+	"FR": {digits(5), nil, "75001"},
+	"GB": {regexp.MustCompile(`^([A-Z]{1,2}\d[A-Z\d]?\d[A-Z]{2}|GIR0AA)$`), splitAt(3, " "), "SW1A 1AA"},
+	"GR": {digits(5), splitAt(2, " "), "105 57"},
+	"HR": {digits(5), nil, "10000"},
+	"HU": {digits(4), nil, "1011"},
+	"ID": {digits(5), nil, "10110"},
+	"IE": {regexp.MustCompile(`^[AC-FHKNPRTV-Y]\d[\dW][\dAC-FHKNPRTV-Y]{4}$`), splitAt(4, " "), "D02 X285"},
+	"IL": {digits(7), nil, "6100000"},
+	"IN": {digits(6), nil, "110001"},
+	"IT": {digits(5), nil, "00118"},
+	"JP": {digits(7), splitAt(4, "-"), "100-0001"},
+	"KR": {digits(5), nil, "03051"},
+	"LT": {regexp.MustCompile(`^(LT)?\d{5}$`), func(code string) string { return "LT-" + strings.TrimPrefix(code, "LT") }, "LT-01100"},
+	"LU": {regexp.MustCompile(`^(L)?\d{4}$`), func(code string) string { return "L-" + strings.TrimPrefix(code, "L") }, "L-1111"},
+	"LV": {regexp.MustCompile(`^(LV)?\d{4}$`), func(code string) string { return "LV-" + strings.TrimPrefix(code, "LV") }, "LV-1050"},
+	"MX": {digits(5), nil, "06000"},
+	"MY": {digits(5), nil, "50000"},
+	"NL": {regexp.MustCompile(`^[1-9]\d{3}[A-Z]{2}$`), splitAt(2, " "), "1012 AB"},
+	"NO": {digits(4), nil, "0150"},
+	"NZ": {digits(4), nil, "6011"},
+	"PH": {digits(4), nil, "1000"},
+	"PL": {digits(5), splitAt(3, "-"), "00-001"},
+	"PT": {digits(7), splitAt(3, "-"), "1000-001"},
+	"RO": {digits(6), nil, "010011"},
+	"RU": {digits(6), nil, "101000"},
+	"SE": {digits(5), splitAt(2, " "), "111 22"},
+	"SG": {digits(6), nil, "018989"},
+	"SI": {digits(4), nil, "1000"},
+	"SK": {digits(5), splitAt(2, " "), "811 01"},
+	"TH": {digits(5), nil, "10200"},
+	"TR": {digits(5), nil, "06100"},
+	"TW": {regexp.MustCompile(`^\d{3}(\d{2,3})?$`), nil, "100"},
+	"UA": {digits(5), nil, "01001"},
+	"US": {regexp.MustCompile(`^\d{5}(\d{4})?$`), func(code string) string {
+		if len(code) == 9 {
+			return splitAt(4, "-")(code)
+		}
+		return code
+	}, "94105 or 94105-1234"},
+	"VN": {digits(6), nil, "100000"},
+	"ZA": {digits(4), nil, "0001"},
+}
+
+// noPostalCodes are the countries that do not use postal codes, so addresses there must leave the code empty.
+var noPostalCodes = map[string]bool{
+	"AE": true, "AG": true, "AO": true, "AW": true, "BF": true, "BI": true, "BJ": true, "BO": true, "BS": true,
+	"BW": true, "BZ": true, "CD": true, "CF": true, "CG": true, "CI": true, "CK": true, "CM": true, "DJ": true,
+	"DM": true, "ER": true, "FJ": true, "GA": true, "GD": true, "GH": true, "GM": true, "GQ": true, "GY": true,
+	"HK": true, "KI": true, "KM": true, "KN": true, "KP": true, "ML": true, "MO": true, "MR": true, "MW": true,
+	"NR": true, "NU": true, "QA": true, "RW": true, "SB": true, "SC": true, "SL": true, "SR": true, "ST": true,
+	"SY": true, "TD": true, "TF": true, "TG": true, "TK": true, "TL": true, "TO": true, "TV": true, "UG": true,
+	"VU": true, "YE": true, "ZW": true,
+}
+
+// UsesPostalCodes reports whether addresses in a country need a postal code.
+func UsesPostalCodes(country string) bool {
+	return !noPostalCodes[country]
+}
+
+// normalizePostalCode checks an upper-cased postal code against the format of its country and writes it in
+// the country's usual form.
+func normalizePostalCode(country, zip string) (string, error) {
+	if noPostalCodes[country] {
+		if zip != "" {
+			return zip, fmt.Errorf("must be empty, %s does not use postal codes", country)
+		}
+		return zip, nil
+	}
+
+	if zip == "" {
+		return zip, fmt.Errorf("is required for %s", country)
+	}
+
+	format, ok := postalFormats[country]
+	if !ok {
+		return zip, nil
+	}
+
+	compact := strings.NewReplacer(" ", "", "-", "").Replace(zip)
+	if !format.pattern.MatchString(compact) {
+		return zip, fmt.Errorf("must be a %s postal code, e.g. %s", country, format.example)
+	}
+
+	if format.format == nil {
+		return compact, nil
+	}
+	return format.format(compact), nil
+}
@@ -0,0 +1,218 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// keySize is the length in bytes of key-encryption keys, data keys, and the blind index key (AES-256, HMAC-SHA256).
+const keySize = 32
+
+// ciphertextPrefix marks an encrypted value. Values without it are treated as plaintext written before
+// encryption was turned on, so existing rows keep working until they are re-encrypted.
+const ciphertextPrefix = "enc:v1:"
+
+var (
+	ErrMissingKeys     = errors.New("no field encryption keys configured")
+	ErrMissingIndexKey = errors.New("no blind index key configured")
+	ErrInvalidKey      = errors.New("field encryption keys must be id:hex pairs of 32-byte keys")
+	ErrUnknownKey      = errors.New("value was encrypted with a key that is not configured")
+	ErrDecrypt         = errors.New("unable to decrypt value")
+)
+
+// Keyring encrypts individual field values with envelope encryption.
+// Every value gets a fresh random data key; the value is sealed with the data key using AES-256-GCM, and the data
+// key is sealed with the current key-encryption key (KEK). The KEK's ID travels with the value, so retired KEKs
+// can stay in the keyring for decryption until every value has been rotated to the current one.
+// The field name is bound into the ciphertext, so a value copied into another column does not decrypt.
+type Keyring struct {
+	current  string
+	keks     map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// NewKeyring builds a keyring from configuration.
+// Parameters:
+// - keys: Comma-separated id:hex pairs of 32-byte KEKs, for example "2025b:<64 hex>,2025a:<64 hex>".
+// The first key encrypts new values; the others are only used to decrypt.
+// - indexKey: The 32-byte hex key for blind indexes. Changing it changes every index, so it is not rotated with the KEKs.
+// Returns:
+// - The keyring, or an error if a key is missing or malformed.
+func NewKeyring(keys, indexKey string) (*Keyring, error) {
+	if strings.TrimSpace(keys) == "" {
+		return nil, ErrMissingKeys
+	}
+	if indexKey == "" {
+		return nil, ErrMissingIndexKey
+	}
+
+	ring := &Keyring{keks: map[string]cipher.AEAD{}}
+
+	for _, pair := range strings.Split(keys, ",") {
+		id, hexKey, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" || ring.keks[id] != nil {
+			return nil, ErrInvalidKey
+		}
+
+		key, err := decodeKey(hexKey)
+		if err != nil {
+			return nil, err
+		}
+
+		ring.keks[id], err = newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if ring.current == "" {
+			ring.current = id
+		}
+	}
+
+	var err error
+	ring.indexKey, err = decodeKey(indexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return ring, nil
+}
+
+// Encrypt seals a field value under the current KEK. Empty values are left empty.
+func (ring *Keyring) Encrypt(field, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := seal(ring.keks[ring.current], dataKey, []byte(ring.current))
+	if err != nil {
+		return "", err
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(dataAEAD, []byte(plaintext), []byte(field))
+	if err != nil {
+		return "", err
+	}
+
+	return ciphertextPrefix + ring.current + ":" +
+		base64.RawURLEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value made by Encrypt with any KEK in the keyring. Plaintext values are returned as they are.
+func (ring *Keyring) Decrypt(field, value string) (string, error) {
+	if !strings.HasPrefix(value, ciphertextPrefix) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, ciphertextPrefix), ":")
+	if len(parts) != 3 {
+		return "", ErrDecrypt
+	}
+
+	kek, ok := ring.keks[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKey, parts[0])
+	}
+
+	wrappedKey, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrDecrypt
+	}
+
+	dataKey, err := open(kek, wrappedKey, []byte(parts[0]))
+	if err != nil {
+		return "", err
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+
+	plaintext, err := open(dataAEAD, sealed, []byte(field))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// IsCurrent reports whether a value needs no rotation: it is empty or already encrypted under the current KEK.
+func (ring *Keyring) IsCurrent(value string) bool {
+	return value == "" || strings.HasPrefix(value, ciphertextPrefix+ring.current+":")
+}
+
+// BlindIndex returns a keyed hash of a field value for exact-match lookups without decrypting.
+// Values are compared case-insensitively and without surrounding space. Empty values have an empty index.
+func (ring *Keyring) BlindIndex(field, plaintext string) string {
+	normalized := strings.ToLower(strings.TrimSpace(plaintext))
+	if normalized == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, ring.indexKey)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(normalized))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func decodeKey(hexKey string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(hexKey))
+	if err != nil || len(key) != keySize {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts with a random nonce and returns the nonce followed by the ciphertext.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open reverses seal.
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
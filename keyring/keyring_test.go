@@ -0,0 +1,122 @@
+package keyring
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"whaleWake/util"
+)
+
+func newTestKeyring(t *testing.T, keys string, indexKey string) *Keyring {
+	ring, err := NewKeyring(keys, indexKey)
+	require.NoError(t, err)
+	return ring
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	ring := newTestKeyring(t, "k1:"+util.RandomSymmetricKey(), util.RandomSymmetricKey())
+
+	ciphertext, err := ring.Encrypt("street_address", "1 Main St")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(ciphertext, "enc:v1:k1:"))
+	require.NotContains(t, ciphertext, "Main")
+	require.True(t, ring.IsCurrent(ciphertext))
+
+	// A fresh data key and nonce every time
+	again, err := ring.Encrypt("street_address", "1 Main St")
+	require.NoError(t, err)
+	require.NotEqual(t, ciphertext, again)
+
+	plaintext, err := ring.Decrypt("street_address", ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "1 Main St", plaintext)
+
+	// Bound to its field
+	_, err = ring.Decrypt("zip", ciphertext)
+	require.ErrorIs(t, err, ErrDecrypt)
+
+	// Tampering is detected
+	_, err = ring.Decrypt("street_address", ciphertext[:len(ciphertext)-2]+"AA")
+	require.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestKeyringPlaintextAndEmpty(t *testing.T) {
+	ring := newTestKeyring(t, "k1:"+util.RandomSymmetricKey(), util.RandomSymmetricKey())
+
+	empty, err := ring.Encrypt("zip", "")
+	require.NoError(t, err)
+	require.Empty(t, empty)
+	require.True(t, ring.IsCurrent(empty))
+
+	plaintext, err := ring.Decrypt("zip", "98101")
+	require.NoError(t, err)
+	require.Equal(t, "98101", plaintext)
+	require.False(t, ring.IsCurrent("98101"))
+}
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey, newKey, indexKey := util.RandomSymmetricKey(), util.RandomSymmetricKey(), util.RandomSymmetricKey()
+
+	before := newTestKeyring(t, "old:"+oldKey, indexKey)
+	ciphertext, err := before.Encrypt("first_name", "Ada")
+	require.NoError(t, err)
+
+	after := newTestKeyring(t, "new:"+newKey+",old:"+oldKey, indexKey)
+	require.False(t, after.IsCurrent(ciphertext))
+
+	plaintext, err := after.Decrypt("first_name", ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "Ada", plaintext)
+
+	rotated, err := after.Encrypt("first_name", plaintext)
+	require.NoError(t, err)
+	require.True(t, after.IsCurrent(rotated))
+
+	retired := newTestKeyring(t, "new:"+newKey, indexKey)
+	_, err = retired.Decrypt("first_name", ciphertext)
+	require.ErrorIs(t, err, ErrUnknownKey)
+
+	// Blind indexes do not depend on the KEKs
+	require.Equal(t, before.BlindIndex("first_name", "Ada"), retired.BlindIndex("first_name", "Ada"))
+}
+
+func TestKeyringBlindIndex(t *testing.T) {
+	ring := newTestKeyring(t, "k1:"+util.RandomSymmetricKey(), util.RandomSymmetricKey())
+
+	index := ring.BlindIndex("last_name", "Lovelace")
+	require.Len(t, index, 64)
+	require.Equal(t, index, ring.BlindIndex("last_name", "  LOVELACE "))
+	require.NotEqual(t, index, ring.BlindIndex("first_name", "Lovelace"))
+	require.NotEqual(t, index, ring.BlindIndex("last_name", "Byron"))
+	require.Empty(t, ring.BlindIndex("last_name", " "))
+
+	other := newTestKeyring(t, "k1:"+util.RandomSymmetricKey(), util.RandomSymmetricKey())
+	require.NotEqual(t, index, other.BlindIndex("last_name", "Lovelace"))
+}
+
+func TestNewKeyringErrors(t *testing.T) {
+	key := util.RandomSymmetricKey()
+
+	testCases := []struct {
+		name     string
+		keys     string
+		indexKey string
+		err      error
+	}{
+		{name: "NoKeys", keys: "", indexKey: key, err: ErrMissingKeys},
+		{name: "NoIndexKey", keys: "k1:" + key, indexKey: "", err: ErrMissingIndexKey},
+		{name: "MissingID", keys: key, indexKey: key, err: ErrInvalidKey},
+		{name: "ShortKey", keys: "k1:abcd", indexKey: key, err: ErrInvalidKey},
+		{name: "DuplicateID", keys: "k1:" + key + ",k1:" + key, indexKey: key, err: ErrInvalidKey},
+		{name: "BadIndexKey", keys: "k1:" + key, indexKey: "zz", err: ErrInvalidKey},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewKeyring(tc.keys, tc.indexKey)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sender kinds accepted by NewSender.
+const (
+	SenderLog  = "log"
+	SenderFile = "file"
+)
+
+var (
+	ErrUnknownSender = errors.New("unknown mail sender")
+	ErrMissingPath   = errors.New("the file mail sender needs a path")
+)
+
+// Message is a plain text email to one address.
+// Fields:
+// - To: The recipient's address.
+// - Subject: The subject line.
+// - Body: The plain text body.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Sender delivers email. Implementations for mail services only need Send; the log and file senders are meant
+// for local development and tests, where nothing should leave the machine.
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// NewSender builds the sender named in configuration.
+// Parameters:
+// - kind: SenderLog, SenderFile, or empty for SenderLog.
+// - path: The file SenderFile appends to.
+// Returns:
+// - The sender, or an error if kind is unknown or a file sender has no path.
+func NewSender(kind, path string) (Sender, error) {
+	switch kind {
+	case "", SenderLog:
+		return LogSender{}, nil
+	case SenderFile:
+		if path == "" {
+			return nil, ErrMissingPath
+		}
+		return &FileSender{path: path}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSender, kind)
+	}
+}
+
+// LogSender writes messages to the standard logger instead of sending them.
+type LogSender struct{}
+
+// Send logs the message.
+func (LogSender) Send(_ context.Context, message Message) error {
+	log.Printf("Mail to %s: %s\n%s", message.To, message.Subject, message.Body)
+	return nil
+}
+
+// FileSender appends messages to a file as JSON lines instead of sending them, so local tools can read them.
+type FileSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+// fileMessage is a line written by FileSender.
+type fileMessage struct {
+	Message
+	SentAt time.Time `json:"sent_at"`
+}
+
+// Send appends the message to the file, creating it if needed.
+func (sender *FileSender) Send(_ context.Context, message Message) error {
+	line, err := json.Marshal(fileMessage{Message: message, SentAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+
+	file, err := os.OpenFile(sender.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSender(t *testing.T) {
+	sender, err := NewSender("", "")
+	require.NoError(t, err)
+	require.IsType(t, LogSender{}, sender)
+	require.NoError(t, sender.Send(context.Background(), Message{To: "ahab@example.com", Subject: "hi", Body: "hello"}))
+
+	_, err = NewSender(SenderFile, "")
+	require.ErrorIs(t, err, ErrMissingPath)
+
+	_, err = NewSender("carrier-pigeon", "")
+	require.ErrorIs(t, err, ErrUnknownSender)
+}
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.ndjson")
+	sender, err := NewSender(SenderFile, path)
+	require.NoError(t, err)
+
+	require.NoError(t, sender.Send(context.Background(), Message{To: "ahab@example.com", Subject: "first", Body: "one"}))
+	require.NoError(t, sender.Send(context.Background(), Message{To: "ishmael@example.com", Subject: "second", Body: "two"}))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var messages []fileMessage
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message fileMessage
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &message))
+		messages = append(messages, message)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, messages, 2)
+	require.Equal(t, "ahab@example.com", messages[0].To)
+	require.Equal(t, "second", messages[1].Subject)
+	require.Equal(t, "two", messages[1].Body)
+	require.False(t, messages[0].SentAt.IsZero())
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	_ "github.com/lib/pq"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"whaleWake/api"
+	"whaleWake/blobstore"
 	db "whaleWake/db/sqlc"
+	"whaleWake/events"
+	"whaleWake/keyring"
 	"whaleWake/util"
+	"whaleWake/worker"
 )
 
 // main is the entry point of the application.
@@ -25,19 +35,90 @@ func main() {
 		log.Fatal("Unable to connect to the db:", err)
 	}
 
+	// Encrypt personal profile fields at rest when keys are configured.
+	var storeOptions []db.StoreOption
+	if config.FieldEncryptionKeys != "" {
+		ring, err := keyring.NewKeyring(config.FieldEncryptionKeys, config.BlindIndexKey)
+		if err != nil {
+			log.Fatal("Unable to load the field encryption keys:", err)
+		}
+		storeOptions = append(storeOptions, db.WithFieldCipher(ring))
+	}
+
+	// Keep old user names for their owners for a while after a rename.
+	storeOptions = append(storeOptions, db.WithUserNameGracePeriod(config.UserNameGracePeriod))
+
 	// Create a new store instance for database operations.
-	store := db.NewStore(conn)
+	store := db.NewStore(conn, storeOptions...)
+
+	// Permanently remove soft deleted users once they are past the retention window.
+	purger := worker.NewPurger(store, config.SoftDeleteRetention, config.PurgeInterval)
+	go purger.Run(context.Background())
+
+	// Delete stored Idempotency-Key responses once they have expired.
+	idempotencyKeys := worker.NewIdempotencyKeySweeper(store, config.IdempotencyKeyTTL, config.IdempotencyInterval)
+	go idempotencyKeys.Run(context.Background())
+
+	// Fail the background imports of servers that stopped without finishing them, including this one's last run.
+	importJobs := worker.NewImportJobSweeper(store, config.ImportJobStaleAfter, config.ImportSweepInterval)
+	go importJobs.Run(context.Background())
+
+	// Carry out erasure requests once their cool-down has passed.
+	eraser := worker.NewEraser(store, config.ErasureInterval)
+	go eraser.Run(context.Background())
+
+	// Delete the blobs of replaced avatars and removed documents.
+	blobs, err := blobstore.NewFromConfig(config)
+	if err != nil {
+		log.Fatal("Unable to open the blob store:", err)
+	}
+	sweeper := worker.NewBlobSweeper(store, blobs, config.BlobSweepInterval)
+	go sweeper.Run(context.Background())
+
+	// Publish user lifecycle events recorded in the outbox.
+	publisher, err := events.NewFromConfig(config)
+	if err != nil {
+		log.Fatal("Unable to create the event publisher:", err)
+	}
+	relay := worker.NewOutboxRelay(store, publisher, config.OutboxRelayInterval, config.OutboxRetention)
+	go relay.Run(context.Background())
+
+	// Send user lifecycle events to the webhooks admins subscribed.
+	sender := events.NewWebhookSender(config.WebhookTimeout)
+	dispatcher := worker.NewWebhookDispatcher(store, sender, config.WebhookInterval, config.WebhookMaxAttempts, config.WebhookRetention)
+	go dispatcher.Run(context.Background())
+
+	// Stream events to clients as their transactions commit.
+	hub := events.NewHub(config.EventStreamBuffer)
+	go func() {
+		if err := events.ListenPostgres(context.Background(), config.DBSource, hub); err != nil {
+			log.Println("Unable to listen for user events:", err)
+		}
+	}()
 
 	// Create a new server instance with the store.
-	server, err := api.NewServer(config, store)
+	server, err := api.NewServer(config, store, api.WithEventHub(hub))
 
 	if err != nil {
 		log.Fatal("Unable to create the server:", err)
 	}
 
 	// Start the HTTP server on the specified address.
-	err = server.Start(config.SeverAddress)
-	if err != nil {
-		log.Fatal("Unable to start the server:", err)
+	go func() {
+		err := server.Start(config.SeverAddress)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Unable to start the server:", err)
+		}
+	}()
+
+	// On SIGINT or SIGTERM, let the requests in progress finish and background imports save how far they got.
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancelShutdown()
+	if err = server.Shutdown(ctx); err != nil {
+		log.Println("Unable to shut down cleanly:", err)
 	}
 }
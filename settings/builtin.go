@@ -0,0 +1,91 @@
+package settings
+
+import (
+	"errors"
+	"regexp"
+	"time"
+	_ "time/tzdata"
+)
+
+// localePattern matches BCP 47 language tags of a language with an optional script and region, e.g. "en",
+// "pt-BR", or "zh-Hant-TW".
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+
+// Builtin holds the settings shared by every client app.
+var Builtin = mustNewRegistry(
+	Setting{
+		Key:         "locale",
+		Description: "Language and region for text, dates, and numbers, as a BCP 47 tag.",
+		Schema:      Schema{Type: TypeString, Pattern: localePattern},
+		Default:     "en-US",
+	},
+	Setting{
+		Key:         "timezone",
+		Description: "IANA time zone times are shown in.",
+		Schema:      Schema{Type: TypeString, MaxLength: 64, Check: checkTimezone},
+		Default:     "UTC",
+	},
+	Setting{
+		Key:         "units",
+		Description: "Measurement system for distances and weights.",
+		Schema:      Schema{Type: TypeString, Enum: []string{"metric", "imperial"}},
+		Default:     "metric",
+	},
+	Setting{
+		Key:         "theme",
+		Description: "Color scheme of the apps.",
+		Schema:      Schema{Type: TypeString, Enum: []string{"system", "light", "dark"}},
+		Default:     "system",
+	},
+	Setting{
+		Key:         "week_start",
+		Description: "First day of the week in calendars, 0 for Sunday through 6 for Saturday.",
+		Schema:      Schema{Type: TypeInteger, Minimum: 0, Maximum: 6},
+		Default:     int64(1),
+	},
+	Setting{
+		Key:         "notifications.email",
+		Description: "Account and activity notifications by email.",
+		Schema:      Schema{Type: TypeBoolean},
+		Default:     true,
+	},
+	Setting{
+		Key:         "notifications.sms",
+		Description: "Account and activity notifications by text message.",
+		Schema:      Schema{Type: TypeBoolean},
+		Default:     false,
+	},
+	Setting{
+		Key:         "notifications.push",
+		Description: "Account and activity notifications on mobile devices.",
+		Schema:      Schema{Type: TypeBoolean},
+		Default:     true,
+	},
+	Setting{
+		Key:         "notifications.marketing",
+		Description: "News and offers. Off until the user opts in.",
+		Schema:      Schema{Type: TypeBoolean},
+		Default:     false,
+	},
+)
+
+// checkTimezone accepts IANA time zone names. The time zone database is embedded, so this does not depend on
+// the host.
+func checkTimezone(value interface{}) error {
+	name := value.(string)
+	if name == "" || name == "Local" {
+		return errors.New("must be an IANA time zone, e.g. Europe/Paris")
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return errors.New("must be an IANA time zone, e.g. Europe/Paris")
+	}
+	return nil
+}
+
+func mustNewRegistry(settings ...Setting) *Registry {
+	registry, err := NewRegistry(settings...)
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
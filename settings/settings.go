@@ -0,0 +1,281 @@
+// Package settings defines the preferences users can store, such as locale, timezone, and notification opt-ins.
+// Every setting is registered with a schema its values are checked against and a default used until the user
+// sets a value, so all client apps read the same typed settings.
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Type is the JSON type of a setting's values.
+type Type string
+
+// Setting value types.
+const (
+	TypeString  Type = "string"
+	TypeBoolean Type = "boolean"
+	TypeInteger Type = "integer"
+)
+
+// Error codes used in FieldError.
+const (
+	CodeUnknown = "unknown_setting"
+	CodeType    = "type"
+	CodeEnum    = "oneof"
+	CodePattern = "pattern"
+	CodeRange   = "range"
+	CodeInvalid = "invalid"
+)
+
+var (
+	// ErrDuplicateSetting is returned when a key is registered twice.
+	ErrDuplicateSetting = errors.New("setting is already registered")
+	// ErrInvalidDefault is returned when a setting's default does not match its own schema.
+	ErrInvalidDefault = errors.New("setting default does not match its schema")
+)
+
+// Schema describes the values a setting accepts.
+// Fields:
+// - Type: The JSON type of the value.
+// - Enum: For strings, the only values allowed, if set.
+// - Pattern: For strings, a pattern the value has to match, if set.
+// - MaxLength: For strings, the most characters allowed, if not zero.
+// - Minimum, Maximum: For integers, the inclusive bounds, checked when either is not zero.
+// - Check: An extra check of the decoded value, if set. Its error message is shown to the user.
+type Schema struct {
+	Type      Type
+	Enum      []string
+	Pattern   *regexp.Regexp
+	MaxLength int
+	Minimum   int64
+	Maximum   int64
+	Check     func(value interface{}) error
+}
+
+// Setting is one registered preference.
+// Fields:
+// - Key: The name the setting is stored and sent under, e.g. "notifications.email".
+// - Description: What the setting controls, for people.
+// - Schema: The values the setting accepts.
+// - Default: The value used until the user sets one: a string, bool, or int64 matching Schema.Type.
+type Setting struct {
+	Key         string
+	Description string
+	Schema      Schema
+	Default     interface{}
+}
+
+// FieldError describes one invalid setting.
+type FieldError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+func (err FieldError) Error() string {
+	return err.Message
+}
+
+// Errors lists every invalid setting of an update.
+type Errors []FieldError
+
+func (errs Errors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Key + " " + err.Message
+	}
+	return "invalid settings: " + strings.Join(messages, "; ")
+}
+
+// Registry holds the settings users can store. It is safe for concurrent reads once registration is done.
+type Registry struct {
+	settings map[string]Setting
+	defaults map[string]json.RawMessage
+	keys     []string
+}
+
+// NewRegistry creates a registry with the given settings.
+// Returns an error if a key is registered twice or a default does not match its schema.
+func NewRegistry(settings ...Setting) (*Registry, error) {
+	registry := &Registry{
+		settings: map[string]Setting{},
+		defaults: map[string]json.RawMessage{},
+	}
+	for _, setting := range settings {
+		if err := registry.Register(setting); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// Register adds a setting to the registry. Registration is not safe to run alongside reads.
+// Returns ErrDuplicateSetting or ErrInvalidDefault.
+func (registry *Registry) Register(setting Setting) error {
+	if _, ok := registry.settings[setting.Key]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateSetting, setting.Key)
+	}
+
+	raw, err := json.Marshal(setting.Default)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidDefault, setting.Key, err)
+	}
+	raw, err = setting.Schema.Normalize(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidDefault, setting.Key, err)
+	}
+
+	registry.settings[setting.Key] = setting
+	registry.defaults[setting.Key] = raw
+	registry.keys = append(registry.keys, setting.Key)
+	sort.Strings(registry.keys)
+	return nil
+}
+
+// Keys returns the keys of every registered setting, sorted.
+func (registry *Registry) Keys() []string {
+	return append([]string(nil), registry.keys...)
+}
+
+// Lookup returns the setting registered under key.
+func (registry *Registry) Lookup(key string) (Setting, bool) {
+	setting, ok := registry.settings[key]
+	return setting, ok
+}
+
+// Validate checks values against the schemas of their settings and returns them in canonical JSON.
+// A nil or null value stands for "reset to the default" and is returned as nil.
+// Parameters:
+// - values: Setting keys and their JSON values.
+// Returns:
+// - The values, re-encoded without insignificant whitespace.
+// - Errors listing every unknown key and invalid value, sorted by key, or nil.
+func (registry *Registry) Validate(values map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	normalized := make(map[string]json.RawMessage, len(values))
+	var errs Errors
+
+	for key, raw := range values {
+		setting, ok := registry.settings[key]
+		if !ok {
+			errs = append(errs, FieldError{Key: key, Code: CodeUnknown, Message: "is not a known setting"})
+			continue
+		}
+		if isNull(raw) {
+			normalized[key] = nil
+			continue
+		}
+		value, err := setting.Schema.Normalize(raw)
+		if err != nil {
+			var fieldErr FieldError
+			if !errors.As(err, &fieldErr) {
+				fieldErr = FieldError{Code: CodeInvalid, Message: err.Error()}
+			}
+			fieldErr.Key = key
+			errs = append(errs, fieldErr)
+			continue
+		}
+		normalized[key] = value
+	}
+
+	if errs != nil {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Key < errs[j].Key })
+		return nil, errs
+	}
+	return normalized, nil
+}
+
+// Resolve returns the effective value of every registered setting: the stored value where there is one and it
+// still matches the schema, and the default otherwise. Stored values of settings no longer registered are dropped.
+func (registry *Registry) Resolve(stored map[string]json.RawMessage) map[string]json.RawMessage {
+	resolved := make(map[string]json.RawMessage, len(registry.keys))
+	for _, key := range registry.keys {
+		resolved[key] = registry.defaults[key]
+		if raw, ok := stored[key]; ok {
+			if value, err := registry.settings[key].Schema.Normalize(raw); err == nil {
+				resolved[key] = value
+			}
+		}
+	}
+	return resolved
+}
+
+// Defaults returns the default value of every registered setting.
+func (registry *Registry) Defaults() map[string]json.RawMessage {
+	return registry.Resolve(nil)
+}
+
+// Normalize decodes raw as a value of the schema, checks it, and encodes it again without insignificant
+// whitespace. The error is a FieldError without a Key when the value does not match.
+func (schema Schema) Normalize(raw json.RawMessage) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, FieldError{Code: CodeType, Message: "must be valid JSON"}
+	}
+
+	switch schema.Type {
+	case TypeString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, FieldError{Code: CodeType, Message: "must be a string"}
+		}
+		if schema.MaxLength > 0 && len([]rune(s)) > schema.MaxLength {
+			return nil, FieldError{Code: CodeRange, Message: fmt.Sprintf("must be at most %d characters", schema.MaxLength)}
+		}
+		if schema.Enum != nil && !contains(schema.Enum, s) {
+			return nil, FieldError{Code: CodeEnum, Message: "must be one of " + strings.Join(schema.Enum, ", ")}
+		}
+		if schema.Pattern != nil && !schema.Pattern.MatchString(s) {
+			return nil, FieldError{Code: CodePattern, Message: "is not in the expected format"}
+		}
+	case TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return nil, FieldError{Code: CodeType, Message: "must be true or false"}
+		}
+	case TypeInteger:
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, FieldError{Code: CodeType, Message: "must be an integer"}
+		}
+		n, err := number.Int64()
+		if err != nil {
+			return nil, FieldError{Code: CodeType, Message: "must be an integer"}
+		}
+		if (schema.Minimum != 0 || schema.Maximum != 0) && (n < schema.Minimum || n > schema.Maximum) {
+			return nil, FieldError{Code: CodeRange, Message: fmt.Sprintf("must be between %d and %d", schema.Minimum, schema.Maximum)}
+		}
+		value = n
+	default:
+		return nil, fmt.Errorf("unknown setting type %q", schema.Type)
+	}
+
+	if schema.Check != nil {
+		if err := schema.Check(value); err != nil {
+			return nil, FieldError{Code: CodeInvalid, Message: err.Error()}
+		}
+	}
+
+	return json.Marshal(value)
+}
+
+// isNull reports whether raw is missing or the JSON null.
+func isNull(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
+
+func contains(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package settings
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		values   map[string]string
+		expected map[string]string
+		codes    []string
+	}{
+		{
+			name:     "Valid",
+			values:   map[string]string{"locale": `"pt-BR"`, "timezone": `"Europe/Paris"`, "week_start": ` 0 `, "notifications.sms": `true`},
+			expected: map[string]string{"locale": `"pt-BR"`, "timezone": `"Europe/Paris"`, "week_start": `0`, "notifications.sms": `true`},
+		},
+		{
+			name:     "Reset",
+			values:   map[string]string{"units": `null`},
+			expected: map[string]string{"units": ``},
+		},
+		{
+			name:   "Unknown",
+			values: map[string]string{"colour": `"red"`},
+			codes:  []string{CodeUnknown},
+		},
+		{
+			name:   "WrongTypes",
+			values: map[string]string{"notifications.email": `"yes"`, "locale": `1`, "week_start": `1.5`},
+			codes:  []string{CodeType, CodeType, CodeType},
+		},
+		{
+			name:   "Constraints",
+			values: map[string]string{"locale": `"english"`, "theme": `"blue"`, "timezone": `"Mars/Olympus"`, "week_start": `7`},
+			codes:  []string{CodePattern, CodeEnum, CodeInvalid, CodeRange},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			values := map[string]json.RawMessage{}
+			for key, value := range tc.values {
+				values[key] = json.RawMessage(value)
+			}
+
+			normalized, err := Builtin.Validate(values)
+			if tc.codes != nil {
+				var errs Errors
+				require.ErrorAs(t, err, &errs)
+				codes := make([]string, len(errs))
+				for i, fieldErr := range errs {
+					codes[i] = fieldErr.Code
+				}
+				require.Equal(t, tc.codes, codes)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, normalized, len(tc.expected))
+			for key, value := range tc.expected {
+				require.Equal(t, value, string(normalized[key]), key)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	resolved := Builtin.Resolve(map[string]json.RawMessage{
+		"units":   json.RawMessage(`"imperial"`),
+		"theme":   json.RawMessage(`"sepia"`),
+		"retired": json.RawMessage(`true`),
+	})
+
+	require.Len(t, resolved, len(Builtin.Keys()))
+	require.JSONEq(t, `"imperial"`, string(resolved["units"]))
+	// Stored values that no longer match the schema fall back to the default.
+	require.JSONEq(t, `"system"`, string(resolved["theme"]))
+	require.JSONEq(t, `"en-US"`, string(resolved["locale"]))
+	require.NotContains(t, resolved, "retired")
+}
+
+func TestRegister(t *testing.T) {
+	registry, err := NewRegistry(Setting{Key: "beta", Schema: Schema{Type: TypeBoolean}, Default: false})
+	require.NoError(t, err)
+
+	err = registry.Register(Setting{Key: "beta", Schema: Schema{Type: TypeBoolean}, Default: true})
+	require.ErrorIs(t, err, ErrDuplicateSetting)
+
+	err = registry.Register(Setting{Key: "size", Schema: Schema{Type: TypeString, Enum: []string{"s", "m"}}, Default: "xl"})
+	require.ErrorIs(t, err, ErrInvalidDefault)
+
+	require.Equal(t, []string{"beta"}, registry.Keys())
+}
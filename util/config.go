@@ -11,12 +11,106 @@ type Config struct {
 	SeverAddress        string        `mapstructure:"SERVER_ADDRESS"`
 	TokenSymmetricKey   string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
 	AccessTokenDuration time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	IdempotencyKeyTTL   time.Duration `mapstructure:"IDEMPOTENCY_KEY_TTL"`
+	IdempotencyInterval time.Duration `mapstructure:"IDEMPOTENCY_SWEEP_INTERVAL"`
+	SoftDeleteRetention time.Duration `mapstructure:"SOFT_DELETE_RETENTION"`
+	PurgeInterval       time.Duration `mapstructure:"PURGE_INTERVAL"`
+	ImportAsyncRows     int           `mapstructure:"IMPORT_ASYNC_ROWS"`
+	ImportJobStaleAfter time.Duration `mapstructure:"IMPORT_JOB_STALE_AFTER"`
+	ImportSweepInterval time.Duration `mapstructure:"IMPORT_SWEEP_INTERVAL"`
+	ErasureCoolDown     time.Duration `mapstructure:"ERASURE_COOL_DOWN"`
+	ErasureInterval     time.Duration `mapstructure:"ERASURE_INTERVAL"`
+	FieldEncryptionKeys string        `mapstructure:"FIELD_ENCRYPTION_KEYS"`
+	BlindIndexKey       string        `mapstructure:"BLIND_INDEX_KEY"`
+	SMSSender           string        `mapstructure:"SMS_SENDER"`
+	SMSFilePath         string        `mapstructure:"SMS_FILE_PATH"`
+	PhoneCodeTTL        time.Duration `mapstructure:"PHONE_CODE_TTL"`
+	PhoneCodeLimit      int           `mapstructure:"PHONE_CODE_LIMIT"`
+	BlobStore           string        `mapstructure:"BLOB_STORE"`
+	BlobLocalDir        string        `mapstructure:"BLOB_LOCAL_DIR"`
+	BlobSweepInterval   time.Duration `mapstructure:"BLOB_SWEEP_INTERVAL"`
+	S3Endpoint          string        `mapstructure:"S3_ENDPOINT"`
+	S3Region            string        `mapstructure:"S3_REGION"`
+	S3Bucket            string        `mapstructure:"S3_BUCKET"`
+	S3AccessKeyID       string        `mapstructure:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey   string        `mapstructure:"S3_SECRET_ACCESS_KEY"`
+	S3PathStyle         bool          `mapstructure:"S3_PATH_STYLE"`
+	AvatarMaxBytes      int64         `mapstructure:"AVATAR_MAX_BYTES"`
+	DocumentMaxBytes    int64         `mapstructure:"DOCUMENT_MAX_BYTES"`
+	UserNameCheckLimit  int           `mapstructure:"USER_NAME_CHECK_LIMIT"`
+	UserNameGracePeriod time.Duration `mapstructure:"USER_NAME_GRACE_PERIOD"`
+	MailSender          string        `mapstructure:"MAIL_SENDER"`
+	MailFilePath        string        `mapstructure:"MAIL_FILE_PATH"`
+	EmailLinkBaseURL    string        `mapstructure:"EMAIL_LINK_BASE_URL"`
+	EmailChangeTTL      time.Duration `mapstructure:"EMAIL_CHANGE_TTL"`
+	EmailRevertTTL      time.Duration `mapstructure:"EMAIL_REVERT_TTL"`
+	EventPublisher      string        `mapstructure:"EVENT_PUBLISHER"`
+	EventFilePath       string        `mapstructure:"EVENT_FILE_PATH"`
+	EventWebhookURL     string        `mapstructure:"EVENT_WEBHOOK_URL"`
+	EventNATSAddress    string        `mapstructure:"EVENT_NATS_ADDRESS"`
+	EventNATSSubject    string        `mapstructure:"EVENT_NATS_SUBJECT"`
+	OutboxRelayInterval time.Duration `mapstructure:"OUTBOX_RELAY_INTERVAL"`
+	OutboxRetention     time.Duration `mapstructure:"OUTBOX_RETENTION"`
+	WebhookInterval     time.Duration `mapstructure:"WEBHOOK_INTERVAL"`
+	WebhookTimeout      time.Duration `mapstructure:"WEBHOOK_TIMEOUT"`
+	WebhookMaxAttempts  int32         `mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookRetention    time.Duration `mapstructure:"WEBHOOK_RETENTION"`
+	EventStreamBuffer   int           `mapstructure:"EVENT_STREAM_BUFFER"`
+	ShutdownTimeout     time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
 	// Enable automatic environment variable reading
 	viper.AutomaticEnv()
 
+	// Optional settings need a default so viper knows to pick them up from the environment
+	viper.SetDefault("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+	viper.SetDefault("IDEMPOTENCY_SWEEP_INTERVAL", time.Hour)
+	viper.SetDefault("SOFT_DELETE_RETENTION", 30*24*time.Hour)
+	viper.SetDefault("PURGE_INTERVAL", time.Hour)
+	viper.SetDefault("IMPORT_ASYNC_ROWS", 100)
+	viper.SetDefault("IMPORT_JOB_STALE_AFTER", 5*time.Minute)
+	viper.SetDefault("IMPORT_SWEEP_INTERVAL", time.Minute)
+	viper.SetDefault("ERASURE_COOL_DOWN", 7*24*time.Hour)
+	viper.SetDefault("ERASURE_INTERVAL", time.Hour)
+	viper.SetDefault("FIELD_ENCRYPTION_KEYS", "")
+	viper.SetDefault("BLIND_INDEX_KEY", "")
+	viper.SetDefault("SMS_SENDER", "log")
+	viper.SetDefault("SMS_FILE_PATH", "")
+	viper.SetDefault("PHONE_CODE_TTL", 10*time.Minute)
+	viper.SetDefault("PHONE_CODE_LIMIT", 5)
+	viper.SetDefault("BLOB_STORE", "local")
+	viper.SetDefault("BLOB_LOCAL_DIR", "./blobs")
+	viper.SetDefault("BLOB_SWEEP_INTERVAL", time.Minute)
+	viper.SetDefault("S3_ENDPOINT", "")
+	viper.SetDefault("S3_REGION", "us-east-1")
+	viper.SetDefault("S3_BUCKET", "")
+	viper.SetDefault("S3_ACCESS_KEY_ID", "")
+	viper.SetDefault("S3_SECRET_ACCESS_KEY", "")
+	viper.SetDefault("S3_PATH_STYLE", true)
+	viper.SetDefault("AVATAR_MAX_BYTES", 5<<20)
+	viper.SetDefault("DOCUMENT_MAX_BYTES", 10<<20)
+	viper.SetDefault("USER_NAME_CHECK_LIMIT", 30)
+	viper.SetDefault("USER_NAME_GRACE_PERIOD", 30*24*time.Hour)
+	viper.SetDefault("MAIL_SENDER", "log")
+	viper.SetDefault("MAIL_FILE_PATH", "")
+	viper.SetDefault("EMAIL_LINK_BASE_URL", "http://localhost:8080")
+	viper.SetDefault("EMAIL_CHANGE_TTL", 24*time.Hour)
+	viper.SetDefault("EMAIL_REVERT_TTL", 7*24*time.Hour)
+	viper.SetDefault("EVENT_PUBLISHER", "log")
+	viper.SetDefault("EVENT_FILE_PATH", "")
+	viper.SetDefault("EVENT_WEBHOOK_URL", "")
+	viper.SetDefault("EVENT_NATS_ADDRESS", "localhost:4222")
+	viper.SetDefault("EVENT_NATS_SUBJECT", "whalewake")
+	viper.SetDefault("OUTBOX_RELAY_INTERVAL", time.Second)
+	viper.SetDefault("OUTBOX_RETENTION", 7*24*time.Hour)
+	viper.SetDefault("WEBHOOK_INTERVAL", time.Second)
+	viper.SetDefault("WEBHOOK_TIMEOUT", 10*time.Second)
+	viper.SetDefault("WEBHOOK_MAX_ATTEMPTS", 10)
+	viper.SetDefault("WEBHOOK_RETENTION", 30*24*time.Hour)
+	viper.SetDefault("EVENT_STREAM_BUFFER", 256)
+	viper.SetDefault("SHUTDOWN_TIMEOUT", 30*time.Second)
+
 	// Load environment variables from the specified path
 	viper.AddConfigPath(path)
 	viper.SetConfigName(".env")
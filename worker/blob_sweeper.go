@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"context"
+	"time"
+	"whaleWake/blobstore"
+	db "whaleWake/db/sqlc"
+)
+
+// blobSweepBatch is how many queued blobs one sweep deletes at most.
+const blobSweepBatch = 100
+
+// BlobSweeper deletes blobs that are no longer referenced, such as replaced avatars and removed documents.
+type BlobSweeper struct {
+	store    db.Store        // Store holding the queue of blobs to delete.
+	blobs    blobstore.Store // Blob store to delete from.
+	interval time.Duration   // How often the sweep runs.
+}
+
+// NewBlobSweeper creates a new BlobSweeper.
+// Parameters:
+// - store: The store holding the queue of blobs to delete.
+// - blobs: The blob store to delete from.
+// - interval: How often to run the sweep.
+// Returns:
+// - A pointer to the initialized BlobSweeper.
+func NewBlobSweeper(store db.Store, blobs blobstore.Store, interval time.Duration) *BlobSweeper {
+	return &BlobSweeper{
+		store:    store,
+		blobs:    blobs,
+		interval: interval,
+	}
+}
+
+// Run sweeps on every interval until ctx is cancelled.
+func (sweeper *BlobSweeper) Run(ctx context.Context) {
+	runEvery(ctx, sweeper.interval, "delete blobs", sweeper.SweepOnce)
+}
+
+// SweepOnce deletes queued blobs, a batch at a time, until the queue is empty or a delete fails.
+// Returns:
+// - The number of blobs deleted.
+// - An error if a blob could not be deleted or the queue could not be read.
+func (sweeper *BlobSweeper) SweepOnce(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		deleted, err := sweeper.store.SweepBlobDeletionsTx(ctx, blobSweepBatch, func(key string) error {
+			return sweeper.blobs.Delete(ctx, key)
+		})
+		total += deleted
+		if err != nil || deleted < blobSweepBatch {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"whaleWake/blobstore"
+	db "whaleWake/db/sqlc"
+)
+
+// sweepTestStore hands out its queued keys in batches and keeps the ones that fail to delete.
+type sweepTestStore struct {
+	db.Store
+	queue []string
+}
+
+func (s *sweepTestStore) SweepBlobDeletionsTx(_ context.Context, limit int32, fn func(key string) error) (int64, error) {
+	var deleted int64
+	var deleteErr error
+	var kept []string
+	for i, key := range s.queue {
+		if i >= int(limit) {
+			kept = append(kept, key)
+			continue
+		}
+		if err := fn(key); err != nil {
+			if deleteErr == nil {
+				deleteErr = err
+			}
+			kept = append(kept, key)
+			continue
+		}
+		deleted++
+	}
+	s.queue = kept
+	return deleted, deleteErr
+}
+
+// failingBlobStore refuses to delete one key.
+type failingBlobStore struct {
+	blobstore.Store
+	failKey string
+}
+
+func (s *failingBlobStore) Delete(ctx context.Context, key string) error {
+	if key == s.failKey {
+		return errors.New("unavailable")
+	}
+	return s.Store.Delete(ctx, key)
+}
+
+func TestSweepOnce(t *testing.T) {
+	ctx := context.Background()
+	local, err := blobstore.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	store := &sweepTestStore{}
+	for i := 0; i < blobSweepBatch+5; i++ {
+		key := "avatars/" + string(rune('a'+i%26)) + "/" + string(rune('a'+i/26))
+		require.NoError(t, local.Put(ctx, key, []byte("x"), "text/plain"))
+		store.queue = append(store.queue, key)
+	}
+	// A key that is already gone still counts as deleted.
+	store.queue = append(store.queue, "avatars/missing")
+
+	blobs := &failingBlobStore{Store: local, failKey: store.queue[3]}
+	sweeper := NewBlobSweeper(store, blobs, 0)
+
+	deleted, err := sweeper.SweepOnce(ctx)
+	require.Error(t, err)
+	require.Equal(t, int64(blobSweepBatch-1), deleted)
+	require.Len(t, store.queue, 7)
+
+	blobs.failKey = ""
+	deleted, err = sweeper.SweepOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), deleted)
+	require.Empty(t, store.queue)
+
+	_, err = local.Get(ctx, "avatars/a/a")
+	require.ErrorIs(t, err, blobstore.ErrNotFound)
+}
@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"context"
+	"time"
+	db "whaleWake/db/sqlc"
+)
+
+// Eraser carries out right-to-erasure requests once their cool-down has passed.
+type Eraser struct {
+	store    db.Store      // Store used to erase users.
+	interval time.Duration // How often due requests are looked for.
+	now      func() time.Time
+}
+
+// NewEraser creates a new Eraser.
+// Parameters:
+// - store: The store to erase users from.
+// - interval: How often to look for due requests.
+// Returns:
+// - A pointer to the initialized Eraser.
+func NewEraser(store db.Store, interval time.Duration) *Eraser {
+	return &Eraser{
+		store:    store,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Run erases due users on every interval until ctx is cancelled.
+func (eraser *Eraser) Run(ctx context.Context) {
+	runEvery(ctx, eraser.interval, "erase users", eraser.EraseOnce)
+}
+
+// EraseOnce carries out every erasure request that is due now.
+// Returns:
+// - The number of users erased.
+// - An error if the erasure fails.
+func (eraser *Eraser) EraseOnce(ctx context.Context) (int64, error) {
+	return eraser.store.EraseDueUsersTx(ctx, eraser.now())
+}
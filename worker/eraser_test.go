@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+)
+
+// eraseTestStore records the time it was asked to erase at.
+type eraseTestStore struct {
+	db.Store
+	now time.Time
+}
+
+func (s *eraseTestStore) EraseDueUsersTx(_ context.Context, now time.Time) (int64, error) {
+	s.now = now
+	return 1, nil
+}
+
+func TestEraseOnce(t *testing.T) {
+	store := &eraseTestStore{}
+	now := time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	eraser := NewEraser(store, time.Hour)
+	eraser.now = func() time.Time { return now }
+
+	erased, err := eraser.EraseOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), erased)
+	require.Equal(t, now, store.now)
+}
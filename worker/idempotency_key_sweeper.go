@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"context"
+	"time"
+	db "whaleWake/db/sqlc"
+)
+
+// IdempotencyKeySweeper deletes stored Idempotency-Key responses once they have expired.
+// Expired keys are already ignored when a request is replayed; the sweep only keeps the table from growing.
+type IdempotencyKeySweeper struct {
+	store    db.Store      // Store used to delete keys.
+	ttl      time.Duration // How long a key is honoured after it is first used. Zero or less keeps keys forever.
+	interval time.Duration // How often the sweep runs.
+	now      func() time.Time
+}
+
+// NewIdempotencyKeySweeper creates a new IdempotencyKeySweeper.
+// Parameters:
+// - store: The store to delete keys from.
+// - ttl: How long a key is honoured, the same as the idempotency middleware's.
+// - interval: How often to run the sweep.
+// Returns:
+// - A pointer to the initialized IdempotencyKeySweeper.
+func NewIdempotencyKeySweeper(store db.Store, ttl, interval time.Duration) *IdempotencyKeySweeper {
+	return &IdempotencyKeySweeper{
+		store:    store,
+		ttl:      ttl,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Run sweeps on every interval until ctx is cancelled.
+func (sweeper *IdempotencyKeySweeper) Run(ctx context.Context) {
+	runEvery(ctx, sweeper.interval, "delete expired idempotency keys", sweeper.SweepOnce)
+}
+
+// SweepOnce deletes every key first used before the TTL cutoff, or nothing when keys are kept forever.
+// Returns:
+// - The number of keys deleted.
+// - An error if the delete fails.
+func (sweeper *IdempotencyKeySweeper) SweepOnce(ctx context.Context) (int64, error) {
+	if sweeper.ttl <= 0 {
+		return 0, nil
+	}
+	return sweeper.store.DeleteExpiredIdempotencyKeys(ctx, sweeper.now().Add(-sweeper.ttl))
+}
@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+)
+
+// idempotencyKeyTestStore records the cutoff it was asked to delete keys with.
+type idempotencyKeyTestStore struct {
+	db.Store
+	createdBefore time.Time
+}
+
+func (s *idempotencyKeyTestStore) DeleteExpiredIdempotencyKeys(_ context.Context, createdBefore time.Time) (int64, error) {
+	s.createdBefore = createdBefore
+	return 3, nil
+}
+
+func TestIdempotencyKeySweepOnce(t *testing.T) {
+	store := &idempotencyKeyTestStore{}
+	now := time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	sweeper := NewIdempotencyKeySweeper(store, 24*time.Hour, time.Hour)
+	sweeper.now = func() time.Time { return now }
+
+	deleted, err := sweeper.SweepOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(3), deleted)
+	require.Equal(t, time.Date(2025, 6, 29, 12, 0, 0, 0, time.UTC), store.createdBefore)
+
+	// Without a TTL keys are kept forever.
+	store.createdBefore = time.Time{}
+	sweeper.ttl = 0
+	deleted, err = sweeper.SweepOnce(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+	require.True(t, store.createdBefore.IsZero())
+}
@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"time"
+	db "whaleWake/db/sqlc"
+)
+
+// staleImportJobError is the error recorded on import jobs the sweeper fails.
+const staleImportJobError = "the import stopped when the server running it went away"
+
+// ImportJobSweeper fails background imports left running by a server that stopped without finishing them.
+// A running job saves its progress every few rows, so one that hasn't for a while is no longer running anywhere.
+type ImportJobSweeper struct {
+	store      db.Store      // Store used to fail jobs.
+	staleAfter time.Duration // How long a running job can go without saving progress.
+	interval   time.Duration // How often the sweep runs.
+	now        func() time.Time
+}
+
+// NewImportJobSweeper creates a new ImportJobSweeper.
+// Parameters:
+// - store: The store to fail jobs in.
+// - staleAfter: How long a running job can go without saving progress before it is failed.
+// - interval: How often to run the sweep.
+// Returns:
+// - A pointer to the initialized ImportJobSweeper.
+func NewImportJobSweeper(store db.Store, staleAfter, interval time.Duration) *ImportJobSweeper {
+	return &ImportJobSweeper{
+		store:      store,
+		staleAfter: staleAfter,
+		interval:   interval,
+		now:        time.Now,
+	}
+}
+
+// Run sweeps right away, to fail the jobs of a previous run of the server, and then on every interval until ctx
+// is cancelled.
+func (sweeper *ImportJobSweeper) Run(ctx context.Context) {
+	runEvery(ctx, sweeper.interval, "fail stale import jobs", sweeper.SweepOnce)
+}
+
+// SweepOnce fails every running job that has not saved progress within staleAfter.
+// Returns:
+// - The number of jobs failed.
+// - An error if the update fails.
+func (sweeper *ImportJobSweeper) SweepOnce(ctx context.Context) (int64, error) {
+	return sweeper.store.FailStaleImportJobs(ctx, db.FailStaleImportJobsParams{
+		Error:         staleImportJobError,
+		UpdatedBefore: sweeper.now().Add(-sweeper.staleAfter),
+	})
+}
@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+)
+
+// importJobTestStore records the arguments it was asked to fail jobs with.
+type importJobTestStore struct {
+	db.Store
+	arg db.FailStaleImportJobsParams
+}
+
+func (s *importJobTestStore) FailStaleImportJobs(_ context.Context, arg db.FailStaleImportJobsParams) (int64, error) {
+	s.arg = arg
+	return 1, nil
+}
+
+func TestImportJobSweepOnce(t *testing.T) {
+	store := &importJobTestStore{}
+	now := time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	sweeper := NewImportJobSweeper(store, 5*time.Minute, time.Minute)
+	sweeper.now = func() time.Time { return now }
+
+	failed, err := sweeper.SweepOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), failed)
+	require.Equal(t, time.Date(2025, 6, 30, 11, 55, 0, 0, time.UTC), store.arg.UpdatedBefore)
+	require.NotEmpty(t, store.arg.Error)
+}
@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runEvery runs once right away and then on every interval until ctx is cancelled. Errors are logged and the next
+// run goes ahead as planned.
+// Parameters:
+// - ctx: Stops the loop when cancelled; also passed to every run.
+// - interval: The time between runs.
+// - name: What a run does, for the log, such as "purge deleted users".
+// - once: A single run. Returns how much it handled, which is logged when more than zero, also next to an error.
+func runEvery(ctx context.Context, interval time.Duration, name string, once func(context.Context) (int64, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		handled, err := once(ctx)
+		if err != nil {
+			log.Printf("Unable to %s: %v", name, err)
+		}
+		if handled > 0 {
+			log.Printf("%s: %d", name, handled)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
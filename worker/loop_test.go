@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRunEvery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	var runCtxs []context.Context
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runEvery(ctx, time.Millisecond, "test", func(runCtx context.Context) (int64, error) {
+			runCtxs = append(runCtxs, runCtx)
+			calls++
+			if calls == 3 {
+				cancel()
+			}
+			// A failed run doesn't stop the loop.
+			if calls == 1 {
+				return 0, errors.New("failed")
+			}
+			return 1, nil
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runEvery did not stop after ctx was cancelled")
+	}
+	require.Equal(t, 3, calls)
+	for _, runCtx := range runCtxs {
+		require.Equal(t, ctx, runCtx)
+	}
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/events"
+)
+
+// outboxRelayBatch is how many events one transaction of the relay publishes at most.
+const outboxRelayBatch = 100
+
+// OutboxRelay publishes the user lifecycle events recorded in the outbox and removes them once they are older
+// than the retention window.
+type OutboxRelay struct {
+	store     db.Store         // Store holding the outbox.
+	publisher events.Publisher // Publisher the events go to.
+	interval  time.Duration    // How often the relay runs.
+	retention time.Duration    // How long published events are kept.
+	now       func() time.Time
+}
+
+// NewOutboxRelay creates a new OutboxRelay.
+// Parameters:
+// - store: The store holding the outbox.
+// - publisher: The publisher to send events to.
+// - interval: How often to look for new events.
+// - retention: How long published events are kept.
+// Returns:
+// - A pointer to the initialized OutboxRelay.
+func NewOutboxRelay(store db.Store, publisher events.Publisher, interval, retention time.Duration) *OutboxRelay {
+	return &OutboxRelay{
+		store:     store,
+		publisher: publisher,
+		interval:  interval,
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// Run relays on every interval until ctx is cancelled.
+func (relay *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relay.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := relay.RelayOnce(ctx); err != nil {
+			log.Println("Unable to publish outbox events:", err)
+		}
+
+		if _, err := relay.store.PurgePublishedOutboxEvents(ctx, relay.now().Add(-relay.retention)); err != nil {
+			log.Println("Unable to remove published outbox events:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publishes due events, a batch at a time, until none are left or publishing fails.
+// A user's events go out one per batch, in order, so a user with many events takes several batches.
+// Returns:
+// - The number of events published.
+// - An error if an event could not be published or the outbox could not be read.
+func (relay *OutboxRelay) RelayOnce(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		published, err := relay.store.RelayOutboxTx(ctx, outboxRelayBatch, relay.now(), func(event db.Outbox) error {
+			return relay.publisher.Publish(ctx, events.Event{
+				ID:         event.ID,
+				Type:       event.EventType,
+				UserID:     event.UserID,
+				OccurredAt: event.CreatedAt,
+				Data:       event.Data,
+			})
+		})
+		total += published
+		if err != nil || published == 0 {
+			return total, err
+		}
+	}
+}
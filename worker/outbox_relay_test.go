@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/events"
+	"whaleWake/util"
+)
+
+// relayTestStore hands out the oldest unpublished event of each user, the way ListDueOutboxEvents does.
+type relayTestStore struct {
+	db.Store
+	outbox    []db.Outbox
+	published map[int64]bool
+}
+
+func (s *relayTestStore) RelayOutboxTx(_ context.Context, limit int32, _ time.Time, fn func(db.Outbox) error) (int64, error) {
+	var published int64
+	var publishErr error
+	seen := map[uuid.UUID]bool{}
+	for _, event := range s.outbox {
+		if s.published[event.ID] || seen[event.UserID] || len(seen) >= int(limit) {
+			continue
+		}
+		seen[event.UserID] = true
+		if err := fn(event); err != nil {
+			if publishErr == nil {
+				publishErr = err
+			}
+			continue
+		}
+		s.published[event.ID] = true
+		published++
+	}
+	return published, publishErr
+}
+
+// recordingPublisher keeps the events it publishes and fails for one user.
+type recordingPublisher struct {
+	events   []events.Event
+	failUser uuid.UUID
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event events.Event) error {
+	if event.UserID == p.failUser {
+		return errors.New("unavailable")
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestRelayOnce(t *testing.T) {
+	ahab, ishmael := util.RandomUUID(), util.RandomUUID()
+	store := &relayTestStore{published: map[int64]bool{}}
+	for i, userID := range []uuid.UUID{ahab, ishmael, ahab, ahab, ishmael} {
+		store.outbox = append(store.outbox, db.Outbox{ID: int64(i + 1), EventType: db.EventUserUpdated, UserID: userID})
+	}
+
+	publisher := &recordingPublisher{failUser: ishmael}
+	relay := NewOutboxRelay(store, publisher, 0, 0)
+
+	// Ahab's events go out in order while Ishmael's wait for the failed one.
+	published, err := relay.RelayOnce(context.Background())
+	require.Error(t, err)
+	require.Equal(t, int64(1), published)
+
+	publisher.failUser = uuid.Nil
+	published, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(4), published)
+
+	var ahabIDs, ishmaelIDs []int64
+	for _, event := range publisher.events {
+		if event.UserID == ahab {
+			ahabIDs = append(ahabIDs, event.ID)
+		} else {
+			ishmaelIDs = append(ishmaelIDs, event.ID)
+		}
+	}
+	require.Equal(t, []int64{1, 3, 4}, ahabIDs)
+	require.Equal(t, []int64{2, 5}, ishmaelIDs)
+}
@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"context"
+	"time"
+	db "whaleWake/db/sqlc"
+)
+
+// Purger permanently removes soft-deleted users once they are older than the retention window.
+type Purger struct {
+	store     db.Store      // Store used to purge rows.
+	retention time.Duration // How long soft-deleted rows are kept before being purged.
+	interval  time.Duration // How often the purge runs.
+	now       func() time.Time
+}
+
+// NewPurger creates a new Purger.
+// Parameters:
+// - store: The store to purge from.
+// - retention: How long soft-deleted rows are kept.
+// - interval: How often to run the purge.
+// Returns:
+// - A pointer to the initialized Purger.
+func NewPurger(store db.Store, retention, interval time.Duration) *Purger {
+	return &Purger{
+		store:     store,
+		retention: retention,
+		interval:  interval,
+		now:       time.Now,
+	}
+}
+
+// Run purges on every interval until ctx is cancelled.
+func (purger *Purger) Run(ctx context.Context) {
+	runEvery(ctx, purger.interval, "purge deleted users", purger.PurgeOnce)
+}
+
+// PurgeOnce removes every user soft deleted before the retention cutoff.
+// Returns:
+// - The number of users removed.
+// - An error if the purge fails.
+func (purger *Purger) PurgeOnce(ctx context.Context) (int64, error) {
+	return purger.store.PurgeDeletedUsersTx(ctx, purger.now().Add(-purger.retention))
+}
@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+)
+
+// purgeTestStore records the cutoff it was asked to purge with.
+type purgeTestStore struct {
+	db.Store
+	deletedBefore time.Time
+}
+
+func (s *purgeTestStore) PurgeDeletedUsersTx(_ context.Context, deletedBefore time.Time) (int64, error) {
+	s.deletedBefore = deletedBefore
+	return 2, nil
+}
+
+func TestPurgeOnce(t *testing.T) {
+	store := &purgeTestStore{}
+	now := time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	purger := NewPurger(store, 30*24*time.Hour, time.Hour)
+	purger.now = func() time.Time { return now }
+
+	purged, err := purger.PurgeOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(2), purged)
+	require.Equal(t, time.Date(2025, 5, 31, 12, 0, 0, 0, time.UTC), store.deletedBefore)
+}
@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/events"
+)
+
+// webhookDispatchBatch is how many deliveries one transaction of the dispatcher attempts at most.
+const webhookDispatchBatch = 50
+
+// WebhookDispatcher sends the pending webhook deliveries to their subscriptions and removes delivered ones once
+// they are older than the retention window.
+type WebhookDispatcher struct {
+	store       db.Store              // Store holding the deliveries.
+	sender      *events.WebhookSender // Signs and posts deliveries.
+	interval    time.Duration         // How often the dispatcher runs.
+	maxAttempts int32                 // How many failed attempts make a delivery dead.
+	retention   time.Duration         // How long delivered deliveries are kept.
+	now         func() time.Time
+}
+
+// NewWebhookDispatcher creates a new WebhookDispatcher.
+// Parameters:
+// - store: The store holding the deliveries.
+// - sender: The sender to post deliveries with.
+// - interval: How often to look for due deliveries.
+// - maxAttempts: How many failed attempts make a delivery dead.
+// - retention: How long delivered deliveries are kept for the delivery log.
+// Returns:
+// - A pointer to the initialized WebhookDispatcher.
+func NewWebhookDispatcher(store db.Store, sender *events.WebhookSender, interval time.Duration, maxAttempts int32, retention time.Duration) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		store:       store,
+		sender:      sender,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		retention:   retention,
+		now:         time.Now,
+	}
+}
+
+// Run dispatches on every interval until ctx is cancelled.
+func (dispatcher *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(dispatcher.interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := dispatcher.DispatchOnce(ctx)
+		if err != nil {
+			log.Println("Unable to send webhook deliveries:", err)
+		}
+		if failed := result.Attempted - result.Delivered; failed > 0 {
+			log.Printf("%d webhook deliveries failed, %d of them for the last time", failed, result.Dead)
+		}
+
+		if _, err = dispatcher.store.PurgeDeliveredWebhookDeliveries(ctx, dispatcher.now().Add(-dispatcher.retention)); err != nil {
+			log.Println("Unable to remove delivered webhook deliveries:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce attempts due deliveries, a batch at a time, until a batch comes back short.
+// Returns:
+// - What happened to the deliveries, over all batches.
+// - An error if the deliveries could not be read or their outcome recorded.
+func (dispatcher *WebhookDispatcher) DispatchOnce(ctx context.Context) (db.WebhookDispatchResult, error) {
+	var total db.WebhookDispatchResult
+	for {
+		arg := db.DeliverWebhooksParams{
+			Limit:       webhookDispatchBatch,
+			Now:         dispatcher.now(),
+			MaxAttempts: dispatcher.maxAttempts,
+		}
+		result, err := dispatcher.store.DeliverWebhooksTx(ctx, arg, func(row db.ListDueWebhookDeliveriesRow) (int, error) {
+			delivery := row.WebhookDelivery
+			return dispatcher.sender.Send(ctx, row.Url, row.Secret, delivery.ID, events.Event{
+				ID:         delivery.EventID,
+				Type:       delivery.EventType,
+				UserID:     delivery.UserID,
+				OccurredAt: delivery.OccurredAt,
+				Data:       delivery.Data,
+			})
+		})
+		total.Attempted += result.Attempted
+		total.Delivered += result.Delivered
+		total.Dead += result.Dead
+		if err != nil || result.Attempted < webhookDispatchBatch {
+			return total, err
+		}
+	}
+}
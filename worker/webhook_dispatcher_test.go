@@ -0,0 +1,110 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	db "whaleWake/db/sqlc"
+	"whaleWake/events"
+	"whaleWake/util"
+)
+
+// dispatchTestStore hands out its due pending deliveries and records attempts the way DeliverWebhooksTx does.
+type dispatchTestStore struct {
+	db.Store
+	deliveries []db.WebhookDelivery
+	url        string
+	secret     string
+}
+
+func (s *dispatchTestStore) DeliverWebhooksTx(_ context.Context, arg db.DeliverWebhooksParams, fn func(db.ListDueWebhookDeliveriesRow) (int, error)) (db.WebhookDispatchResult, error) {
+	var result db.WebhookDispatchResult
+	for i := range s.deliveries {
+		delivery := &s.deliveries[i]
+		if delivery.Status != db.WebhookDeliveryPending || delivery.NextAttemptAt.After(arg.Now) || result.Attempted >= int64(arg.Limit) {
+			continue
+		}
+
+		status, err := fn(db.ListDueWebhookDeliveriesRow{WebhookDelivery: *delivery, Url: s.url, Secret: s.secret})
+		result.Attempted++
+		delivery.Attempts++
+		delivery.LastStatusCode = int32(status)
+		switch {
+		case err == nil:
+			delivery.Status = db.WebhookDeliveryDelivered
+			result.Delivered++
+		case delivery.Attempts >= arg.MaxAttempts:
+			delivery.Status = db.WebhookDeliveryDead
+			result.Dead++
+		default:
+			delivery.NextAttemptAt = arg.Now.Add(time.Minute)
+		}
+	}
+	return result, nil
+}
+
+func TestDispatchOnce(t *testing.T) {
+	const secret = "whsec_dispatch-test"
+	userID := util.RandomUUID()
+	failing := map[string]bool{}
+	var received []events.Event
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		err = events.VerifySignature(secret, r.Header.Get(events.HeaderWebhookTimestamp), r.Header.Get(events.HeaderWebhookSignature), body, time.Minute, time.Now())
+		require.NoError(t, err)
+
+		if failing[r.Header.Get(events.HeaderWebhookID)] {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var event events.Event
+		require.NoError(t, json.Unmarshal(body, &event))
+		received = append(received, event)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	store := &dispatchTestStore{url: receiver.URL, secret: secret}
+	for id := int64(1); id <= 3; id++ {
+		store.deliveries = append(store.deliveries, db.WebhookDelivery{
+			ID:        id,
+			EventID:   100 + id,
+			EventType: db.EventUserUpdated,
+			UserID:    userID,
+			Data:      json.RawMessage(`{"version": 2}`),
+			Status:    db.WebhookDeliveryPending,
+		})
+	}
+
+	dispatcher := NewWebhookDispatcher(store, events.NewWebhookSender(time.Second), 0, 2, 0)
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+
+	// The second delivery fails twice and is dead; the others are delivered on the first attempt.
+	failing["2"] = true
+	result, err := dispatcher.DispatchOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, db.WebhookDispatchResult{Attempted: 3, Delivered: 2}, result)
+	require.Len(t, received, 2)
+	require.Equal(t, int64(101), received[0].ID)
+	require.Equal(t, userID, received[0].UserID)
+	require.JSONEq(t, `{"version": 2}`, string(received[0].Data))
+
+	result, err = dispatcher.DispatchOnce(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, result.Attempted, "the failed delivery waits for its backoff")
+
+	now = now.Add(time.Hour)
+	result, err = dispatcher.DispatchOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, db.WebhookDispatchResult{Attempted: 1, Dead: 1}, result)
+	require.Equal(t, db.WebhookDeliveryDead, store.deliveries[1].Status)
+	require.Equal(t, int32(http.StatusInternalServerError), store.deliveries[1].LastStatusCode)
+}